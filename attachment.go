@@ -0,0 +1,17 @@
+package cmds
+
+import (
+	"io"
+)
+
+// Attachment is a value emitted together with a binary stream, e.g. an
+// object descriptor and the content of the object, so commands can return
+// both in one response.
+//
+// The HTTP transport sends the value and the data as related parts of a
+// multipart response. On the client, Data is the body of the part and can
+// only be read until the next value of the response is requested.
+type Attachment struct {
+	Value interface{}
+	Data  io.Reader
+}
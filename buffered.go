@@ -0,0 +1,231 @@
+package cmds
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// BufferOptions configures a buffered emitter, see NewBufferedEmitter.
+type BufferOptions struct {
+	// Size is the number of values sent to the underlying emitter at once.
+	// Emit blocks while Size values wait for the previous batch to be
+	// sent, so at most twice Size values are held. It defaults to 1.
+	Size int
+	// FlushInterval is the longest time a value waits for its batch to
+	// fill up. Zero means values are only sent once Size values were
+	// emitted, the emitter is flushed or it is closed.
+	FlushInterval time.Duration
+}
+
+// BufferedEmitter is a ResponseEmitter returned by NewBufferedEmitter.
+type BufferedEmitter interface {
+	ResponseEmitter
+	Flusher
+}
+
+// NewBufferedEmitter returns a ResponseEmitter for commands emitting many
+// small values. It collects the values into batches that are sent to re
+// with EmitAll in the background, so the command doesn't wait for re while
+// a batch fills up and frontends like the HTTP handler write and flush a
+// batch at once. Flush sends the values emitted so far right away.
+//
+// Single and io.Reader values are sent on their own, after the values
+// emitted before them. Commands must close the returned emitter instead of
+// re, closing waits until the buffered values were sent and then closes re.
+func NewBufferedEmitter(re ResponseEmitter, opts BufferOptions) BufferedEmitter {
+	if opts.Size < 1 {
+		opts.Size = 1
+	}
+
+	bre := &bufferedEmitter{
+		ResponseEmitter: re,
+		opts:            opts,
+		buf:             make([]interface{}, 0, opts.Size),
+		wake:            make(chan struct{}, 1),
+		done:            make(chan struct{}),
+	}
+	bre.cond = sync.NewCond(&bre.l)
+	go bre.forward()
+
+	return bre
+}
+
+type bufferedEmitter struct {
+	ResponseEmitter
+	opts BufferOptions
+
+	// wake is signaled when a batch is full, the emitter is flushed or it
+	// was closed.
+	wake chan struct{}
+	// done is closed when forward returns.
+	done chan struct{}
+
+	l sync.Mutex
+	// cond is broadcast when a batch was taken or sent.
+	cond *sync.Cond
+	buf  []interface{}
+	// emitted and sent count the values buffered and sent, so Flush knows
+	// when the values emitted before it were sent.
+	emitted, sent uint64
+	flush         bool
+	closed        bool
+	// err is the error sending a batch to the underlying emitter failed
+	// with.
+	err error
+}
+
+func (re *bufferedEmitter) Emit(v interface{}) error {
+	// channel emission iteration
+	if ch, ok := v.(chan interface{}); ok {
+		v = (<-chan interface{})(ch)
+	}
+	if ch, isChan := v.(<-chan interface{}); isChan {
+		return EmitChan(re, ch)
+	}
+
+	switch v.(type) {
+	case Single, io.Reader:
+		if err := re.Flush(); err != nil {
+			return err
+		}
+		return re.ResponseEmitter.Emit(v)
+	}
+
+	re.l.Lock()
+	defer re.l.Unlock()
+	return re.push(v)
+}
+
+func (re *bufferedEmitter) EmitAll(vs []interface{}) error {
+	for _, v := range vs {
+		switch v.(type) {
+		case chan interface{}, <-chan interface{}, Single, io.Reader:
+			for _, v := range vs {
+				if err := re.Emit(v); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	re.l.Lock()
+	defer re.l.Unlock()
+	for _, v := range vs {
+		if err := re.push(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// push buffers v, waiting while the batch is full. The lock must be held.
+func (re *bufferedEmitter) push(v interface{}) error {
+	for len(re.buf) == re.opts.Size && re.err == nil && !re.closed {
+		re.cond.Wait()
+	}
+	if re.closed {
+		return ErrClosedEmitter
+	}
+	if re.err != nil {
+		return re.err
+	}
+
+	re.buf = append(re.buf, v)
+	re.emitted++
+	if len(re.buf) == re.opts.Size {
+		re.signal()
+	}
+	return nil
+}
+
+func (re *bufferedEmitter) signal() {
+	select {
+	case re.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Flush waits until the values emitted before were sent to the underlying
+// emitter.
+func (re *bufferedEmitter) Flush() error {
+	re.l.Lock()
+	defer re.l.Unlock()
+
+	target := re.emitted
+	re.flush = true
+	re.signal()
+	for re.sent < target && re.err == nil {
+		re.cond.Wait()
+	}
+	return re.err
+}
+
+// forward sends the batches to the underlying emitter until the emitter is
+// closed and the buffer is empty.
+func (re *bufferedEmitter) forward() {
+	defer close(re.done)
+
+	var tick <-chan time.Time
+	if re.opts.FlushInterval > 0 {
+		ticker := time.NewTicker(re.opts.FlushInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		re.l.Lock()
+		if len(re.buf) < re.opts.Size && !re.flush && !re.closed {
+			re.l.Unlock()
+			select {
+			case <-re.wake:
+			case <-tick:
+			}
+			re.l.Lock()
+		}
+
+		batch, closed := re.buf, re.closed
+		re.buf = make([]interface{}, 0, re.opts.Size)
+		re.flush = false
+		re.cond.Broadcast()
+		re.l.Unlock()
+
+		var err error
+		if len(batch) > 0 {
+			err = EmitAll(re.ResponseEmitter, batch)
+		}
+
+		re.l.Lock()
+		re.sent += uint64(len(batch))
+		if err != nil {
+			re.err = err
+			re.buf = re.buf[:0]
+		}
+		re.cond.Broadcast()
+		re.l.Unlock()
+
+		if err != nil || (closed && len(batch) == 0) {
+			return
+		}
+	}
+}
+
+func (re *bufferedEmitter) Close() error {
+	return re.CloseWithError(nil)
+}
+
+func (re *bufferedEmitter) CloseWithError(err error) error {
+	re.l.Lock()
+	if re.closed {
+		re.l.Unlock()
+		return ErrClosingClosedEmitter
+	}
+	re.closed = true
+	re.signal()
+	re.cond.Broadcast()
+	re.l.Unlock()
+
+	<-re.done
+	return re.ResponseEmitter.CloseWithError(err)
+}
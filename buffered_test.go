@@ -0,0 +1,156 @@
+package cmds
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// batchRecorder records the batches emitted to it. It blocks in EmitAll
+// while block is set.
+type batchRecorder struct {
+	l       sync.Mutex
+	batches [][]interface{}
+	closed  error
+	block   chan struct{}
+	err     error
+}
+
+func (r *batchRecorder) EmitAll(vs []interface{}) error {
+	if r.block != nil {
+		<-r.block
+	}
+
+	r.l.Lock()
+	defer r.l.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	r.batches = append(r.batches, append([]interface{}(nil), vs...))
+	return nil
+}
+
+func (r *batchRecorder) Emit(v interface{}) error {
+	return r.EmitAll([]interface{}{v})
+}
+
+func (r *batchRecorder) Close() error                   { return r.CloseWithError(nil) }
+func (r *batchRecorder) CloseWithError(err error) error { r.closed = err; return nil }
+func (r *batchRecorder) SetLength(uint64)               {}
+
+func (r *batchRecorder) sizes() []int {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	var sizes []int
+	for _, b := range r.batches {
+		sizes = append(sizes, len(b))
+	}
+	return sizes
+}
+
+func TestBufferedEmitterBatches(t *testing.T) {
+	rec := &batchRecorder{}
+	re := NewBufferedEmitter(rec, BufferOptions{Size: 4})
+
+	for i := 0; i < 10; i++ {
+		if err := re.Emit(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := re.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	// the reader is sent on its own, after the buffered values
+	re.Emit(strings.NewReader("data"))
+	re.Emit(10)
+	closeErr := errors.New("failed")
+	if err := re.CloseWithError(closeErr); err != nil {
+		t.Fatal(err)
+	}
+
+	var values []interface{}
+	for _, b := range rec.batches {
+		values = append(values, b...)
+	}
+	if len(values) != 12 || values[9] != 9 || values[11] != 10 {
+		t.Fatalf("expected the values in order, got %v", values)
+	}
+	if _, ok := values[10].(*strings.Reader); !ok {
+		t.Errorf("expected the reader after the flushed values, got %v", values)
+	}
+	sizes := rec.sizes()
+	if sizes[0] != 4 || sizes[1] != 4 || sizes[2] != 2 {
+		t.Errorf("expected batches of 4 until the flush, got %v", sizes)
+	}
+	if rec.closed != closeErr {
+		t.Errorf("expected the emitter closed with %v, got %v", closeErr, rec.closed)
+	}
+	if err := re.Emit(1); err != ErrClosedEmitter {
+		t.Errorf("expected ErrClosedEmitter, got %v", err)
+	}
+	if err := re.Close(); err != ErrClosingClosedEmitter {
+		t.Errorf("expected ErrClosingClosedEmitter, got %v", err)
+	}
+}
+
+func TestBufferedEmitterFlushInterval(t *testing.T) {
+	rec := &batchRecorder{}
+	re := NewBufferedEmitter(rec, BufferOptions{Size: 100, FlushInterval: 10 * time.Millisecond})
+	defer re.Close()
+
+	re.Emit("a")
+	re.Emit("b")
+	deadline := time.Now().Add(time.Second)
+	for len(rec.sizes()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if sizes := rec.sizes(); len(sizes) != 1 || sizes[0] != 2 {
+		t.Errorf("expected the values sent in one batch after the interval, got %v", sizes)
+	}
+}
+
+func TestBufferedEmitterBackpressure(t *testing.T) {
+	rec := &batchRecorder{block: make(chan struct{})}
+	re := NewBufferedEmitter(rec, BufferOptions{Size: 2})
+
+	// one batch is being sent and one is full, the next value waits
+	emitted := make(chan int, 10)
+	go func() {
+		for i := 0; i < 5; i++ {
+			re.Emit(i)
+			emitted <- i
+		}
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if n := len(emitted); n != 4 {
+		t.Errorf("expected 4 values emitted while the consumer blocks, got %d", n)
+	}
+
+	close(rec.block)
+	for i := 0; i < 5; i++ {
+		<-emitted
+	}
+	re.Close()
+
+	if sizes := rec.sizes(); len(sizes) != 3 {
+		t.Errorf("expected 3 batches, got %v", sizes)
+	}
+}
+
+func TestBufferedEmitterError(t *testing.T) {
+	failed := errors.New("connection lost")
+	rec := &batchRecorder{err: failed}
+	re := NewBufferedEmitter(rec, BufferOptions{Size: 1})
+
+	re.Emit(1)
+	if err := re.Flush(); err != failed {
+		t.Errorf("expected the error of the consumer from Flush, got %v", err)
+	}
+	if err := re.Emit(2); err != failed {
+		t.Errorf("expected the error of the consumer from Emit, got %v", err)
+	}
+	re.Close()
+}
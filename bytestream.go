@@ -0,0 +1,89 @@
+package cmds
+
+import (
+	"bytes"
+	"io"
+	"strings"
+)
+
+// WriterFromEmitter returns an io.Writer emitting every write to re as a
+// []byte value, for commands producing a byte stream, e.g. by passing the
+// writer to an encoder or io.Copy. The written data is copied, so callers
+// may reuse their buffers. Closing re is left to the caller.
+//
+// Commands emitting a single stream should rather emit an io.Reader, which
+// transports send without encoding.
+func WriterFromEmitter(re ResponseEmitter) io.Writer {
+	return emitterWriter{re: re}
+}
+
+type emitterWriter struct {
+	re ResponseEmitter
+}
+
+func (w emitterWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	chunk := make([]byte, len(p))
+	copy(chunk, p)
+	if err := w.re.Emit(chunk); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// ReaderFromResponse returns an io.Reader reading the values of res as one
+// byte stream, for consumers dealing in bytes. io.Reader values are read
+// to their end, []byte and string values are read as they are. Other
+// values fail the read with ErrIncorrectType. Once the response ended, the
+// reader returns io.EOF, or the error of the response.
+func ReaderFromResponse(res Response) io.Reader {
+	return &responseReader{res: res}
+}
+
+type responseReader struct {
+	res Response
+	// cur is the reader of the current value, nil if the next value has to
+	// be fetched.
+	cur io.Reader
+	err error
+}
+
+func (r *responseReader) Read(p []byte) (int, error) {
+	for r.err == nil {
+		if r.cur == nil {
+			v, err := r.res.Next()
+			if err != nil {
+				r.err = err
+				break
+			}
+
+			switch v := Unwrap(v).(type) {
+			case io.Reader:
+				r.cur = v
+			case []byte:
+				r.cur = bytes.NewReader(v)
+			case *[]byte:
+				r.cur = bytes.NewReader(*v)
+			case string:
+				r.cur = strings.NewReader(v)
+			default:
+				r.err = ErrIncorrectType
+				return 0, r.err
+			}
+		}
+
+		n, err := r.cur.Read(p)
+		if err == io.EOF {
+			r.cur = nil
+			err = nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+
+	return 0, r.err
+}
@@ -0,0 +1,62 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestByteStreamAdapters(t *testing.T) {
+	req, err := NewRequest(context.Background(), nil, nil, nil, nil, &Command{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	re, res := NewChanResponsePair(req)
+	go func() {
+		w := WriterFromEmitter(re)
+		buf := []byte("chunk ")
+		w.Write(buf)
+		// the emitted chunk is a copy
+		copy(buf, "xxxxx ")
+
+		fmt.Fprintf(w, "%d ", 42)
+		re.Emit(strings.NewReader("reader "))
+		re.Emit("string")
+		re.Close()
+	}()
+
+	data, err := ioutil.ReadAll(ReaderFromResponse(res))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "chunk 42 reader string"; string(data) != expected {
+		t.Errorf("expected %q but got %q", expected, data)
+	}
+}
+
+func TestReaderFromResponseIncorrectType(t *testing.T) {
+	req, err := NewRequest(context.Background(), nil, nil, nil, nil, &Command{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	re, res := NewChanResponsePair(req)
+	go func() {
+		re.Emit("ok")
+		re.Emit(1)
+		re.Close()
+	}()
+
+	data, err := ioutil.ReadAll(ReaderFromResponse(res))
+	if err != ErrIncorrectType || string(data) != "ok" {
+		t.Errorf("expected %q and ErrIncorrectType, got %q, %v", "ok", data, err)
+	}
+
+	if _, err := ReaderFromResponse(res).Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("expected EOF after the response ended, got %v", err)
+	}
+}
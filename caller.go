@@ -0,0 +1,34 @@
+package cmds
+
+import (
+	"context"
+)
+
+// Caller identifies the program that sent a request, as far as it told.
+// It is meant for support and debugging: a caller can claim to be anything,
+// so it must not be used to make access decisions.
+type Caller struct {
+	// UserAgent is the user agent of the HTTP client.
+	UserAgent string
+	// App and AppVersion name the application using the client.
+	App        string
+	AppVersion string
+}
+
+type callerKey struct{}
+
+// ContextWithCaller returns a context carrying c.
+func ContextWithCaller(ctx context.Context, c *Caller) context.Context {
+	return context.WithValue(ctx, callerKey{}, c)
+}
+
+// CallerFromContext returns the Caller attached to ctx, or nil if the
+// request didn't come in over the network.
+func CallerFromContext(ctx context.Context) *Caller {
+	if ctx == nil {
+		return nil
+	}
+
+	c, _ := ctx.Value(callerKey{}).(*Caller)
+	return c
+}
@@ -0,0 +1,272 @@
+package cbor
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// vectors from RFC 7049, Appendix A
+func TestMarshalVectors(t *testing.T) {
+	tcs := []struct {
+		v   interface{}
+		hex string
+	}{
+		{v: 0, hex: "00"},
+		{v: 23, hex: "17"},
+		{v: 24, hex: "1818"},
+		{v: 1000, hex: "1903e8"},
+		{v: uint64(1000000000000), hex: "1b000000e8d4a51000"},
+		{v: -1, hex: "20"},
+		{v: -1000, hex: "3903e7"},
+		{v: 1.1, hex: "fb3ff199999999999a"},
+		{v: float32(100000), hex: "fa47c35000"},
+		{v: false, hex: "f4"},
+		{v: true, hex: "f5"},
+		{v: nil, hex: "f6"},
+		{v: []byte{1, 2, 3, 4}, hex: "4401020304"},
+		{v: "", hex: "60"},
+		{v: "IETF", hex: "6449455446"},
+		{v: "ü", hex: "62c3bc"},
+		{v: []int{}, hex: "80"},
+		{v: []interface{}{1, []int{2, 3}, []int{4, 5}}, hex: "8301820203820405"},
+		{v: map[string]interface{}{"a": 1, "b": []int{2, 3}}, hex: "a26161016162820203"},
+		{v: map[int]int{3: 4, 1: 2}, hex: "a201020304"},
+		{v: []int(nil), hex: "f6"},
+	}
+
+	for _, tc := range tcs {
+		data, err := Marshal(tc.v)
+		if err != nil {
+			t.Errorf("%#v: unexpected error: %s", tc.v, err)
+			continue
+		}
+		if hex.EncodeToString(data) != tc.hex {
+			t.Errorf("%#v: expected %s but got %x", tc.v, tc.hex, data)
+		}
+	}
+}
+
+func TestUnmarshalVectors(t *testing.T) {
+	tcs := []struct {
+		hex string
+		v   interface{}
+	}{
+		{hex: "00", v: uint64(0)},
+		{hex: "1bffffffffffffffff", v: uint64(math.MaxUint64)},
+		{hex: "3903e7", v: int64(-1000)},
+		{hex: "f93c00", v: 1.0},
+		{hex: "f9c400", v: -4.0},
+		{hex: "f90001", v: 5.960464477539063e-8},
+		{hex: "f97c00", v: math.Inf(1)},
+		{hex: "fa47c35000", v: 100000.0},
+		{hex: "f6", v: nil},
+		{hex: "f7", v: nil},
+		// tagged date/time string
+		{hex: "c074323031332d30332d32315432303a30343a30305a", v: "2013-03-21T20:04:00Z"},
+		{hex: "5f42010243030405ff", v: []byte{1, 2, 3, 4, 5}},
+		{hex: "7f657374726561646d696e67ff", v: "streaming"},
+		{hex: "9f018202039f0405ffff", v: []interface{}{uint64(1), []interface{}{uint64(2), uint64(3)}, []interface{}{uint64(4), uint64(5)}}},
+		{hex: "bf61610161629f0203ffff", v: map[string]interface{}{"a": uint64(1), "b": []interface{}{uint64(2), uint64(3)}}},
+		{hex: "a201020304", v: map[interface{}]interface{}{uint64(1): uint64(2), uint64(3): uint64(4)}},
+	}
+
+	for _, tc := range tcs {
+		var v interface{}
+		if err := Unmarshal(mustHex(t, tc.hex), &v); err != nil {
+			t.Errorf("%s: unexpected error: %s", tc.hex, err)
+			continue
+		}
+		if !reflect.DeepEqual(v, tc.v) {
+			t.Errorf("%s: expected %#v but got %#v", tc.hex, tc.v, v)
+		}
+	}
+}
+
+type Embedded struct {
+	Inner string
+	Outer string
+}
+
+type text struct {
+	s string
+}
+
+func (t text) MarshalText() ([]byte, error) {
+	return []byte("text:" + t.s), nil
+}
+
+func (t *text) UnmarshalText(b []byte) error {
+	t.s = strings.TrimPrefix(string(b), "text:")
+	return nil
+}
+
+type custom int
+
+func (c custom) MarshalCBOR() ([]byte, error) {
+	return Marshal(map[string]int{"custom": int(c)})
+}
+
+func (c *custom) UnmarshalCBOR(data []byte) error {
+	var m map[string]int
+	if err := Unmarshal(data, &m); err != nil {
+		return err
+	}
+	*c = custom(m["custom"])
+	return nil
+}
+
+type record struct {
+	*Embedded
+	Outer      int
+	Name       string         `json:"name"`
+	Renamed    string         `cbor:"r" json:"ignored"`
+	Empty      string         `json:",omitempty"`
+	Skipped    string         `json:"-"`
+	Data       []byte         `json:"data"`
+	Ptr        *int           `json:"ptr"`
+	List       []float64      `json:"list"`
+	Map        map[string]int `json:"map"`
+	Text       text           `json:"text"`
+	Custom     custom         `json:"custom"`
+	Any        interface{}    `json:"any"`
+	unexported int
+}
+
+func TestRoundTripStruct(t *testing.T) {
+	n := -7
+	in := record{
+		Embedded: &Embedded{Inner: "in", Outer: "shadowed"},
+		Outer:    3,
+		Name:     "name",
+		Renamed:  "renamed",
+		Skipped:  "skipped",
+		Data:     []byte{0, 1, 2},
+		Ptr:      &n,
+		List:     []float64{0.5, -2},
+		Map:      map[string]int{"x": 1},
+		Text:     text{s: "hi"},
+		Custom:   42,
+		Any:      "any",
+	}
+
+	data, err := Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var keys map[string]interface{}
+	if err := Unmarshal(data, &keys); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{"Empty", "Skipped", "ignored", "unexported"} {
+		if _, ok := keys[k]; ok {
+			t.Errorf("expected key %q to be omitted", k)
+		}
+	}
+	if keys["Outer"] != uint64(3) {
+		t.Errorf("expected the outer field to shadow the embedded one, got %#v", keys["Outer"])
+	}
+	if keys["text"] != "text:hi" {
+		t.Errorf("expected the text marshaler to be used, got %#v", keys["text"])
+	}
+
+	var out record
+	if err := Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	in.Skipped = ""
+	in.Embedded.Outer = ""
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("expected\n%#v\nbut got\n%#v", in, out)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	var s string
+	if err := Unmarshal(mustHex(t, "01"), &s); err == nil {
+		t.Error("expected a type error")
+	} else if _, ok := err.(*UnmarshalTypeError); !ok {
+		t.Errorf("expected an UnmarshalTypeError, got %T", err)
+	}
+
+	var u8 uint8
+	if err := Unmarshal(mustHex(t, "190100"), &u8); err == nil {
+		t.Error("expected an overflow error")
+	}
+
+	var v interface{}
+	for _, h := range []string{"", "62c3", "8201", "ff", "0000"} {
+		if err := Unmarshal(mustHex(t, h), &v); err == nil {
+			t.Errorf("%q: expected an error", h)
+		}
+	}
+
+	if err := Unmarshal(mustHex(t, "00"), v); err == nil {
+		t.Error("expected an error for a non-pointer")
+	}
+
+	if err := Unmarshal([]byte(strings.Repeat("\x81", maxDepth+2)+"\x00"), &v); err != errTooDeep {
+		t.Errorf("expected %v but got %v", errTooDeep, err)
+	}
+}
+
+func TestUnmarshalNull(t *testing.T) {
+	n := 1
+	v := struct {
+		Ptr  *int
+		List []int
+	}{&n, []int{1}}
+
+	if err := Unmarshal(mustHex(t, "a263507472f6644c697374f6"), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Ptr != nil || v.List != nil {
+		t.Errorf("expected null to reset the fields, got %#v", v)
+	}
+}
+
+func TestEncoderDecoder(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	values := []interface{}{"a", uint64(1), []interface{}{true}, map[string]interface{}{"k": nil}}
+	for _, v := range values {
+		if err := enc.Encode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dec := NewDecoder(&buf)
+	for i, expected := range values {
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			t.Fatalf("value %d: unexpected error: %s", i, err)
+		}
+		if !reflect.DeepEqual(v, expected) {
+			t.Errorf("value %d: expected %#v but got %#v", i, expected, v)
+		}
+	}
+
+	var v interface{}
+	if err := dec.Decode(&v); err != io.EOF {
+		t.Errorf("expected io.EOF at the end of the stream, got %v", err)
+	}
+
+	dec = NewDecoder(bytes.NewReader(mustHex(t, "8201")))
+	if err := dec.Decode(&v); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected io.ErrUnexpectedEOF for a truncated item, got %v", err)
+	}
+}
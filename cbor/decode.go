@@ -0,0 +1,833 @@
+package cbor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+)
+
+// maxDepth limits the nesting of arrays, maps and tags.
+const maxDepth = 1000
+
+var (
+	unmarshalerType     = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+	errTooDeep   = errors.New("cbor: exceeded max depth")
+	errBreak     = errors.New("cbor: unexpected break")
+	errTrailing  = errors.New("cbor: trailing data after the data item")
+	errMalformed = errors.New("cbor: malformed data item")
+)
+
+// UnmarshalTypeError is returned if a data item can't be decoded into the
+// Go type of the target.
+type UnmarshalTypeError struct {
+	// Value describes the data item, e.g. "text string".
+	Value string
+	Type  reflect.Type
+}
+
+func (e *UnmarshalTypeError) Error() string {
+	return "cbor: cannot unmarshal " + e.Value + " into Go value of type " + e.Type.String()
+}
+
+// InvalidUnmarshalError is returned if the target passed to Unmarshal isn't
+// a non-nil pointer.
+type InvalidUnmarshalError struct {
+	Type reflect.Type
+}
+
+func (e *InvalidUnmarshalError) Error() string {
+	if e.Type == nil {
+		return "cbor: Unmarshal(nil)"
+	}
+	if e.Type.Kind() != reflect.Ptr {
+		return "cbor: Unmarshal(non-pointer " + e.Type.String() + ")"
+	}
+	return "cbor: Unmarshal(nil " + e.Type.String() + ")"
+}
+
+// Unmarshal decodes the CBOR data item in data and stores it in the value
+// pointed to by v. Into an empty interface, unsigned integers are decoded as
+// uint64, negative integers as int64, floats as float64, byte strings as
+// []byte, arrays as []interface{} and maps as map[string]interface{}, or as
+// map[interface{}]interface{} if not all keys are text strings. Tags are
+// ignored.
+func Unmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return &InvalidUnmarshalError{Type: reflect.TypeOf(v)}
+	}
+
+	d := &decodeState{data: data}
+	if err := d.value(rv, 0); err != nil {
+		return err
+	}
+	if d.off != len(d.data) {
+		return errTrailing
+	}
+	return nil
+}
+
+// Decoder reads CBOR data items from a stream.
+type Decoder struct {
+	r   *bufio.Reader
+	buf bytes.Buffer
+}
+
+// NewDecoder returns a Decoder reading from r. It may read past the data
+// items it decodes.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// Decode reads the next data item from the stream and stores it in the
+// value pointed to by v, see Unmarshal. It returns io.EOF if the stream
+// ended before the next item, and io.ErrUnexpectedEOF if it ended within
+// an item.
+func (dec *Decoder) Decode(v interface{}) error {
+	dec.buf.Reset()
+	if err := readItem(dec.r, &dec.buf, 0); err != nil {
+		if err == io.EOF && dec.buf.Len() > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	return Unmarshal(dec.buf.Bytes(), v)
+}
+
+// readItem copies the next data item from r to buf.
+func readItem(r *bufio.Reader, buf *bytes.Buffer, depth int) error {
+	if depth > maxDepth {
+		return errTooDeep
+	}
+
+	ib, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	buf.WriteByte(ib)
+
+	major, info := ib>>5, ib&0x1f
+	var n uint64
+	switch {
+	case info < 24:
+		n = uint64(info)
+	case info <= 27:
+		size := 1 << (info - 24)
+		arg := make([]byte, size)
+		if _, err := io.ReadFull(r, arg); err != nil {
+			return unexpected(err)
+		}
+		buf.Write(arg)
+		for _, b := range arg {
+			n = n<<8 | uint64(b)
+		}
+	case info == 31:
+		return readIndefinite(r, buf, major, depth)
+	default:
+		return errMalformed
+	}
+
+	switch major {
+	case majorBytes, majorText:
+		if _, err := io.CopyN(buf, r, int64(n)); err != nil {
+			return unexpected(err)
+		}
+	case majorArray, majorMap:
+		if major == majorMap {
+			n *= 2
+		}
+		for i := uint64(0); i < n; i++ {
+			if err := readItem(r, buf, depth+1); err != nil {
+				return unexpected(err)
+			}
+		}
+	case majorTag:
+		return unexpected(readItem(r, buf, depth+1))
+	}
+	return nil
+}
+
+func readIndefinite(r *bufio.Reader, buf *bytes.Buffer, major byte, depth int) error {
+	switch major {
+	case majorBytes, majorText, majorArray, majorMap:
+	case majorSimple:
+		return errBreak
+	default:
+		return errMalformed
+	}
+
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return unexpected(err)
+		}
+		if b == majorSimple<<5|simpleBreak {
+			buf.WriteByte(b)
+			return nil
+		}
+		r.UnreadByte()
+		if err := readItem(r, buf, depth+1); err != nil {
+			return unexpected(err)
+		}
+	}
+}
+
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+type decodeState struct {
+	data []byte
+	off  int
+}
+
+// head reads the initial byte and the argument of the next data item. info
+// is 31 for items of indefinite length.
+func (d *decodeState) head() (major, info byte, n uint64, err error) {
+	if d.off >= len(d.data) {
+		return 0, 0, 0, io.ErrUnexpectedEOF
+	}
+	ib := d.data[d.off]
+	d.off++
+
+	major, info = ib>>5, ib&0x1f
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info <= 27:
+		size := 1 << (info - 24)
+		if len(d.data)-d.off < size {
+			return 0, 0, 0, io.ErrUnexpectedEOF
+		}
+		for _, b := range d.data[d.off : d.off+size] {
+			n = n<<8 | uint64(b)
+		}
+		d.off += size
+		return major, info, n, nil
+	case info == 31:
+		return major, info, 0, nil
+	}
+	return 0, 0, 0, errMalformed
+}
+
+func (d *decodeState) peek() (byte, error) {
+	if d.off >= len(d.data) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return d.data[d.off], nil
+}
+
+// isBreak consumes the next byte if it is the break of an indefinite length
+// item.
+func (d *decodeState) isBreak() (bool, error) {
+	b, err := d.peek()
+	if err != nil {
+		return false, err
+	}
+	if b == majorSimple<<5|simpleBreak {
+		d.off++
+		return true, nil
+	}
+	return false, nil
+}
+
+// length returns the number of elements of an array or map, or -1 if the
+// length is indefinite. It checks that the data is long enough to hold
+// them, so it's safe to allocate.
+func (d *decodeState) length(info byte, n uint64) (int, error) {
+	if info == 31 {
+		return -1, nil
+	}
+	if n > uint64(len(d.data)-d.off) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return int(n), nil
+}
+
+// skip skips the next data item.
+func (d *decodeState) skip(depth int) error {
+	_, err := d.generic(depth)
+	return err
+}
+
+// raw returns the encoding of the next data item and skips it.
+func (d *decodeState) raw(depth int) ([]byte, error) {
+	start := d.off
+	if err := d.skip(depth); err != nil {
+		return nil, err
+	}
+	return d.data[start:d.off], nil
+}
+
+// stringBytes reads the content of a byte or text string.
+func (d *decodeState) stringBytes(major, info byte, n uint64) ([]byte, error) {
+	if info != 31 {
+		if n > uint64(len(d.data)-d.off) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		b := d.data[d.off : d.off+int(n)]
+		d.off += int(n)
+		return b, nil
+	}
+
+	// indefinite length strings are a sequence of definite length chunks
+	var b []byte
+	for {
+		brk, err := d.isBreak()
+		if err != nil {
+			return nil, err
+		}
+		if brk {
+			return b, nil
+		}
+		cmajor, cinfo, cn, err := d.head()
+		if err != nil {
+			return nil, err
+		}
+		if cmajor != major || cinfo == 31 {
+			return nil, errMalformed
+		}
+		chunk, err := d.stringBytes(cmajor, cinfo, cn)
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, chunk...)
+	}
+}
+
+// simple decodes a value of the major type 7.
+func (d *decodeState) simple(info byte, n uint64) (interface{}, error) {
+	switch info {
+	case simpleFalse:
+		return false, nil
+	case simpleTrue:
+		return true, nil
+	case simpleNull, simpleUndefined:
+		return nil, nil
+	case simpleFloat16:
+		return float16(uint16(n)), nil
+	case simpleFloat32:
+		return float64(math.Float32frombits(uint32(n))), nil
+	case simpleFloat64:
+		return math.Float64frombits(n), nil
+	case simpleBreak:
+		return nil, errBreak
+	}
+	return nil, fmt.Errorf("cbor: unsupported simple value %d", n)
+}
+
+func float16(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+
+	if h&0x8000 != 0 {
+		return -f
+	}
+	return f
+}
+
+// generic decodes the next data item into the Go value Unmarshal stores in
+// an empty interface.
+func (d *decodeState) generic(depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, errTooDeep
+	}
+
+	major, info, n, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case majorUint:
+		return n, nil
+	case majorNegInt:
+		if n > math.MaxInt64 {
+			return nil, &UnmarshalTypeError{Value: "negative integer", Type: reflect.TypeOf(int64(0))}
+		}
+		return -1 - int64(n), nil
+	case majorBytes:
+		b, err := d.stringBytes(major, info, n)
+		return append([]byte(nil), b...), err
+	case majorText:
+		b, err := d.stringBytes(major, info, n)
+		return string(b), err
+	case majorArray:
+		l, err := d.length(info, n)
+		if err != nil {
+			return nil, err
+		}
+		arr := make([]interface{}, 0, max(l, 0))
+		for i := 0; l < 0 || i < l; i++ {
+			if l < 0 {
+				if brk, err := d.isBreak(); err != nil || brk {
+					return arr, err
+				}
+			}
+			v, err := d.generic(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		return arr, nil
+	case majorMap:
+		return d.genericMap(info, n, depth)
+	case majorTag:
+		return d.generic(depth + 1)
+	}
+	return d.simple(info, n)
+}
+
+func (d *decodeState) genericMap(info byte, n uint64, depth int) (interface{}, error) {
+	l, err := d.length(info, n)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys, vals []interface{}
+	strKeys := true
+	for i := 0; l < 0 || i < l; i++ {
+		if l < 0 {
+			brk, err := d.isBreak()
+			if err != nil {
+				return nil, err
+			}
+			if brk {
+				break
+			}
+		}
+		k, err := d.generic(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.generic(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		switch k.(type) {
+		case string:
+		case []byte, []interface{}, map[string]interface{}, map[interface{}]interface{}:
+			return nil, &UnmarshalTypeError{Value: "map key", Type: reflect.TypeOf(k)}
+		default:
+			strKeys = false
+		}
+		keys, vals = append(keys, k), append(vals, v)
+	}
+
+	if strKeys {
+		m := make(map[string]interface{}, len(keys))
+		for i, k := range keys {
+			m[k.(string)] = vals[i]
+		}
+		return m, nil
+	}
+	m := make(map[interface{}]interface{}, len(keys))
+	for i, k := range keys {
+		m[k] = vals[i]
+	}
+	return m, nil
+}
+
+// indirect allocates the pointers v points through and returns the value
+// to store into. If the value implements Unmarshaler or, for text strings,
+// encoding.TextUnmarshaler, it is returned as such. For null, the pointer
+// is not dereferenced so it can be set to nil.
+func indirect(v reflect.Value, null bool) (Unmarshaler, encoding.TextUnmarshaler, reflect.Value) {
+	for {
+		if v.Kind() == reflect.Interface && !v.IsNil() {
+			e := v.Elem()
+			if e.Kind() == reflect.Ptr && !e.IsNil() && !null {
+				v = e
+				continue
+			}
+		}
+		if v.Kind() != reflect.Ptr {
+			break
+		}
+		if null && v.CanSet() {
+			break
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		if v.Type().NumMethod() > 0 && v.CanInterface() {
+			if u, ok := v.Interface().(Unmarshaler); ok {
+				return u, nil, reflect.Value{}
+			}
+			if !null {
+				if u, ok := v.Interface().(encoding.TextUnmarshaler); ok {
+					return nil, u, reflect.Value{}
+				}
+			}
+		}
+		v = v.Elem()
+	}
+
+	if v.CanAddr() && v.Kind() != reflect.Interface {
+		pv := v.Addr()
+		if pv.Type().Implements(unmarshalerType) {
+			return pv.Interface().(Unmarshaler), nil, reflect.Value{}
+		}
+		if !null && pv.Type().Implements(textUnmarshalerType) {
+			return nil, pv.Interface().(encoding.TextUnmarshaler), reflect.Value{}
+		}
+	}
+	return nil, nil, v
+}
+
+// value decodes the next data item into v.
+func (d *decodeState) value(v reflect.Value, depth int) error {
+	if depth > maxDepth {
+		return errTooDeep
+	}
+
+	b, err := d.peek()
+	if err != nil {
+		return err
+	}
+	for b>>5 == majorTag {
+		if _, _, _, err := d.head(); err != nil {
+			return err
+		}
+		if b, err = d.peek(); err != nil {
+			return err
+		}
+	}
+	null := b == majorSimple<<5|simpleNull || b == majorSimple<<5|simpleUndefined
+
+	u, tu, v := indirect(v, null)
+	if u != nil {
+		data, err := d.raw(depth)
+		if err != nil {
+			return err
+		}
+		return u.UnmarshalCBOR(data)
+	}
+	if tu != nil {
+		if b>>5 != majorText {
+			g, err := d.generic(depth)
+			if err != nil {
+				return err
+			}
+			return &UnmarshalTypeError{Value: describe(g), Type: reflect.TypeOf(tu)}
+		}
+		s, err := d.generic(depth)
+		if err != nil {
+			return err
+		}
+		return tu.UnmarshalText([]byte(s.(string)))
+	}
+
+	if null {
+		d.off++
+		switch v.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice:
+			v.Set(reflect.Zero(v.Type()))
+		}
+		return nil
+	}
+
+	if v.Kind() == reflect.Interface {
+		if v.NumMethod() > 0 {
+			g, err := d.generic(depth)
+			if err != nil {
+				return err
+			}
+			return &UnmarshalTypeError{Value: describe(g), Type: v.Type()}
+		}
+		g, err := d.generic(depth)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(g))
+		return nil
+	}
+
+	switch b >> 5 {
+	case majorArray:
+		return d.array(v, depth)
+	case majorMap:
+		return d.object(v, depth)
+	case majorBytes:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			major, info, n, err := d.head()
+			if err != nil {
+				return err
+			}
+			data, err := d.stringBytes(major, info, n)
+			if err != nil {
+				return err
+			}
+			v.SetBytes(append([]byte(nil), data...))
+			return nil
+		}
+	}
+
+	g, err := d.generic(depth)
+	if err != nil {
+		return err
+	}
+	return store(v, g)
+}
+
+// store sets v to the scalar value g.
+func store(v reflect.Value, g interface{}) error {
+	mismatch := &UnmarshalTypeError{Value: describe(g), Type: v.Type()}
+
+	switch g := g.(type) {
+	case bool:
+		if v.Kind() != reflect.Bool {
+			return mismatch
+		}
+		v.SetBool(g)
+	case string:
+		if v.Kind() != reflect.String {
+			return mismatch
+		}
+		v.SetString(g)
+	case []byte:
+		if v.Kind() != reflect.String {
+			return mismatch
+		}
+		v.SetString(string(g))
+	case uint64:
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if g > math.MaxInt64 || v.OverflowInt(int64(g)) {
+				return mismatch
+			}
+			v.SetInt(int64(g))
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if v.OverflowUint(g) {
+				return mismatch
+			}
+			v.SetUint(g)
+		case reflect.Float32, reflect.Float64:
+			v.SetFloat(float64(g))
+		default:
+			return mismatch
+		}
+	case int64:
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if v.OverflowInt(g) {
+				return mismatch
+			}
+			v.SetInt(g)
+		case reflect.Float32, reflect.Float64:
+			v.SetFloat(float64(g))
+		default:
+			return mismatch
+		}
+	case float64:
+		switch v.Kind() {
+		case reflect.Float32, reflect.Float64:
+			v.SetFloat(g)
+		default:
+			return mismatch
+		}
+	default:
+		return mismatch
+	}
+	return nil
+}
+
+func describe(g interface{}) string {
+	switch g.(type) {
+	case bool:
+		return "bool"
+	case string:
+		return "text string"
+	case []byte:
+		return "byte string"
+	case uint64:
+		return "unsigned integer"
+	case int64:
+		return "negative integer"
+	case float64:
+		return "float"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}, map[interface{}]interface{}:
+		return "map"
+	}
+	return "null"
+}
+
+func (d *decodeState) array(v reflect.Value, depth int) error {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+	default:
+		g, err := d.generic(depth)
+		if err != nil {
+			return err
+		}
+		return &UnmarshalTypeError{Value: describe(g), Type: v.Type()}
+	}
+
+	_, info, n, err := d.head()
+	if err != nil {
+		return err
+	}
+	l, err := d.length(info, n)
+	if err != nil {
+		return err
+	}
+
+	if v.Kind() == reflect.Slice {
+		v.Set(reflect.MakeSlice(v.Type(), 0, max(l, 0)))
+	}
+
+	i := 0
+	for ; l < 0 || i < l; i++ {
+		if l < 0 {
+			brk, err := d.isBreak()
+			if err != nil {
+				return err
+			}
+			if brk {
+				break
+			}
+		}
+
+		switch {
+		case v.Kind() == reflect.Slice:
+			v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+			err = d.value(v.Index(i), depth+1)
+		case i < v.Len():
+			err = d.value(v.Index(i), depth+1)
+		default:
+			err = d.skip(depth + 1)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if v.Kind() == reflect.Array {
+		for ; i < v.Len(); i++ {
+			v.Index(i).Set(reflect.Zero(v.Type().Elem()))
+		}
+	}
+	return nil
+}
+
+func (d *decodeState) object(v reflect.Value, depth int) error {
+	switch v.Kind() {
+	case reflect.Map:
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+	case reflect.Struct:
+	default:
+		g, err := d.generic(depth)
+		if err != nil {
+			return err
+		}
+		return &UnmarshalTypeError{Value: describe(g), Type: v.Type()}
+	}
+
+	_, info, n, err := d.head()
+	if err != nil {
+		return err
+	}
+	l, err := d.length(info, n)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; l < 0 || i < l; i++ {
+		if l < 0 {
+			brk, err := d.isBreak()
+			if err != nil {
+				return err
+			}
+			if brk {
+				break
+			}
+		}
+
+		if v.Kind() == reflect.Map {
+			key := reflect.New(v.Type().Key()).Elem()
+			if err := d.value(key, depth+1); err != nil {
+				return err
+			}
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := d.value(elem, depth+1); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, elem)
+			continue
+		}
+
+		k, err := d.generic(depth + 1)
+		if err != nil {
+			return err
+		}
+		name, ok := k.(string)
+		if !ok {
+			if err := d.skip(depth + 1); err != nil {
+				return err
+			}
+			continue
+		}
+		f, ok := fieldNamed(v.Type(), name)
+		if !ok {
+			if err := d.skip(depth + 1); err != nil {
+				return err
+			}
+			continue
+		}
+		fv, err := allocField(v, f.index)
+		if err != nil {
+			return err
+		}
+		if err := d.value(fv, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// allocField returns the field at index, allocating nil embedded struct
+// pointers on the way.
+func allocField(v reflect.Value, index []int) (reflect.Value, error) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, fmt.Errorf("cbor: cannot set embedded pointer to unexported struct %s", v.Type().Elem())
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, nil
+}
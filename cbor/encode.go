@@ -0,0 +1,348 @@
+/*
+Package cbor implements the CBOR encoding (RFC 7049) of Go values, used for
+the cmds.CBOR encoding type. Values are mapped like encoding/json maps them,
+except that byte slices are encoded as byte strings:
+
+	data, err := cbor.Marshal(v)
+	err = cbor.Unmarshal(data, &v)
+
+Struct fields are named by their `cbor` tag, falling back to the `json` tag
+and the field name, and support the omitempty option. Maps are encoded with
+their keys sorted in the canonical order, so equal values are encoded
+equally. Types can customize their encoding by implementing Marshaler and
+Unmarshaler, and encoding.TextMarshaler types are encoded as text.
+*/
+package cbor
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// Marshaler is implemented by types that encode themselves as a CBOR data
+// item.
+type Marshaler interface {
+	MarshalCBOR() ([]byte, error)
+}
+
+// Unmarshaler is implemented by types that decode themselves from a CBOR
+// data item.
+type Unmarshaler interface {
+	UnmarshalCBOR(data []byte) error
+}
+
+// Major types
+const (
+	majorUint   = 0
+	majorNegInt = 1
+	majorBytes  = 2
+	majorText   = 3
+	majorArray  = 4
+	majorMap    = 5
+	majorTag    = 6
+	majorSimple = 7
+)
+
+// Simple values and floats of the major type 7
+const (
+	simpleFalse     = 20
+	simpleTrue      = 21
+	simpleNull      = 22
+	simpleUndefined = 23
+	simpleFloat16   = 25
+	simpleFloat32   = 26
+	simpleFloat64   = 27
+	simpleBreak     = 31
+)
+
+var (
+	marshalerType     = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// Marshal returns the CBOR encoding of v.
+func Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encode(&buf, reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Encoder writes the CBOR encodings of values to a stream, one data item
+// per value.
+type Encoder struct {
+	w   io.Writer
+	buf bytes.Buffer
+}
+
+// NewEncoder returns an Encoder writing to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Encode writes the encoding of v to the stream. The value is written with
+// a single Write.
+func (e *Encoder) Encode(v interface{}) error {
+	e.buf.Reset()
+	if err := encode(&e.buf, reflect.ValueOf(v)); err != nil {
+		return err
+	}
+	_, err := e.w.Write(e.buf.Bytes())
+	return err
+}
+
+// UnsupportedTypeError is returned for values that can't be encoded, e.g.
+// channels and functions.
+type UnsupportedTypeError struct {
+	Type reflect.Type
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	return "cbor: unsupported type: " + e.Type.String()
+}
+
+func writeHead(buf *bytes.Buffer, major byte, n uint64) {
+	major <<= 5
+	switch {
+	case n < 24:
+		buf.WriteByte(major | byte(n))
+	case n <= math.MaxUint8:
+		buf.Write([]byte{major | 24, byte(n)})
+	case n <= math.MaxUint16:
+		buf.WriteByte(major | 25)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	case n <= math.MaxUint32:
+		buf.WriteByte(major | 26)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	default:
+		buf.WriteByte(major | 27)
+		binary.Write(buf, binary.BigEndian, n)
+	}
+}
+
+func writeInt(buf *bytes.Buffer, i int64) {
+	if i < 0 {
+		writeHead(buf, majorNegInt, uint64(-1-i))
+		return
+	}
+	writeHead(buf, majorUint, uint64(i))
+}
+
+func writeText(buf *bytes.Buffer, s string) {
+	writeHead(buf, majorText, uint64(len(s)))
+	buf.WriteString(s)
+}
+
+func writeNull(buf *bytes.Buffer) {
+	buf.WriteByte(majorSimple<<5 | simpleNull)
+}
+
+func encode(buf *bytes.Buffer, v reflect.Value) error {
+	if !v.IsValid() {
+		writeNull(buf)
+		return nil
+	}
+
+	if v.Type().Implements(marshalerType) {
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			writeNull(buf)
+			return nil
+		}
+		data, err := v.Interface().(Marshaler).MarshalCBOR()
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		return nil
+	}
+	if v.Type().Implements(textMarshalerType) {
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			writeNull(buf)
+			return nil
+		}
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return err
+		}
+		writeText(buf, string(text))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			buf.WriteByte(majorSimple<<5 | simpleTrue)
+		} else {
+			buf.WriteByte(majorSimple<<5 | simpleFalse)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		writeInt(buf, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		writeHead(buf, majorUint, v.Uint())
+	case reflect.Float32:
+		buf.WriteByte(majorSimple<<5 | simpleFloat32)
+		binary.Write(buf, binary.BigEndian, math.Float32bits(float32(v.Float())))
+	case reflect.Float64:
+		buf.WriteByte(majorSimple<<5 | simpleFloat64)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(v.Float()))
+	case reflect.String:
+		writeText(buf, v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			writeNull(buf)
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			writeHead(buf, majorBytes, uint64(v.Len()))
+			buf.Write(v.Bytes())
+			return nil
+		}
+		return encodeArray(buf, v)
+	case reflect.Array:
+		return encodeArray(buf, v)
+	case reflect.Map:
+		if v.IsNil() {
+			writeNull(buf)
+			return nil
+		}
+		return encodeMap(buf, v)
+	case reflect.Struct:
+		return encodeStruct(buf, v)
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			writeNull(buf)
+			return nil
+		}
+		return encode(buf, v.Elem())
+	default:
+		return &UnsupportedTypeError{Type: v.Type()}
+	}
+	return nil
+}
+
+func encodeArray(buf *bytes.Buffer, v reflect.Value) error {
+	writeHead(buf, majorArray, uint64(v.Len()))
+	for i := 0; i < v.Len(); i++ {
+		if err := encode(buf, v.Index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeMap writes the entries sorted by their encoded keys, shorter keys
+// first, as the canonical CBOR encoding requires.
+func encodeMap(buf *bytes.Buffer, v reflect.Value) error {
+	type entry struct {
+		key []byte
+		val reflect.Value
+	}
+
+	entries := make([]entry, 0, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		var kb bytes.Buffer
+		if err := encode(&kb, iter.Key()); err != nil {
+			return err
+		}
+		entries = append(entries, entry{key: kb.Bytes(), val: iter.Value()})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i].key, entries[j].key
+		if len(a) != len(b) {
+			return len(a) < len(b)
+		}
+		return bytes.Compare(a, b) < 0
+	})
+
+	writeHead(buf, majorMap, uint64(len(entries)))
+	for _, e := range entries {
+		buf.Write(e.key)
+		if err := encode(buf, e.val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeStruct(buf *bytes.Buffer, v reflect.Value) error {
+	fields := structFields(v.Type())
+
+	vals := make([]reflect.Value, 0, len(fields))
+	used := make([]field, 0, len(fields))
+	for _, f := range fields {
+		fv, ok := fieldByIndex(v, f.index)
+		if !ok || (f.omitEmpty && isEmptyValue(fv)) {
+			continue
+		}
+		vals = append(vals, fv)
+		used = append(used, f)
+	}
+
+	writeHead(buf, majorMap, uint64(len(used)))
+	for i, f := range used {
+		writeText(buf, f.name)
+		if err := encode(buf, vals[i]); err != nil {
+			return fmt.Errorf("cbor: field %s: %w", f.name, err)
+		}
+	}
+	return nil
+}
+
+// fieldByIndex returns the field at index, which is missing if it is in a
+// nil embedded struct pointer.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+// RawMessage is an encoded CBOR data item. It can be used to delay decoding
+// a part of a value, or to embed a precomputed encoding.
+type RawMessage []byte
+
+// MarshalCBOR returns m, or null if m is empty.
+func (m RawMessage) MarshalCBOR() ([]byte, error) {
+	if len(m) == 0 {
+		return []byte{majorSimple<<5 | simpleNull}, nil
+	}
+	return m, nil
+}
+
+// UnmarshalCBOR sets *m to a copy of data.
+func (m *RawMessage) UnmarshalCBOR(data []byte) error {
+	*m = append((*m)[:0], data...)
+	return nil
+}
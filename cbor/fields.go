@@ -0,0 +1,116 @@
+package cbor
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// field is a struct field encoded as a map entry.
+type field struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+var fieldCache sync.Map // map[reflect.Type][]field
+
+// structFields returns the encoded fields of t, including the fields of
+// embedded structs, which are flattened like encoding/json does.
+func structFields(t reflect.Type) []field {
+	if fs, ok := fieldCache.Load(t); ok {
+		return fs.([]field)
+	}
+
+	var fields []field
+	seen := make(map[string]bool)
+	collectFields(t, nil, seen, &fields)
+
+	fs, _ := fieldCache.LoadOrStore(t, fields)
+	return fs.([]field)
+}
+
+func collectFields(t reflect.Type, index []int, seen map[string]bool, fields *[]field) {
+	var embedded []reflect.StructField
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+
+		name, opts, tagged := fieldTag(sf)
+		if name == "-" && opts == "" {
+			continue
+		}
+
+		if sf.Anonymous && !tagged {
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded = append(embedded, sf)
+				continue
+			}
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = sf.Name
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		*fields = append(*fields, field{
+			name:      name,
+			index:     append(append([]int(nil), index...), i),
+			omitEmpty: strings.Contains(","+opts+",", ",omitempty,"),
+		})
+	}
+
+	// fields of the outer struct shadow the embedded ones
+	for _, sf := range embedded {
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		collectFields(ft, append(append([]int(nil), index...), sf.Index...), seen, fields)
+	}
+}
+
+// fieldTag returns the name and options of the cbor tag of sf, falling back
+// to its json tag.
+func fieldTag(sf reflect.StructField) (name, opts string, tagged bool) {
+	tag, ok := sf.Tag.Lookup("cbor")
+	if !ok {
+		tag, ok = sf.Tag.Lookup("json")
+	}
+	if !ok {
+		return "", "", false
+	}
+
+	name = tag
+	if i := strings.IndexByte(tag, ','); i >= 0 {
+		name, opts = tag[:i], tag[i+1:]
+	}
+	return name, opts, name != ""
+}
+
+// fieldNamed returns the field of t that a map key decodes into, matching
+// the name case-insensitively if there is no exact match.
+func fieldNamed(t reflect.Type, name string) (field, bool) {
+	fields := structFields(t)
+	for _, f := range fields {
+		if f.name == name {
+			return f, true
+		}
+	}
+	for _, f := range fields {
+		if strings.EqualFold(f.name, name) {
+			return f, true
+		}
+	}
+	return field{}, false
+}
@@ -9,9 +9,33 @@ import (
 	"github.com/ipfs/go-ipfs-cmds/debug"
 )
 
+// ChanResponse is a Response whose values can be received from a channel,
+// for consumers that wait for responses in their own select loops. The
+// Response returned by NewChanResponsePair implements it.
+type ChanResponse interface {
+	Response
+
+	// Chan returns the channel the emitted values are received on. It is
+	// closed when the response ends, after which Error returns the error
+	// it ended with, if any. Values received from the channel are not
+	// returned by Next.
+	Chan() <-chan interface{}
+
+	// Done returns a channel that is closed when the response ended.
+	Done() <-chan struct{}
+}
+
 func NewChanResponsePair(req *Request) (ResponseEmitter, Response) {
+	// the context is read once, since frontends replace req.Context while
+	// the command runs, e.g. with the context of a span
+	ctx := req.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
 	r := &chanResponse{
 		req:     req,
+		ctx:     ctx,
 		ch:      make(chan interface{}),
 		waitLen: make(chan struct{}),
 		closeCh: make(chan struct{}),
@@ -27,6 +51,8 @@ func NewChanResponsePair(req *Request) (ResponseEmitter, Response) {
 // just type definitions on chanStream.
 type chanStream struct {
 	req *Request
+	// ctx is the context of req when the pair was created.
+	ctx context.Context
 
 	// ch is used to send values from emitter to response.
 	// When Emit received a channel close, it returns the error stored in err.
@@ -92,12 +118,7 @@ func (r *chanResponse) Next() (interface{}, error) {
 		return nil, io.EOF
 	}
 
-	var ctx context.Context
-	if rctx := r.req.Context; rctx != nil {
-		ctx = rctx
-	} else {
-		ctx = context.Background()
-	}
+	ctx := r.ctx
 
 	select {
 	case v, ok := <-r.ch:
@@ -105,17 +126,20 @@ func (r *chanResponse) Next() (interface{}, error) {
 			return nil, r.err
 		}
 
-		switch val := v.(type) {
-		case Single:
-			return val.Value, nil
-		default:
-			return v, nil
-		}
+		return v, nil
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	}
 }
 
+func (r *chanResponse) Chan() <-chan interface{} {
+	return r.ch
+}
+
+func (r *chanResponse) Done() <-chan struct{} {
+	return r.closeCh
+}
+
 type chanResponseEmitter chanResponse
 
 func (re *chanResponseEmitter) Emit(v interface{}) error {
@@ -130,6 +154,57 @@ func (re *chanResponseEmitter) Emit(v interface{}) error {
 	re.wl.Lock()
 	defer re.wl.Unlock()
 
+	_, err := re.emit(v, true)
+	return err
+}
+
+// EmitAll emits the values in vs without other emitters interleaving their
+// values.
+func (re *chanResponseEmitter) EmitAll(vs []interface{}) error {
+	for _, v := range vs {
+		switch v.(type) {
+		case chan interface{}, <-chan interface{}:
+			// channels are emitted value by value
+			for _, v := range vs {
+				if err := re.Emit(v); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	re.wl.Lock()
+	defer re.wl.Unlock()
+
+	for _, v := range vs {
+		if _, err := re.emit(v, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TryEmit emits v if the consumer is waiting for a value, and returns
+// whether v was emitted.
+func (re *chanResponseEmitter) TryEmit(v interface{}) (bool, error) {
+	switch v.(type) {
+	case chan interface{}, <-chan interface{}:
+		return false, ErrTryEmitChan
+	}
+
+	// another Emit may be waiting for the consumer
+	if !re.wl.TryLock() {
+		return false, nil
+	}
+	defer re.wl.Unlock()
+
+	return re.emit(v, false)
+}
+
+// emit sends v to the response, waiting for the consumer if wait is set.
+// It must be called with wl held.
+func (re *chanResponseEmitter) emit(v interface{}, wait bool) (bool, error) {
 	// Initially this library allowed commands to return errors by sending an
 	// error value along a stream. We removed that in favour of CloseWithError,
 	// so we want to make sure we catch situations where some code still uses the
@@ -149,20 +224,41 @@ func (re *chanResponseEmitter) Emit(v interface{}) error {
 	// re.closed is set in a critical section protected by re.wl (we also took
 	// that lock), so we can be sure that this check is not racy.
 	if re.closed {
-		return ErrClosedEmitter
+		CloseReader(v)
+		return false, ErrClosedEmitter
+	}
+
+	ctx := re.ctx
+
+	// unwrap Single here so values received from Chan are unwrapped, too
+	single, isSingle := v.(Single)
+	if isSingle {
+		v = single.Value
 	}
 
-	ctx := re.req.Context
+	if !wait {
+		select {
+		case re.ch <- v:
+		default:
+			return false, nil
+		}
+
+		if isSingle {
+			re.closeWithError(nil)
+		}
+		return true, nil
+	}
 
 	select {
 	case re.ch <- v:
-		if _, ok := v.(Single); ok {
+		if isSingle {
 			re.closeWithError(nil)
 		}
 
-		return nil
+		return true, nil
 	case <-ctx.Done():
-		return ctx.Err()
+		CloseReader(v)
+		return false, ctx.Err()
 	}
 }
 
@@ -7,6 +7,7 @@ import (
 	"io"
 	"sync"
 	"testing"
+	"time"
 )
 
 func TestChanResponsePair(t *testing.T) {
@@ -78,6 +79,42 @@ func TestChanResponsePair(t *testing.T) {
 	}
 }
 
+func TestChanResponseChan(t *testing.T) {
+	req, err := NewRequest(context.TODO(), nil, nil, nil, nil, &Command{})
+	if err != nil {
+		t.Fatal("error building request", err)
+	}
+	re, res := NewChanResponsePair(req)
+	cres := res.(ChanResponse)
+
+	go func() {
+		re.Emit(1)
+		re.Emit(Single{2})
+	}()
+
+	var values []interface{}
+LOOP:
+	for {
+		select {
+		case v, ok := <-cres.Chan():
+			if !ok {
+				break LOOP
+			}
+			values = append(values, v)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for values")
+		}
+	}
+
+	<-cres.Done()
+	if len(values) != 2 || values[0] != 1 || values[1] != 2 {
+		t.Errorf("unexpected values %v", values)
+	}
+	if err := cres.Error(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
 func TestSingle1(t *testing.T) {
 	cmd := &Command{}
 	req, err := NewRequest(context.TODO(), nil, nil, nil, nil, cmd)
@@ -155,3 +192,74 @@ func TestDoubleClose(t *testing.T) {
 		t.Fatal("expected closed emitter error, got", err)
 	}
 }
+
+func TestTryEmit(t *testing.T) {
+	req, err := NewRequest(context.TODO(), nil, nil, nil, nil, &Command{})
+	if err != nil {
+		t.Fatal("error building request", err)
+	}
+	re, res := NewChanResponsePair(req)
+
+	// nobody is waiting for a value
+	if ok, err := TryEmit(re, 1); ok || err != nil {
+		t.Fatalf("expected the value not to be accepted, got %v, %v", ok, err)
+	}
+
+	received := make(chan interface{})
+	go func() {
+		v, _ := res.Next()
+		received <- v
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		ok, err := TryEmit(re, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("value was never accepted")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if v := <-received; v != 2 {
+		t.Errorf("expected 2, got %v", v)
+	}
+
+	if _, err := TryEmit(re, make(chan interface{})); err != ErrTryEmitChan {
+		t.Errorf("expected ErrTryEmitChan, got %v", err)
+	}
+	re.Close()
+	if _, err := TryEmit(re, 3); err != ErrClosedEmitter {
+		t.Errorf("expected ErrClosedEmitter, got %v", err)
+	}
+}
+
+func TestChanEmitAll(t *testing.T) {
+	req, err := NewRequest(context.TODO(), nil, nil, nil, nil, &Command{})
+	if err != nil {
+		t.Fatal("error building request", err)
+	}
+	re, res := NewChanResponsePair(req)
+
+	go func() {
+		EmitAll(re, []interface{}{1, 2, 3})
+		re.Close()
+	}()
+
+	for _, expected := range []int{1, 2, 3} {
+		v, err := res.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != expected {
+			t.Errorf("expected %d, got %v", expected, v)
+		}
+	}
+	if _, err := res.Next(); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
@@ -1,10 +1,10 @@
 package cli
 
 import (
-	"fmt"
 	"sort"
 	"strings"
 
+	"github.com/ipfs/go-ipfs-cmdkit"
 	cmds "github.com/ipfs/go-ipfs-cmds"
 	levenshtein "github.com/texttheater/golang-levenshtein/levenshtein"
 )
@@ -50,7 +50,10 @@ func suggestUnknownCmd(args []string, root *cmds.Command) []string {
 	}
 
 	// Start with a simple strings.Contains check
-	for name, _ := range root.Subcommands {
+	for name, sub := range root.Subcommands {
+		if sub.Hidden {
+			continue
+		}
 		if strings.Contains(arg, name) {
 			suggestions = append(suggestions, name)
 		}
@@ -61,7 +64,10 @@ func suggestUnknownCmd(args []string, root *cmds.Command) []string {
 		return suggestions
 	}
 
-	for name, _ := range root.Subcommands {
+	for name, sub := range root.Subcommands {
+		if sub.Hidden {
+			continue
+		}
 		lev := levenshtein.DistanceForStrings([]rune(arg), []rune(name), options)
 		if lev <= MIN_LEVENSHTEIN {
 			sortableSuggestions = append(sortableSuggestions, &suggestion{name, lev})
@@ -75,15 +81,59 @@ func suggestUnknownCmd(args []string, root *cmds.Command) []string {
 	return sFinal
 }
 
+// suggestOptions returns the names of the options in optDefs that are similar
+// to the unknown option name, closest first.
+func suggestOptions(name string, optDefs map[string]cmdkit.Option) []string {
+	// a bit more lenient than for commands to catch swapped letters
+	const MIN_LEVENSHTEIN = 4
+
+	var options levenshtein.Options = levenshtein.Options{
+		InsCost: 1,
+		DelCost: 3,
+		SubCost: 2,
+		Matches: func(sourceCharacter rune, targetCharacter rune) bool {
+			return sourceCharacter == targetCharacter
+		},
+	}
+
+	names := make([]string, 0, len(optDefs))
+	for n := range optDefs {
+		// only suggest short flags for short flags and vice versa
+		if (len(n) == 1) == (len(name) == 1) {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+
+	sortableSuggestions := make(suggestionSlice, 0)
+	for _, n := range names {
+		lev := levenshtein.DistanceForStrings([]rune(name), []rune(n), options)
+		if lev <= MIN_LEVENSHTEIN || strings.HasPrefix(n, name) {
+			sortableSuggestions = append(sortableSuggestions, &suggestion{n, lev})
+		}
+	}
+	sort.Stable(sortableSuggestions)
+
+	var sFinal []string
+	for _, j := range sortableSuggestions {
+		sFinal = append(sFinal, j.cmd)
+	}
+	return sFinal
+}
+
 func printSuggestions(inputs []string, root *cmds.Command) (err error) {
 
+	defer func() {
+		err = &UsageError{err: err}
+	}()
+
 	suggestions := suggestUnknownCmd(inputs, root)
 	if len(suggestions) > 1 {
-		err = fmt.Errorf("Unknown Command \"%s\"\n\nDid you mean any of these?\n\n\t%s", inputs[0], strings.Join(suggestions, "\n\t"))
+		err = errorf("Unknown Command \"%s\"\n\nDid you mean any of these?\n\n\t%s", inputs[0], strings.Join(suggestions, "\n\t"))
 	} else if len(suggestions) > 0 {
-		err = fmt.Errorf("Unknown Command \"%s\"\n\nDid you mean this?\n\n\t%s", inputs[0], suggestions[0])
+		err = errorf("Unknown Command \"%s\"\n\nDid you mean this?\n\n\t%s", inputs[0], suggestions[0])
 	} else {
-		err = fmt.Errorf("Unknown Command \"%s\"\n", inputs[0])
+		err = errorf("Unknown Command \"%s\"\n", inputs[0])
 	}
 	return
 }
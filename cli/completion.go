@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	"github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/go-ipfs-cmds/cli/completion"
+)
+
+// completionHelp tells how to load the scripts of each shell.
+var completionHelp = map[completion.Shell]string{
+	completion.Bash: `
+Load the completion in the current shell with
+
+  source <(%[1]s completion bash)
+
+or install it for all sessions in the bash-completion directory, e.g. as
+/etc/bash_completion.d/%[1]s.
+`,
+	completion.Zsh: `
+Load the completion in the current shell with
+
+  source <(%[1]s completion zsh)
+
+or install it for all sessions as _%[1]s in a directory in $fpath.
+`,
+	completion.Fish: `
+Load the completion in the current shell with
+
+  %[1]s completion fish | source
+
+or install it for all sessions as ~/.config/fish/completions/%[1]s.fish.
+`,
+}
+
+// CompletionCommand returns a command printing the shell completion scripts
+// for root, see package completion. It has a subcommand for every shell and
+// is meant to be mounted as "completion":
+//
+//	root.Subcommands["completion"] = cli.CompletionCommand(root)
+//
+// The scripts complete the name the application was run with.
+func CompletionCommand(root *cmds.Command) *cmds.Command {
+	name := filepath.Base(os.Args[0])
+
+	cmd := &cmds.Command{
+		Helptext: cmdkit.HelpText{
+			Tagline: "Generate shell completion scripts.",
+			ShortDescription: fmt.Sprintf(`
+Prints a script completing the commands, options and option values of %s
+in bash, zsh or fish. See the help of the subcommands for how to load it.
+`, name),
+		},
+		Subcommands: make(map[string]*cmds.Command, len(completion.Shells)),
+	}
+
+	for _, shell := range completion.Shells {
+		shell := shell
+		cmd.Subcommands[string(shell)] = &cmds.Command{
+			Helptext: cmdkit.HelpText{
+				Tagline:          fmt.Sprintf("Generate the %s completion script.", shell),
+				ShortDescription: fmt.Sprintf(completionHelp[shell], name),
+			},
+			Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+				var buf bytes.Buffer
+				if err := completion.Write(&buf, shell, name, root); err != nil {
+					return err
+				}
+				return re.Emit(&buf)
+			},
+		}
+	}
+
+	return cmd
+}
@@ -0,0 +1,375 @@
+/*
+Package completion generates shell completion scripts from command trees.
+The scripts complete the subcommands of every command, its option flags,
+including the options it inherits from its parents, and the values of
+options implementing cmds.Enumerated, e.g. those made by cmds.EnumOption:
+
+	completion.Write(os.Stdout, completion.Bash, "ipfs", root)
+
+Hidden commands and their subcommands aren't completed. Arguments are
+completed as file names.
+
+cli.CompletionCommand returns a command printing the scripts, so users get
+them from the application itself.
+*/
+package completion
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+// Shell is a shell completion scripts are generated for.
+type Shell string
+
+// Supported Shell constants.
+const (
+	Bash Shell = "bash"
+	Zsh  Shell = "zsh"
+	Fish Shell = "fish"
+)
+
+// Shells lists the supported shells.
+var Shells = []Shell{Bash, Zsh, Fish}
+
+// command is a command that is completed.
+type command struct {
+	// path is the full command line of the command, e.g. "ipfs pin add".
+	path string
+	subs []subcommand
+	opts []option
+}
+
+type subcommand struct {
+	name    string
+	tagline string
+}
+
+type option struct {
+	// flags are the names of the option as typed, e.g. "--recursive", "-r".
+	flags       []string
+	description string
+	// value is set if the option takes a value, i.e. isn't a bool.
+	value bool
+	// values are the values of enum options.
+	values []string
+}
+
+// commands returns the commands of the tree in depth-first order, with
+// the subcommands sorted by name.
+func commands(rootName string, root *cmds.Command) []command {
+	var cs []command
+
+	var visit func(path string, cmd *cmds.Command, opts []option)
+	visit = func(path string, cmd *cmds.Command, opts []option) {
+		for _, opt := range cmd.Options {
+			o := option{
+				description: firstLine(opt.Description()),
+				value:       opt.Type() != cmdkit.Bool,
+			}
+			for _, name := range opt.Names() {
+				if len(name) == 1 {
+					o.flags = append(o.flags, "-"+name)
+				} else {
+					o.flags = append(o.flags, "--"+name)
+				}
+			}
+			if e, ok := opt.(cmds.Enumerated); ok {
+				o.values = e.Values()
+			}
+			opts = append(opts[:len(opts):len(opts)], o)
+		}
+
+		names := make([]string, 0, len(cmd.Subcommands))
+		for name, sub := range cmd.Subcommands {
+			if !sub.Hidden {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		c := command{path: path, opts: opts}
+		for _, name := range names {
+			c.subs = append(c.subs, subcommand{name: name, tagline: firstLine(cmd.Subcommands[name].Helptext.Tagline)})
+		}
+		cs = append(cs, c)
+
+		for _, name := range names {
+			visit(path+" "+name, cmd.Subcommands[name], opts)
+		}
+	}
+	visit(rootName, root, nil)
+
+	return cs
+}
+
+func firstLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[:i]
+	}
+	return s
+}
+
+// Write writes the completion script for root for shell to w. rootName is
+// the name of the root command, i.e. the name of the executable.
+func Write(w io.Writer, shell Shell, rootName string, root *cmds.Command) error {
+	switch shell {
+	case Bash:
+		return WriteBash(w, rootName, root)
+	case Zsh:
+		return WriteZsh(w, rootName, root)
+	case Fish:
+		return WriteFish(w, rootName, root)
+	default:
+		return fmt.Errorf("unknown shell: %s", shell)
+	}
+}
+
+var nonIdentifier = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// funcName returns the name of the completion function for rootName.
+func funcName(rootName string) string {
+	return "_" + nonIdentifier.ReplaceAllString(rootName, "_")
+}
+
+// shQuote quotes s for bash and zsh.
+func shQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+func shQuoteAll(ss []string) []string {
+	quoted := make([]string, len(ss))
+	for i, s := range ss {
+		quoted[i] = shQuote(s)
+	}
+	return quoted
+}
+
+// writePathLoop writes the loop of bash and zsh scripts finding the
+// command being completed in the words before the cursor. Words that
+// aren't subcommands, i.e. options, option values and arguments, are
+// skipped.
+func writePathLoop(b *bytes.Buffer, cs []command, from, to, word string) {
+	fmt.Fprintf(b, "\tlocal cmd=%s i\n", shQuote(cs[0].path))
+	if len(cs) == 1 {
+		return
+	}
+
+	paths := make([]string, 0, len(cs)-1)
+	for _, c := range cs[1:] {
+		paths = append(paths, shQuote(c.path))
+	}
+	fmt.Fprintf(b, "\tfor ((i = %s; i < %s; i++)); do\n", from, to)
+	fmt.Fprintf(b, "\t\tcase \"$cmd %s\" in\n", word)
+	fmt.Fprintf(b, "\t\t%s) cmd=\"$cmd %s\" ;;\n", strings.Join(paths, "|"), word)
+	b.WriteString("\t\tesac\n\tdone\n")
+}
+
+// writeValueCases writes the cases completing the values of the options
+// of c after the word before the cursor, prev. Options taking values that
+// aren't enums complete nothing, leaving the default completion to the
+// shell.
+func writeValueCases(b *bytes.Buffer, c command, prev string, values func([]string) string, other string) {
+	var cases []string
+	for _, o := range c.opts {
+		if !o.value {
+			continue
+		}
+		action := other
+		if len(o.values) > 0 {
+			action = values(o.values)
+		}
+		cases = append(cases, fmt.Sprintf("\t\t%s) %s; return ;;\n", strings.Join(o.flags, "|"), action))
+	}
+	if len(cases) == 0 {
+		return
+	}
+
+	fmt.Fprintf(b, "\t\tcase %s in\n", prev)
+	for _, c := range cases {
+		b.WriteString(c)
+	}
+	b.WriteString("\t\tesac\n")
+}
+
+// WriteBash writes the bash completion script for root to w. It is loaded
+// with
+//
+//	source <(app completion bash)
+//
+// or installed in the bash-completion directory, e.g.
+// /etc/bash_completion.d.
+func WriteBash(w io.Writer, rootName string, root *cmds.Command) error {
+	cs := commands(rootName, root)
+	fn := funcName(rootName)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# bash completion for %s\n\n", rootName)
+	fmt.Fprintf(&b, "%s() {\n", fn)
+	b.WriteString("\tlocal cur=\"${COMP_WORDS[COMP_CWORD]}\" prev=\"${COMP_WORDS[COMP_CWORD-1]}\"\n")
+	writePathLoop(&b, cs, "1", "COMP_CWORD", "${COMP_WORDS[i]}")
+
+	b.WriteString("\n\tcase \"$cmd\" in\n")
+	for _, c := range cs {
+		fmt.Fprintf(&b, "\t%s)\n", shQuote(c.path))
+		writeValueCases(&b, c, `"$prev"`, func(values []string) string {
+			return fmt.Sprintf("COMPREPLY=($(compgen -W %s -- \"$cur\"))", shQuote(strings.Join(values, " ")))
+		}, ":")
+
+		var flags, subs []string
+		for _, o := range c.opts {
+			flags = append(flags, o.flags...)
+		}
+		for _, s := range c.subs {
+			subs = append(subs, s.name)
+		}
+		b.WriteString("\t\tif [[ \"$cur\" == -* ]]; then\n")
+		fmt.Fprintf(&b, "\t\t\tCOMPREPLY=($(compgen -W %s -- \"$cur\"))\n", shQuote(strings.Join(flags, " ")))
+		if len(subs) > 0 {
+			b.WriteString("\t\telse\n")
+			fmt.Fprintf(&b, "\t\t\tCOMPREPLY=($(compgen -W %s -- \"$cur\"))\n", shQuote(strings.Join(subs, " ")))
+		}
+		b.WriteString("\t\tfi\n\t\t;;\n")
+	}
+	b.WriteString("\tesac\n}\n\n")
+	fmt.Fprintf(&b, "complete -o default -F %s %s\n", fn, shQuote(rootName))
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// zshDescribed returns the "name:description" items of _describe.
+func zshDescribed(name, description string) string {
+	item := strings.Replace(name, ":", `\:`, -1)
+	if description != "" {
+		item += ":" + description
+	}
+	return shQuote(item)
+}
+
+// WriteZsh writes the zsh completion script for root to w. It is loaded
+// with
+//
+//	source <(app completion zsh)
+//
+// or installed as _app in a directory in $fpath.
+func WriteZsh(w io.Writer, rootName string, root *cmds.Command) error {
+	cs := commands(rootName, root)
+	fn := funcName(rootName)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "#compdef %s\n# zsh completion for %s\n\n", rootName, rootName)
+	fmt.Fprintf(&b, "%s() {\n", fn)
+	writePathLoop(&b, cs, "2", "CURRENT", "${words[i]}")
+
+	b.WriteString("\n\tlocal -a opts subs\n\tcase \"$cmd\" in\n")
+	for _, c := range cs {
+		fmt.Fprintf(&b, "\t%s)\n", shQuote(c.path))
+		writeValueCases(&b, c, `"${words[CURRENT-1]}"`, func(values []string) string {
+			return "compadd -- " + strings.Join(shQuoteAll(values), " ")
+		}, "_message value")
+
+		var opts, subs []string
+		for _, o := range c.opts {
+			for _, flag := range o.flags {
+				opts = append(opts, zshDescribed(flag, o.description))
+			}
+		}
+		for _, s := range c.subs {
+			subs = append(subs, zshDescribed(s.name, s.tagline))
+		}
+		fmt.Fprintf(&b, "\t\topts=(%s)\n", strings.Join(opts, " "))
+		fmt.Fprintf(&b, "\t\tsubs=(%s)\n", strings.Join(subs, " "))
+		b.WriteString("\t\t;;\n")
+	}
+	b.WriteString("\tesac\n\n")
+	b.WriteString(`	if [[ "$PREFIX" == -* ]]; then
+		_describe -t options option opts
+	elif (( $#subs )); then
+		_describe -t commands command subs
+	else
+		_files
+	fi
+}
+
+`)
+	fmt.Fprintf(&b, "if [[ \"$funcstack[1]\" == %s ]]; then\n\t%s \"$@\"\nelse\n\tcompdef %s %s\nfi\n", fn, fn, fn, shQuote(rootName))
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// fishQuote quotes s for fish.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+// WriteFish writes the fish completion script for root to w. It is loaded
+// with
+//
+//	app completion fish | source
+//
+// or installed as ~/.config/fish/completions/app.fish.
+func WriteFish(w io.Writer, rootName string, root *cmds.Command) error {
+	cs := commands(rootName, root)
+	fn := "_" + funcName(rootName)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# fish completion for %s\n\n", rootName)
+
+	// the function returning the command being completed, see writePathLoop
+	fmt.Fprintf(&b, "function %s_cmd\n\tset -l cmd %s\n", fn, fishQuote(cs[0].path))
+	if len(cs) > 1 {
+		paths := make([]string, 0, len(cs)-1)
+		for _, c := range cs[1:] {
+			paths = append(paths, fishQuote(c.path))
+		}
+		b.WriteString("\tfor w in (commandline -opc)[2..-1]\n\t\tswitch \"$cmd $w\"\n")
+		fmt.Fprintf(&b, "\t\t\tcase %s\n\t\t\t\tset cmd \"$cmd $w\"\n\t\tend\n\tend\n", strings.Join(paths, " "))
+	}
+	b.WriteString("\techo $cmd\nend\n\n")
+	fmt.Fprintf(&b, "function %s_is\n\ttest (%s_cmd) = \"$argv[1]\"\nend\n", fn, fn)
+
+	for _, c := range cs {
+		complete := fmt.Sprintf("complete -c %s -n %s", fishQuote(rootName), fishQuote(fn+"_is "+fishQuote(c.path)))
+
+		b.WriteString("\n")
+		for _, s := range c.subs {
+			fmt.Fprintf(&b, "%s -f -a %s", complete, fishQuote(s.name))
+			if s.tagline != "" {
+				fmt.Fprintf(&b, " -d %s", fishQuote(s.tagline))
+			}
+			b.WriteString("\n")
+		}
+		for _, o := range c.opts {
+			b.WriteString(complete)
+			for _, flag := range o.flags {
+				if strings.HasPrefix(flag, "--") {
+					fmt.Fprintf(&b, " -l %s", fishQuote(flag[2:]))
+				} else {
+					fmt.Fprintf(&b, " -s %s", fishQuote(flag[1:]))
+				}
+			}
+			if len(o.values) > 0 {
+				fmt.Fprintf(&b, " -x -a %s", fishQuote(strings.Join(o.values, " ")))
+			} else if o.value {
+				b.WriteString(" -r")
+			}
+			if o.description != "" {
+				fmt.Fprintf(&b, " -d %s", fishQuote(o.description))
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
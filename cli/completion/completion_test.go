@@ -0,0 +1,130 @@
+package completion
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+var root = &cmds.Command{
+	Options: []cmdkit.Option{
+		cmds.EnumOption([]string{"json", "xml"}, "encoding", "enc", "The encoding type"),
+		cmdkit.BoolOption("help", "h", "Show help"),
+	},
+	Subcommands: map[string]*cmds.Command{
+		"pin": {
+			Helptext: cmdkit.HelpText{Tagline: "Pin objects, it's fast"},
+			Subcommands: map[string]*cmds.Command{
+				"add": {
+					Options: []cmdkit.Option{
+						cmdkit.BoolOption("recursive", "r", "Pin recursively"),
+						cmdkit.StringOption("name", "A name for the pin"),
+					},
+				},
+			},
+		},
+		"cat":   {},
+		"debug": {Hidden: true},
+	},
+}
+
+func TestWriteBash(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not found")
+	}
+
+	var buf bytes.Buffer
+	if err := WriteBash(&buf, "app", root); err != nil {
+		t.Fatal(err)
+	}
+
+	tcs := []struct {
+		line     string
+		expected string
+	}{
+		{"app ", "cat pin"},
+		{"app p", "pin"},
+		{"app --enc", "--encoding --enc"},
+		{"app --enc ", "json xml"},
+		{"app --enc json p", "pin"},
+		{"app pin ", "add"},
+		{"app pin add -", "--encoding --enc --help -h --recursive -r --name"},
+		{"app pin add --name ", ""},
+		{"app cat -", "--encoding --enc --help -h"},
+		{"app debug ", "cat pin"},
+	}
+
+	for _, tc := range tcs {
+		script := buf.String() + `
+COMP_WORDS=(` + tc.line + `)
+COMP_CWORD=$((${#COMP_WORDS[@]} - 1))
+[[ "$COMP_LINE" == *" " ]] && { COMP_WORDS+=(""); COMP_CWORD=$((COMP_CWORD + 1)); }
+_app
+echo "${COMPREPLY[*]}"
+`
+		cmd := exec.Command(bash, "-c", script)
+		cmd.Env = []string{"COMP_LINE=" + tc.line}
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("%q: %s: %s", tc.line, err, out)
+		}
+		if completions := strings.TrimSpace(string(out)); completions != tc.expected {
+			t.Errorf("%q: expected the completions %q, got %q", tc.line, tc.expected, completions)
+		}
+	}
+}
+
+func TestWriteZsh(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteZsh(&buf, "app", root); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(buf.String(), "#compdef app\n") {
+		t.Errorf("expected the script to start with #compdef:\n%s", buf.String())
+	}
+	for _, line := range []string{
+		`		'app cat'|'app pin'|'app pin add') cmd="$cmd ${words[i]}" ;;`,
+		`		--encoding|--enc) compadd -- 'json' 'xml'; return ;;`,
+		`		--name) _message value; return ;;`,
+		`		subs=('cat' 'pin:Pin objects, it'\''s fast')`,
+		`	compdef _app 'app'`,
+	} {
+		if !strings.Contains(buf.String(), "\n"+line+"\n") {
+			t.Errorf("expected line %q in:\n%s", line, buf.String())
+		}
+	}
+}
+
+func TestWriteFish(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteFish(&buf, "app", root); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{
+		`			case 'app cat' 'app pin' 'app pin add'`,
+		`complete -c 'app' -n '__app_is \'app\'' -f -a 'pin' -d 'Pin objects, it\'s fast'`,
+		`complete -c 'app' -n '__app_is \'app pin\'' -l 'encoding' -l 'enc' -x -a 'json xml' -d 'The encoding type. One of: json, xml.'`,
+		`complete -c 'app' -n '__app_is \'app pin add\'' -l 'recursive' -s 'r' -d 'Pin recursively.'`,
+		`complete -c 'app' -n '__app_is \'app pin add\'' -l 'name' -r -d 'A name for the pin.'`,
+	} {
+		if !strings.Contains(buf.String(), "\n"+line+"\n") {
+			t.Errorf("expected line %q in:\n%s", line, buf.String())
+		}
+	}
+	if strings.Contains(buf.String(), "debug") {
+		t.Errorf("expected the hidden command to be left out:\n%s", buf.String())
+	}
+}
+
+func TestWriteUnknownShell(t *testing.T) {
+	if err := Write(&bytes.Buffer{}, Shell("csh"), "app", root); err == nil {
+		t.Error("expected an error for an unknown shell")
+	}
+}
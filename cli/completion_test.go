@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+func TestCompletionCommand(t *testing.T) {
+	root := &cmds.Command{
+		Options: []cmdkit.Option{
+			cmds.EnumOption([]string{"json", "text"}, "encoding", "The encoding"),
+		},
+		Subcommands: map[string]*cmds.Command{
+			"add": {},
+		},
+	}
+	root.Subcommands["completion"] = CompletionCommand(root)
+
+	out, err := ioutil.TempFile("", "cli-completion")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	buildEnv := func(context.Context, *cmds.Request) (cmds.Environment, error) {
+		return nil, nil
+	}
+	makeExecutor := func(*cmds.Request, interface{}) (cmds.Executor, error) {
+		return cmds.NewExecutor(root), nil
+	}
+	err = Run(context.Background(), root, []string{"test", "completion", "fish"}, nil, out, out, buildEnv, makeExecutor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	script, err := ioutil.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Base(os.Args[0])
+	for _, s := range []string{
+		"'" + name + " completion bash'",
+		"-f -a 'add'",
+		"-l 'encoding' -x -a 'json text'",
+	} {
+		if !strings.Contains(string(script), s) {
+			t.Errorf("expected %q in the script:\n%s", s, script)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+)
+
+// Exit codes used by Run and the ResponseEmitter returned by
+// NewResponseEmitter:
+//
+//   - ExitSuccess if the command succeeded,
+//   - ExitFailure if the command failed,
+//   - ExitUsage if the command line couldn't be parsed (including missing or
+//     unreadable files given as arguments) or the command failed with a
+//     cmdkit.ErrClient error,
+//   - ExitInterrupted if the command was canceled by SIGINT.
+//
+// Commands can use other codes by calling Exit on the ResponseEmitter or by
+// closing it with an error created by WithExitCode or a *cmds.CodedError,
+// whose code is also passed on by the HTTP transport.
+const (
+	ExitSuccess     = 0
+	ExitFailure     = 1
+	ExitUsage       = 2
+	ExitInterrupted = 130
+)
+
+// ExitError is the error used when a specific exit code needs to be returned.
+type ExitError int
+
+func (e ExitError) Error() string {
+	return fmt.Sprintf("exit code %d", int(e))
+}
+
+// ExitCode returns the exit code.
+func (e ExitError) ExitCode() int {
+	return int(e)
+}
+
+// ExitCoder is implemented by errors that determine the exit code of the
+// process.
+type ExitCoder interface {
+	error
+	ExitCode() int
+}
+
+type exitCodeError struct {
+	error
+	code int
+}
+
+func (e exitCodeError) ExitCode() int {
+	return e.code
+}
+
+// WithExitCode returns an error with the message of err that makes the CLI
+// exit with code.
+func WithExitCode(err error, code int) error {
+	return exitCodeError{error: err, code: code}
+}
+
+// exitCode returns the exit code for err, see ExitSuccess.
+func exitCode(err error) int {
+	switch e := err.(type) {
+	case nil:
+		return ExitSuccess
+	case ExitCoder:
+		return e.ExitCode()
+	case *UsageError:
+		return ExitUsage
+	case cmdkit.Error:
+		if e.Code == cmdkit.ErrClient {
+			return ExitUsage
+		}
+	case *cmdkit.Error:
+		if e.Code == cmdkit.ErrClient {
+			return ExitUsage
+		}
+	}
+
+	return ExitFailure
+}
+
+// ExitCodeOf returns the code the CLI exits with if a command fails with
+// err, see ExitSuccess.
+func ExitCodeOf(err error) int {
+	return exitCode(err)
+}
@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+func TestExitCode(t *testing.T) {
+	type testcase struct {
+		err  error
+		code int
+	}
+
+	tcs := []testcase{
+		{err: nil, code: ExitSuccess},
+		{err: errors.New("failed"), code: ExitFailure},
+		{err: cmdkit.Error{Message: "failed", Code: cmdkit.ErrNormal}, code: ExitFailure},
+		{err: cmdkit.Error{Message: "bad input", Code: cmdkit.ErrClient}, code: ExitUsage},
+		{err: &cmdkit.Error{Message: "bad input", Code: cmdkit.ErrClient}, code: ExitUsage},
+		{err: optionErrorf("foo", "unknown option %q", "foo"), code: ExitUsage},
+		{err: ExitError(3), code: 3},
+		{err: WithExitCode(errors.New("not found"), 4), code: 4},
+		{err: cmds.NotFoundError("no such pin"), code: cmds.NotFoundCode},
+		{err: cmds.InternalError("disk failure"), code: cmds.InternalErrorCode},
+	}
+
+	for _, tc := range tcs {
+		if code := exitCode(tc.err); code != tc.code {
+			t.Errorf("exitCode(%v): expected %d, got %d", tc.err, tc.code, code)
+		}
+	}
+
+	if err := WithExitCode(errors.New("not found"), 4); err.Error() != "not found" {
+		t.Errorf("expected message to be kept, got %q", err)
+	}
+}
+
+func TestRunParseErrorExitCode(t *testing.T) {
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"add": {
+				Arguments: []cmdkit.Argument{
+					cmdkit.FileArg("path", true, false, "The file to add."),
+				},
+				Run: func(*cmds.Request, cmds.ResponseEmitter, cmds.Environment) error {
+					return nil
+				},
+			},
+		},
+	}
+
+	out, err := ioutil.TempFile("", "cli-exit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	// neither a usage error nor an error from the command, but still caused
+	// by bad input
+	cmdline := []string{"test", "add", "/does/not/exist"}
+	err = Run(context.Background(), root, cmdline, nil, out, out, nil, nil)
+	if code := exitCode(err); code != ExitUsage {
+		t.Errorf("expected exit code %d, got %d (%v)", ExitUsage, code, err)
+	}
+}
@@ -0,0 +1,156 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+// CommandHelp is a structured description of a command, written instead of
+// the help text if help is requested with an encoding other than text, e.g.
+// `--help --enc=json`.
+type CommandHelp struct {
+	// Command is the full command line of the command, e.g. "ipfs add".
+	Command string `json:"command"`
+	// Synopsis is the generated usage line, e.g. "ipfs add [--recursive] <path>...".
+	Synopsis string `json:"synopsis"`
+
+	Tagline          string `json:"tagline,omitempty"`
+	ShortDescription string `json:"shortDescription,omitempty"`
+	LongDescription  string `json:"longDescription,omitempty"`
+	// Usage holds the usage examples of the help text.
+	Usage string `json:"usage,omitempty"`
+
+	Arguments   []ArgumentHelp   `json:"arguments"`
+	Options     []OptionHelp     `json:"options"`
+	Subcommands []SubcommandHelp `json:"subcommands"`
+}
+
+// ArgumentHelp describes an argument of a command.
+type ArgumentHelp struct {
+	Name          string `json:"name"`
+	Type          string `json:"type"`
+	Required      bool   `json:"required"`
+	Variadic      bool   `json:"variadic"`
+	SupportsStdin bool   `json:"supportsStdin"`
+	Recursive     bool   `json:"recursive"`
+	Description   string `json:"description"`
+}
+
+// OptionHelp describes an option of a command.
+type OptionHelp struct {
+	Names       []string    `json:"names"`
+	Type        string      `json:"type"`
+	Default     interface{} `json:"default,omitempty"`
+	Description string      `json:"description"`
+}
+
+// SubcommandHelp describes a subcommand of a command.
+type SubcommandHelp struct {
+	Name    string `json:"name"`
+	Command string `json:"command"`
+	Tagline string `json:"tagline,omitempty"`
+}
+
+// Describe returns the structured help of the command at path, translated to
+// lang.
+func Describe(rootName string, root *cmds.Command, path []string, lang string) (*CommandHelp, error) {
+	cmd, err := root.Get(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pathStr := strings.Join(append([]string{rootName}, path...), " ")
+	tr := func(msg string) string { return Translate(lang, msg) }
+
+	help := &CommandHelp{
+		Command:          pathStr,
+		Synopsis:         generateSynopsis(cmd, pathStr),
+		Tagline:          tr(cmd.Helptext.Tagline),
+		ShortDescription: tr(cmd.Helptext.ShortDescription),
+		LongDescription:  tr(cmd.Helptext.LongDescription),
+		Usage:            tr(cmd.Helptext.Usage),
+		Arguments:        make([]ArgumentHelp, 0, len(cmd.Arguments)),
+		Options:          make([]OptionHelp, 0, len(cmd.Options)),
+		Subcommands:      make([]SubcommandHelp, 0, len(cmd.Subcommands)),
+	}
+
+	for _, arg := range cmd.Arguments {
+		typ := "string"
+		if arg.Type == cmdkit.ArgFile {
+			typ = "file"
+		}
+
+		help.Arguments = append(help.Arguments, ArgumentHelp{
+			Name:          arg.Name,
+			Type:          typ,
+			Required:      arg.Required,
+			Variadic:      arg.Variadic,
+			SupportsStdin: arg.SupportsStdin,
+			Recursive:     arg.Recursive,
+			Description:   tr(arg.Description),
+		})
+	}
+
+	for _, opt := range cmd.Options {
+		help.Options = append(help.Options, OptionHelp{
+			Names:       sortByLength(opt.Names()),
+			Type:        fmt.Sprintf("%v", opt.Type()),
+			Default:     opt.Default(),
+			Description: tr(opt.Description()),
+		})
+	}
+
+	names := make([]string, 0, len(cmd.Subcommands))
+	for name, sub := range cmd.Subcommands {
+		if !sub.Hidden {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		help.Subcommands = append(help.Subcommands, SubcommandHelp{
+			Name:    name,
+			Command: pathStr + " " + name,
+			Tagline: tr(cmd.Subcommands[name].Helptext.Tagline),
+		})
+	}
+
+	return help, nil
+}
+
+// helpEncoding returns the encoding help should be written in if it wasn't
+// requested as text.
+func helpEncoding(req *cmds.Request) (cmds.EncodingType, bool) {
+	enc, _ := req.Options[cmds.EncLong].(string)
+	switch cmds.EncodingType(enc) {
+	case "", cmds.Text, cmds.TextNewline:
+		return "", false
+	default:
+		return cmds.EncodingType(enc), true
+	}
+}
+
+// writeHelpData writes the structured help of the command addressed by req
+// to out, encoded with enc.
+func writeHelpData(appName string, req *cmds.Request, out io.Writer, enc cmds.EncodingType) error {
+	help, err := Describe(appName, req.Root, req.Path, Language(req))
+	if err != nil {
+		return err
+	}
+
+	mkEnc, ok := cmds.DefaultEncoders.Lookup(enc, help)
+	if !ok {
+		mkEnc, ok = cmds.Encoders[enc]
+	}
+	if !ok {
+		return fmt.Errorf("invalid encoding for help: %s", enc)
+	}
+
+	return mkEnc(req)(out).Encode(help)
+}
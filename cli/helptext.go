@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
@@ -76,41 +77,43 @@ func (f *helpFields) IndentAll() {
 
 const usageFormat = "{{if .Usage}}{{.Usage}}{{else}}{{.Path}}{{if .ArgUsage}} {{.ArgUsage}}{{end}} - {{.Tagline}}{{end}}"
 
-const longHelpFormat = `USAGE
+// The T function used in the templates translates the given message, see
+// Catalog.
+const longHelpFormat = `{{T "USAGE"}}
 {{.Indent}}{{template "usage" .}}
 
-{{if .Synopsis}}SYNOPSIS
+{{if .Synopsis}}{{T "SYNOPSIS"}}
 {{.Synopsis}}
 
-{{end}}{{if .Arguments}}ARGUMENTS
+{{end}}{{if .Arguments}}{{T "ARGUMENTS"}}
 
 {{.Arguments}}
 
-{{end}}{{if .Options}}OPTIONS
+{{end}}{{if .Options}}{{T "OPTIONS"}}
 
 {{.Options}}
 
-{{end}}{{if .Description}}DESCRIPTION
+{{end}}{{if .Description}}{{T "DESCRIPTION"}}
 
 {{.Description}}
 
-{{end}}{{if .Subcommands}}SUBCOMMANDS
+{{end}}{{if .Subcommands}}{{T "SUBCOMMANDS"}}
 {{.Subcommands}}
 
-{{.Indent}}Use '{{.Path}} <subcmd> --help' for more information about each command.
+{{.Indent}}{{printf (T "Use '%s <subcmd> --help' for more information about each command.") .Path}}
 {{end}}
 `
-const shortHelpFormat = `USAGE
+const shortHelpFormat = `{{T "USAGE"}}
 {{.Indent}}{{template "usage" .}}
 {{if .Synopsis}}
 {{.Synopsis}}
 {{end}}{{if .Description}}
 {{.Description}}
 {{end}}{{if .Subcommands}}
-SUBCOMMANDS
+{{T "SUBCOMMANDS"}}
 {{.Subcommands}}
 {{end}}{{if .MoreHelp}}
-Use '{{.Path}} --help' for more information about this command.
+{{printf (T "Use '%s --help' for more information about this command.") .Path}}
 {{end}}
 `
 
@@ -119,29 +122,77 @@ var longHelpTemplate *template.Template
 var shortHelpTemplate *template.Template
 
 func init() {
-	usageTemplate = template.Must(template.New("usage").Parse(usageFormat))
+	usageTemplate = template.Must(template.New("usage").Funcs(translateFuncs("")).Parse(usageFormat))
 	longHelpTemplate = template.Must(usageTemplate.New("longHelp").Parse(longHelpFormat))
 	shortHelpTemplate = template.Must(usageTemplate.New("shortHelp").Parse(shortHelpFormat))
 }
 
+// SetLongHelpTemplate replaces the text/template of the long help text,
+// e.g. to add a section about the configuration of the application. The
+// template is executed with the fields Indent, Usage, Path, ArgUsage,
+// Tagline, Arguments, Options, Synopsis, Subcommands, Description and
+// MoreHelp of the command, the sections already indented. It can include
+// the "usage" template, the usage line of the command, and translate
+// messages with the T function, see Catalog. Applications set templates
+// before help is written, e.g. in init.
+func SetLongHelpTemplate(text string) error {
+	tmpl, err := parseHelpTemplate("longHelp", text)
+	if err != nil {
+		return err
+	}
+	longHelpTemplate = tmpl
+	return nil
+}
+
+// SetShortHelpTemplate replaces the template of the short help text, like
+// SetLongHelpTemplate. Arguments and Options are empty.
+func SetShortHelpTemplate(text string) error {
+	tmpl, err := parseHelpTemplate("shortHelp", text)
+	if err != nil {
+		return err
+	}
+	shortHelpTemplate = tmpl
+	return nil
+}
+
+// parseHelpTemplate parses the help template text, which can include the
+// usage template.
+func parseHelpTemplate(name, text string) (*template.Template, error) {
+	base, err := usageTemplate.Clone()
+	if err != nil {
+		return nil, err
+	}
+	return base.New(name).Parse(text)
+}
+
 var ErrNoHelpRequested = errors.New("no help requested")
 
 func HandleHelp(appName string, req *cmds.Request, out io.Writer) error {
 	long, _ := req.Options[cmds.OptLongHelp].(bool)
 	short, _ := req.Options[cmds.OptShortHelp].(bool)
 
+	if enc, ok := helpEncoding(req); ok && (long || short) {
+		return writeHelpData(appName, req, out, enc)
+	}
+
 	switch {
 	case long:
-		return LongHelp(appName, req.Root, req.Path, out)
+		return longHelp(appName, req.Root, req.Path, out, OutputWidth(req, out), Language(req))
 	case short:
-		return ShortHelp(appName, req.Root, req.Path, out)
+		return shortHelp(appName, req.Root, req.Path, out, OutputWidth(req, out), Language(req))
 	default:
 		return ErrNoHelpRequested
 	}
 }
 
-// LongHelp writes a formatted CLI helptext string to a Writer for the given command
+// LongHelp writes a formatted CLI helptext string to a Writer for the given command.
+// If out is a terminal, the text is wrapped at its width. The text is
+// translated to the language set in the environment, see Language.
 func LongHelp(rootName string, root *cmds.Command, path []string, out io.Writer) error {
+	return longHelp(rootName, root, path, out, OutputWidth(nil, out), Language(nil))
+}
+
+func longHelp(rootName string, root *cmds.Command, path []string, out io.Writer, width int, lang string) error {
 	cmd, err := root.Get(path)
 	if err != nil {
 		return err
@@ -152,33 +203,35 @@ func LongHelp(rootName string, root *cmds.Command, path []string, out io.Writer)
 		pathStr += " " + strings.Join(path, " ")
 	}
 
+	tr := func(msg string) string { return Translate(lang, msg) }
+
 	fields := helpFields{
 		Indent:      indentStr,
 		Path:        pathStr,
 		ArgUsage:    usageText(cmd),
-		Tagline:     cmd.Helptext.Tagline,
-		Arguments:   cmd.Helptext.Arguments,
-		Options:     cmd.Helptext.Options,
-		Synopsis:    cmd.Helptext.Synopsis,
-		Subcommands: cmd.Helptext.Subcommands,
-		Description: cmd.Helptext.ShortDescription,
-		Usage:       cmd.Helptext.Usage,
+		Tagline:     tr(cmd.Helptext.Tagline),
+		Arguments:   tr(cmd.Helptext.Arguments),
+		Options:     tr(cmd.Helptext.Options),
+		Synopsis:    tr(cmd.Helptext.Synopsis),
+		Subcommands: tr(cmd.Helptext.Subcommands),
+		Description: tr(cmd.Helptext.ShortDescription),
+		Usage:       tr(cmd.Helptext.Usage),
 		MoreHelp:    (cmd != root),
 	}
 
 	if len(cmd.Helptext.LongDescription) > 0 {
-		fields.Description = cmd.Helptext.LongDescription
+		fields.Description = tr(cmd.Helptext.LongDescription)
 	}
 
 	// autogen fields that are empty
 	if len(fields.Arguments) == 0 {
-		fields.Arguments = strings.Join(argumentText(cmd), "\n")
+		fields.Arguments = strings.Join(argumentText(lang, cmd), "\n")
 	}
 	if len(fields.Options) == 0 {
-		fields.Options = strings.Join(optionText(cmd), "\n")
+		fields.Options = strings.Join(optionText(lang, cmd), "\n")
 	}
 	if len(fields.Subcommands) == 0 {
-		fields.Subcommands = strings.Join(subcommandText(cmd, rootName, path), "\n")
+		fields.Subcommands = strings.Join(subcommandText(lang, cmd, rootName, path), "\n")
 	}
 	if len(fields.Synopsis) == 0 {
 		fields.Synopsis = generateSynopsis(cmd, pathStr)
@@ -190,11 +243,17 @@ func LongHelp(rootName string, root *cmds.Command, path []string, out io.Writer)
 	// indent all fields that have been set
 	fields.IndentAll()
 
-	return longHelpTemplate.Execute(out, fields)
+	return executeWrapped(longHelpTemplate, fields, out, width, lang)
 }
 
-// ShortHelp writes a formatted CLI helptext string to a Writer for the given command
+// ShortHelp writes a formatted CLI helptext string to a Writer for the given command.
+// If out is a terminal, the text is wrapped at its width. The text is
+// translated to the language set in the environment, see Language.
 func ShortHelp(rootName string, root *cmds.Command, path []string, out io.Writer) error {
+	return shortHelp(rootName, root, path, out, OutputWidth(nil, out), Language(nil))
+}
+
+func shortHelp(rootName string, root *cmds.Command, path []string, out io.Writer, width int, lang string) error {
 	cmd, err := root.Get(path)
 	if err != nil {
 		return err
@@ -210,21 +269,23 @@ func ShortHelp(rootName string, root *cmds.Command, path []string, out io.Writer
 		pathStr += " " + strings.Join(path, " ")
 	}
 
+	tr := func(msg string) string { return Translate(lang, msg) }
+
 	fields := helpFields{
 		Indent:      indentStr,
 		Path:        pathStr,
 		ArgUsage:    usageText(cmd),
-		Tagline:     cmd.Helptext.Tagline,
-		Synopsis:    cmd.Helptext.Synopsis,
-		Description: cmd.Helptext.ShortDescription,
-		Subcommands: cmd.Helptext.Subcommands,
-		Usage:       cmd.Helptext.Usage,
+		Tagline:     tr(cmd.Helptext.Tagline),
+		Synopsis:    tr(cmd.Helptext.Synopsis),
+		Description: tr(cmd.Helptext.ShortDescription),
+		Subcommands: tr(cmd.Helptext.Subcommands),
+		Usage:       tr(cmd.Helptext.Usage),
 		MoreHelp:    (cmd != root),
 	}
 
 	// autogen fields that are empty
 	if len(fields.Subcommands) == 0 {
-		fields.Subcommands = strings.Join(subcommandText(cmd, rootName, path), "\n")
+		fields.Subcommands = strings.Join(subcommandText(lang, cmd, rootName, path), "\n")
 	}
 	if len(fields.Synopsis) == 0 {
 		fields.Synopsis = generateSynopsis(cmd, pathStr)
@@ -236,7 +297,38 @@ func ShortHelp(rootName string, root *cmds.Command, path []string, out io.Writer
 	// indent all fields that have been set
 	fields.IndentAll()
 
-	return shortHelpTemplate.Execute(out, fields)
+	return executeWrapped(shortHelpTemplate, fields, out, width, lang)
+}
+
+func translateFuncs(lang string) template.FuncMap {
+	return template.FuncMap{
+		"T": func(msg string) string { return Translate(lang, msg) },
+	}
+}
+
+// executeWrapped executes tmpl, translated to lang, and writes the output
+// wrapped at width to out.
+func executeWrapped(tmpl *template.Template, fields helpFields, out io.Writer, width int, lang string) error {
+	if lang != "" {
+		var err error
+		tmpl, err = tmpl.Clone()
+		if err != nil {
+			return err
+		}
+		tmpl = tmpl.Funcs(translateFuncs(lang))
+	}
+
+	if width <= 0 {
+		return tmpl.Execute(out, fields)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, fields); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(out, WrapText(buf.String(), width))
+	return err
 }
 
 func generateSynopsis(cmd *cmds.Command, path string) string {
@@ -287,7 +379,7 @@ func generateSynopsis(cmd *cmds.Command, path string) string {
 	return strings.Trim(res, " ")
 }
 
-func argumentText(cmd *cmds.Command) []string {
+func argumentText(lang string, cmd *cmds.Command) []string {
 	lines := make([]string, len(cmd.Arguments))
 
 	for i, arg := range cmd.Arguments {
@@ -295,7 +387,7 @@ func argumentText(cmd *cmds.Command) []string {
 	}
 	lines = align(lines)
 	for i, arg := range cmd.Arguments {
-		lines[i] += " - " + arg.Description
+		lines[i] += " - " + Translate(lang, arg.Description)
 	}
 
 	return lines
@@ -309,7 +401,7 @@ func optionFlag(flag string) string {
 	}
 }
 
-func optionText(cmd ...*cmds.Command) []string {
+func optionText(lang string, cmd ...*cmds.Command) []string {
 	// get a slice of the options we want to list out
 	options := make([]cmdkit.Option, 0)
 	for _, c := range cmd {
@@ -358,13 +450,13 @@ func optionText(cmd ...*cmds.Command) []string {
 
 	// add option descriptions to output
 	for i, opt := range options {
-		lines[i] += " - " + opt.Description()
+		lines[i] += " - " + Translate(lang, opt.Description())
 	}
 
 	return lines
 }
 
-func subcommandText(cmd *cmds.Command, rootName string, path []string) []string {
+func subcommandText(lang string, cmd *cmds.Command, rootName string, path []string) []string {
 	prefix := fmt.Sprintf("%v %v", rootName, strings.Join(path, " "))
 	if len(path) > 0 {
 		prefix += " "
@@ -372,13 +464,15 @@ func subcommandText(cmd *cmds.Command, rootName string, path []string) []string
 
 	// Sorting fixes changing order bug #2981.
 	sortedNames := make([]string, 0)
-	for name := range cmd.Subcommands {
-		sortedNames = append(sortedNames, name)
+	for name, sub := range cmd.Subcommands {
+		if !sub.Hidden {
+			sortedNames = append(sortedNames, name)
+		}
 	}
 	sort.Strings(sortedNames)
 
-	subcmds := make([]*cmds.Command, len(cmd.Subcommands))
-	lines := make([]string, len(cmd.Subcommands))
+	subcmds := make([]*cmds.Command, len(sortedNames))
+	lines := make([]string, len(sortedNames))
 
 	for i, name := range sortedNames {
 		sub := cmd.Subcommands[name]
@@ -393,7 +487,7 @@ func subcommandText(cmd *cmds.Command, rootName string, path []string) []string
 
 	lines = align(lines)
 	for i, sub := range subcmds {
-		lines[i] += " - " + sub.Helptext.Tagline
+		lines[i] += " - " + Translate(lang, sub.Helptext.Tagline)
 	}
 
 	return lines
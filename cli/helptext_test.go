@@ -1,8 +1,11 @@
 package cli
 
 import (
+	"bytes"
+	"encoding/json"
 	"strings"
 	"testing"
+	"text/template"
 
 	"github.com/ipfs/go-ipfs-cmdkit"
 	"github.com/ipfs/go-ipfs-cmds"
@@ -44,3 +47,126 @@ func TestSynopsisGenerator(t *testing.T) {
 		t.Fatal("Synopsis should contain options finalizer")
 	}
 }
+
+func TestHelpJSON(t *testing.T) {
+	root := &cmds.Command{
+		Options: []cmdkit.Option{
+			cmds.OptionEncodingType,
+			cmdkit.BoolOption(cmds.OptLongHelp, "Show the full command help text."),
+		},
+		Subcommands: map[string]*cmds.Command{
+			"add": {
+				Arguments: []cmdkit.Argument{
+					cmdkit.FileArg("path", true, true, "The path to add."),
+				},
+				Options: []cmdkit.Option{
+					cmdkit.BoolOption("quiet", "q", "Write minimal output."),
+				},
+				Helptext: cmdkit.HelpText{
+					Tagline: "Add a file.",
+					Usage:   "test add foo.txt",
+				},
+				Subcommands: map[string]*cmds.Command{
+					"dir": {Helptext: cmdkit.HelpText{Tagline: "Add a directory."}},
+				},
+			},
+		},
+	}
+
+	req := &cmds.Request{
+		Root:    root,
+		Command: root.Subcommands["add"],
+		Path:    []string{"add"},
+		Options: cmdkit.OptMap{
+			cmds.OptLongHelp: true,
+			cmds.EncLong:     cmds.JSON,
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := HandleHelp("test", req, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var help CommandHelp
+	if err := json.Unmarshal(buf.Bytes(), &help); err != nil {
+		t.Fatalf("help is not valid JSON: %s\n%s", err, buf.String())
+	}
+
+	if help.Command != "test add" || help.Tagline != "Add a file." || help.Usage != "test add foo.txt" {
+		t.Errorf("unexpected help: %+v", help)
+	}
+	if !strings.HasPrefix(help.Synopsis, "test add [--quiet | -q]") {
+		t.Errorf("unexpected synopsis %q", help.Synopsis)
+	}
+	if len(help.Arguments) != 1 || help.Arguments[0].Name != "path" || help.Arguments[0].Type != "file" ||
+		!help.Arguments[0].Required || !help.Arguments[0].Variadic {
+		t.Errorf("unexpected arguments: %+v", help.Arguments)
+	}
+	if len(help.Options) != 1 || strings.Join(help.Options[0].Names, ",") != "q,quiet" || help.Options[0].Type != "bool" {
+		t.Errorf("unexpected options: %+v", help.Options)
+	}
+	if len(help.Subcommands) != 1 || help.Subcommands[0].Command != "test add dir" {
+		t.Errorf("unexpected subcommands: %+v", help.Subcommands)
+	}
+
+	// text encoding keeps the regular help text
+	req.Options[cmds.EncLong] = cmds.Text
+	buf.Reset()
+	if err := HandleHelp("test", req, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "USAGE") {
+		t.Errorf("expected help text, got:\n%s", buf.String())
+	}
+}
+
+func TestHiddenSubcommands(t *testing.T) {
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"shown":  {Helptext: cmdkit.HelpText{Tagline: "A listed command."}},
+			"hidden": {Hidden: true, Helptext: cmdkit.HelpText{Tagline: "A hidden command."}},
+		},
+	}
+
+	lines := subcommandText("", root, "app", nil)
+	if len(lines) != 1 || !strings.Contains(lines[0], "shown") {
+		t.Errorf("expected only the shown subcommand, got %q", lines)
+	}
+
+	help, err := Describe("app", root, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(help.Subcommands) != 1 || help.Subcommands[0].Name != "shown" {
+		t.Errorf("expected only the shown subcommand, got %v", help.Subcommands)
+	}
+}
+
+func TestHelpTemplate(t *testing.T) {
+	defer func(tmpl *template.Template) { longHelpTemplate = tmpl }(longHelpTemplate)
+
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"add": {
+				Helptext: cmdkit.HelpText{Tagline: "Add a file."},
+				Run:      func(*cmds.Request, cmds.ResponseEmitter, cmds.Environment) error { return nil },
+			},
+		},
+	}
+
+	if err := SetLongHelpTemplate(`{{.Tagline}} {{template "usage" .}}`); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := LongHelp("app", root, []string{"add"}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); !strings.HasPrefix(out, "Add a file. app add") {
+		t.Errorf("expected the custom template to be used, got %q", out)
+	}
+
+	if err := SetLongHelpTemplate(`{{.Tagline`); err == nil {
+		t.Error("expected invalid templates to fail")
+	}
+}
@@ -0,0 +1,128 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+// Catalog maps messages to their translations. The keys are the untranslated
+// messages, i.e. HelpText fields, option and argument descriptions, the
+// headings of the help text, the format strings of the errors returned by
+// Parse (e.g. "unknown option %q") and the Messages of cmds.CodedErrors.
+type Catalog map[string]string
+
+var (
+	catalogsLk sync.RWMutex
+	catalogs   = make(map[string]Catalog)
+)
+
+// RegisterCatalog registers the message catalog for lang, e.g. "de" or
+// "pt_BR". Registering a catalog for a language that already has one merges
+// the catalogs, overwriting existing messages.
+func RegisterCatalog(lang string, c Catalog) {
+	catalogsLk.Lock()
+	defer catalogsLk.Unlock()
+
+	lang = normalizeLang(lang)
+	cat, ok := catalogs[lang]
+	if !ok {
+		cat = make(Catalog, len(c))
+		catalogs[lang] = cat
+	}
+	for k, v := range c {
+		cat[k] = v
+	}
+}
+
+// Language returns the language selected by the --lang option in req or, if
+// not set, the LC_ALL, LC_MESSAGES or LANG environment variables. req may be
+// nil.
+func Language(req *cmds.Request) string {
+	if req != nil {
+		if lang, ok := req.Options[cmds.LangOpt].(string); ok && lang != "" {
+			return normalizeLang(lang)
+		}
+	}
+
+	for _, env := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if lang := os.Getenv(env); lang != "" {
+			return normalizeLang(lang)
+		}
+	}
+
+	return ""
+}
+
+// normalizeLang turns e.g. "de-DE.UTF-8" into "de_DE".
+func normalizeLang(lang string) string {
+	if i := strings.IndexAny(lang, ".@"); i >= 0 {
+		lang = lang[:i]
+	}
+	return strings.Replace(lang, "-", "_", -1)
+}
+
+// Translate returns the translation of msg in lang. If the catalog for e.g.
+// "de_DE" doesn't contain msg, the catalog for "de" is tried. If there is no
+// translation, msg is returned.
+func Translate(lang, msg string) string {
+	if lang == "" || msg == "" {
+		return msg
+	}
+
+	catalogsLk.RLock()
+	defer catalogsLk.RUnlock()
+
+	for {
+		if t, ok := catalogs[lang][msg]; ok {
+			return t
+		}
+
+		i := strings.LastIndex(lang, "_")
+		if i < 0 {
+			return msg
+		}
+		lang = lang[:i]
+	}
+}
+
+// message is an error with a translatable message.
+type message struct {
+	format string
+	args   []interface{}
+}
+
+// errorf returns an error whose message can be translated using a catalog.
+func errorf(format string, args ...interface{}) error {
+	return &message{format: format, args: args}
+}
+
+func (m *message) Error() string {
+	return fmt.Sprintf(m.format, m.args...)
+}
+
+// Translate returns the message translated to lang.
+func (m *message) Translate(lang string) string {
+	return fmt.Sprintf(Translate(lang, m.format), m.args...)
+}
+
+// localize returns the message of err translated to lang.
+func localize(lang string, err error) string {
+	if e, ok := err.(*cmds.CodedError); ok {
+		if len(e.Args) == 0 {
+			return Translate(lang, e.Message)
+		}
+		return fmt.Sprintf(Translate(lang, e.Message), e.Args...)
+	}
+
+	if t, ok := err.(interface {
+		Translate(string) string
+	}); ok {
+		return t.Translate(lang)
+	}
+
+	return Translate(lang, err.Error())
+}
@@ -0,0 +1,122 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+func TestTranslate(t *testing.T) {
+	RegisterCatalog("xx", Catalog{
+		"hello":  "hallo",
+		"option": "Option",
+	})
+	RegisterCatalog("xx-YY.UTF-8", Catalog{
+		"hello": "moin",
+	})
+
+	type testcase struct {
+		lang, msg, out string
+	}
+
+	tcs := []testcase{
+		{lang: "", msg: "hello", out: "hello"},
+		{lang: "xx", msg: "hello", out: "hallo"},
+		{lang: "xx_YY", msg: "hello", out: "moin"},
+		{lang: "xx_YY", msg: "option", out: "Option"},
+		{lang: "xx_ZZ", msg: "hello", out: "hallo"},
+		{lang: "zz", msg: "hello", out: "hello"},
+		{lang: "xx", msg: "missing", out: "missing"},
+	}
+
+	for _, tc := range tcs {
+		if out := Translate(tc.lang, tc.msg); out != tc.out {
+			t.Errorf("Translate(%q, %q): expected %q but got %q", tc.lang, tc.msg, tc.out, out)
+		}
+	}
+}
+
+func TestLocalizedErrors(t *testing.T) {
+	RegisterCatalog("xx", Catalog{
+		"unknown option %q": "unbekannte Option %q",
+	})
+
+	root := &cmds.Command{}
+	_, err := Parse(context.Background(), []string{"--foo"}, nil, root)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if err.Error() != `unknown option "foo"` {
+		t.Errorf("unexpected untranslated error: %q", err)
+	}
+	if msg := localize("xx", err); msg != `unbekannte Option "foo"` {
+		t.Errorf("unexpected translated error: %q", msg)
+	}
+
+	RegisterCatalog("xx", Catalog{
+		"no pin for %s":         "kein Pin für %s",
+		"the repo is read-only": "das Repo ist schreibgeschützt",
+	})
+	if msg := localize("xx", cmds.NotFoundError("no pin for %s", "QmFoo")); msg != "kein Pin für QmFoo" {
+		t.Errorf("unexpected translated coded error: %q", msg)
+	}
+	// coded errors received from servers only have the formatted message
+	remote := &cmds.CodedError{ID: cmds.PermissionDeniedID, Code: cmds.PermissionDeniedCode, Message: "the repo is read-only"}
+	if msg := localize("xx", remote); msg != "das Repo ist schreibgeschützt" {
+		t.Errorf("unexpected translated coded error: %q", msg)
+	}
+}
+
+func TestLocalizedHelp(t *testing.T) {
+	RegisterCatalog("xx", Catalog{
+		"USAGE":                            "VERWENDUNG",
+		"OPTIONS":                          "OPTIONEN",
+		"A test command.":                  "Ein Testbefehl.",
+		"Show the full command help text.": "Zeigt den vollständigen Hilfetext.",
+	})
+
+	root := &cmds.Command{
+		Options: []cmdkit.Option{
+			cmds.OptionLang,
+			cmdkit.BoolOption(cmds.OptLongHelp, "Show the full command help text."),
+		},
+		Helptext: cmdkit.HelpText{
+			Tagline: "A test command.",
+		},
+	}
+
+	req := &cmds.Request{
+		Root:    root,
+		Command: root,
+		Options: cmdkit.OptMap{
+			cmds.OptLongHelp: true,
+			cmds.LangOpt:     "xx",
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := HandleHelp("test", req, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	for _, s := range []string{"VERWENDUNG", "OPTIONEN", "Ein Testbefehl.", "Zeigt den vollständigen Hilfetext."} {
+		if !strings.Contains(out, s) {
+			t.Errorf("expected help text to contain %q, got:\n%s", s, out)
+		}
+	}
+
+	// the templates used for other languages must not be affected
+	buf.Reset()
+	if err := longHelp("test", root, nil, &buf, 0, ""); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "USAGE") {
+		t.Errorf("expected untranslated help text, got:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,222 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+// ManPage writes the manual page of the application rootName with the
+// command tree root to out, in roff for man(1) in section 1. It lists the
+// options of root and every visible command that can be run, with its
+// synopsis, description, arguments and options, e.g. for distribution
+// packages:
+//
+//	ipfs-gen-man > ipfs.1
+//
+// The text is translated to the language set in the environment, see
+// Language.
+func ManPage(rootName string, root *cmds.Command, out io.Writer) error {
+	lang := Language(nil)
+	w := bufio.NewWriter(out)
+
+	help, err := Describe(rootName, root, nil, lang)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, ".TH %s 1\n", roffQuote(strings.ToUpper(rootName)))
+	fmt.Fprintf(w, ".SH %s\n", roffQuote(Translate(lang, "NAME")))
+	name := roffEscape(rootName)
+	if help.Tagline != "" {
+		name += ` \- ` + roffEscape(help.Tagline)
+	}
+	fmt.Fprintln(w, name)
+
+	synopsis := help.Synopsis
+	if len(root.Subcommands) > 0 {
+		synopsis += " <command>"
+	}
+	fmt.Fprintf(w, ".SH %s\n", roffQuote(Translate(lang, "SYNOPSIS")))
+	writeManSynopsis(w, synopsis)
+
+	if desc := manDescription(help); desc != "" {
+		fmt.Fprintf(w, ".SH %s\n", roffQuote(Translate(lang, "DESCRIPTION")))
+		writeManText(w, desc)
+	}
+
+	if len(help.Options) > 0 {
+		fmt.Fprintf(w, ".SH %s\n", roffQuote(Translate(lang, "OPTIONS")))
+		writeManOptions(w, help.Options)
+	}
+
+	var paths [][]string
+	collectManPaths(root, nil, &paths)
+	if len(paths) > 0 {
+		fmt.Fprintf(w, ".SH %s\n", roffQuote(Translate(lang, "COMMANDS")))
+	}
+	for _, path := range paths {
+		help, err := Describe(rootName, root, path, lang)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(w, ".SS %s\n", roffQuote(help.Command))
+		if help.Tagline != "" {
+			fmt.Fprintln(w, roffEscape(help.Tagline))
+			fmt.Fprintln(w, ".PP")
+		}
+		writeManSynopsis(w, help.Synopsis)
+		if desc := manDescription(help); desc != "" {
+			writeManText(w, desc)
+		}
+		if len(help.Arguments) > 0 {
+			fmt.Fprintf(w, ".PP\n%s\n", roffBold(Translate(lang, "ARGUMENTS")))
+			writeManArguments(w, help.Arguments)
+		}
+		if len(help.Options) > 0 {
+			fmt.Fprintf(w, ".PP\n%s\n", roffBold(Translate(lang, "OPTIONS")))
+			writeManOptions(w, help.Options)
+		}
+	}
+
+	return w.Flush()
+}
+
+// collectManPaths appends the paths of the visible commands under cmd that
+// can be run to paths, sorted.
+func collectManPaths(cmd *cmds.Command, path []string, paths *[][]string) {
+	names := make([]string, 0, len(cmd.Subcommands))
+	for name, sub := range cmd.Subcommands {
+		if !sub.Hidden {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		sub := cmd.Subcommands[name]
+		subPath := append(append([]string(nil), path...), name)
+		if sub.Run != nil {
+			*paths = append(*paths, subPath)
+		}
+		collectManPaths(sub, subPath, paths)
+	}
+}
+
+func manDescription(help *CommandHelp) string {
+	if help.LongDescription != "" {
+		return help.LongDescription
+	}
+	return help.ShortDescription
+}
+
+func writeManSynopsis(w io.Writer, synopsis string) {
+	fmt.Fprintf(w, ".nf\n%s\n.fi\n", roffBold(synopsis))
+}
+
+func writeManArguments(w io.Writer, args []ArgumentHelp) {
+	for _, arg := range args {
+		usage := argUsageText(cmdkit.Argument{Name: arg.Name, Required: arg.Required, Variadic: arg.Variadic})
+		fmt.Fprintf(w, ".TP\n%s\n", roffItalic(usage))
+		fmt.Fprintln(w, roffEscape(arg.Description))
+	}
+}
+
+func writeManOptions(w io.Writer, opts []OptionHelp) {
+	for _, opt := range opts {
+		flags := make([]string, len(opt.Names))
+		for i, name := range opt.Names {
+			flags[i] = roffBold(optionFlag(name))
+		}
+		fmt.Fprintf(w, ".TP\n%s %s\n", strings.Join(flags, ", "), roffItalic(opt.Type))
+
+		desc := opt.Description
+		if opt.Default != nil {
+			desc += fmt.Sprintf(" Default: %v.", opt.Default)
+		}
+		fmt.Fprintln(w, roffEscape(strings.TrimSpace(desc)))
+	}
+}
+
+// writeManText writes the help text text as paragraphs. Paragraphs with
+// indented lines, e.g. examples, are written as they are.
+func writeManText(w io.Writer, text string) {
+	for _, para := range strings.Split(dedent(text), "\n\n") {
+		para = strings.Trim(para, "\n")
+		if strings.TrimSpace(para) == "" {
+			continue
+		}
+
+		preformatted := false
+		for _, line := range strings.Split(para, "\n") {
+			if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+				preformatted = true
+				break
+			}
+		}
+
+		fmt.Fprintln(w, ".PP")
+		if preformatted {
+			fmt.Fprintln(w, ".nf")
+		}
+		for _, line := range strings.Split(para, "\n") {
+			fmt.Fprintln(w, roffEscape(line))
+		}
+		if preformatted {
+			fmt.Fprintln(w, ".fi")
+		}
+	}
+}
+
+// dedent removes the indentation all non-empty lines of text share.
+func dedent(text string) string {
+	lines := strings.Split(text, "\n")
+	common := -1
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		n := len(line) - len(strings.TrimLeft(line, " \t"))
+		if common < 0 || n < common {
+			common = n
+		}
+	}
+
+	for i, line := range lines {
+		if len(line) >= common && common > 0 {
+			lines[i] = line[common:]
+		} else if strings.TrimSpace(line) == "" {
+			lines[i] = ""
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// roffEscape escapes s for the text of a roff line.
+func roffEscape(s string) string {
+	s = strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(s)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		// not a request
+		s = `\&` + s
+	}
+	return s
+}
+
+// roffQuote escapes s for an argument of a roff request.
+func roffQuote(s string) string {
+	return `"` + strings.Replace(roffEscape(s), `"`, `\(dq`, -1) + `"`
+}
+
+func roffBold(s string) string {
+	return `\fB` + strings.TrimPrefix(roffEscape(s), `\&`) + `\fR`
+}
+
+func roffItalic(s string) string {
+	return `\fI` + strings.TrimPrefix(roffEscape(s), `\&`) + `\fR`
+}
@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	"github.com/ipfs/go-ipfs-cmds"
+)
+
+func TestManPage(t *testing.T) {
+	noop := func(*cmds.Request, cmds.ResponseEmitter, cmds.Environment) error { return nil }
+	root := &cmds.Command{
+		Helptext: cmdkit.HelpText{Tagline: "A test application."},
+		Options: []cmdkit.Option{
+			cmdkit.BoolOption("verbose", "v", "Write more."),
+		},
+		Subcommands: map[string]*cmds.Command{
+			"pin": {
+				Subcommands: map[string]*cmds.Command{
+					"add": {
+						Helptext: cmdkit.HelpText{
+							Tagline:          "Pin objects.",
+							ShortDescription: "Pins the objects.\n\n    app pin add <hash>\n",
+						},
+						Arguments: []cmdkit.Argument{cmdkit.StringArg("hash", true, true, "The objects to pin.")},
+						Run:       noop,
+					},
+				},
+			},
+			"hidden": {Hidden: true, Run: noop},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := ManPage("app", root, &buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, line := range []string{
+		`.TH "APP" 1`,
+		`app \- A test application.`,
+		`\fBapp [\-\-verbose | \-v] <command>\fR`,
+		`\fB\-v\fR, \fB\-\-verbose\fR \fIbool\fR`,
+		`.SS "app pin add"`,
+		"Pins the objects.",
+		".nf\n    app pin add <hash>\n.fi",
+		`\fI<hash>...\fR`,
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("expected the man page to contain %q:\n%s", line, out)
+		}
+	}
+	if strings.Contains(out, "hidden") {
+		t.Errorf("expected hidden commands to be left out:\n%s", out)
+	}
+}
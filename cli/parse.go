@@ -32,12 +32,22 @@ func init() {
 //
 // This function never returns nil, even on error.
 func Parse(ctx context.Context, input []string, stdin *os.File, root *cmds.Command) (*cmds.Request, error) {
+	return parseCmdline(ctx, input, stdin, os.Stderr, root)
+}
+
+// parseCmdline is Parse with prompts for missing values written to stderr.
+func parseCmdline(ctx context.Context, input []string, stdin *os.File, stderr io.Writer, root *cmds.Command) (*cmds.Request, error) {
 	req := &cmds.Request{Context: ctx}
 
 	if err := parse(req, input, root); err != nil {
 		return req, err
 	}
 
+	// profiles go below the explicit options but above the defaults
+	if err := applyProfile(req); err != nil {
+		return req, err
+	}
+
 	if err := req.FillDefaults(); err != nil {
 		return req, err
 	}
@@ -52,14 +62,26 @@ func Parse(ctx context.Context, input []string, stdin *os.File, root *cmds.Comma
 		}
 	}
 
-	if err := parseArgs(req, root, stdin); err != nil {
+	// ask for missing values if the user is at a terminal, unless they only
+	// want to see the help text
+	var p *prompter
+	long, _ := req.Options[cmds.OptLongHelp].(bool)
+	short, _ := req.Options[cmds.OptShortHelp].(bool)
+	if !long && !short {
+		p = newPrompter(stdin, stderr, Language(req))
+	}
+	if err := p.promptOptions(req); err != nil {
+		return req, err
+	}
+
+	if err := parseArgs(req, root, stdin, p); err != nil {
 		return req, err
 	}
 
 	// if no encoding was specified by user, default to plaintext encoding
 	// (if command doesn't support plaintext, use JSON instead)
 	if enc := req.Options[cmds.EncLong]; enc == "" {
-		if req.Command.Encoders != nil && req.Command.Encoders[cmds.Text] != nil {
+		if req.Command.Encoders[cmds.Text] != nil || req.Command.TypedEncoders.Has(cmds.Text) {
 			req.SetOption(cmds.EncLong, cmds.Text)
 		} else {
 			req.SetOption(cmds.EncLong, cmds.JSON)
@@ -82,6 +104,9 @@ func isRecursive(req *cmds.Request) bool {
 type parseState struct {
 	cmdline []string
 	i       int
+
+	// allowUnknown is set if unknown options should be passed through.
+	allowUnknown bool
 }
 
 func (st *parseState) done() bool {
@@ -92,6 +117,17 @@ func (st *parseState) peek() string {
 	return st.cmdline[st.i]
 }
 
+// nextIsValue checks whether the word after the current one could be the
+// value of an option.
+func (st *parseState) nextIsValue() bool {
+	if st.i+1 >= len(st.cmdline) {
+		return false
+	}
+
+	next := st.cmdline[st.i+1]
+	return next == "-" || !strings.HasPrefix(next, "-")
+}
+
 func parse(req *cmds.Request, cmdline []string, root *cmds.Command) (err error) {
 	var (
 		path = make([]string, 0, len(cmdline))
@@ -100,7 +136,16 @@ func parse(req *cmds.Request, cmdline []string, root *cmds.Command) (err error)
 		cmd  = root
 	)
 
-	st := &parseState{cmdline: cmdline}
+	st := &parseState{cmdline: cmdline, allowUnknown: root.AllowUnknownOptions}
+
+	// remember how far we got so usage errors can refer to the command
+	defer func() {
+		if err != nil {
+			req.Root = root
+			req.Command = cmd
+			req.Path = path
+		}
+	}()
 
 	// get root options
 	optDefs, err := root.GetOptions([]string{})
@@ -125,10 +170,12 @@ L:
 			}
 
 			if _, exists := opts[k]; exists {
-				return fmt.Errorf("multiple values for option %q", k)
+				return optionErrorf(k, "multiple values for option %q", k)
 			}
 
-			k = optDefs[k].Name()
+			if optDef, ok := optDefs[k]; ok {
+				k = optDef.Name()
+			}
 			opts[k] = v
 
 		case strings.HasPrefix(param, "-") && param != "-":
@@ -139,10 +186,12 @@ L:
 			}
 
 			for _, kv := range kvs {
-				kv.Key = optDefs[kv.Key].Names()[0]
+				if optDef, ok := optDefs[kv.Key]; ok {
+					kv.Key = optDef.Names()[0]
+				}
 
 				if _, exists := opts[kv.Key]; exists {
-					return fmt.Errorf("multiple values for option %q", kv.Key)
+					return optionErrorf(kv.Key, "multiple values for option %q", kv.Key)
 				}
 
 				opts[kv.Key] = kv.Value
@@ -154,6 +203,7 @@ L:
 			if sub != nil {
 				cmd = sub
 				path = append(path, arg)
+				st.allowUnknown = st.allowUnknown || sub.AllowUnknownOptions
 				optDefs, err = root.GetOptions(path)
 				if err != nil {
 					return err
@@ -186,7 +236,7 @@ L:
 	return nil
 }
 
-func parseArgs(req *cmds.Request, root *cmds.Command, stdin *os.File) error {
+func parseArgs(req *cmds.Request, root *cmds.Command, stdin *os.File, p *prompter) error {
 	argDefs := req.Command.Arguments
 
 	// count required argument definitions
@@ -299,7 +349,15 @@ func parseArgs(req *cmds.Request, root *cmds.Command, stdin *os.File) error {
 	if len(argDefs) > iArgDef {
 		for _, argDef := range argDefs[iArgDef:] {
 			if argDef.Required {
-				return fmt.Errorf("argument %q is required", argDef.Name)
+				v, ok, err := p.promptArgument(req.Command, argDef)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					return argumentErrorf(argDef.Name, "argument %q is required", argDef.Name)
+				}
+
+				stringArgs = append(stringArgs, v)
 			}
 		}
 	}
@@ -324,12 +382,15 @@ func splitkv(opt string) (k, v string, ok bool) {
 func parseOpt(opt, value string, opts map[string]cmdkit.Option) (interface{}, error) {
 	optDef, ok := opts[opt]
 	if !ok {
-		return nil, fmt.Errorf("unknown option %q", opt)
+		return nil, optionErrorf(opt, "unknown option %q", opt)
 	}
 
 	v, err := optDef.Parse(value)
+	if err == nil {
+		err = cmds.ValidateOptionValue(optDef, v)
+	}
 	if err != nil {
-		return nil, err
+		return nil, &UsageError{Option: opt, err: err}
 	}
 	return v, nil
 }
@@ -343,7 +404,10 @@ func (st *parseState) parseShortOpts(optDefs map[string]cmdkit.Option) ([]kv, er
 	k, vStr, ok := splitkv(st.cmdline[st.i][1:])
 	kvs := make([]kv, 0, len(k))
 
-	if ok {
+	if _, known := optDefs[k]; ok && !known && st.allowUnknown {
+		// pass through as a string, the server will convert it
+		kvs = append(kvs, kv{Key: k, Value: vStr})
+	} else if ok {
 		// split at = successful
 		v, err := parseOpt(k, vStr, optDefs)
 		if err != nil {
@@ -359,8 +423,21 @@ func (st *parseState) parseShortOpts(optDefs map[string]cmdkit.Option) ([]kv, er
 			od, ok := optDefs[flag]
 
 			switch {
+			case !ok && st.allowUnknown:
+				// we can't know whether it takes a value, so only accept it as
+				// a flag if it can't be followed by one
+				if j < len(k)-1 || st.nextIsValue() {
+					return nil, optionErrorf(flag, "unknown option %q is ambiguous, use -%s=<value>", flag, flag)
+				}
+
+				kvs = append(kvs, kv{
+					Key:   flag,
+					Value: true,
+				})
+				j++
+
 			case !ok:
-				return nil, fmt.Errorf("unknown option %q", k)
+				return nil, optionErrorf(flag, "unknown option %q", k)
 
 			case od.Type() == cmdkit.Bool:
 				// single char flags for bools
@@ -394,7 +471,7 @@ func (st *parseState) parseShortOpts(optDefs map[string]cmdkit.Option) ([]kv, er
 				break LOOP
 
 			default:
-				return nil, fmt.Errorf("missing argument for option %q", k)
+				return nil, optionErrorf(flag, "missing argument for option %q", k)
 			}
 		}
 	}
@@ -406,8 +483,16 @@ func (st *parseState) parseLongOpt(optDefs map[string]cmdkit.Option) (string, in
 	k, v, ok := splitkv(st.peek()[2:])
 	if !ok {
 		optDef, ok := optDefs[k]
+		if !ok && st.allowUnknown {
+			// we can't know whether it takes a value, so only accept it as a
+			// flag if it isn't followed by one
+			if st.nextIsValue() {
+				return "", nil, optionErrorf(k, "unknown option %q is ambiguous, use --%s=<value>", k, k)
+			}
+			return k, true, nil
+		}
 		if !ok {
-			return "", nil, fmt.Errorf("unknown option %q", k)
+			return "", nil, optionErrorf(k, "unknown option %q", k)
 		}
 		if optDef.Type() == cmdkit.Bool {
 			return k, true, nil
@@ -415,10 +500,15 @@ func (st *parseState) parseLongOpt(optDefs map[string]cmdkit.Option) (string, in
 			st.i++
 			v = st.peek()
 		} else {
-			return "", nil, fmt.Errorf("missing argument for option %q", k)
+			return "", nil, optionErrorf(k, "missing argument for option %q", k)
 		}
 	}
 
+	if _, known := optDefs[k]; !known && st.allowUnknown {
+		// pass through as a string, the server will convert it
+		return k, v, nil
+	}
+
 	optval, err := parseOpt(k, v, optDefs)
 	return k, optval, err
 }
@@ -476,10 +566,10 @@ func appendFile(fpath string, argDef *cmdkit.Argument, recursive, hidden bool) (
 
 	if stat.IsDir() {
 		if !argDef.Recursive {
-			return nil, fmt.Errorf(dirNotSupportedFmtStr, fpath, argDef.Name)
+			return nil, errorf(dirNotSupportedFmtStr, fpath, argDef.Name)
 		}
 		if !recursive {
-			return nil, fmt.Errorf(notRecursiveFmtStr, fpath, cmds.RecShort)
+			return nil, errorf(notRecursiveFmtStr, fpath, cmds.RecShort)
 		}
 	}
 
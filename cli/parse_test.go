@@ -9,6 +9,7 @@ import (
 	"runtime"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ipfs/go-ipfs-cmdkit"
 	"github.com/ipfs/go-ipfs-cmds"
@@ -76,6 +77,12 @@ func TestOptionParsing(t *testing.T) {
 		},
 		Subcommands: map[string]*cmds.Command{
 			"test": &cmds.Command{},
+			"typed": &cmds.Command{
+				Options: []cmdkit.Option{
+					cmds.DurationOption("timeout", "t", "a timeout"),
+					cmds.EnumOption([]string{"fast", "slow"}, "mode", "m", "a mode"),
+				},
+			},
 			"defaults": &cmds.Command{
 				Options: []cmdkit.Option{
 					cmdkit.StringOption("opt", "o", "an option").WithDefault("def"),
@@ -145,6 +152,9 @@ func TestOptionParsing(t *testing.T) {
 	testFail("foo test")
 	test("defaults", kvs{"opt": "def"}, words{})
 	test("defaults -o foo", kvs{"opt": "foo"}, words{})
+	test("typed -t 1s --mode fast", kvs{"timeout": time.Second, "mode": "fast"}, words{})
+	testFail("typed -t soon")
+	testFail("typed --mode=medium")
 
 	testFail("--bad-flag")
 	testFail("--bad-flag=")
@@ -153,6 +163,57 @@ func TestOptionParsing(t *testing.T) {
 	testFail("-zz--- --")
 }
 
+func TestUnknownOptionPassThrough(t *testing.T) {
+	cmd := &cmds.Command{
+		Options: []cmdkit.Option{
+			cmdkit.StringOption("string", "s", "a string"),
+			cmdkit.BoolOption("bool", "b", "a bool"),
+		},
+		Subcommands: map[string]*cmds.Command{
+			"strict": &cmds.Command{},
+			"loose": &cmds.Command{
+				AllowUnknownOptions: true,
+				Subcommands: map[string]*cmds.Command{
+					"sub": &cmds.Command{},
+				},
+			},
+		},
+	}
+
+	test := func(args string, expectedOpts kvs, expectedWords words, expectErr bool) {
+		req := &cmds.Request{}
+		err := parse(req, strings.Split(args, " "), cmd)
+		if expectErr {
+			if err == nil {
+				t.Errorf("Command line '%v' parsing should have failed", args)
+			}
+		} else if err != nil {
+			t.Errorf("Command line '%v' failed to parse: %v", args, err)
+		} else if !sameWords(req.Arguments, expectedWords) || !sameKVs(kvs(req.Options), expectedOpts) {
+			t.Errorf("Command line '%v':\n  parsed as  %v %v\n  instead of %v %v",
+				args, req.Options, req.Arguments, expectedOpts, expectedWords)
+		}
+	}
+
+	test("strict --new-flag", nil, nil, true)
+	test("loose --new-flag", kvs{"new-flag": true}, words{}, false)
+	test("loose --new-flag=xyz -b", kvs{"new-flag": "xyz", "bool": true}, words{}, false)
+	test("loose sub foo -z", kvs{"z": true}, words{"foo"}, false)
+	test("loose sub -z=1 -s foo", kvs{"z": "1", "string": "foo"}, words{}, false)
+	test("loose -bz", kvs{"z": true, "bool": true}, words{}, false)
+	test("loose -z -b", kvs{"z": true, "bool": true}, words{}, false)
+	test("loose --new-flag -- foo", kvs{"new-flag": true}, words{"foo"}, false)
+	// the value of unknown options must be passed with =
+	test("loose --new-flag value", nil, nil, true)
+	test("loose --new-flag -", nil, nil, true)
+	test("loose sub -z foo", nil, nil, true)
+	test("loose -zb", nil, nil, true)
+	test("loose --new-flag --new-flag", nil, nil, true)
+	test("loose --bool=xyz", nil, nil, true)
+	// options before the command are parsed strictly
+	test("--new-flag loose", nil, nil, true)
+}
+
 func TestArgumentParsing(t *testing.T) {
 	if runtime.GOOS == "windows" {
 		t.Skip("stdin handling doesn't yet work on windows")
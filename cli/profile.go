@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+// ProfileLoader returns the option values of the named profile.
+type ProfileLoader func(name string) (map[string]interface{}, error)
+
+// Profiles loads the profiles selected with the --profile option. It defaults
+// to reading the profiles from DefaultProfilesPath of the running binary.
+var Profiles ProfileLoader = func(name string) (map[string]interface{}, error) {
+	pth, err := DefaultProfilesPath(filepath.Base(os.Args[0]))
+	if err != nil {
+		return nil, err
+	}
+
+	return FileProfiles(pth)(name)
+}
+
+// DefaultProfilesPath returns the path of the profiles file of appName in the
+// user's configuration directory, e.g. ~/.config/ipfs/profiles.json.
+func DefaultProfilesPath(appName string) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, appName, "profiles.json"), nil
+}
+
+// FileProfiles returns a ProfileLoader that reads the profiles from the JSON
+// file at pth, which maps profile names to option values:
+//
+//	{
+//	  "staging": {"api": "/dns4/staging.example.com/tcp/5001", "timeout": "30s"}
+//	}
+func FileProfiles(pth string) ProfileLoader {
+	return func(name string) (map[string]interface{}, error) {
+		f, err := os.Open(pth)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, errorf("unknown profile %q", name)
+			}
+			return nil, err
+		}
+		defer f.Close()
+
+		var profiles map[string]map[string]interface{}
+		if err := json.NewDecoder(f).Decode(&profiles); err != nil {
+			return nil, fmt.Errorf("invalid profiles file %s: %s", pth, err)
+		}
+
+		profile, ok := profiles[name]
+		if !ok {
+			return nil, errorf("unknown profile %q", name)
+		}
+
+		return profile, nil
+	}
+}
+
+// applyProfile sets the options of the profile selected in req that weren't
+// set on the command line. Options that don't apply to the command are
+// ignored, so profiles can be shared between commands.
+func applyProfile(req *cmds.Request) error {
+	name, _ := req.Options[cmds.ProfileOpt].(string)
+	if name == "" || Profiles == nil {
+		return nil
+	}
+
+	profile, err := Profiles(name)
+	if err != nil {
+		return &UsageError{Option: cmds.ProfileOpt, err: err}
+	}
+
+	optDefs, err := req.Root.GetOptions(req.Path)
+	if err != nil {
+		return err
+	}
+
+OPTS:
+	for k, v := range profile {
+		optDef, ok := optDefs[k]
+		if !ok {
+			continue
+		}
+
+		// explicit flags take precedence
+		for _, name := range optDef.Names() {
+			if _, set := req.Options[name]; set {
+				continue OPTS
+			}
+		}
+
+		var str string
+		switch v := v.(type) {
+		case string:
+			str = v
+		case float64:
+			str = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			str = fmt.Sprint(v)
+		}
+
+		val, err := optDef.Parse(str)
+		if vo, ok := optDef.(cmds.ValidatedOption); ok && err == nil {
+			err = vo.Validate(val)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid value for option %q in profile %q: %s", k, name, err)
+		}
+
+		req.Options[optDef.Name()] = val
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package cli
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+func TestProfiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cmds-profiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pth := filepath.Join(dir, "profiles.json")
+	err = ioutil.WriteFile(pth, []byte(`{
+		"staging": {"api": "staging:5001", "count": 3, "verbose": true, "other": "ignored"}
+	}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(p ProfileLoader) { Profiles = p }(Profiles)
+	Profiles = FileProfiles(pth)
+
+	root := &cmds.Command{
+		Options: []cmdkit.Option{
+			cmds.OptionProfile,
+			cmdkit.StringOption("api", "The API address").WithDefault("localhost:5001"),
+			cmdkit.BoolOption("verbose", "v", "Verbose output"),
+		},
+		Subcommands: map[string]*cmds.Command{
+			"add": {
+				Options: []cmdkit.Option{
+					cmdkit.IntOption("count", "c", "A count").WithDefault(1),
+				},
+			},
+		},
+	}
+
+	type testcase struct {
+		cmdline []string
+		opts    kvs
+		fail    bool
+	}
+
+	tcs := []testcase{
+		{
+			cmdline: []string{"add"},
+			opts:    kvs{"api": "localhost:5001", "count": 1},
+		},
+		{
+			cmdline: []string{"--profile=staging", "add"},
+			opts:    kvs{"profile": "staging", "api": "staging:5001", "count": 3, "verbose": true},
+		},
+		{
+			cmdline: []string{"--profile=staging", "--api=prod:5001", "add", "-c", "5"},
+			opts:    kvs{"profile": "staging", "api": "prod:5001", "count": 5, "verbose": true},
+		},
+		{
+			cmdline: []string{"--profile=staging"},
+			opts:    kvs{"profile": "staging", "api": "staging:5001", "verbose": true},
+		},
+		{
+			cmdline: []string{"--profile=prod", "add"},
+			fail:    true,
+		},
+	}
+
+	for _, tc := range tcs {
+		req := &cmds.Request{Context: context.Background()}
+		err := parse(req, tc.cmdline, root)
+		if err == nil {
+			err = applyProfile(req)
+		}
+		if err == nil {
+			err = req.FillDefaults()
+		}
+
+		if tc.fail {
+			if err == nil {
+				t.Errorf("%v: expected an error", tc.cmdline)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error: %s", tc.cmdline, err)
+			continue
+		}
+
+		if !sameKVs(kvs(req.Options), tc.opts) {
+			t.Errorf("%v: expected options %v, got %v", tc.cmdline, tc.opts, req.Options)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+const (
+	// maxBarWidth is the width of the bar of a progress line on wide
+	// terminals.
+	maxBarWidth = 40
+	// minBarWidth is the width below which the bar is left out.
+	minBarWidth = 10
+
+	// clearLine moves the cursor to the start of the line and clears it.
+	clearLine = "\r\x1b[K"
+)
+
+// renderProgress returns the progress line of p for a terminal that is
+// width columns wide: a bar and the percentage if the total is known, the
+// current amount otherwise, followed by the message. The line is shorter
+// than width, so writing it doesn't wrap.
+func renderProgress(p *cmds.Progress, width int) string {
+	if p.Total == 0 {
+		line := strconv.FormatUint(p.Current, 10)
+		if p.Message != "" {
+			line += " " + p.Message
+		}
+		return truncate(line, width-1)
+	}
+
+	frac := float64(p.Current) / float64(p.Total)
+	if frac > 1 {
+		frac = 1
+	}
+	line := fmt.Sprintf("%3d%%", int(frac*100))
+	if p.Message != "" {
+		line += " " + p.Message
+	}
+
+	barWidth := width - 1 - len("[] ") - utf8.RuneCountInString(line)
+	if barWidth > maxBarWidth {
+		barWidth = maxBarWidth
+	}
+	if barWidth >= minBarWidth {
+		filled := int(frac * float64(barWidth))
+		line = "[" + strings.Repeat("=", filled) + strings.Repeat(" ", barWidth-filled) + "] " + line
+	}
+	return truncate(line, width-1)
+}
+
+// truncate cuts s after n runes.
+func truncate(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	for i := range s {
+		if n == 0 {
+			return s[:i]
+		}
+		n--
+	}
+	return s
+}
+
+// showProgress draws the progress line of p over the previous one. The
+// caller holds re.l.
+func (re *responseEmitter) showProgress(p *cmds.Progress) error {
+	if re.progressWidth == 0 {
+		// not a terminal, a progress line would garble the output
+		return nil
+	}
+
+	re.progressShown = true
+	_, err := io.WriteString(re.stderr, clearLine+renderProgress(p, re.progressWidth))
+	return err
+}
+
+// clearProgress removes the progress line, if any, before other output is
+// written. The caller holds re.l.
+func (re *responseEmitter) clearProgress() {
+	if !re.progressShown {
+		return
+	}
+
+	re.progressShown = false
+	io.WriteString(re.stderr, clearLine)
+}
@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+func TestRenderProgress(t *testing.T) {
+	tcs := []struct {
+		p     cmds.Progress
+		width int
+		line  string
+	}{
+		{cmds.Progress{Current: 5, Total: 10, Message: "adding"}, 30, "[=======        ]  50% adding"},
+		{cmds.Progress{Current: 20, Total: 10}, 80, "[" + strings.Repeat("=", maxBarWidth) + "] 100%"},
+		{cmds.Progress{Current: 1, Total: 4, Message: "a long message"}, 20, " 25% a long message"},
+		{cmds.Progress{Current: 42, Message: "blocks"}, 80, "42 blocks"},
+		{cmds.Progress{Current: 42, Message: "blocks"}, 6, "42 bl"},
+	}
+
+	for _, tc := range tcs {
+		if line := renderProgress(&tc.p, tc.width); line != tc.line {
+			t.Errorf("%+v at width %d: expected %q but got %q", tc.p, tc.width, tc.line, line)
+		}
+	}
+}
+
+func TestEmitProgress(t *testing.T) {
+	for _, width := range []int{0, 30} {
+		var stdout, stderr bytes.Buffer
+		req, err := cmds.NewRequest(context.Background(), nil, nil, nil, nil, &cmds.Command{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cmdsre, exitCh, err := NewResponseEmitter(&stdout, &stderr, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		re := cmdsre.(*responseEmitter)
+		// buffers aren't terminals
+		re.progressWidth = width
+
+		go func() {
+			cmds.EmitProgress(re, 1, 2, "")
+			re.Emit("value")
+			cmds.EmitProgress(re, 2, 2, "")
+			re.Close()
+		}()
+		<-exitCh
+
+		if stdout.String() != "value\n" {
+			t.Errorf("width %d: expected the value on stdout, got %q", width, stdout.String())
+		}
+
+		var exStderr string
+		if width > 0 {
+			exStderr = clearLine + renderProgress(&cmds.Progress{Current: 1, Total: 2}, width) + clearLine +
+				clearLine + renderProgress(&cmds.Progress{Current: 2, Total: 2}, width) + clearLine
+		}
+		if stderr.String() != exStderr {
+			t.Errorf("width %d: expected stderr %q but got %q", width, exStderr, stderr.String())
+		}
+	}
+}
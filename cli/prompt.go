@@ -0,0 +1,177 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// prompter asks the user for values that are missing from the command line.
+type prompter struct {
+	in  io.Reader
+	out io.Writer
+	// readSecret reads a line without echoing it.
+	readSecret func() (string, error)
+	// lang is the language the prompts are translated to.
+	lang string
+}
+
+// newPrompter returns a prompter reading from stdin and writing the prompts
+// to out, or nil if stdin is not a terminal.
+func newPrompter(stdin *os.File, out io.Writer, lang string) *prompter {
+	if stdin == nil {
+		return nil
+	}
+	if tty, err := isTty(stdin); err != nil || !tty {
+		return nil
+	}
+
+	return &prompter{
+		in:   stdin,
+		out:  out,
+		lang: lang,
+		readSecret: func() (string, error) {
+			b, err := terminal.ReadPassword(int(stdin.Fd()))
+			return string(b), err
+		},
+	}
+}
+
+// ask prints msg and reads a line of input. If the input ends before a line
+// was entered, an empty value is returned.
+func (p *prompter) ask(msg string, secret bool) (string, error) {
+	fmt.Fprintf(p.out, "%s: ", strings.TrimSuffix(Translate(p.lang, msg), "."))
+
+	if secret {
+		line, err := p.readSecret()
+		// the newline typed by the user wasn't echoed
+		fmt.Fprintln(p.out)
+		if err == io.EOF {
+			err = nil
+		}
+		return strings.TrimRight(line, "\r\n"), err
+	}
+
+	// read byte by byte so we don't consume input meant for the command
+	var (
+		line []byte
+		b    = make([]byte, 1)
+	)
+	for {
+		n, err := p.in.Read(b)
+		if n > 0 {
+			if b[0] == '\n' {
+				break
+			}
+			line = append(line, b[0])
+		}
+		if err == io.EOF {
+			if len(line) == 0 {
+				// the user typed Ctrl-D, treat as no value
+				fmt.Fprintln(p.out)
+			}
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return strings.TrimRight(string(line), "\r"), nil
+}
+
+func findPrompt(cmd *cmds.Command, name string) (cmds.Prompt, bool) {
+	for _, p := range cmd.Prompts {
+		if p.Name == name {
+			return p, true
+		}
+	}
+
+	return cmds.Prompt{}, false
+}
+
+// promptArgument asks for the value of argDef if the command allows it.
+// It returns false if the user wasn't asked or didn't enter a value.
+func (p *prompter) promptArgument(cmd *cmds.Command, argDef cmdkit.Argument) (string, bool, error) {
+	if p == nil || argDef.Type != cmdkit.ArgString {
+		return "", false, nil
+	}
+
+	pr, ok := findPrompt(cmd, argDef.Name)
+	if !ok {
+		return "", false, nil
+	}
+
+	msg := pr.Message
+	if msg == "" {
+		msg = argDef.Description
+	}
+	if msg == "" {
+		msg = argDef.Name
+	}
+
+	v, err := p.ask(msg, pr.Secret)
+	if err != nil {
+		return "", false, err
+	}
+
+	return v, v != "", nil
+}
+
+// promptOptions asks for the options of the command in req that have a
+// prompt but weren't set on the command line.
+func (p *prompter) promptOptions(req *cmds.Request) error {
+	if p == nil || len(req.Command.Prompts) == 0 {
+		return nil
+	}
+
+	optDefs, err := req.Root.GetOptions(req.Path)
+	if err != nil {
+		return err
+	}
+
+	for _, pr := range req.Command.Prompts {
+		optDef, ok := optDefs[pr.Name]
+		if !ok {
+			// an argument
+			continue
+		}
+		if _, set := req.Options[optDef.Name()]; set {
+			continue
+		}
+
+		msg := pr.Message
+		if msg == "" {
+			msg = optDef.Description()
+		}
+		if msg == "" {
+			msg = optDef.Name()
+		}
+
+		str, err := p.ask(msg, pr.Secret)
+		if err != nil {
+			return err
+		}
+		if str == "" {
+			continue
+		}
+
+		v, err := optDef.Parse(str)
+		if err == nil {
+			err = cmds.ValidateOptionValue(optDef, v)
+		}
+		if err != nil {
+			return &UsageError{Option: optDef.Name(), err: err}
+		}
+
+		req.SetOption(optDef.Name(), v)
+	}
+
+	return nil
+}
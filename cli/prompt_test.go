@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+func TestPrompt(t *testing.T) {
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"login": {
+				Arguments: []cmdkit.Argument{
+					cmdkit.StringArg("user", true, false, "The user name"),
+				},
+				Options: []cmdkit.Option{
+					cmdkit.StringOption("password", "p", "The password"),
+					cmdkit.IntOption("port", "The port"),
+				},
+				Prompts: []cmds.Prompt{
+					{Name: "user"},
+					{Name: "password", Secret: true},
+					{Name: "port", Message: "Port to connect to"},
+				},
+			},
+		},
+	}
+
+	var out bytes.Buffer
+	p := &prompter{
+		in:  strings.NewReader("1234\nalice\nrest"),
+		out: &out,
+		readSecret: func() (string, error) {
+			return "hunter2", nil
+		},
+	}
+
+	req, err := Parse(context.Background(), []string{"login"}, nil, root)
+	if err == nil {
+		t.Fatal("expected an error without a terminal")
+	}
+	if uerr, ok := err.(*UsageError); !ok || uerr.Argument != "user" {
+		t.Fatalf("expected usage error for argument, got %v", err)
+	}
+
+	req.Options = cmdkit.OptMap{}
+	req.Arguments = nil
+	if err := p.promptOptions(req); err != nil {
+		t.Fatal(err)
+	}
+	if err := parseArgs(req, root, nil, p); err != nil {
+		t.Fatal(err)
+	}
+
+	if req.Options["password"] != "hunter2" {
+		t.Errorf("expected password to be set, got %v", req.Options["password"])
+	}
+	if req.Options["port"] != 1234 {
+		t.Errorf("expected port 1234, got %v", req.Options["port"])
+	}
+	if len(req.Arguments) != 1 || req.Arguments[0] != "alice" {
+		t.Errorf("expected argument alice, got %v", req.Arguments)
+	}
+
+	for _, msg := range []string{"The password: \n", "Port to connect to: ", "The user name: "} {
+		if !strings.Contains(out.String(), msg) {
+			t.Errorf("expected prompt %q, got %q", msg, out.String())
+		}
+	}
+
+	rest, _ := ioutil.ReadAll(p.in)
+	if string(rest) != "rest" {
+		t.Errorf("prompt consumed too much input, left %q", rest)
+	}
+}
+
+func TestPromptEOF(t *testing.T) {
+	RegisterCatalog("xx", Catalog{
+		"The user name": "Der Benutzername",
+	})
+
+	cmd := &cmds.Command{
+		Arguments: []cmdkit.Argument{
+			cmdkit.StringArg("user", true, false, "The user name"),
+		},
+		Prompts: []cmds.Prompt{{Name: "user"}},
+	}
+
+	var out bytes.Buffer
+	p := &prompter{in: strings.NewReader(""), out: &out, lang: "xx"}
+
+	req := &cmds.Request{Root: cmd, Command: cmd, Options: cmdkit.OptMap{}}
+	err := parseArgs(req, cmd, nil, p)
+	if uerr, ok := err.(*UsageError); !ok || uerr.Argument != "user" {
+		t.Fatalf("expected usage error for argument, got %v", err)
+	}
+
+	if !strings.HasPrefix(out.String(), "Der Benutzername: ") {
+		t.Errorf("expected translated prompt, got %q", out.String())
+	}
+}
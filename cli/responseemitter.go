@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"os"
@@ -27,7 +28,11 @@ func NewResponseEmitter(stdout, stderr io.Writer, req *cmds.Request) (cmds.Respo
 		stderr:  stderr,
 		encType: encType,
 		enc:     enc,
+		req:     req,
 		ch:      ch,
+		stats:   cmds.StatsFromContext(req.Context),
+
+		progressWidth: OutputWidth(nil, stderr),
 	}, ch, err
 }
 
@@ -48,9 +53,19 @@ type responseEmitter struct {
 	length  uint64
 	enc     cmds.Encoder
 	encType cmds.EncodingType
+	req     *cmds.Request
 	exit    int
 	closed  bool
 
+	// stats is updated if set
+	stats *cmds.Stats
+
+	// progressWidth is the width of the terminal progress is drawn on, 0
+	// if stderr isn't a terminal and progress isn't shown.
+	progressWidth int
+	// progressShown is whether a progress line is on the screen.
+	progressShown bool
+
 	ch chan<- int
 }
 
@@ -67,9 +82,14 @@ func (re *responseEmitter) CloseWithError(err error) error {
 		return re.Close()
 	}
 
+	code := exitCode(err)
+
 	if e, ok := err.(cmdkit.Error); ok {
 		err = &e
 	}
+	if e, ok := err.(*cmds.CodedError); ok {
+		err = &cmdkit.Error{Message: localize(Language(re.req), e), Code: e.Type}
+	}
 
 	e, ok := err.(*cmdkit.Error)
 	if !ok {
@@ -85,16 +105,41 @@ func (re *responseEmitter) CloseWithError(err error) error {
 		return cmds.ErrClosingClosedEmitter
 	}
 
-	re.exit = 1 // TODO we could let err carry an exit code
+	re.exit = code
 
-	_, err = fmt.Fprintln(re.stderr, "Error:", e.Message)
-	if err != nil {
+	re.clearProgress()
+	if err := re.writeError(e); err != nil {
 		return err
 	}
 
 	return re.close()
 }
 
+// writeError writes e to stderr in the error envelope of the output
+// encoding. Errors of text output and of encodings without an envelope are
+// written as "Error: <message>".
+func (re *responseEmitter) writeError(e *cmdkit.Error) error {
+	_, hasEnvelope := cmds.ErrorEnvelopes[re.encType]
+	if !hasEnvelope || re.encType == cmds.Text || re.encType == cmds.TextNewline {
+		_, data, err := cmds.MarshalError(cmds.Text, e)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(re.stderr, "Error: %s\n", data)
+		return err
+	}
+
+	_, data, err := cmds.MarshalError(re.encType, e)
+	if err != nil {
+		return err
+	}
+	if !bytes.HasSuffix(data, []byte("\n")) {
+		data = append(data, '\n')
+	}
+	_, err = re.stderr.Write(data)
+	return err
+}
+
 func (re *responseEmitter) isClosed() bool {
 	re.l.Lock()
 	defer re.l.Unlock()
@@ -114,6 +159,14 @@ func (re *responseEmitter) close() error {
 		return cmds.ErrClosingClosedEmitter
 	}
 
+	re.clearProgress()
+
+	if re.enc != nil {
+		if err := cmds.CloseEncoder(re.enc); err != nil {
+			log.Error("error finishing encoded output: ", err)
+		}
+	}
+
 	re.ch <- re.exit
 	close(re.ch)
 
@@ -176,20 +229,21 @@ func (re *responseEmitter) Emit(v interface{}) error {
 		return cmds.EmitChan(re, ch)
 	}
 
-	// TODO find a better solution for this.
-	// Idea: use the actual cmd.Type and not *cmd.Type
-	// would need to fix all commands though
-	switch c := v.(type) {
-	case *string:
-		v = *c
-	case *int:
-		v = *c
-	}
+	v = cmds.Unwrap(v)
+	defer cmds.CloseReader(v)
 
 	if re.isClosed() {
 		return cmds.ErrClosedEmitter
 	}
 
+	re.l.Lock()
+	if p, ok := v.(*cmds.Progress); ok {
+		defer re.l.Unlock()
+		return re.showProgress(p)
+	}
+	re.clearProgress()
+	re.l.Unlock()
+
 	var err error
 
 	switch t := v.(type) {
@@ -200,12 +254,19 @@ func (re *responseEmitter) Emit(v interface{}) error {
 		}
 	default:
 		if re.enc != nil {
-			err = re.enc.Encode(v)
+			var streamed bool
+			if streamed, err = cmds.StreamValue(re.req, re.stdout, re.enc, re.encType, v); !streamed {
+				err = re.enc.Encode(v)
+			}
 		} else {
 			_, err = fmt.Fprintln(re.stdout, t)
 		}
 	}
 
+	if err == nil {
+		re.stats.AddEmitted(1)
+	}
+
 	if isSingle {
 		return re.CloseWithError(err)
 	}
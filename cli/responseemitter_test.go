@@ -2,9 +2,12 @@ package cli
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"strings"
 	"testing"
 
+	"github.com/ipfs/go-ipfs-cmdkit"
 	"github.com/ipfs/go-ipfs-cmds"
 )
 
@@ -82,6 +85,26 @@ func TestCloseWithError(t *testing.T) {
 				}
 			},
 		},
+		tcCloseWithError{
+			stdout:   bytes.NewBuffer(nil),
+			stderr:   bytes.NewBuffer(nil),
+			exStdout: "",
+			exStderr: "Error: not found\n",
+			exExit:   4,
+			f: func(re ResponseEmitter, t *testing.T) {
+				re.CloseWithError(WithExitCode(fmt.Errorf("not found"), 4))
+			},
+		},
+		tcCloseWithError{
+			stdout:   bytes.NewBuffer(nil),
+			stderr:   bytes.NewBuffer(nil),
+			exStdout: "",
+			exStderr: "Error: bad path\n",
+			exExit:   ExitUsage,
+			f: func(re ResponseEmitter, t *testing.T) {
+				re.CloseWithError(cmdkit.Error{Message: "bad path", Code: cmdkit.ErrClient})
+			},
+		},
 	}
 
 	for i, tc := range tcs {
@@ -89,3 +112,73 @@ func TestCloseWithError(t *testing.T) {
 		tc.Run(t)
 	}
 }
+
+type trackedReader struct {
+	*strings.Reader
+	closed bool
+}
+
+func (r *trackedReader) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestEmitReadCloser(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	re, exitCh, err := NewResponseEmitter(&stdout, &stderr, &cmds.Request{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &trackedReader{Reader: strings.NewReader("data")}
+	if err := re.Emit(r); err != nil {
+		t.Fatal(err)
+	}
+	if !r.closed {
+		t.Error("expected the reader to be closed after copying it")
+	}
+
+	go re.Close()
+	<-exitCh
+
+	r = &trackedReader{Reader: strings.NewReader("late")}
+	if err := re.Emit(r); err != cmds.ErrClosedEmitter {
+		t.Fatalf("expected %v but got %v", cmds.ErrClosedEmitter, err)
+	}
+	if !r.closed {
+		t.Error("expected the reader emitted after close to be closed")
+	}
+
+	if stdout.String() != "data" {
+		t.Errorf("unexpected output %q", stdout.String())
+	}
+}
+
+func TestCloseWithErrorEnvelope(t *testing.T) {
+	for _, tc := range []struct {
+		enc      cmds.EncodingType
+		expected string
+	}{
+		{enc: cmds.TextNewline, expected: "Error: not found\n"},
+		{enc: cmds.JSON, expected: `{"Message":"not found","Code":3,"Type":"error"}` + "\n"},
+		{enc: cmds.XML, expected: "<Error><Message>not found</Message><Code>3</Code></Error>\n"},
+		{enc: cmds.HTML, expected: "Error: not found\n"},
+	} {
+		req, err := cmds.NewRequest(context.Background(), nil, cmdkit.OptMap{cmds.EncLong: tc.enc}, nil, nil, &cmds.Command{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var stdout, stderr bytes.Buffer
+		re, exitCh, err := NewResponseEmitter(&stdout, &stderr, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		go re.CloseWithError(cmdkit.Error{Message: "not found", Code: cmdkit.ErrNotFound})
+		<-exitCh
+
+		if stderr.String() != tc.expected {
+			t.Errorf("%s: expected %q but got %q", tc.enc, tc.expected, stderr.String())
+		}
+	}
+}
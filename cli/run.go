@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
 	"strings"
 	"time"
 
@@ -12,27 +13,38 @@ import (
 	cmds "github.com/ipfs/go-ipfs-cmds"
 )
 
-// ExitError is the error used when a specific exit code needs to be returned.
-type ExitError int
+// Closer is a helper interface to check if the env supports closing
+type Closer = cmds.EnvironmentCloser
 
-func (e ExitError) Error() string {
-	return fmt.Sprintf("exit code %d", int(e))
-}
+// Run parses cmdline, runs the command with the executor made by
+// makeExecutor and prints the result. If ctx holds a cmds.Tracer, the
+// command line is traced in a cmds.CLISpan.
+func Run(ctx context.Context, root *cmds.Command,
+	cmdline []string, stdin, stdout, stderr *os.File,
+	buildEnv cmds.MakeEnvironment, makeExecutor cmds.MakeExecutor) error {
 
-// Closer is a helper interface to check if the env supports closing
-type Closer interface {
-	Close()
+	ctx, span := cmds.StartSpan(ctx, cmds.CLISpan)
+	err := run(ctx, span, root, cmdline, stdin, stdout, stderr, buildEnv, makeExecutor)
+	span.End(err)
+	return err
 }
 
-func Run(ctx context.Context, root *cmds.Command,
+func run(ctx context.Context, span cmds.Span, root *cmds.Command,
 	cmdline []string, stdin, stdout, stderr *os.File,
 	buildEnv cmds.MakeEnvironment, makeExecutor cmds.MakeExecutor) error {
 
-	printErr := func(err error) {
-		fmt.Fprintf(stderr, "Error: %s\n", err)
+	_, parseSpan := cmds.StartSpan(ctx, cmds.ParseSpan)
+	req, errParse := parseCmdline(ctx, cmdline[1:], stdin, stderr, root)
+	if req != nil {
+		parseSpan.SetPath(req.Path)
+		span.SetPath(req.Path)
 	}
+	parseSpan.End(errParse)
 
-	req, errParse := Parse(ctx, cmdline[1:], stdin, root)
+	printErr := func(err error) {
+		lang := Language(req)
+		fmt.Fprintf(stderr, Translate(lang, "Error: %s")+"\n", localize(lang, err))
+	}
 
 	// Handle the timeout up front.
 	var cancel func()
@@ -40,7 +52,7 @@ func Run(ctx context.Context, root *cmds.Command,
 		timeout, err := time.ParseDuration(timeoutStr.(string))
 		if err != nil {
 			printErr(err)
-			return err
+			return ExitError(ExitUsage)
 		}
 		req.Context, cancel = context.WithTimeout(req.Context, timeout)
 	} else {
@@ -48,16 +60,40 @@ func Run(ctx context.Context, root *cmds.Command,
 	}
 	defer cancel()
 
+	// cancel the command on SIGINT, a second one kills the process
+	interrupted := make(chan struct{})
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt)
+	defer signal.Stop(sigCh)
+	go func(ctx context.Context) {
+		select {
+		case <-sigCh:
+			signal.Stop(sigCh)
+			close(interrupted)
+			cancel()
+		case <-ctx.Done():
+		}
+	}(req.Context)
+
+	isInterrupted := func() bool {
+		select {
+		case <-interrupted:
+			return true
+		default:
+			return false
+		}
+	}
+
 	// this is a message to tell the user how to get the help text
 	printMetaHelp := func(w io.Writer) {
 		cmdPath := strings.Join(req.Path, " ")
-		fmt.Fprintf(w, "Use '%s %s --help' for information about this command\n", cmdline[0], cmdPath)
+		fmt.Fprintf(w, Translate(Language(req), "Use '%s %s --help' for information about this command")+"\n", cmdline[0], cmdPath)
 	}
 
 	printHelp := func(long bool, w io.Writer) {
-		helpFunc := ShortHelp
+		helpFunc := shortHelp
 		if long {
-			helpFunc = LongHelp
+			helpFunc = longHelp
 		}
 
 		var path []string
@@ -65,7 +101,7 @@ func Run(ctx context.Context, root *cmds.Command,
 			path = req.Path
 		}
 
-		if err := helpFunc(cmdline[0], root, path, w); err != nil {
+		if err := helpFunc(cmdline[0], root, path, w, OutputWidth(req, w), Language(req)); err != nil {
 			// This should not happen
 			panic(err)
 		}
@@ -86,13 +122,20 @@ func Run(ctx context.Context, root *cmds.Command,
 	if errParse != nil {
 		printErr(errParse)
 
-		// this was a user error, print help
+		// this was a user error, print the relevant part of the help
+		if _, ok := errParse.(*UsageError); ok {
+			writeUsage(stderr, cmdline[0], req, errParse, OutputWidth(req, stderr), Language(req))
+			fmt.Fprintln(stderr) // i need some space
+			printMetaHelp(stderr)
+			return ExitError(ExitUsage)
+		}
+
 		if req != nil && req.Command != nil {
 			fmt.Fprintln(stderr) // i need some space
 			printHelp(false, stderr)
 		}
 
-		return err
+		return ExitError(ExitUsage)
 	}
 
 	// here we handle the cases where
@@ -110,9 +153,7 @@ func Run(ctx context.Context, root *cmds.Command,
 		printErr(err)
 		return err
 	}
-	if c, ok := env.(Closer); ok {
-		defer c.Close()
-	}
+	defer cmds.CloseEnvironment(env)
 
 	exctr, err := makeExecutor(req, env)
 	if err != nil {
@@ -128,11 +169,41 @@ func Run(ctx context.Context, root *cmds.Command,
 	encTypeStr, _ := req.Options[cmds.EncLong].(string)
 	encType := cmds.EncodingType(encTypeStr)
 
-	// use JSON if text was requested but the command doesn't have a text-encoder
-	if _, ok := cmd.Encoders[encType]; encType == cmds.Text && !ok {
+	// use JSON if text was requested but the command doesn't have a
+	// text-encoder, a TextFormat or a --format template
+	format, _ := req.Options[cmds.FormatOpt].(string)
+	if _, ok := cmd.Encoders[encType]; encType == cmds.Text && !ok && !cmd.TypedEncoders.Has(encType) && cmd.TextFormat == nil && format == "" {
 		req.Options[cmds.EncLong] = cmds.JSON
 	}
 
+	// fit tables of the text format into the terminal
+	if _, ok := req.Options[cmds.WidthOpt]; !ok && encType == cmds.Text {
+		if width := OutputWidth(req, stdout); width > 0 {
+			req.Options[cmds.WidthOpt] = width
+		}
+	}
+
+	if printStats, _ := req.Options[cmds.StatsOpt].(bool); printStats {
+		var stats *cmds.Stats
+		req.Context, stats = cmds.ContextWithStats(req.Context)
+
+		start := time.Now()
+		defer func() {
+			writeStats(stderr, stats, time.Since(start))
+		}()
+	}
+
+	if cmd.Paginated {
+		var page *cmds.PageResult
+		req.Context, page = cmds.ContextWithPageResult(req.Context)
+
+		defer func() {
+			if cursor := page.NextCursor(); cursor != "" {
+				fmt.Fprintf(stderr, "more values available, continue with --%s=%s\n", cmds.CursorOpt, cursor)
+			}
+		}()
+	}
+
 	// first if condition checks the command's encoder map, second checks global encoder map (cmd vs. cmds)
 	re, exitCh, err = NewResponseEmitter(stdout, stderr, req)
 	if err != nil {
@@ -150,6 +221,10 @@ func Run(ctx context.Context, root *cmds.Command,
 
 	select {
 	case err := <-errCh:
+		if isInterrupted() {
+			return ExitError(ExitInterrupted)
+		}
+
 		printErr(err)
 
 		if kiterr, ok := err.(*cmdkit.Error); ok {
@@ -159,10 +234,16 @@ func Run(ctx context.Context, root *cmds.Command,
 			printMetaHelp(stderr)
 		}
 
+		if code := exitCode(err); code != ExitFailure {
+			return ExitError(code)
+		}
 		return err
 
 	case code := <-exitCh:
-		if code != 0 {
+		if code != ExitSuccess && isInterrupted() {
+			return ExitError(ExitInterrupted)
+		}
+		if code != ExitSuccess {
 			return ExitError(code)
 		}
 	}
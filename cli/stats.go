@@ -0,0 +1,24 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+// writeStats writes the statistics printed for --stats to w. Transferred
+// bytes are only reported if the command was executed remotely.
+func writeStats(w io.Writer, stats *cmds.Stats, elapsed time.Duration) {
+	fmt.Fprintf(w, "\nwall time:      %s\n", elapsed)
+	fmt.Fprintf(w, "values emitted: %d\n", stats.Emitted())
+
+	if sent, received := stats.BytesSent(), stats.BytesReceived(); sent > 0 || received > 0 {
+		fmt.Fprintf(w, "bytes sent:     %d\n", sent)
+		fmt.Fprintf(w, "bytes received: %d\n", received)
+	}
+	if decompressed := stats.BytesDecompressed(); decompressed > 0 {
+		fmt.Fprintf(w, "decompressed:   %d\n", decompressed)
+	}
+}
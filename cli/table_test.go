@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+func TestRunTextFormat(t *testing.T) {
+	type entry struct {
+		Name string
+		Size int
+	}
+
+	root := &cmds.Command{
+		Options: []cmdkit.Option{cmds.OptionEncodingType, cmds.OptionFormat, cmds.OptionNoHeader},
+		Subcommands: map[string]*cmds.Command{
+			"ls": {
+				TextFormat: &cmds.TextFormat{
+					Columns: []cmds.Column{{Header: "NAME", Field: "Name"}, {Header: "SIZE", Field: "Size", Align: cmds.AlignRight}},
+				},
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					if err := re.Emit(&entry{"a", 1}); err != nil {
+						return err
+					}
+					return re.Emit(&entry{"bb", 100})
+				},
+				Type: entry{},
+			},
+		},
+	}
+
+	buildEnv := func(ctx context.Context, req *cmds.Request) (cmds.Environment, error) {
+		return nil, nil
+	}
+	makeExecutor := func(req *cmds.Request, env interface{}) (cmds.Executor, error) {
+		return cmds.NewExecutor(root), nil
+	}
+
+	for _, tc := range []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"ls"}, "NAME  SIZE\na        1\nbb     100\n"},
+		{[]string{"ls", "--no-header"}, "a     1\nbb  100\n"},
+		{[]string{"ls", "--format={{.Name}}"}, "a\nbb\n"},
+	} {
+		out, err := ioutil.TempFile("", "cli-table")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(out.Name())
+		defer out.Close()
+
+		err = Run(context.Background(), root, append([]string{"test"}, tc.args...), nil, out, out, buildEnv, makeExecutor)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := ioutil.ReadFile(out.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != tc.expected {
+			t.Errorf("%v: expected %q, got %q", tc.args, tc.expected, b)
+		}
+	}
+}
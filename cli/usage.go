@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+// UsageError is the error returned by Parse if the command line doesn't match
+// the options and arguments of the command.
+type UsageError struct {
+	// Option is the name of the offending option, if any.
+	Option string
+	// Argument is the name of the offending argument, if any.
+	Argument string
+
+	err error
+}
+
+func (e *UsageError) Error() string {
+	return e.err.Error()
+}
+
+// Translate returns the message translated to lang.
+func (e *UsageError) Translate(lang string) string {
+	return localize(lang, e.err)
+}
+
+func optionErrorf(opt, format string, args ...interface{}) error {
+	return &UsageError{Option: opt, err: errorf(format, args...)}
+}
+
+func argumentErrorf(arg, format string, args ...interface{}) error {
+	return &UsageError{Argument: arg, err: errorf(format, args...)}
+}
+
+// writeUsage writes the part of the help text of the command addressed by req
+// that is relevant to err: the usage line and the offending option or
+// argument, or the options with similar names if the option is unknown. The
+// text is wrapped at width, see WrapText.
+func writeUsage(w io.Writer, rootName string, req *cmds.Request, err error, width int, lang string) {
+	var buf bytes.Buffer
+	writeUsageSections(&buf, rootName, req, err, lang)
+	io.WriteString(w, WrapText(buf.String(), width))
+}
+
+func writeUsageSections(w io.Writer, rootName string, req *cmds.Request, err error, lang string) {
+	uerr, ok := err.(*UsageError)
+	if !ok || req == nil || req.Root == nil || req.Command == nil {
+		return
+	}
+	cmd := req.Command
+
+	pathStr := strings.Join(append([]string{rootName}, req.Path...), " ")
+	fmt.Fprintf(w, "\n%s\n%s%s\n", Translate(lang, "USAGE"), indentStr, generateSynopsis(cmd, pathStr))
+
+	var lines []string
+	switch {
+	case uerr.Option != "":
+		optDefs, err := req.Root.GetOptions(req.Path)
+		if err != nil {
+			return
+		}
+
+		if opt, ok := optDefs[uerr.Option]; ok {
+			lines = optionText(lang, &cmds.Command{Options: []cmdkit.Option{opt}})
+			break
+		}
+
+		suggestions := suggestOptions(uerr.Option, optDefs)
+		for i, name := range suggestions {
+			suggestions[i] = optionFlag(name)
+		}
+		switch len(suggestions) {
+		case 0:
+		case 1:
+			fmt.Fprintf(w, "\n%s\n", Translate(lang, "Did you mean this?"))
+			lines = suggestions
+		default:
+			fmt.Fprintf(w, "\n%s\n", Translate(lang, "Did you mean any of these?"))
+			lines = suggestions
+		}
+
+	case uerr.Argument != "":
+		for _, arg := range cmd.Arguments {
+			if arg.Name == uerr.Argument {
+				lines = argumentText(lang, &cmds.Command{Arguments: []cmdkit.Argument{arg}})
+				break
+			}
+		}
+	}
+
+	if len(lines) > 0 {
+		fmt.Fprintln(w)
+		for _, line := range lines {
+			fmt.Fprintf(w, "%s%s\n", indentStr, line)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+func TestUsageErrors(t *testing.T) {
+	root := &cmds.Command{
+		Options: []cmdkit.Option{
+			cmdkit.StringOption("format", "f", "The output format."),
+		},
+		Subcommands: map[string]*cmds.Command{
+			"add": {
+				Arguments: []cmdkit.Argument{
+					cmdkit.StringArg("path", true, false, "The path to add."),
+				},
+				Options: []cmdkit.Option{
+					cmdkit.IntOption("count", "c", "How often to add the path."),
+				},
+			},
+		},
+	}
+
+	type testcase struct {
+		cmdline  []string
+		option   string
+		argument string
+		contains []string
+		excludes []string
+	}
+
+	tcs := []testcase{
+		{
+			cmdline:  []string{"add", "--fromat=json", "foo"},
+			option:   "fromat",
+			contains: []string{"test add [--count=<count> | -c] [--] <path>", "Did you mean this?", "  --format"},
+		},
+		{
+			cmdline:  []string{"add", "foo", "--count"},
+			option:   "count",
+			contains: []string{"-c, --count int - How often to add the path."},
+			excludes: []string{"--format"},
+		},
+		{
+			cmdline:  []string{"add", "--count=many", "foo"},
+			option:   "count",
+			contains: []string{"How often to add the path."},
+		},
+		{
+			cmdline:  []string{"add"},
+			argument: "path",
+			contains: []string{"<path> - The path to add."},
+			excludes: []string{"How often"},
+		},
+		{
+			cmdline:  []string{"ad"},
+			contains: []string{"USAGE"},
+			excludes: []string{"path"},
+		},
+	}
+
+	for _, tc := range tcs {
+		req, err := Parse(context.Background(), tc.cmdline, nil, root)
+		uerr, ok := err.(*UsageError)
+		if !ok {
+			t.Errorf("%v: expected a usage error, got %v", tc.cmdline, err)
+			continue
+		}
+
+		if uerr.Option != tc.option || uerr.Argument != tc.argument {
+			t.Errorf("%v: expected option %q and argument %q, got %q and %q",
+				tc.cmdline, tc.option, tc.argument, uerr.Option, uerr.Argument)
+		}
+
+		var buf bytes.Buffer
+		writeUsage(&buf, "test", req, err, 0, "")
+		out := buf.String()
+
+		for _, s := range tc.contains {
+			if !strings.Contains(out, s) {
+				t.Errorf("%v: expected usage to contain %q, got:\n%s", tc.cmdline, s, out)
+			}
+		}
+		for _, s := range tc.excludes {
+			if strings.Contains(out, s) {
+				t.Errorf("%v: expected usage not to contain %q, got:\n%s", tc.cmdline, s, out)
+			}
+		}
+	}
+}
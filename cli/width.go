@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// OutputWidth returns the number of columns help text and tables written to
+// w should be fit into. The --width option in req takes precedence.
+// Otherwise, if w is a terminal, its width is used or, if that can't be
+// determined, the COLUMNS environment variable. It returns 0 if the text
+// should not be wrapped. req may be nil.
+func OutputWidth(req *cmds.Request, w io.Writer) int {
+	if req != nil {
+		switch width := req.Options[cmds.WidthOpt].(type) {
+		case int:
+			return width
+		case uint:
+			return int(width)
+		}
+	}
+
+	f, ok := w.(*os.File)
+	if !ok {
+		return 0
+	}
+
+	fd := int(f.Fd())
+	if !terminal.IsTerminal(fd) {
+		return 0
+	}
+
+	if width, _, err := terminal.GetSize(fd); err == nil && width > 0 {
+		return width
+	}
+
+	if width, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && width > 0 {
+		return width
+	}
+
+	return 0
+}
+
+// descSep separates names from descriptions in aligned help lines.
+const descSep = " - "
+
+// WrapText wraps all lines of text that are longer than width characters at
+// word boundaries. Continuation lines keep the indentation of the wrapped line
+// or, for aligned lines of the form "name - description", are aligned with
+// the description. A width of 0 or less disables wrapping.
+func WrapText(text string, width int) string {
+	if width <= 0 {
+		return text
+	}
+
+	var buf bytes.Buffer
+	s := bufio.NewScanner(strings.NewReader(text))
+	first := true
+	for s.Scan() {
+		if !first {
+			buf.WriteByte('\n')
+		}
+		first = false
+
+		buf.WriteString(wrapLine(s.Text(), width))
+	}
+
+	if strings.HasSuffix(text, "\n") {
+		buf.WriteByte('\n')
+	}
+
+	return buf.String()
+}
+
+func wrapLine(line string, width int) string {
+	if utf8.RuneCountInString(line) <= width {
+		return line
+	}
+
+	// indentation is ASCII, so bytes are columns
+	indent := len(line) - len(strings.TrimLeft(line, " \t"))
+	hang := indent
+	if i := strings.Index(line[indent:], descSep); i >= 0 {
+		if h := indent + utf8.RuneCountInString(line[indent:indent+i]) + len(descSep); h <= width/2 {
+			hang = h
+		}
+	}
+
+	var (
+		buf    bytes.Buffer
+		col    int
+		prefix = strings.Repeat(" ", hang)
+	)
+
+	buf.WriteString(line[:indent])
+	col = indent
+
+	for i, word := range strings.Split(line[indent:], " ") {
+		wordLen := utf8.RuneCountInString(word)
+		if i > 0 {
+			if col+1+wordLen > width && col > hang {
+				buf.WriteByte('\n')
+				buf.WriteString(prefix)
+				col = hang
+			} else {
+				buf.WriteByte(' ')
+				col++
+			}
+		}
+
+		buf.WriteString(word)
+		col += wordLen
+	}
+
+	return buf.String()
+}
@@ -0,0 +1,98 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+func TestWrapText(t *testing.T) {
+	type testcase struct {
+		in    string
+		width int
+		out   string
+	}
+
+	tcs := []testcase{
+		{
+			in:    "short line",
+			width: 20,
+			out:   "short line",
+		},
+		{
+			in:    "this line is a lot longer than the width",
+			width: 0,
+			out:   "this line is a lot longer than the width",
+		},
+		{
+			in:    "  this line is a lot longer than the width\n",
+			width: 16,
+			out:   "  this line is a\n  lot longer\n  than the width\n",
+		},
+		{
+			in:    "  --opt string - an option with a long description",
+			width: 40,
+			out: "  --opt string - an option with a long\n" +
+				"                 description",
+		},
+		{
+			// widths are counted in characters, not bytes
+			in:    "äöü äöü äöü",
+			width: 11,
+			out:   "äöü äöü äöü",
+		},
+		{
+			in:    "  --größe int - die Größe der Ausgabe",
+			width: 32,
+			out: "  --größe int - die Größe der\n" +
+				"                Ausgabe",
+		},
+	}
+
+	for _, tc := range tcs {
+		out := WrapText(tc.in, tc.width)
+		if out != tc.out {
+			t.Errorf("WrapText(%q, %d): expected\n%q\nbut got\n%q", tc.in, tc.width, tc.out, out)
+		}
+	}
+}
+
+func TestHelpWidthOption(t *testing.T) {
+	root := &cmds.Command{
+		Options: []cmdkit.Option{
+			cmds.OptionWidth,
+			cmdkit.BoolOption(cmds.OptLongHelp, "Show the full command help text."),
+		},
+		Helptext: cmdkit.HelpText{
+			Tagline:          "A test command.",
+			ShortDescription: strings.Repeat("word ", 40),
+		},
+	}
+
+	req := &cmds.Request{
+		Root:    root,
+		Command: root,
+		Options: cmdkit.OptMap{
+			cmds.OptLongHelp: true,
+			cmds.WidthOpt:    30,
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := HandleHelp("test", req, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if len(line) > 30 {
+			t.Errorf("line exceeds width: %q", line)
+		}
+	}
+
+	if OutputWidth(nil, &buf) != 0 {
+		t.Error("expected no wrapping for non-terminal writers")
+	}
+}
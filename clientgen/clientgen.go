@@ -0,0 +1,513 @@
+/*
+Package clientgen generates typed Go clients for command trees.
+
+The generated client has one method per callable command. Each method takes
+the command's string arguments as parameters and an options struct with one
+typed field per option, and returns an iterator whose Next method yields
+values of the command's Type. Calls are sent using the HTTP client from
+github.com/ipfs/go-ipfs-cmds/http.
+
+Since the command tree only exists at runtime, generation is done by a small
+program that imports the tree, e.g.
+
+	// +build ignore
+
+	package main
+
+	import (
+		"os"
+
+		"github.com/ipfs/go-ipfs-cmds/clientgen"
+		"example.com/app/commands"
+	)
+
+	func main() {
+		err := clientgen.Generate(os.Stdout, clientgen.Config{
+			Package: "client",
+			Root:    commands.Root,
+		})
+		if err != nil {
+			panic(err)
+		}
+	}
+
+which is invoked from the client package with
+
+	//go:generate sh -c "go run gen.go > client_gen.go"
+
+The clientgen command in cmd/clientgen writes and runs such a program, so
+the client can also be generated with
+
+	//go:generate clientgen -package client -root example.com/app/commands.Root -o client_gen.go
+*/
+package clientgen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+// Config configures the generated client.
+type Config struct {
+	// Package is the package name of the generated file.
+	Package string
+
+	// Root is the command tree the client is generated for.
+	Root *cmds.Command
+}
+
+// skipOptions are options that are controlled by the client and therefore
+// not exposed in the generated options structs.
+var skipOptions = map[string]bool{
+	cmds.EncLong:      true,
+	cmds.ChanOpt:      true,
+	cmds.OptLongHelp:  true,
+	cmds.OptShortHelp: true,
+}
+
+type optionDef struct {
+	Field string
+	Name  string
+	Type  string
+	Doc   string
+}
+
+type argDef struct {
+	Param    string
+	Type     string
+	Required bool
+	Variadic bool
+}
+
+type commandDef struct {
+	Name     string
+	Path     []string
+	PathStr  string
+	Tagline  string
+	Options  []optionDef
+	Args     []argDef
+	HasFiles bool
+	Type     string
+}
+
+type fileDef struct {
+	Package  string
+	Imports  map[string]string // import path -> alias
+	Commands []commandDef
+
+	// NeedsFmt is set if a command has a concrete type, whose Next method
+	// uses fmt.Errorf.
+	NeedsFmt bool
+}
+
+// Generate writes the source of a typed client for cfg.Root to w.
+func Generate(w io.Writer, cfg Config) error {
+	if cfg.Root == nil {
+		return fmt.Errorf("clientgen: no root command given")
+	}
+	if cfg.Package == "" {
+		return fmt.Errorf("clientgen: no package name given")
+	}
+
+	fd := &fileDef{
+		Package: cfg.Package,
+		Imports: make(map[string]string),
+	}
+
+	// Go name -> command path, to detect clashes like "foo-bar" and "foo bar"
+	goNames := make(map[string]string)
+
+	var visit func(pth []string, cmd *cmds.Command) error
+	visit = func(pth []string, cmd *cmds.Command) error {
+		if cmd.Run != nil && len(pth) > 0 {
+			cd, err := fd.makeCommand(cfg.Root, pth, cmd)
+			if err != nil {
+				return err
+			}
+
+			if other, ok := goNames[cd.Name]; ok {
+				return fmt.Errorf("clientgen: commands %q and %q both map to the Go name %s", other, cd.PathStr, cd.Name)
+			}
+			goNames[cd.Name] = cd.PathStr
+
+			if cd.Type != "interface{}" {
+				fd.NeedsFmt = true
+			}
+			fd.Commands = append(fd.Commands, cd)
+		}
+
+		names := make([]string, 0, len(cmd.Subcommands))
+		for name := range cmd.Subcommands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			subpth := append(append([]string(nil), pth...), name)
+			if err := visit(subpth, cmd.Subcommands[name]); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if err := visit(nil, cfg.Root); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := clientTemplate.Execute(&buf, fd); err != nil {
+		return err
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("clientgen: generated invalid code: %s", err)
+	}
+
+	_, err = w.Write(src)
+	return err
+}
+
+func (fd *fileDef) makeCommand(root *cmds.Command, pth []string, cmd *cmds.Command) (commandDef, error) {
+	cd := commandDef{
+		Name:    goName(strings.Join(pth, "-")),
+		Path:    pth,
+		PathStr: strings.Join(pth, " "),
+		Tagline: cmd.Helptext.Tagline,
+		Type:    "interface{}",
+	}
+
+	optDefs, err := root.GetOptions(pth)
+	if err != nil {
+		return cd, err
+	}
+
+	seen := make(map[cmdkit.Option]bool)
+	for _, opt := range optDefs {
+		if seen[opt] || skipOptions[opt.Name()] {
+			continue
+		}
+		seen[opt] = true
+
+		typ, ok := kindTypes[opt.Type()]
+		if !ok {
+			return cd, fmt.Errorf("clientgen: option %q of command %q has unsupported type %s", opt.Name(), cd.PathStr, opt.Type())
+		}
+
+		cd.Options = append(cd.Options, optionDef{
+			Field: goName(opt.Name()),
+			Name:  opt.Name(),
+			Type:  typ,
+			Doc:   opt.Description(),
+		})
+	}
+	sort.Slice(cd.Options, func(i, j int) bool { return cd.Options[i].Name < cd.Options[j].Name })
+
+	for _, arg := range cmd.Arguments {
+		if arg.Type == cmdkit.ArgFile {
+			cd.HasFiles = true
+			continue
+		}
+
+		ad := argDef{
+			Param:    goParam(arg.Name),
+			Required: arg.Required,
+			Variadic: arg.Variadic,
+		}
+
+		switch {
+		case arg.Variadic:
+			ad.Type = "[]string"
+		case arg.Required:
+			ad.Type = "string"
+		default:
+			ad.Type = "*string"
+		}
+
+		cd.Args = append(cd.Args, ad)
+	}
+
+	if t := reflect.TypeOf(cmd.Type); t != nil {
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		cd.Type, err = fd.typeExpr(t)
+		if err != nil {
+			return cd, fmt.Errorf("clientgen: type of command %q: %s", cd.PathStr, err)
+		}
+	}
+
+	return cd, nil
+}
+
+var kindTypes = map[reflect.Kind]string{
+	cmdkit.Bool:   "bool",
+	cmdkit.Int:    "int",
+	cmdkit.Uint:   "uint",
+	cmdkit.Float:  "float64",
+	cmdkit.String: "string",
+}
+
+// typeExpr returns the Go expression for t, registering imports as needed.
+// It fails for types that can't be referred to from another package.
+func (fd *fileDef) typeExpr(t reflect.Type) (string, error) {
+	if t.Name() != "" {
+		if t.PkgPath() == "" {
+			// builtin
+			return t.Name(), nil
+		}
+		if r := []rune(t.Name()); !unicode.IsUpper(r[0]) {
+			return "", fmt.Errorf("type %s.%s is not exported", t.PkgPath(), t.Name())
+		}
+		return fd.importAlias(t.PkgPath()) + "." + t.Name(), nil
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		elem, err := fd.typeExpr(t.Elem())
+		if err != nil {
+			return "", err
+		}
+
+		switch t.Kind() {
+		case reflect.Ptr:
+			return "*" + elem, nil
+		case reflect.Slice:
+			return "[]" + elem, nil
+		default:
+			return fmt.Sprintf("[%d]%s", t.Len(), elem), nil
+		}
+	case reflect.Map:
+		key, err := fd.typeExpr(t.Key())
+		if err != nil {
+			return "", err
+		}
+		elem, err := fd.typeExpr(t.Elem())
+		if err != nil {
+			return "", err
+		}
+		return "map[" + key + "]" + elem, nil
+	default:
+		return "interface{}", nil
+	}
+}
+
+// fixedImports are always imported by the generated code.
+var fixedImports = map[string]string{
+	"github.com/ipfs/go-ipfs-cmdkit":    "cmdkit",
+	"github.com/ipfs/go-ipfs-cmds":      "cmds",
+	"github.com/ipfs/go-ipfs-cmds/http": "cmdshttp",
+	"github.com/ipfs/go-ipfs-files":     "files",
+}
+
+func (fd *fileDef) importAlias(pkgPath string) string {
+	if alias, ok := fixedImports[pkgPath]; ok {
+		return alias
+	}
+	if alias, ok := fd.Imports[pkgPath]; ok {
+		return alias
+	}
+
+	// guess the package name, e.g. "go-ipfs-cmdkit" is usually "cmdkit"
+	base := path.Base(pkgPath)
+	if i := strings.LastIndex(base, "-"); i >= 0 && i < len(base)-1 {
+		base = base[i+1:]
+	}
+	base = goParam(base)
+
+	alias := base
+	for i := 2; fd.aliasTaken(alias); i++ {
+		alias = fmt.Sprintf("%s%d", base, i)
+	}
+
+	fd.Imports[pkgPath] = alias
+	return alias
+}
+
+func (fd *fileDef) aliasTaken(alias string) bool {
+	switch alias {
+	case "context", "fmt":
+		return true
+	}
+
+	for _, a := range fixedImports {
+		if a == alias {
+			return true
+		}
+	}
+
+	for _, a := range fd.Imports {
+		if a == alias {
+			return true
+		}
+	}
+	return false
+}
+
+// goName converts e.g. "stream-channels" into "StreamChannels".
+func goName(s string) string {
+	var out []rune
+	upper := true
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		out = append(out, r)
+	}
+
+	if len(out) > 0 && unicode.IsDigit(out[0]) {
+		out = append([]rune{'X'}, out...)
+	}
+	return string(out)
+}
+
+// goParam converts e.g. "ipfs-path" into "ipfsPath".
+func goParam(s string) string {
+	n := []rune(goName(s))
+	if len(n) == 0 {
+		return "arg"
+	}
+	n[0] = unicode.ToLower(n[0])
+
+	p := string(n)
+	switch p {
+	case "break", "case", "chan", "const", "continue", "default", "defer",
+		"else", "fallthrough", "for", "func", "go", "goto", "if", "import",
+		"interface", "map", "package", "range", "return", "select", "struct",
+		"switch", "type", "var",
+		// also avoid shadowing names used in the generated methods
+		"ctx", "opts", "args", "f", "res", "err", "c":
+		p += "Arg"
+	}
+	return p
+}
+
+var clientTemplate = template.Must(template.New("client").Funcs(template.FuncMap{
+	"quote": func(s string) string { return fmt.Sprintf("%q", s) },
+	"comment": func(s string) string {
+		return strings.Replace(strings.TrimSpace(s), "\n", "\n// ", -1)
+	},
+}).Parse(`// Code generated by clientgen. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"context"{{if .NeedsFmt}}
+	"fmt"{{end}}
+
+	cmdkit "github.com/ipfs/go-ipfs-cmdkit"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	cmdshttp "github.com/ipfs/go-ipfs-cmds/http"
+	files "github.com/ipfs/go-ipfs-files"
+{{range $path, $alias := .Imports}}
+	{{$alias}} {{quote $path}}{{end}}
+)
+
+// Client is a typed client for the command tree.
+type Client struct {
+	client cmdshttp.Client
+	root   *cmds.Command
+}
+
+// NewClient returns a Client that sends requests for commands in root using client.
+func NewClient(client cmdshttp.Client, root *cmds.Command) *Client {
+	return &Client{client: client, root: root}
+}
+
+func (c *Client) send(ctx context.Context, path []string, opts cmdkit.OptMap, args []string, f files.File) (cmds.Response, error) {
+	req, err := cmds.NewRequest(ctx, path, opts, args, f, c.root)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.client.Send(req)
+}
+{{range .Commands}}
+// {{.Name}}Options are the options of the "{{.PathStr}}" command.
+type {{.Name}}Options struct {
+{{range .Options}}{{if .Doc}}	// {{.Field}}: {{comment .Doc}}
+{{end}}	{{.Field}} *{{.Type}}
+{{end}}}
+
+func (o *{{.Name}}Options) optMap() cmdkit.OptMap {
+	m := cmdkit.OptMap{}
+	if o == nil {
+		return m
+	}
+{{range .Options}}
+	if o.{{.Field}} != nil {
+		m[{{quote .Name}}] = *o.{{.Field}}
+	}{{end}}
+
+	return m
+}
+
+// {{.Name}}Result iterates over the values emitted by the "{{.PathStr}}" command.
+type {{.Name}}Result struct {
+	res cmds.Response
+}
+
+// Response returns the underlying response.
+func (r *{{.Name}}Result) Response() cmds.Response {
+	return r.res
+}
+
+// Next returns the next emitted value. It returns io.EOF after the last value.
+func (r *{{.Name}}Result) Next() ({{.Type}}, error) {
+	var zero {{.Type}}
+
+	v, err := r.res.Next()
+	if err != nil {
+		return zero, err
+	}
+{{if eq .Type "interface{}"}}
+	return v, nil
+{{else}}
+	switch tv := v.(type) {
+	case {{.Type}}:
+		return tv, nil
+	case *{{.Type}}:
+		if tv != nil {
+			return *tv, nil
+		}
+	}
+
+	return zero, fmt.Errorf("unexpected type %T in response to \"{{.PathStr}}\"", v)
+{{end}}}
+
+// {{.Name}} calls the "{{.PathStr}}" command.{{if .Tagline}}
+// {{comment .Tagline}}{{end}}
+func (c *Client) {{.Name}}(ctx context.Context{{range .Args}}, {{.Param}} {{.Type}}{{end}}{{if .HasFiles}}, f files.File{{end}}, opts *{{.Name}}Options) (*{{.Name}}Result, error) {
+	var args []string
+{{range .Args}}{{if .Variadic}}	args = append(args, {{.Param}}...)
+{{else if .Required}}	args = append(args, {{.Param}})
+{{else}}	if {{.Param}} != nil {
+		args = append(args, *{{.Param}})
+	}
+{{end}}{{end}}
+	res, err := c.send(ctx, []string{ {{range .Path}}{{quote .}}, {{end}} }, opts.optMap(), args, {{if .HasFiles}}f{{else}}nil{{end}})
+	if err != nil {
+		return nil, err
+	}
+
+	return &{{.Name}}Result{res: res}, nil
+}
+{{end}}`))
@@ -0,0 +1,224 @@
+package clientgen
+
+import (
+	"bytes"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+type VersionOutput struct {
+	Version string
+	Commit  string
+}
+
+func noop(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error { return nil }
+
+var root = &cmds.Command{
+	Options: []cmdkit.Option{
+		cmds.OptionEncodingType,
+		cmds.OptionTimeout,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"version": &cmds.Command{
+			Helptext: cmdkit.HelpText{
+				Tagline: "Show version information.",
+			},
+			Options: []cmdkit.Option{
+				cmdkit.BoolOption("number", "n", "Only show the version number."),
+				cmdkit.BoolOption("all", "Show all version information"),
+			},
+			Type: &VersionOutput{},
+			Run:  noop,
+		},
+		"pin": &cmds.Command{
+			Subcommands: map[string]*cmds.Command{
+				"add": &cmds.Command{
+					Arguments: []cmdkit.Argument{
+						cmdkit.StringArg("ipfs-path", true, true, "Path to object(s) to be pinned."),
+					},
+					Options: []cmdkit.Option{
+						cmdkit.IntOption("depth", "Depth to pin."),
+					},
+					Type: []string{},
+					Run:  noop,
+				},
+			},
+		},
+		"cat": &cmds.Command{
+			Arguments: []cmdkit.Argument{
+				cmdkit.StringArg("path", true, false, "The path."),
+				cmdkit.StringArg("offset", false, false, "An offset."),
+			},
+			Run: noop,
+		},
+		"add": &cmds.Command{
+			Arguments: []cmdkit.Argument{
+				cmdkit.FileArg("file", true, true, "The files to add."),
+			},
+			Run: noop,
+		},
+	},
+}
+
+func TestGenerate(t *testing.T) {
+	var buf bytes.Buffer
+	err := Generate(&buf, Config{Package: "client", Root: root})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := buf.String()
+
+	_, err = parser.ParseFile(token.NewFileSet(), "client_gen.go", src, 0)
+	if err != nil {
+		t.Fatalf("generated code does not parse: %s\n%s", err, src)
+	}
+
+	expect := []string{
+		`clientgen "github.com/ipfs/go-ipfs-cmds/clientgen"`,
+		"func (c *Client) Version(ctx context.Context, opts *VersionOptions) (*VersionResult, error) {",
+		"func (r *VersionResult) Next() (clientgen.VersionOutput, error) {",
+		"Number *bool",
+		"Timeout *string",
+		"func (c *Client) PinAdd(ctx context.Context, ipfsPath []string, opts *PinAddOptions) (*PinAddResult, error) {",
+		"func (r *PinAddResult) Next() ([]string, error) {",
+		"Depth *int",
+		"func (c *Client) Cat(ctx context.Context, path string, offset *string, opts *CatOptions) (*CatResult, error) {",
+		"func (r *CatResult) Next() (interface{}, error) {",
+		"func (c *Client) Add(ctx context.Context, f files.File, opts *AddOptions) (*AddResult, error) {",
+	}
+
+	for _, e := range expect {
+		if !strings.Contains(src, e) {
+			t.Errorf("expected generated code to contain %q", e)
+		}
+	}
+
+	// options controlled by the client must not be exposed
+	if strings.Contains(src, "Encoding *string") {
+		t.Error("generated code exposes the encoding option")
+	}
+
+	if t.Failed() {
+		t.Log(src)
+	}
+}
+
+// typeCheck parses and type checks the generated src.
+func typeCheck(t *testing.T, src string) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "client_gen.go", src, 0)
+	if err != nil {
+		t.Fatalf("generated code does not parse: %s\n%s", err, src)
+	}
+
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	if _, err := conf.Check("client", fset, []*ast.File{f}, nil); err != nil {
+		t.Fatalf("generated code does not type check: %s\n%s", err, src)
+	}
+}
+
+func TestGenerateTypeCheck(t *testing.T) {
+	untyped := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"cat": &cmds.Command{
+				Arguments: []cmdkit.Argument{
+					cmdkit.StringArg("path", true, false, "The path."),
+				},
+				Run: noop,
+			},
+			"add": &cmds.Command{
+				Arguments: []cmdkit.Argument{
+					cmdkit.FileArg("file", true, true, "The files to add."),
+				},
+				Options: []cmdkit.Option{
+					cmdkit.BoolOption("quiet", "q", "Write minimal output."),
+				},
+				Run: noop,
+			},
+		},
+	}
+
+	typed := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"ls": &cmds.Command{
+				Type: []string{},
+				Run:  noop,
+			},
+			"resolve": &cmds.Command{
+				Type: &url.URL{},
+				Run:  noop,
+			},
+		},
+	}
+
+	for name, root := range map[string]*cmds.Command{"untyped": untyped, "typed": typed} {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Generate(&buf, Config{Package: "client", Root: root}); err != nil {
+				t.Fatal(err)
+			}
+
+			typeCheck(t, buf.String())
+		})
+	}
+}
+
+type unexported struct{}
+
+func TestGenerateErrors(t *testing.T) {
+	tcs := map[string]*cmds.Command{
+		"unexported type": &cmds.Command{
+			Subcommands: map[string]*cmds.Command{
+				"foo": &cmds.Command{Type: unexported{}, Run: noop},
+			},
+		},
+		"unexported element type": &cmds.Command{
+			Subcommands: map[string]*cmds.Command{
+				"foo": &cmds.Command{Type: map[string]*unexported{}, Run: noop},
+			},
+		},
+		"name clash": &cmds.Command{
+			Subcommands: map[string]*cmds.Command{
+				"foo-bar": &cmds.Command{Run: noop},
+				"foo": &cmds.Command{
+					Subcommands: map[string]*cmds.Command{
+						"bar": &cmds.Command{Run: noop},
+					},
+				},
+			},
+		},
+	}
+
+	for name, root := range tcs {
+		var buf bytes.Buffer
+		if err := Generate(&buf, Config{Package: "client", Root: root}); err == nil {
+			t.Errorf("%s: expected an error, got:\n%s", name, buf.String())
+		}
+	}
+}
+
+func TestGoName(t *testing.T) {
+	tcs := map[string]string{
+		"version":         "Version",
+		"stream-channels": "StreamChannels",
+		"pin-add":         "PinAdd",
+		"a_b":             "AB",
+		"1st":             "X1st",
+	}
+
+	for in, out := range tcs {
+		if n := goName(in); n != out {
+			t.Errorf("goName(%q): expected %q but got %q", in, out, n)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// Command clientgen generates a typed client for a command tree.
+//
+// Since the command tree only exists at runtime, clientgen writes a small
+// program that imports the tree and calls clientgen.Generate, and runs it
+// with "go run". Usage:
+//
+//	clientgen -package client -root example.com/app/commands.Root -o client_gen.go
+//
+// which is usually invoked from a go:generate directive in the client
+// package.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+func main() {
+	var (
+		pkg  = flag.String("package", os.Getenv("GOPACKAGE"), "package name of the generated file (defaults to $GOPACKAGE)")
+		root = flag.String("root", "", "the root command, as <import path>.<variable>")
+		out  = flag.String("o", "", "output file (defaults to stdout)")
+	)
+	flag.Parse()
+
+	if err := run(*pkg, *root, *out); err != nil {
+		fmt.Fprintln(os.Stderr, "clientgen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(pkg, root, out string) error {
+	if pkg == "" {
+		return fmt.Errorf("no package name given")
+	}
+
+	importPath, name, err := splitRoot(root)
+	if err != nil {
+		return err
+	}
+
+	var src bytes.Buffer
+	err = programTemplate.Execute(&src, map[string]string{
+		"ImportPath": importPath,
+		"Name":       name,
+		"Package":    pkg,
+	})
+	if err != nil {
+		return err
+	}
+
+	// the program has to live in the current module or GOPATH so it can
+	// import the command tree
+	dir, err := ioutil.TempDir(".", ".clientgen")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	prog := filepath.Join(dir, "main.go")
+	if err := ioutil.WriteFile(prog, src.Bytes(), 0644); err != nil {
+		return err
+	}
+
+	var stdout bytes.Buffer
+	cmd := exec.Command("go", "run", prog)
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+
+	if out == "" {
+		_, err = os.Stdout.Write(stdout.Bytes())
+		return err
+	}
+
+	return ioutil.WriteFile(out, stdout.Bytes(), 0644)
+}
+
+// splitRoot splits e.g. "example.com/app/commands.Root" into the import path
+// and the variable name.
+func splitRoot(root string) (string, string, error) {
+	i := strings.LastIndex(root, ".")
+	if i <= 0 || i < strings.LastIndex(root, "/") || i == len(root)-1 {
+		return "", "", fmt.Errorf("invalid root %q, expected <import path>.<variable>", root)
+	}
+
+	return root[:i], root[i+1:], nil
+}
+
+var programTemplate = template.Must(template.New("program").Parse(`package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ipfs/go-ipfs-cmds/clientgen"
+
+	root {{printf "%q" .ImportPath}}
+)
+
+func main() {
+	err := clientgen.Generate(os.Stdout, clientgen.Config{
+		Package: {{printf "%q" .Package}},
+		Root:    root.{{.Name}},
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+`))
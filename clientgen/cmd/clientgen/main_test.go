@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSplitRoot(t *testing.T) {
+	type testcase struct {
+		root, importPath, name string
+		fail                   bool
+	}
+
+	tcs := []testcase{
+		{root: "example.com/app/commands.Root", importPath: "example.com/app/commands", name: "Root"},
+		{root: "github.com/ipfs/go-ipfs/core/commands.Root", importPath: "github.com/ipfs/go-ipfs/core/commands", name: "Root"},
+		{root: "example.com/app.v2/commands", fail: true},
+		{root: "example.com/app/commands.", fail: true},
+		{root: "Root", fail: true},
+		{root: "", fail: true},
+	}
+
+	for _, tc := range tcs {
+		importPath, name, err := splitRoot(tc.root)
+		if tc.fail {
+			if err == nil {
+				t.Errorf("splitRoot(%q): expected an error", tc.root)
+			}
+			continue
+		}
+
+		if err != nil || importPath != tc.importPath || name != tc.name {
+			t.Errorf("splitRoot(%q): expected %q, %q but got %q, %q, %v", tc.root, tc.importPath, tc.name, importPath, name, err)
+		}
+	}
+}
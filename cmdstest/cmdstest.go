@@ -0,0 +1,188 @@
+/*
+Package cmdstest helps testing commands. Execute runs a command like the
+CLI would, without a terminal or a server, and returns the values it
+emitted, its error and the exit code of the CLI:
+
+	res := cmdstest.Execute(t, root, []string{"pin", "ls"}, cmdkit.OptMap{"type": "direct"}, nil)
+	if res.Err != nil {
+		t.Fatal(res.Err)
+	}
+
+The output of the command in an encoding is compared with golden files
+named after the encodings, e.g. testdata/pin-ls.json and
+testdata/pin-ls.text:
+
+	res.Golden(t, "testdata/pin-ls", cmds.JSON, cmds.Text)
+
+Run the tests with -cmdstest.update to write the golden files.
+*/
+package cmdstest
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/go-ipfs-cmds/cli"
+	"github.com/ipfs/go-ipfs-files"
+)
+
+var update = flag.Bool("cmdstest.update", false, "write the golden files compared by cmdstest.Golden")
+
+// Env is a cmds.Environment with a context, the background context if
+// Ctx is nil.
+type Env struct {
+	Ctx context.Context
+}
+
+// Context returns the context of the environment.
+func (e Env) Context() context.Context {
+	if e.Ctx == nil {
+		return context.Background()
+	}
+	return e.Ctx
+}
+
+// Result is the result of executing a command.
+type Result struct {
+	// Request is the request the command was called with, nil if it
+	// couldn't be made.
+	Request *cmds.Request
+	// Recorder recorded the response of the command.
+	Recorder *Recorder
+
+	// Values are the values the command emitted, see Recorder.
+	Values []interface{}
+	// Err is the error the command failed with.
+	Err error
+	// ExitCode is the code the CLI would exit with, see cli.ExitSuccess.
+	ExitCode int
+}
+
+// Execute executes the command at path of root with the options opts, the
+// files and the string arguments args in an Env, see ExecuteEnv.
+func Execute(t testing.TB, root *cmds.Command, path []string, opts cmdkit.OptMap, files files.File, args ...string) *Result {
+	t.Helper()
+	return ExecuteEnv(t, Env{}, root, path, opts, files, args...)
+}
+
+// ExecuteEnv executes the command at path of root in env with
+// cmds.NewExecutor, applying no PostRun. The context of the request is
+// canceled once the test finished. Invalid options and arguments fail the
+// command with cli.ExitUsage, like on the command line.
+func ExecuteEnv(t testing.TB, env cmds.Environment, root *cmds.Command, path []string, opts cmdkit.OptMap, files files.File, args ...string) *Result {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(env.Context())
+	t.Cleanup(cancel)
+
+	rec := NewRecorder()
+	req, err := cmds.NewRequest(ctx, path, opts, args, files, root)
+	if err != nil {
+		rec.CloseWithError(err)
+		return &Result{Recorder: rec, Err: err, ExitCode: cli.ExitUsage}
+	}
+	// the CLI checks the arguments while parsing the command line
+	if err := req.Command.CheckArguments(req); err != nil {
+		rec.CloseWithError(err)
+		return &Result{Request: req, Recorder: rec, Err: err, ExitCode: cli.ExitUsage}
+	}
+
+	if err := cmds.NewExecutor(root).Execute(req, rec, env); err != nil {
+		// the executor doesn't close the emitter if the command didn't run
+		rec.CloseWithError(err)
+	}
+	<-rec.Done()
+
+	err = rec.Err()
+	return &Result{
+		Request:  req,
+		Recorder: rec,
+		Values:   rec.Values(),
+		Err:      err,
+		ExitCode: cli.ExitCodeOf(err),
+	}
+}
+
+// Output returns the values of the result encoded with encType as the
+// emitters of the command write them, e.g. with the TextFormat of the
+// command for cmds.Text. The data of readers is written as it is, the error
+// isn't part of the output.
+func (r *Result) Output(t testing.TB, encType cmds.EncodingType) []byte {
+	t.Helper()
+	if r.Request == nil {
+		t.Fatalf("no output, the request failed: %s", r.Err)
+	}
+
+	req := *r.Request
+	req.Options = make(cmdkit.OptMap, len(r.Request.Options)+1)
+	for k, v := range r.Request.Options {
+		req.Options[k] = v
+	}
+	req.Options[cmds.EncLong] = string(encType)
+
+	var buf bytes.Buffer
+	re, err := cmds.NewWriterResponseEmitter(nopCloser{&buf}, &req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range r.Recorder.emitted() {
+		if rd, ok := v.(io.Reader); ok {
+			// written as it is, like by the CLI
+			io.Copy(&buf, rd)
+			continue
+		}
+		if err := re.Emit(v); err != nil {
+			t.Fatalf("error encoding %T with %s: %s", v, encType, err)
+		}
+	}
+	if err := re.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// Golden compares the output of the result in every encoding of encTypes
+// with the golden file at path with the encoding as extension, e.g.
+// path.json for cmds.JSON. With -cmdstest.update, the golden files are
+// written instead.
+func (r *Result) Golden(t testing.TB, path string, encTypes ...cmds.EncodingType) {
+	t.Helper()
+
+	for _, encType := range encTypes {
+		out := r.Output(t, encType)
+		file := path + "." + string(encType)
+
+		if *update {
+			if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(file, out, 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		golden, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Errorf("%s (run with -cmdstest.update to write it)", err)
+			continue
+		}
+		if !bytes.Equal(out, golden) {
+			t.Errorf("%s: output differs from the golden file\ngot:\n%s\nexpected:\n%s", file, out, golden)
+		}
+	}
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
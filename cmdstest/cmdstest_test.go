@@ -0,0 +1,127 @@
+package cmdstest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/go-ipfs-cmds/cli"
+	"github.com/ipfs/go-ipfs-files"
+)
+
+type entry struct {
+	Name string
+	Size int
+}
+
+var root = &cmds.Command{
+	Subcommands: map[string]*cmds.Command{
+		"ls": {
+			Arguments: []cmdkit.Argument{cmdkit.StringArg("name", true, true, "the names")},
+			Options:   []cmdkit.Option{cmdkit.IntOption("size", "the size").WithDefault(1)},
+			Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+				size, _ := req.Options["size"].(int)
+				for _, name := range req.Arguments {
+					if err := re.Emit(&entry{Name: name, Size: size}); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Encoders: cmds.EncoderMap{
+				cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, e *entry) error {
+					_, err := fmt.Fprintf(w, "%s\t%d\n", e.Name, e.Size)
+					return err
+				}),
+			},
+			Type: entry{},
+		},
+		"cat": {
+			Arguments: []cmdkit.Argument{cmdkit.FileArg("file", true, false, "the file")},
+			Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+				f, err := req.Files.NextFile()
+				if err != nil {
+					return err
+				}
+				return re.Emit(f)
+			},
+		},
+		"fail": {
+			Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+				return cmdkit.Errorf(cmdkit.ErrClient, "bad input")
+			},
+		},
+	},
+}
+
+func TestExecute(t *testing.T) {
+	res := Execute(t, root, []string{"ls"}, cmdkit.OptMap{"size": 2}, nil, "a", "b")
+	if res.Err != nil || res.ExitCode != cli.ExitSuccess {
+		t.Fatalf("unexpected result %v, %d", res.Err, res.ExitCode)
+	}
+	if expected := []interface{}{&entry{"a", 2}, &entry{"b", 2}}; !reflect.DeepEqual(res.Values, expected) {
+		t.Errorf("expected %v but got %v", expected, res.Values)
+	}
+	res.Golden(t, "testdata/ls", cmds.JSON, cmds.Text)
+
+	f := files.NewSliceFile("", "", []files.File{
+		files.NewReaderFile("file", "file", ioutil.NopCloser(strings.NewReader("data")), nil),
+	})
+	res = Execute(t, root, []string{"cat"}, nil, f)
+	if res.Err != nil || len(res.Values) != 1 || string(res.Values[0].([]byte)) != "data" {
+		t.Errorf("expected the data of the file, got %v, %v", res.Values, res.Err)
+	}
+	if out := res.Output(t, cmds.JSON); string(out) != "data" {
+		t.Errorf("expected the data to be written as it is, got %q", out)
+	}
+
+	for _, tc := range []struct {
+		path []string
+		opts cmdkit.OptMap
+	}{
+		{[]string{"fail"}, nil},
+		// missing arguments
+		{[]string{"ls"}, nil},
+		// invalid options
+		{[]string{"ls"}, cmdkit.OptMap{"size": "many"}},
+	} {
+		res := Execute(t, root, tc.path, tc.opts, nil)
+		if res.Err == nil || res.ExitCode != cli.ExitUsage {
+			t.Errorf("%v: expected a usage error, got %v, %d", tc.path, res.Err, res.ExitCode)
+		}
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	rec := NewRecorder()
+	if err := cmds.EmitOnce(rec, "single"); err != nil {
+		t.Fatal(err)
+	}
+	if !rec.Closed() {
+		t.Error("expected single values to close the recorder")
+	}
+	if err := rec.Emit("again"); err != cmds.ErrClosedEmitter {
+		t.Errorf("expected ErrClosedEmitter, got %v", err)
+	}
+
+	rec = NewRecorder()
+	ch := make(chan interface{}, 2)
+	ch <- 1
+	ch <- 2
+	close(ch)
+	rec.SetLength(2)
+	if err := rec.Emit(ch); err != nil {
+		t.Fatal(err)
+	}
+	failed := errors.New("failed")
+	rec.CloseWithError(failed)
+	if !reflect.DeepEqual(rec.Values(), []interface{}{1, 2}) || rec.Length() != 2 || rec.Err() != failed {
+		t.Errorf("unexpected recording %v, %d, %v", rec.Values(), rec.Length(), rec.Err())
+	}
+}
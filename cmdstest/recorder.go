@@ -0,0 +1,164 @@
+package cmdstest
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/go-ipfs-cmds/debug"
+)
+
+// Recorder is a cmds.ResponseEmitter recording the values emitted to it.
+// Values wrapped in cmds.Single close it after they are recorded, channels
+// are emitted value by value, and io.Readers are read to the end, closed and
+// recorded as the []byte they returned. The zero value is ready to use.
+type Recorder struct {
+	l       sync.Mutex
+	values  []interface{}
+	readers []bool
+	length  uint64
+	err     error
+	closed  bool
+	done    chan struct{}
+}
+
+// NewRecorder returns an empty Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// Emit records v.
+func (r *Recorder) Emit(v interface{}) error {
+	if ch, ok := v.(chan interface{}); ok {
+		v = (<-chan interface{})(ch)
+	}
+	if ch, ok := v.(<-chan interface{}); ok {
+		return cmds.EmitChan(r, ch)
+	}
+	debug.AssertNotError(v)
+
+	single, isSingle := v.(cmds.Single)
+	if isSingle {
+		v = single.Value
+	}
+
+	r.l.Lock()
+	defer r.l.Unlock()
+	if r.closed {
+		cmds.CloseReader(v)
+		return cmds.ErrClosedEmitter
+	}
+
+	rd, isReader := v.(io.Reader)
+	if isReader {
+		data, err := ioutil.ReadAll(rd)
+		cmds.CloseReader(v)
+		if err != nil {
+			return err
+		}
+		v = data
+	}
+
+	r.values = append(r.values, v)
+	r.readers = append(r.readers, isReader)
+	if isSingle {
+		r.close(nil)
+	}
+	return nil
+}
+
+// SetLength records the length of the output.
+func (r *Recorder) SetLength(l uint64) {
+	r.l.Lock()
+	defer r.l.Unlock()
+	r.length = l
+}
+
+// Close closes the Recorder.
+func (r *Recorder) Close() error {
+	return r.CloseWithError(nil)
+}
+
+// CloseWithError closes the Recorder and records err.
+func (r *Recorder) CloseWithError(err error) error {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	if r.closed {
+		return cmds.ErrClosingClosedEmitter
+	}
+	r.close(err)
+	return nil
+}
+
+func (r *Recorder) close(err error) {
+	if err == io.EOF {
+		err = nil
+	}
+	r.err = err
+	r.closed = true
+	close(r.doneCh())
+}
+
+// doneCh returns the channel closed with the Recorder. It must be called
+// with l held.
+func (r *Recorder) doneCh() chan struct{} {
+	if r.done == nil {
+		r.done = make(chan struct{})
+	}
+	return r.done
+}
+
+// Done returns a channel that is closed once the Recorder is closed.
+func (r *Recorder) Done() <-chan struct{} {
+	r.l.Lock()
+	defer r.l.Unlock()
+	return r.doneCh()
+}
+
+// Values returns the values recorded so far.
+func (r *Recorder) Values() []interface{} {
+	r.l.Lock()
+	defer r.l.Unlock()
+	return append([]interface{}(nil), r.values...)
+}
+
+// Length returns the length set with SetLength.
+func (r *Recorder) Length() uint64 {
+	r.l.Lock()
+	defer r.l.Unlock()
+	return r.length
+}
+
+// Err returns the error the Recorder was closed with, nil if it is still
+// open or was closed without one.
+func (r *Recorder) Err() error {
+	r.l.Lock()
+	defer r.l.Unlock()
+	return r.err
+}
+
+// Closed returns whether the Recorder was closed.
+func (r *Recorder) Closed() bool {
+	r.l.Lock()
+	defer r.l.Unlock()
+	return r.closed
+}
+
+// emitted returns the values to emit to reproduce the output of the
+// command, with the data of readers as readers again.
+func (r *Recorder) emitted() []interface{} {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	vs := make([]interface{}, len(r.values))
+	for i, v := range r.values {
+		if r.readers[i] {
+			v = bytes.NewReader(v.([]byte))
+		}
+		vs[i] = v
+	}
+	return vs
+}
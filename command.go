@@ -30,6 +30,17 @@ type Function func(*Request, ResponseEmitter, Environment) error
 // PostRunMap is the map used in Command.PostRun.
 type PostRunMap map[PostRunType]func(Response, ResponseEmitter) error
 
+// Prompt describes an argument or option the user is prompted for.
+type Prompt struct {
+	// Name is the name of the argument or option.
+	Name string
+	// Message is shown to the user. Defaults to the description of the
+	// argument or option.
+	Message string
+	// Secret disables echoing the input, e.g. for passwords.
+	Secret bool
+}
+
 // Command is a runnable command, with input arguments and options (flags).
 // It can also have Subcommands, to group units of work into sets.
 type Command struct {
@@ -38,14 +49,65 @@ type Command struct {
 	PreRun    func(req *Request, env Environment) error
 
 	// Run is the function that processes the request to generate a response.
-	// Note that when executing the command over the HTTP API you can only read
-	// after writing when using multipart requests. The request body will not be
-	// available for reading after the HTTP connection has been written to.
+	// Over the HTTP API, the files of the request are read from the request
+	// body as it arrives, also after values were emitted.
 	Run      Function
 	PostRun  PostRunMap
 	Encoders EncoderMap
 	Helptext cmdkit.HelpText
 
+	// TypedEncoders encodes the values of the types it has encoders for,
+	// before Encoders and DefaultEncoders are consulted. See
+	// EncoderRegistry.
+	TypedEncoders *EncoderRegistry
+
+	// TextFormat renders the values in the text encoding with a template
+	// or as a table, unless Encoders has an encoder for it.
+	TextFormat *TextFormat
+
+	// Complete optionally returns dynamic completions (e.g. pinned CIDs or
+	// peer names) for the word that is currently being typed.
+	// See Complete.
+	Complete CompleteFunc
+
+	// Prompts lists the arguments and options the CLI asks the user for if
+	// they are missing from the command line and stdin is a terminal.
+	Prompts []Prompt
+
+	// AllowUnknownOptions makes the CLI collect options it doesn't know in
+	// Request.Options instead of failing, for this command and its
+	// subcommands. This lets clients pass options on to a newer server.
+	// Since the type of unknown options isn't known, values have to be
+	// passed as --name=value; --name alone is passed as true.
+	AllowUnknownOptions bool
+
+	// Streaming denotes that the command emits a stream of values or data
+	// over a long time, e.g. by following a log, instead of a single result.
+	// Frontends use it to apply separate limits to such commands.
+	Streaming bool
+
+	// Interactive denotes that the command reads its stdin argument while
+	// it emits values, e.g. a REPL answering every line it reads. Over HTTP
+	// the response starts before the command emits anything, and clients
+	// send stdin as it is read instead of staging it as a resumable upload.
+	Interactive bool
+
+	// Cacheable denotes that the output of the command only depends on its
+	// arguments and options, so clients may cache it.
+	Cacheable bool
+
+	// Paginated denotes that the framework applies the LimitOpt, OffsetOpt
+	// and CursorOpt options to the values the command emits, so it emits
+	// all of them in a stable order and stops once Emit returns
+	// ErrPageEnd. The cursor of the next page is reported to the client,
+	// see NextCursor.
+	Paginated bool
+
+	// Hidden commands can be called, but aren't listed in the help of their
+	// parent or suggested for mistyped commands, e.g. for debugging and
+	// tooling commands.
+	Hidden bool
+
 	// External denotes that a command is actually an external binary.
 	// fewer checks and validations will be performed on such commands.
 	External bool
@@ -55,7 +117,14 @@ type Command struct {
 	// the Run Function.
 	//
 	// ie. If command Run returns &Block{}, then Command.Type == &Block{}
-	Type        interface{}
+	Type interface{}
+
+	// Types describes the types of the output by name if the command emits
+	// values of several types, e.g. progress updates and a result. Values
+	// are tagged with the name of their type on the wire, so clients decode
+	// each value into its type. Types takes precedence over Type.
+	Types map[string]interface{}
+
 	Subcommands map[string]*Command
 }
 
@@ -104,7 +173,20 @@ func (c *Command) call(req *Request, re ResponseEmitter, env Environment) error
 		return err
 	}
 
-	return cmd.Run(req, re, env)
+	page, err := requestPage(req)
+	if err != nil {
+		return err
+	}
+
+	var span Span
+	req.Context, span = StartSpan(req.Context, RunSpan)
+	span.SetPath(req.Path)
+
+	re, done := diagnose(req, paginate(req, re, page))
+	err = pageEndErr(cmd.Run(req, re, env))
+	span.End(err)
+	done(err)
+	return err
 }
 
 // Resolve returns the subcommands at the given path
@@ -0,0 +1,33 @@
+package cmds
+
+import (
+	"strings"
+)
+
+// CompleteFunc returns completions for word, the (possibly empty) argument
+// that is currently being typed. req contains the command, options and
+// arguments that have been typed so far. Required arguments may be missing.
+type CompleteFunc func(req *Request, env Environment, word string) ([]string, error)
+
+// Complete returns the completions provided by the Complete hook of
+// req.Command that start with word. It returns no completions if the
+// command doesn't define a hook.
+func Complete(req *Request, env Environment, word string) ([]string, error) {
+	if req.Command == nil || req.Command.Complete == nil {
+		return nil, nil
+	}
+
+	candidates, err := req.Command.Complete(req, env, word)
+	if err != nil {
+		return nil, err
+	}
+
+	completions := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		if strings.HasPrefix(c, word) {
+			completions = append(completions, c)
+		}
+	}
+
+	return completions, nil
+}
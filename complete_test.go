@@ -0,0 +1,47 @@
+package cmds
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestComplete(t *testing.T) {
+	root := &Command{
+		Subcommands: map[string]*Command{
+			"peers": &Command{
+				Run: noop,
+				Complete: func(req *Request, env Environment, word string) ([]string, error) {
+					return []string{"alice", "bob", "albert"}, nil
+				},
+			},
+			"nohook": &Command{
+				Run: noop,
+			},
+		},
+	}
+
+	req, err := NewRequest(context.Background(), []string{"peers"}, nil, nil, nil, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	completions, err := Complete(req, nil, "al")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exp := []string{"alice", "albert"}; !reflect.DeepEqual(completions, exp) {
+		t.Errorf("expected %v but got %v", exp, completions)
+	}
+
+	req, err = NewRequest(context.Background(), []string{"nohook"}, nil, nil, nil, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	completions, err = Complete(req, nil, "al")
+	if err != nil || completions != nil {
+		t.Errorf("expected no completions and no error but got %v, %v", completions, err)
+	}
+}
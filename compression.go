@@ -0,0 +1,196 @@
+package cmds
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// CompressionType defines a supported payload compression.
+type CompressionType string
+
+// Supported CompressionType constants.
+const (
+	Identity CompressionType = "identity"
+	Gzip     CompressionType = "gzip"
+	Zstd     CompressionType = "zstd"
+)
+
+// CompressWriter compresses the data written to it. Flush writes the data
+// compressed so far, so every value of a stream can be read as soon as it
+// was emitted.
+type CompressWriter interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// Compressor creates the writers and readers of a CompressionType.
+type Compressor struct {
+	NewWriter func(w io.Writer) CompressWriter
+	NewReader func(r io.Reader) (io.ReadCloser, error)
+}
+
+// Compressors holds the payload compressions supported by the writer
+// response emitter and response, which transports such as pipes and stdio
+// use. They compress the values if the request has the CompressOpt option,
+// which lists the compressions the client supports in order of preference.
+// The emitter picks the first one it supports and announces it on the first
+// line of the payload, so both sides may support different compressions.
+// The HTTP handler and client use them as content codings.
+var Compressors = map[CompressionType]Compressor{
+	Gzip: {
+		NewWriter: func(w io.Writer) CompressWriter { return gzip.NewWriter(w) },
+		NewReader: func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+	},
+	Zstd: {
+		NewWriter: func(w io.Writer) CompressWriter {
+			// only fails with invalid options
+			zw, _ := zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+			return zw
+		},
+		NewReader: func(r io.Reader) (io.ReadCloser, error) {
+			// a single goroutine decodes the blocks as they arrive, so
+			// flushed values aren't held back
+			zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+			if err != nil {
+				return nil, err
+			}
+			return zr.IOReadCloser(), nil
+		},
+	},
+}
+
+// errBadCompression is returned if the payload doesn't start with a
+// supported compression.
+var errBadCompression = errors.New("invalid compression announcement")
+
+// compressionRequested returns whether the payloads of req are compressed.
+func compressionRequested(req *Request) bool {
+	pref, _ := req.Options[CompressOpt].(string)
+	return pref != ""
+}
+
+// negotiateCompression returns the first compression listed in pref that
+// is supported.
+func negotiateCompression(pref string) CompressionType {
+	for _, ct := range strings.Split(pref, ",") {
+		ct := CompressionType(strings.TrimSpace(ct))
+		if _, ok := Compressors[ct]; ok {
+			return ct
+		}
+	}
+	return Identity
+}
+
+// newCompressWriter returns the writer compressing the payload of req with
+// the negotiated compression. The compression is announced on w when the
+// payload is written, so creating the emitter doesn't wait for the reader.
+func newCompressWriter(req *Request, w io.Writer) CompressWriter {
+	pref, _ := req.Options[CompressOpt].(string)
+	return &announcingWriter{w: w, ct: negotiateCompression(pref)}
+}
+
+type announcingWriter struct {
+	w  io.Writer
+	ct CompressionType
+	cw CompressWriter
+}
+
+func (w *announcingWriter) announce() error {
+	if w.cw != nil {
+		return nil
+	}
+
+	if _, err := fmt.Fprintf(w.w, "%s\n", w.ct); err != nil {
+		return err
+	}
+
+	if w.ct == Identity {
+		w.cw = nopCompressWriter{w.w}
+	} else {
+		w.cw = Compressors[w.ct].NewWriter(w.w)
+	}
+	return nil
+}
+
+func (w *announcingWriter) Write(p []byte) (int, error) {
+	if err := w.announce(); err != nil {
+		return 0, err
+	}
+	return w.cw.Write(p)
+}
+
+func (w *announcingWriter) Flush() error {
+	if err := w.announce(); err != nil {
+		return err
+	}
+	return w.cw.Flush()
+}
+
+func (w *announcingWriter) Close() error {
+	if err := w.announce(); err != nil {
+		return err
+	}
+	return w.cw.Close()
+}
+
+type nopCompressWriter struct {
+	io.Writer
+}
+
+func (nopCompressWriter) Flush() error { return nil }
+func (nopCompressWriter) Close() error { return nil }
+
+// decompressReader decompresses a payload written by a compressing
+// emitter. The announcement is only read on the first Read, so creating the
+// response doesn't wait for the emitter.
+type decompressReader struct {
+	r  io.Reader
+	dr io.Reader
+}
+
+func (r *decompressReader) Read(p []byte) (int, error) {
+	if r.dr == nil {
+		ct, err := r.readAnnouncement()
+		if err != nil {
+			return 0, err
+		}
+
+		if ct == Identity {
+			r.dr = r.r
+		} else {
+			c, ok := Compressors[ct]
+			if !ok {
+				return 0, errBadCompression
+			}
+			if r.dr, err = c.NewReader(r.r); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return r.dr.Read(p)
+}
+
+// readAnnouncement reads the first line of the payload byte by byte, so no
+// compressed data is consumed.
+func (r *decompressReader) readAnnouncement() (CompressionType, error) {
+	var (
+		line []byte
+		b    [1]byte
+	)
+	for len(line) < 64 {
+		if _, err := io.ReadFull(r.r, b[:]); err != nil {
+			return "", err
+		}
+		if b[0] == '\n' {
+			return CompressionType(line), nil
+		}
+		line = append(line, b[0])
+	}
+	return "", errBadCompression
+}
@@ -0,0 +1,116 @@
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCompression(t *testing.T) {
+	tcs := []struct {
+		pref     string
+		expected CompressionType
+	}{
+		{"gzip", Gzip},
+		{"zstd, gzip", Zstd},
+		{"zstd", Zstd},
+		{"br, gzip", Gzip},
+		{"br", Identity},
+	}
+
+	for _, tc := range tcs {
+		req, err := NewRequest(context.Background(), nil, map[string]interface{}{
+			EncLong:     JSON,
+			CompressOpt: tc.pref,
+		}, nil, nil, &Command{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		re, err := NewWriterResponseEmitter(wc{&buf, nopCloser{}}, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range []string{"a", "b"} {
+			if err := re.Emit(v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := re.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		parts := strings.SplitN(buf.String(), "\n", 2)
+		if parts[0] != string(tc.expected) {
+			t.Errorf("%q: expected compression %q but got %q", tc.pref, tc.expected, parts[0])
+		}
+		if isGzip := strings.HasPrefix(parts[1], "\x1f\x8b"); isGzip != (tc.expected == Gzip) {
+			t.Errorf("%q: expected gzip payload to be %v", tc.pref, tc.expected == Gzip)
+		}
+		if isZstd := strings.HasPrefix(parts[1], "\x28\xb5\x2f\xfd"); isZstd != (tc.expected == Zstd) {
+			t.Errorf("%q: expected zstd payload to be %v", tc.pref, tc.expected == Zstd)
+		}
+
+		res, err := NewReaderResponse(&buf, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var values []string
+		for {
+			v, err := res.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%q: %s", tc.pref, err)
+			}
+			values = append(values, v.(string))
+		}
+		if strings.Join(values, ",") != "a,b" {
+			t.Errorf("%q: unexpected values %v", tc.pref, values)
+		}
+	}
+}
+
+func TestCompressionStreaming(t *testing.T) {
+	for _, ct := range []CompressionType{Gzip, Zstd} {
+		req, err := NewRequest(context.Background(), nil, map[string]interface{}{
+			EncLong:     JSON,
+			CompressOpt: string(ct),
+		}, nil, nil, &Command{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pr, pw := io.Pipe()
+		re, err := NewWriterResponseEmitter(pw, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := NewReaderResponse(pr, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- re.Emit("test")
+		}()
+
+		// the value is flushed before the emitter is closed
+		if v, err := res.Next(); err != nil || v != "test" {
+			t.Fatalf("%s: expected %q but got %v, %v", ct, "test", v, err)
+		}
+		if err := <-errCh; err != nil {
+			t.Fatal(err)
+		}
+
+		go re.Close()
+		if _, err := res.Next(); err != io.EOF {
+			t.Fatalf("%s: expected EOF but got %v", ct, err)
+		}
+	}
+}
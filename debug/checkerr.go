@@ -19,10 +19,11 @@ func (err UnexpectedError) Error() string {
 
 // AssertNotError verifies that v is not a cmdkit.Error or *cmdkit.Error. Otherwise it panics.
 func AssertNotError(v interface{}) {
-	if e, ok := v.(cmdkit.Error); ok {
-		v = &e
-	}
-	if e, ok := v.(*cmdkit.Error); ok {
+	// a type switch only moves e to the heap if v is an error
+	switch e := v.(type) {
+	case cmdkit.Error:
+		panic(UnexpectedError{&e})
+	case *cmdkit.Error:
 		panic(UnexpectedError{e})
 	}
 }
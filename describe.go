@@ -0,0 +1,185 @@
+package cmds
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+)
+
+// CommandTree is the machine-readable description of a command and its
+// subcommands, see DescribeTree.
+type CommandTree struct {
+	// Name is the name of the command, "" for the root.
+	Name string `json:"name"`
+	// Path is the path of the command.
+	Path        []string `json:"path"`
+	Tagline     string   `json:"tagline,omitempty"`
+	Description string   `json:"description,omitempty"`
+
+	Arguments []ArgumentDescription `json:"arguments"`
+	// Options holds the options defined by the command. Commands also
+	// accept the options of their parents.
+	Options []OptionDescription `json:"options"`
+
+	// Streaming is whether the command emits a stream of values.
+	Streaming bool `json:"streaming"`
+	// Paginated is whether the command accepts the pagination options.
+	Paginated bool `json:"paginated"`
+	// Runnable is false for commands that only group subcommands.
+	Runnable    bool           `json:"runnable"`
+	Subcommands []*CommandTree `json:"subcommands"`
+}
+
+// ArgumentDescription describes an argument of a command. Kind is either
+// "string" or "file".
+type ArgumentDescription struct {
+	Name          string `json:"name"`
+	Kind          string `json:"kind"`
+	Required      bool   `json:"required"`
+	Variadic      bool   `json:"variadic"`
+	SupportsStdin bool   `json:"supportsStdin"`
+	Description   string `json:"description,omitempty"`
+}
+
+// OptionDescription describes an option of a command. Type is the kind of
+// its values, e.g. "string", "bool" or "int".
+type OptionDescription struct {
+	Names       []string    `json:"names"`
+	Type        string      `json:"type"`
+	Default     interface{} `json:"default,omitempty"`
+	Description string      `json:"description,omitempty"`
+}
+
+// DescribeArguments returns the descriptions of the arguments of cmd.
+func DescribeArguments(cmd *Command) []ArgumentDescription {
+	descs := make([]ArgumentDescription, 0, len(cmd.Arguments))
+	for _, arg := range cmd.Arguments {
+		kind := "string"
+		if arg.Type == cmdkit.ArgFile {
+			kind = "file"
+		}
+
+		descs = append(descs, ArgumentDescription{
+			Name:          arg.Name,
+			Kind:          kind,
+			Required:      arg.Required,
+			Variadic:      arg.Variadic,
+			SupportsStdin: arg.SupportsStdin,
+			Description:   arg.Description,
+		})
+	}
+	return descs
+}
+
+// DescribeOptions returns the descriptions of the options defined by cmds,
+// e.g. the chain of commands returned by Command.Resolve.
+func DescribeOptions(cmds ...*Command) []OptionDescription {
+	descs := []OptionDescription{}
+	for _, cmd := range cmds {
+		for _, opt := range cmd.Options {
+			descs = append(descs, OptionDescription{
+				Names:       opt.Names(),
+				Type:        fmt.Sprintf("%v", opt.Type()),
+				Default:     opt.Default(),
+				Description: opt.Description(),
+			})
+		}
+	}
+	return descs
+}
+
+// DescribeTree returns the description of root and its subcommands, sorted
+// by name. Hidden commands are left out.
+func DescribeTree(root *Command) *CommandTree {
+	return describeTree(root, "", []string{})
+}
+
+func describeTree(cmd *Command, name string, path []string) *CommandTree {
+	tree := &CommandTree{
+		Name:        name,
+		Path:        path,
+		Tagline:     cmd.Helptext.Tagline,
+		Description: cmd.Helptext.ShortDescription,
+		Arguments:   DescribeArguments(cmd),
+		Options:     DescribeOptions(cmd),
+		Streaming:   cmd.Streaming,
+		Paginated:   cmd.Paginated,
+		Runnable:    cmd.Run != nil,
+		Subcommands: []*CommandTree{},
+	}
+
+	names := make([]string, 0, len(cmd.Subcommands))
+	for name, sub := range cmd.Subcommands {
+		if !sub.Hidden {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		subPath := append(append([]string{}, path...), name)
+		tree.Subcommands = append(tree.Subcommands, describeTree(cmd.Subcommands[name], name, subPath))
+	}
+	return tree
+}
+
+// CommandsCmd returns a command emitting the description of the tree of
+// root, so tools can discover the API of an application and generate
+// bindings for it. Mounted as "commands" on root, it's served over HTTP as
+// <APIPath>/commands like any other command:
+//
+//	root.Subcommands["commands"] = cmds.CommandsCmd(root)
+//
+// The text output lists the paths of the runnable commands, one per line,
+// with their options if --flags is set.
+func CommandsCmd(root *Command) *Command {
+	return &Command{
+		Helptext: cmdkit.HelpText{
+			Tagline:          "List all available commands.",
+			ShortDescription: "Lists the commands with their arguments and options, e.g. to generate bindings for the API.",
+		},
+		Options: []cmdkit.Option{
+			cmdkit.BoolOption("flags", "f", "Show the options of the commands."),
+		},
+		Run: func(req *Request, re ResponseEmitter, env Environment) error {
+			return re.Emit(DescribeTree(root))
+		},
+		Encoders: EncoderMap{
+			Text: MakeTypedEncoder(func(req *Request, w io.Writer, tree *CommandTree) error {
+				flags, _ := req.Options["flags"].(bool)
+				return writeCommandTree(w, tree, flags)
+			}),
+		},
+		Type: CommandTree{},
+	}
+}
+
+func writeCommandTree(w io.Writer, tree *CommandTree, flags bool) error {
+	if tree.Runnable && len(tree.Path) > 0 {
+		line := strings.Join(tree.Path, " ")
+		if flags {
+			for _, opt := range tree.Options {
+				for _, name := range opt.Names {
+					if len(name) == 1 {
+						line += " -" + name
+					} else {
+						line += " --" + name
+					}
+				}
+			}
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+
+	for _, sub := range tree.Subcommands {
+		if err := writeCommandTree(w, sub, flags); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+)
+
+func TestDescribeTree(t *testing.T) {
+	run := func(req *Request, re ResponseEmitter, env Environment) error { return nil }
+	root := &Command{
+		Options: []cmdkit.Option{cmdkit.BoolOption("verbose", "v", "print more")},
+		Subcommands: map[string]*Command{
+			"files": {
+				Helptext: cmdkit.HelpText{Tagline: "manage files"},
+				Subcommands: map[string]*Command{
+					"rm": {Run: run, Arguments: []cmdkit.Argument{cmdkit.StringArg("path", true, true, "the paths")}},
+					"ls": {
+						Run:       run,
+						Paginated: true,
+						Options:   []cmdkit.Option{cmdkit.IntOption("depth", "d", "the depth").WithDefault(1)},
+					},
+				},
+			},
+			"add":    {Run: run, Streaming: true, Arguments: []cmdkit.Argument{cmdkit.FileArg("file", true, false, "the file")}},
+			"secret": {Run: run, Hidden: true},
+		},
+	}
+	root.Subcommands["commands"] = CommandsCmd(root)
+
+	tree := DescribeTree(root)
+	var names []string
+	for _, sub := range tree.Subcommands {
+		names = append(names, sub.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"add", "commands", "files"}) {
+		t.Fatalf("expected the sorted visible subcommands, got %v", names)
+	}
+
+	add, files := tree.Subcommands[0], tree.Subcommands[2]
+	if !add.Runnable || !add.Streaming || len(add.Arguments) != 1 || add.Arguments[0].Kind != "file" {
+		t.Errorf("unexpected description of add: %+v", add)
+	}
+	if files.Runnable || files.Tagline != "manage files" || len(files.Subcommands) != 2 {
+		t.Errorf("unexpected description of files: %+v", files)
+	}
+	ls := files.Subcommands[0]
+	if !reflect.DeepEqual(ls.Path, []string{"files", "ls"}) || !ls.Paginated {
+		t.Errorf("unexpected description of files ls: %+v", ls)
+	}
+	if len(ls.Options) != 1 || ls.Options[0].Type != "int" || ls.Options[0].Default != 1 {
+		t.Errorf("unexpected options of files ls: %+v", ls.Options)
+	}
+
+	for _, tc := range []struct {
+		flags    bool
+		expected string
+	}{
+		{false, "add\ncommands\nfiles ls\nfiles rm\n"},
+		{true, "add\ncommands --flags -f\nfiles ls --depth -d\nfiles rm\n"},
+	} {
+		req, err := NewRequest(context.Background(), []string{"commands"}, map[string]interface{}{"flags": tc.flags, EncLong: Text}, nil, nil, root)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		re, err := NewWriterResponseEmitter(wc{&buf, nopCloser{}}, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := NewExecutor(root).Execute(req, re, nil); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != tc.expected {
+			t.Errorf("flags %v: expected %q, got %q", tc.flags, tc.expected, buf.String())
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package cmds
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DiagnosticsEnv is the environment variable that enables the emitter
+// diagnostics with the default settings if it is set.
+const DiagnosticsEnv = "CMDS_EMITTER_DIAGNOSTICS"
+
+// DefaultBlockedEmitTimeout is the default EmitterDiagnostics.BlockedEmit.
+const DefaultBlockedEmitTimeout = 30 * time.Second
+
+// MisuseKind describes a kind of emitter misuse.
+type MisuseKind string
+
+const (
+	// MisuseNoEmit is reported if a command with a Type finished without
+	// error and without emitting a value.
+	MisuseNoEmit MisuseKind = "command finished without emitting a value"
+	// MisuseEmitAfterClose is reported if a value is emitted after the
+	// emitter was closed.
+	MisuseEmitAfterClose MisuseKind = "emit after close"
+	// MisuseDoubleClose is reported if a command closes its emitter twice.
+	MisuseDoubleClose MisuseKind = "emitter closed twice"
+	// MisuseBlockedEmit is reported if an Emit blocks for longer than
+	// EmitterDiagnostics.BlockedEmit, which usually means the response is
+	// never read.
+	MisuseBlockedEmit MisuseKind = "emit blocked, the response may never be read"
+)
+
+// EmitterMisuse is a misuse of an emitter found by the emitter diagnostics.
+type EmitterMisuse struct {
+	Kind MisuseKind
+	// Path is the path of the command.
+	Path []string
+	// Stack is the stack trace of the offending call.
+	Stack string
+	// Previous is the stack trace of the earlier call the offending call
+	// conflicts with, e.g. the first Close. It is empty for other misuses.
+	Previous string
+}
+
+func (m EmitterMisuse) String() string {
+	s := fmt.Sprintf("%s in command %q at:\n%s", m.Kind, strings.Join(m.Path, " "), m.Stack)
+	if m.Previous != "" {
+		s += "previously at:\n" + m.Previous
+	}
+	return s
+}
+
+// EmitterDiagnostics configure the emitter diagnostics mode, which wraps the
+// emitters passed to Run to report misuses by commands.
+type EmitterDiagnostics struct {
+	// Report is called with every misuse found. If nil, misuses are
+	// logged.
+	Report func(EmitterMisuse)
+	// BlockedEmit is the time an Emit may block before it is reported. It
+	// defaults to DefaultBlockedEmitTimeout.
+	BlockedEmit time.Duration
+}
+
+var diagnostics atomic.Pointer[EmitterDiagnostics]
+
+func init() {
+	if os.Getenv(DiagnosticsEnv) != "" {
+		EnableEmitterDiagnostics(EmitterDiagnostics{})
+	}
+}
+
+// EnableEmitterDiagnostics enables the emitter diagnostics for the commands
+// run afterwards. The checks slow down emitting, so they are meant for
+// development and tests.
+func EnableEmitterDiagnostics(d EmitterDiagnostics) {
+	if d.Report == nil {
+		d.Report = func(m EmitterMisuse) {
+			log.Error(m.String())
+		}
+	}
+	if d.BlockedEmit <= 0 {
+		d.BlockedEmit = DefaultBlockedEmitTimeout
+	}
+	diagnostics.Store(&d)
+}
+
+// DisableEmitterDiagnostics disables the emitter diagnostics.
+func DisableEmitterDiagnostics() {
+	diagnostics.Store(nil)
+}
+
+// diagnose wraps re with the emitter diagnostics if they are enabled. done
+// must be called with the error returned by Run.
+func diagnose(req *Request, re ResponseEmitter) (wrapped ResponseEmitter, done func(error)) {
+	d := diagnostics.Load()
+	if d == nil {
+		return re, func(error) {}
+	}
+
+	dre := &diagnosticEmitter{ResponseEmitter: re, d: d, req: req}
+	return dre, dre.done
+}
+
+type diagnosticEmitter struct {
+	ResponseEmitter
+	d   *EmitterDiagnostics
+	req *Request
+
+	l       sync.Mutex
+	emitted bool
+	// closedAt holds the call stack of the first Close, nil if the
+	// emitter is open.
+	closedAt []uintptr
+	// closedWithErr is whether the emitter was closed with an error.
+	closedWithErr bool
+}
+
+func (re *diagnosticEmitter) report(kind MisuseKind, stack, previous []uintptr) {
+	re.d.Report(EmitterMisuse{
+		Kind:     kind,
+		Path:     re.req.Path,
+		Stack:    formatStack(stack),
+		Previous: formatStack(previous),
+	})
+}
+
+// emitting records that the command emitted at stack, reporting emits after
+// the emitter was closed. The returned function must be called once the
+// emit returned, emits blocking longer are reported.
+func (re *diagnosticEmitter) emitting(stack []uintptr) (emitted func()) {
+	re.l.Lock()
+	closedAt := re.closedAt
+	re.emitted = true
+	re.l.Unlock()
+
+	if closedAt != nil {
+		re.report(MisuseEmitAfterClose, stack, closedAt)
+	}
+
+	timer := time.AfterFunc(re.d.BlockedEmit, func() {
+		re.report(MisuseBlockedEmit, stack, nil)
+	})
+	return func() { timer.Stop() }
+}
+
+func (re *diagnosticEmitter) Emit(v interface{}) error {
+	stack := callers()
+
+	emitted := re.emitting(stack)
+	err := re.ResponseEmitter.Emit(v)
+	emitted()
+
+	if _, ok := v.(Single); ok && err == nil {
+		re.l.Lock()
+		if re.closedAt == nil {
+			re.closedAt = stack
+		}
+		re.l.Unlock()
+	}
+
+	return err
+}
+
+func (re *diagnosticEmitter) EmitAll(vs []interface{}) error {
+	if len(vs) == 0 {
+		return EmitAll(re.ResponseEmitter, vs)
+	}
+
+	emitted := re.emitting(callers())
+	err := EmitAll(re.ResponseEmitter, vs)
+	emitted()
+	return err
+}
+
+func (re *diagnosticEmitter) TryEmit(v interface{}) (bool, error) {
+	re.l.Lock()
+	re.emitted = true
+	re.l.Unlock()
+
+	return TryEmit(re.ResponseEmitter, v)
+}
+
+func (re *diagnosticEmitter) Close() error {
+	return re.close(nil, callers())
+}
+
+func (re *diagnosticEmitter) CloseWithError(err error) error {
+	return re.close(err, callers())
+}
+
+func (re *diagnosticEmitter) close(err error, stack []uintptr) error {
+	re.l.Lock()
+	closedAt := re.closedAt
+	if closedAt == nil {
+		re.closedAt = stack
+		re.closedWithErr = err != nil
+	}
+	re.l.Unlock()
+
+	if closedAt != nil {
+		re.report(MisuseDoubleClose, stack, closedAt)
+	}
+
+	return re.ResponseEmitter.CloseWithError(err)
+}
+
+func (re *diagnosticEmitter) done(runErr error) {
+	re.l.Lock()
+	defer re.l.Unlock()
+
+	if runErr == nil && !re.emitted && !re.closedWithErr && re.req.Command != nil && re.req.Command.Type != nil {
+		stack := re.closedAt
+		if stack == nil {
+			stack = callers()
+		}
+		re.report(MisuseNoEmit, stack, nil)
+	}
+}
+
+// callers returns the call stack of the caller of the emitter method.
+func callers() []uintptr {
+	pcs := make([]uintptr, 32)
+	// skip runtime.Callers, callers and the emitter method
+	return pcs[:runtime.Callers(3, pcs)]
+}
+
+func formatStack(pcs []uintptr) string {
+	if len(pcs) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	frames := runtime.CallersFrames(pcs)
+	for {
+		f, more := frames.Next()
+		fmt.Fprintf(&b, "%s\n\t%s:%d\n", f.Function, f.File, f.Line)
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
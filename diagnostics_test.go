@@ -0,0 +1,116 @@
+package cmds
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEmitterDiagnostics(t *testing.T) {
+	var (
+		l       sync.Mutex
+		misuses []EmitterMisuse
+	)
+	EnableEmitterDiagnostics(EmitterDiagnostics{
+		Report: func(m EmitterMisuse) {
+			l.Lock()
+			defer l.Unlock()
+			misuses = append(misuses, m)
+		},
+		BlockedEmit: 10 * time.Millisecond,
+	})
+	defer DisableEmitterDiagnostics()
+
+	root := &Command{
+		Subcommands: map[string]*Command{
+			"noemit": {
+				Type: "",
+				Run: func(req *Request, re ResponseEmitter, env Environment) error {
+					return nil
+				},
+			},
+			"emitafterclose": {
+				Run: func(req *Request, re ResponseEmitter, env Environment) error {
+					re.Close()
+					re.Emit("value")
+					return nil
+				},
+			},
+			"doubleclose": {
+				Run: func(req *Request, re ResponseEmitter, env Environment) error {
+					re.Close()
+					return re.Close()
+				},
+			},
+			"blocked": {
+				Run: func(req *Request, re ResponseEmitter, env Environment) error {
+					return re.Emit("nobody reads this")
+				},
+			},
+			"fine": {
+				Type: "",
+				Run: func(req *Request, re ResponseEmitter, env Environment) error {
+					return re.Emit("value")
+				},
+			},
+			"batch": {
+				Type: "",
+				Run: func(req *Request, re ResponseEmitter, env Environment) error {
+					return EmitAll(re, []interface{}{"a", "b"})
+				},
+			},
+			"batchafterclose": {
+				Run: func(req *Request, re ResponseEmitter, env Environment) error {
+					re.Close()
+					EmitAll(re, []interface{}{"a"})
+					return nil
+				},
+			},
+		},
+	}
+
+	for path, expected := range map[string]MisuseKind{
+		"noemit":          MisuseNoEmit,
+		"emitafterclose":  MisuseEmitAfterClose,
+		"doubleclose":     MisuseDoubleClose,
+		"blocked":         MisuseBlockedEmit,
+		"fine":            "",
+		"batch":           "",
+		"batchafterclose": MisuseEmitAfterClose,
+	} {
+		misuses = nil
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		req, err := NewRequest(ctx, []string{path}, nil, nil, nil, root)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		re, res := NewChanResponsePair(req)
+		if path != "blocked" {
+			go ForEach(res, func(interface{}) error { return nil })
+		}
+		root.Call(req, re, nil)
+		cancel()
+
+		l.Lock()
+		switch {
+		case expected == "" && len(misuses) > 0:
+			t.Errorf("%s: unexpected misuses %v", path, misuses)
+		case expected != "" && (len(misuses) != 1 || misuses[0].Kind != expected):
+			t.Errorf("%s: expected misuse %q, got %v", path, expected, misuses)
+		case expected == MisuseEmitAfterClose || expected == MisuseDoubleClose:
+			if !strings.Contains(misuses[0].Previous, "TestEmitterDiagnostics") {
+				t.Errorf("%s: expected the stack of the first close, got:\n%s", path, misuses[0].Previous)
+			}
+			fallthrough
+		case expected != "":
+			if !strings.Contains(misuses[0].Stack, "TestEmitterDiagnostics") {
+				t.Errorf("%s: expected the stack of the offending call, got:\n%s", path, misuses[0].Stack)
+			}
+		}
+		l.Unlock()
+	}
+}
@@ -22,7 +22,9 @@
 	and Encoder may be defined that consumes the function's
 	emitted values and generates a visual representation for e.g.
 	the terminal. Encoders work on a value-by-value basis, while
-	PostRun operates on the value stream.
+	PostRun operates on the value stream. Encoders of single value
+	types, like a CSV encoder of the entries of a listing, are
+	registered in an EncoderRegistry.
 
 	Emitters
 
@@ -3,8 +3,10 @@ package cmds
 import (
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"github.com/ipfs/go-ipfs-cmdkit"
+	"github.com/ipfs/go-ipfs-cmds/cbor"
 	"io"
 	"reflect"
 )
@@ -36,9 +38,15 @@ const (
 	Protobuf    = "protobuf"
 	Text        = "text"
 	TextNewline = "textnl"
+	HTML        = "html"
+	CBOR        = "cbor"
 
 	// PostRunTypes
 	CLI = "cli"
+	// HTTP PostRuns are applied by the HTTP handler to the values the
+	// command emits before they are encoded, e.g. to convert them to the
+	// types sent over the wire.
+	HTTP = "http"
 )
 
 var Decoders = map[EncodingType]func(w io.Reader) Decoder{
@@ -48,6 +56,9 @@ var Decoders = map[EncodingType]func(w io.Reader) Decoder{
 	JSON: func(r io.Reader) Decoder {
 		return json.NewDecoder(r)
 	},
+	CBOR: func(r io.Reader) Decoder {
+		return cbor.NewDecoder(r)
+	},
 }
 
 type EncoderFunc func(req *Request) func(w io.Writer) Encoder
@@ -55,6 +66,9 @@ type EncoderMap map[EncodingType]EncoderFunc
 
 var Encoders = EncoderMap{
 	XML: func(req *Request) func(io.Writer) Encoder {
+		if root, ok := req.Options[XMLRootOpt].(string); ok && root != "" {
+			return func(w io.Writer) Encoder { return NewXMLDocumentEncoder(w, root) }
+		}
 		return func(w io.Writer) Encoder { return xml.NewEncoder(w) }
 	},
 	JSON: func(req *Request) func(io.Writer) Encoder {
@@ -66,6 +80,12 @@ var Encoders = EncoderMap{
 	TextNewline: func(req *Request) func(io.Writer) Encoder {
 		return func(w io.Writer) Encoder { return TextEncoder{w: w, suffix: "\n"} }
 	},
+	HTML: func(req *Request) func(io.Writer) Encoder {
+		return func(w io.Writer) Encoder { return HTMLEncoder{w: w} }
+	},
+	CBOR: func(req *Request) func(io.Writer) Encoder {
+		return func(w io.Writer) Encoder { return cbor.NewEncoder(w) }
+	},
 }
 
 func MakeEncoder(f func(*Request, io.Writer, interface{}) error) func(*Request) func(io.Writer) Encoder {
@@ -139,10 +159,101 @@ func (e TextEncoder) Encode(v interface{}) error {
 	return err
 }
 
+// StreamEncoder is implemented by values too large to be marshaled in memory
+// at once, e.g. huge directory listings or DAG dumps. Emitters let them write
+// their encoding incrementally to the output instead of passing them to the
+// Encoder. The output must be decodable like the regular encoding of the
+// value, so clients don't notice the difference.
+//
+// EncodeStream returns ErrStreamUnsupported for encodings the value can't
+// stream, the value is encoded with the Encoder then. Values are streamed
+// untagged, and commands with an Encoder of their own for the encoding, or
+// values with one in an EncoderRegistry, use that instead.
+type StreamEncoder interface {
+	EncodeStream(w io.Writer, encType EncodingType) error
+}
+
+// ErrStreamUnsupported is returned by StreamEncoders for encodings they can't
+// stream.
+var ErrStreamUnsupported = errors.New("the encoding can't be streamed")
+
+// StreamValue lets v write itself to w if it is a StreamEncoder that supports
+// encType and returns whether it did. Emitters encode the value with their
+// Encoder if it wasn't streamed. enc is the Encoder writing to w, whose
+// output written so far is flushed first.
+func StreamValue(req *Request, w io.Writer, enc Encoder, encType EncodingType, v interface{}) (bool, error) {
+	se, ok := v.(StreamEncoder)
+	if !ok {
+		return false, nil
+	}
+	if req.Command != nil {
+		if _, ok := req.Command.Encoders[encType]; ok {
+			return false, nil
+		}
+	}
+	if hasTypedEncoder(req, encType, v) {
+		return false, nil
+	}
+
+	if p, ok := enc.(streamPreparer); ok {
+		if err := p.prepareStream(); err != nil {
+			return true, err
+		}
+	}
+
+	err := se.EncodeStream(w, encType)
+	if err == ErrStreamUnsupported {
+		return false, nil
+	}
+	return true, err
+}
+
+// streamPreparer is implemented by encoders that write more than the encoded
+// values, e.g. the start tag of an XML document, which has to be written
+// before a value is streamed.
+type streamPreparer interface {
+	prepareStream() error
+}
+
+// CloseEncoder finishes the output of enc if it is an io.Closer, e.g. writes
+// the closing tag of an XML document. Emitters call it when they are closed,
+// unless an error was written in place of the output.
+func CloseEncoder(enc Encoder) error {
+	if c, ok := enc.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
 // GetEncoder takes a request and returns returns the encoding type and the encoder.
+// Values with an encoder in an EncoderRegistry are encoded with that one.
 func GetEncoder(req *Request, w io.Writer, def EncodingType) (encType EncodingType, enc Encoder, err error) {
 	encType = GetEncoding(req, def)
 
+	enc, err = getEncoder(req, w, encType)
+	if err != nil {
+		return encType, nil, err
+	}
+	if regs := registries(req, encType); len(regs) > 0 {
+		// without an encoder of their own, values fail to encode if the
+		// encoding only exists in the registries
+		return encType, newRegistryEncoder(req, w, encType, regs, enc), nil
+	}
+	if enc == nil {
+		return encType, nil, cmdkit.Errorf(cmdkit.ErrClient, "invalid encoding: %s", encType)
+	}
+	return encType, enc, nil
+}
+
+// getEncoder returns the encoder of the values of req without registries,
+// nil if encType isn't in Encoders or the encoders of the command.
+func getEncoder(req *Request, w io.Writer, encType EncodingType) (Encoder, error) {
+	if encType == Text {
+		if enc, err := textFormatEncoder(req, w); enc != nil || err != nil {
+			return enc, err
+		}
+	}
+
 	var (
 		fn EncoderFunc
 		ok bool
@@ -154,7 +265,7 @@ func GetEncoder(req *Request, w io.Writer, def EncodingType) (encType EncodingTy
 		fn, ok = Encoders[encType]
 	}
 	if !ok {
-		return encType, nil, cmdkit.Errorf(cmdkit.ErrClient, "invalid encoding: %s", encType)
+		return nil, nil
 	}
-	return encType, fn(req)(w), nil
+	return fn(req)(w), nil
 }
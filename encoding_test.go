@@ -2,7 +2,10 @@ package cmds
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"html/template"
 	"io"
 	"testing"
 )
@@ -80,3 +83,139 @@ func TestMakeTypedEncoderArrays(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestHTMLEncoder(t *testing.T) {
+	type tc struct {
+		v   interface{}
+		out string
+	}
+
+	tcs := []tc{
+		{
+			v:   "<b>hi</b>",
+			out: "<pre>&lt;b&gt;hi&lt;/b&gt;</pre>\n",
+		},
+		{
+			v:   &fooTestObj{true},
+			out: "<table>\n<tr><th>Field</th><th>Value</th></tr>\n<tr><td>Good</td><td>true</td></tr>\n</table>\n",
+		},
+		{
+			v:   []string{"a", "b"},
+			out: "<table>\n<tr><th>Value</th></tr>\n<tr><td>a</td></tr>\n<tr><td>b</td></tr>\n</table>\n",
+		},
+	}
+
+	for _, tc := range tcs {
+		buf := new(bytes.Buffer)
+		err := Encoders[HTML](&Request{})(buf).Encode(tc.v)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if buf.String() != tc.out {
+			t.Errorf("expected %q but got %q", tc.out, buf.String())
+		}
+	}
+}
+
+func TestMakeHTMLEncoder(t *testing.T) {
+	tmpl := template.Must(template.New("foo").Parse("<p>good: {{.Good}}</p>"))
+	enc := MakeHTMLEncoder(tmpl)(&Request{})
+
+	buf := new(bytes.Buffer)
+	if err := enc(buf).Encode(&fooTestObj{true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.String() != "<p>good: true</p>" {
+		t.Errorf("unexpected output %q", buf.String())
+	}
+}
+
+// streamedList streams its JSON encoding element by element.
+type streamedList []string
+
+func (l streamedList) EncodeStream(w io.Writer, encType EncodingType) error {
+	if encType != JSON {
+		return ErrStreamUnsupported
+	}
+
+	sep := "["
+	for _, s := range l {
+		data, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s%s", sep, data); err != nil {
+			return err
+		}
+		sep = ","
+	}
+	if sep == "[" {
+		_, err := io.WriteString(w, "[]\n")
+		return err
+	}
+	_, err := io.WriteString(w, "]\n")
+	return err
+}
+
+func TestStreamEncoder(t *testing.T) {
+	cmd := &Command{Type: []string{}}
+	for _, tc := range []struct {
+		enc      EncodingType
+		cmd      *Command
+		expected string
+	}{
+		{enc: JSON, cmd: cmd, expected: "[\"a\",\"b\"]\n"},
+		// encodings the value can't stream fall back to the Encoder
+		{enc: XML, cmd: cmd, expected: "<string>a</string><string>b</string>"},
+		// encoders of the command take precedence
+		{
+			enc: JSON,
+			cmd: &Command{Encoders: EncoderMap{
+				JSON: MakeEncoder(func(req *Request, w io.Writer, v interface{}) error {
+					_, err := io.WriteString(w, "custom")
+					return err
+				}),
+			}},
+			expected: "custom",
+		},
+	} {
+		req, err := NewRequest(context.Background(), nil, map[string]interface{}{EncLong: tc.enc}, nil, nil, tc.cmd)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		re, err := NewWriterResponseEmitter(wc{&buf, nopCloser{}}, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := re.Emit(streamedList{"a", "b"}); err != nil {
+			t.Fatal(err)
+		}
+		re.Close()
+
+		if buf.String() != tc.expected {
+			t.Errorf("%s: expected %q but got %q", tc.enc, tc.expected, buf.String())
+		}
+	}
+
+	// streamed values are written inside the root element of XML documents
+	var buf bytes.Buffer
+	enc := NewXMLDocumentEncoder(&buf, "List")
+	if _, err := StreamValue(&Request{}, &buf, enc, XML, xmlList{}); err != nil {
+		t.Fatal(err)
+	}
+	CloseEncoder(enc)
+	if buf.String() != "<List><item/></List>" {
+		t.Errorf("unexpected document %q", buf.String())
+	}
+}
+
+type xmlList struct{}
+
+func (xmlList) EncodeStream(w io.Writer, encType EncodingType) error {
+	_, err := io.WriteString(w, "<item/>")
+	return err
+}
@@ -0,0 +1,79 @@
+package cmds
+
+import (
+	"fmt"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+)
+
+// CodedError is an error identified by a machine-readable ID and a numeric
+// code, so clients and scripts can tell errors apart without parsing their
+// messages, which may be translated. The HTTP transport sends the ID and
+// the code along with the error, and the CLI exits with the code.
+type CodedError struct {
+	// ID identifies the kind of error, e.g. "not-found". It should not
+	// change between versions.
+	ID string
+	// Code is the exit code of the CLI. It should be in 3-125, codes 1 and
+	// 2 are used for errors without code and usage errors.
+	Code int
+	// Type is the type of the error sent as cmdkit.Error, e.g.
+	// cmdkit.ErrClient to answer HTTP requests with 400 Bad Request.
+	Type cmdkit.ErrorType
+
+	// Message is the untranslated message, a format for Args if they are
+	// set. The CLI translates it with its message catalogs.
+	Message string
+	Args    []interface{}
+}
+
+// Standard error IDs and codes. Applications can define more, the IDs and
+// codes of their errors should be unique.
+const (
+	NotFoundID         = "not-found"
+	PermissionDeniedID = "permission-denied"
+	InternalErrorID    = "internal"
+
+	NotFoundCode         = 3
+	PermissionDeniedCode = 4
+	InternalErrorCode    = 5
+)
+
+// NewCodedError returns a CodedError with the message format, args.
+func NewCodedError(id string, code int, typ cmdkit.ErrorType, format string, args ...interface{}) *CodedError {
+	return &CodedError{ID: id, Code: code, Type: typ, Message: format, Args: args}
+}
+
+// NotFoundError returns an error for things that don't exist.
+func NotFoundError(format string, args ...interface{}) *CodedError {
+	return NewCodedError(NotFoundID, NotFoundCode, cmdkit.ErrNotFound, format, args...)
+}
+
+// PermissionDeniedError returns an error for actions the user isn't allowed
+// to perform.
+func PermissionDeniedError(format string, args ...interface{}) *CodedError {
+	return NewCodedError(PermissionDeniedID, PermissionDeniedCode, cmdkit.ErrClient, format, args...)
+}
+
+// InternalError returns an error for bugs and failures that aren't caused
+// by the request.
+func InternalError(format string, args ...interface{}) *CodedError {
+	return NewCodedError(InternalErrorID, InternalErrorCode, cmdkit.ErrImplementation, format, args...)
+}
+
+func (e *CodedError) Error() string {
+	if len(e.Args) == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf(e.Message, e.Args...)
+}
+
+// ExitCode returns the exit code of the CLI, the Code.
+func (e *CodedError) ExitCode() int {
+	return e.Code
+}
+
+// CmdkitError returns the error as a cmdkit.Error, without ID and code.
+func (e *CodedError) CmdkitError() *cmdkit.Error {
+	return &cmdkit.Error{Message: e.Error(), Code: e.Type}
+}
@@ -0,0 +1,22 @@
+package cmds
+
+import (
+	"testing"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+)
+
+func TestCodedError(t *testing.T) {
+	e := NotFoundError("no pin for %s", "QmFoo")
+	if e.Error() != "no pin for QmFoo" || e.ID != NotFoundID || e.ExitCode() != NotFoundCode {
+		t.Errorf("unexpected error %#v", e)
+	}
+	if ke := e.CmdkitError(); ke.Message != "no pin for QmFoo" || ke.Code != cmdkit.ErrNotFound {
+		t.Errorf("unexpected cmdkit.Error %#v", ke)
+	}
+
+	// messages without arguments aren't formats
+	if e := PermissionDeniedError("100% read-only"); e.Error() != "100% read-only" {
+		t.Errorf("unexpected message %q", e.Error())
+	}
+}
@@ -0,0 +1,108 @@
+package cmds
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	"github.com/ipfs/go-ipfs-cmds/cbor"
+)
+
+// ErrorEnvelope renders errors in the format of an encoding and reads them
+// back. The envelope is used wherever an error is sent in place of or after
+// the output: as the body of a failed HTTP response, in the trailer of a
+// stream that failed midway and on the standard error of the CLI.
+type ErrorEnvelope struct {
+	Marshal   func(e *cmdkit.Error) ([]byte, error)
+	Unmarshal func(data []byte) (*cmdkit.Error, error)
+}
+
+// ErrorEnvelopes maps encodings to their error envelope. Replacing an entry
+// changes how errors are rendered for that encoding everywhere.
+var ErrorEnvelopes = map[EncodingType]ErrorEnvelope{
+	JSON: {
+		Marshal: func(e *cmdkit.Error) ([]byte, error) {
+			data, err := json.Marshal(e)
+			return append(data, '\n'), err
+		},
+		Unmarshal: func(data []byte) (*cmdkit.Error, error) {
+			e := new(cmdkit.Error)
+			return e, json.Unmarshal(data, e)
+		},
+	},
+	XML: {
+		Marshal: func(e *cmdkit.Error) ([]byte, error) {
+			return xml.Marshal(e)
+		},
+		Unmarshal: func(data []byte) (*cmdkit.Error, error) {
+			e := new(cmdkit.Error)
+			return e, xml.Unmarshal(data, e)
+		},
+	},
+	Text:        textErrorEnvelope,
+	TextNewline: textErrorEnvelope,
+	CBOR: {
+		Marshal:   marshalCBORError,
+		Unmarshal: unmarshalCBORError,
+	},
+}
+
+// textErrorEnvelope is the error message. The code isn't preserved, errors
+// read back have the code cmdkit.ErrNormal.
+var textErrorEnvelope = ErrorEnvelope{
+	Marshal: func(e *cmdkit.Error) ([]byte, error) {
+		return []byte(e.Message), nil
+	},
+	Unmarshal: func(data []byte) (*cmdkit.Error, error) {
+		return &cmdkit.Error{Message: strings.TrimSuffix(string(data), "\n"), Code: cmdkit.ErrNormal}, nil
+	},
+}
+
+// MarshalError renders e in the error envelope of encType. Errors are
+// rendered in JSON if encType has no envelope, the returned encoding type is
+// the one that was used.
+func MarshalError(encType EncodingType, e *cmdkit.Error) (EncodingType, []byte, error) {
+	env, ok := ErrorEnvelopes[encType]
+	if !ok {
+		encType = JSON
+		env = ErrorEnvelopes[JSON]
+	}
+
+	data, err := env.Marshal(e)
+	return encType, data, err
+}
+
+// UnmarshalError reads an error rendered by MarshalError in encType.
+func UnmarshalError(encType EncodingType, data []byte) (*cmdkit.Error, error) {
+	env, ok := ErrorEnvelopes[encType]
+	if !ok {
+		return nil, fmt.Errorf("no error envelope for encoding %q", encType)
+	}
+	return env.Unmarshal(data)
+}
+
+// cborError is the CBOR error envelope, a map with the same fields as the
+// JSON envelope.
+type cborError struct {
+	Message string
+	Code    cmdkit.ErrorType
+	Type    string
+}
+
+func marshalCBORError(e *cmdkit.Error) ([]byte, error) {
+	return cbor.Marshal(cborError{Message: e.Message, Code: e.Code, Type: "error"})
+}
+
+func unmarshalCBORError(data []byte) (*cmdkit.Error, error) {
+	var ce cborError
+	if err := cbor.Unmarshal(data, &ce); err != nil {
+		return nil, err
+	}
+	if ce.Type != "error" {
+		return nil, errors.New("not of type error")
+	}
+	return &cmdkit.Error{Message: ce.Message, Code: ce.Code}, nil
+}
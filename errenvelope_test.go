@@ -0,0 +1,70 @@
+package cmds
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+)
+
+func TestErrorEnvelopes(t *testing.T) {
+	e := &cmdkit.Error{Message: "not <found> & \"gone\"", Code: cmdkit.ErrNotFound}
+
+	for _, encType := range []EncodingType{JSON, XML, CBOR, Text, TextNewline} {
+		used, data, err := MarshalError(encType, e)
+		if err != nil {
+			t.Fatalf("%s: %s", encType, err)
+		}
+		if used != encType {
+			t.Errorf("%s: expected the error in its own envelope, got %s", encType, used)
+		}
+
+		decoded, err := UnmarshalError(encType, data)
+		if err != nil {
+			t.Fatalf("%s: %s", encType, err)
+		}
+		if decoded.Message != e.Message {
+			t.Errorf("%s: expected message %q but got %q", encType, e.Message, decoded.Message)
+		}
+		// text doesn't preserve the code
+		if encType != Text && encType != TextNewline && decoded.Code != e.Code {
+			t.Errorf("%s: expected code %d but got %d", encType, e.Code, decoded.Code)
+		}
+	}
+
+	used, data, err := MarshalError(HTML, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used != JSON || !bytes.HasPrefix(data, []byte("{")) {
+		t.Errorf("expected encodings without envelope to fall back to JSON, got %s %q", used, data)
+	}
+}
+
+func TestCBORErrorEnvelope(t *testing.T) {
+	long := strings.Repeat("x", 300)
+	_, data, err := MarshalError(CBOR, &cmdkit.Error{Message: long, Code: cmdkit.ErrClient})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a map of three pairs, the first key is the text "Message"
+	if !bytes.HasPrefix(data, []byte("\xa3\x67Message\x79\x01\x2c")) {
+		t.Errorf("unexpected encoding %x", data)
+	}
+
+	e, err := UnmarshalError(CBOR, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Message != long || e.Code != cmdkit.ErrClient {
+		t.Errorf("unexpected error %+v", e)
+	}
+
+	for _, bad := range [][]byte{nil, {0xa3}, data[:len(data)-1], {0x80}} {
+		if _, err := UnmarshalError(CBOR, bad); err == nil {
+			t.Errorf("expected an error for %x", bad)
+		}
+	}
+}
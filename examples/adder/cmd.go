@@ -23,6 +23,9 @@ type AddStatus struct {
 
 // Define the root of the commands
 var RootCmd = &cmds.Command{
+	Options: []cmdkit.Option{
+		cmds.OptionWidth,
+	},
 	Subcommands: map[string]*cmds.Command{
 		// the simplest way to make an adder
 		"simpleAdd": &cmds.Command{
@@ -0,0 +1,100 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// ExecuteToChan executes req locally and delivers the emitted values on the
+// returned value channel, converted to T. Values emitted as *T are
+// dereferenced.
+//
+// The error channel receives at most one error (the error the command was
+// closed with, a conversion error or ctx.Err()) and is closed once the value
+// channel has been closed.
+func ExecuteToChan[T any](ctx context.Context, req *Request, env Environment) (<-chan T, <-chan error) {
+	out := make(chan T)
+	errCh := make(chan error, 1)
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	// don't modify the caller's request
+	r := *req
+	req = &r
+	if req.Context == nil {
+		req.Context = ctx
+	}
+
+	// stop the command when we stop reading or ctx is canceled
+	var cancel func()
+	req.Context, cancel = context.WithCancel(req.Context)
+	runCtx := req.Context
+	go func() {
+		select {
+		case <-ctx.Done():
+			cancel()
+		case <-runCtx.Done():
+		}
+	}()
+
+	re, res := NewChanResponsePair(req)
+
+	go func() {
+		err := NewExecutor(req.Root).Execute(req, re, env)
+		if err != nil {
+			// make sure Next returns the error if Execute failed before Run
+			re.CloseWithError(err)
+		}
+	}()
+
+	go func() {
+		defer close(errCh)
+		defer close(out)
+		defer cancel()
+
+		for {
+			v, err := res.Next()
+			if err != nil {
+				if ctx.Err() != nil {
+					errCh <- ctx.Err()
+				} else if err != io.EOF {
+					errCh <- err
+				}
+				return
+			}
+
+			tv, err := convertValue[T](v)
+			if err != nil {
+				errCh <- err
+				return
+			}
+
+			select {
+			case out <- tv:
+			case <-ctx.Done():
+				errCh <- ctx.Err()
+				return
+			}
+		}
+	}()
+
+	return out, errCh
+}
+
+// convertValue asserts that v is of type T or *T and returns it as T.
+func convertValue[T any](v interface{}) (T, error) {
+	switch tv := v.(type) {
+	case T:
+		return tv, nil
+	case *T:
+		if tv != nil {
+			return *tv, nil
+		}
+	}
+
+	var zero T
+	return zero, fmt.Errorf("unexpected type %T, expected %T", v, zero)
+}
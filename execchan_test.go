@@ -0,0 +1,108 @@
+package cmds
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestExecuteToChan(t *testing.T) {
+	e := env(42)
+	req, err := NewRequest(context.Background(), []string{"test"}, nil, nil, nil, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, errCh := ExecuteToChan[env](context.Background(), req, &e)
+
+	var vs []env
+	for v := range out {
+		vs = append(vs, v)
+	}
+
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+
+	if len(vs) != 1 || vs[0] != 42 {
+		t.Fatalf("expected [42] but got %v", vs)
+	}
+}
+
+func TestExecuteToChanError(t *testing.T) {
+	e := env(42)
+	req, err := NewRequest(context.Background(), []string{"testError"}, nil, nil, nil, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, errCh := ExecuteToChan[env](context.Background(), req, &e)
+	for v := range out {
+		t.Errorf("unexpected value %v", v)
+	}
+
+	err = <-errCh
+	if err == nil || err.Error() != theError.Error() {
+		t.Fatalf("expected error %q but got %v", theError, err)
+	}
+}
+
+func TestExecuteToChanWrongType(t *testing.T) {
+	e := env(42)
+	req, err := NewRequest(context.Background(), []string{"test"}, nil, nil, nil, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, errCh := ExecuteToChan[string](context.Background(), req, &e)
+	for v := range out {
+		t.Errorf("unexpected value %v", v)
+	}
+
+	if err := <-errCh; err == nil {
+		t.Fatal("expected conversion error but got nil")
+	}
+}
+
+func TestExecuteToChanCancel(t *testing.T) {
+	started := make(chan struct{})
+	blockRoot := &Command{
+		Subcommands: map[string]*Command{
+			"block": &Command{
+				Run: func(req *Request, re ResponseEmitter, env Environment) error {
+					close(started)
+					<-req.Context.Done()
+					return req.Context.Err()
+				},
+			},
+		},
+	}
+
+	req, err := NewRequest(context.Background(), []string{"block"}, nil, nil, nil, blockRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reqCtx := req.Context
+
+	ctx, cancel := context.WithCancel(context.Background())
+	out, errCh := ExecuteToChan[string](ctx, req, nil)
+
+	<-started
+	cancel()
+
+	select {
+	case err := <-errCh:
+		if err != context.Canceled {
+			t.Fatalf("expected %v but got %v", context.Canceled, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("command was not canceled")
+	}
+
+	if _, ok := <-out; ok {
+		t.Error("expected value channel to be closed")
+	}
+	if req.Context != reqCtx {
+		t.Error("the request passed in was modified")
+	}
+}
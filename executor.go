@@ -2,6 +2,7 @@ package cmds
 
 import (
 	"context"
+	"fmt"
 	"runtime/debug"
 )
 
@@ -33,6 +34,47 @@ func NewExecutor(root *Command) Executor {
 	}
 }
 
+// EnvironmentCloser is implemented by environments made for a single
+// request that hold request-scoped resources, e.g. a database transaction or
+// a session. Frontends making an environment per request call Close once the
+// command finished and its emitter was closed, even if the command panicked.
+type EnvironmentCloser interface {
+	Close()
+}
+
+// CloseEnvironment closes env if it is an EnvironmentCloser.
+func CloseEnvironment(env Environment) {
+	if c, ok := env.(EnvironmentCloser); ok {
+		c.Close()
+	}
+}
+
+// NewEnvironmentExecutor returns an Executor like NewExecutor that runs every
+// request in a new environment made by makeEnv instead of the environment
+// passed to Execute. The environment is closed once the command finished,
+// see EnvironmentCloser.
+func NewEnvironmentExecutor(root *Command, makeEnv MakeEnvironment) Executor {
+	return &envExecutor{
+		Executor: NewExecutor(root),
+		makeEnv:  makeEnv,
+	}
+}
+
+type envExecutor struct {
+	Executor
+	makeEnv MakeEnvironment
+}
+
+func (x *envExecutor) Execute(req *Request, re ResponseEmitter, _ Environment) error {
+	env, err := x.makeEnv(req.Context, req)
+	if err != nil {
+		return err
+	}
+	defer CloseEnvironment(env)
+
+	return x.Executor.Execute(req, re, env)
+}
+
 type executor struct {
 	root *Command
 }
@@ -49,6 +91,11 @@ func (x *executor) Execute(req *Request, re ResponseEmitter, env Environment) (e
 		return err
 	}
 
+	page, err := requestPage(req)
+	if err != nil {
+		return err
+	}
+
 	if cmd.PreRun != nil {
 		err = cmd.PreRun(req, env)
 		if err != nil {
@@ -94,10 +141,15 @@ func (x *executor) Execute(req *Request, re ResponseEmitter, env Environment) (e
 		close(errCh)
 	}
 
+	var span Span
+	req.Context, span = StartSpan(req.Context, RunSpan)
+	span.SetPath(req.Path)
+
 	defer func() {
 		// catch panics in Run (esp. from re.SetError)
 		if v := recover(); v != nil {
 			log.Errorf("panic in command handler at %s", debug.Stack())
+			span.End(fmt.Errorf("panic: %v", v))
 
 			// if they are errors
 			if err, ok := v.(error); ok {
@@ -121,7 +173,10 @@ func (x *executor) Execute(req *Request, re ResponseEmitter, env Environment) (e
 			<-errCh
 		}
 	}()
-	err = cmd.Run(req, re, env)
+	runRe, done := diagnose(req, paginate(req, re, page))
+	err = pageEndErr(cmd.Run(req, runRe, env))
+	span.End(err)
+	done(err)
 	err = re.CloseWithError(err)
 	if err == ErrClosingClosedEmitter {
 		// ignore double close errors
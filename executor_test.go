@@ -84,3 +84,43 @@ func TestExecutorError(t *testing.T) {
 		t.Fatalf("expected error message %q but got: %s", expErr, err)
 	}
 }
+
+type closingEnv struct {
+	env
+	closed bool
+}
+
+func (e *closingEnv) Close() {
+	e.closed = true
+}
+
+func TestEnvironmentExecutor(t *testing.T) {
+	var made *closingEnv
+	x := NewEnvironmentExecutor(root, func(ctx context.Context, req *Request) (Environment, error) {
+		made = &closingEnv{env: 23}
+		return made, nil
+	})
+
+	req, err := NewRequest(context.Background(), []string{"test"}, nil, nil, nil, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	re, res := NewChanResponsePair(req)
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- x.Execute(req, re, nil) }()
+
+	v, err := res.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != Environment(made) {
+		t.Errorf("expected the command to run in the new environment, got %v", v)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+	if !made.closed {
+		t.Error("expected the environment to be closed")
+	}
+}
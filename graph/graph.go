@@ -0,0 +1,205 @@
+/*
+Package graph exports command trees as graphs, for documentation and
+architecture reviews. Graphs are written in the Graphviz DOT language or as
+mermaid flowcharts, with every command annotated with its arguments and
+options:
+
+	graph.Write(os.Stdout, graph.DOT, "ipfs", root)
+
+Command returns a hidden command writing the graph of the tree it is
+added to, so the graph can be exported from the application itself:
+
+	root.Subcommands["commands-graph"] = graph.Command("ipfs")
+*/
+package graph
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+// Format is a graph format.
+type Format string
+
+// Supported Format constants.
+const (
+	DOT     Format = "dot"
+	Mermaid Format = "mermaid"
+)
+
+const formatOpt = "format"
+
+// node is a command in the graph.
+type node struct {
+	// path is the full command line of the command, e.g. "ipfs add".
+	path   string
+	name   string
+	parent int
+	// lines annotate the command with its arguments and options.
+	lines []string
+}
+
+// nodes returns the commands of the tree in depth-first order, with the
+// subcommands sorted by name. The root has no parent.
+func nodes(rootName string, root *cmds.Command) []node {
+	var ns []node
+
+	var visit func(path, name string, parent int, cmd *cmds.Command)
+	visit = func(path, name string, parent int, cmd *cmds.Command) {
+		ns = append(ns, node{path: path, name: name, parent: parent, lines: annotations(cmd)})
+		self := len(ns) - 1
+
+		names := make([]string, 0, len(cmd.Subcommands))
+		for name := range cmd.Subcommands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			visit(path+" "+name, name, self, cmd.Subcommands[name])
+		}
+	}
+	visit(rootName, rootName, -1, root)
+
+	return ns
+}
+
+// annotations describes the arguments and options of cmd, one per line.
+func annotations(cmd *cmds.Command) []string {
+	var lines []string
+	for _, arg := range cmd.Arguments {
+		s := "<" + arg.Name + ">"
+		if arg.Type == cmdkit.ArgFile {
+			s = "<" + arg.Name + " (file)>"
+		}
+		if arg.Variadic {
+			s += "..."
+		}
+		if !arg.Required {
+			s = "[" + s + "]"
+		}
+		lines = append(lines, s)
+	}
+
+	for _, opt := range cmd.Options {
+		names := opt.Names()
+		flags := make([]string, len(names))
+		for i, name := range names {
+			if len(name) == 1 {
+				flags[i] = "-" + name
+			} else {
+				flags[i] = "--" + name
+			}
+		}
+		lines = append(lines, fmt.Sprintf("%s (%v)", strings.Join(flags, ", "), opt.Type()))
+	}
+
+	return lines
+}
+
+// Write writes the graph of root in format to w. rootName is the name
+// of the root command, e.g. the name of the application.
+func Write(w io.Writer, format Format, rootName string, root *cmds.Command) error {
+	switch format {
+	case DOT:
+		return WriteDOT(w, rootName, root)
+	case Mermaid:
+		return WriteMermaid(w, rootName, root)
+	default:
+		return fmt.Errorf("unknown graph format: %s", format)
+	}
+}
+
+// WriteDOT writes the graph of root in the Graphviz DOT language to w.
+func WriteDOT(w io.Writer, rootName string, root *cmds.Command) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "digraph %s {\n", dotQuote(rootName))
+	fmt.Fprintf(&b, "\tnode [shape=box];\n")
+
+	ns := nodes(rootName, root)
+	for _, n := range ns {
+		label := dotEscape(n.name) + `\n`
+		for _, line := range n.lines {
+			label += dotEscape(line) + `\l`
+		}
+		fmt.Fprintf(&b, "\t%s [label=\"%s\"];\n", dotQuote(n.path), label)
+	}
+	for _, n := range ns {
+		if n.parent >= 0 {
+			fmt.Fprintf(&b, "\t%s -> %s;\n", dotQuote(ns[n.parent].path), dotQuote(n.path))
+		}
+	}
+
+	b.WriteString("}\n")
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func dotEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+func dotQuote(s string) string {
+	return `"` + dotEscape(s) + `"`
+}
+
+// WriteMermaid writes the graph of root as a mermaid flowchart to w.
+func WriteMermaid(w io.Writer, rootName string, root *cmds.Command) error {
+	var b bytes.Buffer
+	b.WriteString("flowchart LR\n")
+
+	ns := nodes(rootName, root)
+	for i, n := range ns {
+		label := mermaidEscape(n.name)
+		for _, line := range n.lines {
+			label += "<br/>" + mermaidEscape(line)
+		}
+		fmt.Fprintf(&b, "\tn%d[\"%s\"]\n", i, label)
+	}
+	for i, n := range ns {
+		if n.parent >= 0 {
+			fmt.Fprintf(&b, "\tn%d --> n%d\n", n.parent, i)
+		}
+	}
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func mermaidEscape(s string) string {
+	return strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;").Replace(s)
+}
+
+// Command returns a hidden command writing the graph of the command tree it
+// is called in, in the format given by its --format option. rootName is the
+// name of the root command.
+func Command(rootName string) *cmds.Command {
+	return &cmds.Command{
+		Hidden: true,
+		Helptext: cmdkit.HelpText{
+			Tagline: "Export the command tree as a graph.",
+			ShortDescription: `
+Writes the command tree with the arguments and options of every command as a
+Graphviz DOT graph or a mermaid flowchart.
+`,
+		},
+		Options: []cmdkit.Option{
+			cmdkit.StringOption(formatOpt, "The graph format, dot or mermaid").WithDefault(string(DOT)),
+		},
+		Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+			format, _ := req.Options[formatOpt].(string)
+
+			var buf bytes.Buffer
+			if err := Write(&buf, Format(format), rootName, req.Root); err != nil {
+				return cmds.ClientError(err.Error())
+			}
+			return re.Emit(&buf)
+		},
+	}
+}
@@ -0,0 +1,97 @@
+package graph
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+var root = &cmds.Command{
+	Subcommands: map[string]*cmds.Command{
+		"add": {
+			Arguments: []cmdkit.Argument{
+				cmdkit.FileArg("path", true, true, "The files to add"),
+			},
+			Options: []cmdkit.Option{
+				cmdkit.BoolOption("recursive", "r", "Add directories"),
+			},
+		},
+		"cat": {
+			Arguments: []cmdkit.Argument{
+				cmdkit.StringArg("ref", false, false, `The "ref"`),
+			},
+		},
+	},
+}
+
+func TestWriteDOT(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteDOT(&buf, "app", root); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{
+		`"app" [label="app\n"];`,
+		`"app add" [label="add\n<path (file)>...\l--recursive, -r (bool)\l"];`,
+		`"app cat" [label="cat\n[<ref>]\l"];`,
+		`"app" -> "app add";`,
+		`"app" -> "app cat";`,
+	} {
+		if !strings.Contains(buf.String(), "\t"+line+"\n") {
+			t.Errorf("expected line %q in:\n%s", line, buf.String())
+		}
+	}
+}
+
+func TestWriteMermaid(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteMermaid(&buf, "app", root); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `flowchart LR
+	n0["app"]
+	n1["add<br/>#lt;path (file)#gt;...<br/>--recursive, -r (bool)"]
+	n2["cat<br/>[#lt;ref#gt;]"]
+	n0 --> n1
+	n0 --> n2
+`
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestCommand(t *testing.T) {
+	tree := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"graph": Command("app"),
+		},
+	}
+
+	req, err := cmds.NewRequest(context.Background(), []string{"graph"}, map[string]interface{}{
+		formatOpt: string(Mermaid),
+	}, nil, nil, tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	re, res := cmds.NewChanResponsePair(req)
+	go tree.Call(req, re, nil)
+
+	v, err := res.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadAll(v.(*bytes.Buffer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), `n1["graph<br/>--format (string)"]`) {
+		t.Errorf("unexpected graph:\n%s", out)
+	}
+}
@@ -0,0 +1,101 @@
+package cmds
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"reflect"
+	"sort"
+)
+
+// defaultHTMLTemplate renders values for which no per-command template has
+// been registered. Structs, maps and slices are rendered as tables, all other
+// values in a <pre> block.
+var defaultHTMLTemplate = template.Must(template.New("value").Parse(
+	`{{if .Header}}<table>
+<tr>{{range .Header}}<th>{{.}}</th>{{end}}</tr>
+{{range .Rows}}<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</table>
+{{else}}<pre>{{.Text}}</pre>
+{{end}}`))
+
+type htmlTable struct {
+	Header []string
+	Rows   [][]string
+	Text   string
+}
+
+// HTMLEncoder renders values as HTML fragments, using a table layout for
+// structs, maps and slices and a <pre> block for everything else.
+type HTMLEncoder struct {
+	w io.Writer
+}
+
+// Encode writes the HTML representation of v.
+func (e HTMLEncoder) Encode(v interface{}) error {
+	return defaultHTMLTemplate.Execute(e.w, makeHTMLTable(v))
+}
+
+// MakeHTMLEncoder returns an encoder that renders each emitted value using
+// tmpl. The template is executed with the emitted value as its data.
+// Use it in a Command's Encoders map under the HTML key to give the command
+// its own web page layout.
+func MakeHTMLEncoder(tmpl *template.Template) func(*Request) func(io.Writer) Encoder {
+	return MakeEncoder(func(req *Request, w io.Writer, v interface{}) error {
+		return tmpl.Execute(w, v)
+	})
+}
+
+func makeHTMLTable(v interface{}) htmlTable {
+	val := reflect.ValueOf(v)
+	for val.Kind() == reflect.Ptr || val.Kind() == reflect.Interface {
+		if val.IsNil() {
+			return htmlTable{}
+		}
+		val = val.Elem()
+	}
+
+	if !val.IsValid() {
+		return htmlTable{}
+	}
+
+	switch val.Kind() {
+	case reflect.Struct:
+		var t htmlTable
+		t.Header = []string{"Field", "Value"}
+		for i := 0; i < val.NumField(); i++ {
+			f := val.Type().Field(i)
+			if f.PkgPath != "" {
+				// unexported
+				continue
+			}
+			t.Rows = append(t.Rows, []string{f.Name, fmt.Sprint(val.Field(i).Interface())})
+		}
+		return t
+	case reflect.Map:
+		var t htmlTable
+		t.Header = []string{"Key", "Value"}
+		for _, k := range val.MapKeys() {
+			t.Rows = append(t.Rows, []string{fmt.Sprint(k.Interface()), fmt.Sprint(val.MapIndex(k).Interface())})
+		}
+		// map iteration order is random
+		sort.Slice(t.Rows, func(i, j int) bool { return t.Rows[i][0] < t.Rows[j][0] })
+		return t
+	case reflect.Slice, reflect.Array:
+		if val.Kind() == reflect.Slice && val.Type().Elem().Kind() == reflect.Uint8 {
+			// []byte
+			break
+		}
+		var t htmlTable
+		t.Header = []string{"Value"}
+		for i := 0; i < val.Len(); i++ {
+			t.Rows = append(t.Rows, []string{fmt.Sprint(val.Index(i).Interface())})
+		}
+		return t
+	}
+
+	if b, ok := val.Interface().([]byte); ok {
+		return htmlTable{Text: string(b)}
+	}
+	return htmlTable{Text: fmt.Sprint(val.Interface())}
+}
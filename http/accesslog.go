@@ -0,0 +1,147 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AccessLogEntry describes a request served by the handler.
+type AccessLogEntry struct {
+	Time       time.Time
+	RemoteAddr string
+	Method     string
+	// URI is the request URI as sent by the client.
+	URI   string
+	Proto string
+	// Command is the path of the requested command, e.g. "pin add".
+	Command   string
+	Status    int
+	Bytes     int64
+	Duration  time.Duration
+	Referer   string
+	UserAgent string
+}
+
+// AccessLogger is called with the entry of every request served by the
+// handler, see ServerConfig.AccessLog.
+type AccessLogger func(AccessLogEntry)
+
+// CombinedAccessLog returns an AccessLogger writing the entries to w in the
+// combined log format used by Apache and nginx, followed by the duration of
+// the request.
+func CombinedAccessLog(w io.Writer) AccessLogger {
+	var l sync.Mutex
+	return func(e AccessLogEntry) {
+		host, _, err := net.SplitHostPort(e.RemoteAddr)
+		if err != nil {
+			host = e.RemoteAddr
+		}
+
+		l.Lock()
+		defer l.Unlock()
+		fmt.Fprintf(w, "%s - - [%s] %q %d %d %q %q %s\n",
+			host, e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+			e.Method+" "+e.URI+" "+e.Proto, e.Status, e.Bytes,
+			e.Referer, e.UserAgent, e.Duration)
+	}
+}
+
+// JSONAccessLog returns an AccessLogger writing the entries to w as JSON
+// objects, one per line.
+func JSONAccessLog(w io.Writer) AccessLogger {
+	var l sync.Mutex
+	enc := json.NewEncoder(w)
+	return func(e AccessLogEntry) {
+		l.Lock()
+		defer l.Unlock()
+		err := enc.Encode(struct {
+			Time       time.Time `json:"time"`
+			RemoteAddr string    `json:"remote_addr"`
+			Method     string    `json:"method"`
+			URI        string    `json:"uri"`
+			Proto      string    `json:"proto"`
+			Command    string    `json:"command"`
+			Status     int       `json:"status"`
+			Bytes      int64     `json:"bytes"`
+			Duration   float64   `json:"duration"`
+			Referer    string    `json:"referer,omitempty"`
+			UserAgent  string    `json:"user_agent,omitempty"`
+		}{
+			e.Time, e.RemoteAddr, e.Method, e.URI, e.Proto, e.Command,
+			e.Status, e.Bytes, e.Duration.Seconds(), e.Referer, e.UserAgent,
+		})
+		if err != nil {
+			log.Errorf("failed to write access log: %s", err)
+		}
+	}
+}
+
+func newAccessLogHandler(logger AccessLogger, apiPath string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e := AccessLogEntry{
+			Time:       time.Now(),
+			RemoteAddr: r.RemoteAddr,
+			Method:     r.Method,
+			URI:        r.RequestURI,
+			Proto:      r.Proto,
+			Referer:    r.Referer(),
+			UserAgent:  r.UserAgent(),
+		}
+		if strings.HasPrefix(r.URL.Path, apiPath) {
+			e.Command = strings.Join(strings.FieldsFunc(strings.TrimPrefix(r.URL.Path, apiPath), func(c rune) bool {
+				return c == '/'
+			}), " ")
+		}
+
+		lw := &accessLogWriter{ResponseWriter: w}
+		defer func() {
+			e.Status = lw.status
+			if e.Status == 0 {
+				e.Status = http.StatusOK
+			}
+			e.Bytes = lw.bytes
+			e.Duration = time.Since(e.Time)
+			logger(e)
+		}()
+
+		next.ServeHTTP(lw, r)
+	})
+}
+
+// accessLogWriter records the status and size of a response.
+type accessLogWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *accessLogWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *accessLogWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *accessLogWriter) Flush() {
+	flush(w.ResponseWriter)
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController.
+func (w *accessLogWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
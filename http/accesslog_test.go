@@ -0,0 +1,92 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccessLog(t *testing.T) {
+	env := testEnv{
+		version:     "0.1.2",
+		commit:      "c0mm17",
+		repoVersion: "4",
+		rootCtx:     context.Background(),
+		t:           t,
+		wait:        make(chan struct{}),
+	}
+
+	var entries []AccessLogEntry
+	cfg := originCfg(defaultOrigins)
+	cfg.APIPath = "/api/v0"
+	cfg.AccessLog = func(e AccessLogEntry) {
+		entries = append(entries, e)
+	}
+
+	h := NewHandler(env, cmdRoot, cfg)
+
+	for _, path := range []string{"/api/v0/version", "/api/v0/error", "/other"} {
+		r := httptest.NewRequest("POST", path, nil)
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries but got %d", len(entries))
+	}
+
+	type expect struct {
+		command string
+		status  int
+	}
+	for i, ex := range []expect{
+		{"version", http.StatusOK},
+		{"error", http.StatusInternalServerError},
+		{"", http.StatusNotFound},
+	} {
+		e := entries[i]
+		if e.Command != ex.command || e.Status != ex.status {
+			t.Errorf("entry %d: expected command %q and status %d but got %q and %d",
+				i, ex.command, ex.status, e.Command, e.Status)
+		}
+		if e.Bytes == 0 {
+			t.Errorf("entry %d: expected the body size to be recorded", i)
+		}
+	}
+}
+
+func TestAccessLogFormats(t *testing.T) {
+	e := AccessLogEntry{
+		Time:       time.Date(2018, 10, 4, 13, 55, 36, 0, time.UTC),
+		RemoteAddr: "127.0.0.1:4001",
+		Method:     "POST",
+		URI:        "/api/v0/pin/add?arg=foo",
+		Proto:      "HTTP/1.1",
+		Command:    "pin add",
+		Status:     200,
+		Bytes:      42,
+		Duration:   1500 * time.Millisecond,
+		UserAgent:  "go-ipfs-cmds/http",
+	}
+
+	var buf bytes.Buffer
+	CombinedAccessLog(&buf)(e)
+	expected := `127.0.0.1 - - [04/Oct/2018:13:55:36 +0000] "POST /api/v0/pin/add?arg=foo HTTP/1.1" 200 42 "" "go-ipfs-cmds/http" 1.5s` + "\n"
+	if buf.String() != expected {
+		t.Errorf("expected combined log line\n%s\nbut got\n%s", expected, buf.String())
+	}
+
+	buf.Reset()
+	JSONAccessLog(&buf)(e)
+	var v map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v["command"] != "pin add" || v["status"] != float64(200) || v["duration"] != 1.5 {
+		t.Errorf("unexpected JSON log line %s", strings.TrimSpace(buf.String()))
+	}
+}
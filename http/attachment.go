@@ -0,0 +1,120 @@
+package http
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/textproto"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+const (
+	multipartMixed = "multipart/mixed"
+
+	// attachmentHeader is set on the value parts of a multipart response
+	// followed by the part holding the data attached to the value.
+	attachmentHeader = "X-Attachment"
+
+	contentDispAttachment = "attachment"
+)
+
+// errAttachmentNotFirst is returned if a command emits an Attachment after
+// it emitted other values, since the response is only sent as multipart if
+// the first value is an Attachment.
+var errAttachmentNotFirst = errors.New("attachments must be emitted before other values")
+
+// writeParts writes value to a multipart response, followed by the data of
+// value if it is an Attachment.
+func (re *responseEmitter) writeParts(value interface{}) error {
+	att, hasData := value.(cmds.Attachment)
+	if hasData {
+		value = att.Value
+	}
+
+	h := make(textproto.MIMEHeader)
+	h.Set(contentTypeHeader, mimeTypes[re.encType])
+	if hasData {
+		h.Set(attachmentHeader, "1")
+	}
+	pw, err := re.mw.CreatePart(h)
+	if err != nil {
+		return err
+	}
+	_, enc, err := cmds.GetEncoder(re.req, pw, cmds.JSON)
+	if err != nil {
+		return err
+	}
+	streamed, err := cmds.StreamValue(re.req, pw, enc, re.encType, value)
+	if !streamed {
+		err = enc.Encode(cmds.TagValue(re.req, re.encType, value))
+	}
+	if err != nil {
+		return err
+	}
+
+	if !hasData {
+		return nil
+	}
+
+	h = make(textproto.MIMEHeader)
+	h.Set(contentTypeHeader, applicationOctetStream)
+	h.Set(contentDispHeader, contentDispAttachment)
+	if pw, err = re.mw.CreatePart(h); err != nil {
+		return err
+	}
+	return flushCopy(re.rc, pw, att.Data)
+}
+
+// nextPart decodes the next value of a multipart response into value,
+// returning an Attachment if the value has data.
+func (res *Response) nextPart(value interface{}) (interface{}, error) {
+	p, err := res.mr.NextPart()
+	if err == io.EOF {
+		// read the rest of the body to get the trailer
+		_, err = io.Copy(ioutil.Discard, res.rr)
+		if err == nil {
+			err = io.EOF
+		}
+	}
+	if err != nil {
+		if res.isAborted() {
+			err = ErrResponseAborted
+		}
+		res.err = err
+		return nil, err
+	}
+
+	encType, ok := MIMEEncodings[p.Header.Get(contentTypeHeader)]
+	if !ok {
+		encType = cmds.JSON
+	}
+	makeDec, ok := cmds.Decoders[encType]
+	if !ok {
+		res.err = errors.New("could not find decoder for part encoding " + string(encType))
+		return nil, res.err
+	}
+
+	m := &cmds.MaybeError{Value: value}
+	if err := makeDec(p).Decode(m); err != nil {
+		res.err = err
+		return nil, err
+	}
+	v, err := m.Get()
+	if err != nil {
+		res.err = err
+		return nil, err
+	}
+	v = cmds.Unwrap(v)
+
+	if p.Header.Get(attachmentHeader) == "" {
+		return v, nil
+	}
+
+	data, err := res.mr.NextPart()
+	if err != nil {
+		res.err = err
+		return nil, err
+	}
+	return cmds.Attachment{Value: v, Data: data}, nil
+}
@@ -0,0 +1,77 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+func TestAttachments(t *testing.T) {
+	type object struct {
+		Name string
+	}
+
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"get": {
+				Type: object{},
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					values := []interface{}{
+						cmds.Attachment{Value: object{"a"}, Data: strings.NewReader("content of a")},
+						object{"b"},
+						cmds.Attachment{Value: &object{"c"}, Data: strings.NewReader("content of c")},
+					}
+					for _, v := range values {
+						if err := re.Emit(v); err != nil {
+							return err
+						}
+					}
+					return errors.New("interrupted")
+				},
+			},
+		},
+	}
+
+	h := NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, originCfg(defaultOrigins))
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	req, err := cmds.NewRequest(context.Background(), []string{"get"}, nil, nil, nil, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := NewClient(srv.URL).Send(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	err = cmds.ForEach(res, func(v interface{}) error {
+		switch v := v.(type) {
+		case cmds.Attachment:
+			data, err := ioutil.ReadAll(v.Data)
+			if err != nil {
+				return err
+			}
+			got = append(got, v.Value.(*object).Name+":"+string(data))
+		case *object:
+			got = append(got, v.Name)
+		default:
+			t.Errorf("unexpected value %#v", v)
+		}
+		return nil
+	})
+	if err == nil || err.Error() != "interrupted" {
+		t.Errorf("expected the error of the command, got %v", err)
+	}
+
+	expected := "a:content of a,b,c:content of c"
+	if strings.Join(got, ",") != expected {
+		t.Errorf("expected %q but got %q", expected, strings.Join(got, ","))
+	}
+}
@@ -0,0 +1,222 @@
+package http
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+const (
+	authorizationHeader   = "Authorization"
+	wwwAuthenticateHeader = "WWW-Authenticate"
+)
+
+// Authorizer decides which commands clients may run, see
+// ServerConfig.Authorizer.
+type Authorizer interface {
+	// Authorize is called with the parsed request and the HTTP request it
+	// was parsed from, e.g. for its headers and TLS state, before the
+	// command runs. The request is rejected if it returns an error, with
+	// the status selected by an *AuthError, or 500 Internal Server Error
+	// for other errors, whose message isn't sent to the client.
+	Authorize(req *cmds.Request, r *http.Request) error
+}
+
+// AuthorizerFunc is a function implementing Authorizer.
+type AuthorizerFunc func(req *cmds.Request, r *http.Request) error
+
+// Authorize calls f.
+func (f AuthorizerFunc) Authorize(req *cmds.Request, r *http.Request) error {
+	return f(req, r)
+}
+
+// AuthError rejects a request. Requests from clients that didn't
+// authenticate, e.g. without a valid token, are answered with 401
+// Unauthorized, other requests with 403 Forbidden. Clients receive a
+// cmdkit.Error with the Reason as message and the code ErrClient.
+type AuthError struct {
+	Reason string
+	// Unauthenticated is set if the client didn't authenticate.
+	Unauthenticated bool
+	// Challenge, if set, is sent in the WWW-Authenticate header of 401
+	// responses, e.g. `Bearer realm="api"`.
+	Challenge string
+}
+
+func (e *AuthError) Error() string {
+	return e.Reason
+}
+
+func (e *AuthError) status() int {
+	if e.Unauthenticated {
+		return http.StatusUnauthorized
+	}
+	return http.StatusForbidden
+}
+
+// ChainAuthorizers returns an Authorizer accepting the requests all of as
+// accept. They are called in order until one rejects the request.
+func ChainAuthorizers(as ...Authorizer) Authorizer {
+	return AuthorizerFunc(func(req *cmds.Request, r *http.Request) error {
+		for _, a := range as {
+			if err := a.Authorize(req, r); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// AllowCommands returns an Authorizer accepting only the commands at paths
+// and their subcommands. Paths are space separated, e.g. "pin add".
+func AllowCommands(paths ...string) Authorizer {
+	allowed := splitPaths(paths)
+	return AuthorizerFunc(func(req *cmds.Request, r *http.Request) error {
+		if !matchesPath(allowed, req.Path) {
+			return commandForbidden(req)
+		}
+		return nil
+	})
+}
+
+// DenyCommands returns an Authorizer rejecting the commands at paths and
+// their subcommands, like AllowCommands.
+func DenyCommands(paths ...string) Authorizer {
+	denied := splitPaths(paths)
+	return AuthorizerFunc(func(req *cmds.Request, r *http.Request) error {
+		if matchesPath(denied, req.Path) {
+			return commandForbidden(req)
+		}
+		return nil
+	})
+}
+
+func commandForbidden(req *cmds.Request) error {
+	return &AuthError{Reason: "command " + strings.Join(req.Path, " ") + " is not allowed"}
+}
+
+// BearerToken returns an Authorizer accepting requests with one of tokens
+// in the Authorization header, as in "Authorization: Bearer <token>".
+func BearerToken(tokens ...string) Authorizer {
+	return BearerTokenFunc(func(token string, req *cmds.Request) error {
+		var valid int
+		for _, t := range tokens {
+			// check all tokens to not leak which one matched
+			valid |= subtle.ConstantTimeCompare([]byte(token), []byte(t))
+		}
+		if valid == 0 {
+			return &AuthError{Reason: "invalid token", Unauthenticated: true, Challenge: `Bearer error="invalid_token"`}
+		}
+		return nil
+	})
+}
+
+// BearerTokenFunc returns an Authorizer passing the bearer token of requests
+// to verify, e.g. to look up which commands the token grants access to.
+// Requests without a token are rejected as unauthenticated.
+func BearerTokenFunc(verify func(token string, req *cmds.Request) error) Authorizer {
+	return AuthorizerFunc(func(req *cmds.Request, r *http.Request) error {
+		token, ok := bearerToken(r.Header.Get(authorizationHeader))
+		if !ok {
+			return &AuthError{Reason: "missing bearer token", Unauthenticated: true, Challenge: "Bearer"}
+		}
+		return verify(token, req)
+	})
+}
+
+func bearerToken(h string) (string, bool) {
+	const prefix = "bearer "
+	if len(h) < len(prefix) || !strings.EqualFold(h[:len(prefix)], prefix) {
+		return "", false
+	}
+	token := strings.TrimSpace(h[len(prefix):])
+	return token, token != ""
+}
+
+// splitPaths splits space separated command paths.
+func splitPaths(paths []string) [][]string {
+	split := make([][]string, 0, len(paths))
+	for _, p := range paths {
+		split = append(split, strings.Fields(p))
+	}
+	return split
+}
+
+// matchesPath returns whether path is one of prefixes or a subcommand of
+// one.
+func matchesPath(prefixes [][]string, path []string) bool {
+PREFIXES:
+	for _, p := range prefixes {
+		if len(p) > len(path) {
+			continue
+		}
+		for i := range p {
+			if p[i] != path[i] {
+				continue PREFIXES
+			}
+		}
+		return true
+	}
+
+	return false
+}
+
+// authorize runs the Authorizer of the handler for req. It answers the
+// request and returns false if it was rejected.
+func (h *handler) authorize(w http.ResponseWriter, r *http.Request, req *cmds.Request) bool {
+	if h.cfg.Authorizer == nil {
+		return true
+	}
+	if err := h.cfg.Authorizer.Authorize(req, r); err != nil {
+		serveAuthError(w, req, err)
+		return false
+	}
+	return true
+}
+
+// authorizePath runs the Authorizer of the handler for a request for the
+// command at path without options or arguments, e.g. for its description.
+// It answers the request and returns false if it was rejected or there is
+// no command at path.
+func (h *handler) authorizePath(w http.ResponseWriter, r *http.Request, path []string) bool {
+	if h.cfg.Authorizer == nil {
+		return true
+	}
+	req, err := cmds.NewRequest(r.Context(), path, nil, nil, nil, h.root)
+	if err != nil {
+		http.Error(w, ErrNotFound.Error(), http.StatusNotFound)
+		return false
+	}
+	return h.authorize(w, r, req)
+}
+
+// serveAuthError answers a request its Authorizer rejected with err.
+func serveAuthError(w http.ResponseWriter, req *cmds.Request, err error) {
+	ae, ok := err.(*AuthError)
+	if !ok {
+		log.Errorf("error authorizing %q: %s", req.Path, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("500 - Internal Server Error"))
+		return
+	}
+
+	status := ae.status()
+	if status == http.StatusUnauthorized && ae.Challenge != "" {
+		w.Header().Set(wwwAuthenticateHeader, ae.Challenge)
+	}
+
+	encType, data, err := cmds.MarshalError(cmds.GetEncoding(req, cmds.JSON), &cmdkit.Error{Message: ae.Reason, Code: cmdkit.ErrClient})
+	if err != nil {
+		log.Error("error marshaling error value: ", err)
+	}
+	mime, ok := mimeTypes[encType]
+	if !ok {
+		mime = plainText
+	}
+	w.Header().Set(contentTypeHeader, mime)
+	w.WriteHeader(status)
+	w.Write(data)
+}
@@ -0,0 +1,171 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+func TestAuthorizer(t *testing.T) {
+	var ran []string
+	run := func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		ran = append(ran, req.Path[len(req.Path)-1])
+		return cmds.EmitOnce(re, "ok")
+	}
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"pin": {
+				Subcommands: map[string]*cmds.Command{
+					"add": {Run: run},
+					"ls":  {Run: run},
+				},
+			},
+			"shutdown": {Run: run},
+			"fail":     {Run: run},
+		},
+	}
+
+	cfg := originCfg(defaultOrigins)
+	cfg.Authorizer = ChainAuthorizers(
+		BearerToken("secret"),
+		AllowCommands("pin", "shutdown", "fail"),
+		DenyCommands("pin add"),
+		AuthorizerFunc(func(req *cmds.Request, r *http.Request) error {
+			if req.Path[0] == "fail" {
+				return errors.New("the backend is down")
+			}
+			return nil
+		}),
+	)
+	srv := httptest.NewServer(NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, cfg))
+	defer srv.Close()
+
+	tcs := []struct {
+		path  []string
+		token string
+		code  cmdkit.ErrorType
+		msg   string
+	}{
+		{path: []string{"pin", "ls"}, token: "secret"},
+		{path: []string{"shutdown"}, token: "secret"},
+		{path: []string{"pin", "add"}, token: "secret", code: cmdkit.ErrClient, msg: "command pin add is not allowed"},
+		{path: []string{"pin", "ls"}, token: "wrong", code: cmdkit.ErrClient, msg: "invalid token"},
+		{path: []string{"pin", "ls"}, code: cmdkit.ErrClient, msg: "missing bearer token"},
+	}
+
+	for _, tc := range tcs {
+		ran = nil
+		var opts []ClientOpt
+		if tc.token != "" {
+			opts = append(opts, ClientWithHeader("Authorization", "Bearer "+tc.token))
+		}
+		req, err := cmds.NewRequest(context.Background(), tc.path, nil, nil, nil, root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = NewClient(srv.URL, opts...).Send(req)
+
+		if tc.msg == "" {
+			if err != nil {
+				t.Errorf("%v: unexpected error: %s", tc.path, err)
+			}
+			if len(ran) != 1 {
+				t.Errorf("%v: expected the command to run", tc.path)
+			}
+			continue
+		}
+		if e, ok := err.(*cmdkit.Error); !ok || e.Code != tc.code || e.Message != tc.msg {
+			t.Errorf("%v: expected the error %q, got %#v", tc.path, tc.msg, err)
+		}
+		if len(ran) != 0 {
+			t.Errorf("%v: the rejected command ran", tc.path)
+		}
+	}
+
+	statusTcs := []struct {
+		path, token string
+		status      int
+		challenge   string
+	}{
+		{"/pin/add", "secret", http.StatusForbidden, ""},
+		{"/pin/ls", "", http.StatusUnauthorized, "Bearer"},
+		{"/pin/ls", "wrong", http.StatusUnauthorized, `Bearer error="invalid_token"`},
+		{"/fail", "secret", http.StatusInternalServerError, ""},
+	}
+	for _, tc := range statusTcs {
+		r := httptest.NewRequest("POST", tc.path, nil)
+		if tc.token != "" {
+			r.Header.Set("Authorization", "bearer "+tc.token)
+		}
+		w := httptest.NewRecorder()
+		NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, cfg).ServeHTTP(w, r)
+
+		if w.Code != tc.status {
+			t.Errorf("%s: expected status %d but got %d", tc.path, tc.status, w.Code)
+		}
+		if c := w.Header().Get("WWW-Authenticate"); c != tc.challenge {
+			t.Errorf("%s: expected the challenge %q but got %q", tc.path, tc.challenge, c)
+		}
+	}
+}
+
+func TestAuthorizerEndpoints(t *testing.T) {
+	var completed bool
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"pin": {
+				Subcommands: map[string]*cmds.Command{
+					"add": {
+						Arguments: []cmdkit.Argument{cmdkit.StringArg("path", true, false, "")},
+						Run:       func(*cmds.Request, cmds.ResponseEmitter, cmds.Environment) error { return nil },
+						Complete: func(req *cmds.Request, env cmds.Environment, word string) ([]string, error) {
+							completed = true
+							return nil, nil
+						},
+					},
+					"ls": {Run: func(*cmds.Request, cmds.ResponseEmitter, cmds.Environment) error { return nil }},
+				},
+			},
+		},
+	}
+
+	cfg := originCfg(defaultOrigins)
+	cfg.UploadDir = t.TempDir()
+	cfg.Authorizer = ChainAuthorizers(BearerToken("secret"), DenyCommands("pin add"))
+	h := NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, cfg)
+
+	tcs := []struct {
+		method, url, token string
+		status             int
+	}{
+		{"GET", "/" + CompletionPath + "/pin/add?word=a", "", http.StatusUnauthorized},
+		{"GET", "/" + CompletionPath + "/pin/add?word=a", "secret", http.StatusForbidden},
+		{"POST", "/" + UploadPath + "?cmd=pin+ls", "", http.StatusUnauthorized},
+		{"POST", "/" + UploadPath + "?cmd=pin+add", "secret", http.StatusForbidden},
+		{"POST", "/" + UploadPath + "?cmd=pin+ls", "secret", http.StatusCreated},
+		{"OPTIONS", "/pin/ls", "", http.StatusUnauthorized},
+		{"OPTIONS", "/pin/ls", "secret", http.StatusOK},
+		{"GET", "/" + OpenAPIPath, "", http.StatusUnauthorized},
+		{"GET", "/" + OpenAPIPath, "secret", http.StatusOK},
+	}
+	for _, tc := range tcs {
+		r := httptest.NewRequest(tc.method, tc.url, nil)
+		if tc.token != "" {
+			r.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != tc.status {
+			t.Errorf("%s %s: expected status %d but got %d", tc.method, tc.url, tc.status, w.Code)
+		}
+	}
+	if completed {
+		t.Error("expected the Complete hook of the denied command not to run")
+	}
+}
@@ -0,0 +1,187 @@
+package http
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+const (
+	etagHeader        = "ETag"
+	ifNoneMatchHeader = "If-None-Match"
+)
+
+// CachedResponse is a response stored in a ResponseCache.
+type CachedResponse struct {
+	Header http.Header
+	Body   []byte
+	// ETag is used to revalidate the response with the server once it
+	// expired.
+	ETag    string
+	Expires time.Time
+}
+
+func (cr *CachedResponse) httpResponse() *http.Response {
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Header:     cr.Header.Clone(),
+		Trailer:    make(http.Header),
+		Body:       ioutil.NopCloser(bytes.NewReader(cr.Body)),
+	}
+}
+
+// ResponseCache stores the responses of Cacheable commands for the client,
+// see ClientWithCache. It must be safe for concurrent use.
+type ResponseCache interface {
+	Get(key string) (*CachedResponse, bool)
+	Set(key string, res *CachedResponse)
+}
+
+// ClientWithCache makes the client cache the responses of commands marked
+// Cacheable in cache for ttl. Expired responses are revalidated with the
+// server, which only sends the response again if it changed.
+func ClientWithCache(cache ResponseCache, ttl time.Duration) ClientOpt {
+	return func(c *client) {
+		c.cache = cache
+		c.cacheTTL = ttl
+	}
+}
+
+// cacheLookup returns the cache key for httpReq and the cached response, if
+// any. If the response expired, httpReq is made conditional. The key is
+// empty if the response can't be cached.
+func (c *client) cacheLookup(req *cmds.Request, httpReq *http.Request) (string, *CachedResponse) {
+	if c.cache == nil || !req.Command.Cacheable || httpReq.Body != nil {
+		return "", nil
+	}
+
+	key := httpReq.URL.String()
+	cached, ok := c.cache.Get(key)
+	if !ok {
+		return key, nil
+	}
+
+	if cached.ETag != "" {
+		httpReq.Header.Set(ifNoneMatchHeader, cached.ETag)
+	}
+
+	return key, cached
+}
+
+// cacheStore stores httpRes in the cache, or refreshes the cached
+// response if the server reports it didn't change, and returns the response
+// to parse.
+func (c *client) cacheStore(key string, cached *CachedResponse, httpRes *http.Response) (*http.Response, error) {
+	switch {
+	case httpRes.StatusCode == http.StatusNotModified && cached != nil:
+		httpRes.Body.Close()
+
+		refreshed := *cached
+		refreshed.Expires = time.Now().Add(c.cacheTTL)
+		c.cache.Set(key, &refreshed)
+		return refreshed.httpResponse(), nil
+
+	case httpRes.StatusCode != http.StatusOK:
+		return httpRes, nil
+	}
+
+	body, err := ioutil.ReadAll(httpRes.Body)
+	httpRes.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	httpRes.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	// the trailer is available once the body was read
+	if httpRes.Trailer.Get(StreamErrHeader) != "" || httpRes.Header.Get(StreamErrHeader) != "" {
+		return httpRes, nil
+	}
+
+	c.cache.Set(key, &CachedResponse{
+		Header:  httpRes.Header.Clone(),
+		Body:    body,
+		ETag:    httpRes.Header.Get(etagHeader),
+		Expires: time.Now().Add(c.cacheTTL),
+	})
+
+	return httpRes, nil
+}
+
+// NewMemoryCache returns a ResponseCache keeping up to maxEntries responses
+// in memory, evicting the least recently used ones.
+func NewMemoryCache(maxEntries int) ResponseCache {
+	return &memoryCache{
+		max:     maxEntries,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+type memoryCache struct {
+	l       sync.Mutex
+	max     int
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+type memoryCacheEntry struct {
+	key string
+	res *CachedResponse
+}
+
+func (mc *memoryCache) Get(key string) (*CachedResponse, bool) {
+	mc.l.Lock()
+	defer mc.l.Unlock()
+
+	e, ok := mc.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	mc.lru.MoveToFront(e)
+	return e.Value.(*memoryCacheEntry).res, true
+}
+
+func (mc *memoryCache) Set(key string, res *CachedResponse) {
+	mc.l.Lock()
+	defer mc.l.Unlock()
+
+	if e, ok := mc.entries[key]; ok {
+		e.Value.(*memoryCacheEntry).res = res
+		mc.lru.MoveToFront(e)
+		return
+	}
+
+	mc.entries[key] = mc.lru.PushFront(&memoryCacheEntry{key: key, res: res})
+	for mc.max > 0 && mc.lru.Len() > mc.max {
+		oldest := mc.lru.Back()
+		mc.lru.Remove(oldest)
+		delete(mc.entries, oldest.Value.(*memoryCacheEntry).key)
+	}
+}
+
+// etag returns the entity tag of a response body.
+func etag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches returns whether the If-None-Match header value matches tag.
+func etagMatches(ifNoneMatch, tag string) bool {
+	for _, t := range strings.Split(ifNoneMatch, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || strings.TrimPrefix(t, "W/") == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+func TestClientCache(t *testing.T) {
+	var (
+		calls int
+		value = "first"
+	)
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"cached": {
+				Cacheable: true,
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					calls++
+					return re.Emit(value)
+				},
+			},
+		},
+	}
+
+	var statuses []int
+	h := NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, originCfg(defaultOrigins))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &accessLogWriter{ResponseWriter: w}
+		h.ServeHTTP(rec, r)
+		statuses = append(statuses, rec.status)
+	}))
+	defer srv.Close()
+
+	get := func(c Client) string {
+		req, err := cmds.NewRequest(context.Background(), []string{"cached"}, nil, nil, nil, root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := c.Send(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := res.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, _ := v.(string)
+		return s
+	}
+
+	// fresh responses are answered from the cache
+	fresh := NewClient(srv.URL, ClientWithCache(NewMemoryCache(10), time.Hour))
+	for i := 0; i < 2; i++ {
+		if v := get(fresh); v != "first" {
+			t.Errorf("expected %q but got %q", "first", v)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected one call to the server but got %d", calls)
+	}
+
+	// expired responses are revalidated
+	statuses = nil
+	expired := NewClient(srv.URL, ClientWithCache(NewMemoryCache(10), 0))
+	for _, expected := range []string{"first", "first"} {
+		if v := get(expired); v != expected {
+			t.Errorf("expected %q but got %q", expected, v)
+		}
+	}
+	value = "second"
+	if v := get(expired); v != "second" {
+		t.Errorf("expected the changed value, got %q", v)
+	}
+
+	expectedStatuses := []int{http.StatusOK, http.StatusNotModified, http.StatusOK}
+	if len(statuses) != len(expectedStatuses) {
+		t.Fatalf("expected statuses %v but got %v", expectedStatuses, statuses)
+	}
+	for i := range statuses {
+		if statuses[i] != expectedStatuses[i] {
+			t.Errorf("expected statuses %v but got %v", expectedStatuses, statuses)
+			break
+		}
+	}
+}
+
+func TestMemoryCacheEviction(t *testing.T) {
+	mc := NewMemoryCache(2)
+	mc.Set("a", &CachedResponse{})
+	mc.Set("b", &CachedResponse{})
+	mc.Get("a")
+	mc.Set("c", &CachedResponse{})
+
+	for key, present := range map[string]bool{"a": true, "b": false, "c": true} {
+		if _, ok := mc.Get(key); ok != present {
+			t.Errorf("%s: expected present to be %v", key, present)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package http
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// CancelPath is the path prefix of the endpoint canceling running
+	// requests. The client sends every command with a random id in the
+	// X-Cancel-Id header and, once the context of the request is canceled,
+	//
+	//	DELETE <APIPath>/_cancel/<id>
+	//
+	// which cancels the context of the command on the server. Unlike a
+	// closed connection, the signal also gets through proxies that keep the
+	// connection to the server open. The id is only known to the client, so
+	// it also authorizes the cancellation.
+	CancelPath = "_cancel"
+
+	cancelIDHeader = "X-Cancel-Id"
+
+	// cancelTimeout limits the time the client waits for the server to
+	// acknowledge the cancellation of a request.
+	cancelTimeout = 5 * time.Second
+)
+
+var cancelIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// isCancelRequest checks whether pth (without leading slash) addresses the
+// cancel endpoint.
+func isCancelRequest(pth string) bool {
+	return pth == CancelPath || strings.HasPrefix(pth, CancelPath+"/")
+}
+
+// runningRequests holds the requests being served by the id the client sent
+// in X-Cancel-Id. Retries of a request are sent with the same id and may
+// overlap with the attempt they replace, so an id can have several requests.
+type runningRequests struct {
+	l sync.Mutex
+	m map[string][]*runningRequest
+}
+
+type runningRequest struct {
+	cancel context.CancelFunc
+}
+
+func newRunningRequests() *runningRequests {
+	return &runningRequests{m: make(map[string][]*runningRequest)}
+}
+
+// add registers a request with the id, the returned function must be
+// called once it's done.
+func (rr *runningRequests) add(id string, cancel context.CancelFunc) (func(), error) {
+	if !cancelIDPattern.MatchString(id) {
+		return nil, fmt.Errorf("invalid cancel id %q", id)
+	}
+
+	r := &runningRequest{cancel: cancel}
+	rr.l.Lock()
+	defer rr.l.Unlock()
+	rr.m[id] = append(rr.m[id], r)
+
+	return func() {
+		rr.l.Lock()
+		defer rr.l.Unlock()
+
+		reqs := rr.m[id]
+		for i := range reqs {
+			if reqs[i] == r {
+				reqs = append(reqs[:i], reqs[i+1:]...)
+				break
+			}
+		}
+		if len(reqs) == 0 {
+			delete(rr.m, id)
+		} else {
+			rr.m[id] = reqs
+		}
+	}, nil
+}
+
+// cancel cancels the requests with the id, it returns false if there are
+// none.
+func (rr *runningRequests) cancel(id string) bool {
+	rr.l.Lock()
+	reqs := append([]*runningRequest(nil), rr.m[id]...)
+	rr.l.Unlock()
+
+	for _, r := range reqs {
+		r.cancel()
+	}
+	return len(reqs) > 0
+}
+
+func (h *handler) serveCancel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.Header().Set("Allow", http.MethodDelete)
+		http.Error(w, "405 - Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.Trim(strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/"), CancelPath), "/")
+	if !h.running.cancel(id) {
+		http.Error(w, ErrNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	log.Debugf("canceled request %s", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// newCancelID returns a random id for the X-Cancel-Id header.
+func newCancelID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// watchCancel sends the cancel signal for httpReq to the servers once its
+// context is canceled, until the returned function is called. It's called
+// when the response was received completely or can't be received anymore.
+func (c *client) watchCancel(httpReq *http.Request) func() {
+	id := httpReq.Header.Get(cancelIDHeader)
+	ctx := httpReq.Context()
+	if id == "" || ctx.Done() == nil {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+			// the response may have failed because of the cancellation
+			if ctx.Err() == nil {
+				return
+			}
+		}
+		c.sendCancel(id)
+	}()
+
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// sendCancel asks the servers to cancel the request with the id. It's sent
+// to all endpoints because the request may have failed over.
+func (c *client) sendCancel(id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), cancelTimeout)
+	defer cancel()
+
+	for _, addr := range c.endpoints.all() {
+		url := fmt.Sprintf("%s%s/%s/%s", addr, c.apiPrefix, CancelPath, id)
+		httpReq, err := http.NewRequest(http.MethodDelete, url, nil)
+		if err != nil {
+			log.Debugf("error canceling request %s: %s", id, err)
+			continue
+		}
+		c.setHeaders(httpReq)
+
+		httpRes, err := c.httpClient.Do(httpReq.WithContext(ctx))
+		if err != nil {
+			log.Debugf("error canceling request %s at %s: %s", id, addr, err)
+			continue
+		}
+		httpRes.Body.Close()
+	}
+}
+
+// cancelWatchBody stops watching for the cancellation of the request once
+// the response body was read completely or closed.
+type cancelWatchBody struct {
+	io.ReadCloser
+	stop func()
+}
+
+func (b *cancelWatchBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.stop()
+	}
+	return n, err
+}
+
+func (b *cancelWatchBody) Close() error {
+	b.stop()
+	return b.ReadCloser.Close()
+}
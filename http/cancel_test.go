@@ -0,0 +1,193 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+func TestCancelOnContextCancel(t *testing.T) {
+	started := make(chan struct{})
+	stopped := make(chan error, 1)
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"wait": {
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					close(started)
+					<-req.Context.Done()
+					stopped <- req.Context.Err()
+					return req.Context.Err()
+				},
+			},
+		},
+	}
+
+	var cancels int32
+	h := NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, originCfg(defaultOrigins))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/"+CancelPath+"/") {
+			atomic.AddInt32(&cancels, 1)
+		}
+		h.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := cmds.NewRequest(ctx, []string{"wait"}, nil, nil, nil, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := NewClient(srv.URL).Send(req)
+		errCh <- err
+	}()
+
+	<-started
+	cancel()
+
+	select {
+	case err := <-errCh:
+		if err == nil {
+			t.Error("expected Send to fail after the cancellation")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Send didn't return after the cancellation")
+	}
+	select {
+	case err := <-stopped:
+		if err != context.Canceled {
+			t.Errorf("expected the command's context to be canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the command didn't stop after the cancellation")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&cancels) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&cancels); n != 1 {
+		t.Errorf("expected the client to send 1 cancel signal, got %d", n)
+	}
+}
+
+func TestCancelEndpoint(t *testing.T) {
+	release := make(chan struct{})
+	stopped := make(chan struct{})
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"wait": {
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					close(release)
+					<-req.Context.Done()
+					close(stopped)
+					return req.Context.Err()
+				},
+			},
+		},
+	}
+
+	h := NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, originCfg(defaultOrigins))
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	id := newCancelID()
+	go func() {
+		httpReq, _ := http.NewRequest(http.MethodPost, srv.URL+"/wait", nil)
+		httpReq.Header.Set(cancelIDHeader, id)
+		if res, err := http.DefaultClient.Do(httpReq); err == nil {
+			res.Body.Close()
+		}
+	}()
+	<-release
+	// requests can be canceled after a reload
+	h.SetConfig(originCfg(defaultOrigins))
+
+	for _, tc := range []struct {
+		method, id string
+		status     int
+	}{
+		{http.MethodGet, id, http.StatusMethodNotAllowed},
+		{http.MethodDelete, newCancelID(), http.StatusNotFound},
+		{http.MethodDelete, id, http.StatusNoContent},
+	} {
+		httpReq, _ := http.NewRequest(tc.method, srv.URL+"/"+CancelPath+"/"+tc.id, nil)
+		res, err := http.DefaultClient.Do(httpReq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != tc.status {
+			t.Errorf("%s %s: expected status %d, got %d", tc.method, tc.id, tc.status, res.StatusCode)
+		}
+	}
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the command didn't stop after the cancellation")
+	}
+
+	httpReq, _ := http.NewRequest(http.MethodPost, srv.URL+"/wait", nil)
+	httpReq.Header.Set(cancelIDHeader, "../wait")
+	res, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected an invalid cancel id to be rejected, got status %d", res.StatusCode)
+	}
+}
+
+func TestCancelStopsEmitting(t *testing.T) {
+	stopped := make(chan error, 1)
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			// ignores its context, but not the errors of Emit
+			"spam": {
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					for i := 0; ; i++ {
+						if err := re.Emit(i); err != nil {
+							stopped <- err
+							return err
+						}
+					}
+				},
+			},
+		},
+	}
+
+	srv := httptest.NewServer(NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, originCfg(defaultOrigins)))
+	defer srv.Close()
+
+	req, err := cmds.NewRequest(context.Background(), []string{"spam"}, nil, nil, nil, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := NewClient(srv.URL).Send(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := res.Next(); err != nil {
+		t.Fatal(err)
+	}
+	res.(*Response).Abort()
+
+	select {
+	case err := <-stopped:
+		if err == nil {
+			t.Error("expected Emit to fail after the client went away")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the command kept emitting after the client went away")
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	cmds "github.com/ipfs/go-ipfs-cmds"
 
@@ -25,7 +26,11 @@ var (
 )
 
 var OptionSkipMap = map[string]bool{
-	"api": true,
+	"api":           true,
+	cmds.ProfileOpt: true,
+	cmds.StatsOpt:   true,
+	// rendered by the client
+	cmds.FormatOpt: true,
 }
 
 // Client is the commands HTTP client interface.
@@ -34,10 +39,44 @@ type Client interface {
 }
 
 type client struct {
-	serverAddress string
-	httpClient    *http.Client
-	ua            string
-	apiPrefix     string
+	endpoints  *endpointSet
+	httpClient *http.Client
+	ua         string
+	apiPrefix  string
+	hooks      ClientHooks
+	// header holds extra headers sent with every request.
+	header http.Header
+	// encodings are the preferred encodings of responses, see
+	// ClientWithEncodings.
+	encodings []string
+	// sockets maps the hosts standing in for unix sockets in server URLs
+	// to the socket paths.
+	sockets map[string]string
+
+	cache    ResponseCache
+	cacheTTL time.Duration
+
+	// ctxValues are the values of the request context sent to the server.
+	ctxValues []ContextValue
+
+	// unknownOptions is applied to the requests before they are sent, see
+	// ClientWithUnknownOptions.
+	unknownOptions cmds.UnknownOptionPolicy
+
+	// timeout limits the attempts to send a request, see ClientWithTimeout.
+	timeout time.Duration
+	// retries is the number of times failed requests are retried, waiting
+	// for backoff, see ClientWithRetry.
+	retries int
+	backoff Backoff
+
+	// uploadProgress is reported the upload progress of requests whose
+	// context doesn't set one, see ClientWithUploadProgress.
+	uploadProgress UploadProgress
+	// chunkSize is the size of the chunks request bodies are staged in,
+	// zero if they are sent with the command, see
+	// ClientWithResumableUploads.
+	chunkSize int64
 }
 
 type ClientOpt func(*client)
@@ -48,26 +87,68 @@ func ClientWithUserAgent(ua string) ClientOpt {
 	}
 }
 
+// ClientWithHeader adds a header sent with every request, e.g. to identify
+// the client to a proxy.
+func ClientWithHeader(key, value string) ClientOpt {
+	return func(c *client) {
+		c.header.Add(key, value)
+	}
+}
+
+// ClientWithApp tells the server the name and version of the application
+// using the client, in addition to the user agent. Commands can read them
+// with cmds.CallerFromContext.
+func ClientWithApp(name, version string) ClientOpt {
+	return func(c *client) {
+		c.header.Set(appHeader, name)
+		c.header.Set(appVersionHeader, version)
+	}
+}
+
+// ClientWithUnknownOptions makes the client check requests for options
+// their commands don't define before sending them, according to policy.
+// This catches mistyped options early if the server shares the command
+// tree of the client.
+func ClientWithUnknownOptions(policy cmds.UnknownOptionPolicy) ClientOpt {
+	return func(c *client) {
+		c.unknownOptions = policy
+	}
+}
+
 func ClientWithAPIPrefix(apiPrefix string) ClientOpt {
 	return func(c *client) {
 		c.apiPrefix = apiPrefix
 	}
 }
 
-func NewClient(address string, opts ...ClientOpt) Client {
-	if !strings.HasPrefix(address, "http://") {
-		address = "http://" + address
+// ClientWithProtocols sets the HTTP versions the client may use. HTTP/2 is
+// negotiated for https:// addresses by default; to use HTTP/2 without TLS
+// (h2c), e.g. with a local daemon, enable only UnencryptedHTTP2.
+func ClientWithProtocols(protocols *http.Protocols) ClientOpt {
+	return func(c *client) {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.Protocols = protocols
+		c.httpClient = &http.Client{Transport: t}
 	}
+}
 
+// NewClient returns a Client that sends requests to the server at address,
+// which is either a URL, a multiaddr or a unix socket URL such as
+// unix:///var/run/api.sock, see ClientWithEndpoints. Addresses without a
+// scheme are sent plain HTTP requests.
+// The returned Client also implements Completer.
+func NewClient(address string, opts ...ClientOpt) Client {
 	c := &client{
-		serverAddress: address,
-		httpClient:    http.DefaultClient,
-		ua:            "go-ipfs-cmds/http",
+		httpClient: http.DefaultClient,
+		ua:         "go-ipfs-cmds/http",
+		header:     make(http.Header),
 	}
+	c.endpoints = newEndpointSet(c.serverURL(address))
 
 	for _, opt := range opts {
 		opt(c)
 	}
+	c.dialUnixSockets()
 
 	return c
 }
@@ -90,7 +171,7 @@ func (c *client) Execute(req *cmds.Request, re cmds.ResponseEmitter, env cmds.En
 		return err
 	}
 
-	if cmd.PostRun != nil {
+	if cmd.PostRun != nil && serverPostRunType(res) == "" {
 		if typer, ok := re.(interface {
 			Type() cmds.PostRunType
 		}); ok && cmd.PostRun[typer.Type()] != nil {
@@ -128,8 +209,20 @@ func (c *client) toHTTPRequest(req *cmds.Request) (*http.Request, error) {
 		reader = fileReader
 	}
 
+	progress := uploadProgressFromContext(req.Context)
+	if progress == nil {
+		progress = c.uploadProgress
+	}
+	if progress != nil && reader != nil {
+		reader = progressReader(req, progress, reader)
+	}
+	if stats := cmds.StatsFromContext(req.Context); stats != nil && reader != nil {
+		reader = &countingReader{r: reader, count: stats.AddBytesSent}
+	}
+
+	addr, _ := c.endpoints.pick(nil)
 	path := strings.Join(req.Path, "/")
-	url := fmt.Sprintf(ApiUrlFormat, c.serverAddress, c.apiPrefix, path, query)
+	url := fmt.Sprintf(ApiUrlFormat, addr, c.apiPrefix, path, query)
 
 	httpReq, err := http.NewRequest("POST", url, reader)
 	if err != nil {
@@ -142,7 +235,9 @@ func (c *client) toHTTPRequest(req *cmds.Request) (*http.Request, error) {
 	} else {
 		httpReq.Header.Set(contentTypeHeader, applicationOctetStream)
 	}
-	httpReq.Header.Set(uaHeader, c.ua)
+	c.setHeaders(httpReq)
+	httpReq.Header.Set(cancelIDHeader, newCancelID())
+	setContextValueHeaders(req.Context, httpReq.Header, c.ctxValues)
 
 	httpReq = httpReq.WithContext(req.Context)
 	httpReq.Close = true
@@ -156,29 +251,52 @@ func (c *client) Send(req *cmds.Request) (cmds.Response, error) {
 		req.Context = context.Background()
 	}
 
+	ignored, err := cmds.CheckUnknownOptions(req, c.unknownOptions)
+	if err != nil {
+		return nil, err
+	}
+	if len(ignored) > 0 {
+		log.Warningf("not sending unknown options of %q: %s", req.Path, strings.Join(ignored, ", "))
+	}
+
 	// save user-provided encoding
 	previousUserProvidedEncoding, found := req.Options[cmds.EncLong].(string)
 
-	// override with json to send to server
-	req.SetOption(cmds.EncLong, cmds.JSON)
+	// override with json to send to server, unless the server should
+	// negotiate the encoding
+	if len(c.encodings) > 0 {
+		delete(req.Options, cmds.EncLong)
+	} else {
+		req.SetOption(cmds.EncLong, cmds.JSON)
+	}
 
 	// stream channel output
 	req.SetOption(cmds.ChanOpt, true)
 
+	// the request is sent in the context of the span, so its trace is
+	// propagated to the server
+	ctx := req.Context
+	var span cmds.Span
+	req.Context, span = cmds.StartSpan(ctx, cmds.SendSpan)
+	span.SetPath(req.Path)
+
 	// build http request
 	httpReq, err := c.toHTTPRequest(req)
+	req.Context = ctx
 	if err != nil {
+		span.End(err)
 		return nil, err
 	}
-
-	// send http request
-	httpRes, err := c.httpClient.Do(httpReq)
-	if err != nil {
-		return nil, err
+	// the stdin of interactive commands is sent as it is read
+	if c.chunkSize > 0 && httpReq.Body != nil && httpReq.Body != http.NoBody && !req.Command.Interactive {
+		if err := c.stageUpload(req, httpReq); err != nil {
+			span.End(err)
+			return nil, err
+		}
 	}
 
-	// parse using the overridden JSON encoding in request
-	res, err := parseResponse(httpRes, req)
+	res, err := c.send(req, httpReq)
+	span.End(err)
 	if err != nil {
 		return nil, err
 	}
@@ -194,6 +312,90 @@ func (c *client) Send(req *cmds.Request) (cmds.Response, error) {
 	return res, nil
 }
 
+// SendTyped sends req using c and returns a response decoding the values
+// into fresh values of type T.
+func SendTyped[T any](c Client, req *cmds.Request) (cmds.TypedResponse[T], error) {
+	res, err := c.Send(req)
+	if err != nil {
+		return nil, err
+	}
+	return cmds.Typed[T](res), nil
+}
+
+// send sends httpReq, or answers it from the cache, and parses the response.
+func (c *client) send(req *cmds.Request, httpReq *http.Request) (cmds.Response, error) {
+	cacheKey, cached := c.cacheLookup(req, httpReq)
+	if cached != nil && time.Now().Before(cached.Expires) {
+		return parseResponse(cached.httpResponse(), req)
+	}
+
+	info := RequestInfo{Path: req.Path, Attempt: 1}
+
+	// the server is told to stop the command if the request is canceled
+	// before the response was received
+	stop := c.watchCancel(httpReq)
+
+	// send http request
+	httpRes, err := c.doRetrying(httpReq, &info)
+	if err != nil {
+		stop()
+		return nil, err
+	}
+	httpRes.Body = &cancelWatchBody{ReadCloser: httpRes.Body, stop: stop}
+
+	stats := cmds.StatsFromContext(req.Context)
+	if stats != nil {
+		httpRes.Body = &countingReadCloser{
+			countingReader: countingReader{r: httpRes.Body, count: stats.AddBytesReceived},
+			c:              httpRes.Body,
+		}
+	}
+	decodeBody(httpRes, stats)
+
+	if cacheKey != "" {
+		httpRes, err = c.cacheStore(cacheKey, cached, httpRes)
+		if err != nil {
+			stop()
+			c.hooks.onError(info, err)
+			return nil, err
+		}
+	}
+
+	// parse using the overridden JSON encoding in request
+	res, err := parseResponse(httpRes, req)
+	if err != nil {
+		stop()
+		c.hooks.onError(info, err)
+		return nil, err
+	}
+	c.hooks.onResponse(info)
+
+	if ignored := httpRes.Header.Get(ignoredOptionsHeader); ignored != "" {
+		log.Warningf("server ignored unknown options of %q: %s", req.Path, ignored)
+	}
+
+	return res, nil
+}
+
+// setHeaders sets the headers identifying the client.
+func (c *client) setHeaders(httpReq *http.Request) {
+	for k, vs := range c.header {
+		httpReq.Header[k] = append([]string(nil), vs...)
+	}
+	httpReq.Header.Set(uaHeader, c.ua)
+	httpReq.Header.Set(acceptEncodingHeader, acceptEncoding())
+	if len(c.encodings) > 0 {
+		httpReq.Header.Set(encodingPrefHeader, strings.Join(c.encodings, ", "))
+	}
+}
+
+// RequestQuery returns the URL query the options and string arguments of
+// req are sent in. File arguments are sent in the body and aren't part of
+// it.
+func RequestQuery(req *cmds.Request) (string, error) {
+	return getQuery(req)
+}
+
 func getQuery(req *cmds.Request) (string, error) {
 	query := url.Values{}
 
@@ -1,12 +1,24 @@
 package http
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	cmds "github.com/ipfs/go-ipfs-cmds"
+
+	"github.com/ipfs/go-ipfs-files"
 )
 
 func TestClientUserAgent(t *testing.T) {
@@ -52,6 +64,53 @@ func TestClientUserAgent(t *testing.T) {
 	}
 }
 
+func TestClientIdentity(t *testing.T) {
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"whoami": {
+				Type: cmds.Caller{},
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					return re.Emit(cmds.CallerFromContext(req.Context))
+				},
+			},
+		},
+	}
+
+	var proxyHeader string
+	h := NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, originCfg(defaultOrigins))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxyHeader = r.Header.Get("X-Proxy-Token")
+		h.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL,
+		ClientWithUserAgent("tool/1.0"),
+		ClientWithApp("desktop", "0.3.1"),
+		ClientWithHeader("X-Proxy-Token", "secret"),
+	)
+	req, err := cmds.NewRequest(context.Background(), []string{"whoami"}, nil, nil, nil, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := c.Send(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := res.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := cmds.Caller{UserAgent: "tool/1.0", App: "desktop", AppVersion: "0.3.1"}
+	if caller := v.(*cmds.Caller); *caller != expected {
+		t.Errorf("expected caller %+v but got %+v", expected, *caller)
+	}
+	if proxyHeader != "secret" {
+		t.Errorf("expected the extra header to be sent, got %q", proxyHeader)
+	}
+}
+
 func TestClientAPIPrefix(t *testing.T) {
 	type testcase struct {
 		host   string
@@ -91,3 +150,352 @@ func TestClientAPIPrefix(t *testing.T) {
 		}
 	}
 }
+
+func TestClientSkipsLocalOptions(t *testing.T) {
+	r := &cmds.Request{
+		Command: &cmds.Command{},
+		Root:    &cmds.Command{},
+		Options: map[string]interface{}{
+			"api":           "/ip4/127.0.0.1/tcp/5001",
+			cmds.ProfileOpt: "staging",
+			"quiet":         true,
+		},
+	}
+
+	query, err := getQuery(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if query != "quiet=true" {
+		t.Errorf("expected only the quiet option to be sent, got %q", query)
+	}
+}
+
+func TestClientStats(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		w.Header().Set(contentTypeHeader, "text/plain")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("0123456789"))
+	}))
+	defer s.Close()
+
+	ctx, stats := cmds.ContextWithStats(context.Background())
+	r := &cmds.Request{
+		Context: ctx,
+		Command: &cmds.Command{},
+		Root:    &cmds.Command{},
+		Files: files.NewSliceFile("", "", []files.File{
+			files.NewReaderFile("file", "file", ioutil.NopCloser(strings.NewReader("some data")), nil),
+		}),
+	}
+
+	c := NewClient(s.URL).(*client)
+	c.httpClient = s.Client()
+	res, err := c.Send(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := res.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.ReadAll(v.(io.Reader))
+
+	if sent := stats.BytesSent(); sent < uint64(len("some data")) {
+		t.Errorf("expected at least %d bytes sent, got %d", len("some data"), sent)
+	}
+	if received := stats.BytesReceived(); received != 10 {
+		t.Errorf("expected 10 bytes received, got %d", received)
+	}
+}
+
+func TestClientUploadProgress(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		w.Header().Set(contentTypeHeader, "text/plain")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer s.Close()
+
+	data := strings.Repeat("some data", 10000)
+	f, err := ioutil.TempFile("", "upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	f.WriteString(data)
+	f.Seek(0, io.SeekStart)
+	stat, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sent, total int64
+	ctx := WithUploadProgress(context.Background(), func(s, t int64) {
+		sent, total = s, t
+	})
+	r := &cmds.Request{
+		Context: ctx,
+		Command: &cmds.Command{},
+		Root:    &cmds.Command{},
+		Files: files.NewSliceFile("", "", []files.File{
+			files.NewReaderFile("file", "file", f, stat),
+		}),
+	}
+
+	c := NewClient(s.URL).(*client)
+	c.httpClient = s.Client()
+	if _, err := c.Send(r); err != nil {
+		t.Fatal(err)
+	}
+
+	if total != int64(len(data)) {
+		t.Errorf("expected a total of %d bytes, got %d", len(data), total)
+	}
+	if sent < total {
+		t.Errorf("expected at least %d bytes sent, got %d", total, sent)
+	}
+}
+
+func TestClientDecompression(t *testing.T) {
+	data := strings.Repeat("0123456789", 1000)
+
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write([]byte(data))
+	zw.Close()
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ae := r.Header.Get(acceptEncodingHeader); ae != acceptEncoding() {
+			t.Errorf("expected Accept-Encoding %q, got %q", acceptEncoding(), ae)
+		}
+		w.Header().Set(contentTypeHeader, "text/plain")
+		w.Header().Set(contentEncodingHeader, "gzip")
+		w.Header().Set("Trailer", StreamErrHeader)
+		w.WriteHeader(http.StatusOK)
+		w.Write(compressed.Bytes())
+		w.Header().Set(StreamErrHeader, "an error occurred")
+	}))
+	defer s.Close()
+
+	ctx, stats := cmds.ContextWithStats(context.Background())
+	r := &cmds.Request{Context: ctx, Command: &cmds.Command{}, Root: &cmds.Command{}}
+
+	c := NewClient(s.URL).(*client)
+	c.httpClient = s.Client()
+	res, err := c.Send(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := res.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := ioutil.ReadAll(v.(io.Reader))
+	if err == nil || err.Error() != "an error occurred" {
+		t.Errorf("expected the error from the trailer, got %v", err)
+	}
+	if string(body) != data {
+		t.Errorf("expected the decompressed body, got %d bytes", len(body))
+	}
+	if received := stats.BytesReceived(); received != uint64(compressed.Len()) {
+		t.Errorf("expected %d bytes received, got %d", compressed.Len(), received)
+	}
+	if decompressed := stats.BytesDecompressed(); decompressed != uint64(len(data)) {
+		t.Errorf("expected %d bytes decompressed, got %d", len(data), decompressed)
+	}
+}
+
+func TestSendTyped(t *testing.T) {
+	type version struct {
+		Version string
+		Commit  string
+	}
+
+	_, srv := getTestServer(t, nil) // handler_test:/^func getTestServer/
+	defer srv.Close()
+
+	req, err := cmds.NewRequest(context.Background(), []string{"version"}, nil, nil, nil, cmdRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// decode into T even if the command has no or another Type
+	req.Command = &cmds.Command{}
+
+	res, err := SendTyped[version](NewClient(srv.URL), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := res.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Version == "" {
+		t.Errorf("expected a version, got %+v", v)
+	}
+	if _, err := res.Next(); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
+
+func TestClientMultiaddr(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cmds-client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sock := filepath.Join(dir, "api.sock")
+	listeners, err := Listen("/ip4/127.0.0.1/tcp/0", "/unix"+sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHandler(testEnv{rootCtx: context.Background(), t: t}, cmdRoot, originCfg(defaultOrigins))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go Serve(ctx, h, listeners...)
+
+	port := listeners[0].Addr().(*net.TCPAddr).Port
+	for _, addr := range []string{
+		fmt.Sprintf("/ip4/127.0.0.1/tcp/%d", port),
+		fmt.Sprintf("/dns4/localhost/tcp/%d/http", port),
+		"/unix" + sock,
+		"unix://" + sock,
+	} {
+		req, err := cmds.NewRequest(context.Background(), []string{"version"}, nil, nil, nil, cmdRoot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := NewClient(addr).Send(req)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", addr, err)
+			continue
+		}
+		if _, err := res.Next(); err != nil {
+			t.Errorf("%s: unexpected error: %s", addr, err)
+		}
+	}
+}
+
+func TestClientHTTPS(t *testing.T) {
+	var proto string
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proto = r.Proto
+		w.Header().Set(contentTypeHeader, applicationJson)
+		w.Write([]byte(`"ok"` + "\n"))
+	}))
+	s.EnableHTTP2 = true
+	s.StartTLS()
+	defer s.Close()
+
+	r := &cmds.Request{
+		Context: context.Background(),
+		Command: &cmds.Command{},
+		Root:    &cmds.Command{},
+	}
+
+	c := NewClient(s.URL).(*client)
+	c.httpClient = s.Client()
+	if _, err := c.Send(r); err != nil {
+		t.Fatal(err)
+	}
+
+	if proto != "HTTP/2.0" {
+		t.Errorf("expected HTTP/2.0 but got %s", proto)
+	}
+}
+
+func TestClientHooks(t *testing.T) {
+	_, srv := getTestServer(t, nil) // handler_test:/^func getTestServer/
+	defer srv.Close()
+
+	var events []string
+	hooks := ClientHooks{
+		OnRequest: func(info RequestInfo) {
+			events = append(events, fmt.Sprintf("request %s %d", strings.Join(info.Path, "/"), info.Attempt))
+		},
+		OnResponse: func(info RequestInfo) {
+			events = append(events, fmt.Sprintf("response %s %d", strings.Join(info.Path, "/"), info.StatusCode))
+			if info.Duration <= 0 || info.Start.IsZero() {
+				t.Errorf("expected timing information, got %+v", info)
+			}
+		},
+		OnError: func(info RequestInfo, err error) {
+			events = append(events, fmt.Sprintf("error %s %d %s", strings.Join(info.Path, "/"), info.StatusCode, err))
+		},
+	}
+
+	c := NewClient(srv.URL, ClientWithHooks(hooks))
+	for _, path := range []string{"version", "error"} {
+		req, err := cmds.NewRequest(context.Background(), []string{path}, nil, nil, nil, cmdRoot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Send(req)
+	}
+
+	expected := []string{
+		"request version 1",
+		"response version 200",
+		"request error 1",
+		"error error 500 an error occurred",
+	}
+	if strings.Join(events, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected events\n%s\nbut got\n%s", strings.Join(expected, "\n"), strings.Join(events, "\n"))
+	}
+}
+
+func TestClientInteractive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cmds-interactive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	root := newReplRoot()
+	cfg := originCfg(defaultOrigins)
+	cfg.UploadDir = dir
+	srv := httptest.NewServer(NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, cfg))
+	defer srv.Close()
+
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	req, err := cmds.NewRequest(context.Background(), []string{"repl"}, nil, nil, files.NewSliceFile("", "", []files.File{
+		files.NewReaderFile("stdin", "", pr, nil),
+	}), root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// stdin isn't staged as an upload, and the response starts before the
+	// command emits anything
+	c := NewClient(srv.URL, ClientWithResumableUploads(4), ClientWithTimeout(time.Second))
+	res, err := c.Send(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{"hello", "world"} {
+		if _, err := io.WriteString(pw, line+"\n"); err != nil {
+			t.Fatal(err)
+		}
+		v, err := res.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != strings.ToUpper(line) {
+			t.Errorf("expected %q, got %v", strings.ToUpper(line), v)
+		}
+	}
+
+	pw.Close()
+	if _, err := res.Next(); err != io.EOF {
+		t.Errorf("expected EOF after the end of stdin, got %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+const (
+	// CompletionPath is the path prefix of the hidden completion endpoint.
+	// A request to <APIPath>/_complete/<command path>?arg=...&word=... returns
+	// the completions of the command's Complete hook as a JSON array.
+	CompletionPath = "_complete"
+
+	completionWordParam = "word"
+)
+
+// Completer is implemented by clients that can query a server for
+// completions, including the Client returned by NewClient:
+//
+//	if c, ok := client.(Completer); ok {
+//		completions, err := c.Complete(req, word)
+//		...
+//	}
+type Completer interface {
+	// Complete returns the completions for word given the partially filled
+	// in request req. req.Arguments holds the arguments typed before word.
+	Complete(req *cmds.Request, word string) ([]string, error)
+}
+
+var _ Completer = &client{}
+
+// isCompletionRequest checks whether pth (without leading slash) addresses
+// the completion endpoint.
+func isCompletionRequest(pth string) bool {
+	return pth == CompletionPath || strings.HasPrefix(pth, CompletionPath+"/")
+}
+
+func (h *handler) serveCompletion(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	pth := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/"), CompletionPath)
+	pth = strings.Trim(pth, "/")
+
+	var cmdPath []string
+	if pth != "" {
+		cmdPath = strings.Split(pth, "/")
+	}
+
+	query := r.URL.Query()
+	word := query.Get(completionWordParam)
+	args := query["arg"]
+
+	opts := make(cmdkit.OptMap)
+	for k, v := range query {
+		if k == "arg" || k == completionWordParam {
+			continue
+		}
+		opts[k] = v[0]
+	}
+
+	if _, err := h.root.Get(cmdPath); err != nil {
+		// 404 if there is no command at that path
+		http.Error(w, ErrNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	// args are incomplete, so don't check them like parseRequest does
+	req, err := cmds.NewRequest(ctx, cmdPath, opts, args, nil, h.root)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Complete hooks run code of the command
+	if !h.authorize(w, r, req) {
+		return
+	}
+
+	completions, err := cmds.Complete(req, h.env, word)
+	if err != nil {
+		http.Error(w, sanitizedErrStr(err), http.StatusInternalServerError)
+		return
+	}
+	if completions == nil {
+		completions = []string{}
+	}
+
+	w.Header().Set(contentTypeHeader, applicationJson)
+	if err := json.NewEncoder(w).Encode(completions); err != nil {
+		log.Error("error sending completions: ", err)
+	}
+}
+
+// Complete asks the server for the completions of word.
+func (c *client) Complete(req *cmds.Request, word string) ([]string, error) {
+	query := url.Values{}
+	for k, v := range req.Options {
+		if OptionSkipMap[k] {
+			continue
+		}
+		query.Set(k, fmt.Sprintf("%v", v))
+	}
+	for _, arg := range req.Arguments {
+		query.Add("arg", arg)
+	}
+	query.Set(completionWordParam, word)
+
+	path := strings.Join(append([]string{CompletionPath}, req.Path...), "/")
+	addr, _ := c.endpoints.pick(nil)
+	url := fmt.Sprintf(ApiUrlFormat, addr, c.apiPrefix, path, query.Encode())
+
+	httpReq, err := http.NewRequest("POST", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.setHeaders(httpReq)
+	if req.Context != nil {
+		httpReq = httpReq.WithContext(req.Context)
+	}
+
+	info := RequestInfo{Path: req.Path, Attempt: 1}
+	httpRes, err := c.do(httpReq, &info)
+	if err != nil {
+		if isConnRefused(err) {
+			err = ErrAPINotRunning
+		}
+		return nil, err
+	}
+	defer httpRes.Body.Close()
+	decodeBody(httpRes, nil)
+
+	if httpRes.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(httpRes.Body)
+		err := &cmdkit.Error{
+			Message: strings.TrimSpace(string(msg)),
+			Code:    cmdkit.ErrNormal,
+		}
+		c.hooks.onError(info, err)
+		return nil, err
+	}
+	c.hooks.onResponse(info)
+
+	var completions []string
+	err = json.NewDecoder(httpRes.Body).Decode(&completions)
+	return completions, err
+}
@@ -0,0 +1,128 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+var completeRoot = &cmds.Command{
+	Subcommands: map[string]*cmds.Command{
+		"pin": &cmds.Command{
+			Subcommands: map[string]*cmds.Command{
+				"rm": &cmds.Command{
+					Arguments: []cmdkit.Argument{
+						cmdkit.StringArg("ipfs-path", true, true, "Path to object(s) to be unpinned."),
+					},
+					Options: []cmdkit.Option{
+						cmdkit.IntOption("count", "Number of pins to remove."),
+					},
+					Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+						return nil
+					},
+					Complete: func(req *cmds.Request, env cmds.Environment, word string) ([]string, error) {
+						pins := []string{"QmA", "QmB", "zdC"}
+
+						// don't suggest pins that are already on the command line
+						var out []string
+					Pins:
+						for _, p := range pins {
+							for _, arg := range req.Arguments {
+								if arg == p {
+									continue Pins
+								}
+							}
+							out = append(out, p)
+						}
+						return out, nil
+					},
+				},
+			},
+		},
+		"fail": &cmds.Command{
+			Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+				return nil
+			},
+			Complete: func(req *cmds.Request, env cmds.Environment, word string) ([]string, error) {
+				return nil, errors.New("completion failed")
+			},
+		},
+	},
+}
+
+func TestComplete(t *testing.T) {
+	env := testEnv{rootCtx: context.Background(), t: t}
+	srv := httptest.NewServer(NewHandler(env, completeRoot, originCfg(defaultOrigins)))
+	defer srv.Close()
+
+	c := NewClient(srv.URL).(Completer)
+
+	type testcase struct {
+		path []string
+		args []string
+		word string
+		exp  []string
+		err  string
+	}
+
+	tcs := []testcase{
+		{path: []string{"pin", "rm"}, word: "Qm", exp: []string{"QmA", "QmB"}},
+		{path: []string{"pin", "rm"}, args: []string{"QmA"}, word: "Qm", exp: []string{"QmB"}},
+		{path: []string{"pin", "rm"}, exp: []string{"QmA", "QmB", "zdC"}},
+		{path: []string{"pin"}, word: "Qm", exp: []string{}},
+		{path: []string{"fail"}, err: "completion failed"},
+	}
+
+	for _, tc := range tcs {
+		req, err := cmds.NewRequest(context.Background(), tc.path, nil, tc.args, nil, completeRoot)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		completions, err := c.Complete(req, tc.word)
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("%v: expected error %q but got %v", tc.path, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error: %s", tc.path, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(completions, tc.exp) {
+			t.Errorf("%v: expected completions %v but got %v", tc.path, tc.exp, completions)
+		}
+	}
+}
+
+func TestCompleteStatus(t *testing.T) {
+	env := testEnv{rootCtx: context.Background(), t: t}
+	srv := httptest.NewServer(NewHandler(env, completeRoot, originCfg(defaultOrigins)))
+	defer srv.Close()
+
+	tcs := map[string]int{
+		"/_complete/pin/rm?word=Qm":           http.StatusOK,
+		"/_complete/pin/rm?word=Qm&count=abc": http.StatusBadRequest,
+		"/_complete/nope?word=Qm":             http.StatusNotFound,
+	}
+
+	for pth, status := range tcs {
+		res, err := http.Post(srv.URL+pth, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != status {
+			t.Errorf("%s: expected status %d but got %d", pth, status, res.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package http
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+const (
+	acceptEncodingHeader  = "Accept-Encoding"
+	contentEncodingHeader = "Content-Encoding"
+	varyHeader            = "Vary"
+)
+
+// preferredCodings are the content codings of cmds.Compressors preferred
+// over the others, best first.
+var preferredCodings = []cmds.CompressionType{cmds.Zstd, cmds.Gzip}
+
+// contentCodings returns the content codings of cmds.Compressors, the
+// preferred ones first.
+func contentCodings() []cmds.CompressionType {
+	codings := make([]cmds.CompressionType, 0, len(cmds.Compressors))
+	for _, ct := range preferredCodings {
+		if _, ok := cmds.Compressors[ct]; ok {
+			codings = append(codings, ct)
+		}
+	}
+
+	var others []string
+	for ct := range cmds.Compressors {
+		if !containsCoding(preferredCodings, ct) {
+			others = append(others, string(ct))
+		}
+	}
+	sort.Strings(others)
+	for _, ct := range others {
+		codings = append(codings, cmds.CompressionType(ct))
+	}
+	return codings
+}
+
+func containsCoding(codings []cmds.CompressionType, ct cmds.CompressionType) bool {
+	for _, c := range codings {
+		if c == ct {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptEncoding returns the Accept-Encoding header listing the content
+// codings the client decodes.
+func acceptEncoding() string {
+	codings := contentCodings()
+	names := make([]string, len(codings))
+	for i, ct := range codings {
+		names[i] = string(ct)
+	}
+	return strings.Join(names, ", ")
+}
+
+// negotiateContentCoding returns the content coding of cmds.Compressors with the
+// highest quality in the Accept-Encoding header ae, the most preferred one
+// on ties, or cmds.Identity if none is acceptable.
+func negotiateContentCoding(ae string) cmds.CompressionType {
+	qs := make(map[cmds.CompressionType]float64)
+	wildcard := -1.0
+	for _, part := range strings.Split(ae, ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		if coding == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) == 2 && strings.TrimSpace(kv[0]) == "q" {
+				if v, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64); err == nil {
+					q = v
+				}
+			}
+		}
+
+		if coding == "*" {
+			wildcard = q
+		} else {
+			qs[cmds.CompressionType(coding)] = q
+		}
+	}
+
+	best, bestQ := cmds.Identity, 0.0
+	for _, ct := range contentCodings() {
+		q, ok := qs[ct]
+		if !ok {
+			q = wildcard
+		}
+		if q > bestQ {
+			best, bestQ = ct, q
+		}
+	}
+	return best
+}
+
+// compressResponseWriter compresses the body of a response with a content
+// coding of cmds.Compressors. Every flush of the response emitter, after
+// each value or batch of values with ServerConfig.Buffer, flushes the data
+// compressed so far, so streams are sent as they are emitted.
+//
+// Responses without a body, like 304 Not Modified, aren't compressed.
+type compressResponseWriter struct {
+	http.ResponseWriter
+	ct cmds.CompressionType
+
+	l           sync.Mutex
+	wroteHeader bool
+	// identity is set if the body isn't compressed.
+	identity bool
+	cw       cmds.CompressWriter
+	closed   bool
+}
+
+func newCompressResponseWriter(w http.ResponseWriter, ct cmds.CompressionType) *compressResponseWriter {
+	return &compressResponseWriter{ResponseWriter: w, ct: ct}
+}
+
+func (w *compressResponseWriter) WriteHeader(status int) {
+	w.l.Lock()
+	defer w.l.Unlock()
+	w.writeHeader(status)
+}
+
+func (w *compressResponseWriter) writeHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	h := w.Header()
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified || h.Get(contentEncodingHeader) != "" {
+		w.identity = true
+	} else {
+		h.Set(contentEncodingHeader, string(w.ct))
+		h.Del("Content-Length")
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *compressResponseWriter) Write(p []byte) (int, error) {
+	w.l.Lock()
+	defer w.l.Unlock()
+
+	w.writeHeader(http.StatusOK)
+	if w.identity {
+		return w.ResponseWriter.Write(p)
+	}
+	if w.closed {
+		return 0, io.ErrClosedPipe
+	}
+	if w.cw == nil {
+		w.cw = cmds.Compressors[w.ct].NewWriter(w.ResponseWriter)
+	}
+	return w.cw.Write(p)
+}
+
+// Flush sends the data compressed so far.
+func (w *compressResponseWriter) Flush() {
+	w.l.Lock()
+	defer w.l.Unlock()
+
+	if w.cw != nil && !w.closed {
+		if err := w.cw.Flush(); err != nil {
+			log.Debugf("error flushing compressed response: %s", err)
+			return
+		}
+	}
+	flush(w.ResponseWriter)
+}
+
+// Close writes the end of the compressed data, the response can't be
+// written to afterwards.
+func (w *compressResponseWriter) Close() error {
+	w.l.Lock()
+	defer w.l.Unlock()
+
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if w.cw == nil {
+		return nil
+	}
+	return w.cw.Close()
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController.
+func (w *compressResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// decodeBody transparently decompresses the body of httpRes if the server
+// compressed it, counting the decompressed bytes in stats.
+func decodeBody(httpRes *http.Response, stats *cmds.Stats) {
+	c, ok := cmds.Compressors[cmds.CompressionType(httpRes.Header.Get(contentEncodingHeader))]
+	if !ok {
+		return
+	}
+
+	httpRes.Body = &decompressBody{body: httpRes.Body, newReader: c.NewReader, count: stats.AddBytesDecompressed}
+	httpRes.Header.Del(contentEncodingHeader)
+	httpRes.Header.Del("Content-Length")
+	httpRes.ContentLength = -1
+	httpRes.Uncompressed = true
+}
+
+// decompressBody decompresses a response body. The header of the
+// compressed data is only read on the first Read, so streaming responses
+// aren't waited for before they are parsed.
+type decompressBody struct {
+	body      io.ReadCloser
+	newReader func(io.Reader) (io.ReadCloser, error)
+	zr        io.ReadCloser
+	count     func(uint64)
+}
+
+func (b *decompressBody) Read(p []byte) (int, error) {
+	if b.zr == nil {
+		zr, err := b.newReader(b.body)
+		if err != nil {
+			return 0, err
+		}
+		b.zr = zr
+	}
+
+	n, err := b.zr.Read(p)
+	b.count(uint64(n))
+	if err == io.EOF {
+		// read to the end of the body, so the trailer is available
+		io.Copy(ioutil.Discard, b.body)
+	}
+	if err != nil {
+		b.zr.Close()
+	}
+	return n, err
+}
+
+// Close closes the body, a concurrent Read fails and releases the reader.
+func (b *decompressBody) Close() error {
+	return b.body.Close()
+}
@@ -0,0 +1,138 @@
+package http
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+func TestNegotiateContentCoding(t *testing.T) {
+	for _, tc := range []struct {
+		ae       string
+		expected cmds.CompressionType
+	}{
+		{"", cmds.Identity},
+		{"identity", cmds.Identity},
+		{"br", cmds.Identity},
+		{"gzip", cmds.Gzip},
+		{"gzip, zstd", cmds.Zstd},
+		{"GZIP, deflate", cmds.Gzip},
+		{"gzip;q=1.0, zstd;q=0.5", cmds.Gzip},
+		{"zstd;q=0, gzip;q=0.1", cmds.Gzip},
+		{"*", cmds.Zstd},
+		{"*;q=0.5, zstd;q=0", cmds.Gzip},
+		{"*;q=0", cmds.Identity},
+	} {
+		if ct := negotiateContentCoding(tc.ae); ct != tc.expected {
+			t.Errorf("%q: expected %q, got %q", tc.ae, tc.expected, ct)
+		}
+	}
+}
+
+func TestCompressResponses(t *testing.T) {
+	received := make(chan struct{}, 2)
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"stream": {
+				Streaming: true,
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					for i := 0; i < 2; i++ {
+						if err := re.Emit(i); err != nil {
+							return err
+						}
+						// every value reaches the client before the next one
+						// is emitted
+						select {
+						case <-received:
+						case <-req.Context.Done():
+							return req.Context.Err()
+						}
+					}
+					return nil
+				},
+				Type: 0,
+			},
+		},
+	}
+
+	cfg := originCfg(defaultOrigins)
+	cfg.CompressResponses = true
+	srv := httptest.NewServer(NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, cfg))
+	defer srv.Close()
+
+	ctx, stats := cmds.ContextWithStats(context.Background())
+	req, err := cmds.NewRequest(ctx, []string{"stream"}, nil, nil, nil, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := NewClient(srv.URL).Send(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		v, err := res.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != i {
+			t.Errorf("expected %d, got %v", i, v)
+		}
+		received <- struct{}{}
+	}
+	if _, err := res.Next(); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+	if stats.BytesDecompressed() == 0 {
+		t.Error("expected the client to decompress the response")
+	}
+
+	for _, tc := range []struct {
+		ae, query, expected string
+	}{
+		{"gzip", "", "gzip"},
+		{"identity", "", ""},
+		// buffered responses are compressed as a whole
+		{"gzip", "?" + cmds.BufferOpt + "=true", "gzip"},
+	} {
+		// the values aren't waited for
+		received <- struct{}{}
+		received <- struct{}{}
+
+		httpReq, _ := http.NewRequest(http.MethodPost, srv.URL+"/stream"+tc.query, nil)
+		httpReq.Header.Set(acceptEncodingHeader, tc.ae)
+		httpRes, err := http.DefaultTransport.RoundTrip(httpReq)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var body io.Reader = httpRes.Body
+		if ce := httpRes.Header.Get(contentEncodingHeader); ce != tc.expected {
+			t.Errorf("%s: expected Content-Encoding %q, got %q", tc.ae, tc.expected, ce)
+		} else if ce == "gzip" {
+			if body, err = gzip.NewReader(httpRes.Body); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if buffered := tc.query != ""; buffered != (httpRes.ContentLength >= 0) {
+			t.Errorf("%s%s: unexpected Content-Length %d", tc.ae, tc.query, httpRes.ContentLength)
+		}
+		if vary := httpRes.Header.Get(varyHeader); vary != acceptEncodingHeader {
+			t.Errorf("%s: expected Vary %q, got %q", tc.ae, acceptEncodingHeader, vary)
+		}
+
+		b, err := ioutil.ReadAll(body)
+		httpRes.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != "0\n1\n" {
+			t.Errorf("%s: unexpected body %q", tc.ae, b)
+		}
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"net/http"
 	"net/url"
 	"sync"
+	"time"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
 
 	cors "github.com/rs/cors"
 )
@@ -22,6 +25,155 @@ type ServerConfig struct {
 	// Headers is an optional map of headers that is written out.
 	Headers map[string][]string
 
+	// AccessLog is called after every request if set, e.g. with
+	// CombinedAccessLog(os.Stderr).
+	AccessLog AccessLogger
+
+	// HealthChecks enables the /healthz endpoint if set. It answers 200 if
+	// all checks pass and 503 otherwise, listing the result of every check
+	// by name. The path is not prefixed with APIPath and takes precedence
+	// over a command named healthz.
+	HealthChecks map[string]HealthCheck
+
+	// ReadyChecks enables the /readyz endpoint, like HealthChecks.
+	ReadyChecks map[string]HealthCheck
+
+	// MaxRequests limits the number of requests executing at the same time,
+	// not counting requests for commands marked Streaming, which are limited
+	// by MaxStreamingRequests. Requests over the limit are answered with 429
+	// Too Many Requests. Zero means no limit.
+	MaxRequests          int
+	MaxStreamingRequests int
+
+	// CommandLimits limits the number of requests executing at the same
+	// time for the commands at its paths and their subcommands, in
+	// addition to MaxRequests and MaxStreamingRequests. Paths are space
+	// separated, e.g. "dag export", requests count against the limit of the
+	// longest matching path.
+	CommandLimits map[string]int
+
+	// ClientRate limits the requests every client may send per second,
+	// allowing bursts of ClientBurst requests, which defaults to one.
+	// Requests over the rate are answered with 429 Too Many Requests before
+	// they are parsed, with the time until the client may send the next
+	// one in Retry-After. Clients are told apart by ClientKey, which
+	// defaults to the host of the remote address; set it to e.g. read the
+	// address from a header set by a trusted proxy. Zero means no limit.
+	ClientRate  float64
+	ClientBurst int
+	ClientKey   func(r *http.Request) string
+
+	// RetryAfter is sent in the Retry-After header of 429 responses. It is
+	// rounded up to seconds and defaults to one second.
+	RetryAfter time.Duration
+
+	// MaxDuration limits the time commands may execute, CommandMaxDurations
+	// the time of the commands at its paths and their subcommands, like
+	// CommandLimits. The deadline is set on the context of the request, the
+	// cmds.TimeoutOpt of clients can only shorten it. Once it expires, the
+	// response is closed with an error even if the command doesn't watch
+	// its context. Zero means no limit.
+	MaxDuration         time.Duration
+	CommandMaxDurations map[string]time.Duration
+
+	// HeartbeatInterval makes the handler write a newline to JSON and XML
+	// responses after every interval in which the command emitted nothing,
+	// so proxies don't drop the connection while a slow command produces no
+	// output. Decoders skip the newlines. For commands declaring a Type,
+	// heartbeats start right away, with the response headers sent once the
+	// command is idle before its first value, after which errors are sent in
+	// the trailer; for other commands, e.g. those emitting readers, they
+	// start once the first value was sent.
+	HeartbeatInterval time.Duration
+
+	// BufferResponses makes the handler send every response at once, with
+	// the Content-Length set and errors in headers instead of trailers, for
+	// clients and proxies that can't handle streamed responses. Clients can
+	// request this for single requests with the cmds.BufferOpt option.
+	BufferResponses bool
+
+	// CompressResponses makes the handler compress the responses of
+	// commands with the content coding of cmds.Compressors the request
+	// prefers in its Accept-Encoding header, e.g. zstd or gzip. Streamed
+	// values are flushed as usual, the Client decompresses transparently.
+	CompressResponses bool
+
+	// Buffer batches the values commands emit if its Size is set, so
+	// commands emitting many small values write and flush the response in
+	// batches instead of once per value, see cmds.NewBufferedEmitter.
+	Buffer cmds.BufferOptions
+
+	// ContextValues declares the values of the request context clients may
+	// send, which the handler restores in the context of the request.
+	ContextValues []ContextValue
+
+	// MakeEnvironment, if set, makes a new environment for every request,
+	// which is passed to the command instead of the environment of the
+	// handler. If it implements cmds.EnvironmentCloser, it is closed once
+	// the response was sent, even if the command panicked.
+	MakeEnvironment cmds.MakeEnvironment
+
+	// UnknownOptions selects how the handler treats options the commands
+	// don't define, e.g. options sent by newer clients. Options the handler
+	// ignores are listed in the X-Ignored-Options header of the response,
+	// so clients can warn about them. It defaults to passing them on to the
+	// command, which usually ignores them silently.
+	UnknownOptions cmds.UnknownOptionPolicy
+
+	// Metrics, if set, collects the throughput metrics of every command
+	// served, see cmds.NewInstrumentedEmitter. Bytes counts the bytes of
+	// the response body. A cmds.StartCollector is started when the command
+	// starts, see package prometheus for a collector exporting the metrics.
+	Metrics cmds.MetricsCollector
+
+	// Authorizer, if set, decides which commands clients may run. It is
+	// called before the command runs or the request is validated and can
+	// reject the request, see AllowCommands and BearerToken. Completions,
+	// descriptions and staged uploads are authorized as requests for their
+	// command without options, the OpenAPI document as a request for the
+	// root command.
+	Authorizer Authorizer
+
+	// Executor, if set, executes the commands instead of the handler
+	// calling them, e.g. an executor wrapped in cmds.Middleware that is
+	// also used by the CLI. It gets the emitter of the response, after
+	// the server-side PostRun and metrics, and must close it.
+	Executor cmds.Executor
+
+	// Upgraders serve the requests asking to switch to another protocol,
+	// keyed by the lowercase name of the protocol in the Upgrade header,
+	// e.g. "websocket". Requests for other protocols are served over HTTP.
+	Upgraders map[string]Upgrader
+
+	// Dumper dumps the requests and responses of selected commands while it
+	// is enabled, see NewDumper.
+	Dumper *Dumper
+
+	// PanicHandler is called if a command or encoder panics while serving a
+	// request, with the incident id sent to the client, the value passed to
+	// panic and the stack trace.
+	PanicHandler func(incident string, v interface{}, stack []byte)
+
+	// UploadDir enables resumable uploads if set, see UploadPath. The
+	// bodies of requests are staged in this directory until the command
+	// is sent, and removed once it was served or after UploadTTL, which
+	// defaults to DefaultUploadTTL, if no command used them. Staging is
+	// authorized for the command the upload is staged for, see Authorizer.
+	UploadDir string
+	UploadTTL time.Duration
+	// MaxUploadSize, if positive, is the size in bytes a staged upload
+	// can grow to. Chunks writing past it are rejected with 413 Request
+	// Entity Too Large.
+	MaxUploadSize int64
+	// MaxUploads, if positive, is the number of uploads that can be
+	// staged at the same time. Further uploads are rejected with 503
+	// Service Unavailable until one was used or expired.
+	MaxUploads int
+
+	// APIInfo is the info object of the OpenAPI document served at
+	// OpenAPIPath. The title defaults to "API".
+	APIInfo OpenAPIInfo
+
 	// corsOpts is a set of options for CORS headers.
 	corsOpts *cors.Options
 
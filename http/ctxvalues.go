@@ -0,0 +1,74 @@
+package http
+
+import (
+	"context"
+	"net/http"
+)
+
+// ContextValue declares a value of the request context, e.g. an
+// authenticated identity, a tenant or trace baggage, that is propagated
+// from the client to the handler in a header, see ClientWithContextValues
+// and ServerConfig.ContextValues. Only declared values are propagated.
+//
+// The handler trusts the values the clients send, so values conveying
+// privileges should only be accepted from trusted clients, e.g. behind an
+// authenticating proxy.
+type ContextValue struct {
+	// Header is the name of the header carrying the value.
+	Header string
+	// Encode returns the header value of the value in ctx, or "" if ctx
+	// doesn't hold a value.
+	Encode func(ctx context.Context) string
+	// Decode returns ctx with the value of the header restored.
+	Decode func(ctx context.Context, value string) (context.Context, error)
+}
+
+// StringContextValue returns a ContextValue propagating the string stored
+// in the context under key.
+func StringContextValue(header string, key interface{}) ContextValue {
+	return ContextValue{
+		Header: header,
+		Encode: func(ctx context.Context) string {
+			s, _ := ctx.Value(key).(string)
+			return s
+		},
+		Decode: func(ctx context.Context, value string) (context.Context, error) {
+			return context.WithValue(ctx, key, value), nil
+		},
+	}
+}
+
+// ClientWithContextValues makes the client send the values of the request
+// context declared by vals to the server.
+func ClientWithContextValues(vals ...ContextValue) ClientOpt {
+	return func(c *client) {
+		c.ctxValues = append(c.ctxValues, vals...)
+	}
+}
+
+// setContextValueHeaders sets the headers of the values of ctx declared in
+// vals.
+func setContextValueHeaders(ctx context.Context, h http.Header, vals []ContextValue) {
+	for _, cv := range vals {
+		if v := cv.Encode(ctx); v != "" {
+			h.Set(cv.Header, v)
+		}
+	}
+}
+
+// restoreContextValues returns ctx with the values declared in vals that
+// were sent in h.
+func restoreContextValues(ctx context.Context, h http.Header, vals []ContextValue) (context.Context, error) {
+	for _, cv := range vals {
+		v := h.Get(cv.Header)
+		if v == "" {
+			continue
+		}
+
+		var err error
+		if ctx, err = cv.Decode(ctx, v); err != nil {
+			return nil, err
+		}
+	}
+	return ctx, nil
+}
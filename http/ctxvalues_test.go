@@ -0,0 +1,54 @@
+package http
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+type ctxKey string
+
+func TestContextValues(t *testing.T) {
+	tenant := StringContextValue("X-Tenant", ctxKey("tenant"))
+	secret := StringContextValue("X-Secret", ctxKey("secret"))
+
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"whoami": {
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					t, _ := req.Context.Value(ctxKey("tenant")).(string)
+					s, _ := req.Context.Value(ctxKey("secret")).(string)
+					return re.Emit(t + "/" + s)
+				},
+			},
+		},
+	}
+
+	cfg := originCfg(defaultOrigins)
+	cfg.ContextValues = []ContextValue{tenant}
+	srv := httptest.NewServer(NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, cfg))
+	defer srv.Close()
+
+	ctx := context.WithValue(context.Background(), ctxKey("tenant"), "acme")
+	ctx = context.WithValue(ctx, ctxKey("secret"), "s3cr3t")
+	req, err := cmds.NewRequest(ctx, []string{"whoami"}, nil, nil, nil, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := NewClient(srv.URL, ClientWithContextValues(tenant, secret)).Send(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := res.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// values the server doesn't declare aren't restored
+	if v != "acme/" {
+		t.Errorf("expected %q but got %q", "acme/", v)
+	}
+}
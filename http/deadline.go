@@ -0,0 +1,81 @@
+package http
+
+import (
+	"context"
+	"time"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+// maxDurations holds the maximum durations of the commands, see
+// ServerConfig.MaxDuration.
+type maxDurations struct {
+	def       time.Duration
+	paths     [][]string
+	durations []time.Duration
+}
+
+func newMaxDurations(def time.Duration, durations map[string]time.Duration) *maxDurations {
+	md := &maxDurations{def: def}
+	for p, d := range durations {
+		md.paths = append(md.paths, splitPaths([]string{p})[0])
+		md.durations = append(md.durations, d)
+	}
+	if md.def <= 0 && len(md.paths) == 0 {
+		return nil
+	}
+	return md
+}
+
+// get returns the maximum duration of the command at path, zero if it
+// isn't limited.
+func (md *maxDurations) get(path []string) time.Duration {
+	if md == nil {
+		return 0
+	}
+	if i := longestPath(md.paths, path); i >= 0 {
+		return md.durations[i]
+	}
+	return md.def
+}
+
+// withMaxDuration sets the deadline of the context of req to max from now.
+// It returns the error the context is canceled with once the deadline
+// expires, see closeOnExpiry, and the function releasing the deadline.
+func withMaxDuration(req *cmds.Request, max time.Duration) (*cmdkit.Error, context.CancelFunc) {
+	expired := &cmdkit.Error{
+		Message: "command exceeded the maximum duration of " + max.String(),
+		Code:    cmdkit.ErrNormal,
+	}
+
+	var cancel context.CancelFunc
+	req.Context, cancel = context.WithTimeoutCause(req.Context, max, expired)
+	return expired, cancel
+}
+
+// closeOnExpiry closes re with expired once the deadline set by
+// withMaxDuration expires, even if the command doesn't watch its context;
+// it fails to emit afterwards. The returned function stops waiting for the
+// deadline, or for re to be closed if it expired, and must be called before
+// the handler returns.
+func closeOnExpiry(req *cmds.Request, re cmds.ResponseEmitter, expired *cmdkit.Error) func() {
+	ctx := req.Context
+	fired := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		defer close(fired)
+		if context.Cause(ctx) != error(expired) {
+			// canceled by the client or the handler
+			return
+		}
+		if err := re.CloseWithError(expired); err != nil && err != cmds.ErrClosingClosedEmitter {
+			log.Errorf("error closing ResponseEmitter after the maximum duration: %s", err)
+		}
+	})
+
+	return func() {
+		if !stop() {
+			<-fired
+		}
+	}
+}
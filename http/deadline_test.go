@@ -0,0 +1,75 @@
+package http
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+func TestMaxDuration(t *testing.T) {
+	emitted := make(chan error, 1)
+	// ignores its context
+	slow := func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		if err := re.Emit("first"); err != nil {
+			return err
+		}
+		time.Sleep(300 * time.Millisecond)
+		err := re.Emit("second")
+		emitted <- err
+		return err
+	}
+
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"slow":  {Run: slow, Type: ""},
+			"quick": {Run: slow, Type: ""},
+		},
+	}
+
+	cfg := originCfg(defaultOrigins)
+	cfg.MaxDuration = 100 * time.Millisecond
+	cfg.CommandMaxDurations = map[string]time.Duration{"quick": time.Minute}
+	srv := httptest.NewServer(NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, cfg))
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		path    string
+		expired bool
+	}{
+		{"slow", true},
+		{"quick", false},
+	} {
+		req, err := cmds.NewRequest(context.Background(), []string{tc.path}, nil, nil, nil, root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := NewClient(srv.URL).Send(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var values []interface{}
+		for {
+			v, err := res.Next()
+			if err != nil {
+				if expired := err != io.EOF; expired != tc.expired || (expired && !strings.Contains(err.Error(), "maximum duration of 100ms")) {
+					t.Errorf("%s: unexpected error %v", tc.path, err)
+				}
+				break
+			}
+			values = append(values, v)
+		}
+		if expected := map[bool]int{true: 1, false: 2}[tc.expired]; len(values) != expected {
+			t.Errorf("%s: expected %d values but got %v", tc.path, expected, values)
+		}
+
+		if err := <-emitted; (err != nil) != tc.expired {
+			t.Errorf("%s: unexpected error emitting after the deadline: %v", tc.path, err)
+		}
+	}
+}
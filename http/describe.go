@@ -0,0 +1,128 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+// CommandDescription is the machine-readable description of a command the
+// handler answers OPTIONS requests on the command's path with.
+type CommandDescription struct {
+	// Path is the path of the command.
+	Path    []string `json:"path"`
+	Tagline string   `json:"tagline,omitempty"`
+
+	Arguments []ArgumentDescription `json:"arguments"`
+	// Options holds the options of the command, including the ones it
+	// inherits from its parents.
+	Options []OptionDescription `json:"options"`
+	// Encodings are the encodings the output can be requested in.
+	Encodings []string `json:"encodings"`
+	// Methods are the HTTP methods the command can be called with.
+	Methods []string `json:"methods"`
+	// Streaming is whether the command emits a stream of values.
+	Streaming bool `json:"streaming"`
+	// Runnable is false for commands that only group subcommands.
+	Runnable    bool     `json:"runnable"`
+	Subcommands []string `json:"subcommands"`
+}
+
+// ArgumentDescription describes an argument of a command.
+type ArgumentDescription = cmds.ArgumentDescription
+
+// OptionDescription describes an option of a command.
+type OptionDescription = cmds.OptionDescription
+
+// defaultMethods are the methods allowed if the configuration doesn't set
+// any, matching the CORS defaults.
+var defaultMethods = []string{http.MethodGet, http.MethodPost, http.MethodHead}
+
+// describeCommand returns the description of the command at path.
+func describeCommand(root *cmds.Command, path []string, methods []string) (*CommandDescription, error) {
+	chain, err := root.Resolve(path)
+	if err != nil {
+		return nil, err
+	}
+	cmd := chain[len(chain)-1]
+
+	if len(methods) == 0 {
+		methods = defaultMethods
+	}
+
+	desc := &CommandDescription{
+		Path:        path,
+		Tagline:     cmd.Helptext.Tagline,
+		Arguments:   cmds.DescribeArguments(cmd),
+		Options:     cmds.DescribeOptions(chain...),
+		Encodings:   describeEncodings(cmd),
+		Methods:     append(append([]string{}, methods...), http.MethodOptions),
+		Streaming:   cmd.Streaming,
+		Runnable:    cmd.Run != nil,
+		Subcommands: []string{},
+	}
+	if desc.Path == nil {
+		desc.Path = []string{}
+	}
+
+	for name, sub := range cmd.Subcommands {
+		if !sub.Hidden {
+			desc.Subcommands = append(desc.Subcommands, name)
+		}
+	}
+	sort.Strings(desc.Subcommands)
+
+	return desc, nil
+}
+
+// describeEncodings returns the sorted encodings of the output of cmd.
+func describeEncodings(cmd *cmds.Command) []string {
+	seen := make(map[cmds.EncodingType]bool)
+	for enc := range cmds.Encoders {
+		seen[enc] = true
+	}
+	for enc := range cmd.Encoders {
+		seen[enc] = true
+	}
+	for _, enc := range cmd.TypedEncoders.Encodings() {
+		seen[enc] = true
+	}
+	for _, enc := range cmds.DefaultEncoders.Encodings() {
+		seen[enc] = true
+	}
+
+	encs := make([]string, 0, len(seen))
+	for enc := range seen {
+		encs = append(encs, string(enc))
+	}
+	sort.Strings(encs)
+	return encs
+}
+
+// serveDescription answers an OPTIONS request on the path of a command with
+// the description of the command.
+func (h *handler) serveDescription(w http.ResponseWriter, r *http.Request) {
+	var path []string
+	if pth := strings.Trim(r.URL.Path, "/"); pth != "" {
+		path = strings.Split(pth, "/")
+	}
+
+	if !h.authorizePath(w, r, path) {
+		return
+	}
+
+	desc, err := describeCommand(h.root, path, h.cfg.AllowedMethods())
+	if err != nil {
+		http.Error(w, ErrNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Allow", strings.Join(desc.Methods, ", "))
+	w.Header().Set(contentTypeHeader, applicationJson)
+	if err := json.NewEncoder(w).Encode(desc); err != nil {
+		log.Debugf("error sending the description of %q: %s", path, err)
+	}
+}
@@ -0,0 +1,99 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+func TestHandlerDescribe(t *testing.T) {
+	root := &cmds.Command{
+		Options: []cmdkit.Option{cmdkit.BoolOption("verbose", "v", "print more")},
+		Subcommands: map[string]*cmds.Command{
+			"add": {
+				Helptext:  cmdkit.HelpText{Tagline: "add files"},
+				Arguments: []cmdkit.Argument{cmdkit.FileArg("file", true, true, "the files to add")},
+				Options:   []cmdkit.Option{cmdkit.IntOption("chunks", "the number of chunks").WithDefault(1)},
+				Streaming: true,
+				Encoders: cmds.EncoderMap{
+					"custom": cmds.Encoders[cmds.Text],
+				},
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					t.Error("OPTIONS requests must not run the command")
+					return nil
+				},
+			},
+			"secret": {Hidden: true},
+		},
+	}
+
+	cfg := originCfg(defaultOrigins)
+	cfg.SetAllowedMethods("POST")
+	srv := httptest.NewServer(NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, cfg))
+	defer srv.Close()
+
+	describe := func(path string) (*http.Response, *CommandDescription) {
+		r, err := http.NewRequest(http.MethodOptions, srv.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			return res, nil
+		}
+		var desc CommandDescription
+		if err := json.NewDecoder(res.Body).Decode(&desc); err != nil {
+			t.Fatal(err)
+		}
+		return res, &desc
+	}
+
+	res, desc := describe("/add")
+	if desc == nil {
+		t.Fatalf("unexpected status %d", res.StatusCode)
+	}
+	if allow := res.Header.Get("Allow"); allow != "POST, OPTIONS" {
+		t.Errorf("unexpected Allow header %q", allow)
+	}
+	if strings.Join(desc.Path, "/") != "add" || desc.Tagline != "add files" || !desc.Streaming || !desc.Runnable {
+		t.Errorf("unexpected description %+v", desc)
+	}
+	if len(desc.Arguments) != 1 || desc.Arguments[0].Kind != "file" || !desc.Arguments[0].Variadic {
+		t.Errorf("unexpected arguments %+v", desc.Arguments)
+	}
+	if len(desc.Options) != 2 || desc.Options[0].Names[0] != "verbose" || desc.Options[1].Names[0] != "chunks" {
+		t.Errorf("expected the inherited and the own option, got %+v", desc.Options)
+	}
+	if !contains(desc.Encodings, "custom") || !contains(desc.Encodings, cmds.JSON) {
+		t.Errorf("unexpected encodings %v", desc.Encodings)
+	}
+
+	_, desc = describe("/")
+	if desc == nil || desc.Runnable || strings.Join(desc.Subcommands, ",") != "add" {
+		t.Errorf("expected the root to list the visible subcommands, got %+v", desc)
+	}
+
+	if res, _ := describe("/missing"); res.StatusCode != http.StatusNotFound {
+		t.Errorf("expected status %d but got %d", http.StatusNotFound, res.StatusCode)
+	}
+}
+
+func contains(strs []string, s string) bool {
+	for _, str := range strs {
+		if str == s {
+			return true
+		}
+	}
+	return false
+}
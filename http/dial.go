@@ -0,0 +1,100 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// serverURL returns the URL of the server at addr, which is one of
+//   - a URL, e.g. https://example.com:5001,
+//   - a host and port that is sent plain HTTP requests, e.g. localhost:5001,
+//   - a multiaddr, e.g. /ip4/127.0.0.1/tcp/5001 or /unix/var/run/api.sock,
+//     optionally ending in /http or /https,
+//   - the path of a unix socket prefixed with "unix:", e.g.
+//     unix:///var/run/api.sock.
+//
+// Unix sockets are stood in for by a made up host that is dialed by the
+// transport set up in dialUnixSockets.
+func (c *client) serverURL(addr string) string {
+	isUnix := strings.HasPrefix(addr, "unix:")
+	if !strings.HasPrefix(addr, "/") && !isUnix {
+		if !strings.HasPrefix(addr, "http://") && !strings.HasPrefix(addr, "https://") {
+			addr = "http://" + addr
+		}
+		return addr
+	}
+
+	scheme := "http"
+	switch {
+	case isUnix:
+	case strings.HasSuffix(addr, "/https"):
+		scheme = "https"
+		addr = strings.TrimSuffix(addr, "/https")
+	default:
+		addr = strings.TrimSuffix(addr, "/http")
+	}
+
+	network, address, err := parseListenAddr(addr)
+	if err != nil {
+		// requests to the address fail, there is no way to report it here
+		log.Errorf("invalid API address: %s", err)
+		return scheme + "://" + addr
+	}
+
+	if network == "unix" {
+		if c.sockets == nil {
+			c.sockets = make(map[string]string)
+		}
+		host := fmt.Sprintf("unix-socket-%d", len(c.sockets))
+		for h, path := range c.sockets {
+			if path == address {
+				host = h
+			}
+		}
+		c.sockets[host] = address
+		address = host
+	}
+
+	return scheme + "://" + address
+}
+
+// dialUnixSockets makes the HTTP client connect to the unix sockets of the
+// server URLs.
+func (c *client) dialUnixSockets() {
+	if len(c.sockets) == 0 {
+		return
+	}
+
+	var t *http.Transport
+	switch rt := c.httpClient.Transport.(type) {
+	case nil:
+		t = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		t = rt.Clone()
+	default:
+		log.Errorf("can't dial unix sockets with a %T transport", rt)
+		return
+	}
+
+	dial := t.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	sockets := c.sockets
+	t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err == nil {
+			if path, ok := sockets[host]; ok {
+				return dial(ctx, "unix", path)
+			}
+		}
+		return dial(ctx, network, addr)
+	}
+
+	hc := *c.httpClient
+	hc.Transport = t
+	c.httpClient = &hc
+}
@@ -0,0 +1,306 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DumpEnv is the environment variable read by Dumper.EnableFromEnv. It holds
+// a comma separated list of command paths, e.g. "add,pin ls", or "*" for all
+// commands.
+const DumpEnv = "CMDS_HTTP_DUMP"
+
+// maxDumpBody is the number of body bytes dumped per request and response.
+const maxDumpBody = 64 << 10
+
+// Dumper writes the requests and responses of the selected commands to a
+// writer, for diagnosing protocol problems. It is disabled until one of the
+// Enable methods is called, and can be toggled at runtime, e.g. by a signal
+// or through its admin endpoint (see ServeHTTP).
+//
+// Set ServerConfig.Dumper to use it with a handler.
+type Dumper struct {
+	w io.Writer
+
+	l sync.RWMutex
+	// paths are the selected command paths, nil if disabled. An empty
+	// path selects all commands.
+	paths [][]string
+}
+
+// NewDumper returns a disabled Dumper writing to w.
+func NewDumper(w io.Writer) *Dumper {
+	return &Dumper{w: w}
+}
+
+// Enable dumps the commands at paths and their subcommands, or all commands
+// if no paths are given. Paths are space separated, e.g. "pin add".
+func (d *Dumper) Enable(paths ...string) {
+	selected := make([][]string, 0, len(paths))
+	for _, p := range paths {
+		p = strings.TrimSpace(p)
+		if p == "*" {
+			selected = [][]string{nil}
+			break
+		}
+		if p != "" {
+			selected = append(selected, strings.Fields(p))
+		}
+	}
+	if len(selected) == 0 {
+		selected = [][]string{nil}
+	}
+
+	d.l.Lock()
+	defer d.l.Unlock()
+	d.paths = selected
+}
+
+// EnableFromEnv enables the Dumper for the commands listed in $CMDS_HTTP_DUMP
+// if it is set.
+func (d *Dumper) EnableFromEnv() {
+	if v := os.Getenv(DumpEnv); v != "" {
+		d.Enable(strings.Split(v, ",")...)
+	}
+}
+
+// Disable stops dumping.
+func (d *Dumper) Disable() {
+	d.l.Lock()
+	defer d.l.Unlock()
+	d.paths = nil
+}
+
+// Enabled returns whether the Dumper dumps any commands.
+func (d *Dumper) Enabled() bool {
+	d.l.RLock()
+	defer d.l.RUnlock()
+	return d.paths != nil
+}
+
+// ToggleOnSignal dumps all commands or stops dumping whenever one of sigs is
+// received, e.g. syscall.SIGUSR2, until ctx is canceled.
+func (d *Dumper) ToggleOnSignal(ctx context.Context, sigs ...os.Signal) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+
+	go func() {
+		defer signal.Stop(ch)
+		for {
+			select {
+			case <-ch:
+				if d.Enabled() {
+					d.Disable()
+					log.Info("stopped dumping requests")
+				} else {
+					d.Enable()
+					log.Info("dumping all requests")
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// ServeHTTP is the admin endpoint of the Dumper, which should only be
+// reachable by operators. GET returns the selected command paths, POST
+// enables dumping for the paths given in the "path" query parameters (all if
+// none) and DELETE disables it.
+func (d *Dumper) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+	case "POST":
+		d.Enable(r.URL.Query()["path"]...)
+	case "DELETE":
+		d.Disable()
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "405 - Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	d.l.RLock()
+	defer d.l.RUnlock()
+
+	w.Header().Set(contentTypeHeader, plainText)
+	if d.paths == nil {
+		fmt.Fprintln(w, "disabled")
+		return
+	}
+
+	paths := make([]string, len(d.paths))
+	for i, p := range d.paths {
+		paths[i] = strings.Join(p, " ")
+		if len(p) == 0 {
+			paths[i] = "*"
+		}
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		fmt.Fprintln(w, p)
+	}
+}
+
+func (d *Dumper) selected(path []string) bool {
+	d.l.RLock()
+	defer d.l.RUnlock()
+
+	return matchesPath(d.paths, path)
+}
+
+func newDumpHandler(d *Dumper, apiPath string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !d.Enabled() || !strings.HasPrefix(r.URL.Path, apiPath) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		path := strings.FieldsFunc(strings.TrimPrefix(r.URL.Path, apiPath), func(c rune) bool {
+			return c == '/'
+		})
+		if !d.selected(path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		urlPath := r.URL.Path
+		reqHead, err := httputil.DumpRequest(r, false)
+		if err != nil {
+			log.Errorf("failed to dump request: %s", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		reqBody := &limitedBuffer{max: maxDumpBody}
+		var tee io.Reader
+		if r.Body != nil {
+			tee = io.TeeReader(r.Body, reqBody)
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{tee, r.Body}
+		}
+
+		dw := &dumpWriter{ResponseWriter: w, body: limitedBuffer{max: maxDumpBody}}
+		defer func() {
+			if tee != nil {
+				// dump the part of the body the command didn't read
+				io.Copy(ioutil.Discard, io.LimitReader(tee, int64(maxDumpBody-reqBody.Len())))
+			}
+
+			var buf bytes.Buffer
+			fmt.Fprintf(&buf, "---- request %s %s\n", r.RemoteAddr, urlPath)
+			buf.Write(reqHead)
+			reqBody.writeTo(&buf)
+			fmt.Fprintf(&buf, "\n---- response %s %s\n", r.RemoteAddr, urlPath)
+			dw.writeTo(&buf)
+			buf.WriteString("\n---- end\n")
+
+			d.l.Lock()
+			defer d.l.Unlock()
+			d.w.Write(buf.Bytes())
+		}()
+
+		next.ServeHTTP(dw, r)
+	})
+}
+
+// limitedBuffer keeps the first max bytes written to it.
+type limitedBuffer struct {
+	bytes.Buffer
+	max       int
+	truncated int64
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if room := b.max - b.Len(); room < len(p) {
+		if room < 0 {
+			room = 0
+		}
+		b.truncated += int64(len(p) - room)
+		p = p[:room]
+	}
+	b.Buffer.Write(p)
+	return n, nil
+}
+
+func (b *limitedBuffer) writeTo(w io.Writer) {
+	w.Write(b.Bytes())
+	if b.truncated > 0 {
+		fmt.Fprintf(w, "\n[%d more bytes]", b.truncated)
+	}
+}
+
+// dumpWriter records the response written to it.
+type dumpWriter struct {
+	http.ResponseWriter
+	status int
+	header http.Header
+	body   limitedBuffer
+}
+
+func (w *dumpWriter) WriteHeader(status int) {
+	if w.header == nil {
+		w.status = status
+		w.header = w.Header().Clone()
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *dumpWriter) Write(p []byte) (int, error) {
+	if w.header == nil {
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.body.Write(p[:n])
+	return n, err
+}
+
+func (w *dumpWriter) Flush() {
+	flush(w.ResponseWriter)
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController.
+func (w *dumpWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *dumpWriter) writeTo(out io.Writer) {
+	if w.header == nil {
+		// the handler didn't write anything
+		w.status = http.StatusOK
+		w.header = w.Header().Clone()
+	}
+
+	fmt.Fprintf(out, "%d %s\r\n", w.status, http.StatusText(w.status))
+	w.header.Write(out)
+	out.Write([]byte("\r\n"))
+	w.body.writeTo(out)
+
+	// trailers are set after the headers were written
+	trailer := make(http.Header)
+	for _, names := range w.header["Trailer"] {
+		for _, name := range strings.Split(names, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if vs, ok := w.Header()[name]; ok {
+				trailer[name] = vs
+			}
+		}
+	}
+	if len(trailer) > 0 {
+		out.Write([]byte("\r\n"))
+		trailer.Write(out)
+	}
+}
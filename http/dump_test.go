@@ -0,0 +1,85 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDumper(t *testing.T) {
+	env := testEnv{
+		version:     "0.1.2",
+		commit:      "c0mm17",
+		repoVersion: "4",
+		rootCtx:     context.Background(),
+		t:           t,
+		wait:        make(chan struct{}),
+	}
+
+	var out bytes.Buffer
+	d := NewDumper(&out)
+
+	cfg := originCfg(defaultOrigins)
+	cfg.APIPath = "/api/v0"
+	cfg.Dumper = d
+	h := NewHandler(env, cmdRoot, cfg)
+
+	call := func(path string) {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", path, strings.NewReader("request body")))
+	}
+	admin := func(method, query string) string {
+		rec := httptest.NewRecorder()
+		d.ServeHTTP(rec, httptest.NewRequest(method, "/debug/dump"+query, nil))
+		return rec.Body.String()
+	}
+
+	call("/api/v0/version")
+	if out.Len() != 0 {
+		t.Fatalf("expected nothing to be dumped while disabled, got:\n%s", out.String())
+	}
+
+	if state := admin("POST", "?path=version&path=pin+add"); state != "pin add\nversion\n" {
+		t.Errorf("unexpected state %q", state)
+	}
+
+	call("/api/v0/version")
+	call("/api/v0/error")
+
+	dump := out.String()
+	for _, s := range []string{
+		"---- request",
+		"POST /api/v0/version HTTP/1.1",
+		"request body",
+		"200 OK",
+		`"Version":"0.1.2"`,
+	} {
+		if !strings.Contains(dump, s) {
+			t.Errorf("expected dump to contain %q, got:\n%s", s, dump)
+		}
+	}
+	if strings.Contains(dump, "/api/v0/error") {
+		t.Errorf("expected only the selected command to be dumped, got:\n%s", dump)
+	}
+
+	// trailers are dumped after the body
+	out.Reset()
+	d.Enable("*")
+	call("/api/v0/lateerror")
+	if dump := out.String(); !strings.Contains(dump, `"some value"`+"\n\r\nX-Stream-Error: an error occurred") {
+		t.Errorf("expected the error trailer in the dump, got:\n%s", dump)
+	}
+
+	if state := admin("DELETE", ""); state != "disabled\n" || d.Enabled() {
+		t.Errorf("expected the dumper to be disabled, got %q", state)
+	}
+
+	os.Setenv(DumpEnv, "error, version")
+	defer os.Unsetenv(DumpEnv)
+	d.EnableFromEnv()
+	if state := admin("GET", ""); state != "error\nversion\n" {
+		t.Errorf("unexpected state %q after EnableFromEnv", state)
+	}
+}
@@ -0,0 +1,56 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+// streamErrEnvelope renders an error that occurred midway through a stream
+// for the error envelope trailer. The trailer always holds the JSON
+// envelope, which fits on a header line, and StreamErrHeader is set to the
+// message for clients that don't know the envelope.
+func streamErrEnvelope(e *cmdkit.Error) string {
+	_, data, err := cmds.MarshalError(cmds.JSON, e)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// streamError returns the error a stream failed with according to h, nil if
+// it didn't fail. The code is restored if the server sent the envelope.
+func streamError(h http.Header) error {
+	if env := h.Get(streamErrEnvelopeHeader); env != "" {
+		if e, err := cmds.UnmarshalError(cmds.JSON, []byte(env)); err == nil {
+			return withErrorCode(h, e)
+		}
+	}
+	if msg := h.Get(StreamErrHeader); msg != "" {
+		return withErrorCode(h, &cmdkit.Error{Message: msg})
+	}
+	return nil
+}
+
+// setErrorCode sets the ID and code of err in h if it is a
+// *cmds.CodedError. Set after the status, they are sent in the trailer.
+func setErrorCode(h http.Header, err error) {
+	if e, ok := err.(*cmds.CodedError); ok {
+		h.Set(errorIDHeader, e.ID)
+		h.Set(errorCodeHeader, strconv.Itoa(e.Code))
+	}
+}
+
+// withErrorCode returns e as a *cmds.CodedError if h holds the ID and code
+// set by setErrorCode, and e otherwise.
+func withErrorCode(h http.Header, e *cmdkit.Error) error {
+	id := h.Get(errorIDHeader)
+	code, err := strconv.Atoi(h.Get(errorCodeHeader))
+	if id == "" || err != nil {
+		return e
+	}
+	return &cmds.CodedError{ID: id, Code: code, Type: e.Code, Message: e.Message}
+}
@@ -3,8 +3,10 @@ package http
 import (
 	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"runtime"
 	"strings"
 	"testing"
@@ -159,3 +161,123 @@ func TestErrors(t *testing.T) {
 		t.Run(fmt.Sprintf("%d-%s", i, strings.Join(tc.path, "/")), mkTest(tc))
 	}
 }
+
+func TestErrorEnvelopeCodes(t *testing.T) {
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"early": {
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					return cmdkit.Error{Message: "no <such> thing", Code: cmdkit.ErrNotFound}
+				},
+			},
+			"late": {
+				Type: "",
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					re.Emit("some value")
+					return cmdkit.Error{Message: "went away", Code: cmdkit.ErrFatal}
+				},
+			},
+		},
+	}
+
+	srv := httptest.NewServer(NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, originCfg(defaultOrigins)))
+	defer srv.Close()
+	c := NewClient(srv.URL)
+
+	for _, encType := range []cmds.EncodingType{cmds.JSON, cmds.XML} {
+		req, err := cmds.NewRequest(context.Background(), []string{"early"}, cmdkit.OptMap{cmds.EncLong: encType}, nil, nil, root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = c.Send(req)
+		if e, ok := err.(*cmdkit.Error); !ok || e.Code != cmdkit.ErrNotFound || e.Message != "no <such> thing" {
+			t.Errorf("%s: expected the error with its code, got %#v", encType, err)
+		}
+	}
+
+	req, err := cmds.NewRequest(context.Background(), []string{"late"}, nil, nil, nil, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := c.Send(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := res.Next(); err != nil {
+		t.Fatal(err)
+	}
+	_, err = res.Next()
+	if e, ok := err.(*cmdkit.Error); !ok || e.Code != cmdkit.ErrFatal || e.Message != "went away" {
+		t.Errorf("expected the stream error with its code, got %#v", err)
+	}
+}
+
+func TestCodedErrors(t *testing.T) {
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"early": {
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					return cmds.NotFoundError("no pin for %s", "QmFoo")
+				},
+			},
+			"late": {
+				Type: "",
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					re.Emit("some value")
+					return cmds.PermissionDeniedError("the repo is read-only")
+				},
+			},
+			"reader": {
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					re.Emit(strings.NewReader("partial output"))
+					return cmds.InternalError("disk failure")
+				},
+			},
+		},
+	}
+
+	srv := httptest.NewServer(NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, originCfg(defaultOrigins)))
+	defer srv.Close()
+	c := NewClient(srv.URL)
+
+	send := func(path string) (cmds.Response, error) {
+		req, err := cmds.NewRequest(context.Background(), []string{path}, nil, nil, nil, root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c.Send(req)
+	}
+	check := func(path string, err error, expected *cmds.CodedError) {
+		e, ok := err.(*cmds.CodedError)
+		if !ok || e.ID != expected.ID || e.Code != expected.Code || e.Type != expected.Type || e.Error() != expected.Error() {
+			t.Errorf("%s: expected %#v, got %#v", path, expected, err)
+		}
+	}
+
+	_, err := send("early")
+	check("early", err, cmds.NotFoundError("no pin for QmFoo"))
+
+	res, err := send("late")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := res.Next(); err != nil {
+		t.Fatal(err)
+	}
+	_, err = res.Next()
+	check("late", err, cmds.PermissionDeniedError("the repo is read-only"))
+	if e := res.Error(); e == nil || e.Code != cmdkit.ErrClient || e.Message != "the repo is read-only" {
+		t.Errorf("expected the cmdkit.Error of the coded error, got %#v", e)
+	}
+
+	res, err = send("reader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := res.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ioutil.ReadAll(v.(io.Reader))
+	check("reader", err, cmds.InternalError("disk failure"))
+}
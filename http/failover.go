@@ -0,0 +1,252 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultEndpointCooldown is the time an endpoint that couldn't be reached
+// is skipped for, see ClientWithEndpoints.
+const DefaultEndpointCooldown = 30 * time.Second
+
+// ClientWithEndpoints adds further addresses of servers running the same
+// API, e.g. the daemons of a cluster. Addresses are URLs, host and port
+// pairs, multiaddrs such as /ip4/127.0.0.1/tcp/5001 and
+// /unix/var/run/api.sock, or unix socket URLs such as
+// unix:///var/run/api.sock.
+//
+// Requests are distributed round-robin between the endpoints. If an
+// endpoint can't be reached, the request is retried with the next one and
+// the endpoint is skipped for the cooldown set with
+// ClientWithEndpointCooldown, after which it is tried again.
+//
+// Requests with a body are only retried if the connection to the failed
+// endpoint couldn't be established, since the body may have been consumed.
+// Endpoints are marked down passively, by failed requests; with
+// ClientWithHealthCheck, endpoints that are down are probed until they
+// answer again.
+func ClientWithEndpoints(addrs ...string) ClientOpt {
+	return func(c *client) {
+		for _, addr := range addrs {
+			c.endpoints.add(c.serverURL(addr))
+		}
+	}
+}
+
+// ClientWithEndpointCooldown sets the time an endpoint that couldn't be
+// reached is skipped for. It defaults to DefaultEndpointCooldown.
+func ClientWithEndpointCooldown(d time.Duration) ClientOpt {
+	return func(c *client) {
+		c.endpoints.cooldown = d
+	}
+}
+
+// ClientWithHealthCheck probes the endpoints that are down every interval
+// with a request for the health endpoint of the server, see
+// ServerConfig.HealthChecks. Endpoints stay down while they can't be
+// reached or answer with a server error, instead of being tried again after
+// the cooldown, and are up again as soon as a probe succeeds.
+func ClientWithHealthCheck(interval time.Duration) ClientOpt {
+	return func(c *client) {
+		c.endpoints.interval = interval
+		c.endpoints.probe = c.probe
+	}
+}
+
+// probe returns whether the server at addr answers requests for its health
+// endpoint. Servers without health checks answer 404, they can be reached.
+func (c *client) probe(addr string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), c.endpoints.interval)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, addr+healthPath, nil)
+	if err != nil {
+		return false
+	}
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return false
+	}
+	res.Body.Close()
+	return res.StatusCode < http.StatusInternalServerError
+}
+
+// endpointSet keeps track of the servers a client talks to and whether they
+// can be reached.
+type endpointSet struct {
+	cooldown time.Duration
+	// probe, if set, checks every interval whether an endpoint that is down
+	// is up again, see ClientWithHealthCheck.
+	probe    func(addr string) bool
+	interval time.Duration
+
+	l     sync.Mutex
+	addrs []string
+	// down holds the time until which an endpoint is skipped.
+	down map[string]time.Time
+	// probing holds the endpoints that are probed.
+	probing map[string]bool
+	next    int
+}
+
+func newEndpointSet(addr string) *endpointSet {
+	return &endpointSet{
+		cooldown: DefaultEndpointCooldown,
+		addrs:    []string{addr},
+		down:     make(map[string]time.Time),
+		probing:  make(map[string]bool),
+	}
+}
+
+func (s *endpointSet) add(addr string) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	for _, a := range s.addrs {
+		if a == addr {
+			return
+		}
+	}
+	s.addrs = append(s.addrs, addr)
+}
+
+// pick returns the next endpoint that wasn't tried yet, preferring the ones
+// that are up. It returns false if all endpoints were tried.
+func (s *endpointSet) pick(tried map[string]bool) (string, bool) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	now := time.Now()
+	var fallback string
+	for i := range s.addrs {
+		addr := s.addrs[(s.next+i)%len(s.addrs)]
+		if tried[addr] {
+			continue
+		}
+		if now.Before(s.down[addr]) {
+			if fallback == "" {
+				fallback = addr
+			}
+			continue
+		}
+
+		s.next = (s.next + i + 1) % len(s.addrs)
+		return addr, true
+	}
+
+	// all remaining endpoints are down, try them anyway
+	return fallback, fallback != ""
+}
+
+// match returns the endpoint rawurl points to.
+func (s *endpointSet) match(rawurl string) string {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	var match string
+	for _, addr := range s.addrs {
+		if strings.HasPrefix(rawurl, addr) && len(addr) > len(match) {
+			match = addr
+		}
+	}
+	return match
+}
+
+func (s *endpointSet) markDown(addr string) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	s.down[addr] = time.Now().Add(s.cooldown)
+
+	if s.probe != nil && s.interval > 0 && !s.probing[addr] {
+		s.probing[addr] = true
+		go s.watch(addr)
+	}
+}
+
+// watch probes addr until it is up again.
+func (s *endpointSet) watch(addr string) {
+	t := time.NewTicker(s.interval)
+	defer t.Stop()
+
+	for range t.C {
+		up := s.probe(addr)
+
+		s.l.Lock()
+		if _, down := s.down[addr]; up || !down {
+			// up, or marked up by a request
+			delete(s.down, addr)
+			delete(s.probing, addr)
+			s.l.Unlock()
+			return
+		}
+		s.down[addr] = time.Now().Add(s.cooldown + s.interval)
+		s.l.Unlock()
+	}
+}
+
+func (s *endpointSet) markUp(addr string) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	delete(s.down, addr)
+}
+
+// do sends httpReq, failing over to the other endpoints if the server can't
+// be reached. The hooks are called for every attempt.
+func (c *client) do(httpReq *http.Request, info *RequestInfo) (*http.Response, error) {
+	tried := make(map[string]bool)
+	addr := c.endpoints.match(httpReq.URL.String())
+
+	for {
+		tried[addr] = true
+		info.Start = time.Now()
+		c.hooks.onRequest(*info)
+
+		httpRes, err := c.httpClient.Do(httpReq)
+		info.Duration = time.Since(info.Start)
+		if err == nil {
+			c.endpoints.markUp(addr)
+			info.StatusCode = httpRes.StatusCode
+			return httpRes, nil
+		}
+		c.hooks.onError(*info, err)
+
+		if httpReq.Context().Err() != nil {
+			return nil, err
+		}
+		c.endpoints.markDown(addr)
+
+		if httpReq.Body != nil && httpReq.Body != http.NoBody && !isConnRefused(err) {
+			return nil, err
+		}
+		if httpReq.Header.Get(uploadIDHeader) != "" {
+			// the upload was staged on this endpoint
+			return nil, err
+		}
+		next, ok := c.endpoints.pick(tried)
+		if !ok {
+			return nil, err
+		}
+
+		retry := httpReq.Clone(httpReq.Context())
+		retry.URL, err = url.Parse(next + strings.TrimPrefix(httpReq.URL.String(), addr))
+		if err != nil {
+			return nil, err
+		}
+		retry.Host = retry.URL.Host
+
+		log.Debugf("failing over from %s to %s", addr, next)
+		httpReq, addr = retry, next
+		info.Attempt++
+	}
+}
+
+// all returns all endpoints.
+func (s *endpointSet) all() []string {
+	s.l.Lock()
+	defer s.l.Unlock()
+	return append([]string(nil), s.addrs...)
+}
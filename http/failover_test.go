@@ -0,0 +1,129 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+func TestClientFailover(t *testing.T) {
+	h := NewHandler(testEnv{rootCtx: context.Background(), t: t}, cmdRoot, originCfg(defaultOrigins))
+
+	counts := make(map[string]int)
+	newServer := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			counts[name]++
+			h.ServeHTTP(w, r)
+		}))
+	}
+
+	a, b := newServer("a"), newServer("b")
+	defer a.Close()
+	defer b.Close()
+	down := newServer("down")
+	down.Close()
+
+	var attempts []int
+	c := NewClient(down.URL,
+		ClientWithEndpoints(a.URL, b.URL),
+		ClientWithEndpointCooldown(time.Hour),
+		ClientWithHooks(ClientHooks{
+			OnResponse: func(info RequestInfo) {
+				attempts = append(attempts, info.Attempt)
+			},
+		}),
+	)
+
+	for i := 0; i < 4; i++ {
+		req, err := cmds.NewRequest(context.Background(), []string{"version"}, nil, nil, nil, cmdRoot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := c.Send(req)
+		if err != nil {
+			t.Fatalf("request %d: unexpected error: %s", i, err)
+		}
+		if _, err := res.Next(); err != nil {
+			t.Fatalf("request %d: unexpected error: %s", i, err)
+		}
+	}
+
+	if counts["a"] != 2 || counts["b"] != 2 {
+		t.Errorf("expected the requests to be distributed between the endpoints, got %v", counts)
+	}
+
+	// only the first request tried the endpoint that is down
+	expected := []int{2, 1, 1, 1}
+	if len(attempts) != len(expected) {
+		t.Fatalf("expected attempts %v but got %v", expected, attempts)
+	}
+	for i := range expected {
+		if attempts[i] != expected[i] {
+			t.Fatalf("expected attempts %v but got %v", expected, attempts)
+		}
+	}
+}
+
+func TestEndpointSetPick(t *testing.T) {
+	s := newEndpointSet("a")
+	s.add("b")
+	s.add("a")
+
+	s.markDown("a")
+	if addr, _ := s.pick(nil); addr != "b" {
+		t.Errorf("expected the endpoint that is up, got %q", addr)
+	}
+	if addr, ok := s.pick(map[string]bool{"b": true}); !ok || addr != "a" {
+		t.Errorf("expected the endpoint that is down as a fallback, got %q", addr)
+	}
+	if _, ok := s.pick(map[string]bool{"a": true, "b": true}); ok {
+		t.Error("expected no endpoint once all were tried")
+	}
+}
+
+func TestClientHealthCheck(t *testing.T) {
+	h := NewHandler(testEnv{rootCtx: context.Background(), t: t}, cmdRoot, originCfg(defaultOrigins))
+
+	var healthy int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == healthPath && atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		h.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL,
+		ClientWithEndpointCooldown(time.Millisecond),
+		ClientWithHealthCheck(5*time.Millisecond),
+	).(*client)
+	addr := c.endpoints.all()[0]
+
+	isDown := func() bool {
+		c.endpoints.l.Lock()
+		defer c.endpoints.l.Unlock()
+		_, down := c.endpoints.down[addr]
+		return down
+	}
+
+	c.endpoints.markDown(addr)
+	time.Sleep(50 * time.Millisecond)
+	if !isDown() {
+		t.Fatal("expected the endpoint to stay down while it is unhealthy, despite the cooldown")
+	}
+
+	atomic.StoreInt32(&healthy, 1)
+	deadline := time.Now().Add(time.Second)
+	for isDown() {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the endpoint to be up once it is healthy")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
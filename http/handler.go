@@ -4,12 +4,17 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/base32"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"runtime/debug"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/ipfs/go-ipfs-cmdkit"
 	cmds "github.com/ipfs/go-ipfs-cmds"
 	logging "github.com/ipfs/go-log"
 	cors "github.com/rs/cors"
@@ -24,10 +29,17 @@ var (
 
 const (
 	StreamErrHeader          = "X-Stream-Error"
+	streamErrEnvelopeHeader  = "X-Stream-Error-Envelope"
+	errorIDHeader            = "X-Error-Id"
+	errorCodeHeader          = "X-Error-Code"
 	streamHeader             = "X-Stream-Output"
 	channelHeader            = "X-Chunked-Output"
 	extraContentLengthHeader = "X-Content-Length"
+	ignoredOptionsHeader     = "X-Ignored-Options"
+	nextCursorHeader         = "X-Next-Cursor"
 	uaHeader                 = "User-Agent"
+	appHeader                = "X-Client-App"
+	appVersionHeader         = "X-Client-App-Version"
 	contentTypeHeader        = "Content-Type"
 	contentDispHeader        = "Content-Disposition"
 	transferEncodingHeader   = "Transfer-Encoding"
@@ -56,28 +68,120 @@ type handler struct {
 	root *cmds.Command
 	cfg  *ServerConfig
 	env  cmds.Environment
+
+	// counts the executing requests against MaxRequests,
+	// MaxStreamingRequests and the commandLimits
+	executing *executing
+	// limits the requests of some commands and of every client, nil if
+	// unlimited
+	commandLimits *commandLimits
+	rateLimiter   *rateLimiter
+	// the maximum durations of the commands, nil if unlimited
+	maxDurations *maxDurations
+
+	// uploads holds the staged uploads, nil if resumable uploads are
+	// disabled
+	uploads *uploadStore
+	// running holds the requests that can be canceled through the cancel
+	// endpoint
+	running *runningRequests
+}
+
+// Handler serves a command tree over HTTP, see NewHandler.
+type Handler struct {
+	env   cmds.Environment
+	root  *cmds.Command
+	state *handlerState
+
+	l sync.RWMutex
+	h http.Handler
+}
+
+// NewHandler returns a Handler serving root with the configuration cfg.
+func NewHandler(env cmds.Environment, root *cmds.Command, cfg *ServerConfig) *Handler {
+	h := &Handler{env: env, root: root, state: &handlerState{
+		running:   newRunningRequests(),
+		executing: newExecuting(),
+		buckets:   newClientBuckets(),
+	}}
+	h.SetConfig(cfg)
+	return h
+}
+
+// SetConfig replaces the configuration of a running handler, e.g. to allow
+// new origins, rotate the tokens of the Authorizer or change the request
+// limits. Requests that are already executing are finished with the old
+// configuration, they can still be canceled and count against the new
+// limits, and clients keep the rate budget they have left.
+func (h *Handler) SetConfig(cfg *ServerConfig) {
+	hdlr := newHandler(h.env, h.root, cfg, h.state)
+
+	h.l.Lock()
+	defer h.l.Unlock()
+	h.h = hdlr
 }
 
-func NewHandler(env cmds.Environment, root *cmds.Command, cfg *ServerConfig) http.Handler {
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.l.RLock()
+	hdlr := h.h
+	h.l.RUnlock()
+
+	hdlr.ServeHTTP(w, r)
+}
+
+// handlerState is the state of a Handler its configurations share.
+type handlerState struct {
+	running   *runningRequests
+	executing *executing
+	buckets   *clientBuckets
+}
+
+// newHandler returns the handler for cfg, wrapped in the middlewares cfg
+// enables.
+func newHandler(env cmds.Environment, root *cmds.Command, cfg *ServerConfig, state *handlerState) http.Handler {
 	if cfg == nil {
 		panic("must provide a valid ServerConfig")
 	}
 
-	c := cors.New(*cfg.corsOpts)
-
-	var h http.Handler
+	corsOpts := *cfg.corsOpts
+	if cfg.Authorizer != nil && len(corsOpts.AllowedHeaders) == 0 {
+		// the defaults of the CORS handler, and the credentials of the
+		// Authorizer
+		corsOpts.AllowedHeaders = []string{"Origin", "Accept", "Content-Type", "X-Requested-With", authorizationHeader}
+	}
+	c := cors.New(corsOpts)
 
-	h = &handler{
-		env:  env,
-		root: root,
-		cfg:  cfg,
+	hdlr := &handler{
+		env:       env,
+		root:      root,
+		cfg:       cfg,
+		running:   state.running,
+		executing: state.executing,
+	}
+	hdlr.commandLimits = newCommandLimits(cfg.CommandLimits)
+	hdlr.rateLimiter = newRateLimiter(cfg.ClientRate, cfg.ClientBurst, cfg.ClientKey, state.buckets)
+	hdlr.maxDurations = newMaxDurations(cfg.MaxDuration, cfg.CommandMaxDurations)
+	if cfg.UploadDir != "" {
+		hdlr.uploads = newUploadStore(cfg.UploadDir, cfg.UploadTTL, cfg.MaxUploadSize, cfg.MaxUploads)
 	}
 
+	var h http.Handler = hdlr
 	if cfg.APIPath != "" {
 		h = newPrefixHandler(cfg.APIPath, h) // wrap with path prefix checker and trimmer
 	}
+	if cfg.HealthChecks != nil || cfg.ReadyChecks != nil {
+		h = newHealthHandler(env, cfg.HealthChecks, cfg.ReadyChecks, h)
+	}
 	h = c.Handler(h) // wrap with CORS handler
 
+	if cfg.Dumper != nil {
+		h = newDumpHandler(cfg.Dumper, cfg.APIPath, h)
+	}
+
+	if cfg.AccessLog != nil {
+		h = newAccessLogHandler(cfg.AccessLog, cfg.APIPath, h)
+	}
+
 	return h
 }
 
@@ -88,11 +192,55 @@ type requestLogger interface {
 func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	log.Debug("incoming API request: ", r.URL)
 
+	// the request id doubles as incident id if the command panics
+	reqID := newRequestID()
+
+	var (
+		re ResponseEmitter
+		// bw buffers the response if it is sent at once
+		bw *bufferedResponseWriter
+		// upgraded is the emitter of a request served by an Upgrader
+		upgraded cmds.ResponseEmitter
+		// cw compresses the response if the client accepts it
+		cw *compressResponseWriter
+	)
 	defer func() {
-		if r := recover(); r != nil {
-			log.Error("a panic has occurred in the commands handler!")
-			log.Error(r)
-			log.Errorf("stack trace:\n%s", debug.Stack())
+		v := recover()
+		if v == nil {
+			return
+		}
+		if v == http.ErrAbortHandler {
+			panic(v)
+		}
+
+		stack := debug.Stack()
+		log.Errorf("a panic has occurred in the commands handler (incident %s): %v\nstack trace:\n%s", reqID, v, stack)
+		if h.cfg.PanicHandler != nil {
+			h.cfg.PanicHandler(reqID, v, stack)
+		}
+
+		// don't tell the client what went wrong, only the incident id
+		e := &cmdkit.Error{
+			Message: fmt.Sprintf("internal error, incident %s", reqID),
+			Code:    cmdkit.ErrFatal,
+		}
+		if upgraded != nil {
+			if err := upgraded.CloseWithError(e); err != nil && err != cmds.ErrClosingClosedEmitter {
+				log.Errorf("error closing ResponseEmitter after panic: %s", err)
+			}
+			return
+		}
+		if re == nil || bw != nil {
+			w.Header().Set(contentTypeHeader, applicationJson)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(e)
+			return
+		}
+		if err := re.CloseWithError(e); err != nil && err != cmds.ErrClosingClosedEmitter {
+			log.Errorf("error closing ResponseEmitter after panic: %s", err)
+		}
+		if cw != nil {
+			cw.Close()
 		}
 	}()
 
@@ -109,7 +257,83 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if h.rateLimiter != nil {
+		if ok, retry := h.rateLimiter.allow(r, time.Now()); !ok {
+			h.tooManyRequests(w, retry)
+			return
+		}
+	}
+
+	if isCompletionRequest(strings.TrimPrefix(r.URL.Path, "/")) {
+		h.serveCompletion(ctx, w, r)
+		return
+	}
+
+	if isUploadRequest(strings.TrimPrefix(r.URL.Path, "/")) {
+		h.serveUpload(w, r)
+		return
+	}
+
+	if isCancelRequest(strings.TrimPrefix(r.URL.Path, "/")) {
+		h.serveCancel(w, r)
+		return
+	}
+
+	if isOpenAPIRequest(strings.TrimPrefix(r.URL.Path, "/")) {
+		h.serveOpenAPI(w, r)
+		return
+	}
+
+	// commands read the files of the body while they emit values, which
+	// HTTP/1 servers don't allow by default
+	if r.ContentLength != 0 {
+		if err := http.NewResponseController(w).EnableFullDuplex(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			log.Debugf("error enabling full duplex for %s: %s", r.URL.Path, err)
+		}
+	}
+
+	// the body of the request may have been staged before
+	if id := r.Header.Get(uploadIDHeader); id != "" {
+		if h.uploads == nil {
+			http.Error(w, "resumable uploads are disabled", http.StatusBadRequest)
+			return
+		}
+		body, err := h.uploads.open(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer body.Close()
+		r.Body = body
+	}
+
+	// preflight requests are answered by the CORS handler, other OPTIONS
+	// requests ask for the description of the command
+	if r.Method == http.MethodOptions {
+		h.serveDescription(w, r)
+		return
+	}
+
+	// the values are restored first, so the request is decoded in the
+	// trace of the client
+	ctx, err := restoreContextValues(ctx, r.Header, h.cfg.ContextValues)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	_, span := cmds.StartSpan(ctx, cmds.DecodeSpan)
 	req, err := parseRequest(ctx, r, h.root)
+	if req != nil {
+		span.SetPath(req.Path)
+	}
+	span.End(err)
+	validate := validateRequested(r)
+	if err != nil && validate {
+		h.serveValidation(w, r, nil, err)
+		return
+	}
 	if err != nil {
 		if err == ErrNotFound {
 			w.WriteHeader(http.StatusNotFound)
@@ -120,6 +344,58 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// validations report unknown options instead of rejecting them
+	policy := h.cfg.UnknownOptions
+	if validate {
+		policy = cmds.PassUnknownOptions
+	}
+	ignored, err := cmds.CheckUnknownOptions(req, policy)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if len(ignored) > 0 {
+		log.Warningf("ignoring unknown options of %q: %s", req.Path, strings.Join(ignored, ", "))
+	}
+	// format templates are run by the frontend rendering the values, not by
+	// the daemon on behalf of its clients
+	if _, ok := req.Options[cmds.FormatOpt]; ok {
+		delete(req.Options, cmds.FormatOpt)
+		ignored = append(ignored, cmds.FormatOpt)
+	}
+
+	req.Context = cmds.ContextWithCaller(req.Context, &cmds.Caller{
+		UserAgent:  r.UserAgent(),
+		App:        r.Header.Get(appHeader),
+		AppVersion: r.Header.Get(appVersionHeader),
+	})
+
+	if !h.authorize(w, r, req) {
+		return
+	}
+
+	if validate {
+		h.serveValidation(w, r, req, nil)
+		return
+	}
+
+	l := limit{key: unaryLimit, max: h.cfg.MaxRequests}
+	if req.Command.Streaming {
+		l = limit{key: streamingLimit, max: h.cfg.MaxStreamingRequests}
+	}
+	for _, l := range []limit{l, h.commandLimits.limit(req.Path)} {
+		if l.max <= 0 {
+			continue
+		}
+		done := h.executing.acquire(l)
+		if done == nil {
+			h.tooManyRequests(w, 0)
+			return
+		}
+		defer done()
+	}
+
 	// Handle the timeout up front.
 	var cancel func()
 	if timeoutStr, ok := req.Options[cmds.TimeoutOpt]; ok {
@@ -133,26 +409,100 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	defer cancel()
 
-	req.Context = logging.ContextWithLoggable(req.Context, uuidLoggable())
-	if cn, ok := w.(http.CloseNotifier); ok {
-		clientGone := cn.CloseNotify()
-		go func() {
-			select {
-			case <-clientGone:
-			case <-req.Context.Done():
-			}
-			cancel()
-		}()
+	var expired *cmdkit.Error
+	if max := h.maxDurations.get(req.Path); max > 0 {
+		var cancelMax context.CancelFunc
+		expired, cancelMax = withMaxDuration(req, max)
+		defer cancelMax()
+	}
+
+	req.Context = logging.ContextWithLoggable(req.Context, logging.Metadata{
+		"requestId": reqID,
+	})
+	// the request context is canceled when the client goes away, for both
+	// HTTP/1.1 connections and HTTP/2 streams
+	clientGone := r.Context().Done()
+	go func(ctx context.Context) {
+		select {
+		case <-clientGone:
+		case <-ctx.Done():
+		}
+		cancel()
+	}(req.Context)
+
+	// the client cancels the request explicitly through the cancel endpoint
+	if id := r.Header.Get(cancelIDHeader); id != "" {
+		done, err := h.running.add(id, cancel)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer done()
+	}
+
+	env := h.env
+	if h.cfg.MakeEnvironment != nil {
+		env, err = h.cfg.MakeEnvironment(req.Context, req)
+		if err != nil {
+			log.Errorf("error making the environment for %q: %s", req.Path, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(sanitizedErrStr(err)))
+			return
+		}
+		defer cmds.CloseEnvironment(env)
+	}
+
+	if up := h.upgrader(r); up != nil {
+		upgraded, err = up.Upgrade(w, r, req)
+		if err != nil {
+			log.Debugf("error upgrading the request for %q: %s", req.Path, err)
+			return
+		}
+		runRe, wait := httpPostRun(req, upgraded)
+		if expired != nil {
+			defer closeOnExpiry(req, runRe, expired)()
+		}
+		h.call(req, runRe, env)
+		if wait != nil {
+			wait()
+		}
+		return
+	}
+
+	out := w
+	// the responses of cacheable commands are buffered to compute their ETag
+	if h.cfg.BufferResponses || bufferRequested(req) || req.Command.Cacheable {
+		bw = newBufferedResponseWriter()
+		out = bw
+	}
+
+	// buffered responses are compressed as a whole, so the Content-Length
+	// and ETag are those of the compressed body
+	if h.cfg.CompressResponses && r.Method != http.MethodHead {
+		w.Header().Add(varyHeader, acceptEncodingHeader)
+		if ct := negotiateContentCoding(r.Header.Get(acceptEncodingHeader)); ct != cmds.Identity {
+			cw = newCompressResponseWriter(out, ct)
+			out = cw
+		}
 	}
 
-	re, err := NewResponseEmitter(w, r.Method, req)
+	var bodyBytes *countingResponseWriter
+	if h.cfg.Metrics != nil {
+		bodyBytes = &countingResponseWriter{ResponseWriter: out}
+		out = bodyBytes
+	}
+
+	re, err = NewResponseEmitter(out, r.Method, req)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		w.Write([]byte(err.Error()))
 		return
 	}
+	if h.cfg.HeartbeatInterval > 0 && bw == nil {
+		re.(*responseEmitter).startHeartbeat(h.cfg.HeartbeatInterval)
+	}
 
-	if reqLogger, ok := h.env.(requestLogger); ok {
+	if reqLogger, ok := env.(requestLogger); ok {
 		done := reqLogger.LogRequest(req)
 		defer done()
 	}
@@ -160,20 +510,118 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// set user's headers first.
 	for k, v := range h.cfg.Headers {
 		if !skipAPIHeader(k) {
-			w.Header()[k] = v
+			out.Header()[k] = v
 		}
 	}
+	if len(ignored) > 0 {
+		out.Header().Set(ignoredOptionsHeader, strings.Join(ignored, ","))
+	}
+
+	// the metrics are those of the response, after a server-side PostRun
+	var wireRe cmds.ResponseEmitter = re
+	if h.cfg.Buffer.Size > 0 {
+		wireRe = cmds.NewBufferedEmitter(re, h.cfg.Buffer)
+	}
+	if bodyBytes != nil {
+		wireRe = cmds.NewInstrumentedEmitter(req, wireRe, bodyBytes.collector(h.cfg.Metrics))
+	}
+
+	runRe, postRun, wait := serverPostRun(req, wireRe)
+	if wait != nil {
+		out.Header().Set(postRunHeader, postRun)
+	}
+	runRe, httpWait := httpPostRun(req, runRe)
+
+	// interactive commands may wait for input before emitting anything,
+	// clients shouldn't time out meanwhile
+	if req.Command.Interactive && bw == nil {
+		re.Flush()
+	}
 
-	h.root.Call(req, re, h.env)
+	if expired != nil {
+		defer closeOnExpiry(req, runRe, expired)()
+	}
+	h.call(req, runRe, env)
+	if httpWait != nil {
+		httpWait()
+	}
+	if wait != nil {
+		wait()
+	}
+	if cw != nil {
+		if err := cw.Close(); err != nil {
+			log.Debugf("error finishing compressed response: %s", err)
+		}
+	}
+
+	if bw != nil {
+		if req.Command.Cacheable && bw.status == http.StatusOK && bw.header.Get(StreamErrHeader) == "" {
+			tag := etag(bw.body.Bytes())
+			w.Header().Set(etagHeader, tag)
+			if etagMatches(r.Header.Get(ifNoneMatchHeader), tag) {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+
+		if err := bw.writeTo(w); err != nil {
+			log.Debugf("error sending buffered response: %s", err)
+		}
+	}
+}
+
+// call runs the command of req with the Executor of the configuration, or
+// calls it on the root if there is none.
+func (h *handler) call(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) {
+	if h.cfg.Executor == nil {
+		h.root.Call(req, re, env)
+		return
+	}
+
+	err := h.cfg.Executor.Execute(req, re, env)
+	if err != nil {
+		log.Debugf("error executing %q: %s", req.Path, err)
+	}
+	// executors close the emitter, unless they failed early
+	if closeErr := re.CloseWithError(err); closeErr != nil && closeErr != cmds.ErrClosingClosedEmitter {
+		log.Errorf("error closing ResponseEmitter: %s", closeErr)
+	}
+}
+
+// bufferRequested returns whether the client asked for the whole response to
+// be sent at once, see cmds.BufferOpt.
+func bufferRequested(req *cmds.Request) bool {
+	switch v := req.Options[cmds.BufferOpt].(type) {
+	case bool:
+		return v
+	case string:
+		b, _ := strconv.ParseBool(v)
+		return b
+	default:
+		return false
+	}
+}
+
+// tooManyRequests answers a request over a limit, telling the client to
+// retry after retry, or ServerConfig.RetryAfter if it is zero.
+func (h *handler) tooManyRequests(w http.ResponseWriter, retry time.Duration) {
+	if retry <= 0 {
+		retry = h.cfg.RetryAfter
+	}
+	if retry <= 0 {
+		retry = time.Second
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int((retry+time.Second-1)/time.Second)))
+	w.WriteHeader(http.StatusTooManyRequests)
+	w.Write([]byte("429 - Too Many Requests"))
 }
 
-func uuidLoggable() logging.Loggable {
+func newRequestID() string {
 	ids := make([]byte, 16)
 	rand.Read(ids)
 
-	return logging.Metadata{
-		"requestId": base32.HexEncoding.EncodeToString(ids),
-	}
+	return base32.HexEncoding.EncodeToString(ids)
 }
 
 func sanitizedErrStr(err error) string {
@@ -1,18 +1,26 @@
 package http
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"runtime"
+	"strings"
+	"time"
 
 	"testing"
 
 	cmdkit "github.com/ipfs/go-ipfs-cmdkit"
 	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/go-ipfs-files"
 )
 
 type VersionOutput struct {
@@ -300,3 +308,580 @@ func errEq(err1, err2 error) bool {
 
 	return err1.Error() == err2.Error()
 }
+
+func TestHandlerPanic(t *testing.T) {
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"panic": {
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					panic("oops")
+				},
+			},
+			"latepanic": {
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					re.Emit("some value")
+					panic("oops")
+				},
+			},
+			"encodepanic": {
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					return re.Emit("some value")
+				},
+				Encoders: cmds.EncoderMap{
+					cmds.JSON: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, v string) error {
+						panic("oops")
+					}),
+				},
+			},
+		},
+	}
+
+	type testcase struct {
+		path    string
+		status  int
+		trailer bool
+	}
+
+	tcs := []testcase{
+		{path: "/panic", status: http.StatusInternalServerError},
+		{path: "/latepanic", status: http.StatusOK, trailer: true},
+		// the headers were sent before the encoder was called
+		{path: "/encodepanic", status: http.StatusOK, trailer: true},
+	}
+
+	env := testEnv{rootCtx: context.Background(), t: t}
+	for _, tc := range tcs {
+		var incident string
+		cfg := originCfg(defaultOrigins)
+		cfg.PanicHandler = func(id string, v interface{}, stack []byte) {
+			incident = id
+			if v != "oops" || len(stack) == 0 {
+				t.Errorf("%s: unexpected panic value %v or empty stack", tc.path, v)
+			}
+		}
+
+		srv := httptest.NewServer(NewHandler(env, root, cfg))
+		res, err := http.Post(srv.URL+tc.path, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		srv.Close()
+
+		if incident == "" {
+			t.Errorf("%s: panic handler wasn't called", tc.path)
+			continue
+		}
+		if res.StatusCode != tc.status {
+			t.Errorf("%s: expected status %d but got %d", tc.path, tc.status, res.StatusCode)
+		}
+
+		msg := string(body)
+		if tc.trailer {
+			msg = res.Trailer.Get(StreamErrHeader)
+		}
+		if !strings.Contains(msg, "incident "+incident) || strings.Contains(msg, "oops") {
+			t.Errorf("%s: expected the incident id but not the panic value, got %q", tc.path, msg)
+		}
+	}
+}
+
+func TestHandlerMaxRequests(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	block := func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		started <- struct{}{}
+		<-release
+		return re.Emit("done")
+	}
+
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"unary":  {Run: block},
+			"stream": {Run: block, Streaming: true},
+		},
+	}
+
+	cfg := originCfg(defaultOrigins)
+	cfg.MaxRequests = 1
+	cfg.MaxStreamingRequests = 1
+	cfg.RetryAfter = 1500 * time.Millisecond
+
+	srv := httptest.NewServer(NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, cfg))
+	defer srv.Close()
+
+	post := func(path string) *http.Response {
+		res, err := http.Post(srv.URL+path, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		return res
+	}
+
+	// occupy both limits
+	done := make(chan int, 2)
+	for _, path := range []string{"/unary", "/stream"} {
+		go func(path string) {
+			res, err := http.Post(srv.URL+path, "", nil)
+			if err != nil {
+				done <- 0
+				return
+			}
+			res.Body.Close()
+			done <- res.StatusCode
+		}(path)
+		<-started
+	}
+
+	for _, path := range []string{"/unary", "/stream"} {
+		res := post(path)
+		if res.StatusCode != http.StatusTooManyRequests {
+			t.Errorf("%s: expected status 429 but got %d", path, res.StatusCode)
+		}
+		if ra := res.Header.Get("Retry-After"); ra != "2" {
+			t.Errorf("%s: expected Retry-After 2 but got %q", path, ra)
+		}
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		if status := <-done; status != http.StatusOK {
+			t.Errorf("expected the running requests to succeed, got status %d", status)
+		}
+	}
+
+	// the slots are free again
+	go func() { <-started }()
+	if res := post("/unary"); res.StatusCode != http.StatusOK {
+		t.Errorf("expected status 200 after the requests finished, got %d", res.StatusCode)
+	}
+}
+
+func TestHandlerBufferResponses(t *testing.T) {
+	env := testEnv{rootCtx: context.Background(), t: t, wait: make(chan struct{})}
+
+	type testcase struct {
+		cfgBuffer bool
+		query     string
+		path      string
+		body      string
+		errHeader string
+	}
+
+	tcs := []testcase{
+		{
+			query:     "?" + cmds.BufferOpt + "=true",
+			path:      "/lateerror",
+			body:      `"some value"` + "\n",
+			errHeader: "an error occurred",
+		},
+		{
+			cfgBuffer: true,
+			path:      "/reader",
+			body:      "the reader call returns a reader.",
+		},
+	}
+
+	for _, tc := range tcs {
+		cfg := originCfg(defaultOrigins)
+		cfg.BufferResponses = tc.cfgBuffer
+		srv := httptest.NewServer(NewHandler(env, cmdRoot, cfg))
+
+		res, err := http.Post(srv.URL+tc.path+tc.query, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		srv.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(body) != tc.body {
+			t.Errorf("%s: expected body %q but got %q", tc.path, tc.body, body)
+		}
+		if res.ContentLength != int64(len(tc.body)) || len(res.TransferEncoding) != 0 {
+			t.Errorf("%s: expected Content-Length %d and no chunking, got %d and %v",
+				tc.path, len(tc.body), res.ContentLength, res.TransferEncoding)
+		}
+		if e := res.Header.Get(StreamErrHeader); e != tc.errHeader {
+			t.Errorf("%s: expected error header %q but got %q", tc.path, tc.errHeader, e)
+		}
+	}
+}
+
+func TestHandlerSetConfig(t *testing.T) {
+	env := testEnv{
+		version:     "0.1.2",
+		commit:      "c0mm17",
+		repoVersion: "4",
+		rootCtx:     context.Background(),
+		t:           t,
+		wait:        make(chan struct{}),
+	}
+
+	h := NewHandler(env, cmdRoot, originCfg([]string{"http://localhost"}))
+
+	status := func() int {
+		r := httptest.NewRequest("POST", "/version", nil)
+		r.Header.Set("Origin", "http://example.com")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec.Code
+	}
+
+	if s := status(); s != http.StatusForbidden {
+		t.Errorf("expected status 403 before the origin is allowed, got %d", s)
+	}
+
+	cfg := originCfg([]string{"http://localhost", "http://example.com"})
+	cfg.Headers = map[string][]string{"X-Reloaded": {"1"}}
+	h.SetConfig(cfg)
+
+	r := httptest.NewRequest("POST", "/version", nil)
+	r.Header.Set("Origin", "http://example.com")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Reloaded") != "1" {
+		t.Errorf("expected the new config to be used, got status %d and headers %v", rec.Code, rec.Header())
+	}
+	if allowed := rec.Header().Get(ACAOrigin); allowed != "http://example.com" {
+		t.Errorf("expected the new origin to be allowed by CORS, got %q", allowed)
+	}
+}
+
+func TestHandlerSetConfigAuthorizer(t *testing.T) {
+	env := testEnv{
+		version:     "0.1.2",
+		commit:      "c0mm17",
+		repoVersion: "4",
+		rootCtx:     context.Background(),
+		t:           t,
+		wait:        make(chan struct{}),
+	}
+
+	cfg := originCfg(defaultOrigins)
+	cfg.Authorizer = BearerToken("old")
+	h := NewHandler(env, cmdRoot, cfg)
+
+	status := func(token string) int {
+		r := httptest.NewRequest("POST", "/version", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec.Code
+	}
+
+	if s := status("old"); s != http.StatusOK {
+		t.Errorf("expected the old token to be accepted, got status %d", s)
+	}
+
+	cfg = originCfg(defaultOrigins)
+	cfg.Authorizer = BearerToken("new")
+	h.SetConfig(cfg)
+
+	if s := status("old"); s != http.StatusUnauthorized {
+		t.Errorf("expected the rotated token to be rejected, got status %d", s)
+	}
+	if s := status("new"); s != http.StatusOK {
+		t.Errorf("expected the new token to be accepted, got status %d", s)
+	}
+}
+
+func TestHandlerUnknownOptions(t *testing.T) {
+	var passed bool
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"echo": {
+				Options: []cmdkit.Option{cmdkit.StringOption("name", "")},
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					_, passed = req.Options["newer"]
+					return re.Emit(req.Options["name"])
+				},
+			},
+		},
+	}
+
+	tcs := []struct {
+		policy  cmds.UnknownOptionPolicy
+		status  int
+		ignored string
+		passed  bool
+	}{
+		{cmds.PassUnknownOptions, http.StatusOK, "", true},
+		{cmds.IgnoreUnknownOptions, http.StatusOK, "newer", false},
+		{cmds.RejectUnknownOptions, http.StatusBadRequest, "", false},
+	}
+
+	for _, tc := range tcs {
+		passed = false
+		cfg := originCfg(defaultOrigins)
+		cfg.UnknownOptions = tc.policy
+
+		srv := httptest.NewServer(NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, cfg))
+		res, err := http.Post(srv.URL+"/echo?name=a&newer=b&encoding=json", "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		srv.Close()
+
+		if res.StatusCode != tc.status {
+			t.Errorf("policy %d: expected status %d but got %d", tc.policy, tc.status, res.StatusCode)
+		}
+		if ignored := res.Header.Get(ignoredOptionsHeader); ignored != tc.ignored {
+			t.Errorf("policy %d: expected ignored options %q but got %q", tc.policy, tc.ignored, ignored)
+		}
+		if passed != tc.passed {
+			t.Errorf("policy %d: expected the option to be passed to the command: %v", tc.policy, tc.passed)
+		}
+	}
+}
+
+func TestHandlerFormatTemplate(t *testing.T) {
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"echo": {
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					return re.Emit(map[string]string{"Name": "a"})
+				},
+				TextFormat: &cmds.TextFormat{Template: "name {{.Name}}"},
+			},
+		},
+	}
+
+	srv := httptest.NewServer(NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, originCfg(defaultOrigins)))
+	defer srv.Close()
+
+	query := url.Values{"encoding": {"text"}, cmds.FormatOpt: {"{{.Name}} {{.Name}}"}}
+	res, err := http.Post(srv.URL+"/echo?"+query.Encode(), "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.StatusCode != http.StatusOK || string(body) != "name a\n" {
+		t.Errorf("expected the template of the command, got %d %q", res.StatusCode, body)
+	}
+	if ignored := res.Header.Get(ignoredOptionsHeader); ignored != cmds.FormatOpt {
+		t.Errorf("expected the format to be ignored, got %q", ignored)
+	}
+}
+
+type requestEnv struct {
+	testEnv
+	closed chan struct{}
+}
+
+func (e *requestEnv) Close() {
+	close(e.closed)
+}
+
+func TestHandlerMakeEnvironment(t *testing.T) {
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"env": {
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					if _, ok := env.(*requestEnv); !ok {
+						return fmt.Errorf("unexpected environment %T", env)
+					}
+					return re.Emit("ok")
+				},
+			},
+			"panic": {
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					panic("oops")
+				},
+			},
+		},
+	}
+
+	var envs []*requestEnv
+	cfg := originCfg(defaultOrigins)
+	cfg.MakeEnvironment = func(ctx context.Context, req *cmds.Request) (cmds.Environment, error) {
+		env := &requestEnv{testEnv: testEnv{rootCtx: ctx, t: t}, closed: make(chan struct{})}
+		envs = append(envs, env)
+		return env, nil
+	}
+
+	srv := httptest.NewServer(NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, cfg))
+	defer srv.Close()
+
+	for _, path := range []string{"/env", "/panic"} {
+		res, err := http.Post(srv.URL+path, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if path == "/env" && !strings.Contains(string(body), "ok") {
+			t.Errorf("%s: unexpected response %q", path, body)
+		}
+	}
+
+	if len(envs) != 2 {
+		t.Fatalf("expected an environment per request, got %d", len(envs))
+	}
+	for i, env := range envs {
+		select {
+		case <-env.closed:
+		case <-time.After(time.Second):
+			t.Errorf("environment %d wasn't closed", i)
+		}
+	}
+}
+
+func TestHandlerValidate(t *testing.T) {
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"add": {
+				Arguments: []cmdkit.Argument{cmdkit.StringArg("name", true, false, "the name")},
+				Options:   []cmdkit.Option{cmdkit.IntOption("count", "the number of copies")},
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					t.Error("validations must not run the command")
+					return nil
+				},
+			},
+		},
+	}
+
+	cfg := originCfg(defaultOrigins)
+	cfg.UnknownOptions = cmds.RejectUnknownOptions
+	srv := httptest.NewServer(NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, cfg))
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		query string
+		kinds []cmds.DiagnosticKind
+	}{
+		{query: "arg=a&count=2"},
+		// the handler checks the arguments while parsing the request
+		{query: "count=2", kinds: []cmds.DiagnosticKind{cmds.DiagnosticRequest}},
+		{query: "arg=a&cuont=2", kinds: []cmds.DiagnosticKind{cmds.DiagnosticUnknownOption}},
+		{query: "arg=a&count=many", kinds: []cmds.DiagnosticKind{cmds.DiagnosticRequest}},
+	} {
+		res, err := http.Post(srv.URL+"/add?"+cmds.ValidateOpt+"=true&"+tc.query, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var v cmds.Validation
+		err = json.NewDecoder(res.Body).Decode(&v)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.StatusCode != http.StatusOK || v.Valid != (len(tc.kinds) == 0) || len(v.Diagnostics) != len(tc.kinds) {
+			t.Errorf("%s: expected diagnostics %v but got %d %+v", tc.query, tc.kinds, res.StatusCode, v)
+			continue
+		}
+		for i, kind := range tc.kinds {
+			if v.Diagnostics[i].Kind != kind {
+				t.Errorf("%s: expected diagnostics %v but got %+v", tc.query, tc.kinds, v)
+			}
+		}
+	}
+}
+
+// newReplRoot returns a root with an interactive command emitting every line
+// of its stdin in upper case.
+func newReplRoot() *cmds.Command {
+	return &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"repl": {
+				Interactive: true,
+				Arguments:   []cmdkit.Argument{cmdkit.FileArg("input", true, false, "the input").EnableStdin()},
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					f, err := req.Files.NextFile()
+					if err != nil {
+						return err
+					}
+					s := bufio.NewScanner(f)
+					for s.Scan() {
+						if err := re.Emit(strings.ToUpper(s.Text())); err != nil {
+							return err
+						}
+					}
+					return s.Err()
+				},
+				Type: "",
+			},
+		},
+	}
+}
+
+func TestHandlerFullDuplex(t *testing.T) {
+	root := newReplRoot()
+	srv := httptest.NewServer(NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, originCfg(defaultOrigins)))
+	defer srv.Close()
+
+	// a client keeping the connection alive, which HTTP/1 servers read the
+	// rest of the body for before they respond by default
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	body := files.NewMultiFileReader(files.NewSliceFile("", "", []files.File{
+		files.NewReaderFile("stdin", "", pr, nil),
+	}), true)
+	httpReq, err := http.NewRequest(http.MethodPost, srv.URL+"/repl?encoding=json&stream-channels=true", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpReq.Header.Set(contentTypeHeader, "multipart/form-data; boundary="+body.Boundary())
+
+	resCh := make(chan *http.Response, 1)
+	go func() {
+		res, err := http.DefaultClient.Do(httpReq)
+		if err != nil {
+			t.Error(err)
+		}
+		resCh <- res
+	}()
+
+	var dec *json.Decoder
+	for _, line := range []string{"hello", "world"} {
+		if _, err := io.WriteString(pw, line+"\n"); err != nil {
+			t.Fatal(err)
+		}
+
+		if dec == nil {
+			var res *http.Response
+			select {
+			case res = <-resCh:
+			case <-time.After(5 * time.Second):
+				t.Fatal("no response before the rest of the body")
+			}
+			if res == nil {
+				return
+			}
+			defer res.Body.Close()
+			dec = json.NewDecoder(res.Body)
+		}
+
+		got := make(chan string, 1)
+		go func() {
+			var v string
+			if err := dec.Decode(&v); err != nil {
+				t.Error(err)
+			}
+			got <- v
+		}()
+		select {
+		case v := <-got:
+			if v != strings.ToUpper(line) {
+				t.Errorf("expected %q, got %q", strings.ToUpper(line), v)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no answer to %q before the rest of the body", line)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+const (
+	healthPath = "/healthz"
+	readyPath  = "/readyz"
+)
+
+// HealthCheck returns an error if the part of the daemon it checks is not
+// working, e.g. if the repo is not open.
+type HealthCheck func(env cmds.Environment) error
+
+type healthHandler struct {
+	env    cmds.Environment
+	health map[string]HealthCheck
+	ready  map[string]HealthCheck
+	next   http.Handler
+}
+
+func newHealthHandler(env cmds.Environment, health, ready map[string]HealthCheck, next http.Handler) http.Handler {
+	return healthHandler{env: env, health: health, ready: ready, next: next}
+}
+
+func (h healthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var checks map[string]HealthCheck
+	switch r.URL.Path {
+	case healthPath:
+		checks = h.health
+	case readyPath:
+		checks = h.ready
+	}
+	if checks == nil {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "405 - Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	status := http.StatusOK
+	results := make([]string, len(names))
+	for i, name := range names {
+		if err := checks[name](h.env); err != nil {
+			status = http.StatusServiceUnavailable
+			results[i] = fmt.Sprintf("%s: %s", name, sanitizedErrStr(err))
+		} else {
+			results[i] = name + ": ok"
+		}
+	}
+
+	w.Header().Set(contentTypeHeader, plainText)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if r.Method == "HEAD" {
+		return
+	}
+	for _, res := range results {
+		fmt.Fprintln(w, res)
+	}
+}
@@ -0,0 +1,76 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+func TestHealthEndpoints(t *testing.T) {
+	env := testEnv{
+		version:     "0.1.2",
+		commit:      "c0mm17",
+		repoVersion: "4",
+		rootCtx:     context.Background(),
+		t:           t,
+		wait:        make(chan struct{}),
+	}
+
+	networkUp := false
+	cfg := originCfg(defaultOrigins)
+	cfg.APIPath = "/api/v0"
+	cfg.HealthChecks = map[string]HealthCheck{
+		"repo": func(env cmds.Environment) error {
+			if _, ok := getVersion(env); !ok {
+				return errors.New("no repo")
+			}
+			return nil
+		},
+	}
+	cfg.ReadyChecks = map[string]HealthCheck{
+		"repo": cfg.HealthChecks["repo"],
+		"network": func(cmds.Environment) error {
+			if !networkUp {
+				return errors.New("not connected")
+			}
+			return nil
+		},
+	}
+
+	h := NewHandler(env, cmdRoot, cfg)
+
+	type testcase struct {
+		method string
+		path   string
+		status int
+		body   string
+	}
+
+	check := func(tc testcase) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.path, nil))
+		if rec.Code != tc.status {
+			t.Errorf("%s %s: expected status %d but got %d", tc.method, tc.path, tc.status, rec.Code)
+		}
+		if tc.body != "" && rec.Body.String() != tc.body {
+			t.Errorf("%s %s: expected body %q but got %q", tc.method, tc.path, tc.body, rec.Body.String())
+		}
+	}
+
+	for _, tc := range []testcase{
+		{method: "GET", path: "/healthz", status: http.StatusOK, body: "repo: ok\n"},
+		{method: "GET", path: "/readyz", status: http.StatusServiceUnavailable, body: "network: not connected\nrepo: ok\n"},
+		{method: "POST", path: "/healthz", status: http.StatusMethodNotAllowed},
+		// commands still work
+		{method: "POST", path: "/api/v0/version", status: http.StatusOK},
+	} {
+		check(tc)
+	}
+
+	networkUp = true
+	check(testcase{method: "GET", path: "/readyz", status: http.StatusOK, body: "network: ok\nrepo: ok\n"})
+}
@@ -0,0 +1,93 @@
+package http
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+// heartbeatEncodings are the encodings whose decoders skip the whitespace
+// between values, so heartbeats don't change the decoded output.
+var heartbeatEncodings = map[cmds.EncodingType]bool{
+	cmds.JSON: true,
+	cmds.XML:  true,
+}
+
+// startHeartbeat makes re write a newline after every interval in which it
+// sent nothing, so proxies don't drop idle responses while a command is
+// slow to emit its next value, see ServerConfig.HeartbeatInterval.
+// Heartbeats are only written between the values of encodings in
+// heartbeatEncodings, not in the raw output of readers or in multipart
+// responses. If the command encodes values, see encodesValues, they start
+// right away, sending the preamble once it's idle before its first value;
+// otherwise they start once the first value was sent.
+func (re *responseEmitter) startHeartbeat(interval time.Duration) {
+	if !heartbeatEncodings[re.encType] || re.method == http.MethodHead {
+		return
+	}
+
+	early := encodesValues(re.req)
+	if early {
+		re.l.Lock()
+		re.lastWrite = time.Now()
+		re.l.Unlock()
+	}
+
+	re.stopHeartbeat = make(chan struct{})
+	go func(stop <-chan struct{}) {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-t.C:
+				re.heartbeat(now, interval, early)
+			}
+		}
+	}(re.stopHeartbeat)
+}
+
+// encodesValues returns whether the command of req declares a Type whose
+// values are encoded, so its response is a stream of values whatever it
+// emits first. Commands emitting readers or attachments usually don't
+// declare a Type.
+func encodesValues(req *cmds.Request) bool {
+	if req == nil || req.Command == nil || req.Command.Type == nil {
+		return false
+	}
+	switch req.Command.Type.(type) {
+	case io.Reader, cmds.Attachment, *cmds.Attachment:
+		return false
+	}
+	return true
+}
+
+// heartbeat writes a newline if re sent nothing for interval. With early,
+// it sends the preamble if the command didn't emit anything yet.
+func (re *responseEmitter) heartbeat(now time.Time, interval time.Duration, early bool) {
+	if early {
+		re.l.Lock()
+		idle := now.Sub(re.lastWrite) >= interval
+		re.l.Unlock()
+		if idle {
+			re.once.Do(func() { re.preamble(nil) })
+		}
+	}
+
+	re.l.Lock()
+	defer re.l.Unlock()
+
+	if re.closed || re.lastWrite.IsZero() || re.streaming || re.mw != nil || now.Sub(re.lastWrite) < interval {
+		return
+	}
+	if _, err := io.WriteString(re.w, "\n"); err != nil {
+		log.Debugf("error writing heartbeat: %s", err)
+		return
+	}
+	flushWith(re.rc)
+	re.lastWrite = now
+}
@@ -0,0 +1,115 @@
+package http
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+func TestHeartbeat(t *testing.T) {
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"slow": {
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					if err := re.Emit("first"); err != nil {
+						return err
+					}
+					time.Sleep(250 * time.Millisecond)
+					return re.Emit("second")
+				},
+				Type: "",
+			},
+			"idle": {
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					time.Sleep(250 * time.Millisecond)
+					return re.Emit("first")
+				},
+				Type: "",
+			},
+			// may emit a reader, the response can't be started early
+			"untyped": {
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					time.Sleep(250 * time.Millisecond)
+					return re.Emit(strings.NewReader("raw"))
+				},
+			},
+		},
+	}
+
+	cfg := originCfg(defaultOrigins)
+	cfg.HeartbeatInterval = 50 * time.Millisecond
+	srv := httptest.NewServer(NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, cfg))
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		path      string
+		enc       string
+		heartbeat bool
+	}{
+		{"/slow", cmds.JSON, true},
+		{"/slow", cmds.XML, true},
+		// the newlines would be part of the output
+		{"/slow", cmds.Text, false},
+		// heartbeats start before the first value
+		{"/idle", cmds.JSON, true},
+		{"/idle", cmds.XML, true},
+		{"/untyped", cmds.JSON, false},
+	} {
+		res, err := http.Post(srv.URL+tc.path+"?encoding="+tc.enc, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if heartbeat := strings.Count(string(body), "\n") > 2; heartbeat != tc.heartbeat {
+			t.Errorf("%s %s: unexpected body %q", tc.path, tc.enc, body)
+		}
+	}
+
+	// clients skip the heartbeats
+	req, err := cmds.NewRequest(context.Background(), []string{"slow"}, nil, nil, nil, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := NewClient(srv.URL).Send(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"first", "second"} {
+		v, err := res.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != expected {
+			t.Errorf("expected %q but got %v", expected, v)
+		}
+	}
+	if _, err := res.Next(); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+
+	req, err = cmds.NewRequest(context.Background(), []string{"idle"}, nil, nil, nil, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err = NewClient(srv.URL).Send(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := res.Next(); err != nil || v != "first" {
+		t.Errorf("expected %q after the heartbeats, got %v, %v", "first", v, err)
+	}
+	if _, err := res.Next(); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+package http
+
+import (
+	"time"
+)
+
+// RequestInfo describes a request sent by the client, see ClientHooks.
+type RequestInfo struct {
+	// Path is the path of the command.
+	Path []string
+	// Attempt numbers the attempts to send the request, starting at 1.
+	Attempt int
+	// Start is the time the request was sent.
+	Start time.Time
+	// Duration is the time until the response headers were received or
+	// the request failed. It is zero in OnRequest.
+	Duration time.Duration
+	// StatusCode is the status of the response, zero if none was received.
+	StatusCode int
+}
+
+// ClientHooks are called by the client around every request it sends, so
+// applications can record metrics and traces. All hooks are optional.
+type ClientHooks struct {
+	// OnRequest is called before a request is sent.
+	OnRequest func(RequestInfo)
+	// OnResponse is called when the headers of a successful response were
+	// received.
+	OnResponse func(RequestInfo)
+	// OnError is called if the request failed or the server responded with
+	// an error.
+	OnError func(RequestInfo, error)
+}
+
+// ClientWithHooks sets the hooks called around every request.
+func ClientWithHooks(hooks ClientHooks) ClientOpt {
+	return func(c *client) {
+		c.hooks = hooks
+	}
+}
+
+func (h ClientHooks) onRequest(info RequestInfo) {
+	if h.OnRequest != nil {
+		h.OnRequest(info)
+	}
+}
+
+func (h ClientHooks) onResponse(info RequestInfo) {
+	if h.OnResponse != nil {
+		h.OnResponse(info)
+	}
+}
+
+func (h ClientHooks) onError(info RequestInfo, err error) {
+	if h.OnError != nil {
+		h.OnError(info, err)
+	}
+}
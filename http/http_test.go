@@ -94,11 +94,6 @@ func TestHTTP(t *testing.T) {
 				t.Fatal("unexpected error:", err)
 			}
 
-			// TODO find a better way to solve this!
-			if s, ok := v.(*string); ok {
-				v = *s
-			}
-
 			if len(tc.r) == 0 {
 				// if we don't expect a reader
 				if !reflect.DeepEqual(v, tc.v) {
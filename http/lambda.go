@@ -0,0 +1,211 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// APIGatewayRequest is an API Gateway proxy integration event, as passed to
+// AWS Lambda functions. Its JSON encoding matches the event format, so it can
+// be used directly as the input type of a Lambda function.
+type APIGatewayRequest struct {
+	Resource                        string              `json:"resource"`
+	Path                            string              `json:"path"`
+	HTTPMethod                      string              `json:"httpMethod"`
+	Headers                         map[string]string   `json:"headers"`
+	MultiValueHeaders               map[string][]string `json:"multiValueHeaders"`
+	QueryStringParameters           map[string]string   `json:"queryStringParameters"`
+	MultiValueQueryStringParameters map[string][]string `json:"multiValueQueryStringParameters"`
+	RequestContext                  struct {
+		Identity struct {
+			SourceIP string `json:"sourceIp"`
+		} `json:"identity"`
+	} `json:"requestContext"`
+	Body            string `json:"body"`
+	IsBase64Encoded bool   `json:"isBase64Encoded"`
+}
+
+// APIGatewayResponse is the response to an API Gateway proxy integration
+// event.
+type APIGatewayResponse struct {
+	StatusCode        int                 `json:"statusCode"`
+	Headers           map[string]string   `json:"headers"`
+	MultiValueHeaders map[string][]string `json:"multiValueHeaders"`
+	Body              string              `json:"body"`
+	IsBase64Encoded   bool                `json:"isBase64Encoded"`
+}
+
+// NewLambdaHandler returns a function that serves API Gateway proxy events
+// using h, e.g. a handler returned by NewHandler. Since Lambda functions
+// can't stream, the whole response is buffered and errors that would have
+// been sent in the trailer are sent as regular headers.
+func NewLambdaHandler(h http.Handler) func(context.Context, APIGatewayRequest) (APIGatewayResponse, error) {
+	return func(ctx context.Context, ev APIGatewayRequest) (APIGatewayResponse, error) {
+		r, err := ev.toHTTPRequest(ctx)
+		if err != nil {
+			return APIGatewayResponse{}, err
+		}
+
+		w := newBufferedResponseWriter()
+		h.ServeHTTP(w, r)
+
+		return w.toAPIGatewayResponse(), nil
+	}
+}
+
+func (ev *APIGatewayRequest) toHTTPRequest(ctx context.Context) (*http.Request, error) {
+	query := url.Values{}
+	for k, v := range ev.QueryStringParameters {
+		query.Set(k, v)
+	}
+	for k, vs := range ev.MultiValueQueryStringParameters {
+		query[k] = vs
+	}
+
+	body := []byte(ev.Body)
+	if ev.IsBase64Encoded {
+		var err error
+		body, err = base64.StdEncoding.DecodeString(ev.Body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	u := url.URL{
+		Path:     ev.Path,
+		RawQuery: query.Encode(),
+	}
+
+	r, err := http.NewRequest(ev.HTTPMethod, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range ev.Headers {
+		r.Header.Set(k, v)
+	}
+	for k, vs := range ev.MultiValueHeaders {
+		r.Header.Del(k)
+		for _, v := range vs {
+			r.Header.Add(k, v)
+		}
+	}
+
+	r.Host = r.Header.Get("Host")
+	r.RemoteAddr = ev.RequestContext.Identity.SourceIP
+
+	return r.WithContext(ctx), nil
+}
+
+// bufferedResponseWriter is a http.ResponseWriter that keeps the whole
+// response in memory.
+type bufferedResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+
+	// sent is a copy of the header at the time WriteHeader was called.
+	sent http.Header
+}
+
+func newBufferedResponseWriter() *bufferedResponseWriter {
+	return &bufferedResponseWriter{header: make(http.Header)}
+}
+
+func (w *bufferedResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferedResponseWriter) WriteHeader(status int) {
+	if w.sent != nil {
+		return
+	}
+
+	w.status = status
+	w.sent = make(http.Header, len(w.header))
+	for k, v := range w.header {
+		w.sent[k] = append([]string(nil), v...)
+	}
+}
+
+func (w *bufferedResponseWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(b)
+}
+
+// Flush does nothing since the response can't be sent before it is complete.
+func (w *bufferedResponseWriter) Flush() {}
+
+// finalHeader returns the headers sent with WriteHeader, with the trailers
+// declared in the "Trailer" header merged in.
+func (w *bufferedResponseWriter) finalHeader() http.Header {
+	w.WriteHeader(http.StatusOK)
+
+	h := w.sent
+	for _, names := range h["Trailer"] {
+		for _, name := range strings.Split(names, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if vs, ok := w.header[name]; ok {
+				h[name] = vs
+			}
+		}
+	}
+	h.Del("Trailer")
+
+	return h
+}
+
+// writeTo sends the buffered response to rw with the Content-Length set, so
+// it isn't chunked.
+func (w *bufferedResponseWriter) writeTo(rw http.ResponseWriter) error {
+	h := w.finalHeader()
+	for k, v := range h {
+		rw.Header()[k] = v
+	}
+	rw.Header().Set("Content-Length", strconv.Itoa(w.body.Len()))
+
+	rw.WriteHeader(w.status)
+	_, err := rw.Write(w.body.Bytes())
+	return err
+}
+
+func (w *bufferedResponseWriter) toAPIGatewayResponse() APIGatewayResponse {
+	h := w.finalHeader()
+
+	res := APIGatewayResponse{
+		StatusCode:        w.status,
+		Headers:           make(map[string]string, len(h)),
+		MultiValueHeaders: map[string][]string(h),
+	}
+	for k := range h {
+		res.Headers[k] = h.Get(k)
+	}
+
+	body := w.body.Bytes()
+	if isTextContent(h.Get(contentTypeHeader)) && utf8.Valid(body) {
+		res.Body = string(body)
+	} else {
+		res.Body = base64.StdEncoding.EncodeToString(body)
+		res.IsBase64Encoded = true
+	}
+
+	return res
+}
+
+func isTextContent(contentType string) bool {
+	contentType = strings.TrimSpace(strings.Split(contentType, ";")[0])
+	switch {
+	case strings.HasPrefix(contentType, "text/"),
+		contentType == applicationJson,
+		contentType == "application/xml":
+		return true
+	default:
+		return false
+	}
+}
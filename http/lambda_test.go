@@ -0,0 +1,92 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func getTestLambdaHandler(t *testing.T) func(context.Context, APIGatewayRequest) (APIGatewayResponse, error) {
+	env := testEnv{
+		version:     "0.1.2",
+		commit:      "c0mm17",
+		repoVersion: "4",
+		rootCtx:     context.Background(),
+		t:           t,
+		wait:        make(chan struct{}),
+	}
+
+	return NewLambdaHandler(NewHandler(env, cmdRoot, originCfg(defaultOrigins)))
+}
+
+func TestLambdaHandler(t *testing.T) {
+	h := getTestLambdaHandler(t)
+
+	res, err := h(context.Background(), APIGatewayRequest{
+		HTTPMethod: "POST",
+		Path:       "/version",
+		MultiValueQueryStringParameters: map[string][]string{
+			"all": {"true"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.StatusCode != 200 {
+		t.Fatalf("expected status 200 but got %d", res.StatusCode)
+	}
+
+	if ct := res.Headers[contentTypeHeader]; ct != applicationJson {
+		t.Errorf("expected content type %q but got %q", applicationJson, ct)
+	}
+
+	if res.IsBase64Encoded {
+		t.Error("json body should not be base64 encoded")
+	}
+
+	var v VersionOutput
+	if err := json.Unmarshal([]byte(res.Body), &v); err != nil {
+		t.Fatal(err)
+	}
+
+	if v.Version != "0.1.2" || v.Commit != "c0mm17" {
+		t.Errorf("unexpected version output %#v", v)
+	}
+}
+
+func TestLambdaHandlerTrailerError(t *testing.T) {
+	h := getTestLambdaHandler(t)
+
+	res, err := h(context.Background(), APIGatewayRequest{
+		HTTPMethod: "POST",
+		Path:       "/lateerror",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e := res.Headers[StreamErrHeader]; e != "an error occurred" {
+		t.Errorf("expected stream error header %q but got %q", "an error occurred", e)
+	}
+
+	if _, ok := res.Headers["Trailer"]; ok {
+		t.Error("buffered response should not announce trailers")
+	}
+}
+
+func TestLambdaHandlerNotFound(t *testing.T) {
+	h := getTestLambdaHandler(t)
+
+	res, err := h(context.Background(), APIGatewayRequest{
+		HTTPMethod: "POST",
+		Path:       "/nonexistent",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.StatusCode != 404 {
+		t.Errorf("expected status 404 but got %d", res.StatusCode)
+	}
+}
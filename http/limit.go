@@ -0,0 +1,196 @@
+package http
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxIdleClients is the number of clients the rate limiter tracks before it
+// forgets the clients whose budget is full again.
+const maxIdleClients = 1024
+
+// the keys of the limits of MaxRequests and MaxStreamingRequests, the ones
+// of CommandLimits are their paths prefixed with "command "
+const (
+	unaryLimit     = "requests"
+	streamingLimit = "streaming"
+)
+
+// limit is the maximum number of requests executing at the same time that
+// count against the key.
+type limit struct {
+	key string
+	max int
+}
+
+// executing counts the executing requests by the key of the limit they
+// count against. The counts are shared by the configurations of a Handler,
+// so requests executing before a reload count against the new limits.
+type executing struct {
+	l sync.Mutex
+	n map[string]int
+}
+
+func newExecuting() *executing {
+	return &executing{n: make(map[string]int)}
+}
+
+// acquire counts a request against l, unless l.max requests are executing
+// already. The returned function must be called once the request is done,
+// it is nil if the limit is reached.
+func (e *executing) acquire(l limit) func() {
+	e.l.Lock()
+	defer e.l.Unlock()
+
+	if e.n[l.key] >= l.max {
+		return nil
+	}
+	e.n[l.key]++
+
+	return func() {
+		e.l.Lock()
+		defer e.l.Unlock()
+
+		if e.n[l.key]--; e.n[l.key] <= 0 {
+			delete(e.n, l.key)
+		}
+	}
+}
+
+// commandLimits limits the number of requests executing at the same time
+// for the commands at some paths and their subcommands, see
+// ServerConfig.CommandLimits.
+type commandLimits struct {
+	paths [][]string
+	max   []int
+}
+
+func newCommandLimits(limits map[string]int) *commandLimits {
+	cl := &commandLimits{}
+	for p, n := range limits {
+		if n <= 0 {
+			continue
+		}
+		cl.paths = append(cl.paths, splitPaths([]string{p})[0])
+		cl.max = append(cl.max, n)
+	}
+	if len(cl.max) == 0 {
+		return nil
+	}
+	return cl
+}
+
+// limit returns the limit of the longest path path is or is a subcommand
+// of, the zero limit if the command isn't limited.
+func (cl *commandLimits) limit(path []string) limit {
+	if cl == nil {
+		return limit{}
+	}
+	if i := longestPath(cl.paths, path); i >= 0 {
+		return limit{key: "command " + strings.Join(cl.paths[i], " "), max: cl.max[i]}
+	}
+	return limit{}
+}
+
+// longestPath returns the index of the longest of paths path is or is a
+// subcommand of, -1 if there is none.
+func longestPath(paths [][]string, path []string) int {
+	match := -1
+	for i, p := range paths {
+		if (match < 0 || len(p) > len(paths[match])) && matchesPath(paths[i:i+1], path) {
+			match = i
+		}
+	}
+	return match
+}
+
+// rateLimiter limits the rate of the requests of every client with a token
+// bucket, see ServerConfig.ClientRate.
+type rateLimiter struct {
+	rate    float64
+	burst   float64
+	key     func(*http.Request) string
+	buckets *clientBuckets
+}
+
+// clientBuckets holds the token buckets of the clients. They are shared by
+// the configurations of a Handler, so a reload doesn't refill them.
+type clientBuckets struct {
+	l sync.Mutex
+	m map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newClientBuckets() *clientBuckets {
+	return &clientBuckets{m: make(map[string]*bucket)}
+}
+
+func newRateLimiter(rate float64, burst int, key func(*http.Request) string, buckets *clientBuckets) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	if key == nil {
+		key = remoteHost
+	}
+	return &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		key:     key,
+		buckets: buckets,
+	}
+}
+
+// allow takes a token from the bucket of the client of r. If there is none,
+// it returns false and the time until there is one.
+func (rl *rateLimiter) allow(r *http.Request, now time.Time) (bool, time.Duration) {
+	k := rl.key(r)
+
+	rl.buckets.l.Lock()
+	defer rl.buckets.l.Unlock()
+
+	b, ok := rl.buckets.m[k]
+	if !ok {
+		if len(rl.buckets.m) >= maxIdleClients {
+			rl.forgetIdle(now)
+		}
+		b = &bucket{tokens: rl.burst, last: now}
+		rl.buckets.m[k] = b
+	}
+
+	b.tokens = math.Min(rl.burst, b.tokens+now.Sub(b.last).Seconds()*rl.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / rl.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// forgetIdle drops the buckets that have refilled, they are recreated full.
+func (rl *rateLimiter) forgetIdle(now time.Time) {
+	for k, b := range rl.buckets.m {
+		if b.tokens+now.Sub(b.last).Seconds()*rl.rate >= rl.burst {
+			delete(rl.buckets.m, k)
+		}
+	}
+}
+
+// remoteHost returns the host of the address of the client of r.
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
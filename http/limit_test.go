@@ -0,0 +1,134 @@
+package http
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+func TestCommandLimits(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	block := func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		started <- struct{}{}
+		<-release
+		return re.Emit("done")
+	}
+
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"dag": {
+				Subcommands: map[string]*cmds.Command{
+					"export": {Run: block, Streaming: true},
+					"get":    {Run: block},
+				},
+			},
+			"id": {Run: block},
+		},
+	}
+
+	cfg := originCfg(defaultOrigins)
+	cfg.CommandLimits = map[string]int{"dag": 1, "dag export": 1}
+	h := NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, cfg)
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	post := func(path string) int {
+		res, err := http.Post(srv.URL+path, "", nil)
+		if err != nil {
+			// also called from other goroutines
+			t.Error(err)
+			return 0
+		}
+		ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	done := make(chan int, 3)
+	for _, path := range []string{"/dag/export", "/dag/get"} {
+		go func(path string) { done <- post(path) }(path)
+		<-started
+	}
+	// the executing requests count against the limits after a reload
+	h.SetConfig(cfg)
+
+	// dag export counts against its own limit only, dag get against the one
+	// of dag
+	for _, path := range []string{"/dag/export", "/dag/get"} {
+		if status := post(path); status != http.StatusTooManyRequests {
+			t.Errorf("%s: expected status 429 but got %d", path, status)
+		}
+	}
+	// other commands aren't limited
+	go func() { done <- post("/id") }()
+	<-started
+
+	close(release)
+	for i := 0; i < 3; i++ {
+		if status := <-done; status != http.StatusOK {
+			t.Errorf("expected the running requests to succeed, got status %d", status)
+		}
+	}
+}
+
+func TestClientRate(t *testing.T) {
+	rl := newRateLimiter(2, 2, nil, newClientBuckets())
+	now := time.Now()
+	r := httptest.NewRequest(http.MethodPost, "/id", nil)
+	other := httptest.NewRequest(http.MethodPost, "/id", nil)
+	other.RemoteAddr = "192.0.2.2:1234"
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := rl.allow(r, now); !ok {
+			t.Fatalf("expected request %d of the burst to be allowed", i)
+		}
+	}
+	if ok, retry := rl.allow(r, now); ok || retry != 500*time.Millisecond {
+		t.Errorf("expected the request to be rejected for 500ms, got %v, %s", ok, retry)
+	}
+	if ok, _ := rl.allow(other, now); !ok {
+		t.Error("expected the requests of other clients to be allowed")
+	}
+	if ok, _ := rl.allow(r, now.Add(500*time.Millisecond)); !ok {
+		t.Error("expected the request to be allowed once a token was added")
+	}
+
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"id": {
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					return re.Emit("id")
+				},
+			},
+		},
+	}
+	cfg := originCfg(defaultOrigins)
+	cfg.ClientRate = 0.1
+	h := NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, cfg)
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	for i, expected := range []int{http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests} {
+		if i == 2 {
+			// a reload doesn't refill the budget
+			h.SetConfig(cfg)
+		}
+		res, err := http.Post(srv.URL+"/id", "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != expected {
+			t.Errorf("request %d: expected status %d but got %d", i, expected, res.StatusCode)
+		}
+		if ra := res.Header.Get("Retry-After"); expected != http.StatusOK && ra != "10" {
+			t.Errorf("expected Retry-After 10 but got %q", ra)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ShutdownTimeout is the time Serve waits for active requests to finish
+// after its context is canceled before closing all connections forcefully.
+var ShutdownTimeout = 30 * time.Second
+
+// listenFdsStart is the first file descriptor passed by systemd
+// (SD_LISTEN_FDS_START).
+var listenFdsStart = 3
+
+// SystemdListeners returns the sockets passed to the process by systemd
+// socket activation (see sd_listen_fds(3)). It returns no listeners and no
+// error if the process wasn't socket activated.
+//
+// The environment variables used by systemd are unset so the sockets are not
+// passed on to child processes.
+func SystemdListeners() ([]net.Listener, error) {
+	pidStr := os.Getenv("LISTEN_PID")
+	fdsStr := os.Getenv("LISTEN_FDS")
+	namesStr := os.Getenv("LISTEN_FDNAMES")
+
+	if pidStr == "" || fdsStr == "" {
+		return nil, nil
+	}
+
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	pid, err := strconv.Atoi(pidStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LISTEN_PID %q: %s", pidStr, err)
+	}
+	if pid != os.Getpid() {
+		// the sockets were meant for someone else
+		return nil, nil
+	}
+
+	n, err := strconv.Atoi(fdsStr)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q", fdsStr)
+	}
+
+	var names []string
+	if namesStr != "" {
+		names = strings.Split(namesStr, ":")
+	}
+
+	listeners := make([]net.Listener, 0, n)
+	for i := 0; i < n; i++ {
+		fd := listenFdsStart + i
+
+		name := "LISTEN_FD_" + strconv.Itoa(fd)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+
+		f := os.NewFile(uintptr(fd), name)
+		l, err := net.FileListener(f)
+		// FileListener dups the descriptor
+		f.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("socket %s passed by systemd is not a listener: %s", name, err)
+		}
+
+		listeners = append(listeners, l)
+	}
+
+	return listeners, nil
+}
+
+// DefaultProtocols returns the HTTP versions Serve accepts: HTTP/1.1, HTTP/2
+// over TLS and HTTP/2 without TLS (h2c, with prior knowledge), which is what
+// clients of local daemons use with ClientWithProtocols.
+func DefaultProtocols() *http.Protocols {
+	p := new(http.Protocols)
+	p.SetHTTP1(true)
+	p.SetHTTP2(true)
+	p.SetUnencryptedHTTP2(true)
+	return p
+}
+
+// Serve serves handler on all listeners until ctx is canceled or one of the
+// listeners fails. In both cases the server is shut down gracefully, waiting
+// up to ShutdownTimeout for active requests to finish.
+//
+// The server uses the settings of NewServer. Use a Server or ServeServer to
+// configure it.
+//
+// Serve returns nil if it was stopped by ctx, otherwise the error of the
+// failing listener.
+func Serve(ctx context.Context, handler http.Handler, listeners ...net.Listener) error {
+	return NewServer(handler).Serve(ctx, listeners...)
+}
+
+// ServeServer is like Serve but uses srv, e.g. one with srv.Protocols set to
+// only allow HTTP/1.1.
+func ServeServer(ctx context.Context, srv *http.Server, listeners ...net.Listener) error {
+	if len(listeners) == 0 {
+		return fmt.Errorf("no listeners to serve on")
+	}
+
+	return serve(ctx, srv, listeners)
+}
+
+func serve(ctx context.Context, srv *http.Server, listeners []net.Listener) error {
+	errCh := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func(l net.Listener) {
+			errCh <- srv.Serve(l)
+		}(l)
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-errCh:
+	}
+
+	sctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+
+	if shutdownErr := srv.Shutdown(sctx); shutdownErr != nil {
+		log.Warningf("graceful shutdown failed, closing connections: %s", shutdownErr)
+		srv.Close()
+	}
+
+	if err == http.ErrServerClosed {
+		err = nil
+	}
+	return err
+}
+
+// Listen opens a listener on each of addrs, closing the ones already opened
+// if one fails. An address is one of
+//
+//   - a multiaddr: /ip4/127.0.0.1/tcp/5001, /ip6/::1/tcp/5001,
+//     /dns4/localhost/tcp/5001 or /unix/var/run/api.sock,
+//   - a unix socket path prefixed with "unix:", e.g. unix:api.sock or
+//     unix:///var/run/api.sock,
+//   - a TCP address such as localhost:5001 or :5001.
+func Listen(addrs ...string) ([]net.Listener, error) {
+	listeners := make([]net.Listener, 0, len(addrs))
+	for _, addr := range addrs {
+		network, address, err := parseListenAddr(addr)
+		if err == nil {
+			var l net.Listener
+			l, err = net.Listen(network, address)
+			if err == nil {
+				listeners = append(listeners, l)
+				continue
+			}
+		}
+
+		for _, l := range listeners {
+			l.Close()
+		}
+		return nil, err
+	}
+
+	return listeners, nil
+}
+
+// parseListenAddr returns the network and address to pass to net.Listen or
+// net.Dial for addr, see Listen.
+func parseListenAddr(addr string) (string, string, error) {
+	if strings.HasPrefix(addr, "unix:") {
+		// unix:///path is the URL form of unix:/path
+		path := strings.TrimPrefix(strings.TrimPrefix(addr, "unix:"), "//")
+		if path == "" {
+			return "", "", fmt.Errorf("invalid address %q: missing socket path", addr)
+		}
+		return "unix", path, nil
+	}
+	if !strings.HasPrefix(addr, "/") {
+		return "tcp", addr, nil
+	}
+
+	parts := strings.Split(addr[1:], "/")
+	if parts[0] == "unix" {
+		if len(parts) < 2 || parts[1] == "" {
+			return "", "", fmt.Errorf("invalid multiaddr %q: missing socket path", addr)
+		}
+		return "unix", "/" + strings.Join(parts[1:], "/"), nil
+	}
+
+	if len(parts) != 4 || parts[2] != "tcp" {
+		return "", "", fmt.Errorf("unsupported multiaddr %q, expected /<ip4|ip6|dns|dns4|dns6>/<host>/tcp/<port> or /unix/<path>", addr)
+	}
+
+	host, port := parts[1], parts[3]
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return "", "", fmt.Errorf("invalid multiaddr %q: invalid port %q", addr, port)
+	}
+
+	switch parts[0] {
+	case "ip4":
+		if ip := net.ParseIP(host); ip == nil || ip.To4() == nil {
+			return "", "", fmt.Errorf("invalid multiaddr %q: invalid IPv4 address %q", addr, host)
+		}
+		return "tcp4", net.JoinHostPort(host, port), nil
+	case "ip6":
+		if ip := net.ParseIP(host); ip == nil || ip.To4() != nil {
+			return "", "", fmt.Errorf("invalid multiaddr %q: invalid IPv6 address %q", addr, host)
+		}
+		return "tcp6", net.JoinHostPort(host, port), nil
+	case "dns":
+		return "tcp", net.JoinHostPort(host, port), nil
+	case "dns4":
+		return "tcp4", net.JoinHostPort(host, port), nil
+	case "dns6":
+		return "tcp6", net.JoinHostPort(host, port), nil
+	default:
+		return "", "", fmt.Errorf("unsupported multiaddr %q: unknown protocol %q", addr, parts[0])
+	}
+}
+
+// ListenAndServe serves handler on the sockets passed by systemd socket
+// activation or, if there are none, on addrs (see Listen for the address
+// formats).
+// See Serve for how the server is stopped.
+func ListenAndServe(ctx context.Context, handler http.Handler, addrs ...string) error {
+	return NewServer(handler).ListenAndServe(ctx, addrs...)
+}
@@ -0,0 +1,301 @@
+package http
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+func TestServe(t *testing.T) {
+	var listeners []net.Listener
+	for i := 0; i < 2; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		listeners = append(listeners, l)
+	}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error)
+	go func() {
+		errCh <- Serve(ctx, h, listeners...)
+	}()
+
+	for _, l := range listeners {
+		res, err := http.Get("http://" + l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != "hello" {
+			t.Errorf("expected body %q but got %q", "hello", body)
+		}
+	}
+
+	cancel()
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return after cancel")
+	}
+
+	for _, l := range listeners {
+		if _, err := net.Dial("tcp", l.Addr().String()); err == nil {
+			t.Error("listener still accepting connections after shutdown")
+		}
+	}
+}
+
+func TestSystemdListeners(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	f, err := l.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	oldStart := listenFdsStart
+	listenFdsStart = int(f.Fd())
+	defer func() { listenFdsStart = oldStart }()
+
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	os.Setenv("LISTEN_FDS", "1")
+	os.Setenv("LISTEN_FDNAMES", "api")
+
+	listeners, err := SystemdListeners()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(listeners) != 1 {
+		t.Fatalf("expected one listener but got %d", len(listeners))
+	}
+	defer listeners[0].Close()
+
+	if a, b := listeners[0].Addr().String(), l.Addr().String(); a != b {
+		t.Errorf("expected listener on %s but got %s", b, a)
+	}
+
+	if os.Getenv("LISTEN_FDS") != "" {
+		t.Error("expected LISTEN_FDS to be unset")
+	}
+
+	// calling again must not return the same sockets
+	listeners, err = SystemdListeners()
+	if err != nil || len(listeners) != 0 {
+		t.Errorf("expected no listeners on second call, got %v (err: %v)", listeners, err)
+	}
+}
+
+func TestSystemdListenersOtherPid(t *testing.T) {
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	os.Setenv("LISTEN_FDS", "1")
+
+	listeners, err := SystemdListeners()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(listeners) != 0 {
+		t.Fatalf("expected no listeners but got %d", len(listeners))
+	}
+}
+
+func TestServeH2C(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := testEnv{
+		version:     "0.1.2",
+		commit:      "c0mm17",
+		repoVersion: "4",
+		rootCtx:     context.Background(),
+		t:           t,
+		wait:        make(chan struct{}),
+	}
+	cmdsHandler := NewHandler(env, cmdRoot, originCfg(defaultOrigins))
+
+	protoCh := make(chan string, 1)
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case protoCh <- r.Proto:
+		default:
+		}
+		cmdsHandler.ServeHTTP(w, r)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go Serve(ctx, h, l)
+
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	c := NewClient(l.Addr().String(), ClientWithProtocols(protocols))
+
+	// a streamed value followed by an error in the trailer
+	req, err := cmds.NewRequest(context.Background(), []string{"lateerror"}, nil, nil, nil, cmdRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := c.Send(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if proto := <-protoCh; proto != "HTTP/2.0" {
+		t.Errorf("expected HTTP/2.0 but got %s", proto)
+	}
+
+	v, err := res.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, ok := v.(string); !ok || s != "some value" {
+		t.Errorf("expected value %q but got %v", "some value", v)
+	}
+
+	_, err = res.Next()
+	if err == nil || err.Error() != "an error occurred" {
+		t.Errorf("expected the trailer error but got %v", err)
+	}
+}
+
+func TestParseListenAddr(t *testing.T) {
+	type testcase struct {
+		addr    string
+		network string
+		address string
+		err     bool
+	}
+
+	tcs := []testcase{
+		{addr: "/ip4/127.0.0.1/tcp/5001", network: "tcp4", address: "127.0.0.1:5001"},
+		{addr: "/ip6/::1/tcp/5001", network: "tcp6", address: "[::1]:5001"},
+		{addr: "/dns4/localhost/tcp/5001", network: "tcp4", address: "localhost:5001"},
+		{addr: "/dns/localhost/tcp/5001", network: "tcp", address: "localhost:5001"},
+		{addr: "/unix/var/run/api.sock", network: "unix", address: "/var/run/api.sock"},
+		{addr: "unix:api.sock", network: "unix", address: "api.sock"},
+		{addr: "unix:///var/run/api.sock", network: "unix", address: "/var/run/api.sock"},
+		{addr: "unix:/var/run/api.sock", network: "unix", address: "/var/run/api.sock"},
+		{addr: "localhost:5001", network: "tcp", address: "localhost:5001"},
+		{addr: ":5001", network: "tcp", address: ":5001"},
+		{addr: "/ip4/::1/tcp/5001", err: true},
+		{addr: "/ip6/127.0.0.1/tcp/5001", err: true},
+		{addr: "/ip4/127.0.0.1/udp/5001", err: true},
+		{addr: "/ip4/127.0.0.1/tcp/http", err: true},
+		{addr: "/ip4/127.0.0.1", err: true},
+		{addr: "/unix", err: true},
+		{addr: "unix://", err: true},
+		{addr: "/quic/foo/tcp/1", err: true},
+	}
+
+	for _, tc := range tcs {
+		network, address, err := parseListenAddr(tc.addr)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%s: expected an error but got %s %s", tc.addr, network, address)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tc.addr, err)
+			continue
+		}
+		if network != tc.network || address != tc.address {
+			t.Errorf("%s: expected %s %s but got %s %s", tc.addr, tc.network, tc.address, network, address)
+		}
+	}
+}
+
+func TestListen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cmds-listen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sock := filepath.Join(dir, "api.sock")
+	listeners, err := Listen("/ip4/127.0.0.1/tcp/0", "/unix"+sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error)
+	go func() {
+		errCh <- Serve(ctx, h, listeners...)
+	}()
+
+	unixClient := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+		},
+	}}
+
+	for _, get := range []func() (*http.Response, error){
+		func() (*http.Response, error) { return http.Get("http://" + listeners[0].Addr().String()) },
+		func() (*http.Response, error) { return unixClient.Get("http://unix") },
+	} {
+		res, err := get()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != "hello" {
+			t.Errorf("expected body %q but got %q", "hello", body)
+		}
+	}
+
+	cancel()
+	if err := <-errCh; err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if _, err := os.Stat(sock); !os.IsNotExist(err) {
+		t.Error("expected the socket to be removed after shutdown")
+	}
+
+	// a failing address closes the listeners opened before
+	if _, err := Listen("127.0.0.1:0", "/ip4/127.0.0.1/udp/0"); err == nil {
+		t.Error("expected an error for the udp address")
+	}
+}
@@ -0,0 +1,54 @@
+package http
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+// countingResponseWriter counts the bytes of the response body for the
+// command metrics.
+type countingResponseWriter struct {
+	http.ResponseWriter
+	n atomic.Uint64
+}
+
+func (w *countingResponseWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.n.Add(uint64(n))
+	return n, err
+}
+
+func (w *countingResponseWriter) Flush() {
+	flush(w.ResponseWriter)
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController.
+func (w *countingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// collector returns a collector passing the metrics to c with the bytes
+// written to w.
+func (w *countingResponseWriter) collector(c cmds.MetricsCollector) cmds.MetricsCollector {
+	return &bodyBytesCollector{w: w, c: c}
+}
+
+// bodyBytesCollector sets the bytes of the metrics passed to c, it is
+// started if c is a cmds.StartCollector.
+type bodyBytesCollector struct {
+	w *countingResponseWriter
+	c cmds.MetricsCollector
+}
+
+func (c *bodyBytesCollector) Start(path []string) {
+	if sc, ok := c.c.(cmds.StartCollector); ok {
+		sc.Start(path)
+	}
+}
+
+func (c *bodyBytesCollector) Collect(m cmds.CommandMetrics) {
+	m.Bytes = c.w.n.Load()
+	c.c.Collect(m)
+}
@@ -0,0 +1,55 @@
+package http
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+func TestHandlerMetrics(t *testing.T) {
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"list": {
+				Type: "",
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					for _, v := range []string{"a", "b", "c"} {
+						if err := re.Emit(v); err != nil {
+							return err
+						}
+					}
+					return nil
+				},
+			},
+		},
+	}
+
+	metrics := make(chan cmds.CommandMetrics, 1)
+	cfg := originCfg(defaultOrigins)
+	cfg.Metrics = cmds.MetricsCollectorFunc(func(m cmds.CommandMetrics) {
+		metrics <- m
+	})
+	srv := httptest.NewServer(NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, cfg))
+	defer srv.Close()
+
+	res, err := http.Post(srv.URL+"/list", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := <-metrics
+	if len(m.Path) != 1 || m.Path[0] != "list" || m.Emitted != 3 {
+		t.Errorf("unexpected metrics %+v", m)
+	}
+	if m.Bytes != uint64(len(body)) {
+		t.Errorf("expected %d bytes but got %d", len(body), m.Bytes)
+	}
+}
@@ -0,0 +1,60 @@
+package http
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+func TestHandlerExecutor(t *testing.T) {
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"echo": {
+				Arguments: []cmdkit.Argument{cmdkit.StringArg("text", true, false, "the text")},
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					return cmds.EmitOnce(re, req.Arguments[0])
+				},
+			},
+		},
+	}
+
+	var executed []string
+	cfg := originCfg(defaultOrigins)
+	cfg.Executor = cmds.NewExecutorWithMiddleware(root, func(next cmds.Executor) cmds.Executor {
+		return cmds.ExecutorFunc(func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+			executed = append(executed, req.Arguments[0])
+			if req.Arguments[0] == "reject" {
+				return cmdkit.Errorf(cmdkit.ErrClient, "rejected by middleware")
+			}
+			return next.Execute(req, re, env)
+		})
+	})
+	srv := httptest.NewServer(NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, cfg))
+	defer srv.Close()
+
+	send := func(text string) (interface{}, error) {
+		req, err := cmds.NewRequest(context.Background(), []string{"echo"}, nil, []string{text}, nil, root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := NewClient(srv.URL).Send(req)
+		if err != nil {
+			return nil, err
+		}
+		return res.Next()
+	}
+
+	if v, err := send("hello"); err != nil || v != "hello" {
+		t.Errorf("expected the output of the command, got %v, %v", v, err)
+	}
+	_, err := send("reject")
+	if e, ok := err.(*cmdkit.Error); !ok || e.Message != "rejected by middleware" || e.Code != cmdkit.ErrClient {
+		t.Errorf("expected the error of the middleware, got %#v", err)
+	}
+	if len(executed) != 2 {
+		t.Errorf("expected the middleware to see both requests, got %v", executed)
+	}
+}
@@ -0,0 +1,87 @@
+package http
+
+import (
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+// encodingPrefHeader lists the encodings the client prefers, most preferred
+// first, for requests that don't set the encoding option.
+const encodingPrefHeader = "X-Encoding-Preference"
+
+const acceptHeader = "Accept"
+
+// ClientWithEncodings makes the server encode responses with the first of
+// encs it supports for the command, falling back to JSON. Encodings the
+// client can't decode, i.e. that have no entry in cmds.Decoders, are
+// ignored.
+func ClientWithEncodings(encs ...cmds.EncodingType) ClientOpt {
+	return func(c *client) {
+		c.encodings = c.encodings[:0]
+		for _, enc := range encs {
+			if _, ok := cmds.Decoders[enc]; ok {
+				c.encodings = append(c.encodings, string(enc))
+			}
+		}
+	}
+}
+
+// negotiateEncoding returns the first encoding in pref that cmd can be
+// encoded with, or JSON.
+func negotiateEncoding(pref string, cmd *cmds.Command) string {
+	for _, enc := range strings.Split(pref, ",") {
+		enc := cmds.EncodingType(strings.TrimSpace(enc))
+		if cmds.HasEncoder(cmd, enc) {
+			return string(enc)
+		}
+	}
+
+	return cmds.JSON
+}
+
+// acceptedEncodings returns the encodings of the media types in the Accept
+// header accept that have an entry in MIMEEncodings, most preferred first,
+// in the format of the encoding preference header. Wildcards are ignored.
+// Browsers, which accept text/html, get the default encoding even though
+// they accept XML.
+func acceptedEncodings(accept string) string {
+	type accepted struct {
+		enc string
+		q   float64
+	}
+
+	var encs []accepted
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if mt == "text/html" {
+			return ""
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil || q <= 0 {
+				continue
+			}
+		}
+		if enc, ok := MIMEEncodings[mt]; ok {
+			encs = append(encs, accepted{string(enc), q})
+		}
+	}
+
+	sort.SliceStable(encs, func(i, j int) bool {
+		return encs[i].q > encs[j].q
+	})
+
+	names := make([]string, len(encs))
+	for i, a := range encs {
+		names[i] = a.enc
+	}
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,146 @@
+package http
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+type negotiateValue struct {
+	Name string
+}
+
+func TestClientEncodings(t *testing.T) {
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"value": {
+				Type: negotiateValue{},
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					return re.Emit(&negotiateValue{Name: "some value"})
+				},
+			},
+		},
+	}
+
+	var contentType string
+	h := NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, originCfg(defaultOrigins))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		contentType = rec.Header().Get(contentTypeHeader)
+		for k, v := range rec.Header() {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(rec.Code)
+		io.Copy(w, rec.Body)
+	}))
+	defer srv.Close()
+
+	tcs := []struct {
+		encs        []cmds.EncodingType
+		contentType string
+	}{
+		{nil, "application/json"},
+		{[]cmds.EncodingType{cmds.XML, cmds.JSON}, "application/xml"},
+		{[]cmds.EncodingType{cmds.CBOR}, "application/cbor"},
+		// the client can't decode protobuf
+		{[]cmds.EncodingType{cmds.Protobuf, cmds.JSON}, "application/json"},
+	}
+
+	for _, tc := range tcs {
+		c := NewClient(srv.URL, ClientWithEncodings(tc.encs...))
+		req, err := cmds.NewRequest(context.Background(), []string{"value"}, nil, nil, nil, root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := c.Send(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := res.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if contentType != tc.contentType {
+			t.Errorf("%v: expected content type %q but got %q", tc.encs, tc.contentType, contentType)
+		}
+		if v.(*negotiateValue).Name != "some value" {
+			t.Errorf("%v: unexpected value %#v", tc.encs, v)
+		}
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	cmd := &cmds.Command{
+		Encoders: cmds.EncoderMap{
+			"cbor": cmds.Encoders[cmds.JSON],
+		},
+		TypedEncoders: cmds.NewEncoderRegistry(),
+	}
+	cmd.TypedEncoders.Register("csv", negotiateValue{}, cmds.Encoders[cmds.Text])
+
+	for pref, expected := range map[string]string{
+		"":           cmds.JSON,
+		"yaml":       cmds.JSON,
+		"yaml, xml":  cmds.XML,
+		"cbor,json":  "cbor",
+		" text, xml": cmds.Text,
+		"csv, json":  "csv",
+	} {
+		if enc := negotiateEncoding(pref, cmd); enc != expected {
+			t.Errorf("%q: expected %q but got %q", pref, expected, enc)
+		}
+	}
+}
+
+func TestAcceptedEncodings(t *testing.T) {
+	for accept, expected := range map[string]string{
+		"":                 "",
+		"*/*":              "",
+		"application/cbor": "cbor",
+		"application/json;q=0.5, application/cbor":  "cbor,json",
+		"application/xml;q=0.9, text/plain;q=1":     "text,xml",
+		"application/cbor;q=0, application/json":    "json",
+		"text/html,application/xml;q=0.9,*/*;q=0.8": "",
+	} {
+		if encs := acceptedEncodings(accept); encs != expected {
+			t.Errorf("%q: expected %q but got %q", accept, expected, encs)
+		}
+	}
+}
+
+func TestHandlerAccept(t *testing.T) {
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"value": {
+				Type: negotiateValue{},
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					return re.Emit(&negotiateValue{Name: "some value"})
+				},
+			},
+		},
+	}
+	h := NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, originCfg(defaultOrigins))
+
+	for accept, contentType := range map[string]string{
+		"application/cbor":                         "application/cbor",
+		"application/yaml, application/xml":        "application/xml",
+		"text/html, application/cbor;q=0.9":        "application/json",
+		"application/cbor;q=0.1, application/json": "application/json",
+	} {
+		r := httptest.NewRequest("POST", "/value", nil)
+		r.Header.Set("Origin", "http://localhost")
+		r.Header.Set(acceptHeader, accept)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if ct := w.Header().Get(contentTypeHeader); ct != contentType {
+			t.Errorf("%q: expected content type %q but got %q", accept, contentType, ct)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+// OpenAPIPath is the path of the endpoint serving the OpenAPI document of
+// the command tree, see OpenAPI. A GET request to <APIPath>/_openapi returns
+// the document as JSON.
+const OpenAPIPath = "_openapi"
+
+// OpenAPIInfo is the info object of the OpenAPI document of a server.
+type OpenAPIInfo struct {
+	Title       string
+	Version     string
+	Description string
+}
+
+// isOpenAPIRequest checks whether pth (without leading slash) addresses the
+// OpenAPI endpoint.
+func isOpenAPIRequest(pth string) bool {
+	return pth == OpenAPIPath
+}
+
+// OpenAPI returns the OpenAPI 3 document describing the runnable commands of
+// root as served with cfg, so clients can be generated for the API. The
+// schema of the values of a command is derived from its Type. Streaming and
+// paginated commands are marked with the x-streaming and x-paginated
+// extensions.
+func OpenAPI(root *cmds.Command, cfg *ServerConfig) map[string]interface{} {
+	info := cfg.APIInfo
+	if info.Title == "" {
+		info.Title = "API"
+	}
+	if info.Version == "" {
+		info.Version = "0"
+	}
+
+	method := "post"
+	if methods := cfg.AllowedMethods(); len(methods) > 0 && !containsMethod(methods, http.MethodPost) {
+		method = "get"
+	}
+
+	paths := make(map[string]interface{})
+	var walk func(tree *cmds.CommandTree, chain []*cmds.Command)
+	walk = func(tree *cmds.CommandTree, chain []*cmds.Command) {
+		cmd := chain[len(chain)-1]
+		if tree.Runnable && len(tree.Path) > 0 {
+			paths[cfg.APIPath+"/"+strings.Join(tree.Path, "/")] = map[string]interface{}{
+				method: openAPIOperation(tree, cmd, cmds.DescribeOptions(chain...)),
+			}
+		}
+		for _, sub := range tree.Subcommands {
+			walk(sub, append(chain[:len(chain):len(chain)], cmd.Subcommands[sub.Name]))
+		}
+	}
+	walk(cmds.DescribeTree(root), []*cmds.Command{root})
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       info.Title,
+			"version":     info.Version,
+			"description": info.Description,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": map[string]interface{}{
+				"Error": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"Message": map[string]interface{}{"type": "string"},
+						"Code":    map[string]interface{}{"type": "integer"},
+						"Type":    map[string]interface{}{"type": "string"},
+					},
+				},
+			},
+		},
+	}
+}
+
+func containsMethod(methods []string, method string) bool {
+	for _, m := range methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// openAPIOperation returns the operation object of the command described by
+// tree, accepting opts.
+func openAPIOperation(tree *cmds.CommandTree, cmd *cmds.Command, opts []cmds.OptionDescription) map[string]interface{} {
+	params := []interface{}{}
+	var files, strs bool
+	for _, arg := range tree.Arguments {
+		if arg.Kind == "file" {
+			files = true
+		} else {
+			strs = true
+		}
+	}
+	if strs {
+		params = append(params, map[string]interface{}{
+			"name":    "arg",
+			"in":      "query",
+			"explode": true,
+			"schema": map[string]interface{}{
+				"type":  "array",
+				"items": map[string]interface{}{"type": "string"},
+			},
+		})
+	}
+	for _, opt := range opts {
+		schema := map[string]interface{}{"type": openAPIType(opt.Type)}
+		if opt.Default != nil {
+			schema["default"] = opt.Default
+		}
+		param := map[string]interface{}{
+			"name":   opt.Names[0],
+			"in":     "query",
+			"schema": schema,
+		}
+		if opt.Description != "" {
+			param["description"] = opt.Description
+		}
+		params = append(params, param)
+	}
+
+	op := map[string]interface{}{
+		"operationId": strings.Join(tree.Path, "_"),
+		"summary":     tree.Tagline,
+		"parameters":  params,
+		"responses": map[string]interface{}{
+			"200": map[string]interface{}{
+				"description": "the values emitted by the command",
+				"content": map[string]interface{}{
+					applicationJson: map[string]interface{}{
+						"schema": jsonSchema(reflect.TypeOf(cmd.Type), map[reflect.Type]bool{}),
+					},
+				},
+			},
+			"default": map[string]interface{}{
+				"description": "the error of the command",
+				"content": map[string]interface{}{
+					applicationJson: map[string]interface{}{
+						"schema": map[string]interface{}{"$ref": "#/components/schemas/Error"},
+					},
+				},
+			},
+		},
+		"x-streaming": tree.Streaming,
+		"x-paginated": tree.Paginated,
+	}
+	if tree.Description != "" {
+		op["description"] = tree.Description
+	}
+	if files {
+		op["requestBody"] = map[string]interface{}{
+			"content": map[string]interface{}{
+				"multipart/form-data": map[string]interface{}{
+					"schema": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"file": map[string]interface{}{"type": "string", "format": "binary"},
+						},
+					},
+				},
+			},
+		}
+	}
+	return op
+}
+
+// openAPIType returns the JSON type of the values of an option of type typ,
+// as returned by cmds.DescribeOptions.
+func openAPIType(typ string) string {
+	switch {
+	case typ == "bool":
+		return "boolean"
+	case strings.HasPrefix(typ, "int"), strings.HasPrefix(typ, "uint"):
+		return "integer"
+	case strings.HasPrefix(typ, "float"):
+		return "number"
+	default:
+		return "string"
+	}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// jsonSchema returns the JSON schema of the JSON encoding of values of type
+// t. seen guards against recursive types, which are left unspecified where
+// they recur.
+func jsonSchema(t reflect.Type, seen map[reflect.Type]bool) map[string]interface{} {
+	if t == nil {
+		return map[string]interface{}{}
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": jsonSchema(t.Elem(), seen)}
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return map[string]interface{}{}
+		}
+		return map[string]interface{}{"type": "object", "additionalProperties": jsonSchema(t.Elem(), seen)}
+	case reflect.Struct:
+		if t == timeType {
+			return map[string]interface{}{"type": "string", "format": "date-time"}
+		}
+		if seen[t] {
+			return map[string]interface{}{}
+		}
+		seen[t] = true
+		defer delete(seen, t)
+
+		props := make(map[string]interface{})
+		structProperties(t, props, seen)
+		return map[string]interface{}{"type": "object", "properties": props}
+	default:
+		// interfaces and types encoding/json can't encode
+		return map[string]interface{}{}
+	}
+}
+
+// structProperties adds the schemas of the fields of the struct type t to
+// props, following the rules of encoding/json.
+func structProperties(t reflect.Type, props map[string]interface{}, seen map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Name
+		if tag := f.Tag.Get("json"); tag != "" {
+			if tag == "-" {
+				continue
+			}
+			if n := strings.Split(tag, ",")[0]; n != "" {
+				name = n
+			}
+		}
+
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && f.Tag.Get("json") == "" && ft.Kind() == reflect.Struct {
+			structProperties(ft, props, seen)
+			continue
+		}
+		if f.PkgPath != "" {
+			// unexported
+			continue
+		}
+		props[name] = jsonSchema(f.Type, seen)
+	}
+}
+
+// serveOpenAPI answers a request on OpenAPIPath with the OpenAPI document of
+// the command tree.
+func (h *handler) serveOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// the document describes the whole tree
+	if !h.authorizePath(w, r, nil) {
+		return
+	}
+
+	w.Header().Set(contentTypeHeader, applicationJson)
+	if r.Method == http.MethodHead {
+		return
+	}
+	if err := json.NewEncoder(w).Encode(OpenAPI(h.root, h.cfg)); err != nil {
+		log.Debugf("error sending the OpenAPI document: %s", err)
+	}
+}
@@ -0,0 +1,146 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+func TestOpenAPI(t *testing.T) {
+	type entry struct {
+		Name     string    `json:"name"`
+		Size     int64     `json:",omitempty"`
+		Modified time.Time `json:"modified"`
+		Tags     []string  `json:"tags"`
+		Next     *entry    `json:"next"`
+		Ignored  bool      `json:"-"`
+		hidden   bool
+	}
+
+	run := func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error { return nil }
+	root := &cmds.Command{
+		Options: []cmdkit.Option{cmdkit.BoolOption("verbose", "v", "print more")},
+		Subcommands: map[string]*cmds.Command{
+			"files": {
+				Subcommands: map[string]*cmds.Command{
+					"ls": {
+						Helptext:  cmdkit.HelpText{Tagline: "list files"},
+						Arguments: []cmdkit.Argument{cmdkit.StringArg("path", false, true, "the paths")},
+						Options:   []cmdkit.Option{cmdkit.IntOption("depth", "d", "the depth").WithDefault(1)},
+						Paginated: true,
+						Run:       run,
+						Type:      entry{},
+					},
+				},
+			},
+			"add": {
+				Arguments: []cmdkit.Argument{cmdkit.FileArg("file", true, false, "the file")},
+				Streaming: true,
+				Run:       run,
+			},
+			"secret": {Hidden: true, Run: run},
+		},
+	}
+
+	cfg := originCfg(defaultOrigins)
+	cfg.APIPath = "/api/v0"
+	cfg.APIInfo = OpenAPIInfo{Title: "test", Version: "1.0"}
+	srv := httptest.NewServer(NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, cfg))
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/api/v0/" + OpenAPIPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", res.StatusCode)
+	}
+
+	var doc struct {
+		Info  OpenAPIInfo
+		Paths map[string]map[string]struct {
+			OperationID string `json:"operationId"`
+			Summary     string
+			Parameters  []struct {
+				Name   string
+				Schema map[string]interface{}
+			}
+			RequestBody map[string]interface{} `json:"requestBody"`
+			Responses   map[string]struct {
+				Content map[string]struct {
+					Schema map[string]interface{}
+				}
+			}
+			Streaming bool `json:"x-streaming"`
+			Paginated bool `json:"x-paginated"`
+		}
+	}
+	if err := json.NewDecoder(res.Body).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.Info.Title != "test" || doc.Info.Version != "1.0" {
+		t.Errorf("unexpected info %+v", doc.Info)
+	}
+	if len(doc.Paths) != 2 {
+		t.Fatalf("expected the paths of the visible runnable commands, got %v", doc.Paths)
+	}
+
+	ls, ok := doc.Paths["/api/v0/files/ls"]["post"]
+	if !ok {
+		t.Fatalf("expected a POST operation on files ls, got %v", doc.Paths)
+	}
+	if ls.OperationID != "files_ls" || ls.Summary != "list files" || !ls.Paginated || ls.Streaming || ls.RequestBody != nil {
+		t.Errorf("unexpected operation of files ls: %+v", ls)
+	}
+	var params []string
+	for _, p := range ls.Parameters {
+		params = append(params, p.Name)
+		if p.Name == "depth" && (p.Schema["type"] != "integer" || p.Schema["default"] != 1.0) {
+			t.Errorf("unexpected schema of depth: %v", p.Schema)
+		}
+		if p.Name == "verbose" && p.Schema["type"] != "boolean" {
+			t.Errorf("unexpected schema of verbose: %v", p.Schema)
+		}
+	}
+	if !reflect.DeepEqual(params, []string{"arg", "verbose", "depth"}) {
+		t.Errorf("unexpected parameters of files ls: %v", params)
+	}
+
+	schema := ls.Responses["200"].Content[applicationJson].Schema
+	expected := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"name":     map[string]interface{}{"type": "string"},
+			"Size":     map[string]interface{}{"type": "integer"},
+			"modified": map[string]interface{}{"type": "string", "format": "date-time"},
+			"tags":     map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+			"next":     map[string]interface{}{},
+		},
+	}
+	if !reflect.DeepEqual(schema, expected) {
+		t.Errorf("unexpected schema of the values of files ls: %v", schema)
+	}
+
+	add := doc.Paths["/api/v0/add"]["post"]
+	if !add.Streaming || add.RequestBody == nil || len(add.Parameters) != 1 {
+		t.Errorf("unexpected operation of add: %+v", add)
+	}
+
+	res, err = http.Post(srv.URL+"/api/v0/"+OpenAPIPath, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("expected status 405 for POST, got %d", res.StatusCode)
+	}
+}
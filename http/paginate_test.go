@@ -0,0 +1,77 @@
+package http
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+func TestPaginatedResponse(t *testing.T) {
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"numbers": {
+				Paginated: true,
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					for i := 0; i < 10; i++ {
+						if err := re.Emit(i); err != nil {
+							return err
+						}
+					}
+					return nil
+				},
+				Type: 0,
+			},
+		},
+	}
+
+	srv := httptest.NewServer(NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, originCfg(defaultOrigins)))
+	defer srv.Close()
+
+	for _, buffer := range []bool{false, true} {
+		var (
+			values []int
+			opts   = map[string]interface{}{cmds.LimitOpt: 4, cmds.BufferOpt: buffer}
+			pages  int
+		)
+		for {
+			req, err := cmds.NewRequest(context.Background(), []string{"numbers"}, opts, nil, nil, root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var page *cmds.PageResult
+			req.Context, page = cmds.ContextWithPageResult(req.Context)
+
+			res, err := NewClient(srv.URL).Send(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for {
+				v, err := res.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				values = append(values, v.(int))
+			}
+			pages++
+
+			cursor := cmds.NextCursor(res)
+			if cursor != page.NextCursor() {
+				t.Errorf("expected the cursor %q of the response in the request context, got %q", cursor, page.NextCursor())
+			}
+			if cursor == "" {
+				break
+			}
+			opts = map[string]interface{}{cmds.CursorOpt: cursor, cmds.BufferOpt: buffer}
+		}
+
+		if pages != 3 || len(values) != 10 || values[0] != 0 || values[9] != 9 {
+			t.Errorf("buffer %v: expected all values in 3 pages, got %v in %d", buffer, values, pages)
+		}
+	}
+}
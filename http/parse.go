@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"mime"
+	"mime/multipart"
 	"net/http"
 	"strconv"
 	"strings"
@@ -62,9 +63,13 @@ func parseRequest(ctx context.Context, r *http.Request, root *cmds.Command) (*cm
 			}
 		}
 	}
-	// default to setting encoding to JSON
+	// default to the encoding preferred by the client, or JSON
 	if _, ok := opts[cmds.EncLong]; !ok {
-		opts[cmds.EncLong] = cmds.JSON
+		pref := r.Header.Get(encodingPrefHeader)
+		if pref == "" {
+			pref = acceptedEncodings(r.Header.Get(acceptHeader))
+		}
+		opts[cmds.EncLong] = negotiateEncoding(pref, cmd)
 	}
 
 	stringArgs = append(stringArgs, stringArgs2...)
@@ -169,10 +174,11 @@ func parseOptions(r *http.Request) (map[string]interface{}, []string) {
 // parseResponse decodes a http.Response to create a cmds.Response
 func parseResponse(httpRes *http.Response, req *cmds.Request) (cmds.Response, error) {
 	res := &Response{
-		res: httpRes,
-		req: req,
-		rr:  &responseReader{httpRes},
+		res:     httpRes,
+		req:     req,
+		postRun: httpRes.Header.Get(postRunHeader),
 	}
+	res.rr = &responseReader{resp: httpRes, aborted: &res.aborted}
 
 	lengthHeader := httpRes.Header.Get(extraContentLengthHeader)
 	if len(lengthHeader) > 0 {
@@ -187,7 +193,13 @@ func parseResponse(httpRes *http.Response, req *cmds.Request) (cmds.Response, er
 	contentType = strings.Split(contentType, ";")[0]
 
 	encType, found := MIMEEncodings[contentType]
-	if found {
+	if contentType == multipartMixed {
+		_, params, err := mime.ParseMediaType(httpRes.Header.Get(contentTypeHeader))
+		if err != nil {
+			return nil, err
+		}
+		res.mr = multipart.NewReader(res.rr, params["boundary"])
+	} else if found {
 		makeDec, ok := cmds.Decoders[encType]
 		if ok {
 			res.dec = makeDec(res.rr)
@@ -207,25 +219,22 @@ func parseResponse(httpRes *http.Response, req *cmds.Request) (cmds.Response, er
 			// handle 404s
 			e.Message = "Command not found."
 			e.Code = cmdkit.ErrClient
-		case contentType == plainText:
-			// handle non-marshalled errors
-			mes, err := ioutil.ReadAll(res.rr)
+		case found:
+			// handle errors from the envelope of the encoding
+			data, err := ioutil.ReadAll(res.rr)
 			if err != nil {
 				return nil, err
 			}
-			e.Message = string(mes)
-			e.Code = cmdkit.ErrNormal
-		case res.dec == nil:
-			return nil, fmt.Errorf("unknown error content type: %s", contentType)
-		default:
-			// handle errors from value
-			err := res.dec.Decode(e)
-			if err != nil {
+			if decoded, err := cmds.UnmarshalError(encType, data); err == nil {
+				e = decoded
+			} else {
 				log.Errorf("error parsing error %q", err.Error())
 			}
+		default:
+			return nil, fmt.Errorf("unknown error content type: %s", contentType)
 		}
 
-		return nil, e
+		return nil, withErrorCode(httpRes.Header, e)
 	}
 
 	return res, nil
@@ -0,0 +1,93 @@
+package http
+
+import (
+	"fmt"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+// postRunHeader is set to the type of the PostRun the server applied to
+// the response, see serverPostRun.
+const postRunHeader = "X-Post-Run"
+
+// serverPostRun returns the emitter the command should emit to if the
+// request asks the server to apply the PostRun of a type with the
+// cmds.PostRunOpt option, so thin clients without the command tree receive
+// formatted output. The values the PostRun emits are encoded as usual,
+// e.g. as plain text with the text encoding. PostRuns relying on the
+// emitter of their type, like cli.ResponseEmitter, fail. The cmds.HTTP
+// PostRun is always applied, see httpPostRun, and can't be requested.
+//
+// wait returns once the PostRun closed re. It's nil if no PostRun is
+// applied.
+func serverPostRun(req *cmds.Request, re cmds.ResponseEmitter) (cmds.ResponseEmitter, string, func()) {
+	typ, _ := req.Options[cmds.PostRunOpt].(string)
+	postRun := req.Command.PostRun[cmds.PostRunType(typ)]
+	if postRun == nil || typ == cmds.HTTP {
+		return re, "", nil
+	}
+
+	re, wait := runPostRun(req, typ, postRun, re)
+	return re, typ, wait
+}
+
+// httpPostRun returns the emitter the command should emit to if it has a
+// cmds.HTTP PostRun. The PostRun runs between the command and the emitter
+// of the response, so the values it emits are the ones encoded and sent to
+// the client, including the client's own PostRun. It emits to an
+// httpPostRunEmitter.
+//
+// wait returns once the PostRun closed re. It's nil if the command has no
+// HTTP PostRun.
+func httpPostRun(req *cmds.Request, re cmds.ResponseEmitter) (cmds.ResponseEmitter, func()) {
+	postRun := req.Command.PostRun[cmds.HTTP]
+	if postRun == nil {
+		return re, nil
+	}
+
+	return runPostRun(req, cmds.HTTP, postRun, httpPostRunEmitter{re})
+}
+
+// httpPostRunEmitter is the emitter of the cmds.HTTP PostRun of a command.
+type httpPostRunEmitter struct {
+	cmds.ResponseEmitter
+}
+
+// Type returns cmds.HTTP.
+func (httpPostRunEmitter) Type() cmds.PostRunType {
+	return cmds.HTTP
+}
+
+// runPostRun runs postRun on the values emitted to the returned emitter,
+// emitting to lower. wait returns once the PostRun closed lower.
+func runPostRun(req *cmds.Request, typ string, postRun func(cmds.Response, cmds.ResponseEmitter) error, lower cmds.ResponseEmitter) (cmds.ResponseEmitter, func()) {
+	re, res := cmds.NewChanResponsePair(req)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		var err error
+		defer func() {
+			if v := recover(); v != nil {
+				err = fmt.Errorf("PostRun %s failed: %v", typ, v)
+			}
+			if closeErr := lower.CloseWithError(err); closeErr != nil && closeErr != cmds.ErrClosingClosedEmitter {
+				log.Errorf("error closing connection: %s", closeErr)
+			}
+		}()
+
+		err = postRun(res, lower)
+	}()
+
+	return re, func() { <-done }
+}
+
+// serverPostRunType returns the type of the PostRun the server applied to
+// res, if any.
+func serverPostRunType(res cmds.Response) string {
+	if r, ok := res.(*Response); ok {
+		return r.postRun
+	}
+	return ""
+}
@@ -0,0 +1,209 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+func TestServerPostRun(t *testing.T) {
+	type count struct {
+		N int
+	}
+
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"count": {
+				Type: count{},
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					for i := 1; i <= 2; i++ {
+						if err := re.Emit(&count{i}); err != nil {
+							return err
+						}
+					}
+					return nil
+				},
+				PostRun: cmds.PostRunMap{
+					cmds.CLI: func(res cmds.Response, re cmds.ResponseEmitter) error {
+						for {
+							v, err := res.Next()
+							if err == io.EOF {
+								return nil
+							}
+							if err != nil {
+								return err
+							}
+							if err := re.Emit(fmt.Sprintf("n=%d\n", v.(*count).N)); err != nil {
+								return err
+							}
+						}
+					},
+				},
+			},
+		},
+	}
+
+	srv := httptest.NewServer(NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, originCfg(defaultOrigins)))
+	defer srv.Close()
+
+	// a thin client only gets the formatted output
+	res, err := http.Post(srv.URL+"/count?post-run=cli&encoding=text", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "n=1\nn=2\n" {
+		t.Errorf("unexpected output %q", body)
+	}
+	if pr := res.Header.Get(postRunHeader); pr != "cli" {
+		t.Errorf("expected the PostRun type in the header, got %q", pr)
+	}
+
+	// the client doesn't decode the formatted output as the command's Type
+	req, err := cmds.NewRequest(context.Background(), []string{"count"}, map[string]interface{}{
+		cmds.PostRunOpt: string(cmds.CLI),
+	}, nil, nil, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cres, err := NewClient(srv.URL).Send(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := cmds.Collect[string](cres)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 2 || values[0] != "n=1\n" {
+		t.Errorf("unexpected values %q", values)
+	}
+}
+
+func TestHTTPPostRun(t *testing.T) {
+	type user struct {
+		Name     string
+		Password string
+	}
+
+	received := make(chan struct{})
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"users": {
+				Type:      user{},
+				Streaming: true,
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					if err := re.Emit(&user{"alice", "secret"}); err != nil {
+						return err
+					}
+					// the first value reaches the client before the command returns
+					select {
+					case <-received:
+					case <-req.Context.Done():
+						return req.Context.Err()
+					}
+					return re.Emit(&user{"bob", "hunter2"})
+				},
+				PostRun: cmds.PostRunMap{
+					cmds.HTTP: func(res cmds.Response, re cmds.ResponseEmitter) error {
+						if typ := re.(interface{ Type() cmds.PostRunType }).Type(); typ != cmds.HTTP {
+							t.Errorf("expected the emitter of the HTTP PostRun, got %q", typ)
+						}
+						for {
+							v, err := res.Next()
+							if err == io.EOF {
+								return nil
+							}
+							if err != nil {
+								return err
+							}
+							u := *v.(*user)
+							u.Password = ""
+							if err := re.Emit(&u); err != nil {
+								return err
+							}
+						}
+					},
+					cmds.CLI: func(res cmds.Response, re cmds.ResponseEmitter) error {
+						for {
+							v, err := res.Next()
+							if err == io.EOF {
+								return nil
+							}
+							if err != nil {
+								return err
+							}
+							u := v.(*user)
+							if err := re.Emit(fmt.Sprintf("%s:%s\n", u.Name, u.Password)); err != nil {
+								return err
+							}
+						}
+					},
+				},
+			},
+		},
+	}
+
+	srv := httptest.NewServer(NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, originCfg(defaultOrigins)))
+	defer srv.Close()
+
+	req, err := cmds.NewRequest(context.Background(), []string{"users"}, nil, nil, nil, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := NewClient(srv.URL).Send(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range []string{"alice", "bob"} {
+		v, err := res.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u := v.(*user); u.Name != name || u.Password != "" {
+			t.Errorf("expected the redacted user %s, got %+v", name, u)
+		}
+		if i == 0 {
+			close(received)
+		}
+	}
+	if _, err := res.Next(); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+
+	// the requested PostRun is applied to the values of the HTTP PostRun,
+	// which can't be requested itself
+	received = make(chan struct{})
+	close(received)
+	for _, tc := range []struct {
+		postRun, enc, header, expected string
+	}{
+		{"cli", "text", "cli", "alice:\nbob:\n"},
+		{"http", "json", "", `{"Name":"alice","Password":""}` + "\n" + `{"Name":"bob","Password":""}` + "\n"},
+	} {
+		httpRes, err := http.Post(srv.URL+"/users?encoding="+tc.enc+"&post-run="+tc.postRun, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(httpRes.Body)
+		httpRes.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != tc.expected {
+			t.Errorf("post-run %s: expected %q, got %q", tc.postRun, tc.expected, body)
+		}
+		if pr := httpRes.Header.Get(postRunHeader); pr != tc.header {
+			t.Errorf("post-run %s: expected the PostRun header %q, got %q", tc.postRun, tc.header, pr)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package http
+
+import (
+	"context"
+	"io"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+
+	"github.com/ipfs/go-ipfs-files"
+)
+
+// UploadProgress is called while the client sends the body of a request,
+// with the number of bytes sent so far and the size of the files sent, or -1
+// if it is unknown. sent includes the multipart encoding of the body, so it
+// ends up slightly larger than total.
+type UploadProgress func(sent, total int64)
+
+type uploadProgressKey struct{}
+
+// WithUploadProgress returns a context that makes the client report the
+// upload progress of requests using it to fn.
+func WithUploadProgress(ctx context.Context, fn UploadProgress) context.Context {
+	return context.WithValue(ctx, uploadProgressKey{}, fn)
+}
+
+// ClientWithUploadProgress makes the client report the upload progress of
+// all requests to fn, unless their context sets another function with
+// WithUploadProgress.
+func ClientWithUploadProgress(fn UploadProgress) ClientOpt {
+	return func(c *client) {
+		c.uploadProgress = fn
+	}
+}
+
+func uploadProgressFromContext(ctx context.Context) UploadProgress {
+	if ctx == nil {
+		return nil
+	}
+
+	fn, _ := ctx.Value(uploadProgressKey{}).(UploadProgress)
+	return fn
+}
+
+// uploadSize returns the size of the files of req, or -1 if it is unknown.
+func uploadSize(req *cmds.Request) int64 {
+	sf, ok := req.Files.(files.SizeFile)
+	if !ok || req.BodyArgs() != nil {
+		return -1
+	}
+
+	size, err := sf.Size()
+	if err != nil {
+		return -1
+	}
+	return size
+}
+
+// progressReader reports the bytes read from it to an UploadProgress.
+func progressReader(req *cmds.Request, fn UploadProgress, r io.Reader) *countingReader {
+	var sent int64
+	total := uploadSize(req)
+	return &countingReader{r: r, count: func(n uint64) {
+		if n > 0 {
+			sent += int64(n)
+			fn(sent, total)
+		}
+	}}
+}
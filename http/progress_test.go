@@ -0,0 +1,94 @@
+package http
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+func TestProgress(t *testing.T) {
+	type result struct {
+		Hash string
+	}
+
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"add": {
+				Type: result{},
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					if err := cmds.EmitProgress(re, 50, 100, "adding"); err != nil {
+						return err
+					}
+					return re.Emit(&result{"Qm"})
+				},
+			},
+			"cat": {
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					if err := re.Emit(strings.NewReader("data")); err != nil {
+						return err
+					}
+					return cmds.EmitProgress(re, 4, 4, "")
+				},
+			},
+		},
+	}
+
+	srv := httptest.NewServer(NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, originCfg(defaultOrigins)))
+	defer srv.Close()
+
+	for _, enc := range []cmds.EncodingType{cmds.JSON, cmds.XML, cmds.CBOR} {
+		req, err := cmds.NewRequest(context.Background(), []string{"add"}, cmdkit.OptMap{cmds.EncLong: string(enc)}, nil, nil, root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := NewClient(srv.URL).Send(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var values []interface{}
+		if err := cmds.ForEach(res, func(v interface{}) error {
+			values = append(values, v)
+			return nil
+		}); err != nil {
+			t.Fatalf("%s: %s", enc, err)
+		}
+
+		if len(values) != 2 {
+			t.Fatalf("%s: expected 2 values but got %v", enc, values)
+		}
+		if p, ok := values[0].(*cmds.Progress); !ok || *p != (cmds.Progress{Current: 50, Total: 100, Message: "adding"}) {
+			t.Errorf("%s: expected the progress, got %#v", enc, values[0])
+		}
+		if r, ok := values[1].(*result); !ok || r.Hash != "Qm" {
+			t.Errorf("%s: expected the result value, got %#v", enc, values[1])
+		}
+	}
+
+	// progress can't be told apart from the output of readers
+	req, err := cmds.NewRequest(context.Background(), []string{"cat"}, nil, nil, nil, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := NewClient(srv.URL).Send(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := res.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(v.(io.Reader))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "data" {
+		t.Errorf("expected the output without progress, got %q", data)
+	}
+}
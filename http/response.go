@@ -3,19 +3,25 @@ package http
 import (
 	"errors"
 	"io"
+	"mime/multipart"
 	"net/http"
-	"reflect"
 	"strings"
+	"sync/atomic"
 
 	"github.com/ipfs/go-ipfs-cmdkit"
 	"github.com/ipfs/go-ipfs-cmds"
 )
 
 var (
+	// ErrResponseAborted is returned by Next and by reads of a streamed
+	// response once Abort was called.
+	ErrResponseAborted = errors.New("response aborted")
+
 	MIMEEncodings = map[string]cmds.EncodingType{
 		"application/json": cmds.JSON,
 		"application/xml":  cmds.XML,
 		"text/plain":       cmds.Text,
+		"application/cbor": cmds.CBOR,
 	}
 )
 
@@ -28,8 +34,15 @@ type Response struct {
 
 	rr  *responseReader
 	dec cmds.Decoder
+	// mr reads the parts of a response with attachments.
+	mr *multipart.Reader
+	// postRun is the type of the PostRun the server applied.
+	postRun string
 
 	initErr *cmdkit.Error
+
+	// aborted is set to 1 by Abort.
+	aborted int32
 }
 
 func (res *Response) Request() *cmds.Request {
@@ -46,17 +59,64 @@ func (res *Response) Error() *cmdkit.Error {
 		return err
 	case cmdkit.Error:
 		return &err
+	case *cmds.CodedError:
+		return err.CmdkitError()
 	default:
 		// i.e. is a regular error
 		return &cmdkit.Error{Message: res.err.Error()}
 	}
 }
 
+// NextCursor returns the cursor of the next page of a paginated command,
+// see cmds.NextCursor. It's sent in the trailer, so it's only known once all
+// values were read.
+func (res *Response) NextCursor() string {
+	if cursor := res.res.Trailer.Get(nextCursorHeader); cursor != "" {
+		return cursor
+	}
+	// buffered responses send the trailer with the headers
+	return res.res.Header.Get(nextCursorHeader)
+}
+
 func (res *Response) Length() uint64 {
 	return res.length
 }
 
+// Abort stops receiving the response. It closes the connection to the
+// server, which cancels the request context of the command there, and
+// unblocks a concurrent call to Next. Afterwards, Next and reads of a
+// streamed response return ErrResponseAborted. Unlike canceling the context
+// of the request, Abort is safe to call after the response was received
+// and has no effect on other requests using the context.
+func (res *Response) Abort() error {
+	if !atomic.CompareAndSwapInt32(&res.aborted, 0, 1) {
+		return nil
+	}
+	return res.res.Body.Close()
+}
+
+func (res *Response) isAborted() bool {
+	return atomic.LoadInt32(&res.aborted) == 1
+}
+
 func (res *Response) Next() (interface{}, error) {
+	var value interface{}
+	// the output of a PostRun on the server isn't of the Type of the
+	// command
+	if res.postRun == "" {
+		value = cmds.NewValue(res.req.Command)
+	}
+
+	return res.NextInto(value)
+}
+
+// NextInto is like Next, but decodes the next value into value, which
+// should be a pointer, instead of a new value of the Type of the command.
+func (res *Response) NextInto(value interface{}) (interface{}, error) {
+	if res.isAborted() {
+		return nil, ErrResponseAborted
+	}
+
 	if res.initErr != nil {
 		return nil, res.initErr
 	}
@@ -65,6 +125,10 @@ func (res *Response) Next() (interface{}, error) {
 		return nil, res.err
 	}
 
+	if res.mr != nil {
+		return res.nextPart(value)
+	}
+
 	// nil decoder means stream not chunks
 	// but only do that once
 	if res.dec == nil {
@@ -76,22 +140,21 @@ func (res *Response) Next() (interface{}, error) {
 		return rr, nil
 	}
 
-	var value interface{}
-	if valueType := reflect.TypeOf(res.req.Command.Type); valueType != nil {
-		if valueType.Kind() == reflect.Ptr {
-			valueType = valueType.Elem()
-		}
-		value = reflect.New(valueType).Interface()
-	}
-
 	m := &cmds.MaybeError{Value: value}
 	err := res.dec.Decode(m)
+	if err != nil && res.isAborted() {
+		res.err = ErrResponseAborted
+		return nil, res.err
+	}
 	if err != nil {
 		if err == io.EOF {
 			// handle errors from headers
-			errStr := res.res.Header.Get(StreamErrHeader)
-			if errStr != "" {
-				err = &cmdkit.Error{Message: errStr}
+			if e := streamError(res.res.Header); e != nil {
+				err = e
+			}
+			// the trailer was read, pass the cursor on to the frontend
+			if cursor := res.NextCursor(); cursor != "" {
+				cmds.PageResultFromContext(res.req.Context).SetNextCursor(cursor)
 			}
 
 			res.err = err
@@ -104,6 +167,7 @@ func (res *Response) Next() (interface{}, error) {
 	}
 
 	v, err := m.Get()
+	v = cmds.Unwrap(v)
 	if err != nil {
 		if e, ok := err.(*cmdkit.Error); ok {
 			res.err = e
@@ -119,7 +183,8 @@ func (res *Response) Next() (interface{}, error) {
 // in the http trailer upon EOF, this error if present is returned instead
 // of the EOF.
 type responseReader struct {
-	resp *http.Response
+	resp    *http.Response
+	aborted *int32
 }
 
 func (r *responseReader) Read(b []byte) (int, error) {
@@ -128,6 +193,9 @@ func (r *responseReader) Read(b []byte) (int, error) {
 	}
 
 	n, err := r.resp.Body.Read(b)
+	if err != nil && r.aborted != nil && atomic.LoadInt32(r.aborted) == 1 {
+		return n, ErrResponseAborted
+	}
 
 	// reading on a closed response body is as good as an io.EOF here
 	if err != nil && strings.Contains(err.Error(), "read on closed response body") {
@@ -144,8 +212,8 @@ func (r *responseReader) Read(b []byte) (int, error) {
 }
 
 func (r *responseReader) checkError() error {
-	if e := r.resp.Trailer.Get(StreamErrHeader); e != "" {
-		return errors.New(e)
+	if e := streamError(r.resp.Trailer); e != nil {
+		return e
 	}
 	return nil
 }
@@ -1,7 +1,10 @@
 package http
 
 import (
+	"context"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/ipfs/go-ipfs-cmds"
 )
@@ -79,3 +82,65 @@ func TestNextDecodesIntoNewStruct(t *testing.T) {
 		t.Errorf("tv.b is %#v, expected it to be reset to 0", tv2.b)
 	}
 }
+
+func TestResponseAbort(t *testing.T) {
+	canceled := make(chan struct{})
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"block": {
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					if err := re.Emit("first"); err != nil {
+						return err
+					}
+					<-req.Context.Done()
+					close(canceled)
+					return req.Context.Err()
+				},
+			},
+		},
+	}
+
+	srv := httptest.NewServer(NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, originCfg(defaultOrigins)))
+	defer srv.Close()
+
+	req, err := cmds.NewRequest(context.Background(), []string{"block"}, nil, nil, nil, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := NewClient(srv.URL).Send(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := res.Next(); err != nil {
+		t.Fatal(err)
+	}
+
+	errCh := make(chan error)
+	go func() {
+		_, err := res.Next()
+		errCh <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	if err := res.(*Response).Abort(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-errCh:
+		if err != ErrResponseAborted {
+			t.Errorf("expected ErrResponseAborted from the pending Next, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Next didn't return after Abort")
+	}
+	if _, err := res.Next(); err != ErrResponseAborted {
+		t.Errorf("expected ErrResponseAborted from Next after Abort, got %v", err)
+	}
+
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the command's context wasn't canceled after Abort")
+	}
+}
@@ -1,12 +1,15 @@
 package http
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/ipfs/go-ipfs-cmdkit"
 	cmds "github.com/ipfs/go-ipfs-cmds"
@@ -16,7 +19,7 @@ import (
 var (
 	HeadRequest = fmt.Errorf("HEAD request")
 
-	AllowedExposedHeadersArr = []string{streamHeader, channelHeader, extraContentLengthHeader}
+	AllowedExposedHeadersArr = []string{streamHeader, channelHeader, extraContentLengthHeader, ignoredOptionsHeader, postRunHeader, errorIDHeader, errorCodeHeader, nextCursorHeader}
 	AllowedExposedHeaders    = strings.Join(AllowedExposedHeadersArr, ", ")
 
 	mimeTypes = map[cmds.EncodingType]string{
@@ -24,6 +27,8 @@ var (
 		cmds.JSON:     "application/json",
 		cmds.XML:      "application/xml",
 		cmds.Text:     "text/plain",
+		cmds.HTML:     "text/html",
+		cmds.CBOR:     "application/cbor",
 	}
 )
 
@@ -35,6 +40,7 @@ func NewResponseEmitter(w http.ResponseWriter, method string, req *cmds.Request)
 	}
 	re := &responseEmitter{
 		w:       w,
+		rc:      http.NewResponseController(w),
 		encType: encType,
 		enc:     enc,
 		method:  method,
@@ -50,10 +56,16 @@ type ResponseEmitter interface {
 
 type responseEmitter struct {
 	w http.ResponseWriter
+	// rc flushes w. The encoder, rc and the buffers of the encoder are set
+	// up once per response and reused for every value.
+	rc *http.ResponseController
 
 	enc     cmds.Encoder
 	encType cmds.EncodingType
 	req     *cmds.Request
+	// mw writes the parts of the response if the first value was an
+	// Attachment.
+	mw *multipart.Writer
 
 	l      sync.Mutex
 	length uint64
@@ -63,6 +75,11 @@ type responseEmitter struct {
 	closed    bool
 	once      sync.Once
 	method    string
+
+	// lastWrite is the time a value was last encoded, for the heartbeats
+	// stopped by closing stopHeartbeat, see startHeartbeat
+	lastWrite     time.Time
+	stopHeartbeat chan struct{}
 }
 
 func (re *responseEmitter) Emit(value interface{}) error {
@@ -79,6 +96,7 @@ func (re *responseEmitter) Emit(value interface{}) error {
 	if ch, isChan := value.(<-chan interface{}); isChan {
 		return cmds.EmitChan(re, ch)
 	}
+	defer cmds.CloseReader(value)
 
 	re.once.Do(func() { re.preamble(value) })
 
@@ -88,6 +106,11 @@ func (re *responseEmitter) Emit(value interface{}) error {
 	if re.closed {
 		return cmds.ErrClosedEmitter
 	}
+	// the client went away or canceled the request, so commands stop
+	// emitting even if they don't watch their context
+	if err := re.canceled(); err != nil {
+		return err
+	}
 
 	var err error
 
@@ -107,17 +130,26 @@ func (re *responseEmitter) Emit(value interface{}) error {
 		isSingle = true
 	}
 
-	if f, ok := re.w.(http.Flusher); ok {
-		defer f.Flush()
-	}
+	defer flushWith(re.rc)
 
 	switch v := value.(type) {
 	case error:
 		return re.closeWithError(v)
+	case *cmds.Progress:
+		err = re.emitProgress(v)
+	case cmds.Attachment:
+		if re.mw == nil {
+			return errAttachmentNotFirst
+		}
+		err = re.writeParts(v)
 	case io.Reader:
-		err = flushCopy(re.w, v)
+		err = flushCopy(re.rc, re.w, v)
 	default:
-		err = re.enc.Encode(value)
+		if re.mw != nil {
+			err = re.writeParts(value)
+		} else {
+			err = re.encode(value)
+		}
 	}
 
 	if isSingle && err == nil {
@@ -128,6 +160,99 @@ func (re *responseEmitter) Emit(value interface{}) error {
 	return err
 }
 
+// canceled returns the error of the request context once it's done.
+func (re *responseEmitter) canceled() error {
+	if re.req == nil || re.req.Context == nil {
+		return nil
+	}
+	return re.req.Context.Err()
+}
+
+// EmitAll encodes the values in vs and sends them to the client at once.
+// Batches containing values Emit treats specially, like a Single or an
+// io.Reader, are emitted one by one.
+func (re *responseEmitter) EmitAll(vs []interface{}) error {
+	if len(vs) == 0 {
+		return nil
+	}
+
+	for _, v := range vs {
+		switch v.(type) {
+		case cmds.Single, chan interface{}, <-chan interface{}, error, io.Reader, cmds.Attachment, *cmds.Progress:
+			for _, v := range vs {
+				if err := re.Emit(v); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	re.once.Do(func() { re.preamble(vs[0]) })
+
+	re.l.Lock()
+	defer re.l.Unlock()
+
+	if re.closed {
+		return cmds.ErrClosedEmitter
+	}
+	// the client went away or canceled the request, so commands stop
+	// emitting even if they don't watch their context
+	if err := re.canceled(); err != nil {
+		return err
+	}
+
+	// return immediately if this is a head request
+	if re.method == "HEAD" {
+		return nil
+	}
+
+	defer flushWith(re.rc)
+
+	for _, v := range vs {
+		if v == nil {
+			continue
+		}
+
+		var err error
+		if re.mw != nil {
+			err = re.writeParts(v)
+		} else {
+			err = re.encode(v)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// encode writes v to the response, streaming it if it is a
+// cmds.StreamEncoder.
+func (re *responseEmitter) encode(v interface{}) error {
+	re.lastWrite = time.Now()
+	streamed, err := cmds.StreamValue(re.req, re.w, re.enc, re.encType, v)
+	if !streamed {
+		err = re.enc.Encode(cmds.TagValue(re.req, re.encType, v))
+	}
+	return err
+}
+
+// emitProgress sends p tagged as progress, unless the response is the raw
+// output of a reader or its encoding can't tell progress apart from values.
+func (re *responseEmitter) emitProgress(p *cmds.Progress) error {
+	v, ok := cmds.TagProgress(re.req, re.encType, p)
+	if !ok || re.streaming {
+		return nil
+	}
+	if re.mw != nil {
+		return re.writeParts(v)
+	}
+	re.lastWrite = time.Now()
+	return re.enc.Encode(v)
+}
+
 func (re *responseEmitter) SetLength(l uint64) {
 	re.l.Lock()
 	defer re.l.Unlock()
@@ -154,6 +279,14 @@ func (re *responseEmitter) closeWithError(err error) error {
 		return cmds.ErrClosingClosedEmitter
 	}
 
+	// sent as headers, or in the trailer if the preamble was sent
+	setErrorCode(re.w.Header(), err)
+	if re.req != nil {
+		if cursor := cmds.PageResultFromContext(re.req.Context).NextCursor(); cursor != "" {
+			re.w.Header().Set(nextCursorHeader, cursor)
+		}
+	}
+
 	switch err {
 	case nil:
 		// no error
@@ -166,6 +299,8 @@ func (re *responseEmitter) closeWithError(err error) error {
 		case cmdkit.Error:
 			err = &e
 		case *cmdkit.Error:
+		case *cmds.CodedError:
+			err = e.CmdkitError()
 		case nil:
 		default:
 			err = &cmdkit.Error{Message: err.Error(), Code: cmdkit.ErrNormal}
@@ -185,9 +320,27 @@ func (re *responseEmitter) closeWithError(err error) error {
 
 	if setErrTrailer && err != nil {
 		re.w.Header().Set(StreamErrHeader, err.Error())
+		re.w.Header().Set(streamErrEnvelopeHeader, streamErrEnvelope(err.(*cmdkit.Error)))
+	}
+
+	// finish the encoded output unless the error was sent in its place
+	if (setErrTrailer || err == nil) && re.mw == nil && !re.streaming && re.method != "HEAD" {
+		if err := cmds.CloseEncoder(re.enc); err != nil {
+			log.Error("error finishing encoded response: ", err)
+		}
+	}
+
+	if re.mw != nil {
+		// write the closing boundary
+		if err := re.mw.Close(); err != nil {
+			log.Error("error closing multipart response: ", err)
+		}
 	}
 
 	re.closed = true
+	if re.stopHeartbeat != nil {
+		close(re.stopHeartbeat)
+	}
 
 	return nil
 }
@@ -196,9 +349,7 @@ func (re *responseEmitter) closeWithError(err error) error {
 func (re *responseEmitter) Flush() {
 	re.once.Do(func() { re.preamble(nil) })
 
-	if flusher, ok := re.w.(http.Flusher); ok {
-		flusher.Flush()
-	}
+	flushWith(re.rc)
 }
 
 func (re *responseEmitter) preamble(value interface{}) {
@@ -209,17 +360,19 @@ func (re *responseEmitter) preamble(value interface{}) {
 }
 
 func (re *responseEmitter) sendErr(err *cmdkit.Error) {
-	// Handle error encoding. *Try* to obey the requested encoding, fallback
-	// on json.
-	encType := re.encType
-	enc, ok := cmds.Encoders[encType]
-	if !ok {
-		encType = cmds.JSON
-		enc = cmds.Encoders[encType]
+	// Render the error in the envelope of the requested encoding, falling
+	// back to JSON.
+	encType, data, mErr := cmds.MarshalError(re.encType, err)
+	if mErr != nil {
+		log.Error("error marshaling error value: ", mErr)
 	}
 
 	// Set the appropriate MIME Type
-	re.w.Header().Set(contentTypeHeader, mimeTypes[encType])
+	mime, ok := mimeTypes[encType]
+	if !ok {
+		mime = plainText
+	}
+	re.w.Header().Set(contentTypeHeader, mime)
 
 	// Set the status from the error code.
 	status := http.StatusInternalServerError
@@ -229,7 +382,7 @@ func (re *responseEmitter) sendErr(err *cmdkit.Error) {
 	re.w.WriteHeader(status)
 
 	// Finally, send the errr
-	if err := enc(re.req)(re.w).Encode(err); err != nil {
+	if _, err := re.w.Write(data); err != nil {
 		log.Error("error sending error value after non-200 response", err)
 	}
 
@@ -251,6 +404,12 @@ func (re *responseEmitter) doPreamble(value interface{}) {
 
 	// Set up our potential trailer
 	h.Set("Trailer", StreamErrHeader)
+	h.Add("Trailer", streamErrEnvelopeHeader)
+	h.Add("Trailer", errorIDHeader)
+	h.Add("Trailer", errorCodeHeader)
+	if re.req != nil && re.req.Command != nil && re.req.Command.Paginated {
+		h.Add("Trailer", nextCursorHeader)
+	}
 
 	switch v := value.(type) {
 	case *cmdkit.Error:
@@ -263,6 +422,11 @@ func (re *responseEmitter) doPreamble(value interface{}) {
 		re.streaming = true
 
 		mime = "text/plain"
+	case cmds.Attachment:
+		h.Set(channelHeader, "1")
+		re.mw = multipart.NewWriter(re.w)
+
+		mime = multipartMixed + "; boundary=" + re.mw.Boundary()
 	case cmds.Single:
 		// don't set stream/channel header
 	default:
@@ -289,13 +453,34 @@ type responseWriterer interface {
 	Lower() http.ResponseWriter
 }
 
-func flushCopy(w io.Writer, r io.Reader) error {
-	buf := make([]byte, 4096)
-	f, ok := w.(http.Flusher)
-	if !ok {
-		_, err := io.Copy(w, r)
-		return err
+// flush sends the buffered response data to the client. It goes through a
+// ResponseController so writers wrapped by middleware are flushed as well, on
+// both HTTP/1.1 and HTTP/2 connections.
+func flush(w http.ResponseWriter) error {
+	return flushWith(http.NewResponseController(w))
+}
+
+func flushWith(rc *http.ResponseController) error {
+	err := rc.Flush()
+	if errors.Is(err, http.ErrNotSupported) {
+		return nil
 	}
+	return err
+}
+
+// copyBufPool holds the buffers used by flushCopy.
+var copyBufPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 4096)
+		return &buf
+	},
+}
+
+func flushCopy(rc *http.ResponseController, w io.Writer, r io.Reader) error {
+	bufp := copyBufPool.Get().(*[]byte)
+	defer copyBufPool.Put(bufp)
+
+	buf := *bufp
 	for {
 		n, err := r.Read(buf)
 		switch err {
@@ -320,6 +505,12 @@ func flushCopy(w io.Writer, r io.Reader) error {
 			return fmt.Errorf("http write failed to write full amount: %d != %d", nw, n)
 		}
 
-		f.Flush()
+		if err := rc.Flush(); errors.Is(err, http.ErrNotSupported) {
+			// can't stream, just copy the rest
+			_, err = io.Copy(w, r)
+			return err
+		} else if err != nil {
+			return err
+		}
 	}
 }
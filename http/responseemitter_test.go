@@ -0,0 +1,308 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+type flushCounter struct {
+	*httptest.ResponseRecorder
+	flushes int
+}
+
+func (w *flushCounter) Flush() {
+	w.flushes++
+	w.ResponseRecorder.Flush()
+}
+
+func TestResponseEmitterEmitAll(t *testing.T) {
+	req, err := cmds.NewRequest(context.Background(), nil, map[string]interface{}{cmds.EncLong: cmds.JSON}, nil, nil, &cmds.Command{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := &flushCounter{ResponseRecorder: httptest.NewRecorder()}
+	re, err := NewResponseEmitter(w, "POST", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cmds.EmitAll(re, []interface{}{1, "two", nil, 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := re.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.flushes != 1 {
+		t.Errorf("expected one flush for the batch, got %d", w.flushes)
+	}
+	if body := w.Body.String(); body != "1\n\"two\"\n3\n" {
+		t.Errorf("unexpected body %q", body)
+	}
+	if w.Header().Get(channelHeader) != "1" {
+		t.Error("expected the channel header to be set")
+	}
+}
+
+func BenchmarkResponseEmitterEmit(b *testing.B) {
+	req, err := cmds.NewRequest(context.Background(), nil, map[string]interface{}{cmds.EncLong: cmds.JSON}, nil, nil, &cmds.Command{})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	re, err := NewResponseEmitter(&flushCounter{ResponseRecorder: httptest.NewRecorder()}, "POST", req)
+	if err != nil {
+		b.Fatal(err)
+	}
+	value := struct{ Name string }{"some value"}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := re.Emit(value); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+type trackedReader struct {
+	*strings.Reader
+	closed bool
+}
+
+func (r *trackedReader) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestResponseEmitterReadCloser(t *testing.T) {
+	for _, method := range []string{"POST", "HEAD"} {
+		req, err := cmds.NewRequest(context.Background(), nil, nil, nil, nil, &cmds.Command{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := httptest.NewRecorder()
+		re, err := NewResponseEmitter(w, method, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r := &trackedReader{Reader: strings.NewReader("data")}
+		if err := re.Emit(r); err != nil {
+			t.Fatal(err)
+		}
+		if !r.closed {
+			t.Errorf("%s: expected the reader to be closed after emitting it", method)
+		}
+
+		re.Close()
+		r = &trackedReader{Reader: strings.NewReader("late")}
+		if err := re.Emit(r); err != cmds.ErrClosedEmitter {
+			t.Fatalf("%s: expected %v but got %v", method, cmds.ErrClosedEmitter, err)
+		}
+		if !r.closed {
+			t.Errorf("%s: expected the reader emitted after close to be closed", method)
+		}
+	}
+}
+
+func TestResponseEmitterXMLDocument(t *testing.T) {
+	opts := map[string]interface{}{cmds.EncLong: cmds.XML, cmds.XMLRootOpt: "Values"}
+	for _, tc := range []struct {
+		emit     func(re cmds.ResponseEmitter)
+		expected string
+	}{
+		{
+			emit: func(re cmds.ResponseEmitter) {
+				re.Emit(1)
+				re.Emit("a<b")
+				re.Close()
+			},
+			expected: "<Values><int>1</int><string>a&lt;b</string></Values>",
+		},
+		{
+			emit:     func(re cmds.ResponseEmitter) { re.Close() },
+			expected: "<Values></Values>",
+		},
+		{
+			emit: func(re cmds.ResponseEmitter) {
+				re.Emit(1)
+				re.CloseWithError(errors.New("failed"))
+			},
+			expected: "<Values><int>1</int></Values>",
+		},
+	} {
+		req, err := cmds.NewRequest(context.Background(), nil, opts, nil, nil, &cmds.Command{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := httptest.NewRecorder()
+		re, err := NewResponseEmitter(w, "POST", req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tc.emit(re)
+
+		if body := w.Body.String(); body != tc.expected {
+			t.Errorf("expected %q but got %q", tc.expected, body)
+		}
+	}
+}
+
+type streamedNumbers int
+
+// EncodeStream writes the JSON array of the numbers from 0 to n.
+func (n streamedNumbers) EncodeStream(w io.Writer, encType cmds.EncodingType) error {
+	if encType != cmds.JSON {
+		return cmds.ErrStreamUnsupported
+	}
+
+	io.WriteString(w, "[")
+	for i := 0; i < int(n); i++ {
+		if i > 0 {
+			io.WriteString(w, ",")
+		}
+		if _, err := io.WriteString(w, strconv.Itoa(i)); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "]\n")
+	return err
+}
+
+func TestResponseEmitterStreamEncoder(t *testing.T) {
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"numbers": {
+				Type: []int{},
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					return re.Emit(streamedNumbers(1000))
+				},
+			},
+		},
+	}
+
+	srv := httptest.NewServer(NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, originCfg(defaultOrigins)))
+	defer srv.Close()
+
+	req, err := cmds.NewRequest(context.Background(), []string{"numbers"}, nil, nil, nil, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := NewClient(srv.URL).Send(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := res.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	numbers, ok := v.(*[]int)
+	if !ok || len(*numbers) != 1000 || (*numbers)[999] != 999 {
+		t.Errorf("unexpected value %#v", v)
+	}
+}
+
+// serverFlushCounter counts the flushes of a served response.
+type serverFlushCounter struct {
+	http.ResponseWriter
+	flushes int32
+}
+
+func (w *serverFlushCounter) Flush() {
+	atomic.AddInt32(&w.flushes, 1)
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+func TestBufferedResponse(t *testing.T) {
+	const n = 1000
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"count": {
+				Type: 0,
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					for i := 0; i < n; i++ {
+						if err := re.Emit(i); err != nil {
+							return err
+						}
+					}
+					return nil
+				},
+			},
+		},
+	}
+
+	type testcase struct {
+		size    int
+		metrics bool
+	}
+
+	for _, tc := range []testcase{{0, false}, {100, false}, {100, true}} {
+		size := tc.size
+		var emitted uint64
+		cfg := originCfg(defaultOrigins)
+		cfg.Buffer = cmds.BufferOptions{Size: size}
+		if tc.metrics {
+			cfg.Metrics = cmds.MetricsCollectorFunc(func(m cmds.CommandMetrics) {
+				atomic.StoreUint64(&emitted, m.Emitted)
+			})
+		}
+		h := NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, cfg)
+
+		var fc *serverFlushCounter
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fc = &serverFlushCounter{ResponseWriter: w}
+			h.ServeHTTP(fc, r)
+		}))
+
+		req, err := cmds.NewRequest(context.Background(), []string{"count"}, nil, nil, nil, root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := NewClient(srv.URL).Send(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var i int
+		for ; ; i++ {
+			v, err := res.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v != i {
+				t.Fatalf("size %d: expected value %d, got %v", size, i, v)
+			}
+		}
+		srv.Close()
+
+		if i != n {
+			t.Errorf("size %d: expected %d values, got %d", size, n, i)
+		}
+		flushes := atomic.LoadInt32(&fc.flushes)
+		if size == 0 && flushes < n {
+			t.Errorf("expected a flush per value without buffer, got %d", flushes)
+		}
+		if size > 0 && flushes > 2*n/int32(size)+2 {
+			t.Errorf("expected a flush per batch of %d values, got %d", size, flushes)
+		}
+		if tc.metrics && atomic.LoadUint64(&emitted) != n {
+			t.Errorf("size %d: expected the metrics of %d values, got %d", size, n, emitted)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Backoff returns the time to wait before the retry-th retry of a request,
+// starting at 1, see ClientWithRetry.
+type Backoff func(retry int) time.Duration
+
+// DefaultBackoff is the Backoff used by ClientWithRetry if none is given.
+var DefaultBackoff = ExponentialBackoff(100*time.Millisecond, 5*time.Second)
+
+// ConstantBackoff waits d before every retry.
+func ConstantBackoff(d time.Duration) Backoff {
+	return func(int) time.Duration {
+		return d
+	}
+}
+
+// ExponentialBackoff waits base before the first retry and doubles the wait
+// for every further retry, up to max.
+func ExponentialBackoff(base, max time.Duration) Backoff {
+	return func(retry int) time.Duration {
+		d := base
+		for i := 1; i < retry && d < max; i++ {
+			d *= 2
+		}
+		if d > max {
+			d = max
+		}
+		return d
+	}
+}
+
+// ClientWithHTTPClient sets the HTTP client requests are sent with, e.g.
+// to configure the transport. Of it and ClientWithProtocols, the option
+// given last takes effect.
+func ClientWithHTTPClient(hc *http.Client) ClientOpt {
+	return func(c *client) {
+		c.httpClient = hc
+	}
+}
+
+// ClientWithTimeout limits the time until the headers of a response are
+// received to d, for every attempt to send a request. Reading the response
+// isn't limited, so commands can stream their output; use the context of
+// the request for that. Attempts that time out are retried if retries were
+// enabled with ClientWithRetry.
+func ClientWithTimeout(d time.Duration) ClientOpt {
+	return func(c *client) {
+		c.timeout = d
+	}
+}
+
+// ClientWithRetry retries requests up to n times, waiting for backoff
+// before each retry, if they fail on the network, time out or are answered
+// with 429 Too Many Requests, 502 Bad Gateway, 503 Service Unavailable or
+// 504 Gateway Timeout. A Retry-After header longer than the backoff is
+// honored. Other errors, including the errors of commands, aren't retried.
+// backoff defaults to DefaultBackoff.
+//
+// Retried commands may have run on the server before, which is only safe
+// for idempotent commands. Requests with files in the body can't be
+// retried, since the files were consumed.
+func ClientWithRetry(n int, backoff Backoff) ClientOpt {
+	if backoff == nil {
+		backoff = DefaultBackoff
+	}
+	return func(c *client) {
+		c.retries = n
+		c.backoff = backoff
+	}
+}
+
+// timeoutError is returned for attempts that exceeded the timeout set with
+// ClientWithTimeout. It implements net.Error.
+type timeoutError struct {
+	d time.Duration
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("no response from the server within %s", e.d)
+}
+
+func (e *timeoutError) Timeout() bool   { return true }
+func (e *timeoutError) Temporary() bool { return true }
+
+// retryStatus lists the statuses of responses that are retried.
+var retryStatus = map[int]bool{
+	http.StatusTooManyRequests:    true,
+	http.StatusBadGateway:         true,
+	http.StatusServiceUnavailable: true,
+	http.StatusGatewayTimeout:     true,
+}
+
+// doRetrying sends httpReq like do, retrying failed attempts as set up with
+// ClientWithRetry and limiting them as set with ClientWithTimeout.
+func (c *client) doRetrying(httpReq *http.Request, info *RequestInfo) (*http.Response, error) {
+	ctx := httpReq.Context()
+	canRetry := httpReq.Body == nil || httpReq.Body == http.NoBody || httpReq.GetBody != nil
+
+	for retry := 1; ; retry++ {
+		httpRes, err := c.doTimeout(httpReq, info)
+
+		if retry > c.retries || !canRetry || ctx.Err() != nil {
+			return httpRes, err
+		}
+		if err == nil && !retryStatus[httpRes.StatusCode] {
+			return httpRes, nil
+		}
+
+		wait := c.backoff(retry)
+		if httpRes != nil {
+			if after, err := strconv.Atoi(httpRes.Header.Get("Retry-After")); err == nil && time.Duration(after)*time.Second > wait {
+				wait = time.Duration(after) * time.Second
+			}
+			io.Copy(ioutil.Discard, httpRes.Body)
+			httpRes.Body.Close()
+			log.Debugf("retrying %q in %s after status %d", info.Path, wait, httpRes.StatusCode)
+		} else {
+			log.Debugf("retrying %q in %s after error: %s", info.Path, wait, err)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+
+		httpReq = httpReq.Clone(ctx)
+		if httpReq.GetBody != nil {
+			if httpReq.Body, err = httpReq.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+		info.Attempt++
+	}
+}
+
+// doTimeout is do, canceling the attempt if the headers of the response
+// weren't received within the timeout of the client.
+func (c *client) doTimeout(httpReq *http.Request, info *RequestInfo) (*http.Response, error) {
+	if c.timeout <= 0 {
+		return c.do(httpReq, info)
+	}
+
+	ctx, cancel := context.WithCancel(httpReq.Context())
+	timer := time.AfterFunc(c.timeout, cancel)
+	httpRes, err := c.do(httpReq.WithContext(ctx), info)
+	if !timer.Stop() && httpReq.Context().Err() == nil {
+		// timed out, possibly after the response was received
+		if err == nil {
+			httpRes.Body.Close()
+		}
+		cancel()
+		return nil, &timeoutError{d: c.timeout}
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	// the response is read with the context of the attempt
+	httpRes.Body = &cancelReadCloser{ReadCloser: httpRes.Body, cancel: cancel}
+	return httpRes, nil
+}
+
+// cancelReadCloser cancels a context once it is closed.
+type cancelReadCloser struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (r *cancelReadCloser) Close() error {
+	err := r.ReadCloser.Close()
+	r.cancel()
+	return err
+}
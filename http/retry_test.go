@@ -0,0 +1,110 @@
+package http
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	b := ExponentialBackoff(time.Second, 5*time.Second)
+	for retry, expected := range []time.Duration{0, time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if retry == 0 {
+			continue
+		}
+		if d := b(retry); d != expected {
+			t.Errorf("retry %d: expected %s, got %s", retry, expected, d)
+		}
+	}
+}
+
+func TestClientRetry(t *testing.T) {
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"echo": {
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					return cmds.EmitOnce(re, "ok")
+				},
+			},
+			"stream": {
+				Type: "",
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					if err := re.Emit("first"); err != nil {
+						return err
+					}
+					time.Sleep(100 * time.Millisecond)
+					return re.Emit("second")
+				},
+			},
+		},
+	}
+	h := NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, originCfg(defaultOrigins))
+
+	// failures is the number of requests that fail before the server
+	// answers, delay the time failing requests take
+	var failures, requests int32
+	var delay time.Duration
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= atomic.LoadInt32(&failures) {
+			if delay > 0 {
+				time.Sleep(delay)
+			}
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		h.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	send := func(path string, fails int32, opts ...ClientOpt) (cmds.Response, error) {
+		atomic.StoreInt32(&failures, fails)
+		atomic.StoreInt32(&requests, 0)
+		req, err := cmds.NewRequest(context.Background(), []string{path}, nil, nil, nil, root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return NewClient(srv.URL, opts...).Send(req)
+	}
+
+	var attempts int
+	hooks := ClientWithHooks(ClientHooks{OnRequest: func(info RequestInfo) { attempts = info.Attempt }})
+	if _, err := send("echo", 2, ClientWithRetry(2, ConstantBackoff(0)), hooks); err != nil {
+		t.Errorf("expected the request to succeed after retrying, got %s", err)
+	}
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts)
+	}
+	if _, err := send("echo", 2, ClientWithRetry(1, ConstantBackoff(0))); err == nil {
+		t.Error("expected the request to fail after the last retry")
+	}
+	if _, err := send("echo", 1); err == nil {
+		t.Error("expected the request to fail without retries")
+	}
+
+	delay = 200 * time.Millisecond
+	_, err := send("echo", 1, ClientWithTimeout(50*time.Millisecond))
+	if e, ok := err.(net.Error); !ok || !e.Timeout() {
+		t.Errorf("expected a timeout, got %#v", err)
+	}
+	if _, err := send("echo", 1, ClientWithTimeout(50*time.Millisecond), ClientWithRetry(1, ConstantBackoff(0))); err != nil {
+		t.Errorf("expected the request to succeed after timing out once, got %s", err)
+	}
+
+	// the timeout doesn't apply to reading the response
+	res, err := send("stream", 0, ClientWithTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"first", "second"} {
+		if v, err := res.Next(); err != nil || v != expected {
+			t.Errorf("expected %q, got %v, %v", expected, v, err)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Server serves a handler with the timeouts and limits needed by command
+// APIs. Unlike http.Server it applies the write timeout only once the
+// response headers are written, and not at all to responses that stream
+// values or data, so long running commands and streams aren't cut off.
+//
+// Use NewServer to get a Server with the default settings.
+type Server struct {
+	Handler http.Handler
+
+	// ReadHeaderTimeout is the time allowed to read the request headers.
+	ReadHeaderTimeout time.Duration
+
+	// ReadTimeout is the time allowed to read the entire request including
+	// the body. The default is no timeout, since request bodies stream the
+	// files added by the client.
+	ReadTimeout time.Duration
+
+	// WriteTimeout is the time allowed to write a non-streaming response,
+	// starting when the response headers are written.
+	WriteTimeout time.Duration
+
+	// IdleTimeout is the time a keep-alive connection may wait for the next
+	// request.
+	IdleTimeout time.Duration
+
+	// MaxHeaderBytes is the maximum size of the request headers.
+	MaxHeaderBytes int
+
+	// TLSConfig enables TLS on all listeners if set. HTTP/2 is offered if
+	// the config sets no NextProtos and Protocols allows it.
+	TLSConfig *tls.Config
+
+	// Protocols are the HTTP versions accepted, see DefaultProtocols.
+	Protocols *http.Protocols
+}
+
+// NewServer returns a Server for handler with the default settings.
+func NewServer(handler http.Handler) *Server {
+	return &Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 30 * time.Second,
+		WriteTimeout:      time.Minute,
+		IdleTimeout:       2 * time.Minute,
+		MaxHeaderBytes:    http.DefaultMaxHeaderBytes,
+		Protocols:         DefaultProtocols(),
+	}
+}
+
+// Serve serves on all listeners, see the package level Serve for how the
+// server is stopped.
+func (s *Server) Serve(ctx context.Context, listeners ...net.Listener) error {
+	if len(listeners) == 0 {
+		return fmt.Errorf("no listeners to serve on")
+	}
+
+	srv := s.httpServer()
+	if srv.TLSConfig != nil {
+		for i, l := range listeners {
+			listeners[i] = tls.NewListener(l, srv.TLSConfig)
+		}
+	}
+
+	return serve(ctx, srv, listeners)
+}
+
+// ListenAndServe serves on the sockets passed by systemd socket activation
+// or, if there are none, on addrs (see Listen for the address formats).
+func (s *Server) ListenAndServe(ctx context.Context, addrs ...string) error {
+	listeners, err := SystemdListeners()
+	if err != nil {
+		return err
+	}
+
+	if len(listeners) == 0 {
+		listeners, err = Listen(addrs...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.Serve(ctx, listeners...)
+}
+
+func (s *Server) httpServer() *http.Server {
+	h := s.Handler
+	if s.WriteTimeout > 0 {
+		h = writeTimeoutHandler(h, s.WriteTimeout)
+	}
+
+	srv := &http.Server{
+		Handler:           h,
+		ReadHeaderTimeout: s.ReadHeaderTimeout,
+		ReadTimeout:       s.ReadTimeout,
+		IdleTimeout:       s.IdleTimeout,
+		MaxHeaderBytes:    s.MaxHeaderBytes,
+		Protocols:         s.Protocols,
+	}
+
+	if s.TLSConfig != nil {
+		srv.TLSConfig = s.TLSConfig.Clone()
+		if len(srv.TLSConfig.NextProtos) == 0 {
+			if s.Protocols == nil || s.Protocols.HTTP2() {
+				srv.TLSConfig.NextProtos = append(srv.TLSConfig.NextProtos, "h2")
+			}
+			srv.TLSConfig.NextProtos = append(srv.TLSConfig.NextProtos, "http/1.1")
+		}
+	}
+
+	return srv
+}
+
+// writeTimeoutHandler sets a write deadline of timeout when the response
+// headers are written, unless the response is streamed.
+func writeTimeoutHandler(h http.Handler, timeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(&deadlineWriter{ResponseWriter: w, timeout: timeout}, r)
+	})
+}
+
+type deadlineWriter struct {
+	http.ResponseWriter
+	timeout     time.Duration
+	wroteHeader bool
+}
+
+func (w *deadlineWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+
+		h := w.Header()
+		if h.Get(streamHeader) == "" && h.Get(channelHeader) == "" {
+			err := http.NewResponseController(w.ResponseWriter).SetWriteDeadline(time.Now().Add(w.timeout))
+			if err != nil {
+				log.Debugf("failed to set write deadline: %s", err)
+			}
+		}
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *deadlineWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *deadlineWriter) Flush() {
+	flush(w.ResponseWriter)
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController.
+func (w *deadlineWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
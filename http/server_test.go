@@ -0,0 +1,123 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestServerWriteTimeout(t *testing.T) {
+	type testcase struct {
+		path string
+		ok   bool
+	}
+
+	tcs := []testcase{
+		// the timeout starts when the headers are written
+		{path: "/slowstart", ok: true},
+		{path: "/single", ok: false},
+		{path: "/stream", ok: true},
+		{path: "/chan", ok: true},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slowstart", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("hello"))
+	})
+	slowBody := func(header string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if header != "" {
+				w.Header().Set(header, "1")
+			}
+			w.WriteHeader(http.StatusOK)
+			http.NewResponseController(w).Flush()
+			time.Sleep(200 * time.Millisecond)
+			w.Write([]byte("hello"))
+		}
+	}
+	mux.HandleFunc("/single", slowBody(""))
+	mux.HandleFunc("/stream", slowBody(streamHeader))
+	mux.HandleFunc("/chan", slowBody(channelHeader))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer(mux)
+	s.WriteTimeout = 50 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Serve(ctx, l)
+
+	for _, tc := range tcs {
+		// new connections, so a failed response doesn't affect the next one
+		c := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+		res, err := c.Get("http://" + l.Addr().String() + tc.path)
+		if err != nil {
+			if tc.ok {
+				t.Errorf("%s: unexpected error: %s", tc.path, err)
+			}
+			continue
+		}
+
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		ok := err == nil && string(body) == "hello"
+		if ok != tc.ok {
+			t.Errorf("%s: expected success %v but got body %q and error %v", tc.path, tc.ok, body, err)
+		}
+	}
+}
+
+func TestServerTLS(t *testing.T) {
+	// borrow the test certificate of httptest
+	ts := httptest.NewUnstartedServer(nil)
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	certs := ts.TLS.Certificates
+	transport := ts.Client().Transport
+	ts.Close()
+
+	var proto string
+	s := NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proto = r.Proto
+		w.Write([]byte("hello"))
+	}))
+	s.TLSConfig = &tls.Config{Certificates: certs}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Serve(ctx, l)
+
+	c := &http.Client{Transport: transport}
+	res, err := c.Get("https://" + l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "hello" {
+		t.Errorf("expected body %q but got %q", "hello", body)
+	}
+	if proto != "HTTP/2.0" {
+		t.Errorf("expected HTTP/2.0 but got %s", proto)
+	}
+}
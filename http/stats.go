@@ -0,0 +1,28 @@
+package http
+
+import (
+	"io"
+)
+
+// countingReader calls count with the number of bytes read from r.
+type countingReader struct {
+	r     io.Reader
+	count func(uint64)
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.count(uint64(n))
+	return n, err
+}
+
+// countingReadCloser is a countingReader that also closes the underlying
+// reader.
+type countingReadCloser struct {
+	countingReader
+	c io.Closer
+}
+
+func (r *countingReadCloser) Close() error {
+	return r.c.Close()
+}
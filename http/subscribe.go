@@ -0,0 +1,115 @@
+package http
+
+import (
+	"io"
+	"time"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+)
+
+const (
+	// minResumeDelay and maxResumeDelay bound the time Subscribe waits
+	// before reconnecting.
+	minResumeDelay = 100 * time.Millisecond
+	maxResumeDelay = 10 * time.Second
+)
+
+// Subscribe sends req, a request to a subscription command, and returns a
+// response that reconnects if the connection to the server drops. The
+// request is sent again with the ResumeOpt option set to the token of the
+// last value received, see cmds.ResumeTokener, so the command resumes after
+// it. Subscribe keeps reconnecting, backing off up to 10s, until the context
+// of the request is canceled or the server responds with an error.
+func Subscribe(c Client, req *cmds.Request) (cmds.Response, error) {
+	res, err := c.Send(req)
+	if err != nil {
+		return nil, err
+	}
+	return &subscription{c: c, req: req, res: res}, nil
+}
+
+type subscription struct {
+	c   Client
+	req *cmds.Request
+	res cmds.Response
+
+	// token is the resume token of the last value.
+	token string
+}
+
+func (s *subscription) Request() *cmds.Request {
+	return s.req
+}
+
+func (s *subscription) Error() *cmdkit.Error {
+	return s.res.Error()
+}
+
+func (s *subscription) Length() uint64 {
+	return s.res.Length()
+}
+
+func (s *subscription) Next() (interface{}, error) {
+	for {
+		v, err := s.res.Next()
+		if err == nil {
+			if t, ok := v.(cmds.ResumeTokener); ok {
+				s.token = t.ResumeToken()
+			}
+			return v, nil
+		}
+
+		if !resumable(err) || s.req.Context.Err() != nil {
+			return nil, err
+		}
+
+		log.Debugf("subscription to %q dropped, resuming after %q: %s", s.req.Path, s.token, err)
+		if err := s.resume(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// resume sends the request again until it succeeds, the context is canceled
+// or the server responds with an error.
+func (s *subscription) resume() error {
+	if s.token != "" {
+		s.req.SetOption(cmds.ResumeOpt, s.token)
+	}
+
+	delay := minResumeDelay
+	for {
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-s.req.Context.Done():
+			timer.Stop()
+			return s.req.Context.Err()
+		}
+
+		res, err := s.c.Send(s.req)
+		if err == nil {
+			s.res = res
+			return nil
+		}
+		if !resumable(err) {
+			return err
+		}
+
+		if delay *= 2; delay > maxResumeDelay {
+			delay = maxResumeDelay
+		}
+	}
+}
+
+// resumable returns whether a subscription failing with err should be
+// resumed, i.e. whether the connection dropped.
+func resumable(err error) bool {
+	switch err.(type) {
+	case *cmdkit.Error, cmdkit.Error:
+		return false
+	}
+	return err != io.EOF && err != ErrResponseAborted
+}
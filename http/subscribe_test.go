@@ -0,0 +1,86 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+)
+
+type event struct {
+	Seq int
+}
+
+func (e *event) ResumeToken() string {
+	return strconv.Itoa(e.Seq)
+}
+
+func TestSubscribeResume(t *testing.T) {
+	var conns int
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"follow": {
+				Options:   []cmdkit.Option{cmds.OptionResume},
+				Streaming: true,
+				Type:      event{},
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					conns++
+					start := 0
+					if token := cmds.ResumeToken(req); token != "" {
+						seq, err := strconv.Atoi(token)
+						if err != nil {
+							return err
+						}
+						start = seq + 1
+					}
+
+					for seq := start; seq < 6; seq++ {
+						if conns == 1 && seq == 3 {
+							// drop the connection
+							panic(http.ErrAbortHandler)
+						}
+						if err := re.Emit(&event{Seq: seq}); err != nil {
+							return err
+						}
+					}
+					return nil
+				},
+			},
+		},
+	}
+
+	h := NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, originCfg(defaultOrigins))
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	req, err := cmds.NewRequest(context.Background(), []string{"follow"}, nil, nil, nil, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := Subscribe(NewClient(srv.URL), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var seqs []int
+	err = cmds.ForEach(res, func(v interface{}) error {
+		seqs = append(seqs, v.(*event).Seq)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []int{0, 1, 2, 3, 4, 5}; !reflect.DeepEqual(seqs, expected) {
+		t.Errorf("expected events %v but got %v", expected, seqs)
+	}
+	if conns != 2 {
+		t.Errorf("expected 2 connections but got %d", conns)
+	}
+}
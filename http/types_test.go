@@ -0,0 +1,65 @@
+package http
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+func TestTaggedValues(t *testing.T) {
+	type progress struct {
+		Done int
+	}
+	type result struct {
+		Hash string
+	}
+
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"add": {
+				Types: map[string]interface{}{
+					"progress": progress{},
+					"result":   result{},
+				},
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					if err := re.Emit(&progress{50}); err != nil {
+						return err
+					}
+					return re.Emit(&result{"Qm"})
+				},
+			},
+		},
+	}
+
+	srv := httptest.NewServer(NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, originCfg(defaultOrigins)))
+	defer srv.Close()
+
+	req, err := cmds.NewRequest(context.Background(), []string{"add"}, nil, nil, nil, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := NewClient(srv.URL).Send(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var values []interface{}
+	if err := cmds.ForEach(res, func(v interface{}) error {
+		values = append(values, v)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(values) != 2 {
+		t.Fatalf("expected 2 values but got %v", values)
+	}
+	if p, ok := values[0].(*progress); !ok || p.Done != 50 {
+		t.Errorf("expected the progress value, got %#v", values[0])
+	}
+	if r, ok := values[1].(*result); !ok || r.Hash != "Qm" {
+		t.Errorf("expected the result value, got %#v", values[1])
+	}
+}
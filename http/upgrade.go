@@ -0,0 +1,56 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+const (
+	upgradeHeader    = "Upgrade"
+	connectionHeader = "Connection"
+)
+
+// Upgrader serves requests whose client asked to switch to another protocol
+// with the Upgrade header, e.g. ws.NewUpgrader for WebSocket. Upgraders are
+// registered in ServerConfig.Upgraders.
+//
+// Upgrade takes over the connection of r and returns the emitter the output
+// of the command is sent with, which the handler passes to the command once
+// Upgrade returned. Upgrade may replace req.Context, e.g. to cancel the
+// command if the connection is lost. If the upgrade fails, Upgrade answers r
+// itself and returns the error.
+type Upgrader interface {
+	Upgrade(w http.ResponseWriter, r *http.Request, req *cmds.Request) (cmds.ResponseEmitter, error)
+}
+
+// upgrader returns the upgrader for the first protocol in the Upgrade header
+// of r that has one, or nil if r doesn't ask for an upgrade.
+func (h *handler) upgrader(r *http.Request) Upgrader {
+	if len(h.cfg.Upgraders) == 0 || !headerHasToken(r.Header, connectionHeader, "upgrade") {
+		return nil
+	}
+
+	for _, proto := range strings.Split(r.Header.Get(upgradeHeader), ",") {
+		// ignore the version, e.g. of h2c/1
+		name := strings.SplitN(strings.TrimSpace(proto), "/", 2)[0]
+		if up, ok := h.cfg.Upgraders[strings.ToLower(name)]; ok {
+			return up
+		}
+	}
+	return nil
+}
+
+// headerHasToken returns whether the comma-separated lists of the header key
+// in h contain token, ignoring case.
+func headerHasToken(h http.Header, key, token string) bool {
+	for _, v := range h.Values(key) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
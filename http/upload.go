@@ -0,0 +1,481 @@
+package http
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+const (
+	// UploadPath is the path prefix of the endpoint staging the bodies of
+	// requests for resumable uploads, see ServerConfig.UploadDir:
+	//
+	//	POST <APIPath>/_upload          creates an upload, whose id is
+	//	                                returned in X-Upload-Id
+	//	HEAD <APIPath>/_upload/<id>     returns the size of the upload in
+	//	                                X-Upload-Offset
+	//	POST <APIPath>/_upload/<id>     appends the body to the upload,
+	//	                                if X-Upload-Offset is its size
+	//
+	// The command is then sent without a body, with the X-Upload-Id header
+	// set to the id of the staged body. The requests name the command the
+	// body is staged for in the cmd parameter, e.g. cmd=pin+add, which is
+	// authorized like the completions, see ServerConfig.Authorizer.
+	UploadPath = "_upload"
+
+	uploadCommandParam = "cmd"
+
+	uploadIDHeader     = "X-Upload-Id"
+	uploadOffsetHeader = "X-Upload-Offset"
+
+	// DefaultUploadTTL is the time staged uploads are kept if they aren't
+	// completed, see ServerConfig.UploadTTL.
+	DefaultUploadTTL = 24 * time.Hour
+
+	// defaultChunkRetries is the number of times a chunk is resumed if the
+	// client doesn't retry requests, see ClientWithResumableUploads.
+	defaultChunkRetries = 3
+)
+
+var uploadIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+var (
+	// errUploadBusy is returned for uploads that are written or consumed
+	// by another request.
+	errUploadBusy = errors.New("the upload is in use by another request")
+	// errUploadTooLarge is returned for chunks writing past the maximum
+	// size of uploads.
+	errUploadTooLarge = errors.New("the upload exceeds the maximum size")
+	// errTooManyUploads is returned if the maximum number of uploads is
+	// staged.
+	errTooManyUploads = errors.New("too many uploads are staged")
+)
+
+// isUploadRequest checks whether pth (without leading slash) addresses the
+// upload endpoint.
+func isUploadRequest(pth string) bool {
+	return pth == UploadPath || strings.HasPrefix(pth, UploadPath+"/")
+}
+
+// uploadStore keeps the staged uploads in a directory, one file per upload
+// named by its id.
+type uploadStore struct {
+	dir string
+	ttl time.Duration
+	// maxSize and maxUploads limit the uploads, zero if unlimited.
+	maxSize    int64
+	maxUploads int
+
+	l sync.Mutex
+	// busy holds the uploads being written or consumed.
+	busy map[string]bool
+	// expiry removes the expired uploads while there are any, nil if no
+	// upload is staged.
+	expiry *time.Timer
+}
+
+func newUploadStore(dir string, ttl time.Duration, maxSize int64, maxUploads int) *uploadStore {
+	if ttl <= 0 {
+		ttl = DefaultUploadTTL
+	}
+	return &uploadStore{dir: dir, ttl: ttl, maxSize: maxSize, maxUploads: maxUploads, busy: make(map[string]bool)}
+}
+
+func (s *uploadStore) path(id string) (string, error) {
+	if !uploadIDPattern.MatchString(id) {
+		return "", fmt.Errorf("invalid upload id %q", id)
+	}
+	return filepath.Join(s.dir, id), nil
+}
+
+// create creates an empty upload and removes the expired ones.
+func (s *uploadStore) create() (string, error) {
+	if staged := s.expire(); s.maxUploads > 0 && staged >= s.maxUploads {
+		return "", errTooManyUploads
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(b)
+
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return "", err
+	}
+	f, err := os.OpenFile(filepath.Join(s.dir, id), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", err
+	}
+
+	s.l.Lock()
+	if s.expiry == nil {
+		s.expiry = time.AfterFunc(s.ttl, s.expireStaged)
+	}
+	s.l.Unlock()
+
+	return id, f.Close()
+}
+
+// expire removes the uploads that weren't written to within the TTL and
+// returns the number of uploads left.
+func (s *uploadStore) expire() int {
+	fis, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return 0
+	}
+
+	s.l.Lock()
+	defer s.l.Unlock()
+	var staged int
+	for _, fi := range fis {
+		if !uploadIDPattern.MatchString(fi.Name()) {
+			continue
+		}
+		if !s.busy[fi.Name()] && time.Since(fi.ModTime()) > s.ttl {
+			os.Remove(filepath.Join(s.dir, fi.Name()))
+			continue
+		}
+		staged++
+	}
+	return staged
+}
+
+// expireStaged removes the expired uploads every TTL while uploads are
+// staged, so they are removed within twice the TTL even if no upload is
+// created.
+func (s *uploadStore) expireStaged() {
+	staged := s.expire()
+
+	s.l.Lock()
+	defer s.l.Unlock()
+	if staged > 0 {
+		s.expiry.Reset(s.ttl)
+	} else {
+		s.expiry = nil
+	}
+}
+
+// acquire marks the upload as busy, it must be released afterwards.
+func (s *uploadStore) acquire(id string) (string, error) {
+	p, err := s.path(id)
+	if err != nil {
+		return "", err
+	}
+
+	s.l.Lock()
+	defer s.l.Unlock()
+	if s.busy[id] {
+		return "", errUploadBusy
+	}
+	if _, err := os.Stat(p); err != nil {
+		return "", fmt.Errorf("unknown upload %q", id)
+	}
+	s.busy[id] = true
+	return p, nil
+}
+
+func (s *uploadStore) release(id string) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	delete(s.busy, id)
+}
+
+// offset returns the size of the upload.
+func (s *uploadStore) offset(id string) (int64, error) {
+	p, err := s.path(id)
+	if err != nil {
+		return 0, err
+	}
+	fi, err := os.Stat(p)
+	if err != nil {
+		return 0, fmt.Errorf("unknown upload %q", id)
+	}
+	return fi.Size(), nil
+}
+
+// offsetError is returned for chunks that don't continue the upload.
+type offsetError struct {
+	offset int64
+}
+
+func (e *offsetError) Error() string {
+	return fmt.Sprintf("the upload continues at offset %d", e.offset)
+}
+
+// write appends r to the upload if it is of size offset and returns the new
+// size. The data that was read is kept if r fails, so the client can resume
+// after it.
+func (s *uploadStore) write(id string, offset int64, r io.Reader) (int64, error) {
+	p, err := s.acquire(id)
+	if err != nil {
+		return 0, err
+	}
+	defer s.release(id)
+
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if fi.Size() != offset {
+		return 0, &offsetError{offset: fi.Size()}
+	}
+
+	if s.maxSize <= 0 {
+		n, err := io.Copy(f, r)
+		return offset + n, err
+	}
+
+	// read one byte more to notice chunks writing past the maximum size
+	n, err := io.Copy(f, io.LimitReader(r, s.maxSize-offset+1))
+	if offset+n > s.maxSize {
+		if err := f.Truncate(s.maxSize); err != nil {
+			return 0, err
+		}
+		return s.maxSize, errUploadTooLarge
+	}
+	return offset + n, err
+}
+
+// open returns the upload to be consumed by a request. It is removed when
+// closed.
+func (s *uploadStore) open(id string) (io.ReadCloser, error) {
+	p, err := s.acquire(id)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		s.release(id)
+		return nil, err
+	}
+	return &stagedUpload{File: f, s: s, id: id}, nil
+}
+
+type stagedUpload struct {
+	*os.File
+	s  *uploadStore
+	id string
+}
+
+func (u *stagedUpload) Close() error {
+	err := u.File.Close()
+	os.Remove(u.File.Name())
+	u.s.release(u.id)
+	return err
+}
+
+func (h *handler) serveUpload(w http.ResponseWriter, r *http.Request) {
+	if h.uploads == nil {
+		http.Error(w, ErrNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	if !h.authorizePath(w, r, strings.Fields(r.URL.Query().Get(uploadCommandParam))) {
+		return
+	}
+
+	id := strings.Trim(strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/"), UploadPath), "/")
+
+	switch {
+	case id == "" && r.Method == http.MethodPost:
+		id, err := h.uploads.create()
+		if err == errTooManyUploads {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		if err != nil {
+			log.Errorf("error creating upload: %s", err)
+			http.Error(w, "500 - Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set(uploadIDHeader, id)
+		w.WriteHeader(http.StatusCreated)
+
+	case id != "" && r.Method == http.MethodHead:
+		offset, err := h.uploads.offset(id)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set(uploadOffsetHeader, strconv.FormatInt(offset, 10))
+		w.WriteHeader(http.StatusOK)
+
+	case id != "" && r.Method == http.MethodPost:
+		offset, err := strconv.ParseInt(r.Header.Get(uploadOffsetHeader), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid "+uploadOffsetHeader+" header", http.StatusBadRequest)
+			return
+		}
+
+		offset, err = h.uploads.write(id, offset, r.Body)
+		switch err.(type) {
+		case nil:
+			w.Header().Set(uploadOffsetHeader, strconv.FormatInt(offset, 10))
+			w.WriteHeader(http.StatusNoContent)
+		case *offsetError:
+			w.Header().Set(uploadOffsetHeader, strconv.FormatInt(err.(*offsetError).offset, 10))
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			switch err {
+			case errUploadBusy:
+				http.Error(w, err.Error(), http.StatusConflict)
+			case errUploadTooLarge:
+				w.Header().Set(uploadOffsetHeader, strconv.FormatInt(offset, 10))
+				http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			default:
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			}
+		}
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// ClientWithResumableUploads makes the client stage the bodies of requests
+// with files on the server before sending the command, in chunks of
+// chunkSize bytes. If sending a chunk fails, the client asks the server how
+// much of it arrived and resends the rest, instead of restarting the
+// upload. Chunks are resumed as often as requests are retried, see
+// ClientWithRetry, or three times if requests aren't retried.
+//
+// The server must have resumable uploads enabled, see
+// ServerConfig.UploadDir. Requests with staged uploads aren't failed over
+// to other endpoints, which don't have the upload. The stdin of Interactive
+// commands isn't staged.
+func ClientWithResumableUploads(chunkSize int64) ClientOpt {
+	return func(c *client) {
+		c.chunkSize = chunkSize
+	}
+}
+
+// stageUpload uploads the body of httpReq to the upload endpoint and
+// replaces it by the id of the upload.
+func (c *client) stageUpload(req *cmds.Request, httpReq *http.Request) error {
+	ctx := httpReq.Context()
+	base := c.endpoints.match(httpReq.URL.String()) + c.apiPrefix + "/" + UploadPath
+	query := "?" + url.Values{uploadCommandParam: {strings.Join(req.Path, " ")}}.Encode()
+
+	newRequest := func(method, url string, body io.Reader) (*http.Request, error) {
+		r, err := http.NewRequest(method, url, body)
+		if err != nil {
+			return nil, err
+		}
+		c.setHeaders(r)
+		return r.WithContext(ctx), nil
+	}
+	send := func(r *http.Request, status int) (*http.Response, error) {
+		res, err := c.httpClient.Do(r)
+		if err != nil {
+			return nil, err
+		}
+		io.Copy(ioutil.Discard, res.Body)
+		res.Body.Close()
+		if res.StatusCode != status {
+			return res, fmt.Errorf("%s %s: %s", r.Method, UploadPath, res.Status)
+		}
+		return res, nil
+	}
+
+	r, err := newRequest(http.MethodPost, base+query, nil)
+	if err != nil {
+		return err
+	}
+	res, err := send(r, http.StatusCreated)
+	if err != nil {
+		return err
+	}
+	id := res.Header.Get(uploadIDHeader)
+	uploadURL := base + "/" + id + query
+
+	retries := c.retries
+	if retries == 0 {
+		retries = defaultChunkRetries
+	}
+	backoff := c.backoff
+	if backoff == nil {
+		backoff = DefaultBackoff
+	}
+
+	body := httpReq.Body
+	defer body.Close()
+	chunk := make([]byte, c.chunkSize)
+	var offset int64
+	for {
+		n, rerr := io.ReadFull(body, chunk)
+		if rerr != nil && rerr != io.EOF && rerr != io.ErrUnexpectedEOF {
+			return rerr
+		}
+
+		// send the chunk, resuming after the data that arrived
+		sent, end := offset, offset+int64(n)
+		for retry := 0; sent < end; retry++ {
+			r, err := newRequest(http.MethodPost, uploadURL, bytes.NewReader(chunk[sent-offset:n]))
+			if err != nil {
+				return err
+			}
+			r.Header.Set(uploadOffsetHeader, strconv.FormatInt(sent, 10))
+			res, err := send(r, http.StatusNoContent)
+			if err == nil {
+				sent = end
+				break
+			}
+			if retry >= retries || ctx.Err() != nil || (res != nil && res.StatusCode == http.StatusRequestEntityTooLarge) {
+				return err
+			}
+
+			log.Debugf("resuming upload of %q after error: %s", req.Path, err)
+			timer := time.NewTimer(backoff(retry + 1))
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			}
+			r, err = newRequest(http.MethodHead, uploadURL, nil)
+			if err != nil {
+				return err
+			}
+			res, err = send(r, http.StatusOK)
+			if err != nil {
+				continue
+			}
+			if o, err := strconv.ParseInt(res.Header.Get(uploadOffsetHeader), 10, 64); err == nil && o >= offset && o <= end {
+				sent = o
+			}
+		}
+		offset = end
+
+		if rerr != nil {
+			break
+		}
+	}
+
+	httpReq.Body = http.NoBody
+	httpReq.ContentLength = 0
+	httpReq.Header.Set(uploadIDHeader, id)
+	return nil
+}
@@ -0,0 +1,263 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	"github.com/ipfs/go-ipfs-files"
+)
+
+var catCmd = &cmds.Command{
+	Arguments: []cmdkit.Argument{cmdkit.FileArg("file", true, false, "the file to print")},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		f, err := req.Files.NextFile()
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadAll(f)
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(re, string(data))
+	},
+	Type: "",
+}
+
+func catRequest(t *testing.T, data string) *cmds.Request {
+	root := &cmds.Command{Subcommands: map[string]*cmds.Command{"cat": catCmd}}
+	req, err := cmds.NewRequest(context.Background(), []string{"cat"}, nil, nil, files.NewSliceFile("", "", []files.File{
+		files.NewReaderFile("file", "file", ioutil.NopCloser(strings.NewReader(data)), nil),
+	}), root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+// failingReader returns an error after n bytes, like an interrupted
+// connection.
+type failingReader struct {
+	r io.Reader
+	n int
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.n <= 0 {
+		return 0, errors.New("connection interrupted")
+	}
+	if len(p) > r.n {
+		p = p[:r.n]
+	}
+	n, err := r.r.Read(p)
+	r.n -= n
+	return n, err
+}
+
+func TestResumableUpload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "uploads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	root := &cmds.Command{Subcommands: map[string]*cmds.Command{"cat": catCmd}}
+	cfg := originCfg(defaultOrigins)
+	cfg.UploadDir = dir
+	h := NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, cfg)
+
+	// the second chunk is interrupted after 100 bytes
+	var (
+		l       sync.Mutex
+		chunks  int
+		offsets []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/"+UploadPath+"/") {
+			l.Lock()
+			chunks++
+			offsets = append(offsets, r.Header.Get(uploadOffsetHeader))
+			if chunks == 2 {
+				r.Body = ioutil.NopCloser(&failingReader{r: r.Body, n: 100})
+			}
+			l.Unlock()
+		}
+		h.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	data := strings.Repeat("0123456789", 300)
+	var sent int64
+	c := NewClient(srv.URL, ClientWithResumableUploads(1024), ClientWithRetry(0, ConstantBackoff(0)), ClientWithUploadProgress(func(s, total int64) {
+		sent = s
+	}))
+
+	res, err := c.Send(catRequest(t, data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := res.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != data {
+		t.Errorf("expected the command to read %d bytes, got %d", len(data), len(v.(string)))
+	}
+	if sent <= int64(len(data)) {
+		t.Errorf("expected more than %d bytes reported sent, got %d", len(data), sent)
+	}
+
+	// the interrupted chunk is resumed after the bytes that arrived
+	if len(offsets) < 3 || offsets[1] != "1024" || offsets[2] != "1124" {
+		t.Errorf("expected the chunk at 1024 to be resumed at 1124, got offsets %v", offsets)
+	}
+
+	// the upload is removed once the command was served
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fis) != 0 {
+		t.Errorf("expected no staged uploads, got %d", len(fis))
+	}
+}
+
+func TestUploadEndpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "uploads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	root := &cmds.Command{Subcommands: map[string]*cmds.Command{"cat": catCmd}}
+	cfg := originCfg(defaultOrigins)
+	cfg.UploadDir = dir
+	srv := httptest.NewServer(NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, cfg))
+	defer srv.Close()
+
+	do := func(method, path string, offset string, body string) *http.Response {
+		r, err := http.NewRequest(method, srv.URL+"/"+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if offset != "" {
+			r.Header.Set(uploadOffsetHeader, offset)
+		}
+		res, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res
+	}
+
+	res := do(http.MethodPost, UploadPath, "", "")
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", res.StatusCode)
+	}
+	id := res.Header.Get(uploadIDHeader)
+
+	if res := do(http.MethodPost, UploadPath+"/"+id, "0", "abc"); res.StatusCode != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", res.StatusCode)
+	}
+	res = do(http.MethodPost, UploadPath+"/"+id, "1", "bc")
+	if res.StatusCode != http.StatusConflict || res.Header.Get(uploadOffsetHeader) != "3" {
+		t.Errorf("expected status 409 at offset 3, got %d at %q", res.StatusCode, res.Header.Get(uploadOffsetHeader))
+	}
+	res = do(http.MethodHead, UploadPath+"/"+id, "", "")
+	if res.StatusCode != http.StatusOK || res.Header.Get(uploadOffsetHeader) != "3" {
+		t.Errorf("expected status 200 at offset 3, got %d at %q", res.StatusCode, res.Header.Get(uploadOffsetHeader))
+	}
+
+	for _, bad := range []string{"../uploads", "0123", strings.Repeat("0", 32)} {
+		if res := do(http.MethodPost, UploadPath+"/"+bad, "0", "abc"); res.StatusCode == http.StatusNoContent {
+			t.Errorf("expected upload %q to be rejected", bad)
+		}
+	}
+
+	// a command using an unknown upload is rejected
+	r, _ := http.NewRequest(http.MethodPost, srv.URL+"/cat", nil)
+	r.Header.Set(uploadIDHeader, strings.Repeat("0", 32))
+	res, err = http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", res.StatusCode)
+	}
+}
+
+func TestUploadLimits(t *testing.T) {
+	cfg := originCfg(defaultOrigins)
+	cfg.UploadDir = t.TempDir()
+	cfg.MaxUploadSize = 4
+	cfg.MaxUploads = 1
+	h := NewHandler(testEnv{rootCtx: context.Background(), t: t}, cmdRoot, cfg)
+
+	do := func(method, path string, offset string, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/"+path, strings.NewReader(body))
+		if offset != "" {
+			r.Header.Set(uploadOffsetHeader, offset)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	res := do(http.MethodPost, UploadPath, "", "")
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", res.Code)
+	}
+	id := res.Header().Get(uploadIDHeader)
+	if res := do(http.MethodPost, UploadPath, "", ""); res.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503 for too many uploads, got %d", res.Code)
+	}
+
+	if res := do(http.MethodPost, UploadPath+"/"+id, "0", "abc"); res.Code != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", res.Code)
+	}
+	res = do(http.MethodPost, UploadPath+"/"+id, "3", "de")
+	if res.Code != http.StatusRequestEntityTooLarge || res.Header().Get(uploadOffsetHeader) != "4" {
+		t.Errorf("expected status 413 at offset 4, got %d at %q", res.Code, res.Header().Get(uploadOffsetHeader))
+	}
+
+	// uploads expire without further uploads being created
+	s := newUploadStore(t.TempDir(), 10*time.Millisecond, 0, 0)
+	id, err := s.create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, err := s.offset(id); err != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the upload to expire")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestResumableUploadDisabled(t *testing.T) {
+	root := &cmds.Command{Subcommands: map[string]*cmds.Command{"cat": catCmd}}
+	srv := httptest.NewServer(NewHandler(testEnv{rootCtx: context.Background(), t: t}, root, originCfg(defaultOrigins)))
+	defer srv.Close()
+
+	c := NewClient(srv.URL, ClientWithResumableUploads(1024))
+	if _, err := c.Send(catRequest(t, "data")); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("expected the upload to fail with 404, got %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+// validateRequested checks whether r asks for the request to be validated
+// instead of run, see cmds.ValidateOpt.
+func validateRequested(r *http.Request) bool {
+	validate, _ := strconv.ParseBool(r.URL.Query().Get(cmds.ValidateOpt))
+	return validate
+}
+
+// serveValidation answers a request with the validation of req, or, if
+// parsing the request failed with parseErr, with a validation reporting the
+// error. Validations are sent with status 200, clients check Valid.
+func (h *handler) serveValidation(w http.ResponseWriter, r *http.Request, req *cmds.Request, parseErr error) {
+	var v cmds.Validation
+	if parseErr != nil {
+		v = cmds.Validation{
+			Path:        strings.Split(strings.Trim(r.URL.Path, "/"), "/"),
+			Diagnostics: []cmds.Diagnostic{{Kind: cmds.DiagnosticRequest, Message: parseErr.Error()}},
+		}
+	} else {
+		env := h.env
+		if h.cfg.MakeEnvironment != nil {
+			var err error
+			env, err = h.cfg.MakeEnvironment(req.Context, req)
+			if err != nil {
+				log.Errorf("error making the environment for %q: %s", req.Path, err)
+				http.Error(w, sanitizedErrStr(err), http.StatusInternalServerError)
+				return
+			}
+			defer cmds.CloseEnvironment(env)
+		}
+		v = cmds.ValidateRequest(req, env)
+	}
+
+	w.Header().Set(contentTypeHeader, applicationJson)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Debugf("error sending the validation of %q: %s", r.URL.Path, err)
+	}
+}
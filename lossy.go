@@ -0,0 +1,168 @@
+package cmds
+
+import (
+	"sync"
+)
+
+// DropPolicy selects the value a lossy emitter drops when its buffer is full,
+// see NewLossyEmitter.
+type DropPolicy int
+
+const (
+	// DropOldest drops the oldest buffered value, so the consumer sees the
+	// latest state.
+	DropOldest DropPolicy = iota
+	// DropNewest drops the value being emitted.
+	DropNewest
+)
+
+// NewLossyEmitter returns a ResponseEmitter for commands emitting frequent
+// status updates. It buffers up to size values and sends them to re in the
+// background, so Emit never waits for a slow consumer. If the buffer is
+// full, a value is dropped according to policy.
+//
+// Commands must close the returned emitter instead of re, passing it the
+// error they fail with. Closing waits until the buffered values were sent
+// and then closes re.
+func NewLossyEmitter(re ResponseEmitter, size int, policy DropPolicy) ResponseEmitter {
+	if size < 1 {
+		size = 1
+	}
+
+	lre := &lossyEmitter{
+		ResponseEmitter: re,
+		size:            size,
+		policy:          policy,
+		buf:             make([]interface{}, 0, size),
+		wake:            make(chan struct{}, 1),
+		done:            make(chan struct{}),
+	}
+	go lre.forward()
+
+	return lre
+}
+
+type lossyEmitter struct {
+	ResponseEmitter
+
+	size   int
+	policy DropPolicy
+
+	// wake is signaled when a value was buffered or the emitter was closed.
+	wake chan struct{}
+	// done is closed when forward returns.
+	done chan struct{}
+
+	l      sync.Mutex
+	buf    []interface{}
+	closed bool
+	// err is the error sending a value to the underlying emitter failed
+	// with.
+	err error
+}
+
+func (re *lossyEmitter) Emit(v interface{}) error {
+	// channel emission iteration
+	if ch, ok := v.(chan interface{}); ok {
+		v = (<-chan interface{})(ch)
+	}
+	if ch, isChan := v.(<-chan interface{}); isChan {
+		return EmitChan(re, ch)
+	}
+
+	_, err := re.push(v)
+	return err
+}
+
+// TryEmit is Emit reporting whether v was buffered or dropped.
+func (re *lossyEmitter) TryEmit(v interface{}) (bool, error) {
+	switch v.(type) {
+	case chan interface{}, <-chan interface{}:
+		return false, ErrTryEmitChan
+	}
+
+	return re.push(v)
+}
+
+// push buffers v and returns whether it wasn't dropped.
+func (re *lossyEmitter) push(v interface{}) (bool, error) {
+	re.l.Lock()
+	defer re.l.Unlock()
+
+	if re.closed {
+		return false, ErrClosedEmitter
+	}
+	if re.err != nil {
+		return false, re.err
+	}
+
+	if len(re.buf) == re.size {
+		if re.policy == DropNewest {
+			return false, nil
+		}
+		copy(re.buf, re.buf[1:])
+		re.buf = re.buf[:len(re.buf)-1]
+	}
+	re.buf = append(re.buf, v)
+	re.signal()
+
+	return true, nil
+}
+
+func (re *lossyEmitter) signal() {
+	select {
+	case re.wake <- struct{}{}:
+	default:
+	}
+}
+
+// forward sends the buffered values to the underlying emitter until the
+// emitter is closed and the buffer is empty.
+func (re *lossyEmitter) forward() {
+	defer close(re.done)
+
+	for {
+		re.l.Lock()
+		if len(re.buf) == 0 {
+			closed := re.closed
+			re.l.Unlock()
+
+			if closed {
+				return
+			}
+			<-re.wake
+			continue
+		}
+
+		v := re.buf[0]
+		copy(re.buf, re.buf[1:])
+		re.buf = re.buf[:len(re.buf)-1]
+		re.l.Unlock()
+
+		if err := re.ResponseEmitter.Emit(v); err != nil {
+			re.l.Lock()
+			re.err = err
+			re.buf = re.buf[:0]
+			re.l.Unlock()
+			return
+		}
+	}
+}
+
+func (re *lossyEmitter) Close() error {
+	return re.CloseWithError(nil)
+}
+
+func (re *lossyEmitter) CloseWithError(err error) error {
+	re.l.Lock()
+	if re.closed {
+		re.l.Unlock()
+		return ErrClosingClosedEmitter
+	}
+	re.closed = true
+	re.signal()
+	re.l.Unlock()
+
+	<-re.done
+	return re.ResponseEmitter.CloseWithError(err)
+}
@@ -0,0 +1,56 @@
+package cmds
+
+import (
+	"context"
+	"io"
+	"testing"
+)
+
+func TestLossyEmitter(t *testing.T) {
+	tcs := []struct {
+		policy DropPolicy
+		check  func(values []int) bool
+	}{
+		// the latest value is always delivered
+		{DropOldest, func(values []int) bool { return values[len(values)-1] == 99 }},
+		// the first value is always delivered and the buffer only holds one
+		{DropNewest, func(values []int) bool { return values[0] == 0 && values[len(values)-1] <= 1 }},
+	}
+
+	for _, tc := range tcs {
+		req, err := NewRequest(context.Background(), nil, nil, nil, nil, &Command{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		re, res := NewChanResponsePair(req)
+		lre := NewLossyEmitter(re, 1, tc.policy)
+
+		// nobody reads yet, so Emit must not wait for the consumer
+		for i := 0; i < 100; i++ {
+			if err := lre.Emit(i); err != nil {
+				t.Fatal(err)
+			}
+		}
+		go lre.Close()
+
+		var values []int
+		for {
+			v, err := res.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			values = append(values, v.(int))
+		}
+
+		if len(values) == 0 || len(values) > 2 || !tc.check(values) {
+			t.Errorf("policy %d: unexpected values %v", tc.policy, values)
+		}
+		if err := lre.Emit(100); err != ErrClosedEmitter {
+			t.Errorf("policy %d: expected ErrClosedEmitter, got %v", tc.policy, err)
+		}
+	}
+}
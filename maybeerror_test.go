@@ -1,6 +1,7 @@
 package cmds
 
 import (
+	"bytes"
 	"encoding/json"
 	"io"
 	"reflect"
@@ -8,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/ipfs/go-ipfs-cmdkit"
+	"github.com/ipfs/go-ipfs-cmds/cbor"
 )
 
 func errcmp(t *testing.T, exp, got error, msg string) {
@@ -142,3 +144,44 @@ func TestMaybeError(t *testing.T) {
 		})
 	}
 }
+
+func TestMaybeErrorCBOR(t *testing.T) {
+	var buf bytes.Buffer
+	enc := cbor.NewEncoder(&buf)
+	for _, v := range []interface{}{Foo{23}, map[string]string{"Type": "other"}} {
+		if err := enc.Encode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, data, err := MarshalError(CBOR, &cmdkit.Error{Message: "some error", Code: cmdkit.ErrClient})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Write(data)
+
+	d := cbor.NewDecoder(&buf)
+
+	m := &MaybeError{Value: Foo{}}
+	if err := d.Decode(m); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := m.Get(); err != nil || !reflect.DeepEqual(v, &Foo{23}) {
+		t.Errorf("expected %#v but got %#v, %v", &Foo{23}, v, err)
+	}
+
+	m = &MaybeError{}
+	if err := d.Decode(m); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := m.Get(); err != nil || !reflect.DeepEqual(v, map[string]interface{}{"Type": "other"}) {
+		t.Errorf("expected a value that isn't an error, got %#v, %v", v, err)
+	}
+
+	m = &MaybeError{Value: Foo{}}
+	if err := d.Decode(m); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Get(); err == nil || err.Error() != "some error" || m.Error.Code != cmdkit.ErrClient {
+		t.Errorf("expected the error, got %v", err)
+	}
+}
@@ -0,0 +1,231 @@
+package cmds
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CommandMetrics are the throughput metrics of a command, recorded by the
+// emitter returned by NewInstrumentedEmitter.
+type CommandMetrics struct {
+	// Path is the path of the command.
+	Path []string
+	// Emitted is the number of values emitted.
+	Emitted uint64
+	// Bytes is the number of bytes written. The instrumented emitter counts
+	// the data of io.Reader and []byte values, frontends such as the HTTP
+	// handler count all bytes written to the wire.
+	Bytes uint64
+	// TimeToFirstValue is the time from the start of the command until the
+	// first value was emitted, 0 if no value was emitted.
+	TimeToFirstValue time.Duration
+	// Duration is the time from the start of the command until the emitter
+	// was closed.
+	Duration time.Duration
+	// Err is the error the emitter was closed with.
+	Err error
+}
+
+// MetricsCollector receives the metrics of every command run with an
+// instrumented emitter, e.g. to export them to a monitoring system.
+type MetricsCollector interface {
+	Collect(CommandMetrics)
+}
+
+// MetricsCollectorFunc adapts a function to a MetricsCollector.
+type MetricsCollectorFunc func(CommandMetrics)
+
+// Collect calls f(m).
+func (f MetricsCollectorFunc) Collect(m CommandMetrics) {
+	f(m)
+}
+
+// StartCollector is a MetricsCollector that is also told when commands
+// start, e.g. to count the commands in flight. Every call of Start is
+// followed by a call of Collect with the metrics of the same command.
+type StartCollector interface {
+	MetricsCollector
+	Start(path []string)
+}
+
+// InstrumentMiddleware returns a Middleware recording the metrics of the
+// commands executed with an instrumented emitter passing them to c.
+// Commands failing before they run, e.g. on their arguments or in PreRun,
+// are collected with the error Execute returns.
+func InstrumentMiddleware(c MetricsCollector) Middleware {
+	return func(next Executor) Executor {
+		return ExecutorFunc(func(req *Request, re ResponseEmitter, env Environment) error {
+			ire := NewInstrumentedEmitter(req, re, c).(*instrumentedEmitter)
+			err := next.Execute(req, ire, env)
+			if err != nil {
+				// the caller closes re with err
+				ire.collect(err)
+			}
+			return err
+		})
+	}
+}
+
+// NewInstrumentedEmitter returns an emitter recording the metrics of the
+// command req addresses while it emits to re. The metrics are passed to c
+// when the emitter is closed. The time is measured from the call of
+// NewInstrumentedEmitter, so it should be called right before Run.
+//
+// io.Readers are wrapped to count the bytes read from them, keeping their
+// Close method if they have one. If c is a StartCollector, it is started
+// right away.
+func NewInstrumentedEmitter(req *Request, re ResponseEmitter, c MetricsCollector) ResponseEmitter {
+	if sc, ok := c.(StartCollector); ok {
+		sc.Start(req.Path)
+	}
+	return &instrumentedEmitter{
+		ResponseEmitter: re,
+		c:               c,
+		path:            req.Path,
+		start:           time.Now(),
+	}
+}
+
+type instrumentedEmitter struct {
+	ResponseEmitter
+	c     MetricsCollector
+	path  []string
+	start time.Time
+
+	emitted uint64
+	bytes   uint64
+	// firstValue is the time to the first value, in nanoseconds plus one so
+	// zero means no value was emitted.
+	firstValue int64
+
+	once sync.Once
+}
+
+func (re *instrumentedEmitter) Emit(v interface{}) error {
+	// channel emission iteration
+	if ch, ok := v.(chan interface{}); ok {
+		v = (<-chan interface{})(ch)
+	}
+	if ch, isChan := v.(<-chan interface{}); isChan {
+		return EmitChan(re, ch)
+	}
+
+	re.markFirstValue()
+	v = re.count(v)
+	err := re.ResponseEmitter.Emit(v)
+	if err == nil {
+		atomic.AddUint64(&re.emitted, 1)
+	}
+	return err
+}
+
+func (re *instrumentedEmitter) EmitAll(vs []interface{}) error {
+	for _, v := range vs {
+		switch v.(type) {
+		case chan interface{}, <-chan interface{}, Single, io.Reader:
+			for _, v := range vs {
+				if err := re.Emit(v); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	re.markFirstValue()
+	for _, v := range vs {
+		re.count(v)
+	}
+	err := EmitAll(re.ResponseEmitter, vs)
+	if err == nil {
+		atomic.AddUint64(&re.emitted, uint64(len(vs)))
+	}
+	return err
+}
+
+func (re *instrumentedEmitter) TryEmit(v interface{}) (bool, error) {
+	re.markFirstValue()
+	ok, err := TryEmit(re.ResponseEmitter, re.count(v))
+	if ok {
+		atomic.AddUint64(&re.emitted, 1)
+	}
+	return ok, err
+}
+
+func (re *instrumentedEmitter) markFirstValue() {
+	atomic.CompareAndSwapInt64(&re.firstValue, 0, int64(time.Since(re.start))+1)
+}
+
+// count adds the size of byte values to the metrics and wraps readers to
+// count the bytes read from them.
+func (re *instrumentedEmitter) count(v interface{}) interface{} {
+	if s, ok := v.(Single); ok {
+		return Single{re.count(s.Value)}
+	}
+
+	switch t := v.(type) {
+	case []byte:
+		atomic.AddUint64(&re.bytes, uint64(len(t)))
+	case io.Reader:
+		cr := countingReader{r: t, n: &re.bytes}
+		if c, ok := t.(io.Closer); ok {
+			return &countingReadCloser{countingReader: cr, c: c}
+		}
+		return &cr
+	}
+	return v
+}
+
+func (re *instrumentedEmitter) Close() error {
+	return re.CloseWithError(nil)
+}
+
+func (re *instrumentedEmitter) CloseWithError(err error) error {
+	closeErr := re.ResponseEmitter.CloseWithError(err)
+	if closeErr == ErrClosingClosedEmitter {
+		return closeErr
+	}
+
+	re.collect(err)
+	return closeErr
+}
+
+// collect passes the metrics to the collector, once.
+func (re *instrumentedEmitter) collect(err error) {
+	re.once.Do(func() {
+		m := CommandMetrics{
+			Path:     re.path,
+			Emitted:  atomic.LoadUint64(&re.emitted),
+			Bytes:    atomic.LoadUint64(&re.bytes),
+			Duration: time.Since(re.start),
+			Err:      err,
+		}
+		if first := atomic.LoadInt64(&re.firstValue); first > 0 {
+			m.TimeToFirstValue = time.Duration(first - 1)
+		}
+		re.c.Collect(m)
+	})
+}
+
+// countingReader adds the number of bytes read from r to n.
+type countingReader struct {
+	r io.Reader
+	n *uint64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	atomic.AddUint64(r.n, uint64(n))
+	return n, err
+}
+
+type countingReadCloser struct {
+	countingReader
+	c io.Closer
+}
+
+func (r *countingReadCloser) Close() error {
+	return r.c.Close()
+}
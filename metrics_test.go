@@ -0,0 +1,141 @@
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInstrumentedEmitter(t *testing.T) {
+	req, err := NewRequest(context.Background(), []string{"test"}, nil, nil, nil, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var metrics []CommandMetrics
+	collect := MetricsCollectorFunc(func(m CommandMetrics) {
+		metrics = append(metrics, m)
+	})
+
+	cre, res := NewChanResponsePair(req)
+	re := NewInstrumentedEmitter(req, cre, collect)
+
+	done := make(chan error)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		re.Emit([]byte("abc"))
+		re.Emit(strings.NewReader("defg"))
+		re.Emit("value")
+		done <- re.CloseWithError(errors.New("failed"))
+	}()
+
+	for {
+		v, err := res.Next()
+		if err != nil {
+			break
+		}
+		if r, ok := v.(interface{ Read([]byte) (int, error) }); ok {
+			ioutil.ReadAll(r)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if re.Close() != ErrClosingClosedEmitter || len(metrics) != 1 {
+		t.Fatalf("expected the metrics to be collected once, got %v", metrics)
+	}
+	m := metrics[0]
+	if strings.Join(m.Path, " ") != "test" || m.Emitted != 3 || m.Bytes != 7 {
+		t.Errorf("unexpected metrics %+v", m)
+	}
+	if m.TimeToFirstValue < 10*time.Millisecond || m.Duration < m.TimeToFirstValue {
+		t.Errorf("unexpected times %+v", m)
+	}
+	if m.Err == nil || m.Err.Error() != "failed" {
+		t.Errorf("expected the error the emitter was closed with, got %v", m.Err)
+	}
+}
+
+type startCollector struct {
+	started, collected []string
+}
+
+func (c *startCollector) Start(path []string) {
+	c.started = append(c.started, strings.Join(path, " "))
+}
+
+func (c *startCollector) Collect(m CommandMetrics) {
+	c.collected = append(c.collected, strings.Join(m.Path, " "))
+}
+
+func TestInstrumentMiddleware(t *testing.T) {
+	req, err := NewRequest(context.Background(), []string{"test"}, nil, nil, nil, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := env(1)
+	c := &startCollector{}
+	x := NewExecutorWithMiddleware(root, InstrumentMiddleware(c))
+
+	var buf bytes.Buffer
+	re, err := NewWriterResponseEmitter(wc{&buf, nopCloser{}}, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := x.Execute(req, re, &env); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(c.started, ",") != "test" || strings.Join(c.collected, ",") != "test" {
+		t.Errorf("expected the command to be started and collected once, got %v and %v", c.started, c.collected)
+	}
+}
+
+func TestInstrumentMiddlewarePreRunError(t *testing.T) {
+	root := &Command{
+		Subcommands: map[string]*Command{
+			"test": &Command{
+				PreRun: func(req *Request, env Environment) error {
+					return theError
+				},
+				Run: func(req *Request, re ResponseEmitter, env Environment) error {
+					t.Error("expected the command not to run")
+					return nil
+				},
+			},
+		},
+	}
+
+	req, err := NewRequest(context.Background(), []string{"test"}, nil, nil, nil, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var metrics []CommandMetrics
+	collect := MetricsCollectorFunc(func(m CommandMetrics) {
+		metrics = append(metrics, m)
+	})
+	x := NewExecutorWithMiddleware(root, InstrumentMiddleware(collect))
+
+	env := env(1)
+	var buf bytes.Buffer
+	re, err := NewWriterResponseEmitter(wc{&buf, nopCloser{}}, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = x.Execute(req, re, &env)
+	if err != theError {
+		t.Fatalf("expected the PreRun error, got %v", err)
+	}
+	re.CloseWithError(err)
+
+	if len(metrics) != 1 || metrics[0].Err != theError {
+		t.Fatalf("expected the command to be collected once with the error, got %+v", metrics)
+	}
+}
@@ -0,0 +1,42 @@
+package cmds
+
+// Middleware wraps an Executor with logic around every command it executes,
+// e.g. logging, metrics, panic recovery or tracing. It returns an Executor
+// that calls next to execute the command.
+type Middleware func(next Executor) Executor
+
+// ExecutorFunc is a function implementing Executor.
+type ExecutorFunc func(req *Request, re ResponseEmitter, env Environment) error
+
+// Execute calls f.
+func (f ExecutorFunc) Execute(req *Request, re ResponseEmitter, env Environment) error {
+	return f(req, re, env)
+}
+
+// NewExecutorWithMiddleware returns an Executor like NewExecutor wrapped
+// in mws. The first middleware is the outermost, it sees the request first
+// and the result last.
+func NewExecutorWithMiddleware(root *Command, mws ...Middleware) Executor {
+	return WithMiddleware(NewExecutor(root), mws...)
+}
+
+// WithMiddleware wraps x in mws, the first middleware being the outermost.
+func WithMiddleware(x Executor, mws ...Middleware) Executor {
+	for i := len(mws) - 1; i >= 0; i-- {
+		x = mws[i](x)
+	}
+	return x
+}
+
+// MakeExecutorWithMiddleware wraps the executors made by makeExecutor in
+// mws, see WithMiddleware. Passed to cli.Run, the middleware wraps the
+// commands whether they run in the process or are sent to a server.
+func MakeExecutorWithMiddleware(makeExecutor MakeExecutor, mws ...Middleware) MakeExecutor {
+	return func(req *Request, env interface{}) (Executor, error) {
+		x, err := makeExecutor(req, env)
+		if err != nil {
+			return nil, err
+		}
+		return WithMiddleware(x, mws...), nil
+	}
+}
@@ -0,0 +1,75 @@
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+)
+
+// tracing returns a middleware appending name to calls before and after it
+// calls the next executor.
+func tracing(name string, calls *[]string) Middleware {
+	return func(next Executor) Executor {
+		return ExecutorFunc(func(req *Request, re ResponseEmitter, env Environment) error {
+			*calls = append(*calls, name)
+			err := next.Execute(req, re, env)
+			*calls = append(*calls, name+" done")
+			return err
+		})
+	}
+}
+
+func TestExecutorWithMiddleware(t *testing.T) {
+	var calls []string
+	x := NewExecutorWithMiddleware(root, tracing("outer", &calls), tracing("inner", &calls))
+
+	env := env(42)
+	req, err := NewRequest(context.Background(), []string{"test"}, nil, nil, nil, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	re, err := NewWriterResponseEmitter(wc{&buf, nopCloser{}}, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := x.Execute(req, re, &env); err != nil {
+		t.Fatal(err)
+	}
+
+	if exp := []string{"outer", "inner", "inner done", "outer done"}; !reflect.DeepEqual(calls, exp) {
+		t.Errorf("expected the calls %v but got %v", exp, calls)
+	}
+	if out := buf.String(); out != "42\n" {
+		t.Errorf("expected output \"42\" but got %q", out)
+	}
+}
+
+func TestMakeExecutorWithMiddleware(t *testing.T) {
+	var calls []string
+	makeExecutor := MakeExecutorWithMiddleware(func(req *Request, env interface{}) (Executor, error) {
+		return NewExecutor(root), nil
+	}, tracing("mw", &calls))
+
+	env := env(42)
+	req, err := NewRequest(context.Background(), []string{"testError"}, nil, nil, nil, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, err := makeExecutor(req, &env)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	re, res := NewChanResponsePair(req)
+	errCh := make(chan error, 1)
+	go func() { errCh <- x.Execute(req, re, &env) }()
+	if _, err := res.Next(); err == nil || err.Error() != theError.Error() {
+		t.Errorf("expected the error of the command, got %v", err)
+	}
+	<-errCh
+	if exp := []string{"mw", "mw done"}; !reflect.DeepEqual(calls, exp) {
+		t.Errorf("expected the calls %v but got %v", exp, calls)
+	}
+}
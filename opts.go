@@ -11,13 +11,43 @@ const (
 	RecShort     = "r"
 	RecLong      = "recursive"
 	ChanOpt      = "stream-channels"
+	BufferOpt    = "buffer-response"
 	TimeoutOpt   = "timeout"
+	WidthOpt     = "width"
+	LangOpt      = "lang"
+	ProfileOpt   = "profile"
+	StatsOpt     = "stats"
+	ResumeOpt    = "resume-after"
+	CompressOpt  = "compression"
+	PostRunOpt   = "post-run"
+	XMLRootOpt   = "xml-root"
+	ValidateOpt  = "validate-only"
+	FormatOpt    = "format"
+	NoHeaderOpt  = "no-header"
+	LimitOpt     = "limit"
+	OffsetOpt    = "offset"
+	CursorOpt    = "cursor"
 	OptShortHelp = "h"
 	OptLongHelp  = "help"
 )
 
 // options that are used by this package
-var OptionEncodingType = cmdkit.StringOption(EncLong, EncShort, "The encoding type the output should be encoded with (json, xml, or text)").WithDefault("text")
+var OptionEncodingType = cmdkit.StringOption(EncLong, EncShort, "The encoding type the output should be encoded with (json, xml, cbor, or text)").WithDefault("text")
 var OptionRecursivePath = cmdkit.BoolOption(RecLong, RecShort, "Add directory paths recursively").WithDefault(false)
 var OptionStreamChannels = cmdkit.BoolOption(ChanOpt, "Stream channel output")
+var OptionBufferResponse = cmdkit.BoolOption(BufferOpt, "Send the whole HTTP response at once instead of streaming it")
 var OptionTimeout = cmdkit.StringOption(TimeoutOpt, "set a global timeout on the command")
+var OptionWidth = cmdkit.IntOption(WidthOpt, "Wrap help text and fit tables into the given number of columns instead of the terminal width (0 disables wrapping)")
+var OptionLang = cmdkit.StringOption(LangOpt, "The language of help text and error messages, e.g. de or pt_BR (defaults to $LANG)")
+var OptionProfile = cmdkit.StringOption(ProfileOpt, "Apply the option values of the named profile from the user config")
+var OptionResume = cmdkit.StringOption(ResumeOpt, "Resume a subscription after the value with the given resume token")
+var OptionCompression = cmdkit.StringOption(CompressOpt, "Compress the output with the first supported of the given comma-separated compressions, e.g. gzip")
+var OptionPostRun = cmdkit.StringOption(PostRunOpt, "Apply the PostRun of the given type, e.g. cli, on the server, for clients without the command tree")
+var OptionXMLRoot = cmdkit.StringOption(XMLRootOpt, "Wrap XML output in a root element with the given name, making streamed output a single document")
+var OptionValidate = cmdkit.BoolOption(ValidateOpt, "Only validate the request and report the problems found instead of running the command")
+var OptionFormat = cmdkit.StringOption(FormatOpt, "Print every value of the text output with the given Go template, e.g. '{{.Name}}'")
+var OptionNoHeader = cmdkit.BoolOption(NoHeaderOpt, "Omit the header of tables in the text output")
+var OptionLimit = cmdkit.IntOption(LimitOpt, "Emit at most the given number of values of paginated commands")
+var OptionOffset = cmdkit.IntOption(OffsetOpt, "Skip the given number of values of paginated commands")
+var OptionCursor = cmdkit.StringOption(CursorOpt, "Continue a paginated command with the page the given cursor was returned for")
+var OptionStats = cmdkit.BoolOption(StatsOpt, "Print execution statistics (time, values emitted, bytes transferred) after the command finished")
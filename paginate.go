@@ -0,0 +1,322 @@
+package cmds
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+)
+
+// ErrPageEnd is returned by Emit once a paginated command emitted the last
+// value of the requested page, see Command.Paginated. Commands return it
+// like any other error of Emit, it isn't reported to the client.
+var ErrPageEnd = errors.New("the page is complete")
+
+// Page is the range of the values of a paginated command a request asks for
+// with the LimitOpt, OffsetOpt and CursorOpt options.
+type Page struct {
+	// Offset is the number of values skipped.
+	Offset int
+	// Limit is the maximum number of values emitted, zero if unlimited.
+	Limit int
+}
+
+// Next returns the page following p.
+func (p Page) Next() Page {
+	return Page{Offset: p.Offset + p.Limit, Limit: p.Limit}
+}
+
+// Cursor returns the token continuing a paginated command with p. Tokens
+// are opaque to clients, which pass them in the CursorOpt option.
+func (p Page) Cursor() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", p.Offset, p.Limit)))
+}
+
+// ParseCursor returns the page of a token returned by Page.Cursor.
+func ParseCursor(cursor string) (Page, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil {
+		parts := strings.Split(string(b), ":")
+		if len(parts) == 2 {
+			var p Page
+			p.Offset, err = strconv.Atoi(parts[0])
+			if err == nil {
+				p.Limit, err = strconv.Atoi(parts[1])
+			}
+			if err == nil && p.Offset >= 0 && p.Limit >= 0 {
+				return p, nil
+			}
+		}
+	}
+	return Page{}, cmdkit.Errorf(cmdkit.ErrClient, "invalid --%s %q", CursorOpt, cursor)
+}
+
+// PageOf returns the page req asks for. The limit of the CursorOpt option
+// is replaced by the LimitOpt option if both are set, and the CursorOpt and
+// OffsetOpt options are mutually exclusive.
+func PageOf(req *Request) (Page, error) {
+	var p Page
+
+	cursor, _ := req.Options[CursorOpt].(string)
+	if cursor != "" {
+		if _, ok := req.Options[OffsetOpt]; ok {
+			return Page{}, cmdkit.Errorf(cmdkit.ErrClient, "--%s and --%s can't be used together", CursorOpt, OffsetOpt)
+		}
+
+		var err error
+		p, err = ParseCursor(cursor)
+		if err != nil {
+			return Page{}, err
+		}
+	}
+
+	for _, opt := range []struct {
+		name string
+		v    *int
+	}{{LimitOpt, &p.Limit}, {OffsetOpt, &p.Offset}} {
+		var err error
+		switch v := req.Options[opt.name].(type) {
+		case nil:
+			continue
+		case int:
+			*opt.v = v
+		case string:
+			// sent over HTTP to servers that don't define the option
+			*opt.v, err = strconv.Atoi(v)
+		default:
+			err = fmt.Errorf("unexpected type %T", v)
+		}
+		if err != nil || *opt.v < 0 {
+			return Page{}, cmdkit.Errorf(cmdkit.ErrClient, "invalid --%s: expected a non-negative number", opt.name)
+		}
+	}
+
+	return p, nil
+}
+
+// PageResult holds the cursor of the page following the one a paginated
+// command emitted. Frontends attach it to the request context with
+// ContextWithPageResult and pass the cursor on to the client once the
+// command returned.
+type PageResult struct {
+	l    sync.Mutex
+	next string
+}
+
+type pageResultKey struct{}
+
+// ContextWithPageResult returns a context carrying a new PageResult.
+func ContextWithPageResult(ctx context.Context) (context.Context, *PageResult) {
+	r := &PageResult{}
+	return context.WithValue(ctx, pageResultKey{}, r), r
+}
+
+// PageResultFromContext returns the PageResult attached to ctx, or nil if
+// there is none. All methods of PageResult can be called on nil.
+func PageResultFromContext(ctx context.Context) *PageResult {
+	if ctx == nil {
+		return nil
+	}
+
+	r, _ := ctx.Value(pageResultKey{}).(*PageResult)
+	return r
+}
+
+// NextCursor returns the cursor of the next page, or "" if the command
+// emitted the last page.
+func (r *PageResult) NextCursor() string {
+	if r == nil {
+		return ""
+	}
+
+	r.l.Lock()
+	defer r.l.Unlock()
+	return r.next
+}
+
+// SetNextCursor sets the cursor of the next page, e.g. once a client
+// received it from the server.
+func (r *PageResult) SetNextCursor(cursor string) {
+	if r == nil {
+		return
+	}
+
+	r.l.Lock()
+	defer r.l.Unlock()
+	r.next = cursor
+}
+
+// NextCursor returns the cursor of the page following the one res holds,
+// or "" if res holds the last page or doesn't report cursors. Responses
+// received over HTTP report the cursor once all values were read.
+func NextCursor(res Response) string {
+	if c, ok := res.(interface {
+		NextCursor() string
+	}); ok {
+		return c.NextCursor()
+	}
+	return ""
+}
+
+// requestPage returns the page req asks for, or nil if the command isn't
+// paginated.
+func requestPage(req *Request) (*Page, error) {
+	if req.Command == nil || !req.Command.Paginated {
+		return nil, nil
+	}
+
+	page, err := PageOf(req)
+	if err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// paginate returns the emitter applying page to the values emitted to re,
+// or re if page is nil. The error returned by Run must be passed through
+// pageEndErr.
+func paginate(req *Request, re ResponseEmitter, page *Page) ResponseEmitter {
+	if page == nil {
+		return re
+	}
+
+	res := PageResultFromContext(req.Context)
+	if res == nil {
+		req.Context, res = ContextWithPageResult(req.Context)
+	}
+	return &pageEmitter{ResponseEmitter: re, page: *page, res: res}
+}
+
+// pageEndErr maps ErrPageEnd to nil.
+func pageEndErr(err error) error {
+	if errors.Is(err, ErrPageEnd) {
+		return nil
+	}
+	return err
+}
+
+// pageEmitter skips the values before the page and ends the page after its
+// limit. Once the command emits a value past the limit, the cursor of the
+// next page is set. Progress and errors aren't values of the page, they are
+// passed through without counting them.
+type pageEmitter struct {
+	ResponseEmitter
+	page Page
+	res  *PageResult
+
+	l sync.Mutex
+	// n counts the values emitted by the command.
+	n int
+}
+
+// window returns how many of count values emitted next are skipped and
+// sent, and whether the page ended.
+func (re *pageEmitter) window(count int) (skip, send int, end bool) {
+	re.l.Lock()
+	defer re.l.Unlock()
+
+	for i := 0; i < count; i++ {
+		if re.page.Limit > 0 && re.n >= re.page.Offset+re.page.Limit {
+			re.res.SetNextCursor(re.page.Next().Cursor())
+			return skip, send, true
+		}
+		if re.n < re.page.Offset {
+			skip++
+		} else {
+			send++
+		}
+		re.n++
+	}
+	return skip, send, false
+}
+
+func (re *pageEmitter) Emit(v interface{}) error {
+	// channel emission iteration
+	if ch, ok := v.(chan interface{}); ok {
+		v = (<-chan interface{})(ch)
+	}
+	if ch, isChan := v.(<-chan interface{}); isChan {
+		err := EmitChan(re, ch)
+		if err == ErrPageEnd {
+			// don't leave the producer blocked on the rest
+			go drainChan(ch)
+		}
+		return err
+	}
+	if uncounted(v) {
+		return re.ResponseEmitter.Emit(v)
+	}
+
+	_, send, end := re.window(1)
+	if end {
+		CloseReader(v)
+		return ErrPageEnd
+	}
+	if send == 0 {
+		CloseReader(v)
+		return nil
+	}
+	return re.ResponseEmitter.Emit(v)
+}
+
+func (re *pageEmitter) EmitAll(vs []interface{}) error {
+	for _, v := range vs {
+		switch v.(type) {
+		case chan interface{}, <-chan interface{}, *Progress, error:
+			for _, v := range vs {
+				if err := re.Emit(v); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	skip, send, end := re.window(len(vs))
+	for _, v := range vs[:skip] {
+		CloseReader(v)
+	}
+	for _, v := range vs[skip+send:] {
+		CloseReader(v)
+	}
+	if send > 0 {
+		if err := EmitAll(re.ResponseEmitter, vs[skip:skip+send]); err != nil {
+			return err
+		}
+	}
+	if end {
+		return ErrPageEnd
+	}
+	return nil
+}
+
+// uncounted returns whether v reports on the command instead of being one
+// of its values.
+func uncounted(v interface{}) bool {
+	switch v.(type) {
+	case *Progress, error:
+		return true
+	}
+	return false
+}
+
+// drainChan receives the values left in ch until it's closed, closing the
+// readers among them.
+func drainChan(ch <-chan interface{}) {
+	for v := range ch {
+		CloseReader(v)
+	}
+}
+
+func (re *pageEmitter) Close() error {
+	return re.CloseWithError(nil)
+}
+
+func (re *pageEmitter) CloseWithError(err error) error {
+	return re.ResponseEmitter.CloseWithError(pageEndErr(err))
+}
@@ -0,0 +1,163 @@
+package cmds
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// numbersCmd emits the numbers up to 9, the first five of them in a batch.
+var numbersCmd = &Command{
+	Paginated: true,
+	Run: func(req *Request, re ResponseEmitter, env Environment) error {
+		if err := EmitAll(re, []interface{}{0, 1, 2, 3, 4}); err != nil {
+			return err
+		}
+		for i := 5; i < 10; i++ {
+			if err := re.Emit(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+func TestPaginate(t *testing.T) {
+	root := &Command{Subcommands: map[string]*Command{"numbers": numbersCmd}}
+
+	tcs := []struct {
+		opts     map[string]interface{}
+		values   []interface{}
+		next     *Page
+		executor bool
+	}{
+		{opts: nil, values: []interface{}{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{opts: map[string]interface{}{LimitOpt: 3}, values: []interface{}{0, 1, 2}, next: &Page{Offset: 3, Limit: 3}},
+		{opts: map[string]interface{}{LimitOpt: 4, OffsetOpt: 3}, values: []interface{}{3, 4, 5, 6}, next: &Page{Offset: 7, Limit: 4}},
+		{opts: map[string]interface{}{LimitOpt: "2", OffsetOpt: "6"}, values: []interface{}{6, 7}, next: &Page{Offset: 8, Limit: 2}, executor: true},
+		{opts: map[string]interface{}{CursorOpt: Page{Offset: 8, Limit: 2}.Cursor()}, values: []interface{}{8, 9}},
+		{opts: map[string]interface{}{CursorOpt: Page{Offset: 8, Limit: 2}.Cursor(), LimitOpt: 1}, values: []interface{}{8}, next: &Page{Offset: 9, Limit: 1}},
+		{opts: map[string]interface{}{OffsetOpt: 12}, values: nil},
+	}
+
+	for _, tc := range tcs {
+		req, err := NewRequest(context.Background(), []string{"numbers"}, tc.opts, nil, nil, root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var page *PageResult
+		req.Context, page = ContextWithPageResult(req.Context)
+
+		re, res := NewChanResponsePair(req)
+		go func() {
+			if tc.executor {
+				env := env(1)
+				NewExecutor(root).Execute(req, re, &env)
+			} else {
+				root.Call(req, re, nil)
+			}
+		}()
+
+		var values []interface{}
+		for {
+			v, err := res.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%v: unexpected error: %s", tc.opts, err)
+			}
+			values = append(values, v)
+		}
+
+		if !reflect.DeepEqual(values, tc.values) {
+			t.Errorf("%v: expected values %v, got %v", tc.opts, tc.values, values)
+		}
+		expected := ""
+		if tc.next != nil {
+			expected = tc.next.Cursor()
+		}
+		if cursor := page.NextCursor(); cursor != expected {
+			t.Errorf("%v: expected cursor %q, got %q", tc.opts, expected, cursor)
+		}
+	}
+}
+
+func TestPaginateUncounted(t *testing.T) {
+	produced := make(chan struct{})
+	root := &Command{Subcommands: map[string]*Command{"numbers": {
+		Paginated: true,
+		Run: func(req *Request, re ResponseEmitter, env Environment) error {
+			if err := EmitAll(re, []interface{}{&Progress{Current: 0}, 0}); err != nil {
+				return err
+			}
+
+			ch := make(chan interface{})
+			go func() {
+				defer close(produced)
+				defer close(ch)
+				for i := 1; i < 10; i++ {
+					ch <- &Progress{Current: uint64(i)}
+					ch <- i
+				}
+			}()
+			return re.Emit(ch)
+		},
+	}}}
+
+	req, err := NewRequest(context.Background(), []string{"numbers"}, map[string]interface{}{LimitOpt: 2, OffsetOpt: 1}, nil, nil, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	re, res := NewChanResponsePair(req)
+	go root.Call(req, re, nil)
+
+	var values []interface{}
+	for {
+		v, err := res.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		values = append(values, v)
+	}
+
+	expected := []interface{}{&Progress{Current: 0}, &Progress{Current: 1}, 1, &Progress{Current: 2}, 2, &Progress{Current: 3}}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("expected the progress to be passed through in %v, got %v", expected, values)
+	}
+	select {
+	case <-produced:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the producer of the channel was left blocked")
+	}
+}
+
+func TestPageOfInvalid(t *testing.T) {
+	root := &Command{Subcommands: map[string]*Command{"numbers": numbersCmd}}
+
+	for _, opts := range []map[string]interface{}{
+		{LimitOpt: -1},
+		{OffsetOpt: "many"},
+		{CursorOpt: "garbage"},
+		{CursorOpt: Page{Limit: 2}.Cursor(), OffsetOpt: 1},
+	} {
+		req, err := NewRequest(context.Background(), []string{"numbers"}, opts, nil, nil, root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := PageOf(req); err == nil {
+			t.Errorf("%v: expected an error", opts)
+		}
+
+		re, res := NewChanResponsePair(req)
+		go root.Call(req, re, nil)
+		if _, err := res.Next(); err == nil || err == io.EOF {
+			t.Errorf("%v: expected the request to fail, got %v", opts, err)
+		}
+	}
+}
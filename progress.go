@@ -0,0 +1,61 @@
+package cmds
+
+import (
+	"encoding/xml"
+)
+
+// Progress reports the progress of a long-running command. Commands emit
+// it like any other value, see EmitProgress, interleaved with their output.
+//
+// Emitters keep progress apart from the output: the CLI renders it as a
+// progress bar on stderr, and emitters encoding values send it tagged with
+// ProgressValueType, so responses decoding the values return it as a
+// *Progress instead of decoding it into the Type of the command. Where it
+// can't be told apart from the output, i.e. with text encodings, encoders of
+// the command and the raw output of readers over HTTP, it is dropped. Over
+// HTTP, a response starting with a Progress is a stream of values, so
+// commands whose output is a reader mustn't report progress before it.
+type Progress struct {
+	// Current is the amount of work done so far.
+	Current uint64
+	// Total is the amount of work to do, zero if it is unknown.
+	Total uint64 `json:",omitempty"`
+	// Message, if set, describes the current step.
+	Message string `json:",omitempty"`
+}
+
+// ProgressValueType is the ValueType of Progress values on the wire. It is
+// reserved, Command.Types must not use it.
+const ProgressValueType = "cmds.Progress"
+
+// EmitProgress emits a Progress of current out of total, zero if unknown,
+// with the optional message msg.
+func EmitProgress(re ResponseEmitter, current, total uint64, msg string) error {
+	return re.Emit(&Progress{Current: current, Total: total, Message: msg})
+}
+
+// progressFrame is the tagged value p is encoded as.
+type progressFrame struct {
+	XMLName   xml.Name `xml:"cmds.Progress" json:"-"`
+	ValueType string
+	Value     *Progress
+}
+
+// TagProgress returns the value an emitter encoding values with encType
+// should encode for p, and false if p should be dropped because responses
+// can't tell it apart from the output.
+func TagProgress(req *Request, encType EncodingType, p *Progress) (interface{}, bool) {
+	if _, ok := Decoders[encType]; !ok {
+		return nil, false
+	}
+	if req.Command != nil {
+		if _, ok := req.Command.Encoders[encType]; ok {
+			// custom encoders expect the values of the command
+			return nil, false
+		}
+	}
+	if hasTypedEncoder(req, encType, p) {
+		return nil, false
+	}
+	return &progressFrame{ValueType: ProgressValueType, Value: p}, true
+}
@@ -0,0 +1,90 @@
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+)
+
+func TestProgress(t *testing.T) {
+	cmds := map[string]*Command{
+		"type":  {Type: &result{}},
+		"types": {Types: map[string]interface{}{"result": &result{}}},
+	}
+
+	for name, cmd := range cmds {
+		for _, enc := range []EncodingType{JSON, XML, CBOR} {
+			req, err := NewRequest(context.Background(), nil, map[string]interface{}{EncLong: string(enc)}, nil, nil, cmd)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			re, err := NewWriterResponseEmitter(wc{&buf, nopCloser{}}, req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := EmitProgress(re, 1, 2, "adding"); err != nil {
+				t.Fatal(err)
+			}
+			if err := re.Emit(&result{"Qm"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := EmitProgress(re, 2, 0, ""); err != nil {
+				t.Fatal(err)
+			}
+			re.Close()
+
+			res, err := NewReaderResponse(&buf, req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var values []interface{}
+			for {
+				v, err := res.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("%s/%s: %s", name, enc, err)
+				}
+				values = append(values, v)
+			}
+
+			if len(values) != 3 {
+				t.Fatalf("%s/%s: expected 3 values but got %v", name, enc, values)
+			}
+			if p, ok := values[0].(*Progress); !ok || *p != (Progress{1, 2, "adding"}) {
+				t.Errorf("%s/%s: expected the first progress, got %#v", name, enc, values[0])
+			}
+			if r, ok := values[1].(*result); !ok || r.Hash != "Qm" {
+				t.Errorf("%s/%s: expected the result value, got %#v", name, enc, values[1])
+			}
+			if p, ok := values[2].(*Progress); !ok || *p != (Progress{Current: 2}) {
+				t.Errorf("%s/%s: expected the second progress, got %#v", name, enc, values[2])
+			}
+		}
+	}
+}
+
+func TestTagProgress(t *testing.T) {
+	p := &Progress{Current: 1}
+
+	req, err := NewRequest(context.Background(), nil, nil, nil, nil, &Command{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := TagProgress(req, Text, p); ok {
+		t.Error("expected progress to be dropped for text")
+	}
+	if _, ok := TagProgress(req, JSON, p); !ok {
+		t.Error("expected progress to be sent for JSON")
+	}
+
+	req.Command.Encoders = EncoderMap{JSON: Encoders[JSON]}
+	if _, ok := TagProgress(req, JSON, p); ok {
+		t.Error("expected progress to be dropped for encoders of the command")
+	}
+}
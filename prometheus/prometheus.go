@@ -0,0 +1,179 @@
+/*
+Package prometheus exports the metrics of commands to Prometheus. A
+Collector counts the requests, the requests in flight, the values emitted
+and the errors of every command and records the latency of the commands in
+a histogram, labelled by the path of the command:
+
+	c := prometheus.New(prometheus.Options{Namespace: "ipfs"})
+	registry.MustRegister(c)
+
+	// in the HTTP handler
+	cfg.Metrics = c.Commands()
+	// around an Executor
+	x = cmds.WithMiddleware(x, c.Middleware())
+
+The error rate of a command is the rate of its errors over the rate of its
+requests.
+*/
+package prometheus
+
+import (
+	"context"
+	"strings"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultNamespace is the namespace of the metrics if none is set.
+const DefaultNamespace = "cmds"
+
+// Options configures a Collector.
+type Options struct {
+	// Namespace prefixes the names of the metrics, it defaults to
+	// DefaultNamespace.
+	Namespace string
+	// Buckets are the buckets of the latency histogram in seconds, they
+	// default to prom.DefBuckets.
+	Buckets []float64
+}
+
+// Collector is a prom.Collector of the metrics of the commands it is passed
+// as cmds.MetricsCollector, see Commands and Middleware. Metrics are
+// labelled with the path of the command, joined by spaces, and errors with
+// the type of the error, see ErrorType.
+type Collector struct {
+	requests *prom.CounterVec
+	inFlight *prom.GaugeVec
+	duration *prom.HistogramVec
+	emitted  *prom.CounterVec
+	errors   *prom.CounterVec
+}
+
+// New returns a Collector configured by opts.
+func New(opts Options) *Collector {
+	ns := opts.Namespace
+	if ns == "" {
+		ns = DefaultNamespace
+	}
+	buckets := opts.Buckets
+	if buckets == nil {
+		buckets = prom.DefBuckets
+	}
+
+	return &Collector{
+		requests: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: ns,
+			Name:      "requests_total",
+			Help:      "Number of command requests served.",
+		}, []string{"command"}),
+		inFlight: prom.NewGaugeVec(prom.GaugeOpts{
+			Namespace: ns,
+			Name:      "requests_in_flight",
+			Help:      "Number of command requests being served.",
+		}, []string{"command"}),
+		duration: prom.NewHistogramVec(prom.HistogramOpts{
+			Namespace: ns,
+			Name:      "request_duration_seconds",
+			Help:      "Time from the start of a command until its response was closed.",
+			Buckets:   buckets,
+		}, []string{"command"}),
+		emitted: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: ns,
+			Name:      "emitted_values_total",
+			Help:      "Number of values emitted by commands.",
+		}, []string{"command"}),
+		errors: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: ns,
+			Name:      "errors_total",
+			Help:      "Number of command requests that failed, by type of error.",
+		}, []string{"command", "type"}),
+	}
+}
+
+// Describe implements prom.Collector.
+func (c *Collector) Describe(ch chan<- *prom.Desc) {
+	c.requests.Describe(ch)
+	c.inFlight.Describe(ch)
+	c.duration.Describe(ch)
+	c.emitted.Describe(ch)
+	c.errors.Describe(ch)
+}
+
+// Collect implements prom.Collector.
+func (c *Collector) Collect(ch chan<- prom.Metric) {
+	c.requests.Collect(ch)
+	c.inFlight.Collect(ch)
+	c.duration.Collect(ch)
+	c.emitted.Collect(ch)
+	c.errors.Collect(ch)
+}
+
+// Commands returns the cmds.MetricsCollector recording the metrics, e.g.
+// for the Metrics of the HTTP handler's ServerConfig. It counts a command
+// in flight from its start until its emitter is closed.
+func (c *Collector) Commands() cmds.StartCollector {
+	return (*commandCollector)(c)
+}
+
+// Middleware returns a cmds.Middleware recording the metrics of the
+// commands run by an Executor, see cmds.InstrumentMiddleware.
+func (c *Collector) Middleware() cmds.Middleware {
+	return cmds.InstrumentMiddleware(c.Commands())
+}
+
+type commandCollector Collector
+
+func (c *commandCollector) Start(path []string) {
+	c.inFlight.WithLabelValues(commandLabel(path)).Inc()
+}
+
+func (c *commandCollector) Collect(m cmds.CommandMetrics) {
+	cmd := commandLabel(m.Path)
+	c.inFlight.WithLabelValues(cmd).Dec()
+	c.requests.WithLabelValues(cmd).Inc()
+	c.duration.WithLabelValues(cmd).Observe(m.Duration.Seconds())
+	c.emitted.WithLabelValues(cmd).Add(float64(m.Emitted))
+	if m.Err != nil {
+		c.errors.WithLabelValues(cmd, ErrorType(m.Err)).Inc()
+	}
+}
+
+func commandLabel(path []string) string {
+	return strings.Join(path, " ")
+}
+
+// errorTypes names the types of cmdkit.Errors.
+var errorTypes = map[cmdkit.ErrorType]string{
+	cmdkit.ErrNormal:         "normal",
+	cmdkit.ErrClient:         "client",
+	cmdkit.ErrImplementation: "implementation",
+	cmdkit.ErrNotFound:       "not_found",
+	cmdkit.ErrFatal:          "fatal",
+}
+
+// ErrorType returns the label of the type of err: "canceled" for canceled
+// commands, the type of cmdkit.Errors and cmds.CodedErrors, such as "client"
+// or "not_found", and "normal" for other errors.
+func ErrorType(err error) string {
+	typ := cmdkit.ErrNormal
+	switch e := err.(type) {
+	case *cmdkit.Error:
+		typ = e.Code
+	case cmdkit.Error:
+		typ = e.Code
+	case *cmds.CodedError:
+		typ = e.Type
+	default:
+		if err == context.Canceled || err == context.DeadlineExceeded {
+			return "canceled"
+		}
+	}
+
+	if name, ok := errorTypes[typ]; ok {
+		return name
+	}
+	return "normal"
+}
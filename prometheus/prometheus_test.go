@@ -0,0 +1,96 @@
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type testEnv struct{}
+
+func (testEnv) Context() context.Context { return context.Background() }
+
+func TestCollector(t *testing.T) {
+	c := New(Options{})
+
+	var inFlight float64
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"ls": {
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					inFlight = testutil.ToFloat64(c.inFlight.WithLabelValues("ls"))
+					re.Emit("a")
+					return re.Emit("b")
+				},
+			},
+			"get": {
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					return cmds.NotFoundError("no such thing")
+				},
+			},
+		},
+	}
+	x := cmds.NewExecutorWithMiddleware(root, c.Middleware())
+
+	run := func(path string) {
+		req, err := cmds.NewRequest(context.Background(), []string{path}, nil, nil, nil, root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		re, res := cmds.NewChanResponsePair(req)
+		go x.Execute(req, re, testEnv{})
+		for {
+			if _, err := res.Next(); err != nil {
+				break
+			}
+		}
+	}
+	run("ls")
+	run("ls")
+	run("get")
+
+	if inFlight != 1 {
+		t.Errorf("expected 1 request in flight while running, got %v", inFlight)
+	}
+	for _, tc := range []struct {
+		name     string
+		value    float64
+		expected float64
+	}{
+		{"ls requests", testutil.ToFloat64(c.requests.WithLabelValues("ls")), 2},
+		{"ls in flight", testutil.ToFloat64(c.inFlight.WithLabelValues("ls")), 0},
+		{"ls emitted", testutil.ToFloat64(c.emitted.WithLabelValues("ls")), 4},
+		{"get requests", testutil.ToFloat64(c.requests.WithLabelValues("get")), 1},
+		{"get errors", testutil.ToFloat64(c.errors.WithLabelValues("get", "not_found")), 1},
+	} {
+		if tc.value != tc.expected {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, tc.value)
+		}
+	}
+
+	if n := testutil.CollectAndCount(c); n != 9 {
+		t.Errorf("expected 9 metrics, got %d", n)
+	}
+}
+
+func TestErrorType(t *testing.T) {
+	for _, tc := range []struct {
+		err      error
+		expected string
+	}{
+		{errors.New("failed"), "normal"},
+		{context.Canceled, "canceled"},
+		{&cmdkit.Error{Message: "bad", Code: cmdkit.ErrClient}, "client"},
+		{cmdkit.Error{Message: "bug", Code: cmdkit.ErrImplementation}, "implementation"},
+		{cmds.PermissionDeniedError("denied"), "client"},
+	} {
+		if typ := ErrorType(tc.err); typ != tc.expected {
+			t.Errorf("%v: expected type %q, got %q", tc.err, tc.expected, typ)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package cmds
+
+import "io"
+
+// Emitted io.Readers that are also io.Closers, e.g. files or the bodies of
+// HTTP responses, are owned by the emitter they are passed to. Emitters that
+// write the data out, like the CLI and HTTP emitters, close the reader once
+// it was copied, whether or not the copy succeeded. All emitters close it if
+// the value can't be emitted, e.g. because the emitter was closed or the
+// request was canceled. Emitters that hand values on to a consumer, like the
+// ones returned by NewChanResponsePair, pass the reader on with the value,
+// and the consumer of the response has to close it, which Copy does by
+// emitting it to another emitter.
+//
+// TryEmit calls that return false without an error leave the value with the
+// caller.
+
+// CloseReader closes v if it is an io.Reader that is also an io.Closer.
+// Single values and the data of Attachments are closed, too. Emitters call
+// it with the values they consumed or couldn't emit.
+func CloseReader(v interface{}) error {
+	if s, ok := v.(Single); ok {
+		v = s.Value
+	}
+	if att, ok := v.(Attachment); ok {
+		v = att.Data
+	}
+
+	if _, ok := v.(io.Reader); !ok {
+		return nil
+	}
+	if c, ok := v.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package cmds
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+type trackedReader struct {
+	*strings.Reader
+	closed bool
+}
+
+func (r *trackedReader) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestChanEmitterReadCloser(t *testing.T) {
+	newPair := func(ctx context.Context) (ResponseEmitter, Response) {
+		req, err := NewRequest(ctx, nil, nil, nil, nil, &Command{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		re, res := NewChanResponsePair(req)
+		return re, res
+	}
+
+	// delivered readers are owned by the consumer
+	re, res := newPair(context.Background())
+	r := &trackedReader{Reader: strings.NewReader("data")}
+	go re.Emit(r)
+	if v, err := res.Next(); err != nil || v != r {
+		t.Fatalf("expected the reader, got %v, %v", v, err)
+	}
+	if r.closed {
+		t.Error("expected the delivered reader to be left open")
+	}
+
+	// readers emitted after close are closed
+	re.Close()
+	r = &trackedReader{Reader: strings.NewReader("data")}
+	if err := re.Emit(Single{r}); err != ErrClosedEmitter {
+		t.Fatalf("expected %v but got %v", ErrClosedEmitter, err)
+	}
+	if !r.closed {
+		t.Error("expected the reader emitted after close to be closed")
+	}
+
+	// readers that can't be delivered before cancelation are closed
+	ctx, cancel := context.WithCancel(context.Background())
+	re, _ = newPair(ctx)
+	cancel()
+	r = &trackedReader{Reader: strings.NewReader("data")}
+	if err := re.Emit(r); err != context.Canceled {
+		t.Fatalf("expected %v but got %v", context.Canceled, err)
+	}
+	if !r.closed {
+		t.Error("expected the reader of the canceled request to be closed")
+	}
+}
+
+func TestCloseReader(t *testing.T) {
+	r := &trackedReader{Reader: strings.NewReader("data")}
+	CloseReader(Attachment{Value: "meta", Data: r})
+	if !r.closed {
+		t.Error("expected the attachment data to be closed")
+	}
+
+	if err := CloseReader("not a reader"); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
@@ -0,0 +1,226 @@
+package cmds
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// EncoderRegistry holds encoders for pairs of an EncodingType and the type
+// of the values they encode, e.g. a CSV encoder for the entries of a
+// listing. Emitters encode each value with the encoder registered for its
+// type and encode values of other types as they would without the
+// registry, so applications can add encodings like YAML for some of the
+// values without replacing the encoders of the others.
+//
+// Encoders are looked up in Command.TypedEncoders, then in the encoders of
+// the command in Command.Encoders, then in DefaultEncoders. A nil
+// *EncoderRegistry has no encoders.
+type EncoderRegistry struct {
+	l        sync.RWMutex
+	encoders map[EncodingType]map[reflect.Type]EncoderFunc
+}
+
+// DefaultEncoders is the registry consulted for the values of all commands
+// without an encoder of their own for the encoding.
+var DefaultEncoders = NewEncoderRegistry()
+
+// NewEncoderRegistry returns an empty EncoderRegistry.
+func NewEncoderRegistry() *EncoderRegistry {
+	return &EncoderRegistry{encoders: make(map[EncodingType]map[reflect.Type]EncoderFunc)}
+}
+
+// Register makes fn encode the values of the type of typ, a value like
+// Command.Type, with encType, replacing the encoder registered before.
+// Values and pointers to values of the type share the encoder. A nil typ
+// registers the encoder of the values of all other types, which lets
+// registries add encodings Encoders doesn't have.
+func (r *EncoderRegistry) Register(encType EncodingType, typ interface{}, fn EncoderFunc) {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	encs, ok := r.encoders[encType]
+	if !ok {
+		encs = make(map[reflect.Type]EncoderFunc)
+		r.encoders[encType] = encs
+	}
+	encs[derefType(reflect.TypeOf(typ))] = fn
+}
+
+// Lookup returns the encoder registered for the values of the type of v
+// with encType.
+func (r *EncoderRegistry) Lookup(encType EncodingType, v interface{}) (EncoderFunc, bool) {
+	fn, _, ok := r.lookup(encType, v)
+	return fn, ok
+}
+
+// lookup returns the encoder for v and the type it is registered for, nil
+// for the encoder of all other types.
+func (r *EncoderRegistry) lookup(encType EncodingType, v interface{}) (EncoderFunc, reflect.Type, bool) {
+	if r == nil {
+		return nil, nil, false
+	}
+	r.l.RLock()
+	defer r.l.RUnlock()
+
+	encs := r.encoders[encType]
+	t := derefType(reflect.TypeOf(v))
+	if fn, ok := encs[t]; ok {
+		return fn, t, true
+	}
+	fn, ok := encs[nil]
+	return fn, nil, ok
+}
+
+// Has reports whether encoders are registered for encType.
+func (r *EncoderRegistry) Has(encType EncodingType) bool {
+	if r == nil {
+		return false
+	}
+	r.l.RLock()
+	defer r.l.RUnlock()
+	return len(r.encoders[encType]) > 0
+}
+
+// Encodings returns the sorted encodings encoders are registered for.
+func (r *EncoderRegistry) Encodings() []EncodingType {
+	if r == nil {
+		return nil
+	}
+	r.l.RLock()
+	defer r.l.RUnlock()
+
+	encTypes := make([]EncodingType, 0, len(r.encoders))
+	for encType, encs := range r.encoders {
+		if len(encs) > 0 {
+			encTypes = append(encTypes, encType)
+		}
+	}
+	sort.Slice(encTypes, func(i, j int) bool { return encTypes[i] < encTypes[j] })
+	return encTypes
+}
+
+// HasEncoder reports whether the values of cmd can be encoded with encType
+// by an encoder of cmd, of DefaultEncoders or of Encoders.
+func HasEncoder(cmd *Command, encType EncodingType) bool {
+	if cmd != nil {
+		if _, ok := cmd.Encoders[encType]; ok || cmd.TypedEncoders.Has(encType) {
+			return true
+		}
+	}
+	_, ok := Encoders[encType]
+	return ok || DefaultEncoders.Has(encType)
+}
+
+// registries returns the registries consulted for the values of req
+// encoded with encType, the ones without encoders for it left out.
+func registries(req *Request, encType EncodingType) []*EncoderRegistry {
+	var regs []*EncoderRegistry
+	if req.Command != nil {
+		if req.Command.TypedEncoders.Has(encType) {
+			regs = append(regs, req.Command.TypedEncoders)
+		}
+		if _, ok := req.Command.Encoders[encType]; ok {
+			// the encoders of the command take precedence over the
+			// defaults
+			return regs
+		}
+	}
+	if DefaultEncoders.Has(encType) {
+		regs = append(regs, DefaultEncoders)
+	}
+	return regs
+}
+
+// hasTypedEncoder reports whether v is encoded with an encoder of a
+// registry for encType. Such values aren't tagged or streamed, since the
+// encoders expect the values of the command.
+func hasTypedEncoder(req *Request, encType EncodingType, v interface{}) bool {
+	for _, reg := range registries(req, encType) {
+		if _, ok := reg.Lookup(encType, v); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// registryEncoder encodes each value with the encoder of the first registry
+// with one for its type, and the other values with the fallback, the
+// encoder GetEncoder returns without registries. The encoders write to the
+// same io.Writer and are created on the first value they encode.
+type registryEncoder struct {
+	req      *Request
+	w        io.Writer
+	encType  EncodingType
+	regs     []*EncoderRegistry
+	fallback Encoder
+
+	encs map[registeredType]Encoder
+	// created lists the encoders in encs in the order they were created,
+	// for Close
+	created []Encoder
+}
+
+// registeredType is a type an encoder is registered for in a registry.
+type registeredType struct {
+	reg *EncoderRegistry
+	t   reflect.Type
+}
+
+func newRegistryEncoder(req *Request, w io.Writer, encType EncodingType, regs []*EncoderRegistry, fallback Encoder) *registryEncoder {
+	return &registryEncoder{
+		req:      req,
+		w:        w,
+		encType:  encType,
+		regs:     regs,
+		fallback: fallback,
+		encs:     make(map[registeredType]Encoder),
+	}
+}
+
+func (e *registryEncoder) Encode(v interface{}) error {
+	for _, reg := range e.regs {
+		fn, t, ok := reg.lookup(e.encType, v)
+		if !ok {
+			continue
+		}
+
+		key := registeredType{reg, t}
+		enc, ok := e.encs[key]
+		if !ok {
+			enc = fn(e.req)(e.w)
+			e.encs[key] = enc
+			e.created = append(e.created, enc)
+		}
+		return enc.Encode(v)
+	}
+
+	if e.fallback == nil {
+		return fmt.Errorf("no %s encoder for values of type %T", e.encType, v)
+	}
+	return e.fallback.Encode(v)
+}
+
+func (e *registryEncoder) prepareStream() error {
+	// only values encoded with the fallback are streamed
+	if p, ok := e.fallback.(streamPreparer); ok {
+		return p.prepareStream()
+	}
+	return nil
+}
+
+// Close closes the encoders that were created and the fallback.
+func (e *registryEncoder) Close() error {
+	var err error
+	for _, enc := range append(e.created, e.fallback) {
+		if enc == nil {
+			continue
+		}
+		if cerr := CloseEncoder(enc); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,95 @@
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"testing"
+)
+
+type csvRow struct {
+	Name string
+	Size int
+}
+
+func csvEncoder(req *Request) func(io.Writer) Encoder {
+	return func(w io.Writer) Encoder {
+		return MakeTypedEncoder(func(req *Request, w io.Writer, r *csvRow) error {
+			cw := csv.NewWriter(w)
+			if err := cw.Write([]string{r.Name, fmt.Sprint(r.Size)}); err != nil {
+				return err
+			}
+			cw.Flush()
+			return cw.Error()
+		})(req)(w)
+	}
+}
+
+func TestEncoderRegistry(t *testing.T) {
+	defer func(reg *EncoderRegistry) { DefaultEncoders = reg }(DefaultEncoders)
+	DefaultEncoders = NewEncoderRegistry()
+	DefaultEncoders.Register("lines", nil, MakeEncoder(func(req *Request, w io.Writer, v interface{}) error {
+		_, err := fmt.Fprintf(w, "- %v\n", v)
+		return err
+	}))
+
+	typed := NewEncoderRegistry()
+	typed.Register("csv", csvRow{}, csvEncoder)
+	typed.Register(JSON, csvRow{}, csvEncoder)
+
+	custom := MakeEncoder(func(req *Request, w io.Writer, v interface{}) error {
+		_, err := io.WriteString(w, "custom\n")
+		return err
+	})
+
+	for _, tc := range []struct {
+		enc      EncodingType
+		cmd      *Command
+		expected string
+		err      bool
+	}{
+		// values of other types are encoded as without the registry
+		{enc: JSON, cmd: &Command{TypedEncoders: typed}, expected: "a,1\n\"b\"\n"},
+		// the encoding only exists in the registry
+		{enc: "csv", cmd: &Command{TypedEncoders: typed}, expected: "a,1\n", err: true},
+		{enc: "lines", cmd: &Command{}, expected: "- &{a 1}\n- b\n"},
+		// the encoders of the command take precedence over the defaults
+		{enc: "lines", cmd: &Command{Encoders: EncoderMap{"lines": custom}}, expected: "custom\ncustom\n"},
+		{enc: "lines", cmd: &Command{TypedEncoders: typed, Encoders: EncoderMap{"lines": custom}}, expected: "custom\ncustom\n"},
+	} {
+		if !HasEncoder(tc.cmd, tc.enc) {
+			t.Errorf("%s: expected the command to have an encoder", tc.enc)
+		}
+
+		req, err := NewRequest(context.Background(), nil, map[string]interface{}{EncLong: tc.enc}, nil, nil, tc.cmd)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		re, err := NewWriterResponseEmitter(wc{&buf, nopCloser{}}, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := re.Emit(&csvRow{"a", 1}); err != nil {
+			t.Fatal(err)
+		}
+		if err := re.Emit("b"); (err != nil) != tc.err {
+			t.Errorf("%s: unexpected error %v", tc.enc, err)
+		}
+		re.Close()
+
+		if buf.String() != tc.expected {
+			t.Errorf("%s: expected %q but got %q", tc.enc, tc.expected, buf.String())
+		}
+	}
+
+	if HasEncoder(&Command{}, "csv") {
+		t.Error("expected no csv encoder without the registry of the command")
+	}
+	if encs := typed.Encodings(); len(encs) != 2 || encs[0] != "csv" || encs[1] != JSON {
+		t.Errorf("unexpected encodings %v", encs)
+	}
+}
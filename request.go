@@ -107,8 +107,17 @@ func (req *Request) convertOptions(root *Command) error {
 			continue
 		}
 
-		kind := reflect.TypeOf(v).Kind()
-		if kind != opt.Type() {
+		if _, ok := opt.(ValidatedOption); ok {
+			if str, ok := v.(string); ok {
+				val, err := ParseOptionValue(opt, str)
+				if err != nil {
+					return err
+				}
+				req.Options[k] = val
+			} else if err := ValidateOptionValue(opt, v); err != nil {
+				return err
+			}
+		} else if kind := reflect.TypeOf(v).Kind(); kind != opt.Type() {
 			if str, ok := v.(string); ok {
 				val, err := opt.Parse(str)
 				if err != nil {
@@ -1,6 +1,8 @@
 package cmds
 
 import (
+	"io"
+
 	"github.com/ipfs/go-ipfs-cmdkit"
 )
 
@@ -15,3 +17,105 @@ type Response interface {
 	// The returned error can be a network or decoding error.
 	Next() (interface{}, error)
 }
+
+// TypedResponse is a Response whose values are of type T.
+type TypedResponse[T any] interface {
+	Request() *Request
+
+	Error() *cmdkit.Error
+	Length() uint64
+
+	// Next returns the next emitted value.
+	// The returned error can be a network or decoding error, or
+	// ErrIncorrectType if the value is not a T.
+	Next() (T, error)
+}
+
+// valueDecoder is implemented by responses that decode values, so Typed
+// can have them decode into a T regardless of the Type of the command.
+type valueDecoder interface {
+	NextInto(value interface{}) (interface{}, error)
+}
+
+// Typed returns res as a TypedResponse. Values of type *T are dereferenced.
+func Typed[T any](res Response) TypedResponse[T] {
+	return typedResponse[T]{res}
+}
+
+type typedResponse[T any] struct {
+	Response
+}
+
+func (res typedResponse[T]) Next() (T, error) {
+	var (
+		v   interface{}
+		err error
+	)
+	if dec, ok := res.Response.(valueDecoder); ok {
+		v, err = dec.NextInto(new(T))
+	} else {
+		v, err = res.Response.Next()
+	}
+
+	var zero T
+	if err != nil {
+		return zero, err
+	}
+
+	switch v := v.(type) {
+	case T:
+		return v, nil
+	case *T:
+		if v != nil {
+			return *v, nil
+		}
+	}
+	return zero, ErrIncorrectType
+}
+
+// ForEach calls fn with every value of res until the response ends or fn
+// returns an error. It returns nil once the response ended successfully.
+func ForEach(res Response, fn func(v interface{}) error) error {
+	for {
+		v, err := res.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := fn(v); err != nil {
+			return err
+		}
+	}
+}
+
+// DecodeEach is ForEach for values of type T, see Typed.
+func DecodeEach[T any](res Response, fn func(v T) error) error {
+	typed := Typed[T](res)
+	for {
+		v, err := typed.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := fn(v); err != nil {
+			return err
+		}
+	}
+}
+
+// Collect returns all values of res as values of type T. If the response
+// fails, the values received until then are returned with the error.
+func Collect[T any](res Response) ([]T, error) {
+	var vs []T
+	err := DecodeEach(res, func(v T) error {
+		vs = append(vs, v)
+		return nil
+	})
+	return vs, err
+}
@@ -3,6 +3,7 @@ package cmds
 import (
 	"bytes"
 	"context"
+	"errors"
 	"strings"
 	"testing"
 )
@@ -66,3 +67,85 @@ func removeWhitespace(input string) string {
 	input = strings.Replace(input, "\n", "", -1)
 	return strings.Replace(input, "\r", "", -1)
 }
+
+func TestTyped(t *testing.T) {
+	req, err := NewRequest(context.Background(), nil, nil, nil, nil, &Command{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	re, res := NewChanResponsePair(req)
+	go func() {
+		re.Emit(TestOutput{Foo: "a"})
+		re.Emit(&TestOutput{Foo: "b"})
+		re.Emit("not a TestOutput")
+		re.Close()
+	}()
+
+	typed := Typed[TestOutput](res)
+	for _, expected := range []string{"a", "b"} {
+		v, err := typed.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.Foo != expected {
+			t.Errorf("expected Foo to be %q, got %q", expected, v.Foo)
+		}
+	}
+	if _, err := typed.Next(); err != ErrIncorrectType {
+		t.Errorf("expected ErrIncorrectType, got %v", err)
+	}
+}
+
+func TestIterationHelpers(t *testing.T) {
+	newResponse := func(values ...interface{}) Response {
+		// unblock the emitting goroutine if the helper stops early
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+
+		req, err := NewRequest(ctx, nil, nil, nil, nil, &Command{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		re, res := NewChanResponsePair(req)
+		go func() {
+			for _, v := range values {
+				re.Emit(v)
+			}
+			re.Close()
+		}()
+		return res
+	}
+
+	var values []interface{}
+	err := ForEach(newResponse(1, "two"), func(v interface{}) error {
+		values = append(values, v)
+		return nil
+	})
+	if err != nil || len(values) != 2 || values[0] != 1 || values[1] != "two" {
+		t.Errorf("ForEach: unexpected values %v and error %v", values, err)
+	}
+
+	outs, err := Collect[TestOutput](newResponse(TestOutput{Foo: "a"}, &TestOutput{Foo: "b"}))
+	if err != nil || len(outs) != 2 || outs[0].Foo != "a" || outs[1].Foo != "b" {
+		t.Errorf("Collect: unexpected values %v and error %v", outs, err)
+	}
+
+	if _, err := Collect[int](newResponse(1, "two")); err != ErrIncorrectType {
+		t.Errorf("Collect: expected ErrIncorrectType, got %v", err)
+	}
+
+	stop := errors.New("stop")
+	var n int
+	err = DecodeEach(newResponse(1, 2, 3), func(v int) error {
+		n += v
+		if v == 2 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || n != 3 {
+		t.Errorf("DecodeEach: expected to stop after 2, got sum %d and error %v", n, err)
+	}
+}
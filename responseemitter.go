@@ -9,6 +9,7 @@ import (
 var (
 	ErrClosedEmitter        = errors.New("cmds: emit on closed emitter")
 	ErrClosingClosedEmitter = errors.New("cmds: closing closed emitter")
+	ErrTryEmitChan          = errors.New("cmds: can't try to emit a channel")
 )
 
 // Single can be used to signal to any ResponseEmitter that only one value will be emitted.
@@ -46,18 +47,110 @@ type ResponseEmitter interface {
 
 	// Emit sends a value.
 	// If value is io.Reader we just copy that to the connection
-	// other values are marshalled.
+	// other values are marshalled. Readers that are also io.Closers are
+	// closed by the emitter, see CloseReader.
 	Emit(value interface{}) error
 }
 
+// TryEmitter is implemented by emitters that can emit values without
+// blocking, e.g. for best-effort status updates from latency sensitive code.
+type TryEmitter interface {
+	// TryEmit emits v if that doesn't block and returns whether it did.
+	TryEmit(v interface{}) (accepted bool, err error)
+}
+
+// TryEmit emits v to re if that doesn't block and returns whether it did.
+// Values emitted to ResponseEmitters that don't implement TryEmitter are
+// never accepted; wrap them with NewLossyEmitter to buffer values instead.
+func TryEmit(re ResponseEmitter, v interface{}) (bool, error) {
+	if tre, ok := re.(TryEmitter); ok {
+		return tre.TryEmit(v)
+	}
+	return false, nil
+}
+
+// BatchEmitter is implemented by emitters that can emit several values at
+// once, e.g. to send them to the client in one write.
+type BatchEmitter interface {
+	// EmitAll emits the values in vs.
+	EmitAll(vs []interface{}) error
+}
+
+// EmitAll emits the values in vs to re, at once if re implements
+// BatchEmitter.
+func EmitAll(re ResponseEmitter, vs []interface{}) error {
+	if bre, ok := re.(BatchEmitter); ok {
+		return bre.EmitAll(vs)
+	}
+
+	for _, v := range vs {
+		if err := re.Emit(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Copy sends all values received on res to re. If res is closed, it closes re.
 func Copy(re ResponseEmitter, res Response) error {
-	re.SetLength(res.Length())
+	return CopyWith(re, res, CopyOptions{})
+}
+
+// ErrorPolicy selects what CopyWith does if a Transform fails.
+type ErrorPolicy int
+
+const (
+	// StopOnError closes the emitter with the first error.
+	StopOnError ErrorPolicy = iota
+	// SkipOnError skips the values the Transform fails for and closes the
+	// emitter with all errors once the response ended.
+	SkipOnError
+)
+
+// CopyOptions tweak the values copied by CopyWith.
+type CopyOptions struct {
+	// Filter, if set, drops the values of the response it returns false
+	// for. Dropped readers are closed, see CloseReader.
+	Filter func(v interface{}) bool
+
+	// Transform, if set, replaces the values that passed the Filter by
+	// the returned value before they are emitted. Readers it fails for or
+	// replaces are closed, unless the returned value is an io.Reader that
+	// is also an io.Closer, which takes the reader over.
+	Transform func(v interface{}) (interface{}, error)
+
+	// OnError is the policy for errors returned by Transform. Errors of
+	// the response and of the emitter always stop the copy.
+	OnError ErrorPolicy
+
+	// Progress, if set, is called while an io.Reader value is copied with
+	// the number of bytes copied so far and the length of the response,
+	// zero if it is unknown. It is called with the partial count if the
+	// copy fails.
+	Progress func(copied, length uint64)
+}
+
+// CopyWith is Copy filtering and transforming the values as set in opts,
+// e.g. to implement a PostRun.
+func CopyWith(re ResponseEmitter, res Response, opts CopyOptions) error {
+	// zero means unknown, don't announce an empty response
+	length := res.Length()
+	if length > 0 {
+		re.SetLength(length)
+	}
 
+	var skipped []error
 	for {
 		v, err := res.Next()
 		if err != nil {
 			if err == io.EOF {
+				err = nil
+			}
+			if len(skipped) > 0 {
+				// errors.Join drops a nil err
+				err = errors.Join(append([]error{err}, skipped...)...)
+			}
+			if err == nil {
 				return re.Close()
 			}
 
@@ -69,6 +162,35 @@ func Copy(re ResponseEmitter, res Response) error {
 			return err
 		}
 
+		if opts.Filter != nil && !opts.Filter(v) {
+			CloseReader(v)
+			continue
+		}
+
+		if opts.Transform != nil {
+			orig := v
+			v, err = opts.Transform(orig)
+			if err != nil || replacesReader(orig, v) {
+				CloseReader(orig)
+			}
+			if err != nil {
+				if opts.OnError == SkipOnError {
+					skipped = append(skipped, err)
+					continue
+				}
+
+				closeErr := re.CloseWithError(err)
+				if closeErr != nil {
+					log.Errorf("error closing emitter with error %q: %s", err, closeErr)
+				}
+				return err
+			}
+		}
+
+		if r, ok := v.(io.Reader); ok && opts.Progress != nil {
+			v = &progressReader{r: r, length: length, progress: opts.Progress}
+		}
+
 		err = re.Emit(v)
 		if err != nil {
 			return err
@@ -76,6 +198,42 @@ func Copy(re ResponseEmitter, res Response) error {
 	}
 }
 
+// replacesReader returns whether v replaced the reader orig without taking
+// it over, which readers that are also io.Closers are expected to do.
+func replacesReader(orig, v interface{}) bool {
+	if _, ok := orig.(io.Reader); !ok {
+		return false
+	}
+	_, reader := v.(io.Reader)
+	_, closer := v.(io.Closer)
+	return !(reader && closer)
+}
+
+// progressReader reports the bytes read from it to a CopyOptions.Progress.
+// It closes the reader it wraps, which emitters close through it.
+type progressReader struct {
+	r        io.Reader
+	copied   uint64
+	length   uint64
+	progress func(copied, length uint64)
+}
+
+func (r *progressReader) Close() error {
+	if c, ok := r.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.copied += uint64(n)
+		r.progress(r.copied, r.length)
+	}
+	return n, err
+}
+
 func EmitChan(re ResponseEmitter, ch <-chan interface{}) error {
 	for v := range ch {
 		err := re.Emit(v)
@@ -2,7 +2,9 @@ package cmds
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"strings"
 	"testing"
 
 	"github.com/ipfs/go-ipfs-cmdkit"
@@ -111,3 +113,151 @@ func TestError(t *testing.T) {
 		}
 	}
 }
+
+func TestCopyWith(t *testing.T) {
+	tcs := []struct {
+		policy ErrorPolicy
+		values []interface{}
+		errMsg string
+	}{
+		{StopOnError, []interface{}{"0", "2"}, "3 is odd"},
+		{SkipOnError, []interface{}{"0", "2", "4"}, "3 is odd\n5 is odd"},
+	}
+
+	for _, tc := range tcs {
+		// cancel unblocks the producer once CopyWith stopped reading
+		ctx, cancel := context.WithCancel(context.Background())
+		req, err := NewRequest(ctx, nil, nil, nil, nil, &Command{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		re1, res1 := NewChanResponsePair(req)
+		re2, res2 := NewChanResponsePair(req)
+
+		go func() {
+			for i := 0; i < 6; i++ {
+				re1.Emit(i)
+			}
+			re1.Close()
+		}()
+
+		go CopyWith(re2, res1, CopyOptions{
+			// drop 1
+			Filter: func(v interface{}) bool { return v != 1 },
+			Transform: func(v interface{}) (interface{}, error) {
+				if v.(int)%2 == 1 {
+					return nil, fmt.Errorf("%d is odd", v)
+				}
+				return fmt.Sprint(v), nil
+			},
+			OnError: tc.policy,
+		})
+
+		var values []interface{}
+		err = ForEach(res2, func(v interface{}) error {
+			values = append(values, v)
+			return nil
+		})
+		if err == nil || err.Error() != tc.errMsg {
+			t.Errorf("policy %d: expected error %q, got %v", tc.policy, tc.errMsg, err)
+		}
+
+		if fmt.Sprint(values) != fmt.Sprint(tc.values) {
+			t.Errorf("policy %d: expected values %v but got %v", tc.policy, tc.values, values)
+		}
+		cancel()
+	}
+}
+
+func TestCopyWithProgress(t *testing.T) {
+	req, err := NewRequest(context.Background(), nil, nil, nil, nil, &Command{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	re1, res1 := NewChanResponsePair(req)
+	re2, res2 := NewChanResponsePair(req)
+
+	go func() {
+		re1.SetLength(10)
+		re1.Emit(strings.NewReader("0123456789"))
+		re1.Close()
+	}()
+
+	var copied, length uint64
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		CopyWith(re2, res1, CopyOptions{
+			Progress: func(c, l uint64) { copied, length = c, l },
+		})
+	}()
+
+	v, err := res2.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := res2.Length(); l != 10 {
+		t.Errorf("expected the length to be propagated, got %d", l)
+	}
+	if _, err := io.Copy(io.Discard, v.(io.Reader)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := res2.Next(); err != io.EOF {
+		t.Fatalf("expected EOF but got err=%v", err)
+	}
+	<-done
+
+	if copied != 10 || length != 10 {
+		t.Errorf("expected progress 10/10, got %d/%d", copied, length)
+	}
+}
+
+func TestCopyWithClosesReaders(t *testing.T) {
+	req, err := NewRequest(context.Background(), nil, nil, nil, nil, &Command{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dropped := &trackedReader{Reader: strings.NewReader("dropped")}
+	replaced := &trackedReader{Reader: strings.NewReader("replaced")}
+	wrapped := &trackedReader{Reader: strings.NewReader("wrapped")}
+
+	re1, res1 := NewChanResponsePair(req)
+	re2, res2 := NewChanResponsePair(req)
+	go func() {
+		re1.Emit(dropped)
+		re1.Emit(replaced)
+		re1.Emit(wrapped)
+		re1.Close()
+	}()
+	go CopyWith(re2, res1, CopyOptions{
+		Filter: func(v interface{}) bool { return v != dropped },
+		Transform: func(v interface{}) (interface{}, error) {
+			if v == replaced {
+				return "replacement", nil
+			}
+			return v, nil
+		},
+		Progress: func(copied, length uint64) {},
+	})
+
+	var values []interface{}
+	if err := ForEach(res2, func(v interface{}) error {
+		values = append(values, v)
+		return CloseReader(v)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(values) != 2 || values[0] != "replacement" {
+		t.Fatalf("unexpected values %v", values)
+	}
+	if !dropped.closed || !replaced.closed {
+		t.Error("expected the dropped and the replaced reader to be closed")
+	}
+	if !wrapped.closed {
+		t.Error("expected the reader to be closed through the progress reader")
+	}
+}
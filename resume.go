@@ -0,0 +1,20 @@
+package cmds
+
+// ResumeTokener is implemented by the values of subscription commands, i.e.
+// streaming commands following logs or events, that can be resumed. The
+// token identifies the value in the stream, e.g. its sequence number.
+//
+// When a client resumes a subscription, it sets the ResumeOpt option to the
+// token of the last value it received, and the command continues with the
+// value after it. Such commands should include OptionResume in their
+// Options.
+type ResumeTokener interface {
+	ResumeToken() string
+}
+
+// ResumeToken returns the token of the value req resumes after, or "" if it
+// starts a new subscription.
+func ResumeToken(req *Request) string {
+	token, _ := req.Options[ResumeOpt].(string)
+	return token
+}
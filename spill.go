@@ -0,0 +1,283 @@
+package cmds
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sync"
+)
+
+// NewSpillEmitter returns a ResponseEmitter for commands producing values
+// faster than the consumer reads them. Like NewLossyEmitter it sends the
+// values to re in the background, so Emit doesn't wait for the consumer, but
+// instead of dropping values it buffers up to threshold values in memory
+// and spills the rest to a temporary file. The values are replayed in order
+// as the consumer catches up.
+//
+// Spilled values are stored as JSON and sent as pointers to a new value of
+// the Type of the command, like the values of an HTTP response. Values that
+// can't be encoded, i.e. io.Readers and Single values, wait until the spilled
+// values were sent.
+//
+// Commands must close the returned emitter instead of re, passing it the
+// error they fail with. Closing waits until the buffered values were sent,
+// removes the temporary file and then closes re.
+func NewSpillEmitter(req *Request, re ResponseEmitter, threshold int) ResponseEmitter {
+	if threshold < 1 {
+		threshold = 1
+	}
+
+	sre := &spillEmitter{
+		ResponseEmitter: re,
+		threshold:       threshold,
+		wake:            make(chan struct{}, 1),
+		done:            make(chan struct{}),
+	}
+	if req.Command != nil {
+		sre.typ = reflect.TypeOf(req.Command.Type)
+	}
+	sre.drained = sync.NewCond(&sre.l)
+	go sre.forward()
+
+	return sre
+}
+
+type spillEmitter struct {
+	ResponseEmitter
+
+	threshold int
+	// typ is the type spilled values are decoded into.
+	typ reflect.Type
+
+	// wake is signaled when a value was buffered or the emitter was closed.
+	wake chan struct{}
+	// done is closed when forward returns.
+	done chan struct{}
+
+	l sync.Mutex
+	// drained is signaled when a value was taken from the buffer.
+	drained *sync.Cond
+	mem     []interface{}
+	closed  bool
+	// err is the error sending a value to the underlying emitter or
+	// spilling a value failed with.
+	err error
+
+	// file holds the spilled values, which are written at wOff and read at
+	// rOff. The file is emptied once all spilled values were read.
+	file    *os.File
+	spilled int
+	wOff    int64
+	rOff    int64
+}
+
+func (re *spillEmitter) Emit(v interface{}) error {
+	// channel emission iteration
+	if ch, ok := v.(chan interface{}); ok {
+		v = (<-chan interface{})(ch)
+	}
+	if ch, isChan := v.(<-chan interface{}); isChan {
+		return EmitChan(re, ch)
+	}
+
+	re.l.Lock()
+	defer re.l.Unlock()
+
+	switch v.(type) {
+	case io.Reader, Single:
+		for re.err == nil && !re.closed && (re.spilled > 0 || len(re.mem) >= re.threshold) {
+			re.drained.Wait()
+		}
+	}
+
+	if re.closed {
+		return ErrClosedEmitter
+	}
+	if re.err != nil {
+		return re.err
+	}
+
+	if re.spilled == 0 && len(re.mem) < re.threshold {
+		re.mem = append(re.mem, v)
+	} else if err := re.spill(v); err != nil {
+		re.err = err
+		return err
+	}
+	re.signal()
+
+	return nil
+}
+
+// spill appends v to the spill file. Records are the length of the encoded
+// value as a uvarint followed by the value.
+func (re *spillEmitter) spill(v interface{}) error {
+	if re.file == nil {
+		f, err := ioutil.TempFile("", "cmds-spill-")
+		if err != nil {
+			return err
+		}
+		re.file = f
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	rec := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(data))
+	rec = append(rec[:binary.PutUvarint(rec, uint64(len(data)))], data...)
+	if _, err := re.file.WriteAt(rec, re.wOff); err != nil {
+		return err
+	}
+
+	re.wOff += int64(len(rec))
+	re.spilled++
+	return nil
+}
+
+// unspill reads the spilled value at off and returns it and the offset of
+// the next one. It only reads parts of the file that were written, so it
+// doesn't need the lock.
+func (re *spillEmitter) unspill(off int64) (interface{}, int64, error) {
+	var hdr [binary.MaxVarintLen64]byte
+	n, err := re.file.ReadAt(hdr[:], off)
+	if err != nil && err != io.EOF {
+		return nil, 0, err
+	}
+	size, hdrLen := binary.Uvarint(hdr[:n])
+	if hdrLen <= 0 {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+
+	data := make([]byte, size)
+	if _, err := re.file.ReadAt(data, off+int64(hdrLen)); err != nil {
+		return nil, 0, err
+	}
+
+	var value interface{}
+	if re.typ != nil {
+		typ := re.typ
+		if typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+		value = reflect.New(typ).Interface()
+	}
+
+	if value == nil {
+		err = json.Unmarshal(data, &value)
+	} else {
+		err = json.Unmarshal(data, value)
+	}
+	return value, off + int64(hdrLen) + int64(size), err
+}
+
+func (re *spillEmitter) signal() {
+	select {
+	case re.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next takes the next value from the buffer. It returns false if the
+// buffer is empty. It must be called with the lock held.
+func (re *spillEmitter) next() (interface{}, bool, error) {
+	if len(re.mem) > 0 {
+		v := re.mem[0]
+		copy(re.mem, re.mem[1:])
+		re.mem[len(re.mem)-1] = nil
+		re.mem = re.mem[:len(re.mem)-1]
+		return v, true, nil
+	}
+
+	if re.spilled == 0 {
+		return nil, false, nil
+	}
+
+	off := re.rOff
+	re.l.Unlock()
+	v, next, err := re.unspill(off)
+	re.l.Lock()
+	if err != nil {
+		return nil, false, err
+	}
+
+	re.rOff = next
+	if re.spilled--; re.spilled == 0 {
+		// reuse the file from the start
+		re.rOff, re.wOff = 0, 0
+		err = re.file.Truncate(0)
+	}
+	return v, true, err
+}
+
+// forward sends the buffered values to the underlying emitter until the
+// emitter is closed and the buffer is empty.
+func (re *spillEmitter) forward() {
+	defer close(re.done)
+
+	for {
+		re.l.Lock()
+		v, ok, err := re.next()
+		if err != nil {
+			re.fail(err)
+			re.l.Unlock()
+			return
+		}
+		if !ok {
+			closed := re.closed
+			re.l.Unlock()
+
+			if closed {
+				return
+			}
+			<-re.wake
+			continue
+		}
+		re.drained.Broadcast()
+		re.l.Unlock()
+
+		if err := re.ResponseEmitter.Emit(v); err != nil {
+			re.l.Lock()
+			re.fail(err)
+			re.l.Unlock()
+			return
+		}
+	}
+}
+
+// fail drops the buffered values after err occurred. It must be called with
+// the lock held.
+func (re *spillEmitter) fail(err error) {
+	re.err = err
+	re.mem = nil
+	re.spilled = 0
+	re.drained.Broadcast()
+}
+
+func (re *spillEmitter) Close() error {
+	return re.CloseWithError(nil)
+}
+
+func (re *spillEmitter) CloseWithError(err error) error {
+	re.l.Lock()
+	if re.closed {
+		re.l.Unlock()
+		return ErrClosingClosedEmitter
+	}
+	re.closed = true
+	re.signal()
+	re.drained.Broadcast()
+	re.l.Unlock()
+
+	<-re.done
+
+	if re.file != nil {
+		re.file.Close()
+		os.Remove(re.file.Name())
+	}
+
+	return re.ResponseEmitter.CloseWithError(err)
+}
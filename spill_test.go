@@ -0,0 +1,68 @@
+package cmds
+
+import (
+	"context"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestSpillEmitter(t *testing.T) {
+	type value struct {
+		N int
+	}
+
+	req, err := NewRequest(context.Background(), nil, nil, nil, nil, &Command{Type: value{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	re, res := NewChanResponsePair(req)
+	sre := NewSpillEmitter(req, re, 2)
+
+	// nobody reads yet, so Emit must not wait for the consumer
+	for i := 0; i < 10; i++ {
+		if err := sre.Emit(value{i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	file := sre.(*spillEmitter).file
+	if file == nil {
+		t.Fatal("expected the values to be spilled")
+	}
+	go sre.Close()
+
+	var values []int
+	for {
+		v, err := res.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		switch v := v.(type) {
+		case value:
+			values = append(values, v.N)
+		case *value:
+			values = append(values, v.N)
+		default:
+			t.Fatalf("unexpected value %#v", v)
+		}
+	}
+
+	if len(values) != 10 {
+		t.Fatalf("expected 10 values but got %v", values)
+	}
+	for i, v := range values {
+		if v != i {
+			t.Fatalf("expected the values in order, got %v", values)
+		}
+	}
+
+	if _, err := os.Stat(file.Name()); !os.IsNotExist(err) {
+		t.Errorf("expected the spill file to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package cmds
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Stats collects statistics about the execution of a request. Emitters and
+// clients update the Stats attached to the request context with
+// ContextWithStats.
+type Stats struct {
+	emitted       uint64
+	bytesSent     uint64
+	bytesReceived uint64
+	// bytesDecompressed counts the received bytes after decompression.
+	bytesDecompressed uint64
+}
+
+type statsKey struct{}
+
+// ContextWithStats returns a context carrying new Stats.
+func ContextWithStats(ctx context.Context) (context.Context, *Stats) {
+	s := &Stats{}
+	return context.WithValue(ctx, statsKey{}, s), s
+}
+
+// StatsFromContext returns the Stats attached to ctx, or nil if there are
+// none. All methods of Stats can be called on nil.
+func StatsFromContext(ctx context.Context) *Stats {
+	if ctx == nil {
+		return nil
+	}
+
+	s, _ := ctx.Value(statsKey{}).(*Stats)
+	return s
+}
+
+// AddEmitted adds n to the number of emitted values.
+func (s *Stats) AddEmitted(n uint64) {
+	if s != nil {
+		atomic.AddUint64(&s.emitted, n)
+	}
+}
+
+// AddBytesSent adds n to the number of bytes sent to a server.
+func (s *Stats) AddBytesSent(n uint64) {
+	if s != nil {
+		atomic.AddUint64(&s.bytesSent, n)
+	}
+}
+
+// AddBytesReceived adds n to the number of bytes received from a server.
+func (s *Stats) AddBytesReceived(n uint64) {
+	if s != nil {
+		atomic.AddUint64(&s.bytesReceived, n)
+	}
+}
+
+// AddBytesDecompressed adds n to the number of received bytes after
+// decompression.
+func (s *Stats) AddBytesDecompressed(n uint64) {
+	if s != nil {
+		atomic.AddUint64(&s.bytesDecompressed, n)
+	}
+}
+
+// Emitted returns the number of emitted values.
+func (s *Stats) Emitted() uint64 {
+	if s == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&s.emitted)
+}
+
+// BytesSent returns the number of bytes sent to a server.
+func (s *Stats) BytesSent() uint64 {
+	if s == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&s.bytesSent)
+}
+
+// BytesReceived returns the number of bytes received from a server.
+func (s *Stats) BytesReceived() uint64 {
+	if s == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&s.bytesReceived)
+}
+
+// BytesDecompressed returns the number of bytes received from a server after
+// decompression. It is zero if the responses weren't compressed, in which
+// case BytesReceived is the size of the responses.
+func (s *Stats) BytesDecompressed() uint64 {
+	if s == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&s.bytesDecompressed)
+}
@@ -0,0 +1,33 @@
+package cmds
+
+import (
+	"context"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	if s := StatsFromContext(context.Background()); s != nil {
+		t.Fatalf("expected no stats, got %v", s)
+	}
+
+	// nil Stats are ignored
+	var nilStats *Stats
+	nilStats.AddEmitted(1)
+	if n := nilStats.Emitted(); n != 0 {
+		t.Errorf("expected 0 values emitted, got %d", n)
+	}
+
+	ctx, s := ContextWithStats(context.Background())
+	if StatsFromContext(ctx) != s {
+		t.Fatal("expected stats from context")
+	}
+
+	s.AddEmitted(2)
+	s.AddBytesSent(10)
+	s.AddBytesReceived(20)
+	s.AddBytesReceived(5)
+
+	if s.Emitted() != 2 || s.BytesSent() != 10 || s.BytesReceived() != 25 {
+		t.Errorf("unexpected stats: %d emitted, %d sent, %d received", s.Emitted(), s.BytesSent(), s.BytesReceived())
+	}
+}
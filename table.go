@@ -0,0 +1,319 @@
+package cmds
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+)
+
+// TextFormat renders the values of a command in the text encoding, with a
+// template or as the rows of a table, so list-style commands don't need an
+// encoder of their own, see Command.TextFormat. An Encoder of the command
+// for the text encoding takes precedence.
+//
+// Users can render the values with a template of their own with the
+// FormatOpt option, e.g. --format='{{.Name}}: {{.Size}}', and omit the
+// header of tables with the NoHeaderOpt option. Templates are only run by
+// the local frontend: the HTTP client doesn't send them and the handler
+// ignores them. Tables are fit into the
+// number of columns of the WidthOpt option by truncating the widest cells.
+type TextFormat struct {
+	// Template is a text/template executed for every value, followed by a
+	// newline. It is used instead of the Columns if both are set.
+	Template string
+	// Columns are the columns of the table.
+	Columns []Column
+}
+
+// Alignment aligns the cells of a Column.
+type Alignment int
+
+const (
+	// AlignLeft pads the cells on the right.
+	AlignLeft Alignment = iota
+	// AlignRight pads the cells on the left, e.g. for numbers.
+	AlignRight
+)
+
+// Column is a column of a table, see TextFormat.
+type Column struct {
+	// Header is the heading of the column.
+	Header string
+	// Field selects the content of the cells from the values, the name of a
+	// field or map key, or a path thereof like "Stat.Size". The cells hold
+	// the whole value if it is empty.
+	Field string
+	// Width is the width of the column in characters, longer cells are
+	// truncated. Zero sizes the column to its widest cell.
+	Width int
+	Align Alignment
+}
+
+// textFormatFuncs are the functions available in format templates.
+var textFormatFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// textFormatEncoder returns the encoder of the text format of req, or nil
+// if neither the command nor the FormatOpt option set one.
+func textFormatEncoder(req *Request, w io.Writer) (Encoder, error) {
+	if format, ok := req.Options[FormatOpt].(string); ok && format != "" {
+		enc, err := NewTemplateEncoder(w, format)
+		if err != nil {
+			return nil, cmdkit.Errorf(cmdkit.ErrClient, "invalid --%s: %s", FormatOpt, err)
+		}
+		return enc, nil
+	}
+
+	if req.Command == nil || req.Command.TextFormat == nil {
+		return nil, nil
+	}
+	if _, ok := req.Command.Encoders[Text]; ok {
+		return nil, nil
+	}
+
+	tf := req.Command.TextFormat
+	if tf.Template != "" {
+		return NewTemplateEncoder(w, tf.Template)
+	}
+	var noHeader bool
+	switch v := req.Options[NoHeaderOpt].(type) {
+	case bool:
+		noHeader = v
+	case string:
+		// sent over HTTP to servers that don't define the option
+		noHeader, _ = strconv.ParseBool(v)
+	}
+	enc, err := NewTableEncoder(w, tf.Columns, !noHeader)
+	if err != nil {
+		return nil, err
+	}
+	switch width := req.Options[WidthOpt].(type) {
+	case int:
+		enc.(*tableEncoder).width = width
+	case string:
+		enc.(*tableEncoder).width, _ = strconv.Atoi(width)
+	}
+	return enc, nil
+}
+
+// NewTemplateEncoder returns an Encoder executing the text/template tmpl
+// for every value, followed by a newline. Templates can use the functions
+// json, join, upper and lower.
+func NewTemplateEncoder(w io.Writer, tmpl string) (Encoder, error) {
+	t, err := template.New("format").Funcs(textFormatFuncs).Parse(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	return &templateEncoder{w: w, t: t}, nil
+}
+
+type templateEncoder struct {
+	w io.Writer
+	t *template.Template
+}
+
+func (e *templateEncoder) Encode(v interface{}) error {
+	var buf bytes.Buffer
+	if err := e.t.Execute(&buf, v); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	_, err := e.w.Write(buf.Bytes())
+	return err
+}
+
+// NewTableEncoder returns an Encoder writing the values as the rows of a
+// table with the columns, which are separated by two spaces. The header is
+// written if header is set. If all columns have a Width, the rows are
+// written as they are encoded. Otherwise they are kept until the encoder is
+// closed, which emitters do through CloseEncoder, to size the columns.
+func NewTableEncoder(w io.Writer, columns []Column, header bool) (Encoder, error) {
+	e := &tableEncoder{w: w, columns: columns, header: header, stream: true}
+	for _, col := range columns {
+		field := "."
+		if col.Field != "" {
+			field = "." + col.Field
+		}
+		t, err := template.New(col.Header).Parse("{{" + field + "}}")
+		if err != nil {
+			return nil, err
+		}
+		e.cells = append(e.cells, t)
+		if col.Width <= 0 {
+			e.stream = false
+		}
+	}
+	return e, nil
+}
+
+// minColumnWidth is the width fit doesn't narrow columns below.
+const minColumnWidth = 4
+
+type tableEncoder struct {
+	w       io.Writer
+	columns []Column
+	cells   []*template.Template
+	header  bool
+	// stream is set if the rows are written as they are encoded.
+	stream bool
+	// width is the number of columns rows are fit into, zero if they
+	// aren't limited.
+	width int
+
+	rows    [][]string
+	started bool
+}
+
+func (e *tableEncoder) Encode(v interface{}) error {
+	row := make([]string, len(e.cells))
+	for i, t := range e.cells {
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, v); err != nil {
+			return err
+		}
+		row[i] = buf.String()
+	}
+
+	if !e.stream {
+		e.rows = append(e.rows, row)
+		return nil
+	}
+
+	widths := make([]int, len(e.columns))
+	for i, col := range e.columns {
+		widths[i] = col.Width
+	}
+	e.fit(widths)
+	if err := e.writeHeader(widths); err != nil {
+		return err
+	}
+	return e.writeRow(widths, row)
+}
+
+// Close writes the rows kept to size the columns.
+func (e *tableEncoder) Close() error {
+	if e.stream {
+		return nil
+	}
+
+	widths := make([]int, len(e.columns))
+	for i, col := range e.columns {
+		if col.Width > 0 {
+			widths[i] = col.Width
+			continue
+		}
+		if e.header {
+			widths[i] = utf8.RuneCountInString(col.Header)
+		}
+		for _, row := range e.rows {
+			if n := utf8.RuneCountInString(row[i]); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	e.fit(widths)
+
+	if err := e.writeHeader(widths); err != nil {
+		return err
+	}
+	for _, row := range e.rows {
+		if err := e.writeRow(widths, row); err != nil {
+			return err
+		}
+	}
+	e.rows = nil
+	return nil
+}
+
+// fit narrows the widest columns until the rows fit into the width of the
+// encoder. Columns are kept at least minColumnWidth wide.
+func (e *tableEncoder) fit(widths []int) {
+	if e.width <= 0 {
+		return
+	}
+
+	total := 2 * (len(widths) - 1)
+	for _, w := range widths {
+		total += w
+	}
+	for total > e.width {
+		widest := 0
+		for i, w := range widths {
+			if w > widths[widest] {
+				widest = i
+			}
+		}
+		if widths[widest] <= minColumnWidth {
+			return
+		}
+		widths[widest]--
+		total--
+	}
+}
+
+func (e *tableEncoder) writeHeader(widths []int) error {
+	if e.started {
+		return nil
+	}
+	e.started = true
+
+	if !e.header {
+		return nil
+	}
+	headers := make([]string, len(e.columns))
+	for i, col := range e.columns {
+		headers[i] = col.Header
+	}
+	return e.writeRow(widths, headers)
+}
+
+func (e *tableEncoder) writeRow(widths []int, row []string) error {
+	var buf bytes.Buffer
+	for i, cell := range row {
+		if i > 0 {
+			buf.WriteString("  ")
+		}
+
+		cell = truncate(cell, widths[i])
+		pad := strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell))
+		switch {
+		case e.columns[i].Align == AlignRight:
+			buf.WriteString(pad + cell)
+		case i == len(row)-1:
+			// no trailing spaces
+			buf.WriteString(cell)
+		default:
+			buf.WriteString(cell + pad)
+		}
+	}
+	buf.WriteByte('\n')
+
+	_, err := e.w.Write(buf.Bytes())
+	return err
+}
+
+// truncate shortens s to width characters, marking the cut with an
+// ellipsis.
+func truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	if width <= 1 {
+		return string([]rune(s)[:width])
+	}
+	return fmt.Sprintf("%s…", string([]rune(s)[:width-1]))
+}
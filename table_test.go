@@ -0,0 +1,163 @@
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+)
+
+type tableEntry struct {
+	Name string
+	Size int
+	Tags []string
+}
+
+var tableEntries = []interface{}{
+	&tableEntry{Name: "a", Size: 1, Tags: []string{"x"}},
+	tableEntry{Name: "longer name", Size: 12345},
+	map[string]interface{}{"Name": "ünïcode", "Size": 7},
+}
+
+func encodeAll(t *testing.T, enc Encoder, vs []interface{}) {
+	for _, v := range vs {
+		if err := enc.Encode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := CloseEncoder(enc); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTableEncoder(t *testing.T) {
+	tcs := []struct {
+		name     string
+		columns  []Column
+		header   bool
+		width    int
+		values   []interface{}
+		expected string
+	}{
+		{
+			name:    "sized",
+			columns: []Column{{Header: "NAME", Field: "Name"}, {Header: "SIZE", Field: "Size", Align: AlignRight}, {Header: "X"}},
+			header:  true,
+			values:  tableEntries[1:],
+			expected: "NAME          SIZE  X\n" +
+				"longer name  12345  {longer name 12345 []}\n" +
+				"ünïcode          7  map[Name:ünïcode Size:7]\n",
+		},
+		{
+			name:     "no header",
+			columns:  []Column{{Header: "NAME", Field: "Name"}, {Header: "SIZE", Field: "Size"}},
+			values:   tableEntries,
+			expected: "a            1\nlonger name  12345\nünïcode      7\n",
+		},
+		{
+			name:     "fixed widths",
+			columns:  []Column{{Header: "NAME", Field: "Name", Width: 6}, {Header: "SIZE", Field: "Size", Width: 4, Align: AlignRight}},
+			header:   true,
+			values:   tableEntries,
+			expected: "NAME    SIZE\na          1\nlonge…  123…\nünïco…     7\n",
+		},
+		{
+			name:     "fit into width",
+			columns:  []Column{{Header: "NAME", Field: "Name"}, {Header: "SIZE", Field: "Size"}},
+			header:   true,
+			width:    14,
+			values:   tableEntries,
+			expected: "NAME     SIZE\na        1\nlonger…  12345\nünïcode  7\n",
+		},
+	}
+
+	for _, tc := range tcs {
+		var buf bytes.Buffer
+		enc, err := NewTableEncoder(&buf, tc.columns, tc.header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		enc.(*tableEncoder).width = tc.width
+		encodeAll(t, enc, tc.values)
+		if buf.String() != tc.expected {
+			t.Errorf("%s: expected\n%s\ngot\n%s", tc.name, tc.expected, buf.String())
+		}
+	}
+}
+
+func TestTableEncoderStreams(t *testing.T) {
+	var buf bytes.Buffer
+	enc, err := NewTableEncoder(&buf, []Column{{Header: "NAME", Field: "Name", Width: 4}}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Encode(tableEntries[0]); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "NAME\na\n" {
+		t.Errorf("expected the row written right away, got %q", buf.String())
+	}
+}
+
+func TestTextFormatEncoding(t *testing.T) {
+	cmd := &Command{
+		TextFormat: &TextFormat{
+			Columns: []Column{{Header: "NAME", Field: "Name"}, {Header: "SIZE", Field: "Size"}},
+		},
+	}
+	templated := &Command{TextFormat: &TextFormat{Template: "{{.Name}}={{.Size}}"}}
+	custom := &Command{
+		TextFormat: cmd.TextFormat,
+		Encoders: EncoderMap{
+			Text: MakeEncoder(func(req *Request, w io.Writer, v interface{}) error {
+				_, err := w.Write([]byte("custom\n"))
+				return err
+			}),
+		},
+	}
+	root := &Command{Subcommands: map[string]*Command{"table": cmd, "templated": templated, "custom": custom}}
+
+	tcs := []struct {
+		path     string
+		opts     map[string]interface{}
+		expected string
+	}{
+		{"table", nil, "NAME  SIZE\na     1\n"},
+		{"table", map[string]interface{}{NoHeaderOpt: true}, "a  1\n"},
+		{"table", map[string]interface{}{NoHeaderOpt: "true"}, "a  1\n"},
+		{"table", map[string]interface{}{FormatOpt: "{{.Name}} {{join .Tags \",\" | upper}}"}, "a X\n"},
+		{"table", map[string]interface{}{FormatOpt: "{{json .}}"}, `{"Name":"a","Size":1,"Tags":["x"]}` + "\n"},
+		{"templated", nil, "a=1\n"},
+		{"custom", nil, "custom\n"},
+		{"custom", map[string]interface{}{FormatOpt: "{{.Size}}"}, "1\n"},
+	}
+
+	for _, tc := range tcs {
+		opts := map[string]interface{}{EncLong: Text}
+		for k, v := range tc.opts {
+			opts[k] = v
+		}
+		req, err := NewRequest(context.Background(), []string{tc.path}, opts, nil, nil, root)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		_, enc, err := GetEncoder(req, &buf, JSON)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encodeAll(t, enc, tableEntries[:1])
+		if buf.String() != tc.expected {
+			t.Errorf("%s %v: expected %q, got %q", tc.path, tc.opts, tc.expected, buf.String())
+		}
+	}
+
+	req, err := NewRequest(context.Background(), []string{"table"}, map[string]interface{}{EncLong: Text, FormatOpt: "{{.Name"}, nil, nil, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := GetEncoder(req, &bytes.Buffer{}, JSON); err == nil {
+		t.Error("expected an invalid template to be rejected")
+	}
+}
@@ -0,0 +1,73 @@
+package cmds
+
+import (
+	"context"
+)
+
+// Names of the spans started by the frontends, see Tracer.
+const (
+	// CLISpan spans a command line, from parsing it until the result was
+	// printed.
+	CLISpan = "cmds.cli"
+	// ParseSpan spans parsing the command line.
+	ParseSpan = "cmds.parse"
+	// SendSpan spans sending a request with the HTTP client, until the
+	// headers of the response were received.
+	SendSpan = "cmds.send"
+	// DecodeSpan spans decoding an HTTP request in the handler.
+	DecodeSpan = "cmds.decode"
+	// RunSpan spans the Run function of a command.
+	RunSpan = "cmds.run"
+)
+
+// Tracer starts the spans of requests, e.g. with OpenTelemetry, see package
+// tracing. The CLI, the HTTP client and handler and the executor start
+// spans with the Tracer of the context they are passed, see
+// ContextWithTracer.
+type Tracer interface {
+	// Start starts a span named name as child of the span in ctx, if any,
+	// and returns the context holding it.
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	// SetPath sets the path of the command the span is about, once it is
+	// known.
+	SetPath(path []string)
+	// End ends the span with the error of the operation, or nil.
+	End(err error)
+}
+
+type tracerKey struct{}
+
+// ContextWithTracer returns a context making the frontends trace requests
+// with t.
+func ContextWithTracer(ctx context.Context, t Tracer) context.Context {
+	return context.WithValue(ctx, tracerKey{}, t)
+}
+
+// TracerFromContext returns the Tracer of ctx, or nil.
+func TracerFromContext(ctx context.Context) Tracer {
+	if ctx == nil {
+		return nil
+	}
+
+	t, _ := ctx.Value(tracerKey{}).(Tracer)
+	return t
+}
+
+// StartSpan starts a span with the Tracer of ctx. Without Tracer it returns
+// ctx and a span doing nothing.
+func StartSpan(ctx context.Context, name string) (context.Context, Span) {
+	t := TracerFromContext(ctx)
+	if t == nil {
+		return ctx, noopSpan{}
+	}
+	return t.Start(ctx, name)
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetPath([]string) {}
+func (noopSpan) End(error)        {}
@@ -0,0 +1,70 @@
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+type testSpan struct {
+	name string
+	path []string
+	err  error
+	done bool
+}
+
+func (s *testSpan) SetPath(path []string) { s.path = path }
+func (s *testSpan) End(err error)         { s.err, s.done = err, true }
+
+type testTracer struct {
+	spans []*testSpan
+}
+
+func (t *testTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	s := &testSpan{name: name}
+	t.spans = append(t.spans, s)
+	return ctx, s
+}
+
+func TestStartSpanWithoutTracer(t *testing.T) {
+	ctx := context.Background()
+	sctx, span := StartSpan(ctx, RunSpan)
+	if sctx != ctx {
+		t.Error("expected the context to be returned")
+	}
+	span.SetPath([]string{"test"})
+	span.End(nil)
+}
+
+func TestExecutorRunSpan(t *testing.T) {
+	tracer := &testTracer{}
+	ctx := ContextWithTracer(context.Background(), tracer)
+
+	for _, path := range []string{"test", "testError"} {
+		req, err := NewRequest(ctx, []string{path}, nil, nil, nil, root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		re, err := NewWriterResponseEmitter(wc{&buf, nopCloser{}}, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		env := env(1)
+		NewExecutor(root).Execute(req, re, &env)
+	}
+
+	if len(tracer.spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(tracer.spans))
+	}
+	for i, expected := range []error{nil, theError} {
+		s := tracer.spans[i]
+		if s.name != RunSpan || !s.done || s.err != expected {
+			t.Errorf("span %d: expected ended %s span with error %v, got %+v", i, RunSpan, expected, s)
+		}
+	}
+	if strings.Join(tracer.spans[1].path, " ") != "testError" {
+		t.Errorf("expected the path of the command, got %v", tracer.spans[1].path)
+	}
+}
@@ -0,0 +1,109 @@
+/*
+Package tracing traces commands with OpenTelemetry. New adapts an
+OpenTelemetry tracer to a cmds.Tracer, which the CLI, the HTTP client and
+handler and the executor use to span parsing the command line, sending the
+request, decoding it on the server and running the command:
+
+	tracer := tracing.New(provider.Tracer("ipfs"))
+
+	// in the CLI
+	ctx = cmds.ContextWithTracer(ctx, tracer)
+	client := cmdshttp.NewClient(addr, cmdshttp.ClientWithContextValues(tracing.TraceContext))
+
+	// in the daemon, whose environment returns ctx
+	ctx = cmds.ContextWithTracer(ctx, tracer)
+	cfg.ContextValues = append(cfg.ContextValues, tracing.TraceContext)
+
+TraceContext propagates the span of the client to the server in the W3C
+traceparent header, so a command sent to a daemon shows up as one trace.
+*/
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	cmdshttp "github.com/ipfs/go-ipfs-cmds/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// CommandKey is the attribute holding the path of the command, joined by
+// spaces.
+const CommandKey = attribute.Key("cmds.command")
+
+// spanKinds are the kinds of the spans the frontends start, others are
+// internal.
+var spanKinds = map[string]trace.SpanKind{
+	cmds.SendSpan:   trace.SpanKindClient,
+	cmds.DecodeSpan: trace.SpanKindServer,
+}
+
+// New returns a cmds.Tracer starting the spans with t. The spans are named
+// like the span constants of cmds, followed by the path of the command
+// once it is known, e.g. "cmds.run files ls". Spans of failed operations
+// record the error and have the status codes.Error.
+func New(t trace.Tracer) cmds.Tracer {
+	return &tracer{t: t}
+}
+
+type tracer struct {
+	t trace.Tracer
+}
+
+func (t *tracer) Start(ctx context.Context, name string) (context.Context, cmds.Span) {
+	kind, ok := spanKinds[name]
+	if !ok {
+		kind = trace.SpanKindInternal
+	}
+
+	ctx, s := t.t.Start(ctx, name, trace.WithSpanKind(kind))
+	return ctx, &span{s: s, name: name}
+}
+
+type span struct {
+	s    trace.Span
+	name string
+}
+
+func (s *span) SetPath(path []string) {
+	if len(path) == 0 {
+		return
+	}
+
+	cmd := strings.Join(path, " ")
+	s.s.SetName(s.name + " " + cmd)
+	s.s.SetAttributes(CommandKey.String(cmd))
+}
+
+func (s *span) End(err error) {
+	if err != nil {
+		s.s.RecordError(err)
+		s.s.SetStatus(codes.Error, err.Error())
+	}
+	s.s.End()
+}
+
+const traceparentHeader = "traceparent"
+
+// TraceContext propagates the span of the request context from the HTTP
+// client to the handler in the W3C traceparent header, see
+// cmdshttp.ClientWithContextValues and cmdshttp.ServerConfig.ContextValues.
+// The handler continues the trace in the spans of the request, invalid
+// headers are ignored.
+var TraceContext = cmdshttp.ContextValue{
+	Header: traceparentHeader,
+	Encode: func(ctx context.Context) string {
+		carrier := make(propagation.MapCarrier)
+		propagation.TraceContext{}.Inject(ctx, carrier)
+		return carrier.Get(traceparentHeader)
+	},
+	Decode: func(ctx context.Context, value string) (context.Context, error) {
+		carrier := propagation.MapCarrier{traceparentHeader: value}
+		return propagation.TraceContext{}.Extract(ctx, carrier), nil
+	},
+}
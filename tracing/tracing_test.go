@@ -0,0 +1,132 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/go-ipfs-cmds/cli"
+	cmdshttp "github.com/ipfs/go-ipfs-cmds/http"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type env struct {
+	ctx context.Context
+}
+
+func (e env) Context() context.Context { return e.ctx }
+
+func TestTraceCLIToServer(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tracer := New(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)).Tracer("test"))
+
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"echo": {
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					return cmds.EmitOnce(re, "hello")
+				},
+			},
+			"fail": {
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+					return errors.New("failed")
+				},
+			},
+		},
+	}
+
+	cfg := cmdshttp.NewServerConfig()
+	cfg.ContextValues = []cmdshttp.ContextValue{TraceContext}
+	srv := httptest.NewServer(cmdshttp.NewHandler(env{cmds.ContextWithTracer(context.Background(), tracer)}, root, cfg))
+	defer srv.Close()
+
+	out, err := ioutil.TempFile("", "out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	buildEnv := func(ctx context.Context, req *cmds.Request) (cmds.Environment, error) {
+		return env{ctx}, nil
+	}
+	makeExecutor := func(req *cmds.Request, env interface{}) (cmds.Executor, error) {
+		return cmdshttp.NewClient(srv.URL, cmdshttp.ClientWithContextValues(TraceContext)).(cmds.Executor), nil
+	}
+
+	ctx := cmds.ContextWithTracer(context.Background(), tracer)
+	if err := cli.Run(ctx, root, []string{"test", "echo"}, nil, out, out, buildEnv, makeExecutor); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, s := range rec.Ended() {
+		spans[s.Name()] = s
+	}
+	for _, tc := range []struct {
+		name, parent string
+		remote       bool
+	}{
+		{"cmds.cli echo", "", false},
+		{"cmds.parse echo", "cmds.cli echo", false},
+		{"cmds.send echo", "cmds.cli echo", false},
+		{"cmds.decode echo", "cmds.send echo", true},
+		{"cmds.run echo", "cmds.send echo", true},
+	} {
+		s, ok := spans[tc.name]
+		if !ok {
+			t.Errorf("expected span %q, got %v", tc.name, spans)
+			continue
+		}
+		if s.SpanContext().TraceID() != spans["cmds.cli echo"].SpanContext().TraceID() {
+			t.Errorf("expected span %q in the trace of the command line", tc.name)
+		}
+		if tc.parent == "" {
+			if s.Parent().IsValid() {
+				t.Errorf("expected span %q to be the root", tc.name)
+			}
+			continue
+		}
+		if p := spans[tc.parent]; p == nil || s.Parent().SpanID() != p.SpanContext().SpanID() || s.Parent().IsRemote() != tc.remote {
+			t.Errorf("expected span %q to be a child of %q", tc.name, tc.parent)
+		}
+	}
+
+	cli.Run(ctx, root, []string{"test", "fail"}, nil, out, out, buildEnv, makeExecutor)
+	for _, s := range rec.Ended() {
+		if s.Name() == "cmds.run fail" && s.Status().Code != codes.Error {
+			t.Errorf("expected the failed run to have status Error, got %v", s.Status())
+		}
+	}
+}
+
+func TestTraceContextInvalid(t *testing.T) {
+	ctx, err := TraceContext.Decode(context.Background(), "garbage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trace.SpanContextFromContext(ctx).IsValid() {
+		t.Error("expected no span context from an invalid header")
+	}
+
+	if v := TraceContext.Encode(context.Background()); v != "" {
+		t.Errorf("expected no header without span, got %q", v)
+	}
+
+	// round trip
+	ctx = propagation.TraceContext{}.Extract(context.Background(), propagation.MapCarrier{
+		traceparentHeader: "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+	})
+	if v := TraceContext.Encode(ctx); v != "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01" {
+		t.Errorf("unexpected traceparent %q", v)
+	}
+}
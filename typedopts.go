@@ -0,0 +1,264 @@
+package cmds
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+)
+
+// ValidatedOption is an option whose values are checked before the command
+// runs, so Run doesn't have to: NewRequest, used by clients and the HTTP
+// server, and the CLI parser reject invalid values with an
+// *OptionValueError, which is a client error.
+type ValidatedOption interface {
+	cmdkit.Option
+
+	// Validate checks a value of the option. Values given as strings are
+	// passed to Parse first, which may convert them to a typed value.
+	Validate(value interface{}) error
+}
+
+// OptionValueError is returned for invalid option values.
+type OptionValueError struct {
+	// Option is the name of the option.
+	Option string
+	Err    error
+}
+
+func (e *OptionValueError) Error() string {
+	return fmt.Sprintf("invalid value for option %q: %s", e.Option, e.Err)
+}
+
+// ParseOptionValue parses str as a value of opt and validates it if opt is
+// a ValidatedOption.
+func ParseOptionValue(opt cmdkit.Option, str string) (interface{}, error) {
+	v, err := opt.Parse(str)
+	if err != nil {
+		return nil, &OptionValueError{Option: opt.Name(), Err: err}
+	}
+	if err := ValidateOptionValue(opt, v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// ValidateOptionValue validates v if opt is a ValidatedOption.
+func ValidateOptionValue(opt cmdkit.Option, v interface{}) error {
+	vo, ok := opt.(ValidatedOption)
+	if !ok {
+		return nil
+	}
+	if err := vo.Validate(v); err != nil {
+		return &OptionValueError{Option: opt.Name(), Err: err}
+	}
+	return nil
+}
+
+// typedOption is a ValidatedOption built on an option of cmdkit, which is
+// sent as a string and parsed into a typed value.
+type typedOption struct {
+	cmdkit.Option
+
+	// parse, if set, replaces the Parse of the option.
+	parse func(string) (interface{}, error)
+	// validators are called in order until one fails.
+	validators []func(interface{}) error
+	// values are the values an enum option accepts.
+	values []string
+}
+
+func (o *typedOption) Parse(str string) (interface{}, error) {
+	if o.parse != nil {
+		return o.parse(str)
+	}
+	return o.Option.Parse(str)
+}
+
+func (o *typedOption) Validate(v interface{}) error {
+	for _, validate := range o.validators {
+		if err := validate(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *typedOption) WithDefault(v interface{}) cmdkit.Option {
+	o2 := *o
+	o2.Option = o.Option.WithDefault(v)
+	return &o2
+}
+
+func (o *typedOption) Description() string {
+	d := o.Option.Description()
+	if len(o.values) > 0 && d != "" {
+		d += " One of: " + strings.Join(o.values, ", ") + "."
+	}
+	return d
+}
+
+// Values returns the values an option made by EnumOption accepts, nil for
+// other options.
+func (o *typedOption) Values() []string {
+	return o.values
+}
+
+// Enumerated is implemented by options that accept a fixed set of values,
+// e.g. for shell completion.
+type Enumerated interface {
+	Values() []string
+}
+
+// WithValidation returns opt validating its values with validate, after
+// the checks opt does itself if it is a ValidatedOption.
+func WithValidation(opt cmdkit.Option, validate func(value interface{}) error) ValidatedOption {
+	o, ok := opt.(*typedOption)
+	if !ok {
+		o = &typedOption{Option: opt}
+		if vo, ok := opt.(ValidatedOption); ok {
+			o.validators = []func(interface{}) error{vo.Validate}
+		}
+	} else {
+		o2 := *o
+		o = &o2
+	}
+
+	o.validators = append(o.validators[:len(o.validators):len(o.validators)], validate)
+	return o
+}
+
+// DurationOption returns an option whose values are time.Durations, given
+// like "1m30s". Defaults must be time.Durations as well.
+func DurationOption(names ...string) ValidatedOption {
+	return &typedOption{
+		Option: cmdkit.StringOption(names...),
+		parse: func(str string) (interface{}, error) {
+			return time.ParseDuration(str)
+		},
+		validators: []func(interface{}) error{func(v interface{}) error {
+			if _, ok := v.(time.Duration); !ok {
+				return fmt.Errorf("expected a duration, got %T", v)
+			}
+			return nil
+		}},
+	}
+}
+
+// ByteSizeOption returns an option whose values are ByteSizes, given like
+// "10MB" or "512KiB", see ParseByteSize. Defaults must be ByteSizes as well.
+func ByteSizeOption(names ...string) ValidatedOption {
+	return &typedOption{
+		Option: cmdkit.StringOption(names...),
+		parse: func(str string) (interface{}, error) {
+			return ParseByteSize(str)
+		},
+		validators: []func(interface{}) error{func(v interface{}) error {
+			if _, ok := v.(ByteSize); !ok {
+				return fmt.Errorf("expected a byte size, got %T", v)
+			}
+			return nil
+		}},
+	}
+}
+
+// EnumOption returns a string option accepting only values, which are
+// listed in its description.
+func EnumOption(values []string, names ...string) ValidatedOption {
+	return &typedOption{
+		Option: cmdkit.StringOption(names...),
+		values: values,
+		validators: []func(interface{}) error{func(v interface{}) error {
+			s, ok := v.(string)
+			if !ok {
+				return fmt.Errorf("expected a string, got %T", v)
+			}
+			for _, value := range values {
+				if s == value {
+					return nil
+				}
+			}
+			return fmt.Errorf("%q is not one of %s", s, strings.Join(values, ", "))
+		}},
+	}
+}
+
+// ByteSize is a number of bytes.
+type ByteSize uint64
+
+// byteUnits are the units of ByteSizes, largest first within each system.
+var byteUnits = []struct {
+	name string
+	size ByteSize
+}{
+	{"TiB", 1 << 40},
+	{"GiB", 1 << 30},
+	{"MiB", 1 << 20},
+	{"KiB", 1 << 10},
+	{"TB", 1e12},
+	{"GB", 1e9},
+	{"MB", 1e6},
+	{"kB", 1e3},
+	{"B", 1},
+}
+
+// ParseByteSize parses sizes like "10MB", "1.5GiB" or "512", which is in
+// bytes. Units are decimal (kB, MB, GB, TB) or binary (KiB, MiB, GiB, TiB)
+// and case-insensitive.
+func ParseByteSize(str string) (ByteSize, error) {
+	s := strings.TrimSpace(str)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	num, unit := s, ""
+	if i >= 0 {
+		num, unit = s[:i], strings.TrimSpace(s[i:])
+	}
+
+	size := ByteSize(1)
+	if unit != "" {
+		found := false
+		for _, u := range byteUnits {
+			if strings.EqualFold(unit, u.name) {
+				size, found = u.size, true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("invalid byte size %q: unknown unit %q", str, unit)
+		}
+	}
+
+	if n, err := strconv.ParseUint(num, 10, 64); err == nil {
+		if n > math.MaxUint64/uint64(size) {
+			return 0, fmt.Errorf("invalid byte size %q: too large", str)
+		}
+		return ByteSize(n) * size, nil
+	}
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil || num == "" {
+		return 0, fmt.Errorf("invalid byte size %q", str)
+	}
+	f *= float64(size)
+	if f >= math.MaxUint64 {
+		return 0, fmt.Errorf("invalid byte size %q: too large", str)
+	}
+	return ByteSize(math.Round(f)), nil
+}
+
+// String returns s in the largest unit that divides it, e.g. "10MiB", so it
+// is parsed back into the same size.
+func (s ByteSize) String() string {
+	unit := byteUnits[len(byteUnits)-1]
+	if s != 0 {
+		for _, u := range byteUnits {
+			if s%u.size == 0 && u.size > unit.size {
+				unit = u
+			}
+		}
+	}
+	return strconv.FormatUint(uint64(s/unit.size), 10) + unit.name
+}
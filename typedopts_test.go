@@ -0,0 +1,127 @@
+package cmds
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tcs := []struct {
+		str  string
+		size ByteSize
+		err  bool
+	}{
+		{str: "512", size: 512},
+		{str: "512B", size: 512},
+		{str: "10MB", size: 10e6},
+		{str: "10mb", size: 10e6},
+		{str: "1kB", size: 1000},
+		{str: "512KiB", size: 512 << 10},
+		{str: "1.5GiB", size: 3 << 29},
+		{str: " 2 TB ", size: 2e12},
+		{str: "", err: true},
+		{str: "MB", err: true},
+		{str: "10XB", err: true},
+		{str: "-1", err: true},
+		{str: "20000000TiB", err: true},
+	}
+
+	for _, tc := range tcs {
+		size, err := ParseByteSize(tc.str)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %d", tc.str, size)
+			}
+			continue
+		}
+		if err != nil || size != tc.size {
+			t.Errorf("%q: expected %d, got %d, %v", tc.str, tc.size, size, err)
+		}
+	}
+
+	for _, size := range []ByteSize{0, 1, 999, 1000, 1024, 10e6, 3 << 29, 1<<40 + 1} {
+		if parsed, err := ParseByteSize(size.String()); err != nil || parsed != size {
+			t.Errorf("%d was printed as %q and parsed as %d, %v", size, size.String(), parsed, err)
+		}
+	}
+	if s := ByteSize(10 << 20).String(); s != "10MiB" {
+		t.Errorf("expected 10MiB, got %q", s)
+	}
+}
+
+func TestTypedOptions(t *testing.T) {
+	root := &Command{
+		Options: []cmdkit.Option{
+			DurationOption("timeout", "t", "a timeout").WithDefault(time.Minute),
+			ByteSizeOption("size", "a size"),
+			EnumOption([]string{"fast", "slow"}, "mode", "a mode"),
+			WithValidation(cmdkit.IntOption("count", "a count"), func(v interface{}) error {
+				if v.(int) <= 0 {
+					return errors.New("must be positive")
+				}
+				return nil
+			}),
+		},
+	}
+
+	tcs := []struct {
+		opts map[string]interface{}
+		name string
+		val  interface{}
+		err  string
+	}{
+		{opts: map[string]interface{}{"timeout": "1m30s"}, name: "timeout", val: 90 * time.Second},
+		{opts: map[string]interface{}{"t": time.Second}, name: "t", val: time.Second},
+		{opts: map[string]interface{}{"size": "10MB"}, name: "size", val: ByteSize(10e6)},
+		{opts: map[string]interface{}{"mode": "fast"}, name: "mode", val: "fast"},
+		{opts: map[string]interface{}{"count": "3"}, name: "count", val: 3},
+		{opts: map[string]interface{}{"count": 3}, name: "count", val: 3},
+		{opts: map[string]interface{}{"timeout": "soon"}, err: `invalid value for option "timeout": time: invalid duration "soon"`},
+		{opts: map[string]interface{}{"timeout": 5}, err: `invalid value for option "timeout": expected a duration, got int`},
+		{opts: map[string]interface{}{"size": "10XB"}, err: `invalid value for option "size": invalid byte size "10XB": unknown unit "XB"`},
+		{opts: map[string]interface{}{"mode": "medium"}, err: `invalid value for option "mode": "medium" is not one of fast, slow`},
+		{opts: map[string]interface{}{"count": "0"}, err: `invalid value for option "count": must be positive`},
+	}
+
+	for _, tc := range tcs {
+		req, err := NewRequest(context.Background(), nil, tc.opts, nil, nil, root)
+		if tc.err != "" {
+			if _, ok := err.(*OptionValueError); !ok || err.Error() != tc.err {
+				t.Errorf("%v: expected the error %q, got %v", tc.opts, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error: %s", tc.opts, err)
+			continue
+		}
+		if v := req.Options[tc.name]; v != tc.val {
+			t.Errorf("%v: expected %#v, got %#v", tc.opts, tc.val, v)
+		}
+	}
+
+	mode := root.Options[2]
+	if values := mode.(Enumerated).Values(); len(values) != 2 || values[0] != "fast" {
+		t.Errorf("expected the enum values, got %v", values)
+	}
+	if d := mode.Description(); d != "a mode. One of: fast, slow." {
+		t.Errorf("unexpected description %q", d)
+	}
+
+	big := WithValidation(root.Options[1], func(v interface{}) error {
+		if v.(ByteSize) < 1e6 {
+			return errors.New("too small")
+		}
+		return nil
+	})
+	if _, err := ParseOptionValue(big, "1kB"); err == nil {
+		t.Error("expected the added validation to fail")
+	}
+	if _, err := ParseOptionValue(root.Options[1], "1kB"); err != nil {
+		t.Errorf("expected the option to be unchanged, got %v", err)
+	}
+}
@@ -0,0 +1,184 @@
+package cmds
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"reflect"
+
+	"github.com/ipfs/go-ipfs-cmds/cbor"
+)
+
+// TaggedValue is a value of a command with several output types, tagged
+// with the name of its type in Command.Types. Emitters encoding the values,
+// e.g. for HTTP, send tagged values, and responses decoding them return the
+// Value.
+type TaggedValue struct {
+	ValueType string
+	Value     interface{}
+}
+
+// typeName returns the name of the type of v in types.
+func typeName(types map[string]interface{}, v interface{}) (string, bool) {
+	t := derefType(reflect.TypeOf(v))
+	for name, typ := range types {
+		if derefType(reflect.TypeOf(typ)) == t {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+func derefType(t reflect.Type) reflect.Type {
+	if t != nil && t.Kind() == reflect.Ptr {
+		return t.Elem()
+	}
+	return t
+}
+
+// TagValue returns the value an emitter encoding values with encType
+// should encode for v: a TaggedValue if the command of req has several
+// output types and the encoding can be decoded, and v otherwise. Values of
+// types not in Command.Types are returned as they are.
+func TagValue(req *Request, encType EncodingType, v interface{}) interface{} {
+	if req.Command == nil || req.Command.Types == nil {
+		return v
+	}
+	if _, ok := req.Command.Encoders[encType]; ok || hasTypedEncoder(req, encType, v) {
+		// custom encoders expect the values of the command
+		return v
+	}
+	if _, ok := Decoders[encType]; !ok {
+		return v
+	}
+
+	name, ok := typeName(req.Command.Types, v)
+	if !ok {
+		return v
+	}
+	return &TaggedValue{ValueType: name, Value: v}
+}
+
+// taggedDecoder decodes tagged values into a new value of their type.
+type taggedDecoder struct {
+	types map[string]interface{}
+	value interface{}
+}
+
+// newValue returns a pointer to a new value of the type named name.
+func (d *taggedDecoder) newValue(name string) (interface{}, error) {
+	typ, ok := d.types[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown value type %q", name)
+	}
+	return reflect.New(derefType(reflect.TypeOf(typ))).Interface(), nil
+}
+
+func (d *taggedDecoder) UnmarshalJSON(data []byte) error {
+	if trimmed := bytes.TrimLeft(data, " \t\r\n"); len(trimmed) == 0 || trimmed[0] != '{' {
+		// a value of a type not in Command.Types, e.g. a string
+		return json.Unmarshal(data, &d.value)
+	}
+
+	var tv struct {
+		ValueType string
+		Value     json.RawMessage
+	}
+	if err := json.Unmarshal(data, &tv); err != nil {
+		return err
+	}
+	if tv.ValueType == "" {
+		// a value of a type not in Command.Types
+		return json.Unmarshal(data, &d.value)
+	}
+
+	v, err := d.newValue(tv.ValueType)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(tv.Value, v); err != nil {
+		return err
+	}
+	d.value = v
+	return nil
+}
+
+func (d *taggedDecoder) UnmarshalCBOR(data []byte) error {
+	var tv struct {
+		ValueType string
+		Value     cbor.RawMessage
+	}
+	if err := cbor.Unmarshal(data, &tv); err != nil || tv.ValueType == "" {
+		// a value of a type not in Command.Types
+		return cbor.Unmarshal(data, &d.value)
+	}
+
+	v, err := d.newValue(tv.ValueType)
+	if err != nil {
+		return err
+	}
+	if err := cbor.Unmarshal(tv.Value, v); err != nil {
+		return err
+	}
+	d.value = v
+	return nil
+}
+
+func (d *taggedDecoder) UnmarshalXML(dec *xml.Decoder, start xml.StartElement) error {
+	var name string
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			switch tok.Name.Local {
+			case "ValueType":
+				if err := dec.DecodeElement(&name, &tok); err != nil {
+					return err
+				}
+			case "Value":
+				v, err := d.newValue(name)
+				if err != nil {
+					return err
+				}
+				if err := dec.DecodeElement(v, &tok); err != nil {
+					return err
+				}
+				d.value = v
+			default:
+				if err := dec.Skip(); err != nil {
+					return err
+				}
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// Unwrap returns the decoded value.
+func (d *taggedDecoder) Unwrap() interface{} {
+	return Unwrap(d.value)
+}
+
+// NewValue returns the value a response should decode the next value of
+// cmd into: a pointer to a new value of the Type of cmd, or, if cmd has
+// several output types, a decoder of tagged values, which is an Unwrapper
+// returning the decoded value. It returns nil if cmd has no Type.
+func NewValue(cmd *Command) interface{} {
+	if cmd == nil {
+		return nil
+	}
+	if cmd.Types != nil {
+		return &taggedDecoder{types: cmd.Types}
+	}
+
+	if t := derefType(reflect.TypeOf(cmd.Type)); t != nil {
+		return reflect.New(t).Interface()
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+)
+
+type progress struct {
+	Done int
+}
+
+type result struct {
+	Hash string
+}
+
+func TestTaggedValues(t *testing.T) {
+	cmd := &Command{
+		Types: map[string]interface{}{
+			"progress": progress{},
+			"result":   &result{},
+		},
+	}
+
+	for _, enc := range []EncodingType{JSON, XML, CBOR} {
+		req, err := NewRequest(context.Background(), nil, map[string]interface{}{EncLong: string(enc)}, nil, nil, cmd)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		re, err := NewWriterResponseEmitter(wc{&buf, nopCloser{}}, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range []interface{}{&progress{1}, progress{2}, &result{"Qm"}} {
+			if err := re.Emit(v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		re.Close()
+
+		res, err := NewReaderResponse(&buf, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var values []interface{}
+		for {
+			v, err := res.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: %s", enc, err)
+			}
+			values = append(values, v)
+		}
+
+		if len(values) != 3 {
+			t.Fatalf("%s: expected 3 values but got %v", enc, values)
+		}
+		if p, ok := values[1].(*progress); !ok || p.Done != 2 {
+			t.Errorf("%s: expected the progress value, got %#v", enc, values[1])
+		}
+		if r, ok := values[2].(*result); !ok || r.Hash != "Qm" {
+			t.Errorf("%s: expected the result value, got %#v", enc, values[2])
+		}
+	}
+
+	// values of types not in Types are returned as they are
+	for _, enc := range []EncodingType{JSON, CBOR} {
+		req, err := NewRequest(context.Background(), nil, map[string]interface{}{EncLong: string(enc)}, nil, nil, cmd)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		re, err := NewWriterResponseEmitter(wc{&buf, nopCloser{}}, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := re.Emit("untagged"); err != nil {
+			t.Fatal(err)
+		}
+		re.Close()
+
+		res, err := NewReaderResponse(&buf, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v, err := res.Next(); err != nil || v != "untagged" {
+			t.Errorf("%s: expected the untagged string, got %#v, %v", enc, v, err)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package cmds
+
+import (
+	"sort"
+	"strings"
+)
+
+// UnknownOptionPolicy selects how options that aren't defined for the
+// command of a request are handled, e.g. options a newer client sends to an
+// older server, see CheckUnknownOptions.
+type UnknownOptionPolicy int
+
+const (
+	// PassUnknownOptions passes unknown options on to the command, which
+	// usually ignores them.
+	PassUnknownOptions UnknownOptionPolicy = iota
+	// IgnoreUnknownOptions removes unknown options from the request and
+	// reports them, so the caller can warn about them.
+	IgnoreUnknownOptions
+	// RejectUnknownOptions fails requests with unknown options.
+	RejectUnknownOptions
+)
+
+// builtinOptions are handled by this package and the transports, so they
+// are known to every command even if the tree doesn't define them.
+var builtinOptions = map[string]bool{
+	EncLong:      true,
+	EncShort:     true,
+	ChanOpt:      true,
+	BufferOpt:    true,
+	TimeoutOpt:   true,
+	WidthOpt:     true,
+	LangOpt:      true,
+	ProfileOpt:   true,
+	StatsOpt:     true,
+	ResumeOpt:    true,
+	CompressOpt:  true,
+	PostRunOpt:   true,
+	XMLRootOpt:   true,
+	ValidateOpt:  true,
+	FormatOpt:    true,
+	NoHeaderOpt:  true,
+	LimitOpt:     true,
+	OffsetOpt:    true,
+	CursorOpt:    true,
+	OptLongHelp:  true,
+	OptShortHelp: true,
+}
+
+// UnknownOptions returns the sorted names of the options of req that
+// aren't defined for its command or its parents. It returns nil if one of
+// the commands sets AllowUnknownOptions.
+func (req *Request) UnknownOptions() []string {
+	cmds, err := req.Root.Resolve(req.Path)
+	if err != nil {
+		return nil
+	}
+	for _, cmd := range cmds {
+		if cmd.AllowUnknownOptions {
+			return nil
+		}
+	}
+
+	optDefs, err := req.Root.GetOptions(req.Path)
+	if err != nil {
+		return nil
+	}
+
+	var unknown []string
+	for name := range req.Options {
+		if _, ok := optDefs[name]; !ok && !builtinOptions[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+
+	return unknown
+}
+
+// CheckUnknownOptions applies policy to the unknown options of req. It
+// returns the options it removed from req, or a client error if the policy
+// rejects them.
+func CheckUnknownOptions(req *Request, policy UnknownOptionPolicy) ([]string, error) {
+	if policy == PassUnknownOptions {
+		return nil, nil
+	}
+
+	unknown := req.UnknownOptions()
+	if len(unknown) == 0 {
+		return nil, nil
+	}
+
+	if policy == RejectUnknownOptions {
+		return nil, ClientError("unknown options for command " + strings.Join(req.Path, " ") + ": " + strings.Join(unknown, ", "))
+	}
+
+	for _, name := range unknown {
+		delete(req.Options, name)
+	}
+	return unknown, nil
+}
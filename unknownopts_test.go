@@ -0,0 +1,59 @@
+package cmds
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+)
+
+func TestCheckUnknownOptions(t *testing.T) {
+	root := &Command{
+		Options: []cmdkit.Option{cmdkit.BoolOption("global", "g", "")},
+		Subcommands: map[string]*Command{
+			"known": {
+				Options: []cmdkit.Option{cmdkit.StringOption("name", "")},
+			},
+			"open": {AllowUnknownOptions: true},
+		},
+	}
+
+	newRequest := func(path string) *Request {
+		req, err := NewRequest(context.Background(), []string{path}, map[string]interface{}{
+			"g":     true,
+			"name":  "n",
+			"newer": "x",
+			EncLong: JSON,
+		}, nil, nil, root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+
+	if unknown := newRequest("known").UnknownOptions(); !reflect.DeepEqual(unknown, []string{"newer"}) {
+		t.Errorf("expected the unknown option, got %v", unknown)
+	}
+	if unknown := newRequest("open").UnknownOptions(); unknown != nil {
+		t.Errorf("expected commands allowing unknown options to have none, got %v", unknown)
+	}
+
+	req := newRequest("known")
+	if ignored, err := CheckUnknownOptions(req, PassUnknownOptions); err != nil || ignored != nil {
+		t.Errorf("expected unknown options to be passed, got %v, %v", ignored, err)
+	}
+
+	ignored, err := CheckUnknownOptions(req, IgnoreUnknownOptions)
+	if err != nil || !reflect.DeepEqual(ignored, []string{"newer"}) {
+		t.Errorf("expected the unknown option to be ignored, got %v, %v", ignored, err)
+	}
+	if _, ok := req.Options["newer"]; ok {
+		t.Error("expected the ignored option to be removed")
+	}
+
+	_, err = CheckUnknownOptions(newRequest("known"), RejectUnknownOptions)
+	if e, ok := err.(*cmdkit.Error); !ok || e.Code != cmdkit.ErrClient {
+		t.Errorf("expected a client error, got %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+package cmds
+
+import (
+	"reflect"
+)
+
+// Unwrapper is implemented by values that should be replaced by another
+// value before they are encoded or handed to a consumer, see Unwrap.
+type Unwrapper interface {
+	Unwrap() interface{}
+}
+
+// Unwrap returns the value v stands for: the result of Unwrap if v is an
+// Unwrapper, the value pointed to if v is a non-nil pointer to a string,
+// bool or number, and v otherwise. Responses decoding values into pointers
+// to the Type of the command use it, so consumers see the same values as
+// the command emitted.
+func Unwrap(v interface{}) interface{} {
+	if u, ok := v.(Unwrapper); ok {
+		return u.Unwrap()
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return v
+	}
+
+	switch rv.Elem().Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return rv.Elem().Interface()
+	}
+
+	return v
+}
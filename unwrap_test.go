@@ -0,0 +1,71 @@
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+)
+
+type testUnwrapper struct {
+	v interface{}
+}
+
+func (u testUnwrapper) Unwrap() interface{} {
+	return u.v
+}
+
+func TestUnwrap(t *testing.T) {
+	var (
+		s      = "some value"
+		i      = 42
+		f      = 1.5
+		out    = &TestOutput{Foo: "a"}
+		nilInt *int
+	)
+
+	tcs := []struct {
+		v, expected interface{}
+	}{
+		{&s, s},
+		{&i, i},
+		{&f, f},
+		{s, s},
+		{out, out},
+		{nilInt, nilInt},
+		{testUnwrapper{&s}, &s},
+		{nil, nil},
+	}
+
+	for _, tc := range tcs {
+		if v := Unwrap(tc.v); !reflect.DeepEqual(v, tc.expected) {
+			t.Errorf("Unwrap(%#v): expected %#v but got %#v", tc.v, tc.expected, v)
+		}
+	}
+}
+
+func TestReaderResponseUnwrap(t *testing.T) {
+	cmd := &Command{Type: ""}
+	req, err := NewRequest(context.Background(), nil, map[string]interface{}{EncLong: JSON}, nil, nil, cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	re, err := NewWriterResponseEmitter(wc{&buf, nopCloser{}}, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := re.Emit("value"); err != nil {
+		t.Fatal(err)
+	}
+	re.Close()
+
+	res, err := NewReaderResponse(&buf, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := res.Next(); err != nil || v != "value" {
+		t.Errorf("expected the string, got %#v, %v", v, err)
+	}
+}
@@ -0,0 +1,101 @@
+package cmds
+
+// DiagnosticKind describes the kind of problem a Diagnostic reports.
+type DiagnosticKind string
+
+const (
+	// DiagnosticRequest is reported if the request couldn't be parsed, e.g.
+	// because an option value has the wrong type or, for the HTTP handler,
+	// because a required argument is missing.
+	DiagnosticRequest DiagnosticKind = "request"
+	// DiagnosticNotCallable is reported if the command only groups
+	// subcommands.
+	DiagnosticNotCallable DiagnosticKind = "not-callable"
+	// DiagnosticUnknownOption is reported for every option the command and
+	// its parents don't define.
+	DiagnosticUnknownOption DiagnosticKind = "unknown-option"
+	// DiagnosticArguments is reported if the arguments don't match the
+	// argument definitions of the command.
+	DiagnosticArguments DiagnosticKind = "arguments"
+	// DiagnosticPreRun is reported if the PreRun of the command failed.
+	DiagnosticPreRun DiagnosticKind = "prerun"
+)
+
+// Diagnostic is a problem found when validating a request.
+type Diagnostic struct {
+	Kind    DiagnosticKind `json:"kind"`
+	Message string         `json:"message"`
+	// Option is the name of the option the diagnostic is about, if any.
+	Option string `json:"option,omitempty"`
+}
+
+// Validation is the result of validating a request.
+type Validation struct {
+	Path        []string     `json:"path"`
+	Valid       bool         `json:"valid"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+// Validator is implemented by executors that can check a request without
+// running it, including the ones returned by NewExecutor and
+// NewEnvironmentExecutor.
+type Validator interface {
+	Validate(req *Request, env Environment) Validation
+}
+
+// ValidateRequest checks req like executing it would, without calling Run:
+// it checks that the command can be called, its options and arguments, and
+// calls its PreRun. Commands whose PreRun has side effects should keep them
+// out of validations, e.g. by checking the request context.
+func ValidateRequest(req *Request, env Environment) Validation {
+	v := Validation{Path: req.Path, Diagnostics: []Diagnostic{}}
+	if v.Path == nil {
+		v.Path = []string{}
+	}
+	report := func(kind DiagnosticKind, msg, opt string) {
+		v.Diagnostics = append(v.Diagnostics, Diagnostic{Kind: kind, Message: msg, Option: opt})
+	}
+
+	cmd := req.Command
+	if cmd.Run == nil {
+		report(DiagnosticNotCallable, ErrNotCallable.Error(), "")
+	}
+
+	for _, name := range req.UnknownOptions() {
+		report(DiagnosticUnknownOption, "unknown option "+name, name)
+	}
+
+	if err := cmd.CheckArguments(req); err != nil {
+		report(DiagnosticArguments, err.Error(), "")
+	}
+
+	// only run PreRun for requests that would get that far
+	if len(v.Diagnostics) == 0 && cmd.PreRun != nil {
+		if err := cmd.PreRun(req, env); err != nil {
+			report(DiagnosticPreRun, err.Error(), "")
+		}
+	}
+
+	v.Valid = len(v.Diagnostics) == 0
+	return v
+}
+
+// Validate checks req without executing it, see ValidateRequest.
+func (x *executor) Validate(req *Request, env Environment) Validation {
+	return ValidateRequest(req, env)
+}
+
+// Validate makes the environment of req and checks req in it. Failing to
+// make the environment is reported as a PreRun diagnostic.
+func (x *envExecutor) Validate(req *Request, _ Environment) Validation {
+	env, err := x.makeEnv(req.Context, req)
+	if err != nil {
+		return Validation{
+			Path:        req.Path,
+			Diagnostics: []Diagnostic{{Kind: DiagnosticPreRun, Message: err.Error()}},
+		}
+	}
+	defer CloseEnvironment(env)
+
+	return ValidateRequest(req, env)
+}
@@ -0,0 +1,76 @@
+package cmds
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+)
+
+func TestValidate(t *testing.T) {
+	var ran, preRan bool
+	vroot := &Command{
+		Subcommands: map[string]*Command{
+			"add": {
+				Arguments: []cmdkit.Argument{cmdkit.StringArg("name", true, false, "the name")},
+				Options:   []cmdkit.Option{cmdkit.BoolOption("force", "f", "overwrite")},
+				PreRun: func(req *Request, env Environment) error {
+					preRan = true
+					if req.Arguments[0] == "forbidden" {
+						return errors.New("not allowed")
+					}
+					return nil
+				},
+				Run: func(req *Request, re ResponseEmitter, env Environment) error {
+					ran = true
+					return nil
+				},
+			},
+			"group": {
+				Subcommands: map[string]*Command{"sub": {}},
+			},
+		},
+	}
+
+	x, ok := NewExecutor(vroot).(Validator)
+	if !ok {
+		t.Fatal("expected the executor to be a Validator")
+	}
+
+	for _, tc := range []struct {
+		path  []string
+		args  []string
+		opts  cmdkit.OptMap
+		kinds []DiagnosticKind
+	}{
+		{path: []string{"add"}, args: []string{"a"}, opts: cmdkit.OptMap{"force": true}},
+		{path: []string{"add"}, kinds: []DiagnosticKind{DiagnosticArguments}},
+		{path: []string{"add"}, args: []string{"a"}, opts: cmdkit.OptMap{"forse": true}, kinds: []DiagnosticKind{DiagnosticUnknownOption}},
+		{path: []string{"add"}, args: []string{"forbidden"}, kinds: []DiagnosticKind{DiagnosticPreRun}},
+		{path: []string{"group"}, kinds: []DiagnosticKind{DiagnosticNotCallable}},
+	} {
+		req, err := NewRequest(context.Background(), tc.path, tc.opts, tc.args, nil, vroot)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		v := x.Validate(req, nil)
+		if v.Valid != (len(tc.kinds) == 0) || len(v.Diagnostics) != len(tc.kinds) {
+			t.Errorf("%v %v: expected diagnostics %v but got %+v", tc.path, tc.args, tc.kinds, v)
+			continue
+		}
+		for i, kind := range tc.kinds {
+			if v.Diagnostics[i].Kind != kind {
+				t.Errorf("%v %v: expected diagnostics %v but got %+v", tc.path, tc.args, tc.kinds, v)
+			}
+		}
+	}
+
+	if ran {
+		t.Error("validating must not run the command")
+	}
+	if !preRan {
+		t.Error("expected the PreRun to be called")
+	}
+}
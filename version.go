@@ -0,0 +1,110 @@
+package cmds
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+)
+
+// BuildInfo is the build metadata of an application, see VersionCommand.
+type BuildInfo struct {
+	// Name is the name of the application, e.g. "ipfs".
+	Name    string
+	Version string
+	// Commit is the commit the application was built from. It defaults to
+	// the revision recorded by the go tool.
+	Commit string
+	// BuildDate is the time the application was built.
+	BuildDate string
+}
+
+// VersionOutput is the output of the command built by VersionCommand.
+type VersionOutput struct {
+	Version   string
+	Commit    string
+	BuildDate string
+	// System is the architecture and operating system, e.g. amd64/linux.
+	System string
+	Golang string
+}
+
+// VersionCommand returns a standard version command reporting info. By
+// default, it prints "<name> version <version>"; its options select other
+// forms of the output:
+//
+//	--number, -n	only the version number
+//	--commit	the commit hash appended to the version
+//	--all		all version information
+//
+// Other encodings, e.g. JSON, always contain all of the VersionOutput.
+func VersionCommand(info BuildInfo) *Command {
+	if info.Commit == "" {
+		info.Commit = vcsRevision()
+	}
+
+	return &Command{
+		Helptext: cmdkit.HelpText{
+			Tagline:          fmt.Sprintf("Show %s version information.", info.Name),
+			ShortDescription: fmt.Sprintf("Returns the current version of %s and exits.", info.Name),
+		},
+		Options: []cmdkit.Option{
+			cmdkit.BoolOption("number", "n", "Only show the version number."),
+			cmdkit.BoolOption("commit", "Show the commit hash."),
+			cmdkit.BoolOption("all", "Show all version information"),
+		},
+		Run: func(req *Request, re ResponseEmitter, env Environment) error {
+			return re.Emit(&VersionOutput{
+				Version:   info.Version,
+				Commit:    info.Commit,
+				BuildDate: info.BuildDate,
+				System:    runtime.GOARCH + "/" + runtime.GOOS,
+				Golang:    runtime.Version(),
+			})
+		},
+		Encoders: EncoderMap{
+			Text: MakeTypedEncoder(func(req *Request, w io.Writer, v *VersionOutput) error {
+				if all, _ := req.Options["all"].(bool); all {
+					_, err := fmt.Fprintf(w, "%s version: %s\nCommit: %s\nBuild date: %s\nSystem version: %s\nGolang version: %s\n",
+						info.Name, v.Version, v.Commit, v.BuildDate, v.System, v.Golang)
+					return err
+				}
+
+				version := v.Version
+				if commit, _ := req.Options["commit"].(bool); commit && v.Commit != "" {
+					version += "-" + v.Commit
+				}
+
+				if number, _ := req.Options["number"].(bool); number {
+					_, err := fmt.Fprintln(w, version)
+					return err
+				}
+
+				_, err := fmt.Fprintf(w, "%s version %s\n", info.Name, version)
+				return err
+			}),
+		},
+		Type: VersionOutput{},
+	}
+}
+
+// vcsRevision returns the short commit hash the go tool recorded in the
+// binary, if any.
+func vcsRevision() string {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+
+	for _, s := range bi.Settings {
+		if s.Key == "vcs.revision" {
+			if len(s.Value) > 7 {
+				return s.Value[:7]
+			}
+			return s.Value
+		}
+	}
+	return ""
+}
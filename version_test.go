@@ -0,0 +1,57 @@
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestVersionCommand(t *testing.T) {
+	root := &Command{
+		Subcommands: map[string]*Command{
+			"version": VersionCommand(BuildInfo{
+				Name:      "app",
+				Version:   "1.2.3",
+				Commit:    "abcdef0",
+				BuildDate: "2018-01-02",
+			}),
+		},
+	}
+
+	tcs := []struct {
+		opts     map[string]interface{}
+		expected string
+	}{
+		{nil, "app version 1.2.3\n"},
+		{map[string]interface{}{"commit": true}, "app version 1.2.3-abcdef0\n"},
+		{map[string]interface{}{"number": true, "commit": true}, "1.2.3-abcdef0\n"},
+		{map[string]interface{}{"all": true}, "app version: 1.2.3\nCommit: abcdef0\nBuild date: 2018-01-02\n"},
+	}
+
+	for _, tc := range tcs {
+		req, err := NewRequest(context.Background(), []string{"version"}, tc.opts, nil, nil, root)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		re, res := NewChanResponsePair(req)
+		go root.Call(req, re, nil)
+
+		v, err := res.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, ok := v.(*VersionOutput)
+		if !ok || out.Version != "1.2.3" || out.System == "" {
+			t.Fatalf("unexpected output %#v", v)
+		}
+
+		var buf bytes.Buffer
+		if err := req.Command.Encoders[Text](req)(&buf).Encode(out); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(buf.Bytes(), []byte(tc.expected)) {
+			t.Errorf("%v: expected %q but got %q", tc.opts, tc.expected, buf.String())
+		}
+	}
+}
@@ -2,17 +2,28 @@ package cmds
 
 import (
 	"encoding/json"
+	"encoding/xml"
 	"errors"
 	"io"
 	"reflect"
 	"sync"
 
 	"github.com/ipfs/go-ipfs-cmdkit"
+	"github.com/ipfs/go-ipfs-cmds/cbor"
 	"github.com/ipfs/go-ipfs-cmds/debug"
 )
 
 func NewWriterResponseEmitter(w io.WriteCloser, req *Request) (ResponseEmitter, error) {
-	_, valEnc, err := GetEncoder(req, w, Undefined)
+	var (
+		out io.Writer = w
+		cw  CompressWriter
+	)
+	if compressionRequested(req) {
+		cw = newCompressWriter(req, w)
+		out = cw
+	}
+
+	_, valEnc, err := GetEncoder(req, out, Undefined)
 	if err != nil {
 		return nil, err
 	}
@@ -20,6 +31,7 @@ func NewWriterResponseEmitter(w io.WriteCloser, req *Request) (ResponseEmitter,
 	re := &writerResponseEmitter{
 		w:   w,
 		c:   w,
+		cw:  cw,
 		req: req,
 		enc: valEnc,
 	}
@@ -33,6 +45,9 @@ func NewReaderResponse(r io.Reader, req *Request) (Response, error) {
 	if !ok {
 		return nil, cmdkit.Errorf(cmdkit.ErrClient, "unknown encoding: %s", encType)
 	}
+	if compressionRequested(req) {
+		r = &decompressReader{r: r}
+	}
 	return &readerResponse{
 		req:     req,
 		r:       r,
@@ -77,7 +92,11 @@ func (r *readerResponse) Length() uint64 {
 }
 
 func (r *readerResponse) Next() (interface{}, error) {
-	m := &MaybeError{Value: r.req.Command.Type}
+	value := r.req.Command.Type
+	if r.req.Command.Types != nil {
+		value = NewValue(r.req.Command)
+	}
+	m := &MaybeError{Value: value}
 	err := r.dec.Decode(m)
 	if err != nil {
 		return nil, err
@@ -86,9 +105,10 @@ func (r *readerResponse) Next() (interface{}, error) {
 	r.once.Do(func() { close(r.emitted) })
 
 	v, err := m.Get()
+	v = Unwrap(v)
 
 	// because working with pointers to arrays is annoying
-	if t := reflect.TypeOf(v); t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Slice {
+	if t := reflect.TypeOf(v); t != nil && t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Slice {
 		v = reflect.ValueOf(v).Elem().Interface()
 	}
 	return v, err
@@ -98,6 +118,7 @@ type writerResponseEmitter struct {
 	// TODO maybe make those public?
 	w   io.Writer
 	c   io.Closer
+	cw  CompressWriter
 	enc Encoder
 	req *Request
 
@@ -142,6 +163,16 @@ func (re *writerResponseEmitter) Close() error {
 	}
 
 	re.closed = true
+	if err := CloseEncoder(re.enc); err != nil {
+		re.c.Close()
+		return err
+	}
+	if re.cw != nil {
+		if err := re.cw.Close(); err != nil {
+			re.c.Close()
+			return err
+		}
+	}
 	return re.c.Close()
 }
 
@@ -174,11 +205,30 @@ func (re *writerResponseEmitter) Emit(v interface{}) error {
 		isSingle = true
 	}
 
-	err := re.enc.Encode(v)
+	var out io.Writer = re.w
+	if re.cw != nil {
+		out = re.cw
+	}
+	encType := GetEncoding(re.req, Undefined)
+	if p, ok := v.(*Progress); ok {
+		if v, ok = TagProgress(re.req, encType, p); !ok {
+			return nil
+		}
+	}
+	streamed, err := StreamValue(re.req, out, re.enc, encType, v)
+	if !streamed {
+		err = re.enc.Encode(TagValue(re.req, encType, v))
+	}
 	if err != nil {
 		return err
 	}
 
+	if re.cw != nil {
+		if err := re.cw.Flush(); err != nil {
+			return err
+		}
+	}
+
 	if isSingle {
 		return re.Close()
 	}
@@ -200,6 +250,14 @@ func (m *MaybeError) Get() (interface{}, error) {
 	return m.Value, nil
 }
 
+// setProgress makes p, which was sent in place of a value, the value.
+func (m *MaybeError) setProgress(p *Progress) {
+	if p == nil {
+		p = &Progress{}
+	}
+	m.Value = p
+}
+
 func (m *MaybeError) UnmarshalJSON(data []byte) error {
 	var e cmdkit.Error
 	err := json.Unmarshal(data, &e)
@@ -209,6 +267,12 @@ func (m *MaybeError) UnmarshalJSON(data []byte) error {
 		return nil
 	}
 
+	var f progressFrame
+	if json.Unmarshal(data, &f) == nil && f.ValueType == ProgressValueType {
+		m.setProgress(f.Value)
+		return nil
+	}
+
 	if m.Value != nil {
 		// make sure we are working with a pointer here
 		v := reflect.ValueOf(m.Value)
@@ -224,3 +288,68 @@ func (m *MaybeError) UnmarshalJSON(data []byte) error {
 
 	return err
 }
+
+// UnmarshalCBOR decodes a CBOR encoded value or error.
+func (m *MaybeError) UnmarshalCBOR(data []byte) error {
+	if e, err := unmarshalCBORError(data); err == nil {
+		m.isError = true
+		m.Error = e
+		return nil
+	}
+
+	var f progressFrame
+	if cbor.Unmarshal(data, &f) == nil && f.ValueType == ProgressValueType {
+		m.setProgress(f.Value)
+		return nil
+	}
+
+	if m.Value == nil {
+		return cbor.Unmarshal(data, &m.Value)
+	}
+
+	// make sure we are working with a pointer here
+	v := reflect.ValueOf(m.Value)
+	if v.Kind() != reflect.Ptr {
+		m.Value = reflect.New(v.Type()).Interface()
+	}
+
+	return cbor.Unmarshal(data, m.Value)
+}
+
+// UnmarshalXML decodes an XML encoded value or error. Untyped values are
+// decoded as the character data of the element.
+func (m *MaybeError) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	if start.Name.Local == "Error" {
+		var e cmdkit.Error
+		if err := d.DecodeElement(&e, &start); err != nil {
+			return err
+		}
+		m.isError = true
+		m.Error = &e
+		return nil
+	}
+
+	if start.Name.Local == ProgressValueType {
+		var f progressFrame
+		if err := d.DecodeElement(&f, &start); err != nil {
+			return err
+		}
+		m.setProgress(f.Value)
+		return nil
+	}
+
+	if m.Value == nil {
+		var s string
+		err := d.DecodeElement(&s, &start)
+		m.Value = s
+		return err
+	}
+
+	// make sure we are working with a pointer here
+	v := reflect.ValueOf(m.Value)
+	if v.Kind() != reflect.Ptr {
+		m.Value = reflect.New(v.Type()).Interface()
+	}
+
+	return d.DecodeElement(m.Value, &start)
+}
@@ -0,0 +1,251 @@
+package ws
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	cmdshttp "github.com/ipfs/go-ipfs-cmds/http"
+)
+
+// ErrUpgradeRefused is returned if the server answered a request as a plain
+// HTTP request, e.g. because it has no upgrader for WebSocket. The server
+// may have run the command nonetheless.
+var ErrUpgradeRefused = errors.New("websocket: the server refused to upgrade the connection")
+
+// errorBodyLimit limits the body of failed handshakes that is read for the
+// error message.
+const errorBodyLimit = 64 << 10
+
+type client struct {
+	serverURL    string
+	apiPrefix    string
+	header       http.Header
+	ua           string
+	pingInterval time.Duration
+	tlsConfig    *tls.Config
+}
+
+// ClientOpt configures the client returned by NewClient.
+type ClientOpt func(*client)
+
+// ClientWithAPIPrefix sets the prefix of the request paths, e.g. /api/v0.
+func ClientWithAPIPrefix(apiPrefix string) ClientOpt {
+	return func(c *client) {
+		c.apiPrefix = apiPrefix
+	}
+}
+
+// ClientWithHeader adds a header sent with every handshake, e.g. for the
+// authentication with a proxy.
+func ClientWithHeader(key, value string) ClientOpt {
+	return func(c *client) {
+		c.header.Add(key, value)
+	}
+}
+
+// ClientWithUserAgent sets the user agent sent with every handshake.
+func ClientWithUserAgent(ua string) ClientOpt {
+	return func(c *client) {
+		c.ua = ua
+	}
+}
+
+// ClientWithPingInterval sets the interval the client pings the server in.
+// The connection is considered lost if a response gets nothing for twice
+// the interval while it is read. It must be shorter than twice the interval
+// of the server. It defaults to DefaultPingInterval.
+func ClientWithPingInterval(d time.Duration) ClientOpt {
+	return func(c *client) {
+		c.pingInterval = d
+	}
+}
+
+// ClientWithTLSConfig sets the TLS configuration of connections to https://
+// and wss:// addresses.
+func ClientWithTLSConfig(cfg *tls.Config) ClientOpt {
+	return func(c *client) {
+		c.tlsConfig = cfg
+	}
+}
+
+// NewClient returns a client running commands on the server at address over
+// WebSocket. The address is an http://, https://, ws:// or wss:// URL, or a
+// host and port pair, which is connected to without TLS.
+//
+// Responses are decoded as they are read, every call of Next reads the next
+// message. Values the command emits as io.Readers are returned as readers,
+// which must be read before the next call of Next or their remaining output
+// is skipped. Canceling the context of the request closes the connection,
+// which cancels the command on the server.
+func NewClient(address string, opts ...ClientOpt) cmdshttp.Client {
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+
+	c := &client{
+		serverURL:    strings.TrimSuffix(address, "/"),
+		header:       make(http.Header),
+		ua:           "go-ipfs-cmds/ws",
+		pingInterval: DefaultPingInterval,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *client) Send(req *cmds.Request) (cmds.Response, error) {
+	if req.Context == nil {
+		log.Warningf("no context set in request")
+		req.Context = context.Background()
+	}
+	if req.Files != nil || req.BodyArgs() != nil {
+		return nil, errors.New("websocket requests can't carry files")
+	}
+
+	// values are sent as JSON unless XML is requested
+	prevEnc, found := req.Options[cmds.EncLong]
+	encType := cmds.GetEncoding(req, cmds.JSON)
+	if !textEncodings[encType] {
+		encType = cmds.JSON
+	}
+	req.SetOption(cmds.EncLong, string(encType))
+	req.SetOption(cmds.ChanOpt, true)
+
+	query, err := cmdshttp.RequestQuery(req)
+	if found {
+		req.SetOption(cmds.EncLong, prevEnc)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rawurl := c.serverURL + c.apiPrefix + "/" + strings.Join(req.Path, "/") + "?" + query
+	conn, err := c.dial(req.Context, rawurl)
+	if err != nil {
+		return nil, err
+	}
+	conn.readTimeout = 2 * c.pingInterval
+
+	return newResponse(conn, req, encType, c.pingInterval), nil
+}
+
+// dial connects to rawurl and completes the opening handshake.
+func (c *client) dial(ctx context.Context, rawurl string) (*conn, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	var useTLS bool
+	switch u.Scheme {
+	case "http", "ws":
+		u.Scheme = "http"
+	case "https", "wss":
+		u.Scheme, useTLS = "https", true
+	default:
+		return nil, errors.New("websocket: unsupported scheme " + u.Scheme)
+	}
+
+	addr := u.Host
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		port := "80"
+		if useTLS {
+			port = "443"
+		}
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	var nc net.Conn
+	if useTLS {
+		d := &tls.Dialer{Config: c.tlsConfig}
+		nc, err = d.DialContext(ctx, "tcp", addr)
+	} else {
+		d := &net.Dialer{}
+		nc, err = d.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// abort the handshake if ctx is canceled
+	stop := context.AfterFunc(ctx, func() {
+		nc.SetDeadline(time.Unix(1, 0))
+	})
+	defer stop()
+
+	conn, err := c.handshake(nc, u)
+	if err != nil {
+		nc.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (c *client) handshake(nc net.Conn, u *url.URL) (*conn, error) {
+	key := newKey()
+	hreq := &http.Request{
+		Method: http.MethodGet,
+		URL:    u,
+		Host:   u.Host,
+		Header: c.header.Clone(),
+	}
+	hreq.Header.Set("User-Agent", c.ua)
+	hreq.Header.Set("Upgrade", Protocol)
+	hreq.Header.Set("Connection", "Upgrade")
+	hreq.Header.Set(keyHeader, key)
+	hreq.Header.Set(versionHeader, version)
+	if err := hreq.Write(nc); err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(nc)
+	res, err := http.ReadResponse(br, hreq)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		defer res.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(res.Body, errorBodyLimit))
+		return nil, handshakeError(res.StatusCode, string(body))
+	}
+	if !headerHasToken(res.Header, "Upgrade", Protocol) || res.Header.Get(acceptHeader) != acceptKey(key) {
+		return nil, errors.New("websocket: invalid handshake response")
+	}
+
+	nc.SetDeadline(time.Time{})
+	return newConn(nc, br, true), nil
+}
+
+// handshakeError returns the error a server that didn't upgrade the
+// connection answered with.
+func handshakeError(status int, body string) error {
+	msg := strings.TrimSpace(body)
+	switch {
+	case status < http.StatusBadRequest:
+		return ErrUpgradeRefused
+	case status == http.StatusNotFound:
+		return &cmdkit.Error{Message: "Command not found.", Code: cmdkit.ErrClient}
+	case msg == "":
+		msg = http.StatusText(status)
+	}
+
+	code := cmdkit.ErrNormal
+	if status < http.StatusInternalServerError {
+		code = cmdkit.ErrClient
+	}
+	return &cmdkit.Error{Message: msg, Code: code}
+}
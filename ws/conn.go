@@ -0,0 +1,387 @@
+package ws
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// acceptGUID is appended to the key of the client to compute the
+// Sec-WebSocket-Accept header, see RFC 6455, section 1.3.
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	keyHeader     = "Sec-WebSocket-Key"
+	acceptHeader  = "Sec-WebSocket-Accept"
+	versionHeader = "Sec-WebSocket-Version"
+	version       = "13"
+)
+
+// Opcodes
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+// Close codes, see RFC 6455, section 7.4.1.
+const (
+	CloseNormal         = 1000
+	CloseGoingAway      = 1001
+	CloseProtocolError  = 1002
+	closeNoStatus       = 1005
+	closeInvalidPayload = 1007
+	CloseTooBig         = 1009
+)
+
+// DefaultMaxMessageSize is the size of the largest message a connection
+// reads.
+const DefaultMaxMessageSize = 32 << 20
+
+var (
+	errCloseSent = errors.New("websocket: close frame already sent")
+	errTooBig    = errors.New("websocket: message too big")
+)
+
+// CloseError is returned when the peer closed the connection. Code is the
+// close code it sent, or 1005 if it sent none.
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("websocket: closed with code %d", e.Code)
+	}
+	return fmt.Sprintf("websocket: closed with code %d: %s", e.Code, e.Reason)
+}
+
+type protocolError struct {
+	code int
+	msg  string
+}
+
+func (e *protocolError) Error() string {
+	return "websocket: " + e.msg
+}
+
+// conn is a WebSocket connection as defined by RFC 6455. It supports what
+// the command transport needs: text and binary messages, fragmented
+// messages from the peer, pings and the closing handshake. Extensions
+// aren't supported.
+//
+// Messages are read by a single goroutine, frames may be written
+// concurrently.
+type conn struct {
+	nc net.Conn
+	br *bufio.Reader
+	// client is whether this is the client end, which masks its frames.
+	client bool
+
+	// readTimeout, if set, is the time a frame must be received in. Peers
+	// send pings regularly, so it detects lost connections.
+	readTimeout    time.Duration
+	maxMessageSize int64
+
+	wl        sync.Mutex
+	closeSent bool
+}
+
+func newConn(nc net.Conn, br *bufio.Reader, client bool) *conn {
+	if br == nil {
+		br = bufio.NewReader(nc)
+	}
+	return &conn{nc: nc, br: br, client: client, maxMessageSize: DefaultMaxMessageSize}
+}
+
+func acceptKey(key string) string {
+	h := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// headerHasToken returns whether the comma-separated lists of the header key
+// in h contain token, ignoring case.
+func headerHasToken(h http.Header, key, token string) bool {
+	for _, v := range h.Values(key) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// accept completes the opening handshake of the WebSocket request r and
+// takes over its connection. If r isn't a valid handshake, it answers with
+// 400 Bad Request.
+func accept(w http.ResponseWriter, r *http.Request) (*conn, error) {
+	key := r.Header.Get(keyHeader)
+	var err error
+	switch {
+	case r.Method != http.MethodGet:
+		err = errors.New("websocket: the handshake must be a GET request")
+	case !headerHasToken(r.Header, "Upgrade", "websocket"):
+		err = errors.New("websocket: missing Upgrade: websocket header")
+	case r.Header.Get(versionHeader) != version:
+		err = errors.New("websocket: unsupported version")
+	case key == "":
+		err = errors.New("websocket: missing " + keyHeader + " header")
+	}
+	if err != nil {
+		w.Header().Set(versionHeader, version)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, err
+	}
+
+	nc, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, err
+	}
+	// clear the deadlines set by the server for HTTP requests
+	nc.SetDeadline(time.Time{})
+
+	res := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		acceptHeader + ": " + acceptKey(key) + "\r\n\r\n"
+	if _, err := io.WriteString(nc, res); err != nil {
+		nc.Close()
+		return nil, err
+	}
+
+	return newConn(nc, brw.Reader, false), nil
+}
+
+// newKey returns a random Sec-WebSocket-Key.
+func newKey() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return base64.StdEncoding.EncodeToString(b[:])
+}
+
+func (c *conn) readFrame() (fin bool, op byte, payload []byte, err error) {
+	if c.readTimeout > 0 {
+		c.nc.SetReadDeadline(time.Now().Add(c.readTimeout))
+	}
+
+	var h [2]byte
+	if _, err := io.ReadFull(c.br, h[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin, op = h[0]&0x80 != 0, h[0]&0x0f
+	if h[0]&0x70 != 0 {
+		return false, 0, nil, &protocolError{CloseProtocolError, "reserved bits set"}
+	}
+	// clients mask their frames, servers don't
+	if masked := h[1]&0x80 != 0; masked == c.client {
+		return false, 0, nil, &protocolError{CloseProtocolError, "bad frame masking"}
+	}
+
+	n := uint64(h[1] & 0x7f)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, unexpected(err)
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, unexpected(err)
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if op >= opClose && (n > 125 || !fin) {
+		return false, 0, nil, &protocolError{CloseProtocolError, "invalid control frame"}
+	}
+	if n > uint64(c.maxMessageSize) {
+		return false, 0, nil, errTooBig
+	}
+
+	var key [4]byte
+	if !c.client {
+		if _, err := io.ReadFull(c.br, key[:]); err != nil {
+			return false, 0, nil, unexpected(err)
+		}
+	}
+
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, unexpected(err)
+	}
+	if !c.client {
+		for i := range payload {
+			payload[i] ^= key[i%4]
+		}
+	}
+	return fin, op, payload, nil
+}
+
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// readMessage returns the next text or binary message. It answers pings
+// and closes on the way; if the peer closed the connection, it returns a
+// *CloseError. Protocol errors of the peer close the connection.
+func (c *conn) readMessage() (op byte, msg []byte, err error) {
+	op, msg, err = c.nextMessage()
+	if err != nil {
+		var perr *protocolError
+		switch {
+		case errors.As(err, &perr):
+			c.writeClose(perr.code, "")
+		case err == errTooBig:
+			c.writeClose(CloseTooBig, "")
+		}
+	}
+	return op, msg, err
+}
+
+func (c *conn) nextMessage() (byte, []byte, error) {
+	var (
+		msgOp byte
+		msg   []byte
+	)
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch op {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil && err != errCloseSent {
+				return 0, nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			return 0, nil, c.closed(payload)
+		case opText, opBinary:
+			if msgOp != 0 {
+				return 0, nil, &protocolError{CloseProtocolError, "expected a continuation frame"}
+			}
+			msgOp, msg = op, payload
+		case opContinuation:
+			if msgOp == 0 {
+				return 0, nil, &protocolError{CloseProtocolError, "unexpected continuation frame"}
+			}
+			if int64(len(msg)+len(payload)) > c.maxMessageSize {
+				return 0, nil, errTooBig
+			}
+			msg = append(msg, payload...)
+		default:
+			return 0, nil, &protocolError{CloseProtocolError, fmt.Sprintf("unknown opcode %d", op)}
+		}
+
+		if fin {
+			if msgOp == opText && !utf8.Valid(msg) {
+				return 0, nil, &protocolError{closeInvalidPayload, "invalid UTF-8 in text message"}
+			}
+			return msgOp, msg, nil
+		}
+	}
+}
+
+// closed handles a close frame of the peer: it echoes the close code if it
+// didn't close the connection itself, and returns the *CloseError.
+func (c *conn) closed(payload []byte) error {
+	e := &CloseError{Code: closeNoStatus}
+	switch {
+	case len(payload) == 1:
+		return &protocolError{CloseProtocolError, "invalid close frame"}
+	case len(payload) >= 2:
+		e.Code = int(binary.BigEndian.Uint16(payload))
+		e.Reason = string(payload[2:])
+	}
+
+	code := e.Code
+	if code == closeNoStatus {
+		code = CloseNormal
+	}
+	c.writeClose(code, "")
+	return e
+}
+
+func (c *conn) ping() error {
+	return c.writeFrame(opPing, nil)
+}
+
+// writeClose starts or completes the closing handshake. No frames can be
+// sent afterwards.
+func (c *conn) writeClose(code int, reason string) error {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	return c.writeFrame(opClose, append(payload, reason...))
+}
+
+func (c *conn) writeFrame(op byte, payload []byte) error {
+	c.wl.Lock()
+	defer c.wl.Unlock()
+
+	if c.closeSent {
+		return errCloseSent
+	}
+	if op == opClose {
+		c.closeSent = true
+	}
+
+	frame := make([]byte, 0, 14+len(payload))
+	frame = append(frame, 0x80|op)
+
+	var mask byte
+	if c.client {
+		mask = 0x80
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, mask|byte(n))
+	case n <= 0xffff:
+		frame = append(frame, mask|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, mask|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+
+	if !c.client {
+		frame = append(frame, payload...)
+	} else {
+		var key [4]byte
+		rand.Read(key[:])
+		frame = append(frame, key[:]...)
+		for i, b := range payload {
+			frame = append(frame, b^key[i%4])
+		}
+	}
+
+	_, err := c.nc.Write(frame)
+	return err
+}
+
+func (c *conn) close() error {
+	return c.nc.Close()
+}
@@ -0,0 +1,196 @@
+package ws
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+// message is a text or binary message.
+type message struct {
+	op   byte
+	data []byte
+}
+
+// response reads the values sent over a WebSocket connection.
+type response struct {
+	conn    *conn
+	req     *cmds.Request
+	encType cmds.EncodingType
+
+	// stop ends the keepalive and the cancellation of the connection with
+	// the context of the request.
+	stop     chan struct{}
+	stopOnce sync.Once
+	unwatch  func() bool
+
+	err *cmdkit.Error
+	// raw is the reader of the output the last call of Next returned, nil
+	// if it returned a value.
+	raw *rawReader
+	// pending is the message read after the end of raw.
+	pending *message
+	// end is the error subsequent reads return once the connection was
+	// closed: io.EOF if the server closed it normally.
+	end error
+}
+
+func newResponse(c *conn, req *cmds.Request, encType cmds.EncodingType, pingInterval time.Duration) *response {
+	res := &response{
+		conn:    c,
+		req:     req,
+		encType: encType,
+		stop:    make(chan struct{}),
+	}
+
+	go keepalive(c, pingInterval, res.stop)
+	// closing the connection tells the server to cancel the command
+	res.unwatch = context.AfterFunc(req.Context, func() {
+		c.writeClose(CloseGoingAway, "")
+		c.close()
+	})
+
+	return res
+}
+
+func (res *response) Request() *cmds.Request {
+	return res.req
+}
+
+func (res *response) Error() *cmdkit.Error {
+	return res.err
+}
+
+// Length returns 0, WebSocket responses carry no length.
+func (res *response) Length() uint64 {
+	return 0
+}
+
+func (res *response) Next() (interface{}, error) {
+	cmd := res.req.Command
+	var value interface{}
+	if cmd != nil {
+		value = cmd.Type
+		if cmd.Types != nil {
+			value = cmds.NewValue(cmd)
+		}
+	}
+	return res.NextInto(value)
+}
+
+// NextInto decodes the next value into value, see cmds.Typed.
+func (res *response) NextInto(value interface{}) (interface{}, error) {
+	if res.raw != nil {
+		// skip the rest of the output the caller didn't read
+		io.Copy(io.Discard, res.raw)
+		res.raw = nil
+	}
+
+	op, data, err := res.next()
+	if err != nil {
+		return nil, err
+	}
+	if op == opBinary {
+		res.raw = &rawReader{res: res, buf: data}
+		return res.raw, nil
+	}
+
+	m := &cmds.MaybeError{Value: value}
+	if err := cmds.Decoders[res.encType](bytes.NewReader(data)).Decode(m); err != nil {
+		return nil, err
+	}
+
+	v, err := m.Get()
+	if err != nil {
+		if e, ok := err.(*cmdkit.Error); ok {
+			res.err = e
+		}
+		return nil, err
+	}
+	if u, ok := v.(cmds.Unwrapper); ok {
+		v = u.Unwrap()
+	}
+
+	// because working with pointers to arrays is annoying
+	if t := reflect.TypeOf(v); t != nil && t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Slice {
+		v = reflect.ValueOf(v).Elem().Interface()
+	}
+	return v, nil
+}
+
+// next returns the next message.
+func (res *response) next() (byte, []byte, error) {
+	if m := res.pending; m != nil {
+		res.pending = nil
+		return m.op, m.data, nil
+	}
+	if res.end != nil {
+		return 0, nil, res.end
+	}
+
+	op, data, err := res.conn.readMessage()
+	if err != nil {
+		res.finish(err)
+		return 0, nil, res.end
+	}
+	return op, data, nil
+}
+
+// finish closes the connection after reading it failed with err.
+func (res *response) finish(err error) {
+	var ce *CloseError
+	switch {
+	case errors.As(err, &ce) && ce.Code == CloseNormal:
+		res.end = io.EOF
+	case res.req.Context.Err() != nil:
+		res.end = res.req.Context.Err()
+	default:
+		res.end = err
+	}
+
+	res.stopOnce.Do(func() {
+		close(res.stop)
+		res.unwatch()
+	})
+	res.conn.close()
+}
+
+// rawReader reads the output of a reader emitted by the command, which is
+// sent in consecutive binary messages.
+type rawReader struct {
+	res *response
+	buf []byte
+	eof bool
+}
+
+func (r *rawReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.eof {
+			return 0, io.EOF
+		}
+
+		op, data, err := r.res.next()
+		if err != nil {
+			r.eof = true
+			return 0, err
+		}
+		if op != opBinary {
+			// the message belongs to the next call of Next
+			r.res.pending = &message{op, data}
+			r.eof = true
+			return 0, io.EOF
+		}
+		r.buf = data
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
@@ -0,0 +1,298 @@
+package ws
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/go-ipfs-cmds/debug"
+	cmdshttp "github.com/ipfs/go-ipfs-cmds/http"
+)
+
+// DefaultPingInterval is the default interval servers and clients ping the
+// other end of the connection in.
+const DefaultPingInterval = 30 * time.Second
+
+// closeTimeout is the time the peer has to complete the closing handshake.
+const closeTimeout = 5 * time.Second
+
+// chunkSize is the size of the binary messages the output of readers is
+// sent in.
+const chunkSize = 32 << 10
+
+// textEncodings are the encodings values can be sent with: their output is
+// text and clients can decode it.
+var textEncodings = map[cmds.EncodingType]bool{
+	cmds.JSON: true,
+	cmds.XML:  true,
+}
+
+type upgrader struct {
+	pingInterval time.Duration
+}
+
+// UpgraderOpt configures the upgrader returned by NewUpgrader.
+type UpgraderOpt func(*upgrader)
+
+// UpgraderWithPingInterval sets the interval the server pings clients in. A
+// connection is dropped if the client sends nothing for twice the interval,
+// so clients must ping at least that often. It defaults to
+// DefaultPingInterval.
+func UpgraderWithPingInterval(d time.Duration) UpgraderOpt {
+	return func(u *upgrader) {
+		u.pingInterval = d
+	}
+}
+
+// NewUpgrader returns an upgrader serving commands over WebSocket, to be
+// registered as the upgrader for the Protocol in the Upgraders of the
+// ServerConfig of the HTTP handler.
+func NewUpgrader(opts ...UpgraderOpt) cmdshttp.Upgrader {
+	u := &upgrader{pingInterval: DefaultPingInterval}
+	for _, opt := range opts {
+		opt(u)
+	}
+	return u
+}
+
+func (u *upgrader) Upgrade(w http.ResponseWriter, r *http.Request, req *cmds.Request) (cmds.ResponseEmitter, error) {
+	encType := cmds.GetEncoding(req, cmds.JSON)
+	if !textEncodings[encType] {
+		err := fmt.Errorf("encoding %q can't be used over WebSocket, use json or xml", encType)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, err
+	}
+
+	re := &responseEmitter{
+		req:     req,
+		encType: encType,
+		done:    make(chan struct{}),
+	}
+	_, enc, err := cmds.GetEncoder(req, &re.buf, cmds.JSON)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, err
+	}
+	re.enc = enc
+
+	c, err := accept(w, r)
+	if err != nil {
+		return nil, err
+	}
+	c.readTimeout = 2 * u.pingInterval
+	re.conn = c
+
+	// the command is canceled when the client closes the connection or
+	// stops answering
+	req.Context, re.cancel = context.WithCancel(req.Context)
+	go re.readLoop()
+	go keepalive(c, u.pingInterval, re.done)
+
+	return re, nil
+}
+
+// keepalive pings the other end of c every interval until stop is closed.
+func keepalive(c *conn, interval time.Duration, stop <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			if err := c.ping(); err != nil {
+				return
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// responseEmitter sends values over a WebSocket connection. Encoded values
+// are sent as text messages, one value per message, and the output of
+// readers as binary messages.
+type responseEmitter struct {
+	conn    *conn
+	req     *cmds.Request
+	encType cmds.EncodingType
+	// enc encodes values into buf, which is sent as a message.
+	enc cmds.Encoder
+	buf bytes.Buffer
+
+	// done is closed once the client closed the connection or the
+	// connection was lost.
+	done   chan struct{}
+	cancel context.CancelFunc
+
+	l      sync.Mutex
+	closed bool
+}
+
+// readLoop reads the frames of the client, answering pings and closes,
+// until the connection is closed. Messages of the client are ignored.
+func (re *responseEmitter) readLoop() {
+	defer close(re.done)
+	defer re.cancel()
+
+	for {
+		if _, _, err := re.conn.readMessage(); err != nil {
+			if _, ok := err.(*CloseError); !ok {
+				log.Debugf("websocket connection of %q lost: %s", re.req.Path, err)
+			}
+			return
+		}
+	}
+}
+
+func (re *responseEmitter) Emit(value interface{}) error {
+	debug.AssertNotError(value)
+
+	// if we got a channel, instead emit values received on there.
+	if ch, ok := value.(chan interface{}); ok {
+		value = (<-chan interface{})(ch)
+	}
+	if ch, isChan := value.(<-chan interface{}); isChan {
+		return cmds.EmitChan(re, ch)
+	}
+	defer cmds.CloseReader(value)
+
+	re.l.Lock()
+	defer re.l.Unlock()
+
+	if re.closed {
+		return cmds.ErrClosedEmitter
+	}
+
+	// ignore those
+	if value == nil {
+		return nil
+	}
+
+	var isSingle bool
+	if single, ok := value.(cmds.Single); ok {
+		value = single.Value
+		isSingle = true
+	}
+
+	var err error
+	switch v := value.(type) {
+	case error:
+		return re.closeWithError(v)
+	case *cmds.Progress:
+		if tagged, ok := cmds.TagProgress(re.req, re.encType, v); ok {
+			err = re.encode(tagged)
+		}
+	case cmds.Attachment:
+		if err = re.encode(v.Value); err == nil {
+			err = re.copy(v.Data)
+		}
+	case io.Reader:
+		err = re.copy(v)
+	default:
+		err = re.encode(value)
+	}
+
+	if isSingle && err == nil {
+		err = re.closeWithError(nil)
+	}
+
+	return err
+}
+
+// encode sends v in a text message.
+func (re *responseEmitter) encode(v interface{}) error {
+	re.buf.Reset()
+	streamed, err := cmds.StreamValue(re.req, &re.buf, re.enc, re.encType, v)
+	if !streamed {
+		err = re.enc.Encode(cmds.TagValue(re.req, re.encType, v))
+	}
+	if err != nil {
+		return err
+	}
+	return re.conn.writeFrame(opText, re.buf.Bytes())
+}
+
+// copy sends the output of r in binary messages.
+func (re *responseEmitter) copy(r io.Reader) error {
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if werr := re.conn.writeFrame(opBinary, buf[:n]); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// SetLength does nothing, WebSocket responses carry no length.
+func (re *responseEmitter) SetLength(l uint64) {}
+
+func (re *responseEmitter) Close() error {
+	return re.CloseWithError(nil)
+}
+
+func (re *responseEmitter) CloseWithError(err error) error {
+	re.l.Lock()
+	defer re.l.Unlock()
+
+	return re.closeWithError(err)
+}
+
+// closeWithError sends err, if any, in the error envelope of the encoding,
+// and closes the connection once the client completed the closing
+// handshake.
+func (re *responseEmitter) closeWithError(err error) error {
+	if re.closed {
+		return cmds.ErrClosingClosedEmitter
+	}
+	re.closed = true
+
+	var e *cmdkit.Error
+	switch v := err.(type) {
+	case nil:
+	case *cmdkit.Error:
+		e = v
+	case cmdkit.Error:
+		e = &v
+	case *cmds.CodedError:
+		e = v.CmdkitError()
+	default:
+		// io.EOF is not a real error
+		if err != io.EOF {
+			e = &cmdkit.Error{Message: err.Error(), Code: cmdkit.ErrNormal}
+		}
+	}
+
+	if e != nil {
+		_, data, mErr := cmds.MarshalError(re.encType, e)
+		if mErr != nil {
+			log.Error("error marshaling error value: ", mErr)
+		} else if wErr := re.conn.writeFrame(opText, data); wErr != nil {
+			log.Debugf("error sending error to the client: %s", wErr)
+		}
+	}
+
+	if err := re.conn.writeClose(CloseNormal, ""); err == nil {
+		select {
+		case <-re.done:
+		case <-time.After(closeTimeout):
+		}
+	}
+	re.conn.close()
+	<-re.done
+
+	return nil
+}
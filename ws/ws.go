@@ -0,0 +1,32 @@
+/*
+Package ws serves commands over WebSocket connections, for streaming
+commands such as log tailing or subscriptions whose responses would be cut
+off by proxies that buffer or time out long HTTP responses.
+
+Clients ask the HTTP handler to upgrade a request to WebSocket with the
+Upgrade header. The handler passes these requests to the upgrader
+registered for the Protocol:
+
+	cfg := cmdshttp.NewServerConfig()
+	cfg.Upgraders = map[string]cmdshttp.Upgrader{ws.Protocol: ws.NewUpgrader()}
+
+The request is sent like an HTTP request, with the options and arguments
+in the query of a GET request; requests can't carry files. Once upgraded,
+every value the command emits is sent in a text message, encoded with JSON
+or XML, and the output of commands emitting an io.Reader in binary
+messages. An error the command fails with is sent in the error envelope of
+the encoding before the server closes the connection.
+
+Both ends ping each other, so connections through proxies that close idle
+connections stay open and lost connections cancel the command.
+*/
+package ws
+
+import (
+	logging "github.com/ipfs/go-log"
+)
+
+var log = logging.Logger("cmds/ws")
+
+// Protocol is the name of the WebSocket protocol in the Upgrade header.
+const Protocol = "websocket"
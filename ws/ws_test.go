@@ -0,0 +1,369 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	cmdshttp "github.com/ipfs/go-ipfs-cmds/http"
+)
+
+type env struct{}
+
+func (env) Context() context.Context {
+	return context.Background()
+}
+
+type tick struct {
+	N int
+}
+
+// canceled receives the error of the context of the wait command.
+var canceled = make(chan error, 1)
+
+var root = &cmds.Command{
+	Subcommands: map[string]*cmds.Command{
+		"ticks": {
+			Arguments: []cmdkit.Argument{
+				cmdkit.StringArg("fail", false, false, "the error to fail with"),
+			},
+			Type: tick{},
+			Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+				for i := 0; i < 3; i++ {
+					if err := re.Emit(&tick{i}); err != nil {
+						return err
+					}
+				}
+				if len(req.Arguments) > 0 {
+					return cmdkit.Errorf(cmdkit.ErrClient, "%s", req.Arguments[0])
+				}
+				return nil
+			},
+		},
+		"cat": {
+			Type: tick{},
+			Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+				r := strings.NewReader(strings.Repeat("x", chunkSize+10))
+				if err := re.Emit(r); err != nil {
+					return err
+				}
+				return re.Emit(&tick{42})
+			},
+		},
+		"progress": {
+			Type: tick{},
+			Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+				if err := cmds.EmitProgress(re, 1, 2, "ticking"); err != nil {
+					return err
+				}
+				return re.Emit(&tick{2})
+			},
+		},
+		"wait": {
+			Type: tick{},
+			Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+				if err := re.Emit(&tick{1}); err != nil {
+					return err
+				}
+				<-req.Context.Done()
+				canceled <- req.Context.Err()
+				return req.Context.Err()
+			},
+		},
+	},
+}
+
+func newServer(t *testing.T, opts ...UpgraderOpt) *httptest.Server {
+	cfg := cmdshttp.NewServerConfig()
+	cfg.SetAllowedOrigins("*")
+	cfg.Upgraders = map[string]cmdshttp.Upgrader{Protocol: NewUpgrader(opts...)}
+	srv := httptest.NewServer(cmdshttp.NewHandler(env{}, root, cfg))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func send(t *testing.T, c cmdshttp.Client, ctx context.Context, path string, args ...string) cmds.Response {
+	t.Helper()
+	req, err := cmds.NewRequest(ctx, []string{path}, nil, args, nil, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := c.Send(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestStreamValues(t *testing.T) {
+	srv := newServer(t)
+
+	for _, enc := range []cmds.EncodingType{cmds.JSON, cmds.XML} {
+		req, err := cmds.NewRequest(context.Background(), []string{"ticks"}, cmdkit.OptMap{cmds.EncLong: string(enc)}, nil, nil, root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := NewClient(srv.URL).Send(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 3; i++ {
+			v, err := res.Next()
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %s", enc, err)
+			}
+			if tk, ok := v.(*tick); !ok || tk.N != i {
+				t.Errorf("%s: expected tick %d but got %#v", enc, i, v)
+			}
+		}
+		if _, err := res.Next(); err != io.EOF {
+			t.Errorf("%s: expected io.EOF but got %v", enc, err)
+		}
+	}
+}
+
+func TestStreamError(t *testing.T) {
+	srv := newServer(t)
+	res := send(t, NewClient(srv.URL), context.Background(), "ticks", "some error")
+
+	for i := 0; i < 3; i++ {
+		if _, err := res.Next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := res.Next()
+	if e, ok := err.(*cmdkit.Error); !ok || e.Message != "some error" || e.Code != cmdkit.ErrClient {
+		t.Errorf("expected the error of the command, got %#v", err)
+	}
+	if res.Error() == nil || res.Error().Message != "some error" {
+		t.Errorf("expected Error to return the error, got %v", res.Error())
+	}
+	if _, err := res.Next(); err != io.EOF {
+		t.Errorf("expected io.EOF after the error, got %v", err)
+	}
+}
+
+func TestStreamReader(t *testing.T) {
+	srv := newServer(t)
+	res := send(t, NewClient(srv.URL), context.Background(), "cat")
+
+	v, err := res.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, ok := v.(io.Reader)
+	if !ok {
+		t.Fatalf("expected a reader, got %#v", v)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != chunkSize+10 {
+		t.Errorf("expected %d bytes but got %d", chunkSize+10, len(data))
+	}
+
+	v, err = res.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tk, ok := v.(*tick); !ok || tk.N != 42 {
+		t.Errorf("expected the value after the output, got %#v", v)
+	}
+}
+
+func TestStreamProgress(t *testing.T) {
+	srv := newServer(t)
+	res := send(t, NewClient(srv.URL), context.Background(), "progress")
+
+	v, err := res.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, ok := v.(*cmds.Progress); !ok || *p != (cmds.Progress{Current: 1, Total: 2, Message: "ticking"}) {
+		t.Errorf("expected the progress, got %#v", v)
+	}
+	v, err = res.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tk, ok := v.(*tick); !ok || tk.N != 2 {
+		t.Errorf("expected the value after the progress, got %#v", v)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	srv := newServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	res := send(t, NewClient(srv.URL), ctx, "wait")
+
+	if _, err := res.Next(); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+
+	select {
+	case err := <-canceled:
+		if err != context.Canceled {
+			t.Errorf("expected the command to be canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the command wasn't canceled")
+	}
+	if _, err := res.Next(); err != context.Canceled {
+		t.Errorf("expected the response to end with the cancellation, got %v", err)
+	}
+}
+
+func TestKeepalive(t *testing.T) {
+	interval := 20 * time.Millisecond
+	srv := newServer(t, UpgraderWithPingInterval(interval))
+	c := NewClient(srv.URL, ClientWithPingInterval(interval)).(*client)
+
+	// a client pinging the server keeps the command running
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	res := send(t, c, ctx, "wait")
+	if _, err := res.Next(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-canceled:
+		t.Fatalf("the command was canceled: %v", err)
+	case <-time.After(10 * interval):
+	}
+	cancel()
+	<-canceled
+
+	// a client that went silent is dropped
+	req, err := cmds.NewRequest(context.Background(), []string{"wait"}, nil, nil, nil, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := c.dial(context.Background(), srv.URL+"/wait?"+mustQuery(t, req))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.close()
+
+	select {
+	case err := <-canceled:
+		if err != context.Canceled {
+			t.Errorf("expected the command to be canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the command of the silent client wasn't canceled")
+	}
+}
+
+func mustQuery(t *testing.T, req *cmds.Request) string {
+	t.Helper()
+	q, err := cmdshttp.RequestQuery(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+func TestHandshakeErrors(t *testing.T) {
+	srv := newServer(t)
+
+	req, err := cmds.NewRequest(context.Background(), []string{"ticks"}, cmdkit.OptMap{cmds.EncLong: cmds.Text}, nil, nil, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the client replaces encodings that can't be used with JSON
+	if _, err := NewClient(srv.URL).Send(req); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	c := NewClient(srv.URL).(*client)
+	_, err = c.dial(context.Background(), srv.URL+"/ticks?encoding=text")
+	if e, ok := err.(*cmdkit.Error); !ok || e.Code != cmdkit.ErrClient || !strings.Contains(e.Message, "can't be used") {
+		t.Errorf("expected the server to refuse the encoding, got %v", err)
+	}
+
+	req, err = cmds.NewRequest(context.Background(), []string{"ticks"}, nil, nil, nil, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewClient(srv.URL, ClientWithAPIPrefix("/missing")).Send(req)
+	if e, ok := err.(*cmdkit.Error); !ok || e.Code != cmdkit.ErrClient {
+		t.Errorf("expected a client error for a missing command, got %v", err)
+	}
+
+	// servers without upgrader answer over HTTP
+	plain := httptest.NewServer(cmdshttp.NewHandler(env{}, root, cmdshttp.NewServerConfig()))
+	defer plain.Close()
+	if _, err := NewClient(plain.URL).Send(req); err != ErrUpgradeRefused {
+		t.Errorf("expected %v but got %v", ErrUpgradeRefused, err)
+	}
+}
+
+func TestConnFragmentsAndPings(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	server, client := newConn(a, nil, false), newConn(b, nil, true)
+
+	go func() {
+		// a fragmented text message with a ping in between, as a client
+		// sends it
+		frames := [][]byte{
+			maskedFrame(opText, false, "hel"),
+			maskedFrame(opPing, true, "p"),
+			maskedFrame(opContinuation, true, "lo"),
+		}
+		for _, f := range frames {
+			b.Write(f)
+		}
+	}()
+
+	pong := make(chan error, 1)
+	go func() {
+		fin, op, payload, err := client.readFrame()
+		if err == nil && (!fin || op != opPong || string(payload) != "p") {
+			err = errors.New("unexpected frame")
+		}
+		pong <- err
+	}()
+
+	op, msg, err := server.readMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if op != opText || string(msg) != "hello" {
+		t.Errorf("expected the text message \"hello\", got %d %q", op, msg)
+	}
+	if err := <-pong; err != nil {
+		t.Errorf("expected the ping to be answered: %s", err)
+	}
+}
+
+func maskedFrame(op byte, fin bool, payload string) []byte {
+	b0 := op
+	if fin {
+		b0 |= 0x80
+	}
+	key := []byte{1, 2, 3, 4}
+	frame := append([]byte{b0, 0x80 | byte(len(payload))}, key...)
+	for i := 0; i < len(payload); i++ {
+		frame = append(frame, payload[i]^key[i%4])
+	}
+	return frame
+}
+
+func TestAcceptKey(t *testing.T) {
+	// the example of RFC 6455, section 1.3
+	if k := acceptKey("dGhlIHNhbXBsZSBub25jZQ=="); k != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("unexpected accept key %q", k)
+	}
+}
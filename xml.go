@@ -0,0 +1,92 @@
+package cmds
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+)
+
+// NewXMLDocumentEncoder returns an XML encoder that wraps the encoded values
+// in a root element with the given name, so a streamed response is a single
+// well-formed document instead of concatenated fragments. The start tag is
+// written with the first value and the closing tag by Close, which emitters
+// call through CloseEncoder when they are closed.
+//
+// The XML encoding uses it if the XMLRootOpt option is set. Decoders of
+// such output have to read the root element first.
+func NewXMLDocumentEncoder(w io.Writer, root string) Encoder {
+	return &xmlDocumentEncoder{enc: xml.NewEncoder(w), root: xml.Name{Local: root}}
+}
+
+type xmlDocumentEncoder struct {
+	enc     *xml.Encoder
+	root    xml.Name
+	started bool
+	closed  bool
+}
+
+func (e *xmlDocumentEncoder) start() error {
+	if e.started {
+		return nil
+	}
+	if !validXMLName(e.root.Local) {
+		return cmdkit.Errorf(cmdkit.ErrClient, "invalid XML root element name: %q", e.root.Local)
+	}
+
+	e.started = true
+	return e.enc.EncodeToken(xml.StartElement{Name: e.root})
+}
+
+func (e *xmlDocumentEncoder) Encode(v interface{}) error {
+	if e.closed {
+		return ErrClosedEmitter
+	}
+	if err := e.start(); err != nil {
+		return err
+	}
+	return e.enc.Encode(v)
+}
+
+func (e *xmlDocumentEncoder) prepareStream() error {
+	if e.closed {
+		return ErrClosedEmitter
+	}
+	if err := e.start(); err != nil {
+		return err
+	}
+	return e.enc.Flush()
+}
+
+// Close writes the closing tag of the root element. Documents without values
+// consist of an empty root element.
+func (e *xmlDocumentEncoder) Close() error {
+	if e.closed {
+		return nil
+	}
+	if err := e.start(); err != nil {
+		return err
+	}
+
+	e.closed = true
+	if err := e.enc.EncodeToken(xml.EndElement{Name: e.root}); err != nil {
+		return err
+	}
+	return e.enc.Flush()
+}
+
+// validXMLName reports whether name can be used as the name of an element
+// without a namespace prefix.
+func validXMLName(name string) bool {
+	if name == "" || strings.ContainsAny(name, ":<>&'\"= \t\r\n/") {
+		return false
+	}
+
+	tok, err := xml.NewDecoder(strings.NewReader("<" + name + "/>")).Token()
+	if err != nil {
+		return false
+	}
+	start, ok := tok.(xml.StartElement)
+	return ok && start.Name.Local == name
+}
@@ -0,0 +1,82 @@
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"testing"
+)
+
+func TestXMLDocumentEncoder(t *testing.T) {
+	type entry struct {
+		Name string
+	}
+
+	var buf bytes.Buffer
+	enc := NewXMLDocumentEncoder(&buf, "Entries")
+	for _, name := range []string{"a", "<b & c>"} {
+		if err := enc.Encode(entry{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := CloseEncoder(enc); err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		XMLName xml.Name `xml:"Entries"`
+		Entries []entry  `xml:"entry"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("expected a well-formed document, got %q: %s", buf.String(), err)
+	}
+	if len(doc.Entries) != 2 || doc.Entries[1].Name != "<b & c>" {
+		t.Errorf("unexpected entries %v in %q", doc.Entries, buf.String())
+	}
+
+	// the document must end with the root element
+	dec := xml.NewDecoder(&buf)
+	for {
+		if _, err := dec.Token(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buf.Reset()
+	if err := CloseEncoder(NewXMLDocumentEncoder(&buf, "Empty")); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "<Empty></Empty>" {
+		t.Errorf("unexpected empty document %q", buf.String())
+	}
+
+	if err := NewXMLDocumentEncoder(&buf, "not a name").Encode(entry{}); err == nil {
+		t.Error("expected an error for an invalid root element name")
+	}
+}
+
+func TestXMLRootOption(t *testing.T) {
+	req, err := NewRequest(context.Background(), nil, map[string]interface{}{EncLong: XML, XMLRootOpt: "Out"}, nil, nil, &Command{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	re, err := NewWriterResponseEmitter(wc{&buf, nopCloser{}}, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := re.Emit("value"); err != nil {
+		t.Fatal(err)
+	}
+	if err := re.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.String() != "<Out><string>value</string></Out>" {
+		t.Errorf("unexpected output %q", buf.String())
+	}
+}